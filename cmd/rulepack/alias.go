@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/config"
+)
+
+// builtinAliases are available without any configuration. An alias of the
+// same name in the user config replaces them.
+var builtinAliases = map[string]string{
+	"sync": "deps install && build",
+}
+
+// addAliasCmds registers the built-in aliases and the aliases in the user
+// config as commands of root. An alias named like an existing command is
+// ignored, and a user config that fails to load contributes no aliases; the
+// commands that read it report the error.
+func (a *app) addAliasCmds(root *cobra.Command) {
+	aliases := maps.Clone(builtinAliases)
+	if userCfg, err := config.LoadUserConfig(); err == nil {
+		maps.Copy(aliases, userCfg.Aliases)
+	}
+	for _, name := range slices.Sorted(maps.Keys(aliases)) {
+		if cmd, _, err := root.Find([]string{name}); err == nil && cmd != root {
+			continue
+		}
+		root.AddCommand(a.newAliasCmd(name, aliases[name]))
+	}
+}
+
+// newAliasCmd runs each command of cmdline in turn through a fresh root
+// command, stopping at the first that fails. Global flags given anywhere on
+// the command line apply to every command; other arguments are appended to
+// the last one.
+func (a *app) newAliasCmd(name, cmdline string) *cobra.Command {
+	return &cobra.Command{
+		Use:                name + " [args...]",
+		Short:              "Alias for: rulepack " + cmdline,
+		Long:               "Run rulepack " + cmdline + ", stopping at the first command that fails. Global flags apply to every command; other arguments are passed to the last one.",
+		DisableFlagParsing: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			// Flag parsing is off so step flags pass through untouched; parse
+			// the global ones here so errors render as the user asked.
+			root := cmd.Root()
+			globals, _ := splitGlobalFlags(root, args)
+			if err := root.ParseFlags(globals); err != nil {
+				return err
+			}
+			return root.PersistentPreRunE(root, nil)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			steps, err := config.AliasSteps(cmdline)
+			if err != nil {
+				return fmt.Errorf("alias %s: %w", name, err)
+			}
+			globals, rest := splitGlobalFlags(cmd.Root(), args)
+			// Help must not reach a step, or the steps before it would run.
+			for _, arg := range rest {
+				if arg == "--" {
+					break
+				}
+				if arg == "-h" || arg == "--help" {
+					return cmd.Help()
+				}
+			}
+			for i, step := range steps {
+				stepArgs := append(slices.Clone(globals), step...)
+				if i == len(steps)-1 {
+					stepArgs = append(stepArgs, rest...)
+				}
+				sub := &app{out: a.out, inAlias: true}
+				root := sub.newRootCmd(stepArgs)
+				root.SetContext(cmd.Context())
+				root.SetIn(cmd.InOrStdin())
+				root.SetOut(cmd.OutOrStdout())
+				root.SetErr(cmd.ErrOrStderr())
+				if err := root.Execute(); err != nil {
+					_ = sub.recordAudit(err)
+					return fmt.Errorf("rulepack %s: %w", strings.Join(step, " "), err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// splitGlobalFlags separates root's persistent flags in args, with their
+// values, from everything else. Arguments after -- are never flags.
+func splitGlobalFlags(root *cobra.Command, args []string) (globals, rest []string) {
+	flags := root.PersistentFlags()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		long, isLong := strings.CutPrefix(arg, "--")
+		name, _, hasValue := strings.Cut(long, "=")
+		f := flags.Lookup(name)
+		if !isLong {
+			f, hasValue = nil, len(arg) > 2
+			if len(arg) > 1 && arg[0] == '-' {
+				f = flags.ShorthandLookup(arg[1:2])
+			}
+		}
+		if f == nil {
+			rest = append(rest, arg)
+			continue
+		}
+		globals = append(globals, arg)
+		if !hasValue && f.NoOptDefVal == "" && i+1 < len(args) {
+			i++
+			globals = append(globals, args[i])
+		}
+	}
+	return globals, rest
+}
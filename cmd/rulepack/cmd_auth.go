@@ -0,0 +1,278 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"rulepack/internal/auth"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+var newAuthStore = func(cmd *cobra.Command) *auth.Store {
+	store := auth.NewStore()
+	store.Passphrase = func() (string, error) {
+		if v := os.Getenv(auth.PassphraseEnv); v != "" {
+			return v, nil
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return "", auth.ErrPassphraseRequired
+		}
+		_, _ = fmt.Fprint(cmd.ErrOrStderr(), "Auth passphrase: ")
+		bytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+		_, _ = fmt.Fprintln(cmd.ErrOrStderr())
+		if err != nil {
+			return "", err
+		}
+		return string(bytes), nil
+	}
+	return store
+}
+
+func (a *app) newAuthCmd() *cobra.Command {
+	root := &cobra.Command{Use: "auth", Short: "Manage credentials for git hosts and registries"}
+	root.AddCommand(a.newAuthLoginCmd())
+	root.AddCommand(a.newAuthLogoutCmd())
+	root.AddCommand(a.newAuthStatusCmd())
+	root.AddCommand(a.newAuthTestCmd())
+	return root
+}
+
+func (a *app) newAuthLoginCmd() *cobra.Command {
+	var kind string
+	var username string
+	var token string
+	var tokenStdin bool
+	var storage string
+	var tokenEnv string
+	var app config.GitHubAppCredential
+	cmd := &cobra.Command{
+		Use:   "login <host>",
+		Short: "Store a token for a host in the OS keychain or passphrase-encrypted config",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userCfg, err := config.LoadUserConfig()
+			if err != nil {
+				return err
+			}
+			store := newAuthStore(cmd)
+			var status auth.HostStatus
+			switch {
+			case app.AppID != "" || app.InstallationID != "":
+				if token != "" || tokenStdin || tokenEnv != "" {
+					return errors.New("github app login does not accept a token")
+				}
+				status, err = store.LoginGitHubApp(&userCfg, args[0], app)
+			case tokenEnv != "":
+				if token != "" || tokenStdin {
+					return errors.New("use only one of --token-env, --token, or --token-stdin")
+				}
+				status, err = store.LoginTokenEnv(&userCfg, args[0], kind, username, tokenEnv)
+			default:
+				secret, readErr := readAuthToken(cmd, token, tokenStdin)
+				if readErr != nil {
+					return readErr
+				}
+				status, err = store.Login(&userCfg, args[0], kind, username, secret, storage)
+			}
+			if err != nil {
+				return err
+			}
+			if err := config.SaveUserConfig(userCfg); err != nil {
+				return err
+			}
+			out := authLoginOutput{Host: status}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("auth.login", out)
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "auth.login",
+				Title:   "Credentials Stored",
+				Events:  []cliout.Event{{Level: "info", Message: "Host: " + status.Host}, {Level: "info", Message: "Kind: " + status.Kind}, {Level: "info", Message: "Storage: " + status.Storage}},
+				Done:    "Login complete",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&kind, "kind", "git", "credential kind: git|oci|registry|archive")
+	cmd.Flags().StringVar(&username, "username", "", "username sent with the token (optional)")
+	cmd.Flags().StringVar(&token, "token", "", "token value (prefer --token-stdin to keep it out of shell history)")
+	cmd.Flags().BoolVar(&tokenStdin, "token-stdin", false, "read token from stdin")
+	cmd.Flags().StringVar(&storage, "storage", "", "secret storage: keyring|passphrase (default keyring when available)")
+	cmd.Flags().StringVar(&tokenEnv, "token-env", "", "read the token from this environment variable at runtime (for CI-injected fine-grained tokens)")
+	cmd.Flags().StringVar(&app.AppID, "github-app-id", "", "GitHub App ID used to mint installation tokens at runtime")
+	cmd.Flags().StringVar(&app.InstallationID, "installation-id", "", "GitHub App installation ID")
+	cmd.Flags().StringVar(&app.PrivateKeyPath, "private-key", "", "path to the GitHub App private key (PEM)")
+	cmd.Flags().StringVar(&app.PrivateKeyEnv, "private-key-env", "", "environment variable holding the GitHub App private key (PEM)")
+	cmd.Flags().StringVar(&app.APIURL, "github-api-url", "", "GitHub API base URL (default https://api.github.com)")
+	cmd.Flags().StringArrayVar(&app.Repositories, "repository", nil, "limit minted tokens to these repository names (repeatable)")
+	return cmd
+}
+
+func (a *app) newAuthLogoutCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logout <host>",
+		Short: "Remove stored credentials for a host",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userCfg, err := config.LoadUserConfig()
+			if err != nil {
+				return err
+			}
+			status, err := newAuthStore(cmd).Logout(&userCfg, args[0])
+			if err != nil {
+				return err
+			}
+			if err := config.SaveUserConfig(userCfg); err != nil {
+				return err
+			}
+			out := authLogoutOutput{Host: status}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("auth.logout", out)
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "auth.logout",
+				Title:   "Credentials Removed",
+				Events:  []cliout.Event{{Level: "info", Message: "Host: " + status.Host}},
+				Done:    "Logout complete",
+			})
+			return nil
+		},
+	}
+	return cmd
+}
+
+func (a *app) newAuthStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show stored credentials and whether they can be unlocked",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userCfg, err := config.LoadUserConfig()
+			if err != nil {
+				return err
+			}
+			store := auth.NewStore()
+			hosts := store.Status(userCfg)
+			out := authStatusOutput{Hosts: hosts}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("auth.status", out)
+			}
+			rows := make([][]string, 0, len(hosts))
+			for _, h := range hosts {
+				rows = append(rows, []string{h.Host, h.Kind, h.Username, h.Storage, h.Status, h.Details})
+			}
+			events := []cliout.Event{}
+			if len(hosts) == 0 {
+				events = append(events, cliout.Event{Level: "info", Message: "No stored credentials"})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "auth.status",
+				Title:   "Auth Status",
+				Events:  events,
+				Tables:  []cliout.Table{{Title: "Hosts", Columns: []string{"Host", "Kind", "Username", "Storage", "Status", "Details"}, Rows: rows}},
+				Done:    "Auth status complete",
+			})
+			return nil
+		},
+	}
+	return cmd
+}
+
+func (a *app) newAuthTestCmd() *cobra.Command {
+	var uri string
+	cmd := &cobra.Command{
+		Use:   "test <host>",
+		Short: "Test connectivity and credentials for a host",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			userCfg, err := config.LoadUserConfig()
+			if err != nil {
+				return err
+			}
+			host := auth.NormalizeHost(args[0])
+			store := newAuthStore(cmd)
+			entry, stored := userCfg.Auth.Hosts[host]
+			out := authTestOutput{Host: host, Kind: entry.Kind, Credentials: stored, Status: "ok"}
+			if entry.Kind == "" || entry.Kind == auth.KindGit {
+				out.Kind = auth.KindGit
+			}
+			if out.Kind == auth.KindGit && uri != "" {
+				out.Probe = "git ls-remote " + uri
+				gc, err := newGitClient()
+				if err != nil {
+					return err
+				}
+				if err := gc.LsRemote(uri); err != nil {
+					out.Status = "fail"
+					out.Details = err.Error()
+				}
+			} else {
+				target := uri
+				if target == "" {
+					target = "https://" + host + "/"
+				}
+				out.Probe = "GET " + target
+				code, err := store.ProbeHTTP(userCfg, host, target)
+				out.HTTPStatus = code
+				if err != nil {
+					out.Status = "fail"
+					out.Details = err.Error()
+				}
+			}
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("auth.test", out); err != nil {
+					return err
+				}
+			} else {
+				level := "info"
+				if out.Status != "ok" {
+					level = "error"
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command: "auth.test",
+					Title:   "Auth Test",
+					Events:  []cliout.Event{{Level: level, Message: out.Probe + ": " + out.Status}},
+					Summary: map[string]string{"host": out.Host, "kind": out.Kind, "credentials": boolToYesNo(out.Credentials)},
+					Done:    "Auth test complete",
+				})
+			}
+			if out.Status != "ok" {
+				return fmt.Errorf("auth test failed for %s: %s", host, out.Details)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&uri, "uri", "", "repository or endpoint URL to probe (git hosts use git ls-remote)")
+	return cmd
+}
+
+func readAuthToken(cmd *cobra.Command, token string, tokenStdin bool) (string, error) {
+	if token != "" && tokenStdin {
+		return "", errors.New("use only one of --token or --token-stdin")
+	}
+	if token != "" {
+		return token, nil
+	}
+	if tokenStdin {
+		bytes, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(bytes)), nil
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", errors.New("auth login requires --token or --token-stdin in non-interactive mode")
+	}
+	_, _ = fmt.Fprint(cmd.ErrOrStderr(), "Token: ")
+	bytes, err := term.ReadPassword(int(os.Stdin.Fd()))
+	_, _ = fmt.Fprintln(cmd.ErrOrStderr())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(bytes)), nil
+}
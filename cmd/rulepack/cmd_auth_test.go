@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"rulepack/internal/auth"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+func TestAuthLoginStatusLogoutJSON(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv(auth.PassphraseEnv, "correct horse")
+	projectDir := t.TempDir()
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newAuthCmd(), &env, "login", "git.example.com", "--token", "tok-123", "--storage", "passphrase"); err != nil {
+		t.Fatalf("auth login failed: %v", err)
+	}
+	path, err := config.UserConfigPath()
+	if err != nil {
+		t.Fatalf("user config path: %v", err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read user config: %v", err)
+	}
+	if strings.Contains(string(raw), "tok-123") {
+		t.Fatalf("expected token to be encrypted at rest, got %s", raw)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newAuthCmd(), &env, "status"); err != nil {
+		t.Fatalf("auth status failed: %v", err)
+	}
+	var status authStatusOutput
+	if err := json.Unmarshal(env.Result, &status); err != nil {
+		t.Fatalf("unmarshal status: %v", err)
+	}
+	if len(status.Hosts) != 1 || status.Hosts[0].Status != "ok" || status.Hosts[0].Storage != auth.StoragePassphrase {
+		t.Fatalf("unexpected auth status: %#v", status.Hosts)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newAuthCmd(), &env, "logout", "git.example.com"); err != nil {
+		t.Fatalf("auth logout failed: %v", err)
+	}
+	userCfg, err := config.LoadUserConfig()
+	if err != nil {
+		t.Fatalf("load user config: %v", err)
+	}
+	if len(userCfg.Auth.Hosts) != 0 {
+		t.Fatalf("expected no hosts after logout, got %#v", userCfg.Auth.Hosts)
+	}
+}
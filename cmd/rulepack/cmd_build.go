@@ -1,9 +1,16 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"rulepack/internal/build"
@@ -18,112 +25,171 @@ import (
 func (a *app) newBuildCmd() *cobra.Command {
 	var target string
 	var yes bool
+	var stdout bool
+	var requireApproved bool
+	var strict bool
+	var preset string
+	var vars []string
+	var noAtomic bool
+	var check bool
+	var plan bool
+	var showDiff bool
+	var goos string
+	var goarch string
+	var recoverProfiles bool
 	cmd := &cobra.Command{
 		Use:   "build",
 		Short: "Compile resolved rule packs into target outputs",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			if preset != "" && cmd.Flags().Changed("target") {
+				return fmt.Errorf("use only one of --target or --preset")
+			}
+			if showDiff {
+				if check || stdout {
+					return fmt.Errorf("--diff cannot be combined with --check or --stdout")
+				}
+				plan = true
+			}
+			if (check && stdout) || (plan && (check || stdout)) {
+				return fmt.Errorf("use only one of --check, --plan, or --stdout")
+			}
+			if stdout {
+				if a.jsonMode {
+					return fmt.Errorf("--stdout cannot be combined with --json")
+				}
+				if t := strings.ToLower(target); t == "" || t == "all" || preset != "" {
+					return fmt.Errorf("--stdout requires a single --target")
+				}
+			}
+			if recoverProfiles && plan {
+				return fmt.Errorf("--recover cannot be combined with --plan")
+			}
+			platform := &config.When{OS: goos, Arch: goarch}
+			if err := platform.Validate(); err != nil {
+				return fmt.Errorf("--os/--arch: %w", err)
+			}
+			cfg, err := config.LoadEffectiveRuleset(rulesetFile)
 			if err != nil {
 				return err
 			}
-			cfgPath, err := filepath.Abs(config.RulesetFileName)
+			targets := resolveBuildTargets(target, cfg.Targets)
+			if preset != "" {
+				presetTargets, ok := cfg.Presets[preset]
+				if !ok {
+					return fmt.Errorf("unknown preset %q", preset)
+				}
+				targets = presetTargets
+			}
+			pathVars, err := parseBuildVars(vars)
 			if err != nil {
 				return err
 			}
-			cfgDir := filepath.Dir(cfgPath)
-			lock, err := config.LoadLockfile(config.LockFileName)
+			for _, t := range targets {
+				entry, ok := cfg.Targets[t]
+				if !ok {
+					continue
+				}
+				if cfg.Targets[t], err = entry.ExpandPaths(pathVars); err != nil {
+					return fmt.Errorf("targets.%s: %w", t, err)
+				}
+			}
+			var recovered []string
+			if recoverProfiles {
+				if recovered, err = recoverMissingProfiles(cfg); err != nil {
+					return err
+				}
+			}
+			timer := newPhaseTimer()
+			modules, provided, err := composeLocked(cfg, goos, goarch, timer)
+			var triaged []string
+			for err != nil && !plan && !check && !stdout && !a.jsonMode && isInteractiveTerminal() {
+				var dup *duplicateModuleError
+				if !errors.As(err, &dup) || len(dup.Dependencies) < 2 {
+					break
+				}
+				deps, change, triageErr := a.triageDuplicate(cmd, dup)
+				if triageErr != nil {
+					return triageErr
+				}
+				cfg.Dependencies = deps
+				triaged = append(triaged, change)
+				modules, provided, err = composeLocked(cfg, goos, goarch, timer)
+			}
 			if err != nil {
 				return err
 			}
-			if len(cfg.Dependencies) != len(lock.Resolved) {
-				return fmt.Errorf("lockfile mismatch: run rulepack deps install")
+			// Overrides for a dependency this platform leaves out would look
+			// dead here; deps install checks those against every dependency.
+			var overrideWarnings []string
+			if !slices.ContainsFunc(cfg.Dependencies, func(dep config.Dependency) bool { return !dep.When.Matches(goos, goarch) }) {
+				if overrideWarnings, err = checkOverrides(cfg.Overrides, provided, strict); err != nil {
+					return err
+				}
 			}
-
-			gc, err := git.NewClient()
+			lock, err := config.LoadLockfile(lockFile)
 			if err != nil {
 				return err
 			}
-
-			var modules []pack.Module
-			for i, dep := range cfg.Dependencies {
-				locked := lock.Resolved[i]
-				source := dependencySource(dep)
-				lockedSource := lockSource(locked)
-				if source != lockedSource {
-					return fmt.Errorf("lockfile mismatch at index %d (source %s != %s)", i, source, lockedSource)
+			if requireApproved {
+				if err := checkApprovals(cfg.Dependencies, lock); err != nil {
+					return err
 				}
-				switch source {
-				case "git":
-					if dep.URI != locked.URI {
-						return fmt.Errorf("lockfile mismatch at index %d (%s != %s)", i, dep.URI, locked.URI)
-					}
-					repoDir, err := gc.EnsureRepo(dep.URI)
-					if err != nil {
-						return err
-					}
-					expanded, err := pack.ExpandGitDependency(gc, repoDir, dep, locked)
-					if err != nil {
-						return err
-					}
-					modules = append(modules, expanded...)
-				case "local":
-					absLocalPath, relPath, err := resolveLocalPath(cfgDir, dep.Path)
-					if err != nil {
-						return err
-					}
-					if relPath != locked.Path {
-						return fmt.Errorf("lockfile mismatch at index %d (%s != %s)", i, relPath, locked.Path)
-					}
-					expanded, contentHash, err := pack.ExpandLocalDependency(absLocalPath, dep, "local")
-					if err != nil {
-						return err
-					}
-					if contentHash != locked.ContentHash {
-						return fmt.Errorf("local dependency changed; run rulepack deps install")
-					}
-					modules = append(modules, expanded...)
-				case "profile":
-					depProfile := dep.Profile
-					if depProfile == "" {
-						depProfile = locked.Profile
-					}
-					meta, profileDir, err := profilesvc.ResolveIDOrAlias(depProfile)
-					if err != nil {
-						return err
-					}
-					if locked.Profile != "" && meta.ID != locked.Profile {
-						return fmt.Errorf("lockfile mismatch at index %d (%s != %s)", i, meta.ID, locked.Profile)
-					}
-					depRead := profileDependencyForRead(dep)
-					expanded, contentHash, err := pack.ExpandProfileDependency(profileDir, depRead, profilesvc.ProfileCommit)
-					if err != nil {
-						return err
-					}
-					if contentHash != locked.ContentHash {
-						return fmt.Errorf("profile snapshot drift detected; run rulepack deps install")
+			}
+			builtAt := time.Now().UTC()
+			for _, t := range targets {
+				if entry, ok := cfg.Targets[t]; ok {
+					entry.RulesetDigest = lock.RulesetDigest
+					if entry.StampBuildID {
+						entry.BuildID = buildID(lock.RulesetDigest, builtAt)
 					}
-					modules = append(modules, expanded...)
-				default:
-					return fmt.Errorf("unsupported source %q", dep.Source)
+					cfg.Targets[t] = entry
 				}
 			}
-
-			modules = build.ApplyOverrides(modules, cfg.Overrides)
-			if err := build.CheckDuplicateIDs(modules); err != nil {
+			bands, err := cfg.Bands()
+			if err != nil {
 				return err
 			}
-			build.Sort(modules)
+			if issues := render.LintBands(modules, bands); len(issues) > 0 {
+				return fmt.Errorf("module %s: %s (see rulepack lint)", issues[0].Module, issues[0].Message)
+			}
 
-			targets := resolveTargets(target)
+			if stdout {
+				entry, ok := cfg.Targets[targets[0]]
+				if !ok {
+					return fmt.Errorf("target %q not configured", targets[0])
+				}
+				content, err := render.RenderSingleFile(entry.Kind(targets[0]), entry, targetModules(entry, modules))
+				if err != nil {
+					return fmt.Errorf("--stdout: %w", err)
+				}
+				_, err = fmt.Fprint(cmd.OutOrStdout(), content)
+				return err
+			}
+			if check {
+				return a.checkBuildOutputs(cfg, targets, modules)
+			}
+			violations, err := protectedOutputs(cfg, targets, modules)
+			if err != nil {
+				return err
+			}
+			if len(violations) > 0 {
+				return fmt.Errorf("build refuses to write protected output(s): %s", strings.Join(violations, ", "))
+			}
 			targetRows := make([]buildTargetRow, 0, len(targets))
-			warnings := make([]string, 0)
+			warnings := append(make([]string, 0), overrideWarnings...)
 			unmanagedCollisions := make([]string, 0)
 			for _, t := range targets {
 				entry, ok := cfg.Targets[t]
 				if !ok {
 					return fmt.Errorf("target %q not configured", t)
 				}
-				switch t {
+				modules := targetModules(entry, modules)
+				for _, issue := range render.LintApply(t, entry.Kind(t), entry, modules) {
+					if issue.Level == "error" {
+						return fmt.Errorf("module %s: %s for target %s (see rulepack lint)", issue.Module, issue.Message, issue.Target)
+					}
+				}
+				switch entry.Kind(t) {
 				case "cursor":
 					collisions, err := render.CursorUnmanagedOverwrites(entry, modules)
 					if err != nil {
@@ -133,58 +199,168 @@ func (a *app) newBuildCmd() *cobra.Command {
 						unmanagedCollisions = append(unmanagedCollisions, path)
 						warnings = append(warnings, fmt.Sprintf("cursor output will overwrite existing non-rulepack file: %s", path))
 					}
+					fallbacks, err := render.CursorMergedFallbacks(entry, modules)
+					if err != nil {
+						return err
+					}
+					warnings = append(warnings, fallbacks...)
+				case "amazonq", "cline", "copilot":
+					collisions, err := render.RulesUnmanagedOverwrites(entry.Kind(t), entry, modules)
+					if err != nil {
+						return err
+					}
+					for _, path := range collisions {
+						unmanagedCollisions = append(unmanagedCollisions, path)
+						warnings = append(warnings, fmt.Sprintf("%s output will overwrite existing non-rulepack file: %s", entry.Kind(t), path))
+					}
+				case "codex":
+					collisions, err := render.ScopedUnmanagedOverwrites(entry, "codex", modules)
+					if err != nil {
+						return err
+					}
+					for _, path := range collisions {
+						unmanagedCollisions = append(unmanagedCollisions, path)
+						warnings = append(warnings, fmt.Sprintf("codex output will overwrite existing non-rulepack file: %s", path))
+					}
 				default:
 					continue
 				}
 			}
-			if err := confirmRiskAction(
-				cmd,
-				a.jsonMode,
-				yes,
-				len(unmanagedCollisions) > 0,
-				fmt.Sprintf("build detected %d unmanaged cursor overwrite collision(s)", len(unmanagedCollisions)),
-				fmt.Sprintf("Build will overwrite %d existing non-rulepack cursor file(s). Continue?", len(unmanagedCollisions)),
-				unmanagedCollisions,
-				"build",
-			); err != nil {
+			collisionMessage := fmt.Sprintf("build detected %d unmanaged overwrite collision(s)", len(unmanagedCollisions))
+			if !plan {
+				if err := confirmRiskAction(
+					cmd,
+					a.jsonMode,
+					yes,
+					len(unmanagedCollisions) > 0,
+					collisionMessage,
+					fmt.Sprintf("Build will overwrite %d existing non-rulepack file(s). Continue?", len(unmanagedCollisions)),
+					unmanagedCollisions,
+					"build",
+				); err != nil {
+					return err
+				}
+			}
+			// Each target renders into its own subtree of a staging directory
+			// inside the project, so committed files can be attributed to it in
+			// the output manifest. Unless --no-atomic is set, nothing moves into
+			// place until every target has rendered.
+			manifest, err := config.LoadOutputs(outputsFile)
+			if err != nil {
 				return err
 			}
-			for _, t := range targets {
+			stage, err := build.NewStage(".")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(stage)
+			hashes := make(map[string]string, len(targets))
+			built := make([]string, 0, len(targets))
+			committed := make(map[string][]string, len(targets))
+			snapshotted := false
+			commit := func(i int, t string) error {
+				if !snapshotted {
+					if err := a.snapshotProject("build"); err != nil {
+						return err
+					}
+					snapshotted = true
+				}
+				files, err := build.CommitStage(filepath.Join(stage, strconv.Itoa(i)), ".")
+				committed[t] = files
+				return err
+			}
+			for i, t := range targets {
 				entry, ok := cfg.Targets[t]
 				if !ok {
 					return fmt.Errorf("target %q not configured", t)
 				}
-				switch t {
-				case "cursor":
-					if err := render.WriteCursor(entry, modules); err != nil {
+				modules := targetModules(entry, modules)
+				hash, err := build.InputHash(entry, modules)
+				if err != nil {
+					return err
+				}
+				if rec, ok := manifest.Targets[t]; ok && rec.InputHash == hash {
+					intact, err := outputsIntact(rec)
+					if err != nil {
 						return err
 					}
-					targetRows = append(targetRows, buildTargetRow{Target: t, Output: entry.OutDir, Status: "ok"})
-				case "copilot":
-					if err := render.WriteMerged(entry.OutFile, modules); err != nil {
-						return err
+					if intact {
+						targetRows = append(targetRows, buildTargetRow{Target: t, Output: targetOutput(entry.Kind(t), entry), Status: "unchanged"})
+						continue
 					}
-					targetRows = append(targetRows, buildTargetRow{Target: t, Output: entry.OutFile, Status: "ok"})
-				case "codex":
-					if err := render.WriteMerged(entry.OutFile, modules); err != nil {
+				}
+				hashes[t] = hash
+				entry.Root = filepath.Join(stage, strconv.Itoa(i))
+				start := time.Now()
+				err = writeTarget(entry.Kind(t), entry, modules)
+				timer.trackTarget(t, start)
+				if err != nil {
+					return err
+				}
+				targetRows = append(targetRows, buildTargetRow{Target: t, Output: targetOutput(entry.Kind(t), entry), Status: "ok"})
+				built = append(built, t)
+				if noAtomic && !plan {
+					if err := commit(i, t); err != nil {
 						return err
 					}
-					targetRows = append(targetRows, buildTargetRow{Target: t, Output: entry.OutFile, Status: "ok"})
-				case "claude":
-					if err := render.WriteClaude(entry, modules); err != nil {
+				}
+			}
+			if plan {
+				actions, diffs, err := buildPlan(stage, targets, hashes, manifest, showDiff)
+				if err != nil {
+					return err
+				}
+				return a.renderPlan(planOutput{Command: "build", Actions: actions, Risks: newPlanRisk(len(unmanagedCollisions) > 0, collisionMessage, unmanagedCollisions), Diffs: diffs})
+			}
+			if !noAtomic {
+				for i, t := range targets {
+					if _, ok := hashes[t]; !ok {
+						continue
+					}
+					if err := commit(i, t); err != nil {
 						return err
 					}
-					outDir := entry.OutDir
-					if outDir == "" {
-						outDir = ".claude/rules"
+				}
+			}
+			written := map[string]bool{}
+			for _, files := range committed {
+				for _, f := range files {
+					written[f] = true
+				}
+			}
+			for _, t := range built {
+				entry := cfg.Targets[t]
+				files := committed[t]
+				if err := build.Format(entry.Format, files); err != nil {
+					warnings = append(warnings, fmt.Sprintf("%s formatter: %v", t, err))
+				}
+				recorded, err := build.RecordOutputs(files)
+				if err != nil {
+					return err
+				}
+				stale := make([]config.OutputFile, 0)
+				for _, f := range manifest.Targets[t].Files {
+					if !written[f.Path] {
+						stale = append(stale, f)
 					}
-					targetRows = append(targetRows, buildTargetRow{Target: t, Output: outDir, Status: "ok"})
-				default:
-					return fmt.Errorf("unsupported target %q", t)
+				}
+				_, skipped, err := build.RemoveOutputs(stale)
+				if err != nil {
+					return err
+				}
+				for _, path := range skipped {
+					warnings = append(warnings, fmt.Sprintf("%s: kept stale output with local edits: %s", t, path))
+				}
+				manifest.Targets[t] = config.TargetOutputs{InputHash: hashes[t], Files: recorded}
+			}
+			if len(built) > 0 {
+				if err := config.SaveOutputs(outputsFile, manifest); err != nil {
+					return err
 				}
 			}
 
-			out := buildOutput{ModuleCount: len(modules), Targets: targetRows, Warnings: warnings}
+			timings := timer.timings()
+			out := buildOutput{ModuleCount: len(modules), RulesetDigest: lock.RulesetDigest, Targets: targetRows, Recovered: recovered, Warnings: warnings, Timings: &timings}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("build", out)
 			}
@@ -192,7 +368,13 @@ func (a *app) newBuildCmd() *cobra.Command {
 			for _, r := range targetRows {
 				rows = append(rows, []string{r.Target, r.Output, r.Status})
 			}
-			events := make([]cliout.Event, 0, len(warnings))
+			events := make([]cliout.Event, 0, len(recovered)+len(triaged)+len(warnings))
+			for _, id := range recovered {
+				events = append(events, cliout.Event{Level: "info", Message: "Recovered profile " + id + " from lockfile sources"})
+			}
+			for _, change := range triaged {
+				events = append(events, cliout.Event{Level: "info", Message: "Updated " + rulesetFile + ": " + change})
+			}
 			for _, warning := range warnings {
 				events = append(events, cliout.Event{Level: "warn", Message: warning})
 			}
@@ -207,7 +389,632 @@ func (a *app) newBuildCmd() *cobra.Command {
 			return nil
 		},
 	}
-	cmd.Flags().StringVar(&target, "target", "all", "target: cursor|copilot|codex|claude|all")
+	cmd.Flags().StringVar(&target, "target", "all", "target: cursor|copilot|codex|claude|amazonq|cline|zed|junie|custom|all")
 	cmd.Flags().BoolVar(&yes, "yes", false, "confirm risky overwrites without prompting")
+	cmd.Flags().StringVar(&preset, "preset", "", "build the targets listed under this name in presets")
+	cmd.Flags().StringArrayVar(&vars, "var", nil, "set a variable for templated output paths, e.g. Env=prod (repeatable)")
+	cmd.Flags().BoolVar(&noAtomic, "no-atomic", false, "write each target in place as it renders instead of staging all targets first")
+	cmd.Flags().BoolVar(&plan, "plan", false, "render into a staging directory and report the file changes without applying them")
+	cmd.Flags().BoolVar(&showDiff, "diff", false, "like --plan, and show each changed file as a diff")
+	cmd.Flags().BoolVar(&check, "check", false, "report targets whose outputs are out of date without writing anything")
+	cmd.Flags().StringVar(&goos, "os", runtime.GOOS, "build for this operating system when evaluating when conditions")
+	cmd.Flags().StringVar(&goarch, "arch", runtime.GOARCH, "build for this architecture when evaluating when conditions")
+	cmd.Flags().BoolVar(&recoverProfiles, "recover", false, "rebuild locked profiles missing from the profile stores from the sources recorded in the lockfile")
+	cmd.Flags().BoolVar(&stdout, "stdout", false, "write one single-file target's output to stdout instead of disk")
+	cmd.Flags().BoolVar(&requireApproved, "require-approved", false, "fail unless every dependency's locked content hash has an approval")
+	cmd.Flags().BoolVar(&strict, "strict", false, "fail when an override matches no module the dependencies provide")
 	return cmd
 }
+
+// buildID identifies one build run as <ruleset digest>-<UTC time>-<version>,
+// e.g. 44a10e7c15e5-20261015T093000Z-v1.4.0. Locks without a ruleset digest
+// show "unlocked" in its place.
+func buildID(digest string, at time.Time) string {
+	if digest == "" {
+		digest = "unlocked"
+	}
+	return fmt.Sprintf("%s-%s-%s", shortSHA(digest), at.Format("20060102T150405Z"), appVersion())
+}
+
+// checkBuildOutputs compares each target against the output manifest and fails
+// when a build would change something.
+func (a *app) checkBuildOutputs(cfg config.Ruleset, targets []string, modules []pack.Module) error {
+	manifest, err := config.LoadOutputs(outputsFile)
+	if err != nil {
+		return err
+	}
+	targetRows := make([]buildTargetRow, 0, len(targets))
+	warnings := make([]string, 0)
+	for _, t := range targets {
+		entry, ok := cfg.Targets[t]
+		if !ok {
+			return fmt.Errorf("target %q not configured", t)
+		}
+		modules := targetModules(entry, modules)
+		hash, err := build.InputHash(entry, modules)
+		if err != nil {
+			return err
+		}
+		status := "ok"
+		rec, ok := manifest.Targets[t]
+		switch {
+		case !ok:
+			status = "stale"
+			warnings = append(warnings, fmt.Sprintf("%s: not built", t))
+		case rec.InputHash != hash:
+			status = "stale"
+			warnings = append(warnings, fmt.Sprintf("%s: inputs changed since last build", t))
+		default:
+			for _, f := range rec.Files {
+				fileStatus, err := build.OutputStatus(f)
+				if err != nil {
+					return err
+				}
+				if fileStatus != "ok" {
+					status = "stale"
+					warnings = append(warnings, fmt.Sprintf("%s: %s %s", t, f.Path, fileStatus))
+				}
+			}
+		}
+		targetRows = append(targetRows, buildTargetRow{Target: t, Output: targetOutput(entry.Kind(t), entry), Status: status})
+	}
+	stale := 0
+	for _, r := range targetRows {
+		if r.Status != "ok" {
+			stale++
+		}
+	}
+
+	out := buildOutput{ModuleCount: len(modules), Targets: targetRows, Warnings: warnings}
+	if a.jsonMode {
+		if err := a.renderer.RenderJSON("build", out); err != nil {
+			return err
+		}
+	} else {
+		rows := make([][]string, 0, len(targetRows))
+		for _, r := range targetRows {
+			rows = append(rows, []string{r.Target, r.Output, r.Status})
+		}
+		events := make([]cliout.Event, 0, len(warnings))
+		for _, warning := range warnings {
+			events = append(events, cliout.Event{Level: "warn", Message: warning})
+		}
+		a.renderer.RenderHuman(cliout.HumanPayload{
+			Command: "build",
+			Title:   "Build Check",
+			Tables:  []cliout.Table{{Title: "Build Targets", Columns: []string{"Target", "Output", "Status"}, Rows: rows}},
+			Events:  events,
+			Summary: map[string]string{"moduleCount": strconv.Itoa(len(modules)), "stale": strconv.Itoa(stale)},
+			Done:    "Build check complete",
+		})
+	}
+	if stale > 0 {
+		return fmt.Errorf("%d target(s) out of date; run rulepack build", stale)
+	}
+	return nil
+}
+
+// buildPlan compares each rendered target's staging subtree with the worktree
+// and lists the files a build would create, update, or prune, with their
+// contents before and after when withDiffs is set.
+func buildPlan(stage string, targets []string, hashes map[string]string, manifest config.Outputs, withDiffs bool) ([]planAction, []cliout.Diff, error) {
+	actions := make([]planAction, 0)
+	var diffs []cliout.Diff
+	written := map[string]bool{}
+	for i, t := range targets {
+		if _, ok := hashes[t]; !ok {
+			continue
+		}
+		root := filepath.Join(stage, strconv.Itoa(i))
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, walkErr error) error {
+			if walkErr != nil || d.IsDir() {
+				return walkErr
+			}
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			written[rel] = true
+			staged, err := os.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			current, err := os.ReadFile(rel)
+			switch {
+			case os.IsNotExist(err):
+				actions = append(actions, planAction{Action: "create", Kind: "file", Target: rel, Detail: t})
+			case err != nil:
+				return err
+			case !bytes.Equal(current, staged):
+				actions = append(actions, planAction{Action: "update", Kind: "file", Target: rel, Detail: t})
+			default:
+				return nil
+			}
+			if withDiffs {
+				diffs = append(diffs, cliout.Diff{Title: rel, Before: string(current), After: string(staged)})
+			}
+			return nil
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, nil, err
+		}
+	}
+	for _, t := range targets {
+		if _, ok := hashes[t]; !ok {
+			continue
+		}
+		for _, f := range manifest.Targets[t].Files {
+			if written[f.Path] {
+				continue
+			}
+			status, err := build.OutputStatus(f)
+			if err != nil {
+				return nil, nil, err
+			}
+			if status != "ok" {
+				continue
+			}
+			actions = append(actions, planAction{Action: "delete", Kind: "file", Target: f.Path, Detail: t + " stale output"})
+			if withDiffs {
+				current, err := os.ReadFile(f.Path)
+				if err != nil {
+					return nil, nil, err
+				}
+				diffs = append(diffs, cliout.Diff{Title: f.Path, Before: string(current)})
+			}
+		}
+	}
+	return actions, diffs, nil
+}
+
+// writeTarget renders one target with the renderer for kind.
+func writeTarget(kind string, entry config.TargetEntry, modules []pack.Module) error {
+	switch kind {
+	case "cursor":
+		return render.WriteCursor(entry, modules)
+	case "copilot":
+		return render.WriteCopilot(entry, modules)
+	case "codex":
+		return render.WriteCodex(entry, modules)
+	case "claude":
+		return render.WriteClaude(entry, modules)
+	case "amazonq":
+		return render.WriteAmazonQ(entry, modules)
+	case "cline":
+		return render.WriteCline(entry, modules)
+	case "zed":
+		return render.WriteZed(entry, modules)
+	case "junie":
+		return render.WriteJunie(entry, modules)
+	case "custom":
+		return render.WriteCustom(entry, modules)
+	default:
+		return fmt.Errorf("unsupported target %q", kind)
+	}
+}
+
+// targetOutput is the output path a build row reports for a target.
+func targetOutput(kind string, entry config.TargetEntry) string {
+	switch kind {
+	case "cursor":
+		return entry.OutDir
+	case "claude":
+		if !entry.PerModule {
+			if entry.OutFile == "" {
+				return "CLAUDE.md"
+			}
+			return entry.OutFile
+		}
+		if entry.OutDir == "" {
+			return ".claude/rules"
+		}
+		return entry.OutDir
+	case "copilot":
+		if !entry.PerModule {
+			return entry.OutFile
+		}
+		if entry.OutDir == "" {
+			return ".github/instructions"
+		}
+		return entry.OutDir
+	case "amazonq":
+		if entry.OutDir == "" {
+			return ".amazonq/rules"
+		}
+		return entry.OutDir
+	case "cline":
+		if entry.OutDir == "" {
+			return ".clinerules"
+		}
+		return entry.OutDir
+	case "zed":
+		if entry.OutFile == "" {
+			return ".rules"
+		}
+		return entry.OutFile
+	case "junie":
+		if entry.OutFile == "" {
+			return ".junie/guidelines.md"
+		}
+		return entry.OutFile
+	default:
+		return entry.OutFile
+	}
+}
+
+// outputsIntact reports whether every file recorded for a target is still on
+// disk as built.
+func outputsIntact(rec config.TargetOutputs) (bool, error) {
+	for _, f := range rec.Files {
+		status, err := build.OutputStatus(f)
+		if err != nil {
+			return false, err
+		}
+		if status != "ok" {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func parseBuildVars(raw []string) (map[string]string, error) {
+	vars := make(map[string]string, len(raw))
+	for _, kv := range raw {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid --var %q (use key=value)", kv)
+		}
+		vars[strings.TrimSpace(key)] = value
+	}
+	return vars, nil
+}
+
+// composeModules expands every locked dependency of cfg for a build on
+// goos/goarch and applies overrides, duplicate checks, ordering, and size
+// limits, yielding what build renders.
+func composeModules(cfg config.Ruleset, goos, goarch string) ([]pack.Module, error) {
+	return composeModulesTimed(cfg, goos, goarch, nil)
+}
+
+// composeModulesTimed is composeModules recording fetch and expand time in
+// timer, which may be nil.
+func composeModulesTimed(cfg config.Ruleset, goos, goarch string, timer *phaseTimer) ([]pack.Module, error) {
+	modules, _, err := composeLocked(cfg, goos, goarch, timer)
+	return modules, err
+}
+
+// composeLocked is composeModulesTimed also returning every module the
+// dependencies built on goos/goarch provide, before ignore rules and module
+// when conditions drop any. An empty goos composes every dependency and
+// module regardless of when conditions.
+func composeLocked(cfg config.Ruleset, goos, goarch string, timer *phaseTimer) ([]pack.Module, []pack.Module, error) {
+	lock, err := config.LoadLockfile(lockFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	return composeLock(cfg, lock, goos, goarch, timer)
+}
+
+// composeLock is composeLocked reading lock rather than the lockfile.
+func composeLock(cfg config.Ruleset, lock config.Lockfile, goos, goarch string, timer *phaseTimer) ([]pack.Module, []pack.Module, error) {
+	cfgPath, err := filepath.Abs(rulesetFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfgDir := filepath.Dir(cfgPath)
+	aligned, err := lock.Align(cfg.Dependencies)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	gc, err := newProjectGitClient(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ignore, err := pack.LoadIgnore(config.IgnoreFileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	opts := expandOptions(cfg)
+	var modules []pack.Module
+	byDep := make([][]pack.Module, len(cfg.Dependencies))
+	for i, dep := range cfg.Dependencies {
+		if goos != "" && !dep.When.Matches(goos, goarch) {
+			continue
+		}
+		locked := aligned[i]
+		source := dependencySource(dep)
+		lockedSource := lockSource(locked)
+		if source != lockedSource {
+			return nil, nil, fmt.Errorf("lockfile mismatch: %s is locked as source %s, not %s; run rulepack deps install", dependencyLabel(i, dep), lockedSource, source)
+		}
+		switch source {
+		case "git":
+			if dep.URI != locked.URI {
+				return nil, nil, fmt.Errorf("lockfile mismatch: %s is locked to %s; run rulepack deps install", dependencyLabel(i, dep), locked.URI)
+			}
+			start := time.Now()
+			repoDir, err := gc.EnsureRepo(dep.URI)
+			timer.track("fetch", start)
+			if err != nil {
+				return nil, nil, err
+			}
+			start = time.Now()
+			expanded, err := pack.ExpandGitDependency(gc, repoDir, dep, locked, opts)
+			timer.track("expand", start)
+			if err != nil {
+				return nil, nil, err
+			}
+			byDep[i] = expanded
+			modules = append(modules, expanded...)
+		case "local":
+			absLocalPath, relPath, err := resolveLocalPath(cfgDir, dep.Path)
+			if err != nil {
+				return nil, nil, err
+			}
+			if relPath != locked.Path {
+				return nil, nil, fmt.Errorf("lockfile mismatch: %s resolves to %s but is locked to %s; run rulepack deps install", dependencyLabel(i, dep), relPath, locked.Path)
+			}
+			start := time.Now()
+			expanded, contentHash, err := pack.ExpandLocalDependency(absLocalPath, dep, "local", opts)
+			timer.track("expand", start)
+			if err != nil {
+				return nil, nil, err
+			}
+			if contentHash != locked.ContentHash {
+				return nil, nil, fmt.Errorf("local dependency changed; run rulepack deps install")
+			}
+			byDep[i] = expanded
+			modules = append(modules, expanded...)
+		case "profile":
+			depProfile := dep.Profile
+			if depProfile == "" {
+				depProfile = locked.Profile
+			}
+			if _, remote := config.ParseRemoteProfile(depProfile); remote && locked.URI != cfg.ProfileRegistry {
+				return nil, nil, fmt.Errorf("lockfile mismatch: %s is locked to registry %s, not %s; run rulepack deps install", dependencyLabel(i, dep), locked.URI, cfg.ProfileRegistry)
+			}
+			start := time.Now()
+			loc, err := resolveProfileDependency(gc, locked.URI, depProfile, locked.Commit)
+			timer.track("fetch", start)
+			if errors.Is(err, profilesvc.ErrNotFound) && locked.URI == "" && locked.Profile != "" {
+				return nil, nil, newMissingProfileError(i, locked)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			if locked.Profile != "" && loc.ID != locked.Profile {
+				return nil, nil, fmt.Errorf("lockfile mismatch: %s resolves to profile %s but is locked to %s; run rulepack deps install", dependencyLabel(i, dep), loc.ID, locked.Profile)
+			}
+			depRead := profileDependencyForRead(dep)
+			start = time.Now()
+			expanded, contentHash, err := profilesvc.Expand(loc.Dir, depRead, opts)
+			timer.track("expand", start)
+			if err != nil {
+				return nil, nil, err
+			}
+			if contentHash != locked.ContentHash {
+				return nil, nil, profileDriftError(loc, expanded)
+			}
+			byDep[i] = expanded
+			modules = append(modules, expanded...)
+		default:
+			return nil, nil, fmt.Errorf("unsupported source %q", dep.Source)
+		}
+	}
+
+	provided := modules
+	modules, _ = ignore.Filter(modules)
+	if goos != "" {
+		modules = build.FilterPlatform(modules, goos, goarch)
+	}
+	modules = build.ApplyOverrides(modules, cfg.Overrides)
+	if err := build.CheckDuplicateIDs(modules); err != nil {
+		var dup *build.DuplicateIDError
+		if !errors.As(err, &dup) {
+			return nil, nil, err
+		}
+		out := &duplicateModuleError{DuplicateIDError: dup}
+		for i, expanded := range byDep {
+			kept, _ := ignore.Filter(expanded)
+			if goos != "" {
+				kept = build.FilterPlatform(kept, goos, goarch)
+			}
+			if slices.ContainsFunc(kept, func(m pack.Module) bool { return m.ID == dup.ID }) {
+				out.Dependencies = append(out.Dependencies, i)
+			}
+		}
+		return nil, nil, out
+	}
+	build.Sort(modules)
+	if err := build.CheckOutputSize(modules, cfg.Policy.EffectiveLimits().MaxOutputBytes); err != nil {
+		return nil, nil, err
+	}
+	return modules, provided, nil
+}
+
+// duplicateModuleError is a duplicate module ID with the indices of the
+// dependencies that supply it, so build can offer to resolve it.
+type duplicateModuleError struct {
+	*build.DuplicateIDError
+	Dependencies []int
+}
+
+func (e *duplicateModuleError) Unwrap() error { return e.DuplicateIDError }
+
+// profileDriftError explains a profile whose content no longer matches its
+// lock entry. When the saved profile recorded module digests, modules edited
+// in the snapshot since it was saved are named; otherwise the profile was
+// re-saved after install.
+func profileDriftError(loc profileLocation, modules []pack.Module) error {
+	if len(loc.Meta.ModuleDigests) == 0 {
+		return fmt.Errorf("profile snapshot drift detected; run rulepack deps install")
+	}
+	changed, added, _ := loc.Meta.DigestDiff(modules)
+	edited := append(changed, added...)
+	if len(edited) == 0 {
+		return fmt.Errorf("profile %s changed since it was locked; run rulepack deps install", loc.ID)
+	}
+	buildSortStrings(edited)
+	return fmt.Errorf("profile %s snapshot drift detected: module(s) %s edited since the profile was saved; run rulepack profile refresh %s to rebuild it from its sources, or rulepack deps install to keep the edits", loc.ID, strings.Join(edited, ", "), loc.ID)
+}
+
+// missingProfileError reports a locked saved profile that is in neither
+// profile store, with what the lock recorded about where it came from.
+type missingProfileError struct {
+	Index   int
+	Profile string
+	Alias   string
+	Sources []profilesvc.SourceSnapshot
+}
+
+func newMissingProfileError(index int, locked config.LockedSource) *missingProfileError {
+	return &missingProfileError{Index: index, Profile: locked.Profile, Alias: locked.ProfileAlias, Sources: locked.ProfileSources}
+}
+
+// subject names the profile the way the lock knows it.
+func (e *missingProfileError) subject() string {
+	name := strconv.Quote(e.Profile)
+	if e.Alias != "" {
+		name += " (alias " + e.Alias + ")"
+	}
+	return fmt.Sprintf("dependency[%d]: profile %s", e.Index, name)
+}
+
+func (e *missingProfileError) Error() string {
+	msg := e.subject() + " is not saved locally"
+	if len(e.Sources) == 0 {
+		return msg + "; save it on this machine or share it with rulepack profile save --scope project"
+	}
+	labels := make([]string, 0, len(e.Sources))
+	for _, src := range e.Sources {
+		labels = append(labels, sourceStatusLabel(src.SourceType, src.SourceRef))
+	}
+	return msg + "; it was built from " + strings.Join(labels, ", ") + "; run rulepack build --recover to rebuild it from those sources, or share it with rulepack profile save --scope project"
+}
+
+func (e *missingProfileError) Details() any {
+	return map[string]any{
+		"kind":    "missingProfile",
+		"index":   e.Index,
+		"profile": e.Profile,
+		"alias":   e.Alias,
+		"sources": e.Sources,
+	}
+}
+
+// missingLockedProfiles returns the lock entries of saved profiles that are
+// not in any profile store. Registry profiles are fetched on demand and are
+// never missing.
+func missingLockedProfiles(lock config.Lockfile) ([]int, error) {
+	missing := make([]int, 0)
+	for i, locked := range lock.Resolved {
+		if lockSource(locked) != profilesvc.ProfileSource || locked.URI != "" || locked.Profile == "" {
+			continue
+		}
+		if _, _, err := profilesvc.ResolveIDOrAlias(locked.Profile); err != nil {
+			if !errors.Is(err, profilesvc.ErrNotFound) {
+				return nil, err
+			}
+			missing = append(missing, i)
+		}
+	}
+	return missing, nil
+}
+
+// recoverLockedProfile rebuilds a missing saved profile from the sources its
+// lock entry recorded and saves it under the locked ID. Git sources are
+// pinned to their recorded commit, and the result must reproduce the locked
+// content hash; otherwise nothing is saved.
+func recoverLockedProfile(gc *git.Client, index int, locked config.LockedSource) error {
+	if len(locked.ProfileSources) == 0 {
+		return newMissingProfileError(index, locked)
+	}
+	if locked.Export != "" && locked.Export != "default" {
+		return fmt.Errorf("cannot recover profile %s: export %q is not recorded in the lockfile", locked.Profile, locked.Export)
+	}
+	modules := make([]pack.Module, 0)
+	for _, src := range locked.ProfileSources {
+		dep, err := dependencyFromSourceSnapshot(src)
+		if err != nil {
+			return fmt.Errorf("cannot recover profile %s: %w", locked.Profile, err)
+		}
+		if commit := src.Provenance["commit"]; dependencySource(dep) == "git" && commit != "" {
+			dep.Ref, dep.Version = commit, ""
+		}
+		mods, err := resolveModulesForDependency(gc, dep)
+		if err != nil {
+			return fmt.Errorf("cannot recover profile %s from %s: %w", locked.Profile, sourceStatusLabel(src.SourceType, src.SourceRef), err)
+		}
+		modules = append(modules, keepModuleIDs(mods, src.ModuleIDs)...)
+	}
+	if err := build.CheckDuplicateIDs(modules); err != nil {
+		return err
+	}
+	build.Sort(modules)
+	meta, err := profilesvc.SaveSnapshot(profilesvc.SaveInput{
+		ID:          locked.Profile,
+		Alias:       locked.ProfileAlias,
+		Sources:     locked.ProfileSources,
+		ContentHash: profilesvc.ComputeContentHash(modules, "default"),
+		Modules:     modules,
+	})
+	if err != nil {
+		return err
+	}
+	_, dir, err := profilesvc.ResolveIDOrAlias(meta.ID)
+	if err != nil {
+		return err
+	}
+	_, hash, err := profilesvc.Expand(dir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: locked.Export}), expandOptions(config.Ruleset{}))
+	if err == nil && hash != locked.ContentHash {
+		err = fmt.Errorf("cannot recover profile %s: its sources no longer produce the locked content; run rulepack deps install", locked.Profile)
+	}
+	if err != nil {
+		_, _, _ = profilesvc.Remove(meta.ID)
+		return err
+	}
+	return nil
+}
+
+// recoverMissingProfiles rebuilds every locked saved profile missing from
+// the profile stores and returns their IDs.
+func recoverMissingProfiles(cfg config.Ruleset) ([]string, error) {
+	lock, err := config.LoadLockfile(lockFile)
+	if err != nil {
+		return nil, err
+	}
+	missing, err := missingLockedProfiles(lock)
+	if err != nil || len(missing) == 0 {
+		return nil, err
+	}
+	gc, err := newProjectGitClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	recovered := make([]string, 0, len(missing))
+	for _, i := range missing {
+		if err := recoverLockedProfile(gc, i, lock.Resolved[i]); err != nil {
+			return nil, err
+		}
+		recovered = append(recovered, lock.Resolved[i].Profile)
+	}
+	return recovered, nil
+}
+
+// keepModuleIDs narrows modules to ids; an empty ids keeps them all.
+func keepModuleIDs(modules []pack.Module, ids []string) []pack.Module {
+	if len(ids) == 0 {
+		return modules
+	}
+	out := make([]pack.Module, 0, len(ids))
+	for _, m := range modules {
+		if slices.Contains(ids, m.ID) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
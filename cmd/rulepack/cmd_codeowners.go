@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/render"
+)
+
+// The markers around the entries codeowners --write manages in a CODEOWNERS
+// file; lines outside them are left alone.
+const (
+	codeownersBegin = "# rulepack:codeowners begin"
+	codeownersEnd   = "# rulepack:codeowners end"
+)
+
+func (a *app) newCodeownersCmd() *cobra.Command {
+	var targets []string
+	var write string
+	cmd := &cobra.Command{
+		Use:   "codeowners",
+		Short: "Emit CODEOWNERS entries for generated rule files",
+		Long:  "Map each file the configured targets generate to the owners of the modules rendered into it, from the module owner field in pack manifests. Prints CODEOWNERS lines, or the mapping with --json. Files whose modules have no owner are left out of the CODEOWNERS lines. With --write the entries replace rulepack's marked block in the given CODEOWNERS file.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadEffectiveRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			names, err := coverageTargets(cfg, targets)
+			if err != nil {
+				return err
+			}
+			modules, err := composeModules(cfg, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+			owners := make(map[string][]string, len(modules))
+			for _, m := range modules {
+				owners[m.ID] = strings.Fields(m.Owner)
+			}
+			byPath := map[string]*codeownersFile{}
+			for _, name := range names {
+				entry := cfg.Targets[name]
+				files, err := render.OutputModules(entry.Kind(name), entry, targetModules(entry, modules))
+				if err != nil {
+					return err
+				}
+				for path, ids := range files {
+					path = filepath.ToSlash(path)
+					f, ok := byPath[path]
+					if !ok {
+						f = &codeownersFile{Path: path, Targets: []string{}, Owners: []string{}, Modules: []string{}}
+						byPath[path] = f
+					}
+					f.Targets = append(f.Targets, name)
+					for _, id := range ids {
+						if !slices.Contains(f.Modules, id) {
+							f.Modules = append(f.Modules, id)
+						}
+						for _, owner := range owners[id] {
+							if !slices.Contains(f.Owners, owner) {
+								f.Owners = append(f.Owners, owner)
+							}
+						}
+					}
+				}
+			}
+			out := codeownersOutput{Files: make([]codeownersFile, 0, len(byPath))}
+			for _, f := range byPath {
+				sort.Strings(f.Owners)
+				out.Files = append(out.Files, *f)
+			}
+			sort.Slice(out.Files, func(i, j int) bool { return out.Files[i].Path < out.Files[j].Path })
+			lines := codeownersLines(out.Files)
+
+			if write != "" {
+				if err := writeCodeowners(write, lines); err != nil {
+					return err
+				}
+				out.Written = write
+			}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("codeowners", out)
+			}
+			if write == "" {
+				_, err := fmt.Fprint(cmd.OutOrStdout(), strings.Join(lines, "\n")+"\n")
+				return err
+			}
+			rows := make([][]string, 0, len(out.Files))
+			for _, f := range out.Files {
+				rows = append(rows, []string{f.Path, strings.Join(f.Owners, " "), strings.Join(f.Modules, ", ")})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "codeowners",
+				Title:   "Codeowners",
+				Tables:  []cliout.Table{{Title: write, Columns: []string{"File", "Owners", "Modules"}, Rows: rows}},
+				Summary: map[string]string{"files": strconv.Itoa(len(out.Files)), "entries": strconv.Itoa(len(lines) - 2)},
+				Done:    "Codeowners written",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&targets, "target", nil, "map only this configured target's files (repeatable); default all")
+	cmd.Flags().StringVar(&write, "write", "", "replace rulepack's entries in this CODEOWNERS file instead of printing them")
+	return cmd
+}
+
+// codeownersLines returns the marked block of CODEOWNERS entries, one
+// root-anchored pattern per owned file.
+func codeownersLines(files []codeownersFile) []string {
+	lines := []string{codeownersBegin}
+	for _, f := range files {
+		if len(f.Owners) == 0 {
+			continue
+		}
+		pattern := "/" + strings.ReplaceAll(strings.TrimPrefix(f.Path, "./"), " ", `\ `)
+		lines = append(lines, pattern+" "+strings.Join(f.Owners, " "))
+	}
+	return append(lines, codeownersEnd)
+}
+
+// writeCodeowners replaces the marked block in the CODEOWNERS file at path,
+// or appends it when there is none yet.
+func writeCodeowners(path string, block []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	existing := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(data) == 0 {
+		existing = nil
+	}
+	begin, end := -1, -1
+	for i, line := range existing {
+		switch strings.TrimSpace(line) {
+		case codeownersBegin:
+			begin = i
+		case codeownersEnd:
+			if begin >= 0 && end < 0 {
+				end = i
+			}
+		}
+	}
+	var lines []string
+	switch {
+	case begin >= 0 && end >= 0:
+		lines = append(lines, existing[:begin]...)
+		lines = append(lines, block...)
+		lines = append(lines, existing[end+1:]...)
+	case begin >= 0:
+		return fmt.Errorf("%s: %q has no matching %q", path, codeownersBegin, codeownersEnd)
+	default:
+		lines = append(lines, existing...)
+		if len(lines) > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, block...)
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+}
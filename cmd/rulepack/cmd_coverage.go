@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/render"
+)
+
+func (a *app) newCoverageCmd() *cobra.Command {
+	var targets []string
+	var excludes []string
+	cmd := &cobra.Command{
+		Use:   "coverage",
+		Short: "Report which directories and extensions glob-scoped modules reach",
+		Long:  "Walk the project tree and, for each target, count the files in every directory and with every extension that at least one glob-scoped module applies to. Groups with no covered files are blind spots in the rule globs. Dot directories, node_modules, and vendor are skipped.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadEffectiveRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			names, err := coverageTargets(cfg, targets)
+			if err != nil {
+				return err
+			}
+			modules, err := composeModules(cfg, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+			files, err := coverageFiles(".", excludes)
+			if err != nil {
+				return err
+			}
+			out := coverageOutput{Files: len(files), Targets: make([]coverageTargetRow, 0, len(names))}
+			for _, name := range names {
+				entry := cfg.Targets[name]
+				groups, err := render.Coverage(entry.Kind(name), entry, targetModules(entry, modules), files)
+				if err != nil {
+					return err
+				}
+				row := coverageTargetRow{Target: name, Groups: groups, UncoveredDirs: []string{}, UncoveredExts: []string{}}
+				for _, g := range groups {
+					switch {
+					case g.Covered > 0:
+					case g.By == "dir":
+						row.UncoveredDirs = append(row.UncoveredDirs, g.Key)
+					default:
+						row.UncoveredExts = append(row.UncoveredExts, g.Key)
+					}
+				}
+				out.Targets = append(out.Targets, row)
+			}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("coverage", out)
+			}
+			tables := make([]cliout.Table, 0, len(out.Targets))
+			events := []cliout.Event{}
+			for _, t := range out.Targets {
+				rows := make([][]string, 0, len(t.Groups))
+				for _, g := range t.Groups {
+					rows = append(rows, []string{g.By, g.Key, strconv.Itoa(g.Files), strconv.Itoa(g.Covered), strings.Join(g.Modules, ", ")})
+				}
+				tables = append(tables, cliout.Table{Title: t.Target, Columns: []string{"By", "Path/Extension", "Files", "Covered", "Modules"}, Rows: rows})
+				if n := len(t.UncoveredDirs) + len(t.UncoveredExts); n > 0 {
+					events = append(events, cliout.Event{Level: "warn", Message: fmt.Sprintf("%s: no glob-scoped rules reach %d group(s)", t.Target, n)})
+				}
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "coverage",
+				Title:   "Rule Coverage",
+				Events:  events,
+				Tables:  tables,
+				Summary: map[string]string{"files": strconv.Itoa(out.Files), "targets": strconv.Itoa(len(out.Targets))},
+				Done:    "Coverage complete",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringArrayVar(&targets, "target", nil, "report only this configured target (repeatable); default all")
+	cmd.Flags().StringArrayVar(&excludes, "exclude", nil, "skip files or directories matching this glob, by path or name (repeatable)")
+	return cmd
+}
+
+// coverageTargets returns the targets to report, sorted: the requested ones,
+// or every configured target.
+func coverageTargets(cfg config.Ruleset, requested []string) ([]string, error) {
+	names := []string{}
+	if len(requested) == 0 {
+		for name := range cfg.Targets {
+			names = append(names, name)
+		}
+	}
+	for _, name := range requested {
+		name = strings.ToLower(name)
+		if _, ok := cfg.Targets[name]; !ok {
+			return nil, fmt.Errorf("target %q not configured", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// coverageFiles lists the slash-separated files under root that coverage
+// evaluates.
+func coverageFiles(root string, excludes []string) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(p)
+		if p == root {
+			return nil
+		}
+		excluded := false
+		for _, pattern := range excludes {
+			if ok, _ := path.Match(pattern, rel); ok {
+				excluded = true
+			} else if ok, _ := path.Match(pattern, d.Name()); ok {
+				excluded = true
+			}
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if excluded || strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !excluded {
+			files = append(files, rel)
+		}
+		return nil
+	})
+	return files, err
+}
@@ -1,15 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/spf13/cobra"
 	"rulepack/internal/cliout"
 	"rulepack/internal/config"
 	"rulepack/internal/git"
+	"rulepack/internal/pack"
 	profilesvc "rulepack/internal/profile"
 )
 
@@ -22,24 +31,35 @@ func (a *app) newDepsCmd() *cobra.Command {
 	root.AddCommand(a.newDepsListCmd())
 	root.AddCommand(a.newDepsUninstallCmd())
 	root.AddCommand(a.newDepsInstallCmd())
+	root.AddCommand(a.newDepsUpdateCmd())
 	root.AddCommand(a.newDepsOutdatedCmd())
+	root.AddCommand(a.newDepsLicensesCmd())
 	return root
 }
 
 func (a *app) newDepsListCmd() *cobra.Command {
+	var refresh bool
+	var noCache bool
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List dependencies configured in rulepack.json",
+		Long:  "List dependencies with health columns. Git sources are only fetched with --refresh; otherwise their resolve, export, and module checks are left blank.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			cfg, err := config.LoadRuleset(rulesetFile)
 			if err != nil {
 				return err
 			}
 			var lock config.Lockfile
-			_, lockErr := os.Stat(config.LockFileName)
+			_, lockErr := os.Stat(lockFile)
 			if lockErr == nil {
-				lock, _ = config.LoadLockfile(config.LockFileName)
+				lock, _ = config.LoadLockfile(lockFile)
 			}
+			lockedFor := lockEntriesByDependency(cfg.Dependencies, lock)
+			cfgPath, err := filepath.Abs(rulesetFile)
+			if err != nil {
+				return err
+			}
+			checker := depsHealthChecker{cfg: cfg, cfgDir: filepath.Dir(cfgPath), refresh: refresh, noCache: noCache, now: time.Now()}
 
 			rows := make([]depsListRow, 0, len(cfg.Dependencies))
 			for i, dep := range cfg.Dependencies {
@@ -47,17 +67,18 @@ func (a *app) newDepsListCmd() *cobra.Command {
 				if ref == "" {
 					ref = "-"
 				}
-				locked := ""
-				if i < len(lock.Resolved) {
-					locked = lockReference(lock.Resolved[i])
-				}
-				rows = append(rows, depsListRow{
+				row := depsListRow{
 					Index:  i + 1,
 					Source: dependencySource(dep),
 					Ref:    ref,
 					Export: dep.Export,
-					Locked: locked,
-				})
+				}
+				locked := lockedFor[i]
+				if locked != nil {
+					row.Locked = lockReference(*locked)
+				}
+				checker.check(&row, dep, locked)
+				rows = append(rows, row)
 			}
 			out := depsListOutput{Dependencies: rows}
 			if a.jsonMode {
@@ -65,56 +86,292 @@ func (a *app) newDepsListCmd() *cobra.Command {
 			}
 			tableRows := make([][]string, 0, len(rows))
 			for _, r := range rows {
-				tableRows = append(tableRows, []string{strconv.Itoa(r.Index), r.Source, r.Ref, r.Export, r.Locked})
+				age, delta := "-", "-"
+				if r.AgeDays != nil {
+					age = strconv.Itoa(*r.AgeDays) + "d"
+				}
+				if r.ModuleDelta != nil {
+					delta = fmt.Sprintf("%+d", *r.ModuleDelta)
+				}
+				tableRows = append(tableRows, []string{strconv.Itoa(r.Index), r.Source, r.Ref, r.Export, r.Locked, age, orDash(r.Resolves), orDash(r.ExportExists), delta, orDash(r.Health)})
 			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "deps.list",
 				Title:   "Dependencies",
-				Tables:  []cliout.Table{{Title: "Configured Dependencies", Columns: []string{"#", "Source", "Ref/Path/Profile", "Export", "Locked"}, Rows: tableRows}},
+				Tables:  []cliout.Table{{Title: "Configured Dependencies", Columns: []string{"#", "Source", "Ref/Path/Profile", "Export", "Locked", "Age", "Resolves", "Export Exists", "Modules +/-", "Health"}, Rows: tableRows}},
 				Done:    "Dependency listing complete",
 			})
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&refresh, "refresh", false, "fetch git sources to check that they still resolve")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "with --refresh, fetch even git sources resolved in the last five minutes")
 	return cmd
 }
 
+// lockEntriesByDependency matches lock entries to deps for reporting, where
+// a partly stale lock is expected: dependencies without an entry get nil.
+// Keyed entries match by key; lockfiles without keys match by position.
+func lockEntriesByDependency(deps []config.Dependency, lock config.Lockfile) []*config.LockedSource {
+	out := make([]*config.LockedSource, len(deps))
+	if aligned, err := lock.Align(deps); err == nil {
+		for i := range aligned {
+			out[i] = &aligned[i]
+		}
+		return out
+	}
+	used := make([]bool, len(lock.Resolved))
+	for i, dep := range deps {
+		for j := range lock.Resolved {
+			locked := &lock.Resolved[j]
+			if used[j] || (locked.Key != dep.Key() && (locked.Key != "" || j != i)) {
+				continue
+			}
+			used[j] = true
+			out[i] = locked
+			break
+		}
+	}
+	return out
+}
+
+// staleDependencyDays is the locked commit age at which deps list reports a
+// dependency as stale.
+const staleDependencyDays = 365
+
+// depsHealthChecker computes the deps list health columns. Local and saved
+// profile sources are always checked; git sources and registry profiles need
+// refresh, except for the age of a git source's locked commit, which is read
+// from the local cache when present.
+type depsHealthChecker struct {
+	cfg     config.Ruleset
+	cfgDir  string
+	refresh bool
+	noCache bool
+	now     time.Time
+	gc      *git.Client
+}
+
+// resolveGit fetches and resolves a git dependency, or reuses a resolution
+// recorded in the last ResolutionTTL whose mirror is still cached.
+func (c *depsHealthChecker) resolveGit(dep config.Dependency) (string, git.CachedResolution, error) {
+	if !c.noCache {
+		if res, ok := c.gc.CachedResolution(dep.URI, dep.Ref, dep.Version, c.now); ok {
+			if repoDir, ok := c.gc.CachedRepo(dep.URI); ok {
+				return repoDir, res, nil
+			}
+		}
+	}
+	repoDir, err := c.gc.EnsureRepo(dep.URI)
+	if err != nil {
+		return "", git.CachedResolution{}, err
+	}
+	res, err := resolveAndRecord(c.gc, repoDir, dep, c.now)
+	return repoDir, res, err
+}
+
+func (c *depsHealthChecker) check(row *depsListRow, dep config.Dependency, locked *config.LockedSource) {
+	var modules []pack.Module
+	var expandErr error
+	opts := expandOptions(c.cfg)
+	switch row.Source {
+	case "git":
+		if c.gc == nil {
+			gc, err := newProjectGitClient(c.cfg)
+			if err != nil {
+				return
+			}
+			c.gc = gc
+		}
+		if locked != nil && locked.Commit != "" {
+			if repoDir, ok := c.gc.CachedRepo(dep.URI); ok {
+				if at, err := c.gc.CommitTime(repoDir, locked.Commit); err == nil {
+					days := int(c.now.Sub(at).Hours() / 24)
+					row.AgeDays = &days
+				}
+			}
+		}
+		if !c.refresh {
+			break
+		}
+		repoDir, res, err := c.resolveGit(dep)
+		if err != nil {
+			row.Resolves = "no"
+			break
+		}
+		row.Resolves = "yes"
+		modules, expandErr = pack.ExpandGitDependency(c.gc, repoDir, dep, config.LockedSource{Source: "git", URI: dep.URI, Commit: res.Commit, Export: dep.Export}, opts)
+	case "local":
+		absLocalPath, _, err := resolveLocalPath(c.cfgDir, dep.Path)
+		if err != nil {
+			row.Resolves = "no"
+			break
+		}
+		if _, err := os.Stat(absLocalPath); err != nil {
+			row.Resolves = "no"
+			break
+		}
+		row.Resolves = "yes"
+		modules, _, expandErr = pack.ExpandLocalDependency(absLocalPath, dep, "local", opts)
+	case profilesvc.ProfileSource:
+		id := dep.Profile
+		if id == "" && locked != nil {
+			id = locked.Profile
+		}
+		if _, remote := config.ParseRemoteProfile(id); remote {
+			if !c.refresh {
+				break
+			}
+			if c.gc == nil {
+				gc, err := newProjectGitClient(c.cfg)
+				if err != nil {
+					return
+				}
+				c.gc = gc
+			}
+		}
+		loc, err := resolveProfileDependency(c.gc, c.cfg.ProfileRegistry, id, "")
+		if err != nil {
+			row.Resolves = "no"
+			break
+		}
+		row.Resolves = "yes"
+		modules, _, expandErr = profilesvc.Expand(loc.Dir, profileDependencyForRead(dep), opts)
+	}
+	if row.Resolves == "yes" {
+		switch {
+		case expandErr == nil:
+			row.ExportExists = "yes"
+			if locked != nil && locked.ModuleCount > 0 {
+				delta := len(modules) - locked.ModuleCount
+				row.ModuleDelta = &delta
+			}
+		case errors.Is(expandErr, pack.ErrMissingExport):
+			row.ExportExists = "no"
+		}
+	}
+
+	switch {
+	case row.Resolves == "no" || row.ExportExists == "no":
+		row.Health = "broken"
+	case row.AgeDays != nil && *row.AgeDays >= staleDependencyDays:
+		row.Health = "stale"
+	case row.Resolves == "yes" && row.ExportExists == "yes":
+		row.Health = "ok"
+	}
+}
+
+func orDash(v string) string {
+	if v == "" {
+		return "-"
+	}
+	return v
+}
+
 func (a *app) newDepsInstallCmd() *cobra.Command {
+	var plan bool
+	var updateProfiles bool
+	var yes bool
+	var requireApproved bool
+	var noNotify bool
+	var strict bool
 	cmd := &cobra.Command{
-		Use:   "install",
+		Use:   "install [dep-selector...]",
 		Short: "Resolve dependencies and write rulepack.lock.json",
+		Long:  "Resolve every dependency and write rulepack.lock.json. With selectors only the selected dependencies resolve again; the others keep the git commit or registry commit they are locked to, and dependencies missing from the lock resolve fresh.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			timer := newPhaseTimer()
+			if plan && updateProfiles {
+				return fmt.Errorf("--update-profiles cannot be combined with --plan; preview with rulepack profile refresh --dry-run")
+			}
+			cfg, err := config.LoadRuleset(rulesetFile)
 			if err != nil {
 				return err
 			}
-			cfgPath, err := filepath.Abs(config.RulesetFileName)
+			cfgPath, err := filepath.Abs(rulesetFile)
 			if err != nil {
 				return err
 			}
 			cfgDir := filepath.Dir(cfgPath)
-			gc, err := git.NewClient()
+			gc, err := newProjectGitClient(cfg)
+			if err != nil {
+				return err
+			}
+			var updated []profileRefreshOutput
+			if updateProfiles {
+				if updated, err = a.refreshProfileDependencies(cmd, cfg, gc, yes); err != nil {
+					return err
+				}
+			}
+			hold, err := installHold(cfg, args)
 			if err != nil {
 				return err
 			}
-			lock, resolvedRows, counts, err := buildLock(cfg, cfgDir, gc)
+			lock, resolvedRows, counts, composed, warnings, err := buildLock(cfg, cfgDir, gc, nil, hold, timer)
 			if err != nil {
 				return err
 			}
-			if err := config.SaveLockfile(config.LockFileName, lock); err != nil {
+			// Overrides files add to rulepack.json's overrides, so check
+			// them all; cfg itself keeps only rulepack.json's.
+			effective, err := config.LoadEffectiveRuleset(rulesetFile)
+			if err != nil {
 				return err
 			}
-			out := installOutput{LockFile: config.LockFileName, Resolved: resolvedRows, Counts: counts}
+			overrideWarnings, err := checkOverrides(effective.Overrides, composed, strict)
+			if err != nil {
+				return err
+			}
+			warnings = append(warnings, overrideWarnings...)
+			if requireApproved {
+				if err := checkApprovals(cfg.Dependencies, lock); err != nil {
+					return err
+				}
+			}
+			if plan {
+				return a.renderPlan(planOutput{Command: "install", Actions: installPlan(lock)})
+			}
+			// A missing or unreadable previous lock makes every entry new.
+			previous, _ := config.LoadLockfile(lockFile)
+			if err := a.snapshotProject("deps install"); err != nil {
+				return err
+			}
+			if err := config.SaveLockfile(lockFile, lock); err != nil {
+				return err
+			}
+			if !noNotify && cfg.Notify != nil {
+				changes := dependencyChanges(gc, expandOptions(cfg), cfg.Dependencies, previous, lock)
+				warnings = append(warnings, notifyDependencyChanges(cfg, "deps.install", changes)...)
+			}
+			timings := timer.timings()
+			pruned := prunedLockRows(previous, previous.Orphans(cfg.Dependencies))
+			out := installOutput{LockFile: lockFile, Resolved: resolvedRows, Counts: counts, Warnings: warnings, Pruned: pruned, UpdatedProfiles: updated, Timings: &timings}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("install", out)
 			}
 			rows := make([][]string, 0, len(resolvedRows))
+			ignored := 0
 			for _, r := range resolvedRows {
 				rows = append(rows, []string{strconv.Itoa(r.Index), r.Source, r.Ref, r.Export, r.Resolved, r.Hash})
+				ignored += r.Ignored
+			}
+			events := []cliout.Event{}
+			for _, p := range updated {
+				events = append(events, cliout.Event{Level: "info", Message: fmt.Sprintf("Refreshed profile %s: %d changed, %d added, %d removed", p.OldProfileID, len(p.ChangedModules), len(p.AddedModules), len(p.RemovedModules))})
+				events = append(events, localEditEvents(p)...)
+			}
+			if ignored > 0 {
+				events = append(events, cliout.Event{Level: "info", Message: fmt.Sprintf("%s excludes %d module(s) from builds", config.IgnoreFileName, ignored)})
+			}
+			for _, row := range pruned {
+				events = append(events, cliout.Event{Level: "info", Message: fmt.Sprintf("Dropped lock entry of removed dependency %s (%s)", row.Ref, row.Resolved)})
+			}
+			for _, w := range warnings {
+				events = append(events, cliout.Event{Level: "warn", Message: w})
 			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "install",
 				Title:   "Install Dependencies",
+				Events:  events,
 				Tables: []cliout.Table{{
 					Title:   "Resolved Dependencies",
 					Columns: []string{"#", "Source", "Ref/Path/Profile", "Export", "Resolved", "Hash/Commit"},
@@ -124,71 +381,265 @@ func (a *app) newDepsInstallCmd() *cobra.Command {
 					"git":       strconv.Itoa(counts["git"]),
 					"local":     strconv.Itoa(counts["local"]),
 					"profile":   strconv.Itoa(counts["profile"]),
-					"lock file": config.LockFileName,
+					"lock file": lockFile,
 				},
 				Done: "Install complete",
 			})
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&plan, "plan", false, "resolve dependencies and report lockfile changes without writing them")
+	cmd.Flags().BoolVar(&updateProfiles, "update-profiles", false, "refresh saved profile dependencies from their recorded sources before locking")
+	cmd.Flags().BoolVar(&yes, "yes", false, "confirm in-place profile refreshes without prompting")
+	cmd.Flags().BoolVar(&requireApproved, "require-approved", false, "fail without writing the lockfile unless every dependency's locked content hash has an approval")
+	cmd.Flags().BoolVar(&noNotify, "no-notify", false, "do not send the notify payload for this run")
+	cmd.Flags().BoolVar(&strict, "strict", false, "fail when an override matches no module the dependencies provide")
 	return cmd
 }
 
+// installHold returns the lock entries an install with selectors keeps:
+// those of every unselected dependency still locked to the same source.
+func installHold(cfg config.Ruleset, selectors []string) ([]*config.LockedSource, error) {
+	if len(selectors) == 0 {
+		return nil, nil
+	}
+	selected := map[int]bool{}
+	for _, sel := range selectors {
+		idx, err := findDependencyIndex(cfg, sel)
+		if err != nil {
+			return nil, err
+		}
+		selected[idx] = true
+	}
+	// Without a readable lock every dependency resolves fresh.
+	lock, _ := config.LoadLockfile(lockFile)
+	hold := lockEntriesByDependency(cfg.Dependencies, lock)
+	for i, locked := range hold {
+		dep := cfg.Dependencies[i]
+		if selected[i] || locked == nil || lockSource(*locked) != dependencySource(dep) || (dependencySource(dep) == "git" && locked.URI != dep.URI) {
+			hold[i] = nil
+		}
+	}
+	return hold, nil
+}
+
+// refreshProfileDependencies refreshes every saved profile the ruleset
+// depends on in place, so the lock written next records the new hashes.
+// Registry profiles are immutable releases and are left alone.
+func (a *app) refreshProfileDependencies(cmd *cobra.Command, cfg config.Ruleset, gc *git.Client, yes bool) ([]profileRefreshOutput, error) {
+	pending := []inPlaceRefresh{}
+	preview := []string{}
+	seen := map[string]bool{}
+	for _, dep := range cfg.Dependencies {
+		if dep.Source != profilesvc.ProfileSource {
+			continue
+		}
+		if _, ok := config.ParseRemoteProfile(dep.Profile); ok {
+			continue
+		}
+		meta, _, err := profilesvc.ResolveIDOrAlias(dep.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if seen[meta.ID] {
+			continue
+		}
+		seen[meta.ID] = true
+		p, err := planInPlaceRefresh(gc, meta, false)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+		preview = append(preview, p.preview()...)
+	}
+	if err := confirmRiskAction(
+		cmd,
+		a.jsonMode,
+		yes,
+		len(preview) > 0,
+		fmt.Sprintf("deps install --update-profiles would update %d profile(s) in place with module diffs", len(pending)),
+		fmt.Sprintf("Refresh %d profile(s) in place with %d module change(s) before locking?", len(pending), len(preview)),
+		preview,
+		"deps install",
+	); err != nil {
+		return nil, err
+	}
+	updated := make([]profileRefreshOutput, 0, len(pending))
+	for _, p := range pending {
+		if err := p.save(); err != nil {
+			return nil, err
+		}
+		updated = append(updated, p.out)
+	}
+	return updated, nil
+}
+
+// installPlan compares a freshly resolved lock with the one on disk.
+func installPlan(lock config.Lockfile) []planAction {
+	old, err := config.LoadLockfile(lockFile)
+	fileAction := "update"
+	if err != nil {
+		fileAction = "create"
+	}
+	actions := make([]planAction, 0)
+	pairs, unpaired := pairLockEntries(old.Resolved, lock.Resolved)
+	for i, locked := range lock.Resolved {
+		ref := lockSourceReference(locked)
+		switch prev := pairs[i]; {
+		case prev < 0:
+			actions = append(actions, planAction{Action: "create", Kind: "lock entry", Target: ref, Detail: lockReference(locked)})
+		case !reflect.DeepEqual(old.Resolved[prev], locked):
+			actions = append(actions, planAction{Action: "update", Kind: "lock entry", Target: ref, Detail: lockReference(old.Resolved[prev]) + " -> " + lockReference(locked)})
+		}
+	}
+	for _, j := range unpaired {
+		actions = append(actions, planAction{Action: "delete", Kind: "lock entry", Target: lockSourceReference(old.Resolved[j])})
+	}
+	if len(actions) > 0 || fileAction == "create" {
+		actions = append(actions, planAction{Action: fileAction, Kind: "file", Target: lockFile})
+	}
+	return actions
+}
+
+// pairLockEntries returns, for each entry of resolved, the index of the
+// previous entry it replaces, or -1, and the previous entries nothing
+// replaces. Entries are paired by key, so reordering dependencies changes
+// nothing; previous entries without a key pair by position.
+func pairLockEntries(previous, resolved []config.LockedSource) (pairs []int, unpaired []int) {
+	used := make([]bool, len(previous))
+	pairs = make([]int, len(resolved))
+	for i, locked := range resolved {
+		pairs[i] = -1
+		for j, candidate := range previous {
+			if !used[j] && (candidate.Key == locked.Key || (candidate.Key == "" && j == i)) {
+				pairs[i] = j
+				used[j] = true
+				break
+			}
+		}
+	}
+	for j := range previous {
+		if !used[j] {
+			unpaired = append(unpaired, j)
+		}
+	}
+	return pairs, unpaired
+}
+
 func (a *app) newDepsOutdatedCmd() *cobra.Command {
+	var failWhen string
+	var quiet bool
+	var timeout time.Duration
+	var jobs int
+	var noCache bool
 	cmd := &cobra.Command{
 		Use:   "outdated",
 		Short: "Check whether dependencies have newer resolvable revisions",
+		Long:  "Fetch every git dependency concurrently and report whether a newer revision resolves. Each fetch is limited by --timeout; a dependency that times out is reported as an error without holding up the rest. On interrupt, the dependencies checked so far are reported and the rest are marked cancelled. Resolutions checked in the last five minutes are reused without fetching unless --no-cache is set.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			threshold, err := parseOutdatedThreshold(failWhen)
 			if err != nil {
 				return err
 			}
-			lock, err := config.LoadLockfile(config.LockFileName)
+			if timeout <= 0 {
+				return fmt.Errorf("--timeout must be positive")
+			}
+			if jobs < 1 {
+				return fmt.Errorf("--jobs must be at least 1")
+			}
+			cfg, err := config.LoadRuleset(rulesetFile)
 			if err != nil {
 				return err
 			}
-			if len(cfg.Dependencies) != len(lock.Resolved) {
-				return fmt.Errorf("lockfile mismatch: run rulepack deps install")
+			lock, err := config.LoadLockfile(lockFile)
+			if err != nil {
+				return err
 			}
-			gc, err := git.NewClient()
+			aligned, err := lock.Align(cfg.Dependencies)
+			if err != nil {
+				return err
+			}
+			gc, err := newProjectGitClient(cfg)
 			if err != nil {
 				return err
 			}
 
+			ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt)
+			defer stop()
+			now := time.Now()
+			cached := map[int]git.CachedResolution{}
+			uris := make([]string, 0, len(cfg.Dependencies))
+			for i, dep := range cfg.Dependencies {
+				if dependencySource(dep) != "git" {
+					continue
+				}
+				if !noCache {
+					if r, ok := gc.CachedResolution(dep.URI, dep.Ref, dep.Version, now); ok {
+						cached[i] = r
+						continue
+					}
+				}
+				uris = append(uris, dep.URI)
+			}
+			repos := fetchRepos(ctx, gc, uris, timeout, jobs)
+
 			rows := make([]outdatedEntry, 0, len(cfg.Dependencies))
-			outdatedCount := 0
 			for i, dep := range cfg.Dependencies {
-				locked := lock.Resolved[i]
+				locked := aligned[i]
 				source := dependencySource(dep)
 				entry := outdatedEntry{
-					Index:     i + 1,
-					Source:    source,
-					Reference: dependencyReference(dep),
+					Index:      i + 1,
+					Source:     source,
+					Reference:  dependencyReference(dep),
+					MaxAgeDays: dep.MaxAgeDays,
 				}
+				entry.Freshness, entry.LockAgeDays = lockFreshness(dep, locked, now)
 				switch source {
 				case "git":
-					repoDir, err := gc.EnsureRepo(dep.URI)
-					if err != nil {
-						entry.UpdateStatus = "error"
-						entry.Latest = err.Error()
-						rows = append(rows, entry)
-						continue
-					}
-					res, err := gc.Resolve(repoDir, dep.Ref, dep.Version)
-					if err != nil {
-						entry.UpdateStatus = "error"
-						entry.Latest = err.Error()
-						rows = append(rows, entry)
-						continue
+					res, ok := cached[i]
+					entry.Cached = ok
+					repoDir, _ := gc.CachedRepo(dep.URI)
+					if !ok {
+						fetched := repos[dep.URI]
+						if fetched.err != nil {
+							entry.UpdateStatus = "error"
+							if fetched.cancelled {
+								entry.UpdateStatus = "cancelled"
+							}
+							entry.Latest = fetched.err.Error()
+							rows = append(rows, entry)
+							continue
+						}
+						repoDir = fetched.dir
+						var err error
+						if res, err = resolveAndRecord(gc, fetched.dir, dep, now); err != nil {
+							entry.UpdateStatus = "error"
+							entry.Latest = err.Error()
+							rows = append(rows, entry)
+							continue
+						}
 					}
 					entry.Locked = shortSHA(locked.Commit)
 					entry.Latest = shortSHA(res.Commit)
 					if locked.Commit != "" && res.Commit != locked.Commit {
 						entry.UpdateStatus = "outdated"
-						outdatedCount++
+						var missing *pack.MissingExportError
+						if err := pack.CheckExport(pack.GitReader(gc, repoDir, res.Commit), dep); errors.As(err, &missing) {
+							entry.UpdateStatus = "export-removed"
+							entry.AvailableExports = missing.Available
+						}
 					} else {
 						entry.UpdateStatus = "up-to-date"
 					}
+					if lockedVersion, err := semver.NewVersion(locked.ResolvedVersion); err == nil {
+						newest, err := semver.NewVersion(res.Newest)
+						if err == nil && newest.GreaterThan(lockedVersion) {
+							entry.Newest = newest.String()
+							if newest.Major() > lockedVersion.Major() {
+								entry.MajorUpdate = true
+							}
+						}
+					}
 				case "local", profilesvc.ProfileSource:
 					entry.Locked = lockReference(locked)
 					entry.Latest = "-"
@@ -199,37 +650,218 @@ func (a *app) newDepsOutdatedCmd() *cobra.Command {
 				rows = append(rows, entry)
 			}
 
-			out := newOutdatedOutput(rows, outdatedCount)
-			if a.jsonMode {
-				return a.renderer.RenderJSON("outdated", out)
+			out := newOutdatedOutput(rows)
+			if err := a.renderOutdated(out, quiet); err != nil {
+				return err
 			}
-			tableRows := make([][]string, 0, len(rows))
-			for _, r := range rows {
-				tableRows = append(tableRows, []string{
-					strconv.Itoa(r.Index),
-					r.Source,
-					r.Reference,
-					r.Locked,
-					r.Latest,
-					r.UpdateStatus,
-				})
+			if out.CancelledCount > 0 {
+				return fmt.Errorf("outdated check interrupted: %d dependency check(s) cancelled; results are partial", out.CancelledCount)
+			}
+			if threshold.exceeded(out) {
+				return fmt.Errorf("outdated dependencies exceed --fail-when %s: %d outdated, %d with a major update, %d past maxAgeDays", failWhen, out.OutdatedCount, out.MajorCount, out.StaleCount)
 			}
-			a.renderer.RenderHuman(cliout.HumanPayload{
-				Command: "outdated",
-				Title:   "Dependency Update Check",
-				Tables: []cliout.Table{{
-					Title:   "Dependency Status",
-					Columns: []string{"#", "Source", "Ref/Path/Profile", "Locked", "Latest", "Status"},
-					Rows:    tableRows,
-				}},
-				Summary: map[string]string{
-					"outdated": strconv.Itoa(outdatedCount),
-					"total":    strconv.Itoa(len(rows)),
-				},
-				Done: "Outdated check complete",
-			})
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&failWhen, "fail-when", "", "exit non-zero when any dependency is outdated (any), has a newer major version (major), is locked longer than its maxAgeDays (stale), or more than N are outdated (count>N)")
+	cmd.Flags().BoolVar(&quiet, "quiet", false, "print only the summary counts in human output")
+	cmd.Flags().DurationVar(&timeout, "timeout", time.Minute, "give up on a dependency whose fetch takes longer than this")
+	cmd.Flags().IntVar(&jobs, "jobs", 8, "fetch at most this many dependencies at once")
+	cmd.Flags().BoolVar(&noCache, "no-cache", false, "fetch every git dependency instead of reusing resolutions from the last five minutes")
 	return cmd
 }
+
+// resolveAndRecord resolves dep in its fetched mirror, with the newest
+// version tag, and records the result for later cached checks.
+func resolveAndRecord(gc *git.Client, repoDir string, dep config.Dependency, now time.Time) (git.CachedResolution, error) {
+	res, err := gc.Resolve(repoDir, dep.Ref, dep.Version)
+	if err != nil {
+		return git.CachedResolution{}, err
+	}
+	r := git.CachedResolution{Requested: res.Requested, ResolvedVersion: res.ResolvedVersion, Commit: res.Commit, CheckedAt: now}
+	if newest, err := gc.NewestVersion(repoDir); err == nil && newest != nil {
+		r.Newest = newest.String()
+	}
+	// The cache only spares later fetches; failing to write it is not an error.
+	_ = gc.RecordResolution(dep.URI, dep.Ref, dep.Version, r)
+	return r, nil
+}
+
+// repoFetch is the outcome of fetching one git dependency for outdated.
+type repoFetch struct {
+	dir string
+	err error
+	// cancelled is set when ctx ended before the fetch finished.
+	cancelled bool
+}
+
+// fetchRepos fetches each distinct uri, at most jobs at a time and each
+// under its own timeout. Fetches still queued or running when ctx is done
+// come back cancelled, so callers can report what finished.
+func fetchRepos(ctx context.Context, gc *git.Client, uris []string, timeout time.Duration, jobs int) map[string]repoFetch {
+	results := make(map[string]repoFetch, len(uris))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, jobs)
+	// Duplicate URIs share one fetch.
+	seen := make(map[string]bool, len(uris))
+	for _, uri := range uris {
+		if seen[uri] {
+			continue
+		}
+		seen[uri] = true
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := repoFetch{}
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+				fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+				defer cancel()
+				result.dir, result.err = gc.EnsureRepoContext(fetchCtx, uri)
+				switch {
+				case result.err == nil:
+				case ctx.Err() != nil:
+					result.err, result.cancelled = fmt.Errorf("fetch cancelled"), true
+				case fetchCtx.Err() != nil:
+					result.err = fmt.Errorf("fetch timed out after %s", timeout)
+				}
+			case <-ctx.Done():
+				result.err, result.cancelled = fmt.Errorf("fetch cancelled"), true
+			}
+			mu.Lock()
+			results[uri] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (a *app) renderOutdated(out outdatedOutput, quiet bool) error {
+	if a.jsonMode {
+		return a.renderer.RenderJSON("outdated", out)
+	}
+	summary := map[string]string{
+		"outdated": strconv.Itoa(out.OutdatedCount),
+		"major":    strconv.Itoa(out.MajorCount),
+		"stale":    strconv.Itoa(out.StaleCount),
+		"total":    strconv.Itoa(len(out.Dependencies)),
+	}
+	if out.CancelledCount > 0 {
+		summary["cancelled"] = strconv.Itoa(out.CancelledCount)
+	}
+	if quiet {
+		a.renderer.RenderHuman(cliout.HumanPayload{
+			Command: "outdated",
+			Title:   "Dependency Update Check",
+			Summary: summary,
+		})
+		return nil
+	}
+	tableRows := make([][]string, 0, len(out.Dependencies))
+	events := make([]cliout.Event, 0)
+	for _, r := range out.Dependencies {
+		if r.UpdateStatus == "export-removed" {
+			events = append(events, cliout.Event{Level: "warn", Message: fmt.Sprintf("dependency #%d: export removed upstream; available exports: %s", r.Index, orDash(strings.Join(r.AvailableExports, ", ")))})
+		}
+		tableRows = append(tableRows, []string{
+			strconv.Itoa(r.Index),
+			r.Source,
+			r.Reference,
+			r.Locked,
+			r.Latest,
+			orDash(r.Newest),
+			r.UpdateStatus,
+			freshnessLabel(r.Freshness, r.LockAgeDays, r.MaxAgeDays),
+		})
+	}
+	a.renderer.RenderHuman(cliout.HumanPayload{
+		Command: "outdated",
+		Title:   "Dependency Update Check",
+		Events:  events,
+		Tables: []cliout.Table{{
+			Title:   "Dependency Status",
+			Columns: []string{"#", "Source", "Ref/Path/Profile", "Locked", "Latest", "Newest", "Status", "Freshness"},
+			Rows:    tableRows,
+		}},
+		Summary: summary,
+		Done:    "Outdated check complete",
+	})
+	return nil
+}
+
+// lockFreshness checks a lock entry against the dependency's maxAgeDays. It
+// returns "" when no limit is set, unknown when the entry predates lockedAt,
+// and otherwise ok or stale along with the lock age.
+func lockFreshness(dep config.Dependency, locked config.LockedSource, now time.Time) (string, *int) {
+	if dep.MaxAgeDays == 0 {
+		return "", nil
+	}
+	age, ok := locked.AgeDays(now)
+	if !ok {
+		return "unknown", nil
+	}
+	if age > dep.MaxAgeDays {
+		return "stale", &age
+	}
+	return "ok", &age
+}
+
+func freshnessLabel(freshness string, age *int, maxAge int) string {
+	if age == nil {
+		return orDash(freshness)
+	}
+	return fmt.Sprintf("%s (%dd of %dd)", freshness, *age, maxAge)
+}
+
+// outdatedThreshold is a parsed --fail-when value; the zero value never
+// fails.
+type outdatedThreshold struct {
+	kind  string
+	count int
+}
+
+func parseOutdatedThreshold(value string) (outdatedThreshold, error) {
+	switch value {
+	case "":
+		return outdatedThreshold{}, nil
+	case "any", "major", "stale":
+		return outdatedThreshold{kind: value}, nil
+	}
+	if n, ok := strings.CutPrefix(value, "count>"); ok {
+		count, err := strconv.Atoi(n)
+		if err == nil && count >= 0 {
+			return outdatedThreshold{kind: "count", count: count}, nil
+		}
+	}
+	return outdatedThreshold{}, fmt.Errorf("invalid --fail-when %q: use any, major, stale, or count>N", value)
+}
+
+func (t outdatedThreshold) exceeded(out outdatedOutput) bool {
+	switch t.kind {
+	case "any":
+		return out.OutdatedCount > 0
+	case "major":
+		return out.MajorCount > 0
+	case "stale":
+		return out.StaleCount > 0
+	case "count":
+		return out.OutdatedCount > t.count
+	default:
+		return false
+	}
+}
+
+// lockSourceReference names a lock entry by its URI, path, or profile.
+func lockSourceReference(locked config.LockedSource) string {
+	switch lockSource(locked) {
+	case "git":
+		return locked.URI
+	case "local":
+		return locked.Path
+	default:
+		return locked.Profile
+	}
+}
@@ -3,13 +3,17 @@ package main
 import (
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/spf13/cobra"
 	"rulepack/internal/cliout"
 	"rulepack/internal/config"
+	"rulepack/internal/git"
+	"rulepack/internal/pack"
 )
 
 func (a *app) newDepsAddCmd() *cobra.Command {
@@ -18,10 +22,12 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 	var ref string
 	var localPath string
 	var yes bool
+	var plan bool
 
 	cmd := &cobra.Command{
 		Use:   "add [git-url]",
 		Short: "Add a dependency to rulepack.json",
+		Long:  "Add a git or local dependency to rulepack.json. The shorthand gh:org/repo[//dir][@ref] (gl: for GitLab) expands to the repository's clone URL, dir, and ref. A GitHub or GitLab page URL copied from the browser is translated to the repository's clone URL: a tree or blob URL also sets the ref it shows, and when it points into a directory of the pack, the export whose folders select that directory; a shorthand dir picks the export the same way. The expanded clone URL is what rulepack.json and the lockfile record. --ref, --version, and --export take precedence over what the URL implies.",
 		Args: func(cmd *cobra.Command, args []string) error {
 			hasGitURL := len(args) == 1
 			hasLocal := strings.TrimSpace(localPath) != ""
@@ -48,14 +54,16 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 				return errors.New("use only one of --version or --ref")
 			}
 
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			cfg, err := config.LoadRuleset(rulesetFile)
 			cwd, wdErr := os.Getwd()
 			if wdErr != nil {
 				return wdErr
 			}
 			cfgDir := cwd
+			rulesetAction := "update"
 			if err != nil {
 				if errors.Is(err, os.ErrNotExist) {
+					rulesetAction = "create"
 					cfg = config.DefaultRuleset(filepath.Base(cwd))
 				} else {
 					return err
@@ -64,6 +72,7 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 
 			dep := config.Dependency{Export: exportName}
 			matchKey := ""
+			fromURL := ""
 			if hasLocal {
 				_, normalizedPath, pathErr := resolveLocalPath(cfgDir, localPath)
 				if pathErr != nil {
@@ -77,6 +86,33 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 				dep.URI = args[0]
 				dep.Ref = ref
 				dep.Version = version
+				src, ok, srcErr := parseShorthand(args[0])
+				if srcErr != nil {
+					return srcErr
+				}
+				if !ok {
+					src, ok = parseBrowserURL(args[0], ref)
+				}
+				if ok {
+					dep.URI = src.URI
+					if ref == "" && version == "" {
+						dep.Ref = src.Ref
+					}
+					if src.Dir != "" && exportName == "" {
+						gc, gcErr := newProjectGitClient(cfg)
+						if gcErr != nil {
+							return gcErr
+						}
+						export, exportErr := browserExport(gc, dep, src.Dir)
+						if exportErr != nil {
+							return fmt.Errorf("%s: %w; pass --export", args[0], exportErr)
+						}
+						dep.Export = export
+					}
+					if dep.URI != args[0] {
+						fromURL = args[0]
+					}
+				}
 				matchKey = dep.URI + "#" + normalizeExportName(dep.Export)
 			}
 
@@ -86,6 +122,7 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 			for i := range cfg.Dependencies {
 				if dependencyMatchKey(cfg.Dependencies[i]) == matchKey && dependencySource(cfg.Dependencies[i]) == dependencySource(dep) {
 					old = cfg.Dependencies[i]
+					dep.Name = old.Name
 					cfg.Dependencies[i] = dep
 					action = "replaced"
 					replaced = true
@@ -96,26 +133,45 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 				cfg.Dependencies = append(cfg.Dependencies, dep)
 			}
 
+			riskMessage := fmt.Sprintf("add would replace existing dependency %q", matchKey)
+			preview := []string{
+				fmt.Sprintf("old source=%q uri=%q path=%q export=%q version=%q ref=%q", old.Source, old.URI, old.Path, old.Export, old.Version, old.Ref),
+				fmt.Sprintf("new source=%q uri=%q path=%q export=%q version=%q ref=%q", dep.Source, dep.URI, dep.Path, dep.Export, dep.Version, dep.Ref),
+			}
+			if plan {
+				depAction := "add"
+				if replaced {
+					depAction = "replace"
+				}
+				return a.renderPlan(planOutput{
+					Command: "add",
+					Actions: []planAction{
+						{Action: depAction, Kind: "dependency", Target: matchKey, Detail: preview[1]},
+						{Action: rulesetAction, Kind: "file", Target: rulesetFile},
+					},
+					Risks: newPlanRisk(replaced, riskMessage, preview),
+				})
+			}
 			if err := confirmRiskAction(
 				cmd,
 				a.jsonMode,
 				yes,
 				replaced,
-				fmt.Sprintf("add would replace existing dependency %q", matchKey),
-				fmt.Sprintf("Replace existing dependency %q in %s?", matchKey, config.RulesetFileName),
-				[]string{
-					fmt.Sprintf("old source=%q uri=%q path=%q export=%q version=%q ref=%q", old.Source, old.URI, old.Path, old.Export, old.Version, old.Ref),
-					fmt.Sprintf("new source=%q uri=%q path=%q export=%q version=%q ref=%q", dep.Source, dep.URI, dep.Path, dep.Export, dep.Version, dep.Ref),
-				},
+				riskMessage,
+				fmt.Sprintf("Replace existing dependency %q in %s?", matchKey, rulesetFile),
+				preview,
 				"add",
 			); err != nil {
 				return err
 			}
 
-			if err := config.SaveRuleset(config.RulesetFileName, cfg); err != nil {
+			if err := a.snapshotProject("deps add"); err != nil {
+				return err
+			}
+			if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
 				return err
 			}
-			out := addOutput{RulesetFile: config.RulesetFileName, Action: action, Dependency: dep}
+			out := addOutput{RulesetFile: rulesetFile, Action: action, Dependency: dep, FromURL: fromURL}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("add", out)
 			}
@@ -128,12 +184,16 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 				{"version", old.Version, dep.Version},
 				{"ref", old.Ref, dep.Ref},
 			}
+			events := []cliout.Event{{Level: "info", Message: "Action: " + action}}
+			if fromURL != "" {
+				events = append(events, cliout.Event{Level: "info", Message: "Translated " + fromURL + " to " + dep.URI})
+			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "add",
 				Title:   "Dependency Updated",
-				Events:  []cliout.Event{{Level: "info", Message: "Action: " + action}},
+				Events:  events,
 				Tables:  []cliout.Table{{Title: "Dependency Diff", Columns: []string{"Field", "Old", "New"}, Rows: diffRows}},
-				Done:    "Updated " + config.RulesetFileName,
+				Done:    "Updated " + rulesetFile,
 			})
 			return nil
 		},
@@ -143,6 +203,7 @@ func (a *app) newDepsAddCmd() *cobra.Command {
 	cmd.Flags().StringVar(&ref, "ref", "", "ref (commit/tag/branch)")
 	cmd.Flags().StringVar(&localPath, "local", "", "local rulepack path")
 	cmd.Flags().BoolVar(&yes, "yes", false, "confirm risky replacement without prompting")
+	cmd.Flags().BoolVar(&plan, "plan", false, "report the changes add would make without applying them")
 	return cmd
 }
 
@@ -156,3 +217,109 @@ func dependencyMatchKey(dep config.Dependency) string {
 		return dependencyReference(dep) + "#" + normalizeExportName(dep.Export)
 	}
 }
+
+// browserSource is a git dependency read from a repository page URL.
+type browserSource struct {
+	URI string
+	Ref string
+	// Dir is the pack directory the page shows, if any.
+	Dir string
+}
+
+// parseBrowserURL translates the URL of a GitHub or GitLab repository page,
+// as copied from a browser, into a clone URI, ref, and pack directory:
+// https://github.com/org/rules/tree/main/languages/python is
+// https://github.com/org/rules.git at main, directory languages/python. Blob
+// URLs name the file's directory. The segment after tree or blob is taken as
+// the ref unless ref, which may contain slashes, prefixes the rest.
+func parseBrowserURL(raw string, ref string) (browserSource, bool) {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return browserSource{}, false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	var repo, page []string
+	if host := strings.TrimPrefix(u.Host, "www."); host == "github.com" {
+		if len(segments) < 2 {
+			return browserSource{}, false
+		}
+		repo, page = segments[:2], segments[2:]
+	} else {
+		// GitLab project paths may nest groups, so "-" separates them from
+		// the page.
+		i := slices.Index(segments, "-")
+		if i < 2 {
+			return browserSource{}, false
+		}
+		repo, page = segments[:i], segments[i+1:]
+	}
+	src := browserSource{URI: u.Scheme + "://" + u.Host + "/" + strings.TrimSuffix(strings.Join(repo, "/"), ".git") + ".git"}
+	if len(page) == 0 {
+		return src, true
+	}
+	if len(page) < 2 || (page[0] != "tree" && page[0] != "blob") {
+		return browserSource{}, false
+	}
+	rest := strings.Join(page[1:], "/")
+	if ref != "" && (rest == ref || strings.HasPrefix(rest, ref+"/")) {
+		src.Ref, rest = ref, strings.TrimPrefix(strings.TrimPrefix(rest, ref), "/")
+	} else {
+		src.Ref, rest, _ = strings.Cut(rest, "/")
+	}
+	if page[0] == "blob" {
+		if i := strings.LastIndex(rest, "/"); i >= 0 {
+			rest = rest[:i]
+		} else {
+			rest = ""
+		}
+	}
+	src.Dir = rest
+	return src, true
+}
+
+// shorthandHosts maps the shorthand prefixes deps add accepts to the hosts
+// they expand to.
+var shorthandHosts = map[string]string{
+	"gh": "https://github.com/",
+	"gl": "https://gitlab.com/",
+}
+
+// parseShorthand expands gh:org/repo[//dir][@ref], or gl: for GitLab, into a
+// clone URI, ref, and pack directory. It reports false for anything without a
+// known prefix, and an error for a known prefix it cannot parse.
+func parseShorthand(raw string) (browserSource, bool, error) {
+	prefix, rest, found := strings.Cut(raw, ":")
+	host, known := shorthandHosts[prefix]
+	if !found || !known {
+		return browserSource{}, false, nil
+	}
+	var src browserSource
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		rest, src.Ref = rest[:i], rest[i+1:]
+		if src.Ref == "" {
+			return browserSource{}, false, fmt.Errorf("%s: empty ref after @", raw)
+		}
+	}
+	repo, dir, _ := strings.Cut(rest, "//")
+	segments := strings.Split(strings.TrimSuffix(repo, ".git"), "/")
+	if len(segments) < 2 || (prefix == "gh" && len(segments) != 2) || slices.Contains(segments, "") {
+		return browserSource{}, false, fmt.Errorf("%s: expected %s:org/repo[//dir][@ref]", raw, prefix)
+	}
+	src.URI = host + strings.Join(segments, "/") + ".git"
+	src.Dir = strings.Trim(dir, "/")
+	return src, true, nil
+}
+
+// browserExport reads the pack at the dependency's ref or version and returns
+// the export that selects dir.
+func browserExport(gc *git.Client, dep config.Dependency, dir string) (string, error) {
+	repoDir, err := gc.EnsureRepo(dep.URI)
+	if err != nil {
+		return "", fmt.Errorf("prepare %s: %w", dep.URI, err)
+	}
+	res, err := gc.Resolve(repoDir, dep.Ref, dep.Version)
+	if err != nil {
+		return "", fmt.Errorf("resolve %s: %w", dep.URI, err)
+	}
+	return pack.ExportForFolder(pack.GitReader(gc, repoDir, res.Commit), dir)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+// licenseRules are the SARIF rules deps licenses --sarif reports.
+var licenseRules = []cliout.SARIFRule{
+	{ID: "license-not-allowed", Description: "A locked dependency's license is not accepted by policy.licenses."},
+}
+
+func (a *app) newDepsLicensesCmd() *cobra.Command {
+	var sarifPath string
+	cmd := &cobra.Command{
+		Use:   "licenses",
+		Short: "Report the license recorded for each locked dependency",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			lock, err := config.LoadLockfile(lockFile)
+			if err != nil {
+				return err
+			}
+			aligned, err := lock.Align(cfg.Dependencies)
+			if err != nil {
+				return err
+			}
+			var policy *config.LicensePolicy
+			if cfg.Policy != nil {
+				policy = cfg.Policy.Licenses
+			}
+
+			rows := make([]licenseRow, 0, len(cfg.Dependencies))
+			violations := 0
+			for i, dep := range cfg.Dependencies {
+				locked := aligned[i]
+				source := dependencySource(dep)
+				row := licenseRow{
+					Index:     i + 1,
+					Source:    source,
+					Reference: dependencyReference(dep),
+					License:   locked.License,
+					Policy:    "-",
+				}
+				switch {
+				case policy == nil:
+				case source == "local":
+					row.Policy = "exempt"
+				case policy.Allows(locked.License):
+					row.Policy = "allowed"
+				default:
+					row.Policy = "denied"
+					violations++
+				}
+				rows = append(rows, row)
+			}
+
+			if sarifPath != "" {
+				if err := writeSARIF(sarifPath, licenseRules, licenseFindings(rows)); err != nil {
+					return err
+				}
+			}
+
+			out := licensesOutput{Dependencies: rows, Violations: violations}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("deps.licenses", out)
+			}
+			tableRows := make([][]string, 0, len(rows))
+			for _, r := range rows {
+				license := r.License
+				if license == "" {
+					license = "unknown"
+				}
+				tableRows = append(tableRows, []string{strconv.Itoa(r.Index), r.Source, r.Reference, license, r.Policy})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "deps.licenses",
+				Title:   "Dependency Licenses",
+				Tables:  []cliout.Table{{Title: "Licenses", Columns: []string{"#", "Source", "Ref/Path/Profile", "License", "Policy"}, Rows: tableRows}},
+				Summary: map[string]string{
+					"violations": strconv.Itoa(violations),
+					"total":      strconv.Itoa(len(rows)),
+				},
+				Done: "License report complete",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&sarifPath, "sarif", "", "also write policy violations as a SARIF 2.1.0 log to this file, for code-scanning tools")
+	return cmd
+}
+
+// licenseFindings reports each denied dependency against rulepack.json,
+// naming the dependency as the logical location.
+func licenseFindings(rows []licenseRow) []cliout.Finding {
+	findings := []cliout.Finding{}
+	for _, r := range rows {
+		if r.Policy != "denied" {
+			continue
+		}
+		license := r.License
+		if license == "" {
+			license = "no license"
+		}
+		findings = append(findings, cliout.Finding{
+			RuleID:  "license-not-allowed",
+			Level:   "error",
+			Message: fmt.Sprintf("dependency %d (%s) declares %s, which policy.licenses does not allow", r.Index, r.Reference, license),
+			File:    rulesetFile,
+			Logical: r.Reference,
+		})
+	}
+	return findings
+}
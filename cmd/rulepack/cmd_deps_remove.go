@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"sort"
 	"strconv"
@@ -14,12 +15,18 @@ import (
 func (a *app) newDepsUninstallCmd() *cobra.Command {
 	var yes bool
 	var cleanup bool
+	var plan bool
+	var sync bool
 	cmd := &cobra.Command{
 		Use:   "uninstall <dep-selector> [dep-selector...]",
 		Short: "Uninstall one or more dependencies from rulepack.json",
+		Long:  "Uninstall one or more dependencies from rulepack.json. With --sync, uninstall also drops their entries from the lockfile, as rulepack lock prune does, and then runs rulepack build, which deletes the generated files the removed dependencies no longer produce.",
 		Args:  cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			if sync && cleanup {
+				return fmt.Errorf("--sync rebuilds outputs; it cannot be combined with --cleanup")
+			}
+			cfg, err := config.LoadRuleset(rulesetFile)
 			if err != nil {
 				return err
 			}
@@ -49,30 +56,96 @@ func (a *app) newDepsUninstallCmd() *cobra.Command {
 				kept = append(kept, dep)
 			}
 			sort.Slice(removed, func(i, j int) bool { return removed[i].Index < removed[j].Index })
+			// --sync prunes the lock before anything is written, so a lock that
+			// cannot be pruned leaves rulepack.json untouched.
+			var syncLock config.Lockfile
+			var syncOut *uninstallSyncOutput
+			if sync {
+				lock, err := config.LoadLockfile(lockFile)
+				if err != nil {
+					return err
+				}
+				syncLock, syncOut = lock, &uninstallSyncOutput{LockFile: lockFile, Pruned: []prunedLockRow{}}
+				if !plan {
+					after := cfg
+					after.Dependencies = kept
+					syncLock, syncOut.Pruned, err = pruneLock(after, lock)
+					if err != nil {
+						return err
+					}
+				}
+			}
 			preview := make([]string, 0, len(removed))
 			for _, row := range removed {
 				preview = append(preview, fmt.Sprintf("#%d %s %s export=%s", row.Index, row.Source, row.Ref, row.Export))
 			}
+			riskMessage := fmt.Sprintf("uninstall would delete %d dependency entries from %s", len(removed), rulesetFile)
+			if plan {
+				actions := make([]planAction, 0, len(removed)+1)
+				for i, row := range removed {
+					actions = append(actions, planAction{Action: "remove", Kind: "dependency", Target: dependencyMatchKey(row.Dependency), Detail: preview[i]})
+				}
+				actions = append(actions, planAction{Action: "update", Kind: "file", Target: rulesetFile})
+				if sync {
+					actions = append(actions, lockPrunePlan(prunedLockRows(syncLock, syncLock.Orphans(kept)))...)
+					actions = append(actions, planAction{Action: "run", Kind: "command", Target: "rulepack build", Detail: "deletes outputs the removed dependencies no longer produce"})
+				}
+				if cleanup {
+					deletable, _, err := render.PreviewManagedCleanup(cfg.Targets)
+					if err != nil {
+						return err
+					}
+					for _, path := range deletable {
+						actions = append(actions, planAction{Action: "delete", Kind: "file", Target: path, Detail: "managed output cleanup"})
+					}
+				}
+				return a.renderPlan(planOutput{Command: "uninstall", Actions: actions, Risks: newPlanRisk(len(removed) > 0, riskMessage, preview)})
+			}
 			if err := confirmRiskAction(
 				cmd,
 				a.jsonMode,
 				yes,
 				len(removed) > 0,
-				fmt.Sprintf("uninstall would delete %d dependency entries from %s", len(removed), config.RulesetFileName),
-				fmt.Sprintf("Uninstall %d dependency entries from %s?", len(removed), config.RulesetFileName),
+				riskMessage,
+				fmt.Sprintf("Uninstall %d dependency entries from %s?", len(removed), rulesetFile),
 				preview,
 				"uninstall",
 			); err != nil {
 				return err
 			}
 
+			if err := a.snapshotProject("deps uninstall"); err != nil {
+				return err
+			}
 			cfg.Dependencies = kept
-			if err := config.SaveRuleset(config.RulesetFileName, cfg); err != nil {
+			if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
 				return err
 			}
+			if sync {
+				if len(syncOut.Pruned) > 0 {
+					if err := config.SaveLockfile(lockFile, syncLock); err != nil {
+						return err
+					}
+				}
+				buildArgs := []string{"--file", rulesetFile, "build"}
+				if yes {
+					buildArgs = append(buildArgs, "--yes")
+				}
+				envelope, err := a.runInProcess(cmd, buildArgs)
+				if err != nil {
+					return fmt.Errorf("dependencies uninstalled and lock pruned, but build failed: %w", err)
+				}
+				var env struct {
+					Result json.RawMessage `json:"result"`
+				}
+				if err := json.Unmarshal(envelope, &env); err != nil {
+					return fmt.Errorf("decode build result: %w", err)
+				}
+				syncOut.Build = env.Result
+			}
 
 			cleanupRequested := cleanup
-			if !cleanupRequested && !a.jsonMode && isInteractiveTerminal() {
+			if !cleanupRequested && !sync && !a.jsonMode && isInteractiveTerminal() {
 				previewDelete, _, err := render.PreviewManagedCleanup(cfg.Targets)
 				if err != nil {
 					return err
@@ -99,13 +172,14 @@ func (a *app) newDepsUninstallCmd() *cobra.Command {
 			}
 
 			out := uninstallOutput{
-				RulesetFile:      config.RulesetFileName,
+				RulesetFile:      rulesetFile,
 				Removed:          removed,
 				Remaining:        len(cfg.Dependencies),
 				CleanupRequested: cleanupRequested,
 				CleanupPerformed: cleanupPerformed,
 				CleanupDeleted:   cleanupDeleted,
 				CleanupSkipped:   cleanupSkipped,
+				Sync:             syncOut,
 			}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("uninstall", out)
@@ -124,18 +198,32 @@ func (a *app) newDepsUninstallCmd() *cobra.Command {
 					events = append(events, cliout.Event{Level: "warn", Message: "Cleanup skipped " + strconv.Itoa(len(cleanupSkipped)) + " unmanaged file(s)"})
 				}
 			}
+			if syncOut != nil {
+				for _, row := range syncOut.Pruned {
+					events = append(events, cliout.Event{Level: "info", Message: fmt.Sprintf("Dropped lock entry %s %s", row.Source, row.Ref)})
+				}
+				var built buildOutput
+				if err := json.Unmarshal(syncOut.Build, &built); err == nil {
+					events = append(events, cliout.Event{Level: "info", Message: "Rebuilt " + strconv.Itoa(len(built.Targets)) + " target(s)"})
+					for _, warning := range built.Warnings {
+						events = append(events, cliout.Event{Level: "warn", Message: warning})
+					}
+				}
+			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "uninstall",
 				Title:   "Dependencies Uninstalled",
 				Events:  events,
 				Tables:  []cliout.Table{{Title: "Uninstalled Dependencies", Columns: []string{"#", "Source", "Ref/Path/Profile", "Export"}, Rows: rows}},
 				Summary: map[string]string{"remaining": strconv.Itoa(len(cfg.Dependencies)), "cleanupDeleted": strconv.Itoa(len(cleanupDeleted)), "cleanupSkipped": strconv.Itoa(len(cleanupSkipped))},
-				Done:    "Updated " + config.RulesetFileName,
+				Done:    "Updated " + rulesetFile,
 			})
 			return nil
 		},
 	}
 	cmd.Flags().BoolVar(&yes, "yes", false, "confirm dependency uninstall without prompting")
 	cmd.Flags().BoolVar(&cleanup, "cleanup", false, "cleanup managed generated outputs after uninstall")
+	cmd.Flags().BoolVar(&plan, "plan", false, "report the changes uninstall would make without applying them")
+	cmd.Flags().BoolVar(&sync, "sync", false, "also prune the lockfile and run build to delete outputs the removed dependencies produced")
 	return cmd
 }
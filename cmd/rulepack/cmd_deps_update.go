@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+func (a *app) newDepsUpdateCmd() *cobra.Command {
+	var noNotify bool
+	var carry bool
+	cmd := &cobra.Command{
+		Use:   "update [dep-selector...]",
+		Short: "Resolve dependencies and accept new content for their pinned modules",
+		Long:  "Resolve dependencies like deps install, but record the new digests of pinned modules that changed instead of failing. Without selectors every dependency's pins are bumped. Modules that reappear under a new ID with the same content are reported as renames; with --carry-overrides, overrides in rulepack.json follow them to the new ID.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			cfgPath, err := filepath.Abs(rulesetFile)
+			if err != nil {
+				return err
+			}
+			cfgDir := filepath.Dir(cfgPath)
+			bump := map[int]bool{}
+			for _, selector := range args {
+				idx, err := findDependencyIndex(cfg, selector)
+				if err != nil {
+					return err
+				}
+				bump[idx] = true
+			}
+			if len(args) == 0 {
+				for i := range cfg.Dependencies {
+					bump[i] = true
+				}
+			}
+			gc, err := newProjectGitClient(cfg)
+			if err != nil {
+				return err
+			}
+			lock, _, _, _, _, err := buildLock(cfg, cfgDir, gc, bump, nil, nil)
+			if err != nil {
+				return err
+			}
+			// A missing or unreadable previous lock has no pins to bump.
+			previous, _ := config.LoadLockfile(lockFile)
+			if err := a.snapshotProject("deps update"); err != nil {
+				return err
+			}
+			if err := config.SaveLockfile(lockFile, lock); err != nil {
+				return err
+			}
+			out := depsUpdateOutput{LockFile: lockFile, Updated: []int{}, BumpedPins: modulePinChanges(lock.Resolved, previous.Resolved)}
+			changes := dependencyChanges(gc, expandOptions(cfg), cfg.Dependencies, previous, lock)
+			carriedAny := false
+			for _, c := range changes {
+				carried := make([]bool, len(c.RenamedModules))
+				if carry {
+					carried = carryOverrides(cfg.Overrides, c.RenamedModules)
+				}
+				for i, r := range c.RenamedModules {
+					out.RenamedModules = append(out.RenamedModules, renameRow{Dependency: c.Name, From: r.From, To: r.To, CarriedOverride: carried[i]})
+					carriedAny = carriedAny || carried[i]
+					if !carried[i] && slices.ContainsFunc(cfg.Overrides, func(ov config.Override) bool { return ov.ID == r.From }) {
+						out.Warnings = append(out.Warnings, fmt.Sprintf("override for %s no longer matches a module; it was renamed to %s, so update the override's id", r.From, r.To))
+					}
+				}
+			}
+			if carriedAny {
+				if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
+					return err
+				}
+			}
+			if !noNotify {
+				out.Warnings = append(out.Warnings, notifyDependencyChanges(cfg, "deps.update", changes)...)
+			}
+			for i := range cfg.Dependencies {
+				if bump[i] {
+					out.Updated = append(out.Updated, i+1)
+				}
+			}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("deps.update", out)
+			}
+			rows := make([][]string, 0, len(out.BumpedPins))
+			for _, c := range out.BumpedPins {
+				rows = append(rows, []string{strconv.Itoa(c.Index), c.Ref, c.Module, shortSHA(c.From), shortSHA(c.To)})
+			}
+			events := []cliout.Event{}
+			if len(rows) == 0 {
+				events = append(events, cliout.Event{Level: "info", Message: "No pinned modules changed"})
+			}
+			for _, r := range out.RenamedModules {
+				message := fmt.Sprintf("%s: module %s renamed to %s", r.Dependency, r.From, r.To)
+				if r.CarriedOverride {
+					message += "; override carried"
+				}
+				events = append(events, cliout.Event{Level: "info", Message: message})
+			}
+			for _, w := range out.Warnings {
+				events = append(events, cliout.Event{Level: "warn", Message: w})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "deps.update",
+				Title:   "Update Dependencies",
+				Events:  events,
+				Tables: []cliout.Table{{
+					Title:   "Bumped Pins",
+					Columns: []string{"#", "Dependency", "Module", "From", "To"},
+					Rows:    rows,
+				}},
+				Summary: map[string]string{
+					"bumped":    strconv.Itoa(len(rows)),
+					"lock file": lockFile,
+				},
+				Done: "Update complete",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&noNotify, "no-notify", false, "do not send the notify payload for this run")
+	cmd.Flags().BoolVar(&carry, "carry-overrides", false, "move overrides of renamed modules in rulepack.json to the new module ID")
+	return cmd
+}
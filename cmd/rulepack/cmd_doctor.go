@@ -1,9 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
+	"rulepack/internal/auth"
 	"rulepack/internal/cliout"
 	"rulepack/internal/config"
 	"rulepack/internal/git"
@@ -11,31 +22,76 @@ import (
 )
 
 func (a *app) newDoctorCmd() *cobra.Command {
+	var fix, network, offline, tools bool
+	var timeout time.Duration
 	cmd := &cobra.Command{
 		Use:   "doctor",
 		Short: "Validate environment, config, lockfile, and profile store",
+		Long: "Run each check and report it as ok, warn, or fail. " +
+			"With --fix, lockfile paths written with Windows separators are rewritten with forward slashes first. " +
+			"Unless --offline, each host the dependencies and profile registry are fetched from is probed with git ls-remote, so unreachable hosts and rejected credentials show up before an install. " +
+			"With --tools, each target type is also checked against the files its tool keeps in the repository, warning about targets whose tool seems unused and tools without a target.",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if network && offline {
+				return errors.New("use only one of --network or --offline")
+			}
 			checks := []doctorCheck{}
-			if _, err := os.Stat(config.RulesetFileName); err != nil {
+			if _, err := os.Stat(rulesetFile); err != nil {
 				checks = append(checks, doctorCheck{Name: "ruleset file", Status: "fail", Details: err.Error()})
 			} else {
 				checks = append(checks, doctorCheck{Name: "ruleset file", Status: "ok"})
 			}
-			cfg, cfgErr := config.LoadRuleset(config.RulesetFileName)
+			cfg, cfgErr := config.LoadEffectiveRuleset(rulesetFile)
 			if cfgErr != nil {
 				checks = append(checks, doctorCheck{Name: "ruleset parse", Status: "fail", Details: cfgErr.Error()})
 			} else {
 				checks = append(checks, doctorCheck{Name: "ruleset parse", Status: "ok"})
 			}
-			lock, lockErr := config.LoadLockfile(config.LockFileName)
+			if cfgErr == nil && tools {
+				toolChecks, err := targetToolChecks(cfg)
+				if err != nil {
+					checks = append(checks, doctorCheck{Name: "target tools", Status: "fail", Details: err.Error()})
+				}
+				checks = append(checks, toolChecks...)
+			}
+			if cfgErr == nil && cfg.Protect != nil {
+				targetNames := make([]string, 0, len(cfg.Targets))
+				for name := range cfg.Targets {
+					targetNames = append(targetNames, name)
+				}
+				sort.Strings(targetNames)
+				violations, err := protectedOutputs(cfg, targetNames, nil)
+				switch {
+				case err != nil:
+					checks = append(checks, doctorCheck{Name: "protected outputs", Status: "fail", Details: err.Error()})
+				case len(violations) > 0:
+					checks = append(checks, doctorCheck{Name: "protected outputs", Status: "fail", Details: strings.Join(violations, ", ")})
+				default:
+					checks = append(checks, doctorCheck{Name: "protected outputs", Status: "ok"})
+				}
+			}
+			lock, lockErr := config.LoadLockfile(lockFile)
 			if lockErr != nil {
 				checks = append(checks, doctorCheck{Name: "lockfile", Status: "warn", Details: lockErr.Error()})
 			} else {
 				checks = append(checks, doctorCheck{Name: "lockfile", Status: "ok"})
-				if cfgErr == nil && len(cfg.Dependencies) != len(lock.Resolved) {
-					checks = append(checks, doctorCheck{Name: "lock alignment", Status: "fail", Details: "dependency count differs from lockfile"})
-				} else if cfgErr == nil {
-					checks = append(checks, doctorCheck{Name: "lock alignment", Status: "ok"})
+				check, err := a.lockPathsCheck(&lock, fix)
+				if err != nil {
+					return err
+				}
+				checks = append(checks, check)
+				if cfgErr == nil {
+					if aligned, err := lock.Align(cfg.Dependencies); err != nil {
+						checks = append(checks, doctorCheck{Name: "lock alignment", Status: "fail", Details: err.Error()})
+					} else {
+						checks = append(checks, doctorCheck{Name: "lock alignment", Status: "ok"})
+						if check, ok := freshnessCheck(cfg, aligned, time.Now()); ok {
+							checks = append(checks, check)
+						}
+					}
+				}
+				if check, ok := lockedProfilesCheck(lock); ok {
+					checks = append(checks, check)
 				}
 			}
 			profileRoot, pErr := profilesvc.GlobalRoot()
@@ -48,12 +104,34 @@ func (a *app) newDoctorCmd() *cobra.Command {
 					checks = append(checks, doctorCheck{Name: "profile store", Status: "warn", Details: profileRoot + " (not created yet)"})
 				}
 			}
-			_, gErr := git.NewClient()
+			if info, err := os.Stat(filepath.FromSlash(profilesvc.ProjectDir)); err == nil && info.IsDir() {
+				checks = append(checks, doctorCheck{Name: "project profile store", Status: "ok", Details: profilesvc.ProjectDir})
+			}
+			if profiles, err := profilesvc.List(); err == nil {
+				if check, ok := profileFreshnessCheck(profiles, time.Now()); ok {
+					checks = append(checks, check)
+				}
+			}
+			if unreadable, err := profilesvc.ListUnreadable(); err == nil && len(unreadable) > 0 {
+				names := make([]string, 0, len(unreadable))
+				for _, u := range unreadable {
+					names = append(names, fmt.Sprintf("%s (%s)", u.ID, u.Reason))
+				}
+				checks = append(checks, doctorCheck{Name: "unreadable profiles", Status: "warn", Details: strings.Join(names, ", ") + "; see rulepack profile doctor"})
+			}
+			_, gErr := newGitClient()
 			if gErr != nil {
 				checks = append(checks, doctorCheck{Name: "git client", Status: "fail", Details: gErr.Error()})
 			} else {
 				checks = append(checks, doctorCheck{Name: "git client", Status: "ok"})
 			}
+			if gErr == nil && cfgErr == nil && !offline {
+				gc, err := newProjectGitClient(cfg)
+				if err != nil {
+					return err
+				}
+				checks = append(checks, hostChecks(cmd.Context(), gc, cfg, timeout)...)
+			}
 
 			out := doctorOutput{Checks: checks}
 			if a.jsonMode {
@@ -72,5 +150,325 @@ func (a *app) newDoctorCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().BoolVar(&fix, "fix", false, "rewrite lockfile paths that use Windows separators")
+	cmd.Flags().BoolVar(&network, "network", false, "probe every dependency host (the default)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "skip the dependency host probes")
+	cmd.Flags().DurationVar(&timeout, "timeout", 15*time.Second, "give up on a host whose probe takes longer than this")
+	cmd.Flags().BoolVar(&tools, "tools", false, "check configured targets against the tools the repository uses")
 	return cmd
 }
+
+// hostProbe is one host the ruleset fetches from, the URI probed for it,
+// and the dependencies that would fail without it.
+type hostProbe struct {
+	host  string
+	uri   string
+	users []string
+}
+
+// hostChecks probes each host that git dependencies and, when a dependency
+// uses a registry profile, the profile registry are fetched from, in
+// dependency order. Mirrors apply, so a mirrored dependency is reported
+// under the mirror's host.
+func hostChecks(ctx context.Context, gc *git.Client, cfg config.Ruleset, timeout time.Duration) []doctorCheck {
+	var probes []*hostProbe
+	byHost := map[string]*hostProbe{}
+	add := func(uri, user string) {
+		host := dependencyHost(gc.FetchURI(uri))
+		p, ok := byHost[host]
+		if !ok {
+			p = &hostProbe{host: host, uri: uri}
+			byHost[host] = p
+			probes = append(probes, p)
+		}
+		p.users = append(p.users, user)
+	}
+	for i, dep := range cfg.Dependencies {
+		switch dependencySource(dep) {
+		case "git":
+			add(dep.URI, dependencyLabel(i, dep))
+		case profilesvc.ProfileSource:
+			if _, remote := config.ParseRemoteProfile(dep.Profile); remote && cfg.ProfileRegistry != "" {
+				add(cfg.ProfileRegistry, dependencyLabel(i, dep))
+			}
+		}
+	}
+	checks := make([]doctorCheck, 0, len(probes))
+	for _, p := range probes {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := gc.LsRemoteContext(probeCtx, p.uri)
+		cancel()
+		check := doctorCheck{Name: "host " + p.host, Status: "ok", Details: "git ls-remote " + p.uri}
+		if err != nil {
+			reason := strings.Join(strings.Fields(err.Error()), " ")
+			if errors.Is(probeCtx.Err(), context.DeadlineExceeded) {
+				reason = "no answer after " + timeout.String()
+			}
+			check.Status = "fail"
+			check.Details = fmt.Sprintf("%s: %s; would fail %s", check.Details, reason, strings.Join(p.users, ", "))
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// dependencyHost names the host a fetch URI connects to. Local paths and
+// file URLs are their own host.
+func dependencyHost(uri string) string {
+	if strings.HasPrefix(uri, "file://") || (!strings.Contains(uri, "://") && !strings.Contains(uri, "@")) {
+		return uri
+	}
+	return auth.HostFromURI(uri)
+}
+
+// lockPathsCheck warns about local lock entries whose path or key uses
+// backslashes, which only Windows reads. With fix it rewrites them in lock
+// and saves the lockfile.
+func (a *app) lockPathsCheck(lock *config.Lockfile, fix bool) (doctorCheck, error) {
+	normalized := *lock
+	normalized.Resolved = slices.Clone(lock.Resolved)
+	changed := normalized.NormalizePaths()
+	if len(changed) == 0 {
+		return doctorCheck{Name: "lockfile paths", Status: "ok"}, nil
+	}
+	entries := make([]string, 0, len(changed))
+	for _, i := range changed {
+		entries = append(entries, fmt.Sprintf("%d (%s)", i+1, lock.Resolved[i].Path))
+	}
+	if !fix {
+		return doctorCheck{Name: "lockfile paths", Status: "warn", Details: "entries " + strings.Join(entries, ", ") + " use Windows path separators; run rulepack doctor --fix"}, nil
+	}
+	if err := a.snapshotProject("doctor --fix"); err != nil {
+		return doctorCheck{}, err
+	}
+	if err := config.SaveLockfile(lockFile, normalized); err != nil {
+		return doctorCheck{}, err
+	}
+	*lock = normalized
+	return doctorCheck{Name: "lockfile paths", Status: "ok", Details: "normalized entries " + strings.Join(entries, ", ")}, nil
+}
+
+// toolMarkers lists, per target type, repository paths showing its tool is
+// in use. .vscode/settings.json only counts when it configures Copilot.
+var toolMarkers = map[string][]string{
+	"cursor":  {".cursor", ".cursorrules", ".cursorignore"},
+	"copilot": {".github/copilot-instructions.md", ".github/instructions", ".github/prompts", ".vscode/settings.json"},
+	"codex":   {"AGENTS.md", ".codex"},
+	"claude":  {"CLAUDE.md", ".claude", ".mcp.json"},
+	"amazonq": {".amazonq"},
+	"cline":   {".clinerules", ".roo", ".roorules"},
+	"zed":     {".zed", ".rules"},
+	"junie":   {".junie"},
+}
+
+// targetToolChecks reports, for each target type that is configured or
+// whose tool leaves files in the repository, whether both hold. Target
+// outputs and files recorded in the build manifest are rulepack's own and
+// never count as use.
+func targetToolChecks(cfg config.Ruleset) ([]doctorCheck, error) {
+	manifest, err := config.LoadOutputs(outputsFile)
+	if err != nil {
+		return nil, err
+	}
+	var generated []string
+	configured := map[string][]string{}
+	for name, entry := range cfg.Targets {
+		kind := entry.Kind(name)
+		configured[kind] = append(configured[kind], name)
+		if out := targetOutput(kind, entry); out != "" {
+			generated = append(generated, path.Clean(filepath.ToSlash(out)))
+		}
+	}
+	for _, rec := range manifest.Targets {
+		for _, f := range rec.Files {
+			generated = append(generated, path.Clean(filepath.ToSlash(f.Path)))
+		}
+	}
+	isGenerated := func(p string) bool {
+		for _, g := range generated {
+			if p == g || strings.HasPrefix(p, g+"/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	var checks []doctorCheck
+	for _, kind := range config.TargetKinds {
+		// Custom targets write for whatever tool their template targets.
+		if _, ok := toolMarkers[kind]; !ok {
+			continue
+		}
+		found, err := toolEvidence(kind, isGenerated)
+		if err != nil {
+			return checks, err
+		}
+		names := configured[kind]
+		sort.Strings(names)
+		check := doctorCheck{Name: "tool " + kind}
+		switch {
+		case len(names) == 0 && len(found) == 0:
+			continue
+		case len(found) == 0:
+			check.Status = "warn"
+			check.Details = fmt.Sprintf("target %s configured but no %s files found besides rulepack outputs; remove the target if the tool is unused", strings.Join(names, ", "), kind)
+		case len(names) == 0:
+			check.Status = "warn"
+			check.Details = fmt.Sprintf("%s found but no target renders for %s", strings.Join(found, ", "), kind)
+		default:
+			check.Status = "ok"
+			check.Details = strings.Join(found, ", ")
+		}
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+// toolEvidence returns the markers of kind's tool that are in use.
+func toolEvidence(kind string, isGenerated func(string) bool) ([]string, error) {
+	var found []string
+	for _, marker := range toolMarkers[kind] {
+		used, err := markerInUse(marker, isGenerated)
+		if err != nil {
+			return nil, err
+		}
+		if used {
+			found = append(found, marker)
+		}
+	}
+	return found, nil
+}
+
+// markerInUse reports whether marker exists with anything rulepack did not
+// generate: the file itself, or any file under the directory.
+func markerInUse(marker string, isGenerated func(string) bool) (bool, error) {
+	info, err := os.Stat(filepath.FromSlash(marker))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.IsDir() {
+		if isGenerated(marker) {
+			return false, nil
+		}
+		if marker == ".vscode/settings.json" {
+			data, err := os.ReadFile(filepath.FromSlash(marker))
+			if err != nil {
+				return false, err
+			}
+			return strings.Contains(string(data), "github.copilot"), nil
+		}
+		return true, nil
+	}
+	used := false
+	err = filepath.WalkDir(filepath.FromSlash(marker), func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := filepath.ToSlash(p)
+		if d.IsDir() {
+			if isGenerated(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isGenerated(rel) {
+			used = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return used, err
+}
+
+// profileFreshnessCheck warns about saved profiles past their refreshEvery
+// interval. It returns false when no profile sets an interval.
+func profileFreshnessCheck(profiles []profilesvc.Metadata, now time.Time) (doctorCheck, bool) {
+	scheduled := false
+	due := []string{}
+	for _, p := range profiles {
+		if p.RefreshEvery == "" {
+			continue
+		}
+		scheduled = true
+		if !p.RefreshDue(now) {
+			continue
+		}
+		name := p.ID
+		if p.Alias != "" {
+			name = p.Alias
+		}
+		if last, ok := p.LastRefreshed(); ok {
+			due = append(due, fmt.Sprintf("%s refreshed %dd ago (every %s)", name, int(now.Sub(last).Hours()/24), p.RefreshEvery))
+		} else {
+			due = append(due, fmt.Sprintf("%s never refreshed (every %s)", name, p.RefreshEvery))
+		}
+	}
+	switch {
+	case !scheduled:
+		return doctorCheck{}, false
+	case len(due) > 0:
+		return doctorCheck{Name: "profile freshness", Status: "warn", Details: strings.Join(due, ", ") + "; run rulepack profile refresh --due"}, true
+	default:
+		return doctorCheck{Name: "profile freshness", Status: "ok"}, true
+	}
+}
+
+// lockedProfilesCheck fails when the lockfile references saved profiles
+// missing from the profile stores. It returns false when no dependency is a
+// saved profile.
+func lockedProfilesCheck(lock config.Lockfile) (doctorCheck, bool) {
+	saved := false
+	for _, locked := range lock.Resolved {
+		if lockSource(locked) == profilesvc.ProfileSource && locked.URI == "" {
+			saved = true
+		}
+	}
+	if !saved {
+		return doctorCheck{}, false
+	}
+	missing, err := missingLockedProfiles(lock)
+	if err != nil {
+		return doctorCheck{Name: "locked profiles", Status: "fail", Details: err.Error()}, true
+	}
+	if len(missing) == 0 {
+		return doctorCheck{Name: "locked profiles", Status: "ok"}, true
+	}
+	names := make([]string, 0, len(missing))
+	for _, i := range missing {
+		names = append(names, newMissingProfileError(i, lock.Resolved[i]).subject())
+	}
+	return doctorCheck{Name: "locked profiles", Status: "fail", Details: strings.Join(names, ", ") + " not saved locally; run rulepack build --recover"}, true
+}
+
+// freshnessCheck reports dependencies locked longer than their maxAgeDays. It
+// returns false when no dependency sets a limit.
+func freshnessCheck(cfg config.Ruleset, aligned []config.LockedSource, now time.Time) (doctorCheck, bool) {
+	limited := false
+	stale := []string{}
+	unknown := []string{}
+	for i, dep := range cfg.Dependencies {
+		freshness, age := lockFreshness(dep, aligned[i], now)
+		switch freshness {
+		case "":
+			continue
+		case "stale":
+			stale = append(stale, fmt.Sprintf("%s locked %dd ago (max %dd)", dependencyReference(dep), *age, dep.MaxAgeDays))
+		case "unknown":
+			unknown = append(unknown, dependencyReference(dep))
+		}
+		limited = true
+	}
+	switch {
+	case !limited:
+		return doctorCheck{}, false
+	case len(stale) > 0:
+		return doctorCheck{Name: "dependency freshness", Status: "fail", Details: strings.Join(stale, ", ")}, true
+	case len(unknown) > 0:
+		return doctorCheck{Name: "dependency freshness", Status: "warn", Details: "no lock time for " + strings.Join(unknown, ", ") + "; run rulepack deps install"}, true
+	default:
+		return doctorCheck{Name: "dependency freshness", Status: "ok"}, true
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/render"
+)
+
+func (a *app) newEffectiveCmd() *cobra.Command {
+	var target string
+	var filePath string
+	cmd := &cobra.Command{
+		Use:   "effective",
+		Short: "Show which modules a target applies, optionally for one file path",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if target == "" {
+				return fmt.Errorf("--target is required")
+			}
+			cfg, err := config.LoadEffectiveRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			target = strings.ToLower(target)
+			entry, ok := cfg.Targets[target]
+			if !ok {
+				return fmt.Errorf("target %q not configured", target)
+			}
+			modules, err := composeModules(cfg, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+			effective, err := render.Effective(entry.Kind(target), entry, targetModules(entry, modules), filePath)
+			if err != nil {
+				return err
+			}
+
+			out := effectiveOutput{Target: target, Path: filePath, Modules: effective}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("effective", out)
+			}
+			rows := make([][]string, 0, len(effective))
+			counts := map[string]int{}
+			for _, m := range effective {
+				counts[m.Status]++
+				rows = append(rows, []string{m.ID, strconv.Itoa(m.Priority), m.Mode, m.Status, m.Reason})
+			}
+			summary := map[string]string{
+				"target":      target,
+				"applies":     strconv.Itoa(counts["applies"]),
+				"conditional": strconv.Itoa(counts["conditional"]),
+				"excluded":    strconv.Itoa(counts["excluded"]),
+			}
+			if filePath != "" {
+				summary["path"] = filePath
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "effective",
+				Title:   "Effective Rules",
+				Tables:  []cliout.Table{{Title: "Modules", Columns: []string{"Module", "Priority", "Mode", "Status", "Reason"}, Rows: rows}},
+				Summary: summary,
+				Done:    "Effective rules resolved",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&target, "target", "", "configured target to inspect")
+	cmd.Flags().StringVar(&filePath, "path", "", "project-relative file path to evaluate glob rules against")
+	return cmd
+}
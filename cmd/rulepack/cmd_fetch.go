@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/git"
+	"rulepack/internal/pack"
+	profilesvc "rulepack/internal/profile"
+)
+
+func (a *app) newFetchCmd() *cobra.Command {
+	var lockPath string
+	var outDir string
+	cmd := &cobra.Command{
+		Use:   "fetch",
+		Short: "Materialize every locked dependency into a directory",
+		Long: "Copy each dependency of a lockfile into <out>/<NN>-<name>, NN being its 1-based position in the lock, as the pack's rulepack.json and module files. " +
+			"Only the lock is read: git dependencies are read at the locked commit, reusing the cached mirror when it has it, and local and profile dependencies must still match their locked content hash. " +
+			"The output directory must not exist or be empty, and is written whole or not at all.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if outDir == "" {
+				return errors.New("--out is required")
+			}
+			if !cmd.Flags().Changed("lockfile") {
+				lockPath = lockFile
+			}
+			lock, err := config.LoadLockfile(lockPath)
+			if err != nil {
+				return err
+			}
+			if entries, err := os.ReadDir(outDir); err == nil && len(entries) > 0 {
+				return fmt.Errorf("output directory %s is not empty", outDir)
+			} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			lockDir, err := filepath.Abs(filepath.Dir(lockPath))
+			if err != nil {
+				return err
+			}
+			gc, err := newGitClient()
+			if err != nil {
+				return err
+			}
+
+			if err := os.MkdirAll(filepath.Dir(filepath.Clean(outDir)), 0o755); err != nil {
+				return err
+			}
+			staging, err := os.MkdirTemp(filepath.Dir(filepath.Clean(outDir)), ".rulepack-fetch-*")
+			if err != nil {
+				return err
+			}
+			defer os.RemoveAll(staging)
+			rows := make([]fetchedDependency, 0, len(lock.Resolved))
+			for i, locked := range lock.Resolved {
+				reader, err := lockedReader(gc, lockDir, locked)
+				if err != nil {
+					return fmt.Errorf("dependency %d (%s): %w", i+1, lockSourceReference(locked), err)
+				}
+				dir := fetchDirName(i, locked)
+				files, err := pack.Materialize(reader, filepath.Join(staging, dir))
+				if err != nil {
+					return fmt.Errorf("dependency %d (%s): %w", i+1, lockSourceReference(locked), err)
+				}
+				rows = append(rows, fetchedDependency{
+					Index:     i + 1,
+					Source:    lockSource(locked),
+					Reference: lockSourceReference(locked),
+					Resolved:  lockReference(locked),
+					Dir:       dir,
+					Files:     files,
+				})
+			}
+			if err := os.Remove(outDir); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			if err := os.Rename(staging, outDir); err != nil {
+				return err
+			}
+
+			out := fetchOutput{Lockfile: lockPath, Out: outDir, Dependencies: rows}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("fetch", out)
+			}
+			tableRows := make([][]string, 0, len(rows))
+			files := 0
+			for _, r := range rows {
+				tableRows = append(tableRows, []string{strconv.Itoa(r.Index), r.Source, r.Reference, r.Resolved, r.Dir})
+				files += len(r.Files)
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "fetch",
+				Title:   "Fetch",
+				Tables:  []cliout.Table{{Title: "Dependencies", Columns: []string{"#", "Source", "Ref/Path/Profile", "Resolved", "Dir"}, Rows: tableRows}},
+				Summary: map[string]string{
+					"dependencies": strconv.Itoa(len(rows)),
+					"files":        strconv.Itoa(files),
+					"out":          outDir,
+				},
+				Done: "Fetch complete",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&lockPath, "lockfile", config.LockFileName, "lockfile to materialize (default: the -f ruleset's)")
+	cmd.Flags().StringVar(&outDir, "out", "", "directory to write the dependencies to")
+	return cmd
+}
+
+// lockedReader reads the pack locked dependency resolved to. Git entries
+// only fetch when the cached mirror lacks the locked commit.
+func lockedReader(gc *git.Client, lockDir string, locked config.LockedSource) (pack.FileReader, error) {
+	switch lockSource(locked) {
+	case "git":
+		if locked.Commit == "" {
+			return nil, errors.New("lock entry has no commit")
+		}
+		repoDir, ok := gc.CachedRepo(locked.URI)
+		if ok {
+			if _, err := gc.CommitTime(repoDir, locked.Commit); err != nil {
+				ok = false
+			}
+		}
+		if !ok {
+			var err error
+			if repoDir, err = gc.EnsureRepo(locked.URI); err != nil {
+				return nil, fmt.Errorf("prepare %s: %w", locked.URI, err)
+			}
+		}
+		return pack.GitReader(gc, repoDir, locked.Commit), nil
+	case "local":
+		root, _, err := resolveLocalPath(lockDir, locked.Path)
+		if err != nil {
+			return nil, err
+		}
+		reader := pack.LocalReader(root)
+		return reader, checkLockedHash(reader, locked)
+	case profilesvc.ProfileSource:
+		loc, err := resolveProfileDependency(gc, locked.URI, locked.Profile, locked.Commit)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := profilesvc.Reader(loc.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return reader, checkLockedHash(reader, locked)
+	default:
+		return nil, fmt.Errorf("unsupported source %q", locked.Source)
+	}
+}
+
+// checkLockedHash fails when the pack no longer hashes to the lock entry.
+// Without rulepack.json the normalize settings are unknown, so either
+// Unicode form of the hash is accepted.
+func checkLockedHash(reader pack.FileReader, locked config.LockedSource) error {
+	if locked.ContentHash == "" {
+		return nil
+	}
+	dep := config.Dependency{Export: locked.Export}
+	for _, nfc := range []bool{false, true} {
+		_, hash, err := pack.ExpandReader(reader, dep, locked.Commit, pack.Options{NFC: nfc})
+		if err != nil {
+			return err
+		}
+		if hash == locked.ContentHash {
+			return nil
+		}
+	}
+	return fmt.Errorf("content no longer matches locked hash %s; run rulepack deps install", shortSHA(locked.ContentHash))
+}
+
+// fetchDirName names a dependency's directory from its lock position and
+// reference, so the layout depends on nothing but the lock.
+func fetchDirName(i int, locked config.LockedSource) string {
+	ref := lockSourceReference(locked)
+	if lockSource(locked) != profilesvc.ProfileSource {
+		ref = strings.TrimSuffix(path.Base(strings.TrimRight(filepath.ToSlash(ref), "/")), ".git")
+	}
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, ref)
+	name = strings.Trim(name, ".-")
+	if name == "" {
+		name = lockSource(locked)
+	}
+	return fmt.Sprintf("%02d-%s", i+1, name)
+}
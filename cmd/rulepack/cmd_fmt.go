@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/pack"
+)
+
+func (a *app) newFmtCmd() *cobra.Command {
+	var check bool
+	cmd := &cobra.Command{
+		Use:   "fmt",
+		Short: "Canonicalize rulepack.json and pack module files",
+		Long:  "Rewrite rulepack.json with canonical field order and indentation. In a rule pack, modules are also sorted by priority and module markdown loses trailing whitespace and extra final newlines.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			files, err := formatProjectFiles()
+			if err != nil {
+				return err
+			}
+			out := fmtOutput{Files: make([]fmtFileRow, 0, len(files))}
+			for _, f := range files {
+				status := "unchanged"
+				if f.changed() {
+					out.Changed++
+					status = "formatted"
+					if check {
+						status = "needs-format"
+					}
+				}
+				out.Files = append(out.Files, fmtFileRow{Path: f.path, Status: status})
+			}
+			if out.Changed > 0 && !check {
+				if err := a.snapshotProject("fmt"); err != nil {
+					return err
+				}
+				for _, f := range files {
+					if !f.changed() {
+						continue
+					}
+					if err := os.WriteFile(f.path, f.formatted, 0o644); err != nil {
+						return err
+					}
+				}
+			}
+
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("fmt", out); err != nil {
+					return err
+				}
+			} else {
+				rows := make([][]string, 0, len(out.Files))
+				for _, f := range out.Files {
+					rows = append(rows, []string{f.Path, f.Status})
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command: "fmt",
+					Title:   "Format",
+					Tables:  []cliout.Table{{Title: "Files", Columns: []string{"Path", "Status"}, Rows: rows}},
+					Summary: map[string]string{"files": strconv.Itoa(len(out.Files)), "changed": strconv.Itoa(out.Changed)},
+					Done:    "Format complete",
+				})
+			}
+			if check && out.Changed > 0 {
+				return fmt.Errorf("%d file(s) need formatting; run rulepack fmt", out.Changed)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&check, "check", false, "report files that are not formatted without writing anything")
+	return cmd
+}
+
+type formattedFile struct {
+	path      string
+	original  []byte
+	formatted []byte
+}
+
+func (f formattedFile) changed() bool {
+	return string(f.original) != string(f.formatted)
+}
+
+// formatProjectFiles formats rulepack.json in the current directory and, when
+// it describes a rule pack rather than a project, every module file it lists.
+func formatProjectFiles() ([]formattedFile, error) {
+	data, err := os.ReadFile(rulesetFile)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", rulesetFile, err)
+	}
+	if _, isPack := fields["modules"]; !isPack {
+		formatted, err := config.FormatRuleset(data)
+		if err != nil {
+			return nil, err
+		}
+		return []formattedFile{{path: rulesetFile, original: data, formatted: formatted}}, nil
+	}
+
+	formatted, rp, err := pack.FormatManifest(data)
+	if err != nil {
+		return nil, err
+	}
+	files := []formattedFile{{path: rulesetFile, original: data, formatted: formatted}}
+	seen := map[string]bool{}
+	for _, m := range rp.Modules {
+		modulePath, err := pack.ModuleFile(".", m.Path)
+		if err != nil {
+			return nil, fmt.Errorf("module %s: %w", m.ID, err)
+		}
+		if seen[modulePath] {
+			continue
+		}
+		seen[modulePath] = true
+		content, err := os.ReadFile(modulePath)
+		if err != nil {
+			return nil, fmt.Errorf("read module %s (%s): %w", m.ID, m.Path, err)
+		}
+		files = append(files, formattedFile{
+			path:      filepath.ToSlash(modulePath),
+			original:  content,
+			formatted: []byte(pack.FormatMarkdown(string(content))),
+		})
+	}
+	return files, nil
+}
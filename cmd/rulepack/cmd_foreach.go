@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+func (a *app) newForEachCmd() *cobra.Command {
+	var root string
+	cmd := &cobra.Command{
+		Use:   "for-each --root <dir> -- <command> [args...]",
+		Short: "Run a rulepack command in every project under a directory",
+		Long:  "Discover every rulepack.json that declares dependencies or targets under --root, run the given rulepack subcommand in each project directory, and aggregate the results into one report. Hidden directories, node_modules, and vendor are skipped.",
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 0 {
+				return errors.New("missing command: rulepack for-each --root <dir> -- <command> [args...]")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if args[0] == "rulepack" {
+				args = args[1:]
+			}
+			if len(args) == 0 {
+				return errors.New("missing command after rulepack")
+			}
+			if args[0] == "for-each" {
+				return errors.New("for-each cannot run itself")
+			}
+			projects, err := discoverProjects(root)
+			if err != nil {
+				return err
+			}
+			exe, err := os.Executable()
+			if err != nil {
+				return err
+			}
+			childArgs := append([]string{"--json", "--schema-version", strconv.Itoa(a.schemaVersion)}, args...)
+
+			out := forEachOutput{Root: root, Command: args, Projects: make([]forEachProjectRow, 0, len(projects))}
+			for _, project := range projects {
+				row := runInProject(exe, filepath.Join(root, filepath.FromSlash(project)), childArgs)
+				row.Project = project
+				if row.Status != "ok" {
+					out.Failed++
+				}
+				out.Projects = append(out.Projects, row)
+			}
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("for-each", out); err != nil {
+					return err
+				}
+			} else {
+				rows := make([][]string, 0, len(out.Projects))
+				for _, p := range out.Projects {
+					rows = append(rows, []string{p.Project, p.Status, orDash(p.Error)})
+				}
+				events := []cliout.Event{}
+				if len(projects) == 0 {
+					events = append(events, cliout.Event{Level: "info", Message: "No rulepack projects found under " + root})
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command: "for-each",
+					Title:   "For Each: rulepack " + strings.Join(args, " "),
+					Events:  events,
+					Tables:  []cliout.Table{{Title: "Projects", Columns: []string{"Project", "Status", "Error"}, Rows: rows}},
+					Summary: map[string]string{"projects": strconv.Itoa(len(out.Projects)), "failed": strconv.Itoa(out.Failed)},
+					Done:    "Ran in " + strconv.Itoa(len(out.Projects)) + " project(s)",
+				})
+			}
+			if out.Failed > 0 {
+				return fmt.Errorf("%d of %d project(s) failed", out.Failed, len(out.Projects))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&root, "root", ".", "directory to search for rulepack projects")
+	return cmd
+}
+
+// discoverProjects returns the slash-separated directories under root, in walk
+// order, whose rulepack.json declares dependencies or targets. Rule pack
+// manifests, which declare neither, are not projects.
+func discoverProjects(root string) ([]string, error) {
+	projects := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if path != root && (strings.HasPrefix(name, ".") || name == "node_modules" || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != config.RulesetFileName {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var cfg config.Ruleset
+		// Unparseable files are kept so the command reports the error.
+		if json.Unmarshal(data, &cfg) == nil && len(cfg.Dependencies) == 0 && len(cfg.Targets) == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		projects = append(projects, filepath.ToSlash(rel))
+		return nil
+	})
+	return projects, err
+}
+
+// runInProject runs the rulepack executable in dir and decodes its JSON
+// envelope into a report row.
+func runInProject(exe, dir string, args []string) forEachProjectRow {
+	var stdout, stderr bytes.Buffer
+	c := exec.Command(exe, args...)
+	c.Dir = dir
+	c.Stdout = &stdout
+	c.Stderr = &stderr
+	runErr := c.Run()
+
+	var env struct {
+		Command string          `json:"command"`
+		Result  json.RawMessage `json:"result"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &env); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg == "" && runErr != nil {
+			msg = runErr.Error()
+		} else if msg == "" {
+			msg = "decode output: " + err.Error()
+		}
+		return forEachProjectRow{Status: "failed", Error: msg}
+	}
+	if env.Command == "error" {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		_ = json.Unmarshal(env.Result, &failure)
+		return forEachProjectRow{Status: "failed", Error: failure.Error.Message}
+	}
+	row := forEachProjectRow{Status: "ok", Command: env.Command, Result: env.Result}
+	if runErr != nil {
+		// Commands such as verify-outputs report a result and still fail.
+		row.Status = "failed"
+		row.Error = runErr.Error()
+	}
+	return row
+}
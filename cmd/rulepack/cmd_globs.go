@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/pack"
+	"rulepack/internal/render"
+)
+
+func (a *app) newGlobsCmd() *cobra.Command {
+	root := &cobra.Command{Use: "globs", Short: "Debug module apply globs"}
+	root.AddCommand(a.newGlobsTestCmd())
+	return root
+}
+
+func (a *app) newGlobsTestCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "test <module-id> <path...>",
+		Short: "Evaluate a module's apply globs against sample paths for each glob-aware target",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadEffectiveRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			modules, err := composeModules(cfg, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+			var module *pack.Module
+			for i := range modules {
+				if modules[i].ID == args[0] {
+					module = &modules[i]
+					break
+				}
+			}
+			if module == nil {
+				return fmt.Errorf("module %q not found in resolved dependencies", args[0])
+			}
+			results := render.EvaluateGlobs(*module, args[1:])
+
+			out := globsTestOutput{Module: module.ID, Results: results}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("globs.test", out)
+			}
+			rows := make([][]string, 0, len(results))
+			for _, r := range results {
+				detail := r.Glob
+				if r.Error != "" {
+					detail = r.Error
+				}
+				rows = append(rows, []string{r.Target, r.Mode, r.Path, boolToYesNo(r.Matched), detail})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "globs.test",
+				Title:   "Glob Test",
+				Tables:  []cliout.Table{{Title: module.ID, Columns: []string{"Target", "Mode", "Path", "Match", "Glob"}, Rows: rows}},
+				Done:    "Glob test complete",
+			})
+			return nil
+		},
+	}
+	return cmd
+}
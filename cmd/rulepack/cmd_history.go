@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/history"
+)
+
+func (a *app) newHistoryCmd() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show the audit log of mutating commands",
+		Long:  "Show " + history.AuditFile + ", which records the time, user, arguments, and resulting file hashes of every command that changed rulepack.json, the lockfile, or generated outputs.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if limit < 0 {
+				return errors.New("--limit must not be negative")
+			}
+			entries, err := history.ReadAudit()
+			if err != nil {
+				return err
+			}
+			if limit > 0 && len(entries) > limit {
+				entries = entries[len(entries)-limit:]
+			}
+			if entries == nil {
+				entries = []history.AuditEntry{}
+			}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("history", historyOutput{Entries: entries})
+			}
+			rows := make([][]string, 0, len(entries))
+			for _, entry := range entries {
+				result := "ok"
+				if entry.Error != "" {
+					result = "error: " + entry.Error
+				}
+				rows = append(rows, []string{entry.Time, orDash(entry.User), entry.Command, orDash(strings.Join(entry.Args, " ")), result})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "history",
+				Title:   "History",
+				Tables:  []cliout.Table{{Title: "Audit Log", Columns: []string{"Time", "User", "Command", "Args", "Result"}, Rows: rows}},
+				Done:    "History loaded",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().IntVar(&limit, "limit", 0, "show only the newest N entries")
+	return cmd
+}
@@ -1,37 +1,73 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"rulepack/internal/cliout"
 	"rulepack/internal/config"
+	"rulepack/internal/pack"
 )
 
 func (a *app) newInitCmd() *cobra.Command {
 	var name string
 	var template string
+	var templateRef string
+	var fromExisting bool
 	cmd := &cobra.Command{
 		Use:   "init",
 		Short: "Create a starter rulepack.json",
+		Long: "Write rulepack.json with the default cursor, copilot, codex, and claude targets. " +
+			"--template git:<uri>#<export> or local:<path>#<export> starts from the project template a pack export publishes instead, at the default branch or --template-ref. " +
+			"With --from-existing, the targets are instead those whose tool already keeps files in the repository (see doctor --tools), falling back to the defaults when none does.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if _, err := os.Stat(config.RulesetFileName); err == nil {
-				return fmt.Errorf("%s already exists", config.RulesetFileName)
+			if _, err := os.Stat(rulesetFile); err == nil {
+				return fmt.Errorf("%s already exists", rulesetFile)
 			}
 			if name == "" {
 				cwd, _ := os.Getwd()
 				name = filepath.Base(cwd)
 			}
-			cfg, files, err := initTemplate(name, template)
+			var cfg config.Ruleset
+			var files []templateFile
+			var templateCommit string
+			dep, fromPack, err := parseTemplateSource(template)
 			if err != nil {
 				return err
 			}
+			if templateRef != "" && dependencySource(dep) != "git" {
+				return errors.New("--template-ref requires a git: template")
+			}
+			if fromPack {
+				if cfg, templateCommit, err = loadPackTemplate(dep, templateRef); err != nil {
+					return err
+				}
+				cfg.Name = name
+			} else if cfg, files, err = initTemplate(name, template); err != nil {
+				return err
+			}
+			var detected []initDetection
+			if fromExisting {
+				if detected, err = detectTargets(); err != nil {
+					return err
+				}
+				if len(detected) > 0 {
+					cfg.Targets = make(map[string]config.TargetEntry, len(detected))
+					for _, d := range detected {
+						cfg.Targets[d.Target] = initTargetEntry(d.Target)
+					}
+				}
+			}
 			if err := writeTemplateFiles(files); err != nil {
 				return err
 			}
-			if err := config.SaveRuleset(config.RulesetFileName, cfg); err != nil {
+			if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
 				return err
 			}
 			templatePaths := make([]string, 0, len(files))
@@ -40,14 +76,29 @@ func (a *app) newInitCmd() *cobra.Command {
 				templatePaths = append(templatePaths, f.Path)
 				rows = append(rows, []string{f.Path})
 			}
-			out := initOutput{RulesetFile: config.RulesetFileName, Name: name, TemplateFiles: templatePaths}
+			targets := slices.Sorted(maps.Keys(cfg.Targets))
+			out := initOutput{RulesetFile: rulesetFile, Name: name, Template: template, TemplateCommit: templateCommit, Targets: targets, Detected: detected, TemplateFiles: templatePaths}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("init", out)
 			}
+			events := []cliout.Event{{Level: "info", Message: "Created " + rulesetFile + " with targets " + strings.Join(targets, ", ")}}
+			if fromPack {
+				from := "Started from template " + template
+				if templateCommit != "" {
+					from += " at " + shortSHA(templateCommit)
+				}
+				events = append(events, cliout.Event{Level: "info", Message: from})
+			}
+			for _, d := range detected {
+				events = append(events, cliout.Event{Level: "info", Message: "Detected " + d.Target + " from " + strings.Join(d.Evidence, ", ")})
+			}
+			if fromExisting && len(detected) == 0 {
+				events = append(events, cliout.Event{Level: "warn", Message: "No assistant config found; using the default targets"})
+			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "init",
 				Title:   "Initialize Rulepack",
-				Events:  []cliout.Event{{Level: "info", Message: "Created " + config.RulesetFileName}},
+				Events:  events,
 				Tables:  []cliout.Table{{Title: "Scaffolded Files", Columns: []string{"Path"}, Rows: rows}},
 				Done:    "Initialization complete",
 			})
@@ -55,6 +106,85 @@ func (a *app) newInitCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVar(&name, "name", "", "rulepack name")
-	cmd.Flags().StringVar(&template, "template", "", "init template: rulepack")
+	cmd.Flags().StringVar(&template, "template", "", "init template: rulepack, git:<uri>#<export>, or local:<path>#<export>")
+	cmd.Flags().StringVar(&templateRef, "template-ref", "", "ref (commit/tag/branch) of a git: template")
+	cmd.Flags().BoolVar(&fromExisting, "from-existing", false, "configure targets for the assistant tools the repository already uses")
 	return cmd
 }
+
+// parseTemplateSource reads a --template naming a pack export, as
+// git:<uri>#<export> or local:<path>#<export>, into a dependency. It returns
+// false for built-in template names.
+func parseTemplateSource(template string) (config.Dependency, bool, error) {
+	source, ref, ok := strings.Cut(template, ":")
+	if !ok || (source != "git" && source != "local") {
+		return config.Dependency{}, false, nil
+	}
+	export := ""
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		ref, export = ref[:i], ref[i+1:]
+	}
+	if ref == "" {
+		return config.Dependency{}, false, fmt.Errorf("template %q names no %s source", template, source)
+	}
+	dep := config.Dependency{Source: source, Export: export}
+	if source == "git" {
+		dep.URI = ref
+	} else {
+		dep.Path = ref
+	}
+	return dep, true, nil
+}
+
+// loadPackTemplate reads the project template dep's export publishes, git
+// packs at ref or their default branch, and returns the commit read.
+func loadPackTemplate(dep config.Dependency, ref string) (config.Ruleset, string, error) {
+	if dependencySource(dep) == "local" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return config.Ruleset{}, "", err
+		}
+		root, _, err := resolveLocalPath(cwd, dep.Path)
+		if err != nil {
+			return config.Ruleset{}, "", err
+		}
+		cfg, err := pack.LoadTemplate(pack.LocalReader(root), dep.Export)
+		return cfg, "", err
+	}
+	gc, err := newGitClient()
+	if err != nil {
+		return config.Ruleset{}, "", err
+	}
+	repoDir, err := gc.EnsureRepo(dep.URI)
+	if err != nil {
+		return config.Ruleset{}, "", fmt.Errorf("prepare %s: %w", dep.URI, err)
+	}
+	res, err := gc.Resolve(repoDir, ref, "")
+	if err != nil {
+		return config.Ruleset{}, "", fmt.Errorf("resolve %s: %w", dep.URI, err)
+	}
+	cfg, err := pack.LoadTemplate(pack.GitReader(gc, repoDir, res.Commit), dep.Export)
+	return cfg, res.Commit, err
+}
+
+// detectTargets lists the target types whose tool already keeps files in
+// the working directory, in TargetKinds order.
+func detectTargets() ([]initDetection, error) {
+	var detected []initDetection
+	for _, kind := range config.TargetKinds {
+		found, err := toolEvidence(kind, func(string) bool { return false })
+		if err != nil {
+			return nil, err
+		}
+		if len(found) > 0 {
+			detected = append(detected, initDetection{Target: kind, Evidence: found})
+		}
+	}
+	return detected, nil
+}
+
+// initTargetEntry is the entry init writes for kind: the default entry when
+// there is one, else an empty entry using the renderer's defaults.
+func initTargetEntry(kind string) config.TargetEntry {
+	return config.DefaultRuleset("").Targets[kind]
+}
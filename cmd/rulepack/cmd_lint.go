@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/pack"
+	"rulepack/internal/render"
+)
+
+func (a *app) newLintCmd() *cobra.Command {
+	var target string
+	var sarifPath string
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check module apply rules against each target before building",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadEffectiveRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			modules, err := composeModules(cfg, runtime.GOOS, runtime.GOARCH)
+			if err != nil {
+				return err
+			}
+			targets := resolveBuildTargets(target, cfg.Targets)
+			bands, err := cfg.Bands()
+			if err != nil {
+				return err
+			}
+			issues := append(render.LintApplyTargets(modules), render.LintNamespaces(modules)...)
+			issues = append(issues, render.LintBands(modules, bands)...)
+			issues = append(issues, render.LintTerminology(modules, cfg.Terminology)...)
+			for _, t := range targets {
+				entry, ok := cfg.Targets[t]
+				if !ok {
+					if target != "all" {
+						return fmt.Errorf("target %q not configured", t)
+					}
+					continue
+				}
+				issues = append(issues, render.LintApply(t, entry.Kind(t), entry, targetModules(entry, modules))...)
+			}
+
+			if sarifPath != "" {
+				if err := writeLintSARIF(sarifPath, issues); err != nil {
+					return err
+				}
+			}
+
+			out := lintOutput{Issues: issues}
+			for _, issue := range issues {
+				if issue.Level == "error" {
+					out.Errors++
+				} else {
+					out.Warnings++
+				}
+			}
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("lint", out); err != nil {
+					return err
+				}
+			} else {
+				rows := make([][]string, 0, len(issues))
+				for _, issue := range issues {
+					rows = append(rows, []string{issue.Level, issue.Target, issue.Module, issue.Message})
+				}
+				events := []cliout.Event{}
+				if len(issues) == 0 {
+					events = append(events, cliout.Event{Level: "info", Message: "No apply issues found"})
+				}
+				findings := []cliout.Finding{}
+				if a.problems {
+					findings = lintProblems(cfg, issues)
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command:  "lint",
+					Title:    "Apply Lint",
+					Events:   events,
+					Tables:   []cliout.Table{{Title: "Issues", Columns: []string{"Level", "Target", "Module", "Message"}, Rows: rows}},
+					Summary:  map[string]string{"errors": strconv.Itoa(out.Errors), "warnings": strconv.Itoa(out.Warnings)},
+					Done:     "Lint complete",
+					Findings: findings,
+				})
+			}
+			if out.Errors > 0 {
+				return fmt.Errorf("lint found %d error(s)", out.Errors)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&target, "target", "all", "target to check, or all")
+	cmd.Flags().StringVar(&sarifPath, "sarif", "", "also write the issues as a SARIF 2.1.0 log to this file, for code-scanning tools")
+	return cmd
+}
+
+// writeLintSARIF reports issues against rulepack.json, which pulls in the
+// modules, naming the module as the logical location.
+func writeLintSARIF(path string, issues []render.LintIssue) error {
+	rules := make([]cliout.SARIFRule, 0, len(render.LintRules))
+	for _, rule := range render.LintRules {
+		rules = append(rules, cliout.SARIFRule{ID: rule.ID, Description: rule.Description})
+	}
+	findings := make([]cliout.Finding, 0, len(issues))
+	for _, issue := range issues {
+		findings = append(findings, lintFinding(issue))
+	}
+	return writeSARIF(path, rules, findings)
+}
+
+// writeSARIF writes findings as a SARIF log from rulepack to path.
+func writeSARIF(path string, rules []cliout.SARIFRule, findings []cliout.Finding) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := cliout.WriteSARIF(f, "rulepack", appVersion(), rules, findings); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// lintFinding reports issue against rulepack.json, which pulls in the module.
+func lintFinding(issue render.LintIssue) cliout.Finding {
+	msg := fmt.Sprintf("%s (module %s, target %s)", issue.Message, issue.Module, issue.Target)
+	if issue.Path != "" {
+		msg = fmt.Sprintf("%s (module %s at %s, target %s)", issue.Message, issue.Module, issue.Path, issue.Target)
+	}
+	return cliout.Finding{
+		RuleID:  issue.Rule,
+		Level:   issue.Level,
+		Message: msg,
+		File:    rulesetFile,
+		Logical: issue.Module,
+	}
+}
+
+// lintProblems locates issues for --problems output: issues of modules from
+// local dependencies point at the module's source file, the rest at
+// rulepack.json.
+func lintProblems(cfg config.Ruleset, issues []render.LintIssue) []cliout.Finding {
+	files := localModuleFiles(cfg)
+	findings := make([]cliout.Finding, 0, len(issues))
+	for _, issue := range issues {
+		f := lintFinding(issue)
+		if file, ok := files[issue.Module]; ok {
+			f.File, f.Line = file, issue.Line
+		}
+		findings = append(findings, f)
+	}
+	return findings
+}
+
+// localModuleFiles maps the IDs of modules from local dependencies to their
+// source files, relative to the working directory. Dependencies that fail to
+// expand are left out; build and lint report those errors themselves.
+func localModuleFiles(cfg config.Ruleset) map[string]string {
+	files := map[string]string{}
+	cfgPath, err := filepath.Abs(rulesetFile)
+	if err != nil {
+		return files
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return files
+	}
+	for _, dep := range cfg.Dependencies {
+		if dependencySource(dep) != "local" {
+			continue
+		}
+		root, _, err := resolveLocalPath(filepath.Dir(cfgPath), dep.Path)
+		if err != nil {
+			continue
+		}
+		modules, _, err := pack.ExpandLocalDependency(root, dep, "local", expandOptions(cfg))
+		if err != nil {
+			continue
+		}
+		for _, m := range modules {
+			if rel, err := filepath.Rel(wd, filepath.Join(root, filepath.FromSlash(m.Path))); err == nil {
+				files[m.ID] = filepath.ToSlash(rel)
+			}
+		}
+	}
+	return files
+}
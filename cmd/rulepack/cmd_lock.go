@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/build"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+func (a *app) newLockCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lock",
+		Short: "Maintain rulepack.lock.json",
+	}
+	cmd.AddCommand(a.newLockPruneCmd())
+	return cmd
+}
+
+func (a *app) newLockPruneCmd() *cobra.Command {
+	var plan bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Drop lock entries of dependencies removed from rulepack.json",
+		Long:  "Drop the lock entries no dependency in rulepack.json claims, without resolving anything, and recompute the lockfile's rulesetDigest from the entries that remain. Every remaining dependency must already be locked. Cached git mirrors are shared by every project on the machine and are left alone.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			lock, err := config.LoadLockfile(lockFile)
+			if err != nil {
+				return err
+			}
+			if plan {
+				rows := prunedLockRows(lock, lock.Orphans(cfg.Dependencies))
+				return a.renderPlan(planOutput{Command: "lock.prune", Actions: lockPrunePlan(rows)})
+			}
+			lock, pruned, err := pruneLock(cfg, lock)
+			if err != nil {
+				return err
+			}
+			out := lockPruneOutput{LockFile: lockFile, Pruned: pruned}
+			if len(pruned) > 0 {
+				if err := a.snapshotProject("lock prune"); err != nil {
+					return err
+				}
+				if err := config.SaveLockfile(lockFile, lock); err != nil {
+					return err
+				}
+			}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("lock.prune", out)
+			}
+			rows := make([][]string, 0, len(out.Pruned))
+			for _, row := range out.Pruned {
+				rows = append(rows, []string{row.Source, row.Ref, row.Resolved})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "lock.prune",
+				Title:   "Prune Lockfile",
+				Tables:  []cliout.Table{{Title: "Dropped Lock Entries", Columns: []string{"Source", "Ref", "Resolved"}, Rows: rows}},
+				Summary: map[string]string{"dropped": strconv.Itoa(len(out.Pruned))},
+				Done:    fmt.Sprintf("%s pruned", lockFile),
+			})
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&plan, "plan", false, "report the lock entries prune would drop without writing anything")
+	return cmd
+}
+
+// pruneLock drops the entries of lock no dependency of cfg claims and
+// recomputes its rulesetDigest from the rest, which must all still match
+// their dependencies. lock is returned unchanged when nothing is orphaned.
+func pruneLock(cfg config.Ruleset, lock config.Lockfile) (config.Lockfile, []prunedLockRow, error) {
+	orphans := lock.Orphans(cfg.Dependencies)
+	if len(orphans) == 0 {
+		return lock, []prunedLockRow{}, nil
+	}
+	pruned := prunedLockRows(lock, orphans)
+	kept := make([]config.LockedSource, 0, len(lock.Resolved)-len(orphans))
+	for i, locked := range lock.Resolved {
+		if !slices.Contains(orphans, i) {
+			kept = append(kept, locked)
+		}
+	}
+	lock.Resolved = kept
+	// The digest covers every module the lock provides, so it changes with
+	// the entries that remain.
+	_, provided, err := composeLock(cfg, lock, "", "", nil)
+	if err != nil {
+		return lock, nil, err
+	}
+	if lock.RulesetDigest, err = build.RulesetDigest(provided); err != nil {
+		return lock, nil, err
+	}
+	return lock, pruned, nil
+}
+
+// lockPrunePlan lists the lock entries pruning drops and the lockfile write.
+func lockPrunePlan(rows []prunedLockRow) []planAction {
+	actions := make([]planAction, 0, len(rows)+1)
+	for _, row := range rows {
+		actions = append(actions, planAction{Action: "delete", Kind: "lock entry", Target: row.Ref, Detail: row.Resolved})
+	}
+	if len(rows) > 0 {
+		actions = append(actions, planAction{Action: "update", Kind: "file", Target: lockFile})
+	}
+	return actions
+}
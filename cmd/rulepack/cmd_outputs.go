@@ -0,0 +1,189 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/build"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/render"
+)
+
+func (a *app) newVerifyOutputsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify-outputs",
+		Short: "Check generated files against the digests recorded by the last build",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := config.LoadOutputs(outputsFile)
+			if err != nil {
+				return err
+			}
+			out := verifyOutputsOutput{Files: make([]outputFileRow, 0)}
+			for _, t := range manifestTargets(manifest) {
+				for _, f := range manifest.Targets[t].Files {
+					status, err := build.OutputStatus(f)
+					if err != nil {
+						return err
+					}
+					if status != "ok" {
+						out.Problems++
+					}
+					out.Files = append(out.Files, outputFileRow{Target: t, Path: f.Path, Status: status})
+				}
+			}
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("verify-outputs", out); err != nil {
+					return err
+				}
+			} else {
+				rows := make([][]string, 0, len(out.Files))
+				for _, f := range out.Files {
+					rows = append(rows, []string{f.Target, f.Path, f.Status})
+				}
+				events := []cliout.Event{}
+				if len(manifest.Targets) == 0 {
+					events = append(events, cliout.Event{Level: "info", Message: "No outputs recorded; run rulepack build"})
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command: "verify-outputs",
+					Title:   "Output Verification",
+					Events:  events,
+					Tables:  []cliout.Table{{Title: "Outputs", Columns: []string{"Target", "Path", "Status"}, Rows: rows}},
+					Summary: map[string]string{"files": strconv.Itoa(len(out.Files)), "problems": strconv.Itoa(out.Problems)},
+					Done:    "Verification complete",
+				})
+			}
+			if out.Problems > 0 {
+				return fmt.Errorf("%d generated file(s) modified or missing", out.Problems)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func (a *app) newSmokeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "smoke",
+		Short: "Check that generated files will load in their assistants",
+		Long:  "Check every file recorded by the last build for invalid encoding, leftover merge conflict markers, and malformed frontmatter (required in Cursor .mdc rules). Exits non-zero on any problem, so it can gate a commit.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := config.LoadOutputs(outputsFile)
+			if err != nil {
+				return err
+			}
+			out := smokeOutput{Files: make([]smokeFileRow, 0)}
+			for _, t := range manifestTargets(manifest) {
+				for _, f := range manifest.Targets[t].Files {
+					row := smokeFileRow{Target: t, Path: f.Path, Status: "ok"}
+					content, err := os.ReadFile(f.Path)
+					switch {
+					case os.IsNotExist(err):
+						row.Problems = []string{"missing; run rulepack build"}
+					case err != nil:
+						return err
+					default:
+						row.Problems = render.Smoke(f.Path, content)
+					}
+					if len(row.Problems) > 0 {
+						row.Status = "fail"
+						out.Failures++
+					}
+					out.Files = append(out.Files, row)
+				}
+			}
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("smoke", out); err != nil {
+					return err
+				}
+			} else {
+				rows := make([][]string, 0, len(out.Files))
+				for _, f := range out.Files {
+					rows = append(rows, []string{f.Target, f.Path, f.Status, strings.Join(f.Problems, "; ")})
+				}
+				events := []cliout.Event{}
+				if len(manifest.Targets) == 0 {
+					events = append(events, cliout.Event{Level: "info", Message: "No outputs recorded; run rulepack build"})
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command: "smoke",
+					Title:   "Output Smoke Check",
+					Events:  events,
+					Tables:  []cliout.Table{{Title: "Outputs", Columns: []string{"Target", "Path", "Status", "Problems"}, Rows: rows}},
+					Summary: map[string]string{"files": strconv.Itoa(len(out.Files)), "failures": strconv.Itoa(out.Failures)},
+					Done:    "Smoke check complete",
+				})
+			}
+			if out.Failures > 0 {
+				return fmt.Errorf("%d generated file(s) failed the smoke check", out.Failures)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func (a *app) newCleanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "Delete the generated files recorded by the last build",
+		Long:  "Delete the generated files recorded in " + config.OutputsFileName + ". Files edited since the build are kept.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := config.LoadOutputs(outputsFile)
+			if err != nil {
+				return err
+			}
+			if len(manifest.Targets) > 0 {
+				if err := a.snapshotProject("clean"); err != nil {
+					return err
+				}
+			}
+			out := cleanOutput{Deleted: make([]string, 0)}
+			for _, t := range manifestTargets(manifest) {
+				deleted, skipped, err := build.RemoveOutputs(manifest.Targets[t].Files)
+				if err != nil {
+					return err
+				}
+				out.Deleted = append(out.Deleted, deleted...)
+				out.Skipped = append(out.Skipped, skipped...)
+			}
+			if err := os.Remove(outputsFile); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+
+			if a.jsonMode {
+				return a.renderer.RenderJSON("clean", out)
+			}
+			rows := make([][]string, 0, len(out.Deleted)+len(out.Skipped))
+			for _, path := range out.Deleted {
+				rows = append(rows, []string{path, "deleted"})
+			}
+			for _, path := range out.Skipped {
+				rows = append(rows, []string{path, "kept (modified)"})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "clean",
+				Title:   "Clean Outputs",
+				Tables:  []cliout.Table{{Title: "Files", Columns: []string{"Path", "Result"}, Rows: rows}},
+				Summary: map[string]string{"deleted": strconv.Itoa(len(out.Deleted)), "skipped": strconv.Itoa(len(out.Skipped))},
+				Done:    "Clean complete",
+			})
+			return nil
+		},
+	}
+	return cmd
+}
+
+func manifestTargets(manifest config.Outputs) []string {
+	names := make([]string, 0, len(manifest.Targets))
+	for name := range manifest.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+)
+
+func (a *app) newOverridesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "overrides",
+		Short: "Maintain module overrides",
+	}
+	cmd.AddCommand(a.newOverridesPruneCmd())
+	return cmd
+}
+
+func (a *app) newOverridesPruneCmd() *cobra.Command {
+	var plan bool
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove overrides that match no locked module",
+		Long:  "Remove the overrides in rulepack.json and the overrides files whose module ID no locked dependency provides, on any platform. Modules dropped by " + config.IgnoreFileName + " still count as provided. Run rulepack deps install first so the lockfile reflects the current dependencies.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.LoadRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			_, provided, err := composeLocked(cfg, "", "", nil)
+			if err != nil {
+				return err
+			}
+			files := []string{rulesetFile}
+			overrides := [][]config.Override{cfg.Overrides}
+			for _, file := range config.OverrideFiles(rulesetFile) {
+				ovs, err := config.LoadOverrideFile(file)
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				files = append(files, file)
+				overrides = append(overrides, ovs)
+			}
+			var all []config.Override
+			for _, ovs := range overrides {
+				all = append(all, ovs...)
+			}
+			dead := deadOverrides(all, provided)
+
+			out := overridesPruneOutput{Removed: []overridePruneRow{}, Updated: []string{}}
+			kept := make([][]config.Override, len(files))
+			for i, ovs := range overrides {
+				for _, ov := range ovs {
+					if slices.Contains(dead, ov.ID) {
+						out.Removed = append(out.Removed, overridePruneRow{ID: ov.ID, File: filepath.ToSlash(files[i])})
+						continue
+					}
+					kept[i] = append(kept[i], ov)
+				}
+				if len(kept[i]) < len(ovs) {
+					out.Updated = append(out.Updated, filepath.ToSlash(files[i]))
+				}
+			}
+			if plan {
+				actions := make([]planAction, 0, len(out.Removed)+len(out.Updated))
+				for _, row := range out.Removed {
+					actions = append(actions, planAction{Action: "remove", Kind: "override", Target: row.ID, Detail: row.File})
+				}
+				for _, file := range out.Updated {
+					actions = append(actions, planAction{Action: "update", Kind: "file", Target: file})
+				}
+				return a.renderPlan(planOutput{Command: "overrides.prune", Actions: actions})
+			}
+			if len(out.Updated) > 0 {
+				if err := a.snapshotProject("overrides prune"); err != nil {
+					return err
+				}
+			}
+			for i, file := range files {
+				if len(kept[i]) == len(overrides[i]) {
+					continue
+				}
+				if i == 0 {
+					cfg.Overrides = kept[i]
+					err = config.SaveRuleset(rulesetFile, cfg)
+				} else {
+					err = config.SaveOverrideFile(file, kept[i])
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("overrides.prune", out)
+			}
+			rows := make([][]string, 0, len(out.Removed))
+			for _, row := range out.Removed {
+				rows = append(rows, []string{row.ID, row.File})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "overrides.prune",
+				Title:   "Prune Overrides",
+				Tables:  []cliout.Table{{Title: "Removed Overrides", Columns: []string{"Module", "File"}, Rows: rows}},
+				Summary: map[string]string{"removed": strconv.Itoa(len(out.Removed)), "files": strconv.Itoa(len(out.Updated))},
+				Done:    "Overrides pruned",
+			})
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&plan, "plan", false, "report the overrides prune would remove without writing anything")
+	return cmd
+}
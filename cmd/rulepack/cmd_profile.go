@@ -6,16 +6,23 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
+	"rulepack/internal/build"
 	"rulepack/internal/cliout"
 	"rulepack/internal/config"
 	"rulepack/internal/git"
 	"rulepack/internal/pack"
 	profilesvc "rulepack/internal/profile"
+	"rulepack/internal/selector"
 )
 
 func (a *app) newProfileCmd() *cobra.Command {
@@ -26,6 +33,8 @@ func (a *app) newProfileCmd() *cobra.Command {
 	root.AddCommand(a.newProfileRemoveCmd())
 	root.AddCommand(a.newProfileUseCmd())
 	root.AddCommand(a.newProfileDiffCmd())
+	root.AddCommand(a.newProfileVerifyCmd())
+	root.AddCommand(a.newProfileDoctorCmd())
 	root.AddCommand(a.newProfileRefreshCmd())
 	return root
 }
@@ -34,31 +43,47 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 	var depSelector string
 	var alias string
 	var switchDependency bool
+	var exportFlags []string
+	var store string
+	var refreshEvery string
 	cmd := &cobra.Command{
 		Use:   "save",
 		Short: "Save dependencies as a globally reusable local profile snapshot",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			exports, err := parseProfileExports(exportFlags)
 			if err != nil {
 				return err
 			}
-			lock, err := config.LoadLockfile(config.LockFileName)
+			if _, err := profilesvc.Root(store); err != nil {
+				return fmt.Errorf("invalid --scope: %w", err)
+			}
+			if refreshEvery != "" {
+				if _, err := profilesvc.ParseRefreshEvery(refreshEvery); err != nil {
+					return fmt.Errorf("--refresh-every: %w", err)
+				}
+			}
+			cfg, err := config.LoadRuleset(rulesetFile)
+			if err != nil {
+				return err
+			}
+			lock, err := config.LoadLockfile(lockFile)
 			if err != nil {
 				return err
 			}
-			if len(cfg.Dependencies) != len(lock.Resolved) {
+			aligned, err := lock.Align(cfg.Dependencies)
+			if err != nil {
 				return errors.New("cannot save profile: dependency not installed; run rulepack deps install")
 			}
 			resolvedAlias, err := resolveProfileAlias(cmd, alias)
 			if err != nil {
 				return err
 			}
-			cfgPath, err := filepath.Abs(config.RulesetFileName)
+			cfgPath, err := filepath.Abs(rulesetFile)
 			if err != nil {
 				return err
 			}
 			cfgDir := filepath.Dir(cfgPath)
-			gc, err := git.NewClient()
+			gc, err := newProjectGitClient(cfg)
 			if err != nil {
 				return err
 			}
@@ -79,8 +104,8 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 				dependencyIndex = idx
 				sourceCount = 1
 				dep := cfg.Dependencies[idx]
-				locked := lock.Resolved[idx]
-				modules, contentHash, sourceRef, provenance, err := expandDependencyForSnapshot(cfgDir, gc, dep, locked)
+				locked := aligned[idx]
+				modules, contentHash, sourceRef, provenance, err := expandDependencyForSnapshot(cfgDir, gc, dep, locked, expandOptions(cfg))
 				if err != nil {
 					return err
 				}
@@ -93,8 +118,11 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 						Provenance:   provenance,
 						ModuleIDs:    moduleIDs(modules),
 					}},
-					ContentHash: contentHash,
-					Modules:     modules,
+					ContentHash:  contentHash,
+					Modules:      modules,
+					Exports:      exports,
+					Scope:        store,
+					RefreshEvery: refreshEvery,
 				})
 				if err != nil {
 					return err
@@ -110,10 +138,13 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 				}
 				contentHash := profilesvc.ComputeContentHash(modules, "default")
 				meta, err = profilesvc.SaveSnapshot(profilesvc.SaveInput{
-					Alias:       resolvedAlias,
-					Sources:     sources,
-					ContentHash: contentHash,
-					Modules:     modules,
+					Alias:        resolvedAlias,
+					Sources:      sources,
+					ContentHash:  contentHash,
+					Modules:      modules,
+					Exports:      exports,
+					Scope:        store,
+					RefreshEvery: refreshEvery,
 				})
 				if err != nil {
 					return err
@@ -126,14 +157,17 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 				}
 			}
 			if switchDependency {
-				if err := config.SaveRuleset(config.RulesetFileName, cfg); err != nil {
+				if err := a.snapshotProject("profile save"); err != nil {
 					return err
 				}
-				newLock, _, _, err := buildLock(cfg, cfgDir, gc)
+				if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
+					return err
+				}
+				newLock, _, _, _, _, err := buildLock(cfg, cfgDir, gc, nil, nil, nil)
 				if err != nil {
 					return err
 				}
-				if err := config.SaveLockfile(config.LockFileName, newLock); err != nil {
+				if err := config.SaveLockfile(lockFile, newLock); err != nil {
 					return err
 				}
 			}
@@ -148,8 +182,8 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 			if a.jsonMode {
 				return a.renderer.RenderJSON("profile.save", out)
 			}
-			rows := [][]string{{meta.ID, meta.Alias, profileSourceSummary(meta), "default", strconv.Itoa(meta.ModuleCount), shortSHA(meta.ContentHash)}}
-			events := []cliout.Event{{Level: "info", Message: "Scope: " + scope}}
+			rows := [][]string{{meta.ID, meta.Alias, profileSourceSummary(meta), strings.Join(meta.ExportNames(), ", "), strconv.Itoa(meta.ModuleCount), shortSHA(meta.ContentHash)}}
+			events := []cliout.Event{{Level: "info", Message: "Scope: " + scope}, {Level: "info", Message: "Store: " + meta.Scope}}
 			if switchDependency {
 				events = append(events, cliout.Event{Level: "info", Message: "Switched dependencies to profile source and refreshed lockfile"})
 			}
@@ -170,9 +204,39 @@ func (a *app) newProfileSaveCmd() *cobra.Command {
 	cmd.Flags().StringVar(&depSelector, "dep", "", "dependency selector (index or source ref)")
 	cmd.Flags().StringVar(&alias, "alias", "", "profile alias (required; prompts in interactive terminals)")
 	cmd.Flags().BoolVar(&switchDependency, "switch", false, "switch dependency config to saved profile source")
+	cmd.Flags().StringVar(&refreshEvery, "refresh-every", "", "how often the profile should be refreshed, e.g. 30d, 2w, or 12h; profile list and doctor flag it when overdue")
+	cmd.Flags().StringVar(&store, "scope", profilesvc.ScopeGlobal, "profile store to save into: global (~/.rulepack/profiles) or project (.rulepack/profiles, for committing)")
+	cmd.Flags().StringArrayVar(&exportFlags, "export", nil, "define a named export of the profile as name=pattern[,pattern...] over module IDs (repeatable)")
 	return cmd
 }
 
+// parseProfileExports parses profile save --export values into export names
+// and their module ID patterns.
+func parseProfileExports(raw []string) (map[string][]string, error) {
+	if len(raw) == 0 {
+		return nil, nil
+	}
+	exports := make(map[string][]string, len(raw))
+	for _, r := range raw {
+		name, list, ok := strings.Cut(r, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --export %q: use name=pattern[,pattern...]", r)
+		}
+		if _, dup := exports[name]; dup {
+			return nil, fmt.Errorf("duplicate --export %q", name)
+		}
+		patterns := []string{}
+		for _, p := range strings.Split(list, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				patterns = append(patterns, p)
+			}
+		}
+		exports[name] = patterns
+	}
+	return exports, nil
+}
+
 func resolveProfileAlias(cmd *cobra.Command, alias string) (string, error) {
 	alias = strings.TrimSpace(alias)
 	if alias != "" {
@@ -197,15 +261,62 @@ func resolveProfileAlias(cmd *cobra.Command, alias string) (string, error) {
 }
 
 func (a *app) newProfileListCmd() *cobra.Command {
+	var filters []string
+	var source string
+	var sortBy string
+	var limit int
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List globally saved profiles in a table",
+		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			profiles, err := profilesvc.List()
+			parsed, err := parseProfileFilters(filters)
+			if err != nil {
+				return err
+			}
+			switch source {
+			case "", "git", "local", profilesvc.ProfileSource:
+			default:
+				return fmt.Errorf("invalid --source %q: use git, local, or profile", source)
+			}
+			switch sortBy {
+			case "", "id", "created", "modules", "alias":
+			default:
+				return fmt.Errorf("invalid --sort %q: use id, created, modules, or alias", sortBy)
+			}
+			if limit < 0 {
+				return errors.New("--limit must not be negative")
+			}
+			all, err := profilesvc.List()
 			if err != nil {
 				return err
 			}
-			out := profileListOutput{Profiles: profiles}
+			profiles := make([]profilesvc.Metadata, 0, len(all))
+			for _, p := range all {
+				if profileMatches(p, parsed, source) {
+					profiles = append(profiles, p)
+				}
+			}
+			sortProfiles(profiles, sortBy)
+			out := profileListOutput{
+				Profiles: profiles,
+				Total:    len(all),
+				Matched:  len(profiles),
+				Filters:  filters,
+				Source:   source,
+				Sort:     sortBy,
+				Limit:    limit,
+			}
+			if limit > 0 && len(profiles) > limit {
+				out.Profiles = profiles[:limit]
+			}
+			profiles = out.Profiles
+			now := time.Now()
+			for _, p := range profiles {
+				if p.RefreshDue(now) {
+					out.Due = append(out.Due, p.ID)
+				}
+			}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("profile.list", out)
 			}
@@ -215,35 +326,158 @@ func (a *app) newProfileListCmd() *cobra.Command {
 				if alias == "" {
 					alias = "-"
 				}
-				rows = append(rows, []string{p.ID, alias, profileSourceSummary(p), "default", strconv.Itoa(p.ModuleCount), p.CreatedAt})
+				rows = append(rows, []string{p.ID, alias, p.Scope, profileSourceSummary(p), strings.Join(p.ExportNames(), ", "), strconv.Itoa(p.ModuleCount), p.CreatedAt, profileRefreshLabel(p, now)})
 			}
 			events := []cliout.Event{}
-			if len(profiles) == 0 {
+			switch {
+			case len(all) == 0:
 				events = append(events, cliout.Event{Level: "info", Message: "No saved profiles"})
+			case out.Matched == 0:
+				events = append(events, cliout.Event{Level: "info", Message: "No profiles match the filters"})
+			}
+			if len(out.Due) > 0 {
+				events = append(events, cliout.Event{Level: "warn", Message: fmt.Sprintf("%d profile(s) due for refresh; run rulepack profile refresh --due", len(out.Due))})
 			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "profile.list",
 				Title:   "Saved Profiles",
 				Events:  events,
-				Tables:  []cliout.Table{{Title: "Profiles", Columns: []string{"Profile ID", "Alias", "Source", "Export", "Modules", "Created"}, Rows: rows}},
+				Tables:  []cliout.Table{{Title: "Profiles", Columns: []string{"Profile ID", "Alias", "Store", "Source", "Export", "Modules", "Created", "Refresh"}, Rows: rows}},
+				Summary: map[string]string{"shown": strconv.Itoa(len(profiles)), "matched": strconv.Itoa(out.Matched), "total": strconv.Itoa(out.Total)},
 				Done:    "List complete",
 			})
 			return nil
 		},
 	}
+	cmd.Flags().StringArrayVar(&filters, "filter", nil, "keep profiles whose field matches a pattern (* matches any text), as key=pattern with key id, alias, ref, or export (repeatable; all must match)")
+	cmd.Flags().StringVar(&source, "source", "", "keep profiles with a source of this type: git, local, or profile")
+	cmd.Flags().StringVar(&sortBy, "sort", "id", "order by id, created (newest first), modules (most first), or alias")
+	cmd.Flags().IntVar(&limit, "limit", 0, "show at most N profiles after filtering and sorting")
 	return cmd
 }
 
+// profileRefreshLabel describes a profile's refresh interval for tables:
+// "-" when it has none, otherwise the interval, marked when overdue.
+func profileRefreshLabel(p profilesvc.Metadata, now time.Time) string {
+	switch {
+	case p.RefreshEvery == "":
+		return "-"
+	case p.RefreshDue(now):
+		return "due (every " + p.RefreshEvery + ")"
+	default:
+		return "every " + p.RefreshEvery
+	}
+}
+
+type profileFilter struct {
+	key     string
+	pattern *regexp.Regexp
+}
+
+func parseProfileFilters(raw []string) ([]profileFilter, error) {
+	filters := make([]profileFilter, 0, len(raw))
+	for _, r := range raw {
+		key, pattern, ok := strings.Cut(r, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid --filter %q: use key=pattern", r)
+		}
+		switch key {
+		case "id", "alias", "ref", "export":
+		default:
+			return nil, fmt.Errorf("invalid --filter key %q: use id, alias, ref, or export", key)
+		}
+		// * matches any text, including slashes in refs, and ? one character.
+		expr := strings.NewReplacer(`\*`, ".*", `\?`, ".").Replace(regexp.QuoteMeta(pattern))
+		filters = append(filters, profileFilter{key: key, pattern: regexp.MustCompile("^" + expr + "$")})
+	}
+	return filters, nil
+}
+
+// profileMatches reports whether p passes every filter and, when source is
+// set, has a source of that type. ref and export match if any source does.
+func profileMatches(p profilesvc.Metadata, filters []profileFilter, source string) bool {
+	if source != "" && !slices.ContainsFunc(p.Sources, func(s profilesvc.SourceSnapshot) bool { return s.SourceType == source }) {
+		return false
+	}
+	for _, f := range filters {
+		var values []string
+		switch f.key {
+		case "id":
+			values = []string{p.ID}
+		case "alias":
+			values = []string{p.Alias}
+		case "ref":
+			for _, s := range p.Sources {
+				values = append(values, s.SourceRef)
+			}
+		case "export":
+			for _, s := range p.Sources {
+				values = append(values, s.SourceExport)
+			}
+		}
+		if !slices.ContainsFunc(values, f.pattern.MatchString) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortProfiles orders profiles for profile list; ties keep ID order.
+func sortProfiles(profiles []profilesvc.Metadata, by string) {
+	sort.SliceStable(profiles, func(i, j int) bool {
+		a, b := profiles[i], profiles[j]
+		switch by {
+		case "created":
+			return a.CreatedAt > b.CreatedAt
+		case "modules":
+			return a.ModuleCount > b.ModuleCount
+		case "alias":
+			// Profiles without an alias sort last.
+			if (a.Alias == "") != (b.Alias == "") {
+				return a.Alias != ""
+			}
+			return a.Alias < b.Alias
+		default:
+			return a.ID < b.ID
+		}
+	})
+}
+
 func (a *app) newProfileShowCmd() *cobra.Command {
+	var renderTarget string
 	cmd := &cobra.Command{
 		Use:   "show <profile-id-or-alias>",
 		Short: "Show details for a saved profile",
+		Long:  "Show details for a saved profile. With --render, print what a target would generate from the profile's modules instead; nothing is written to any project.",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			meta, path, err := profilesvc.ResolveIDOrAlias(args[0])
+			meta, path, err := profilesvc.ResolveSelector(args[0])
 			if err != nil {
 				return err
 			}
+			if renderTarget != "" {
+				files, err := renderProfile(meta, path, renderTarget)
+				if err != nil {
+					return err
+				}
+				if a.jsonMode {
+					return a.renderer.RenderJSON("profile.show", profileRenderOutput{ProfileID: meta.ID, Target: renderTarget, Files: files})
+				}
+				w := cmd.OutOrStdout()
+				if len(files) == 1 {
+					_, err := fmt.Fprint(w, files[0].Content)
+					return err
+				}
+				for i, f := range files {
+					if i > 0 {
+						fmt.Fprintln(w)
+					}
+					if _, err := fmt.Fprintf(w, "==> %s <==\n%s", f.Path, f.Content); err != nil {
+						return err
+					}
+				}
+				return nil
+			}
 			out := profileShowOutput{Profile: meta, Path: path}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("profile.show", out)
@@ -251,7 +485,9 @@ func (a *app) newProfileShowCmd() *cobra.Command {
 			rows := [][]string{
 				{"id", meta.ID},
 				{"alias", meta.Alias},
+				{"store", meta.Scope},
 				{"sources", profileSourceSummary(meta)},
+				{"exports", strings.Join(meta.ExportNames(), ", ")},
 				{"createdAt", meta.CreatedAt},
 				{"contentHash", shortSHA(meta.ContentHash)},
 				{"moduleCount", strconv.Itoa(meta.ModuleCount)},
@@ -266,9 +502,57 @@ func (a *app) newProfileShowCmd() *cobra.Command {
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&renderTarget, "render", "", "print the files this target would generate from the profile (cursor|copilot|codex|claude|amazonq|cline|zed|junie)")
 	return cmd
 }
 
+// renderProfile renders a profile's modules with the default settings for
+// kind into a temporary directory and returns the generated files, so no
+// project is read or written.
+func renderProfile(meta profilesvc.Metadata, profileDir, kind string) ([]renderedFile, error) {
+	if !slices.Contains(config.TargetKinds, kind) {
+		return nil, fmt.Errorf("unknown --render target %q: use one of %s", kind, strings.Join(config.TargetKinds, ", "))
+	}
+	if kind == "custom" {
+		return nil, fmt.Errorf("--render does not support custom targets, which need a template; use rulepack build --stdout")
+	}
+	dep := profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID})
+	modules, _, err := profilesvc.Expand(profileDir, dep, pack.Options{})
+	if err != nil {
+		return nil, err
+	}
+	modules = build.FilterPlatform(modules, runtime.GOOS, runtime.GOARCH)
+	build.Sort(modules)
+
+	stage, err := os.MkdirTemp("", "rulepack-render-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+	entry := config.DefaultRuleset("").Targets[kind]
+	entry.Root = stage
+	if err := writeTarget(kind, entry, modules); err != nil {
+		return nil, err
+	}
+	files := make([]renderedFile, 0)
+	err = filepath.WalkDir(stage, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(stage, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, renderedFile{Path: filepath.ToSlash(rel), Content: string(content)})
+		return nil
+	})
+	return files, err
+}
+
 func (a *app) newProfileRemoveCmd() *cobra.Command {
 	var yes bool
 	var removeAll bool
@@ -362,25 +646,30 @@ func (a *app) newProfileRemoveCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().BoolVar(&yes, "yes", false, "confirm deletion without prompting")
-	cmd.Flags().BoolVar(&removeAll, "all", false, "remove all saved profiles")
+	cmd.Flags().BoolVar(&removeAll, "all", false, "remove all profiles in the global store (project profiles are kept)")
 	return cmd
 }
 
 func (a *app) newProfileUseCmd() *cobra.Command {
+	var export string
 	cmd := &cobra.Command{
 		Use:   "use <profile-id-or-alias>",
 		Short: "Add/update dependency to use a saved global profile",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			meta, _, err := profilesvc.ResolveIDOrAlias(args[0])
+			meta, _, err := profilesvc.ResolveSelector(args[0])
 			if err != nil {
 				return err
 			}
-			cfg, err := config.LoadRuleset(config.RulesetFileName)
+			export = normalizeExportName(export)
+			if names := meta.ExportNames(); !slices.Contains(names, export) {
+				return fmt.Errorf("profile %s has no export %q%s (available: %s)", meta.ID, export, selector.Hint(selector.Suggest(export, names)), strings.Join(names, ", "))
+			}
+			cfg, err := config.LoadRuleset(rulesetFile)
 			if err != nil {
 				return err
 			}
-			dep := config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"}
+			dep := config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: export}
 			action := "added"
 			updated := false
 			for i := range cfg.Dependencies {
@@ -394,45 +683,50 @@ func (a *app) newProfileUseCmd() *cobra.Command {
 			if !updated {
 				cfg.Dependencies = append(cfg.Dependencies, dep)
 			}
-			if err := config.SaveRuleset(config.RulesetFileName, cfg); err != nil {
+			if err := a.snapshotProject("profile use"); err != nil {
+				return err
+			}
+			if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
 				return err
 			}
-			out := profileUseOutput{ProfileID: meta.ID, Action: action, RulesetFile: config.RulesetFileName}
+			out := profileUseOutput{ProfileID: meta.ID, Export: export, Action: action, RulesetFile: rulesetFile}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("profile.use", out)
 			}
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "profile.use",
 				Title:   "Profile Applied",
-				Events:  []cliout.Event{{Level: "info", Message: "Action: " + action}, {Level: "info", Message: "Profile: " + meta.ID}},
-				Done:    "Updated " + config.RulesetFileName,
+				Events:  []cliout.Event{{Level: "info", Message: "Action: " + action}, {Level: "info", Message: "Profile: " + meta.ID}, {Level: "info", Message: "Export: " + export}},
+				Done:    "Updated " + rulesetFile,
 			})
 			return nil
 		},
 	}
+	cmd.Flags().StringVar(&export, "export", "default", "profile export to consume (see profile show)")
 	return cmd
 }
 
 func (a *app) newProfileDiffCmd() *cobra.Command {
 	var rules []string
+	var content bool
 	cmd := &cobra.Command{
 		Use:   "diff <profile-id-or-alias>",
 		Short: "Compare a saved profile snapshot with its current source",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			meta, profileDir, err := profilesvc.ResolveIDOrAlias(args[0])
+			meta, profileDir, err := profilesvc.ResolveSelector(args[0])
 			if err != nil {
 				return err
 			}
-			gc, err := git.NewClient()
+			gc, err := newGitClient()
 			if err != nil {
 				return err
 			}
-			currentModules, _, err := pack.ExpandProfileDependency(profileDir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"}), profilesvc.ProfileCommit)
+			currentModules, _, err := profilesvc.Expand(profileDir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"}), pack.Options{})
 			if err != nil {
 				return err
 			}
-			freshModules, refreshedSources, skippedSources, err := resolveFreshModulesForProfile(gc, meta, currentModules)
+			freshModules, refreshedSources, skippedSources, err := resolveFreshModulesForProfile(gc, meta, currentModules, nil)
 			if err != nil {
 				return err
 			}
@@ -442,17 +736,26 @@ func (a *app) newProfileDiffCmd() *cobra.Command {
 			}
 
 			changed, added, removed := diffModules(currentModules, freshModules)
+			renamed, removed, added := detectRenames(currentModules, freshModules, removed, added)
 			currentHash := profilesvc.ComputeContentHash(currentModules, "default")
 			freshHash := profilesvc.ComputeContentHash(freshModules, "default")
 			out := newProfileDiffOutput(meta.ID, "combined", profileSourceSummary(meta), currentHash, freshHash, changed, added, removed, refreshedSources, skippedSources, rules)
+			out.RenamedModules = renamed
+			out.EditedModules = editedSnapshotModules(meta, currentModules, rules)
+			if content {
+				out.ContentDiffs = moduleContentDiffs(currentModules, freshModules, out)
+			}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("profile.diff", out)
 			}
 
-			diffRows := make([][]string, 0, len(changed)+len(added)+len(removed))
+			diffRows := make([][]string, 0, len(changed)+len(added)+len(removed)+len(renamed))
 			for _, id := range changed {
 				diffRows = append(diffRows, []string{"changed", id})
 			}
+			for _, r := range renamed {
+				diffRows = append(diffRows, []string{"renamed", r.From + " -> " + r.To})
+			}
 			for _, id := range added {
 				diffRows = append(diffRows, []string{"added", id})
 			}
@@ -463,6 +766,9 @@ func (a *app) newProfileDiffCmd() *cobra.Command {
 			if len(rules) > 0 {
 				events = append(events, cliout.Event{Level: "info", Message: "Filtered by selectors: " + strings.Join(rules, ", ")})
 			}
+			if len(out.EditedModules) > 0 {
+				events = append(events, cliout.Event{Level: "warn", Message: "Snapshot modules edited since save: " + strings.Join(out.EditedModules, ", ")})
+			}
 			if len(skippedSources) > 0 {
 				for _, s := range skippedSources {
 					events = append(events, cliout.Event{Level: "warn", Message: "Skipped source " + s.Source + ": " + s.Reason})
@@ -476,6 +782,7 @@ func (a *app) newProfileDiffCmd() *cobra.Command {
 				Title:   "Profile Diff",
 				Events:  events,
 				Tables:  []cliout.Table{{Title: "Module Changes", Columns: []string{"Type", "Module ID"}, Rows: diffRows}},
+				Diffs:   out.ContentDiffs,
 				Summary: map[string]string{
 					"profile":     meta.ID,
 					"source":      profileSourceSummary(meta),
@@ -488,6 +795,164 @@ func (a *app) newProfileDiffCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().StringArrayVar(&rules, "rule", nil, "diff only specific module IDs/patterns")
+	cmd.Flags().BoolVar(&content, "content", false, "also show the content of each differing module as a diff")
+	return cmd
+}
+
+// moduleContentDiffs pairs the snapshot and source content of every module
+// out reports as changed, renamed, added, or removed, in that order.
+func moduleContentDiffs(current, fresh []pack.Module, out profileDiffOutput) []cliout.Diff {
+	currentByID := make(map[string]string, len(current))
+	for _, m := range current {
+		currentByID[m.ID] = m.Content
+	}
+	freshByID := make(map[string]string, len(fresh))
+	for _, m := range fresh {
+		freshByID[m.ID] = m.Content
+	}
+	diffs := make([]cliout.Diff, 0, len(out.ChangedModules)+len(out.RenamedModules)+len(out.AddedModules)+len(out.RemovedModules))
+	for _, id := range out.ChangedModules {
+		diffs = append(diffs, cliout.Diff{Title: id, Before: currentByID[id], After: freshByID[id]})
+	}
+	for _, r := range out.RenamedModules {
+		diffs = append(diffs, cliout.Diff{Title: r.From + " -> " + r.To, Before: currentByID[r.From], After: freshByID[r.To]})
+	}
+	for _, id := range out.AddedModules {
+		diffs = append(diffs, cliout.Diff{Title: id + " (added)", After: freshByID[id]})
+	}
+	for _, id := range out.RemovedModules {
+		diffs = append(diffs, cliout.Diff{Title: id + " (removed)", Before: currentByID[id]})
+	}
+	return diffs
+}
+
+// editedSnapshotModules lists snapshot modules whose content no longer
+// matches the digest recorded when the profile was saved, limited to rules
+// when given. Profiles without digests report none.
+func editedSnapshotModules(meta profilesvc.Metadata, modules []pack.Module, rules []string) []string {
+	if len(meta.ModuleDigests) == 0 {
+		return nil
+	}
+	changed, added, removed := meta.DigestDiff(modules)
+	edited := make([]string, 0, len(changed)+len(added)+len(removed))
+	for _, id := range slices.Concat(changed, added, removed) {
+		if len(rules) == 0 || moduleMatchesAny(id, rules) {
+			edited = append(edited, id)
+		}
+	}
+	buildSortStrings(edited)
+	return edited
+}
+
+func (a *app) newProfileVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <profile-id-or-alias>",
+		Short: "Check a saved profile's snapshot against the module digests recorded at save",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			meta, profileDir, err := profilesvc.ResolveSelector(args[0])
+			if err != nil {
+				return err
+			}
+			if len(meta.ModuleDigests) == 0 {
+				return fmt.Errorf("profile %s has no module digests; run rulepack profile refresh %s to record them", meta.ID, meta.ID)
+			}
+			modules, _, err := profilesvc.Expand(profileDir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID}), pack.Options{})
+			if err != nil {
+				return err
+			}
+			changed, added, removed := meta.DigestDiff(modules)
+			out := profileVerifyOutput{
+				ProfileID:      meta.ID,
+				Verified:       len(changed)+len(added)+len(removed) == 0,
+				ModuleCount:    len(modules),
+				ChangedModules: changed,
+				AddedModules:   added,
+				RemovedModules: removed,
+			}
+			if a.jsonMode {
+				if err := a.renderer.RenderJSON("profile.verify", out); err != nil {
+					return err
+				}
+			} else {
+				rows := make([][]string, 0, len(changed)+len(added)+len(removed))
+				for _, id := range changed {
+					rows = append(rows, []string{"changed", id})
+				}
+				for _, id := range added {
+					rows = append(rows, []string{"added", id})
+				}
+				for _, id := range removed {
+					rows = append(rows, []string{"removed", id})
+				}
+				events := []cliout.Event{}
+				if out.Verified {
+					events = append(events, cliout.Event{Level: "info", Message: "All modules match their recorded digests"})
+				}
+				a.renderer.RenderHuman(cliout.HumanPayload{
+					Command: "profile.verify",
+					Title:   "Profile Verify",
+					Events:  events,
+					Tables:  []cliout.Table{{Title: "Module Mismatches", Columns: []string{"Type", "Module ID"}, Rows: rows}},
+					Summary: map[string]string{
+						"profile":     meta.ID,
+						"moduleCount": strconv.Itoa(len(modules)),
+						"mismatches":  strconv.Itoa(len(rows)),
+					},
+					Done: "Profile verify complete",
+				})
+			}
+			if !out.Verified {
+				return fmt.Errorf("profile %s snapshot differs from its recorded digests: %s", meta.ID, strings.Join(slices.Concat(changed, added, removed), ", "))
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func (a *app) newProfileDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Report profile store entries that cannot be read and why",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			profiles, err := profilesvc.List()
+			if err != nil {
+				return err
+			}
+			unreadable, err := profilesvc.ListUnreadable()
+			if err != nil {
+				return err
+			}
+			out := profileDoctorOutput{ProfileCount: len(profiles), Unreadable: unreadable}
+			if a.jsonMode {
+				return a.renderer.RenderJSON("profile.doctor", out)
+			}
+			rows := make([][]string, 0, len(unreadable))
+			for _, u := range unreadable {
+				rows = append(rows, []string{u.ID, u.Scope, u.Reason, u.Path})
+			}
+			events := []cliout.Event{}
+			if len(unreadable) == 0 {
+				events = append(events, cliout.Event{Level: "info", Message: "Every profile store entry is readable"})
+			} else {
+				events = append(events, cliout.Event{Level: "warn", Message: fmt.Sprintf("%d profile(s) are skipped by every profile command until fixed or removed", len(unreadable))})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "profile.doctor",
+				Title:   "Profile Doctor",
+				Events:  events,
+				Tables:  []cliout.Table{{Title: "Unreadable Profiles", Columns: []string{"ID", "Store", "Reason", "Path"}, Rows: rows}},
+				Summary: map[string]string{
+					"profiles":   strconv.Itoa(len(profiles)),
+					"unreadable": strconv.Itoa(len(unreadable)),
+				},
+				Done: "Profile doctor complete",
+			})
+			return nil
+		},
+	}
 	return cmd
 }
 
@@ -496,24 +961,43 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 	var rules []string
 	var dryRun bool
 	var yes bool
+	var plan bool
+	var due bool
+	var sources []string
 	cmd := &cobra.Command{
 		Use:   "refresh <profile-id-or-alias>",
 		Short: "Refresh a saved profile from its original source",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			meta, profileDir, err := profilesvc.ResolveIDOrAlias(args[0])
+			if due {
+				if len(args) > 0 {
+					return errors.New("profile refresh --due takes no profile argument")
+				}
+				if newID || plan || len(rules) > 0 || len(sources) > 0 {
+					return errors.New("profile refresh --due cannot be combined with --new-id, --plan, --rule, or --source")
+				}
+				return a.refreshDueProfiles(cmd, dryRun, yes)
+			}
+			if len(args) != 1 {
+				return errors.New("profile refresh requires a profile ID or alias, or --due")
+			}
+			meta, profileDir, err := profilesvc.ResolveSelector(args[0])
 			if err != nil {
 				return err
 			}
-			gc, err := git.NewClient()
+			gc, err := newGitClient()
 			if err != nil {
 				return err
 			}
-			oldModules, _, err := pack.ExpandProfileDependency(profileDir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"}), profilesvc.ProfileCommit)
+			oldModules, _, err := profilesvc.Expand(profileDir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"}), pack.Options{})
 			if err != nil {
 				return err
 			}
-			freshModules, refreshedSources, skippedSources, err := resolveFreshModulesForProfile(gc, meta, oldModules)
+			only, sourceLabels, err := selectProfileSources(meta, sources)
+			if err != nil {
+				return err
+			}
+			freshModules, refreshedSources, skippedSources, err := resolveFreshModulesForProfile(gc, meta, oldModules, only)
 			if err != nil {
 				return err
 			}
@@ -522,6 +1006,11 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			edits, err := profilesvc.MergeLocalEdits(meta, oldModules, mergedModules)
+			if err != nil {
+				return err
+			}
+			mergedModules = edits.Modules
 			changedModules, addedModules, removedModules := diffModules(oldModules, mergedModules)
 			inPlaceWithDiff := !newID && !dryRun && (len(changedModules)+len(addedModules)+len(removedModules) > 0)
 			preview := make([]string, 0, len(changedModules)+len(addedModules)+len(removedModules))
@@ -534,12 +1023,32 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 			for _, id := range removedModules {
 				preview = append(preview, "removed: "+id)
 			}
+			riskMessage := fmt.Sprintf("profile refresh would update profile %q in place with module diffs", meta.ID)
+			if plan {
+				actions := make([]planAction, 0, len(preview)+1)
+				for _, id := range changedModules {
+					actions = append(actions, planAction{Action: "update", Kind: "module", Target: id})
+				}
+				for _, id := range addedModules {
+					actions = append(actions, planAction{Action: "create", Kind: "module", Target: id})
+				}
+				for _, id := range removedModules {
+					actions = append(actions, planAction{Action: "delete", Kind: "module", Target: id})
+				}
+				switch {
+				case newID:
+					actions = append(actions, planAction{Action: "create", Kind: "profile", Target: "new profile ID", Detail: "copy of " + meta.ID})
+				case len(actions) > 0:
+					actions = append(actions, planAction{Action: "update", Kind: "profile", Target: meta.ID})
+				}
+				return a.renderPlan(planOutput{Command: "profile.refresh", Actions: actions, Risks: newPlanRisk(!newID && len(preview) > 0, riskMessage, preview)})
+			}
 			if err := confirmRiskAction(
 				cmd,
 				a.jsonMode,
 				yes,
 				inPlaceWithDiff,
-				fmt.Sprintf("profile refresh would update profile %q in place with module diffs", meta.ID),
+				riskMessage,
 				fmt.Sprintf("Refresh profile %q in place with %d module change(s)?", meta.ID, len(preview)),
 				preview,
 				"profile refresh",
@@ -561,11 +1070,16 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 			} else {
 				alias := meta.Alias
 				saved, err = profilesvc.SaveSnapshot(profilesvc.SaveInput{
-					ID:          saveID,
-					Alias:       alias,
-					Sources:     meta.Sources,
-					ContentHash: newHash,
-					Modules:     mergedModules,
+					ID:           saveID,
+					Alias:        alias,
+					Sources:      meta.Sources,
+					ContentHash:  newHash,
+					Modules:      mergedModules,
+					Exports:      meta.Exports,
+					Scope:        meta.Scope,
+					RefreshEvery: meta.RefreshEvery,
+					EditBases:    edits.EditBases,
+					Conflicts:    edits.Conflicts,
 				})
 				if err != nil {
 					return err
@@ -573,17 +1087,20 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 			}
 
 			out := profileRefreshOutput{
-				OldProfileID:     meta.ID,
-				NewProfileID:     saved.ID,
-				RefreshedRule:    refreshedIDs,
-				Source:           profileSourceSummary(meta),
-				InPlace:          !newID,
-				DryRun:           dryRun,
-				RefreshedSources: refreshedSources,
-				SkippedSources:   skippedSources,
-				ChangedModules:   changedModules,
-				AddedModules:     addedModules,
-				RemovedModules:   removedModules,
+				OldProfileID:      meta.ID,
+				NewProfileID:      saved.ID,
+				RefreshedRule:     refreshedIDs,
+				Source:            profileSourceSummary(meta),
+				SelectedSources:   sourceLabels,
+				InPlace:           !newID,
+				DryRun:            dryRun,
+				RefreshedSources:  refreshedSources,
+				SkippedSources:    skippedSources,
+				ChangedModules:    changedModules,
+				AddedModules:      addedModules,
+				RemovedModules:    removedModules,
+				MergedModules:     edits.Merged,
+				ConflictedModules: edits.Conflicts,
 			}
 			if a.jsonMode {
 				return a.renderer.RenderJSON("profile.refresh", out)
@@ -604,10 +1121,15 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 				}
 				tables = append(tables, cliout.Table{Title: "Skipped Sources", Columns: []string{"Source", "Reason"}, Rows: skipRows})
 			}
+			events := []cliout.Event{{Level: "info", Message: dryRunMessage(dryRun)}}
+			if len(sourceLabels) > 0 {
+				events = append(events, cliout.Event{Level: "info", Message: "Refreshed only sources: " + strings.Join(sourceLabels, ", ")})
+			}
+			events = append(events, localEditEvents(out)...)
 			a.renderer.RenderHuman(cliout.HumanPayload{
 				Command: "profile.refresh",
 				Title:   "Profile Refreshed",
-				Events:  []cliout.Event{{Level: "info", Message: dryRunMessage(dryRun)}},
+				Events:  events,
 				Tables:  tables,
 				Done:    "Profile refresh complete",
 			})
@@ -616,11 +1138,237 @@ func (a *app) newProfileRefreshCmd() *cobra.Command {
 	}
 	cmd.Flags().BoolVar(&newID, "new-id", false, "create a new profile ID instead of updating in place")
 	cmd.Flags().StringArrayVar(&rules, "rule", nil, "refresh only specific module IDs/patterns")
+	cmd.Flags().StringArrayVar(&sources, "source", nil, "refresh only this source of a combined profile, by 1-based index or ref (repeatable); other sources keep their snapshot")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "preview refresh result without writing profile files")
 	cmd.Flags().BoolVar(&yes, "yes", false, "confirm risky in-place refresh without prompting")
+	cmd.Flags().BoolVar(&plan, "plan", false, "report the module and profile changes without applying them")
+	cmd.Flags().BoolVar(&due, "due", false, "refresh in place every profile whose refreshEvery interval has passed")
 	return cmd
 }
 
+// selectProfileSources resolves profile refresh --source selectors to source
+// indexes and their labels. It returns a nil set when no selector is given,
+// meaning every source.
+func selectProfileSources(meta profilesvc.Metadata, refs []string) (map[int]bool, []string, error) {
+	if len(refs) == 0 {
+		return nil, nil, nil
+	}
+	only := map[int]bool{}
+	labels := []string{}
+	for _, ref := range refs {
+		idx, err := findProfileSourceIndex(meta, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		if only[idx] {
+			continue
+		}
+		only[idx] = true
+		labels = append(labels, sourceStatusLabel(meta.Sources[idx].SourceType, meta.Sources[idx].SourceRef))
+	}
+	return only, labels, nil
+}
+
+// findProfileSourceIndex resolves a 1-based index or a source ref (exact, or
+// a unique prefix) to an index into meta.Sources.
+func findProfileSourceIndex(meta profilesvc.Metadata, ref string) (int, error) {
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n >= 1 && n <= len(meta.Sources) {
+			return n - 1, nil
+		}
+		return -1, fmt.Errorf("profile %s source index %d out of range (1-%d)", meta.ID, n, len(meta.Sources))
+	}
+	refs := make([]string, len(meta.Sources))
+	candidates := make([][]string, len(meta.Sources))
+	for i, src := range meta.Sources {
+		refs[i] = src.SourceRef
+		candidates[i] = []string{src.SourceRef}
+	}
+	matches := selector.Match(ref, candidates)
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("profile %s has no source %q%s", meta.ID, ref, selector.Hint(selector.Suggest(ref, refs)))
+	case 1:
+		return matches[0], nil
+	default:
+		listed := make([]string, len(matches))
+		for i, idx := range matches {
+			listed[i] = fmt.Sprintf("#%d %s", idx+1, refs[idx])
+		}
+		return -1, fmt.Errorf("source selector %q matched multiple sources of profile %s: %s", ref, meta.ID, strings.Join(listed, ", "))
+	}
+}
+
+// refreshDueProfiles refreshes every overdue profile in place with all of
+// its rules, asking once before rewriting any that changed.
+func (a *app) refreshDueProfiles(cmd *cobra.Command, dryRun bool, yes bool) error {
+	all, err := profilesvc.List()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	pending := []inPlaceRefresh{}
+	preview := []string{}
+	var gc *git.Client
+	for _, meta := range all {
+		if !meta.RefreshDue(now) {
+			continue
+		}
+		if gc == nil {
+			if gc, err = newGitClient(); err != nil {
+				return err
+			}
+		}
+		p, err := planInPlaceRefresh(gc, meta, dryRun)
+		if err != nil {
+			return err
+		}
+		pending = append(pending, p)
+		preview = append(preview, p.preview()...)
+	}
+	if err := confirmRiskAction(
+		cmd,
+		a.jsonMode,
+		yes,
+		!dryRun && len(preview) > 0,
+		fmt.Sprintf("profile refresh --due would update %d profile(s) in place with module diffs", len(pending)),
+		fmt.Sprintf("Refresh %d due profile(s) in place with %d module change(s)?", len(pending), len(preview)),
+		preview,
+		"profile refresh",
+	); err != nil {
+		return err
+	}
+	out := profileRefreshDueOutput{DryRun: dryRun, Profiles: make([]profileRefreshOutput, 0, len(pending))}
+	for _, p := range pending {
+		if !dryRun {
+			if err := p.save(); err != nil {
+				return err
+			}
+		}
+		out.Profiles = append(out.Profiles, p.out)
+	}
+	if a.jsonMode {
+		return a.renderer.RenderJSON("profile.refresh", out)
+	}
+	rows := make([][]string, 0, len(out.Profiles))
+	for _, p := range out.Profiles {
+		rows = append(rows, []string{p.OldProfileID, strconv.Itoa(len(p.ChangedModules)), strconv.Itoa(len(p.AddedModules)), strconv.Itoa(len(p.RemovedModules)), strconv.Itoa(len(p.SkippedSources))})
+	}
+	events := []cliout.Event{{Level: "info", Message: dryRunMessage(dryRun)}}
+	if len(rows) == 0 {
+		events = append(events, cliout.Event{Level: "info", Message: "No profiles due for refresh"})
+	}
+	for _, p := range out.Profiles {
+		events = append(events, localEditEvents(p)...)
+	}
+	a.renderer.RenderHuman(cliout.HumanPayload{
+		Command: "profile.refresh",
+		Title:   "Due Profiles Refreshed",
+		Events:  events,
+		Tables:  []cliout.Table{{Title: "Refreshed Profiles", Columns: []string{"Profile", "Changed", "Added", "Removed", "Skipped Sources"}, Rows: rows}},
+		Summary: map[string]string{"refreshed": strconv.Itoa(len(rows))},
+		Done:    "Profile refresh complete",
+	})
+	return nil
+}
+
+// inPlaceRefresh is a profile re-resolved from its recorded sources but not
+// yet saved.
+type inPlaceRefresh struct {
+	meta   profilesvc.Metadata
+	merged []pack.Module
+	edits  profilesvc.RefreshMerge
+	out    profileRefreshOutput
+}
+
+// planInPlaceRefresh re-resolves every source of meta and merges the fresh
+// modules over the saved snapshot without writing anything.
+func planInPlaceRefresh(gc *git.Client, meta profilesvc.Metadata, dryRun bool) (inPlaceRefresh, error) {
+	_, profileDir, err := profilesvc.ResolveIDOrAlias(meta.ID)
+	if err != nil {
+		return inPlaceRefresh{}, err
+	}
+	oldModules, _, err := profilesvc.Expand(profileDir, profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"}), pack.Options{})
+	if err != nil {
+		return inPlaceRefresh{}, fmt.Errorf("profile %s: %w", meta.ID, err)
+	}
+	freshModules, refreshedSources, skippedSources, err := resolveFreshModulesForProfile(gc, meta, oldModules, nil)
+	if err != nil {
+		return inPlaceRefresh{}, fmt.Errorf("profile %s: %w", meta.ID, err)
+	}
+	merged, refreshedIDs, err := mergeRefreshedModules(oldModules, freshModules, nil)
+	if err != nil {
+		return inPlaceRefresh{}, fmt.Errorf("profile %s: %w", meta.ID, err)
+	}
+	edits, err := profilesvc.MergeLocalEdits(meta, oldModules, merged)
+	if err != nil {
+		return inPlaceRefresh{}, fmt.Errorf("profile %s: %w", meta.ID, err)
+	}
+	merged = edits.Modules
+	changed, added, removed := diffModules(oldModules, merged)
+	return inPlaceRefresh{meta: meta, merged: merged, edits: edits, out: profileRefreshOutput{
+		OldProfileID:      meta.ID,
+		NewProfileID:      meta.ID,
+		RefreshedRule:     refreshedIDs,
+		Source:            profileSourceSummary(meta),
+		InPlace:           true,
+		DryRun:            dryRun,
+		RefreshedSources:  refreshedSources,
+		SkippedSources:    skippedSources,
+		ChangedModules:    changed,
+		AddedModules:      added,
+		RemovedModules:    removed,
+		MergedModules:     edits.Merged,
+		ConflictedModules: edits.Conflicts,
+	}}, nil
+}
+
+// preview lists the module changes of p for a confirmation prompt.
+func (p inPlaceRefresh) preview() []string {
+	lines := []string{}
+	for _, id := range p.out.ChangedModules {
+		lines = append(lines, p.meta.ID+": changed: "+id)
+	}
+	for _, id := range p.out.AddedModules {
+		lines = append(lines, p.meta.ID+": added: "+id)
+	}
+	for _, id := range p.out.RemovedModules {
+		lines = append(lines, p.meta.ID+": removed: "+id)
+	}
+	return lines
+}
+
+// save writes the refreshed snapshot over the profile, keeping its ID.
+func (p inPlaceRefresh) save() error {
+	if _, err := profilesvc.SaveSnapshot(profilesvc.SaveInput{
+		ID:           p.meta.ID,
+		Alias:        p.meta.Alias,
+		Sources:      p.meta.Sources,
+		ContentHash:  profilesvc.ComputeContentHash(p.merged, "default"),
+		Modules:      p.merged,
+		Exports:      p.meta.Exports,
+		Scope:        p.meta.Scope,
+		RefreshEvery: p.meta.RefreshEvery,
+		EditBases:    p.edits.EditBases,
+		Conflicts:    p.edits.Conflicts,
+	}); err != nil {
+		return fmt.Errorf("profile %s: %w", p.meta.ID, err)
+	}
+	return nil
+}
+
+// localEditEvents reports how a refresh treated a profile's local edits.
+func localEditEvents(out profileRefreshOutput) []cliout.Event {
+	events := []cliout.Event{}
+	if len(out.MergedModules) > 0 {
+		events = append(events, cliout.Event{Level: "info", Message: out.OldProfileID + ": merged source changes into local edits of " + strings.Join(out.MergedModules, ", ")})
+	}
+	if len(out.ConflictedModules) > 0 {
+		events = append(events, cliout.Event{Level: "warn", Message: out.OldProfileID + ": local edits conflict with the source in " + strings.Join(out.ConflictedModules, ", ") + "; resolve the conflict markers before installing"})
+	}
+	return events
+}
+
 func profileSourceSummary(meta profilesvc.Metadata) string {
 	if len(meta.Sources) == 1 {
 		s := meta.Sources[0]
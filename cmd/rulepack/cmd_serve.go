@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// serveMethods maps RPC methods to the command line they run. Request args
+// are appended, so "modules" with ["--target", "cursor"] runs
+// rulepack effective --target cursor.
+var serveMethods = map[string][]string{
+	"modules":  {"effective"},
+	"drift":    {"build", "--check"},
+	"outdated": {"deps", "outdated"},
+	"build":    {"build"},
+	"run":      {},
+}
+
+// JSON-RPC 2.0 error codes. Command failures use serveCommandFailed with the
+// command's JSON output, if it rendered any, as error data.
+const (
+	serveParseError     = -32700
+	serveInvalidRequest = -32600
+	serveMethodNotFound = -32601
+	serveInvalidParams  = -32602
+	serveCommandFailed  = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+type serveParams struct {
+	Args []string `json:"args"`
+}
+
+func (a *app) newServeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Answer JSON-RPC requests on stdin/stdout for editor integrations",
+		Long: "Run until stdin closes or a shutdown request arrives, reading JSON-RPC 2.0 requests framed with Content-Length headers as in the Language Server Protocol. " +
+			"Methods modules (effective), drift (build --check), outdated (deps outdated), and build run the matching command in process with params.args appended; run takes the whole command line in params.args. " +
+			"Each result is the command's --json envelope. Commands run one at a time in the current directory and never prompt, so risky actions need --yes in args.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			in := bufio.NewReader(cmd.InOrStdin())
+			out := cmd.OutOrStdout()
+			for {
+				body, err := readRPCMessage(in)
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				resp, shutdown := a.serveRequest(cmd, body)
+				if resp != nil {
+					if err := writeRPCMessage(out, resp); err != nil {
+						return err
+					}
+				}
+				if shutdown {
+					return nil
+				}
+			}
+		},
+	}
+	return cmd
+}
+
+// serveRequest answers one message. Notifications, which have no id, get no
+// response.
+func (a *app) serveRequest(cmd *cobra.Command, body []byte) (*rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return rpcFailure(json.RawMessage("null"), serveParseError, "parse error: "+err.Error(), nil), false
+	}
+	id := req.ID
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(id, serveInvalidRequest, `invalid request: need jsonrpc "2.0" and a method`, nil), false
+	}
+	notification := len(req.ID) == 0
+	if req.Method == "shutdown" {
+		if notification {
+			return nil, true
+		}
+		return &rpcResponse{JSONRPC: "2.0", ID: id, Result: json.RawMessage("null")}, true
+	}
+	prefix, ok := serveMethods[req.Method]
+	if !ok {
+		return rpcFailure(id, serveMethodNotFound, fmt.Sprintf("unknown method %q", req.Method), nil), false
+	}
+	var params serveParams
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return rpcFailure(id, serveInvalidParams, "invalid params: "+err.Error(), nil), false
+		}
+	}
+	cmdline := append(slices.Clone(prefix), params.Args...)
+	if len(cmdline) == 0 || cmdline[0] == "serve" {
+		return rpcFailure(id, serveInvalidParams, "invalid params: args must name a command other than serve", nil), false
+	}
+	result, err := a.runInProcess(cmd, cmdline)
+	if notification {
+		return nil, false
+	}
+	if err != nil {
+		return rpcFailure(id, serveCommandFailed, err.Error(), result), false
+	}
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Result: result}, false
+}
+
+// runInProcess runs one rulepack command line with --json and returns the
+// envelope it rendered, which a failing command may still have done.
+func (a *app) runInProcess(cmd *cobra.Command, cmdline []string) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	sub := &app{out: &buf}
+	args := []string{"--json"}
+	if a.schemaVersion != 0 {
+		args = append(args, "--schema-version", strconv.Itoa(a.schemaVersion))
+	}
+	args = append(args, cmdline...)
+	root := sub.newRootCmd(args)
+	root.SetContext(cmd.Context())
+	root.SetIn(strings.NewReader(""))
+	root.SetOut(io.Discard)
+	root.SetErr(io.Discard)
+	runErr := root.Execute()
+	if runErr != nil {
+		_ = sub.recordAudit(runErr)
+	}
+	var result json.RawMessage
+	if trimmed := bytes.TrimSpace(buf.Bytes()); json.Valid(trimmed) && len(trimmed) > 0 {
+		result = trimmed
+	}
+	return result, runErr
+}
+
+func rpcFailure(id json.RawMessage, code int, message string, data json.RawMessage) *rpcResponse {
+	return &rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message, Data: data}}
+}
+
+// readRPCMessage reads one Content-Length framed message body. io.EOF means
+// the client closed the stream between messages.
+func readRPCMessage(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	started := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && !started && line == "" {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("read message header: %w", err)
+		}
+		started = true
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid message header %q", line)
+		}
+		if strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			n, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid Content-Length %q", strings.TrimSpace(value))
+			}
+			length = n
+		}
+	}
+	if length < 0 {
+		return nil, errors.New("message has no Content-Length header")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, fmt.Errorf("read message body: %w", err)
+	}
+	return body, nil
+}
+
+func writeRPCMessage(w io.Writer, resp *rpcResponse) error {
+	body, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
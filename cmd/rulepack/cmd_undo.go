@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/cliout"
+	"rulepack/internal/config"
+	"rulepack/internal/history"
+)
+
+// projectFiles are the files mutating commands snapshot for undo and hash in
+// the audit log.
+func projectFiles() []string {
+	return append([]string{rulesetFile, lockFile, outputsFile}, config.OverrideFiles(rulesetFile)...)
+}
+
+// snapshotProject records the project files a mutating command may change so
+// rulepack undo can restore them, and marks the run for the audit log. Call it
+// just before the first write.
+func (a *app) snapshotProject(command string) error {
+	if _, err := history.Snapshot(command, projectFiles()); err != nil {
+		return err
+	}
+	a.mutation = command
+	return nil
+}
+
+// recordAudit appends the mutating command of this run, if any, to the audit
+// log. runErr is recorded when the command failed after it started writing.
+func (a *app) recordAudit(runErr error) error {
+	if a.mutation == "" {
+		return nil
+	}
+	entry := history.AuditEntry{Command: a.mutation, Args: a.args}
+	if runErr != nil {
+		entry.Error = runErr.Error()
+	}
+	a.mutation = ""
+	return history.Audit(entry, projectFiles())
+}
+
+func (a *app) newUndoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "undo",
+		Short: "Restore rulepack.json, the lockfile, and the outputs manifest from before the last mutating command",
+		Long:  "Restore rulepack.json, rulepack.lock.json, " + config.OutputsFileName + ", and the overrides files from the newest snapshot in " + history.Dir + ". Generated outputs are not restored; run rulepack build afterwards.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			entry, err := history.Undo()
+			if errors.Is(err, history.ErrEmpty) {
+				return errors.New("nothing to undo")
+			}
+			if err != nil {
+				return err
+			}
+			a.mutation = "undo"
+			out := undoOutput{Command: entry.Command, CreatedAt: entry.CreatedAt, Restored: []string{}, Removed: []string{}}
+			for file, existed := range entry.Files {
+				if existed {
+					out.Restored = append(out.Restored, file)
+				} else {
+					out.Removed = append(out.Removed, file)
+				}
+			}
+			sort.Strings(out.Restored)
+			sort.Strings(out.Removed)
+			if a.jsonMode {
+				return a.renderer.RenderJSON("undo", out)
+			}
+			rows := make([][]string, 0, len(entry.Files))
+			for _, file := range out.Restored {
+				rows = append(rows, []string{file, "restored"})
+			}
+			for _, file := range out.Removed {
+				rows = append(rows, []string{file, "removed"})
+			}
+			a.renderer.RenderHuman(cliout.HumanPayload{
+				Command: "undo",
+				Title:   "Undo",
+				Events:  []cliout.Event{{Level: "info", Message: "Undid " + entry.Command + " from " + entry.CreatedAt}, {Level: "info", Message: "Run rulepack build to regenerate outputs"}},
+				Tables:  []cliout.Table{{Title: "Files", Columns: []string{"Path", "Result"}, Rows: rows}},
+				Done:    "Undo complete",
+			})
+			return nil
+		},
+	}
+	return cmd
+}
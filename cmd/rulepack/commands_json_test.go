@@ -1,19 +1,34 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"rulepack/internal/cliout"
 	"rulepack/internal/config"
 	"rulepack/internal/pack"
 	profilesvc "rulepack/internal/profile"
+	"rulepack/internal/render"
 )
 
 type jsonEnvelope struct {
@@ -68,20 +83,92 @@ func TestOutdatedCommandJSON(t *testing.T) {
 	}
 }
 
-func TestDepsListCommandJSON(t *testing.T) {
+func TestExportRemovedUpstreamReportedByOutdatedAndInstall(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	manifest := func(exports string) string {
+		return `{"specVersion":"0.1","name":"rules","version":"1.0.0","modules":[{"id":"python.base","path":"modules/python_base.md","priority":100}],"exports":{` + exports + `}}`
+	}
+	repo := createLocalSourcePackWithManifest(t, map[string]string{"modules/python_base.md": "Base\n"}, manifest(`"python":{"include":["python.*"]}`))
+	commit := func(message string) string {
+		t.Helper()
+		if _, err := runGit(repo, "add", "."); err != nil {
+			t.Fatalf("git add: %v", err)
+		}
+		if _, err := runGit(repo, "-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", message); err != nil {
+			t.Fatalf("git commit: %v", err)
+		}
+		sha, err := runGit(repo, "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatalf("rev-parse: %v", err)
+		}
+		return strings.TrimSpace(sha)
+	}
+	if _, err := runGit(repo, "init"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	oldCommit := commit("init")
+	if err := os.WriteFile(filepath.Join(repo, "rulepack.json"), []byte(manifest(`"py":{"include":["python.*"]},"core":{"include":["**"]}`)), 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	commit("rename python export")
+
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{SpecVersion: "0.1", Name: "proj", Dependencies: []config.Dependency{{Source: "git", URI: repo, Export: "python"}}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	lock := config.Lockfile{LockVersion: "0.1", Resolved: []config.LockedSource{{Source: "git", URI: repo, Commit: oldCommit, Export: "python"}}}
+	if err := config.SaveLockfile(filepath.Join(projectDir, config.LockFileName), lock); err != nil {
+		t.Fatalf("save lock: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env); err != nil {
+		t.Fatalf("outdated command failed: %v", err)
+	}
+	var out outdatedOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if len(out.Dependencies) != 1 || out.Dependencies[0].UpdateStatus != "export-removed" || !slices.Equal(out.Dependencies[0].AvailableExports, []string{"core", "py"}) || out.OutdatedCount != 1 {
+		t.Fatalf("expected export-removed with available exports, got %#v", out)
+	}
+
+	err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), `export "python" removed upstream`) || !strings.Contains(err.Error(), "available exports: core, py") {
+		t.Fatalf("expected export removed error from install, got %v", err)
+	}
+
+	cfg.Dependencies[0].ExportAliases = map[string]string{"python": "py"}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install with export alias failed: %v", err)
+	}
+}
+
+func TestOutdatedCommandJSON_FailWhenThresholds(t *testing.T) {
+	repoDir, oldCommit, newCommit, err := createGitRepoWithTwoCommits(t)
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	for tag, commit := range map[string]string{"v1.0.0": oldCommit, "v2.0.0": newCommit} {
+		if _, err := runGit(repoDir, "tag", tag, commit); err != nil {
+			t.Fatalf("tag %s: %v", tag, err)
+		}
+	}
+
 	projectDir := t.TempDir()
 	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "python"},
-		},
+		SpecVersion:  "0.1",
+		Name:         "proj",
+		Dependencies: []config.Dependency{{Source: "git", URI: repoDir, Version: "^1.0.0"}},
 	}
 	lock := config.Lockfile{
 		LockVersion: "0.1",
-		Resolved: []config.LockedSource{
-			{Source: "git", URI: "https://example.com/rules.git", Commit: "abcdef0123456789"},
-		},
+		Resolved:    []config.LockedSource{{Source: "git", URI: repoDir, Requested: "^1.0.0", ResolvedVersion: "1.0.0", Commit: oldCommit}},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
@@ -92,790 +179,4388 @@ func TestDepsListCommandJSON(t *testing.T) {
 
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsListCmd(), &env); err != nil {
-		t.Fatalf("deps list failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env, "--fail-when", "any"); err != nil {
+		t.Fatalf("expected no outdated dependency within the constraint, got %v", err)
 	}
-
-	var out depsListOutput
+	var out outdatedOutput
 	if err := json.Unmarshal(env.Result, &out); err != nil {
 		t.Fatalf("unmarshal result: %v", err)
 	}
-	if len(out.Dependencies) != 1 {
-		t.Fatalf("expected one dependency row, got %d", len(out.Dependencies))
+	if out.OutdatedCount != 0 || out.MajorCount != 1 || out.Dependencies[0].Newest != "2.0.0" || !out.Dependencies[0].MajorUpdate {
+		t.Fatalf("expected a major update outside the constraint, got %#v", out)
 	}
-	if out.Dependencies[0].Locked != "abcdef012345" {
-		t.Fatalf("unexpected locked reference: %s", out.Dependencies[0].Locked)
+
+	if err := runCmd(t, projectDir, a.newDepsOutdatedCmd(), "--fail-when", "count>0"); err != nil {
+		t.Fatalf("expected count>0 to pass, got %v", err)
+	}
+	err = runCmd(t, projectDir, a.newDepsOutdatedCmd(), "--fail-when", "major")
+	if err == nil || !strings.Contains(err.Error(), "1 with a major update") {
+		t.Fatalf("expected major threshold failure, got %v", err)
+	}
+	err = runCmd(t, projectDir, a.newDepsOutdatedCmd(), "--fail-when", "count>x")
+	if err == nil || !strings.Contains(err.Error(), "invalid --fail-when") {
+		t.Fatalf("expected invalid threshold error, got %v", err)
+	}
+
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+	human := &app{renderer: cliout.NewHumanRenderer(true)}
+	quietCmd := human.newDepsOutdatedCmd()
+	quietCmd.SetArgs([]string{"--quiet"})
+	text, err := captureStdout(quietCmd.Execute)
+	if err != nil {
+		t.Fatalf("quiet outdated failed: %v", err)
+	}
+	if strings.Contains(string(text), "Dependency Status") || !strings.Contains(string(text), "major: 1") {
+		t.Fatalf("expected summary-only output, got %q", text)
 	}
 }
 
-func TestBuildCommandJSON_RequiresYesOnCursorOverwriteCollision(t *testing.T) {
+func TestOutdatedCommandJSON_ReusesRecentResolutions(t *testing.T) {
+	repoDir, oldCommit, _, err := createGitRepoWithTwoCommits(t)
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
 	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
-	relSource, _ := filepath.Rel(projectDir, sourceDir)
-	cfg := config.DefaultRuleset("proj")
-	cfg.Dependencies = []config.Dependency{
-		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	cfg := config.Ruleset{
+		SpecVersion:  "0.1",
+		Name:         "proj",
+		Dependencies: []config.Dependency{{Source: "git", URI: repoDir}},
+	}
+	lock := config.Lockfile{
+		LockVersion: "0.1",
+		Resolved:    []config.LockedSource{{Source: "git", URI: repoDir, Commit: oldCommit}},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
+	if err := config.SaveLockfile(filepath.Join(projectDir, config.LockFileName), lock); err != nil {
+		t.Fatalf("save lock: %v", err)
+	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
-		t.Fatalf("install failed: %v", err)
+	check := func(args ...string) outdatedEntry {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env, args...); err != nil {
+			t.Fatalf("outdated command failed: %v", err)
+		}
+		var out outdatedOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("unmarshal result: %v", err)
+		}
+		if len(out.Dependencies) != 1 || out.Dependencies[0].UpdateStatus != "outdated" {
+			t.Fatalf("unexpected dependency status: %#v", out.Dependencies)
+		}
+		return out.Dependencies[0]
 	}
 
-	collision := filepath.Join(projectDir, ".cursor", "rules", "100-python_base.mdc")
-	if err := os.MkdirAll(filepath.Dir(collision), 0o755); err != nil {
-		t.Fatalf("mkdir collision dir: %v", err)
+	first := check()
+	if first.Cached {
+		t.Fatalf("expected first check to fetch")
 	}
-	if err := os.WriteFile(collision, []byte("manual rule\n"), 0o644); err != nil {
-		t.Fatalf("write collision file: %v", err)
+	// Without a fetch the cache is the only way to know the latest commit.
+	if err := os.RemoveAll(repoDir); err != nil {
+		t.Fatalf("remove repo: %v", err)
+	}
+	second := check()
+	if !second.Cached || second.Latest != first.Latest {
+		t.Fatalf("expected cached resolution %s, got %#v", first.Latest, second)
 	}
 
 	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env)
-	if err == nil {
-		t.Fatalf("expected build to fail without --yes on unmanaged overwrite collision")
-	}
-	if !strings.Contains(err.Error(), "rerun with --yes") {
-		t.Fatalf("unexpected build error: %v", err)
-	}
-	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--yes"); err != nil {
-		t.Fatalf("build failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env, "--no-cache"); err != nil {
+		t.Fatalf("outdated command failed: %v", err)
 	}
-	var out buildOutput
+	var out outdatedOutput
 	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal build output: %v", err)
-	}
-	if len(out.Warnings) != 1 {
-		t.Fatalf("expected one warning, got %#v", out.Warnings)
+		t.Fatalf("unmarshal result: %v", err)
 	}
-	if !strings.Contains(out.Warnings[0], ".cursor/rules/100-python_base.mdc") {
-		t.Fatalf("unexpected warning: %s", out.Warnings[0])
+	if out.Dependencies[0].Cached || out.Dependencies[0].UpdateStatus != "error" {
+		t.Fatalf("expected --no-cache to fetch the removed remote, got %#v", out.Dependencies[0])
 	}
 }
 
-func TestBuildCommandJSON_ClaudeTargetWritesPerModuleOutput(t *testing.T) {
+func TestOutdatedCommandJSON_TimeoutAndCancellationKeepPartialResults(t *testing.T) {
+	repoDir, oldCommit, _, err := createGitRepoWithTwoCommits(t)
+	if err != nil {
+		t.Fatalf("create repo: %v", err)
+	}
+	sourceDir := createLocalSourcePack(t, "base rule\n")
+
 	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
-	relSource, _ := filepath.Rel(projectDir, sourceDir)
-	cfg := config.DefaultRuleset("proj")
-	cfg.Dependencies = []config.Dependency{
-		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: repoDir},
+			{Source: "local", Path: sourceDir},
+		},
+	}
+	lock := config.Lockfile{
+		LockVersion: "0.1",
+		Resolved: []config.LockedSource{
+			{Source: "git", URI: repoDir, Commit: oldCommit},
+			{Source: "local", Path: sourceDir, Commit: "local"},
+		},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
-		t.Fatalf("install failed: %v", err)
+	if err := config.SaveLockfile(filepath.Join(projectDir, config.LockFileName), lock); err != nil {
+		t.Fatalf("save lock: %v", err)
 	}
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
 
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
-		t.Fatalf("build failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env, "--timeout", "1ns"); err != nil {
+		t.Fatalf("outdated command failed: %v", err)
+	}
+	var out outdatedOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if got := out.Dependencies[0]; got.UpdateStatus != "error" || !strings.Contains(got.Latest, "timed out after 1ns") {
+		t.Fatalf("expected timed out git dependency, got %#v", got)
+	}
+	if out.Dependencies[1].UpdateStatus != "n/a" {
+		t.Fatalf("expected local dependency to be reported, got %#v", out.Dependencies[1])
 	}
 
-	outFile := filepath.Join(projectDir, ".claude", "rules", "100-python_base.md")
-	content, err := os.ReadFile(outFile)
+	oldWD, err := os.Getwd()
 	if err != nil {
-		t.Fatalf("read claude output: %v", err)
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cancelledCmd := a.newDepsOutdatedCmd()
+	cancelledCmd.SetContext(ctx)
+	cancelledCmd.SetArgs(nil)
+	data, err := captureStdout(cancelledCmd.Execute)
+	if err == nil || !strings.Contains(err.Error(), "results are partial") {
+		t.Fatalf("expected interrupted error, got %v", err)
+	}
+	if err := json.Unmarshal(data, &env); err != nil {
+		t.Fatalf("unmarshal partial output: %v", err)
+	}
+	out = outdatedOutput{}
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
 	}
-	if !strings.HasPrefix(string(content), "<!-- pack=") {
-		t.Fatalf("expected provenance header in claude output, got %q", string(content))
+	if out.CancelledCount != 1 || out.Dependencies[0].UpdateStatus != "cancelled" || out.Dependencies[1].UpdateStatus != "n/a" {
+		t.Fatalf("expected partial report with one cancelled dependency, got %#v", out)
 	}
 }
 
-func TestBuildCommandJSON_ClaudeTargetWritesNestedOutput(t *testing.T) {
+func TestFetchCommandJSON_MaterializesLockedDependencies(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	repo := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	for _, args := range [][]string{{"init"}, {"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "init"}} {
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
 	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
-		"modules/backend/api/auth.md": "auth rule\n",
-	}, `{
-  "specVersion": "0.1",
-  "name": "source-pack",
-  "version": "1.0.0",
-  "modules": [
-    { "id": "backend.api.auth", "path": "modules/backend/api/auth.md", "priority": 100 }
-  ],
-  "exports": { "default": { "include": ["**"] } }
-}`)
-	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	sourceDir := filepath.Join(projectDir, "packs", "local")
+	if err := os.CopyFS(sourceDir, os.DirFS(createLocalSourcePackWithID(t, "python.base", "python rule\n"))); err != nil {
+		t.Fatalf("copy pack: %v", err)
+	}
 	cfg := config.DefaultRuleset("proj")
 	cfg.Dependencies = []config.Dependency{
-		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+		{Source: "git", URI: repo, Export: "default"},
+		{Source: "local", Path: "packs/local", Export: "default"},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
 		t.Fatalf("install failed: %v", err)
 	}
-	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
-		t.Fatalf("build failed: %v", err)
+	if err := os.Remove(filepath.Join(projectDir, config.RulesetFileName)); err != nil {
+		t.Fatalf("remove ruleset: %v", err)
 	}
-	outFile := filepath.Join(projectDir, ".claude", "rules", "backend", "api", "100-auth.md")
-	if _, err := os.Stat(outFile); err != nil {
-		t.Fatalf("expected nested claude output, stat err=%v", err)
+
+	lockPath := filepath.Join(projectDir, config.LockFileName)
+	outDir := filepath.Join(t.TempDir(), "deps")
+	if err := runCmdJSON(t, t.TempDir(), a.newFetchCmd(), &env, "--lockfile", lockPath, "--out", outDir); err != nil {
+		t.Fatalf("fetch failed: %v", err)
+	}
+	var out fetchOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	wantDirs := []string{"01-" + filepath.Base(repo), "02-local"}
+	if len(out.Dependencies) != 2 || out.Dependencies[0].Dir != wantDirs[0] || out.Dependencies[1].Dir != wantDirs[1] {
+		t.Fatalf("unexpected fetched dependencies: %#v", out.Dependencies)
+	}
+	for i, want := range []string{"modules/go_base.md", "modules/python_base.md"} {
+		if got := out.Dependencies[i].Files; !reflect.DeepEqual(got, []string{want, "rulepack.json"}) {
+			t.Fatalf("unexpected files for %s: %v", wantDirs[i], got)
+		}
+	}
+	content, err := os.ReadFile(filepath.Join(outDir, wantDirs[0], "modules", "go_base.md"))
+	if err != nil || string(content) != "go rule\n" {
+		t.Fatalf("unexpected git module content %q: %v", content, err)
+	}
+
+	if err := runCmdJSON(t, t.TempDir(), a.newFetchCmd(), &env, "--lockfile", lockPath, "--out", outDir); err == nil || !strings.Contains(err.Error(), "is not empty") {
+		t.Fatalf("expected non-empty output directory to fail, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "modules", "python_base.md"), []byte("changed\n"), 0o644); err != nil {
+		t.Fatalf("edit module: %v", err)
+	}
+	staleOut := filepath.Join(t.TempDir(), "deps")
+	err = runCmdJSON(t, t.TempDir(), a.newFetchCmd(), &env, "--lockfile", lockPath, "--out", staleOut)
+	if err == nil || !strings.Contains(err.Error(), "no longer matches locked hash") {
+		t.Fatalf("expected changed local dependency to fail, got %v", err)
+	}
+	if _, statErr := os.Stat(staleOut); !os.IsNotExist(statErr) {
+		t.Fatalf("expected failed fetch to leave no output, got %v", statErr)
 	}
 }
 
-func TestBuildCommandJSON_CursorTargetWritesNestedOutput(t *testing.T) {
+func TestDepsInstall_PinnedModuleChangeFailsUntilUpdate(t *testing.T) {
 	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
-		"modules/backend/api/auth.md": "auth rule\n",
-	}, `{
-  "specVersion": "0.1",
-  "name": "source-pack",
-  "version": "1.0.0",
-  "modules": [
-    { "id": "backend.api.auth", "path": "modules/backend/api/auth.md", "priority": 100 }
-  ],
-  "exports": { "default": { "include": ["**"] } }
-}`)
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
 	relSource, _ := filepath.Rel(projectDir, sourceDir)
 	cfg := config.DefaultRuleset("proj")
-	cfg.Dependencies = []config.Dependency{
-		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
-	}
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default", Pin: []string{"python.missing"}}}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), `pins module "python.missing"`) {
+		t.Fatalf("expected unknown pin to fail, got %v", err)
+	}
+	cfg.Dependencies[0].Pin = []string{"python.base"}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
 		t.Fatalf("install failed: %v", err)
 	}
-	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "cursor"); err != nil {
-		t.Fatalf("build failed: %v", err)
+	lockPath := filepath.Join(projectDir, config.LockFileName)
+	lock, err := config.LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatalf("load lockfile: %v", err)
 	}
-	outFile := filepath.Join(projectDir, ".cursor", "rules", "backend", "api", "100-auth.mdc")
-	if _, err := os.Stat(outFile); err != nil {
-		t.Fatalf("expected nested cursor output, stat err=%v", err)
+	pinned := lock.Resolved[0].ModulePins["python.base"]
+	if pinned == "" {
+		t.Fatalf("expected pinned digest in lock, got %#v", lock.Resolved[0])
+	}
+
+	if err := os.WriteFile(filepath.Join(sourceDir, "modules", "python_base.md"), []byte("rewritten rule\n"), 0o644); err != nil {
+		t.Fatalf("edit module: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), "module python.base") || !strings.Contains(err.Error(), "deps update") {
+		t.Fatalf("expected pinned module change to fail install, got %v", err)
+	}
+	if lock, _ := config.LoadLockfile(lockPath); lock.Resolved[0].ModulePins["python.base"] != pinned {
+		t.Fatalf("expected failed install to leave the lock alone")
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newDepsUpdateCmd(), &env, "1"); err != nil {
+		t.Fatalf("deps update failed: %v", err)
+	}
+	var out depsUpdateOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal deps update: %v", err)
+	}
+	if len(out.BumpedPins) != 1 || out.BumpedPins[0].Module != "python.base" || out.BumpedPins[0].From != pinned {
+		t.Fatalf("unexpected bumped pins: %#v", out)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install after update failed: %v", err)
 	}
 }
 
-func TestBuildCommandJSON_ClaudeTargetNeverSkipsModuleFile(t *testing.T) {
-	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
-		"modules/never.md": "never\n",
-		"modules/keep.md":  "keep\n",
-	}, `{
-  "specVersion": "0.1",
-  "name": "source-pack",
-  "version": "1.0.0",
-  "modules": [
-    {
-      "id": "a.never",
-      "path": "modules/never.md",
-      "priority": 100,
-      "apply": { "targets": { "claude": { "mode": "never" } } }
-    },
-    { "id": "b.keep", "path": "modules/keep.md", "priority": 110 }
-  ],
-  "exports": { "default": { "include": ["**"] } }
-}`)
-	relSource, _ := filepath.Rel(projectDir, sourceDir)
+func TestDepsUpdate_ReportsRenamedModulesAndCarriesOverrides(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	manifest := func(id string) string {
+		return `{"specVersion":"0.1","name":"rules","version":"1.0.0","modules":[{"id":"` + id + `","path":"modules/python_base.md","priority":100},{"id":"go.base","path":"modules/go_base.md","priority":110}]}`
+	}
+	repo := createLocalSourcePackWithManifest(t, map[string]string{"modules/python_base.md": "Python\n", "modules/go_base.md": "Go\n"}, manifest("python.base"))
+	for _, args := range [][]string{{"init"}, {"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "init"}} {
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+
+	projectDir := t.TempDir()
+	priority := 5
 	cfg := config.DefaultRuleset("proj")
-	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	cfg.Dependencies = []config.Dependency{{Source: "git", URI: repo}}
+	cfg.Overrides = []config.Override{{ID: "python.base", Priority: &priority}}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
-		t.Fatalf("install failed: %v", err)
-	}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
-		t.Fatalf("build failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
 	}
 
-	if _, err := os.Stat(filepath.Join(projectDir, ".claude", "rules", "100-never.md")); !os.IsNotExist(err) {
-		t.Fatalf("expected never file to be skipped, stat err=%v", err)
+	if err := os.WriteFile(filepath.Join(repo, "rulepack.json"), []byte(manifest("python.core")), 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
 	}
-	if _, err := os.Stat(filepath.Join(projectDir, ".claude", "rules", "110-keep.md")); err != nil {
-		t.Fatalf("expected keep file to exist, stat err=%v", err)
+	for _, args := range [][]string{{"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "rename"}} {
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsUpdateCmd(), &env, "--carry-overrides", "--no-notify"); err != nil {
+		t.Fatalf("deps update failed: %v", err)
+	}
+	var out depsUpdateOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal deps update: %v", err)
+	}
+	want := []renameRow{{Dependency: filepath.Base(repo), From: "python.base", To: "python.core", CarriedOverride: true}}
+	if !slices.Equal(out.RenamedModules, want) || len(out.Warnings) != 0 {
+		t.Fatalf("unexpected renames: %#v", out)
+	}
+	saved, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if len(saved.Overrides) != 1 || saved.Overrides[0].ID != "python.core" || *saved.Overrides[0].Priority != priority {
+		t.Fatalf("expected override carried to python.core, got %#v", saved.Overrides)
 	}
 }
 
-func TestBuildCommandJSON_ClaudeTargetGlobIncludesPathsFrontmatter(t *testing.T) {
+func TestDeadOverridesWarnFailStrictAndPrune(t *testing.T) {
 	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
-		"modules/api.md": "api\n",
-	}, `{
-  "specVersion": "0.1",
-  "name": "source-pack",
-  "version": "1.0.0",
-  "modules": [
-    {
-      "id": "api.rule",
-      "path": "modules/api.md",
-      "priority": 100,
-      "apply": { "targets": { "claude": { "mode": "glob", "globs": ["src/api/**/*.ts"] } } }
-    }
-  ],
-  "exports": { "default": { "include": ["**"] } }
-}`)
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
 	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	priority := 5
 	cfg := config.DefaultRuleset("proj")
 	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	cfg.Overrides = []config.Override{{ID: "python.base", Priority: &priority}, {ID: "python.gone", Priority: &priority}}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
+	if err := os.WriteFile(filepath.Join(projectDir, config.LocalOverridesFileName), []byte(`{"overrides":[{"id":"local.gone","priority":7}]}`), 0o644); err != nil {
+		t.Fatalf("write local overrides: %v", err)
+	}
 
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--strict"); err == nil || !strings.Contains(err.Error(), "overrides match no composed module: python.gone, local.gone") {
+		t.Fatalf("expected strict install to fail on dead overrides, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, config.LockFileName)); !os.IsNotExist(err) {
+		t.Fatalf("strict install wrote the lockfile: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
 		t.Fatalf("install failed: %v", err)
 	}
-	var env jsonEnvelope
+	var install installOutput
+	if err := json.Unmarshal(env.Result, &install); err != nil {
+		t.Fatalf("unmarshal install: %v", err)
+	}
+	if len(install.Warnings) != 2 || !strings.Contains(install.Warnings[0], "override for python.gone matches no composed module") {
+		t.Fatalf("expected dead override warnings, got %#v", install.Warnings)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude", "--strict"); err == nil || !strings.Contains(err.Error(), "python.gone") {
+		t.Fatalf("expected strict build to fail on dead overrides, got %v", err)
+	}
 	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
 		t.Fatalf("build failed: %v", err)
 	}
+	var built buildOutput
+	if err := json.Unmarshal(env.Result, &built); err != nil {
+		t.Fatalf("unmarshal build: %v", err)
+	}
+	if len(built.Warnings) != 2 {
+		t.Fatalf("expected dead override warnings from build, got %#v", built.Warnings)
+	}
 
-	content, err := os.ReadFile(filepath.Join(projectDir, ".claude", "rules", "100-api.md"))
+	if err := runCmdJSON(t, projectDir, a.newOverridesPruneCmd(), &env); err != nil {
+		t.Fatalf("overrides prune failed: %v", err)
+	}
+	var pruned overridesPruneOutput
+	if err := json.Unmarshal(env.Result, &pruned); err != nil {
+		t.Fatalf("unmarshal prune: %v", err)
+	}
+	want := []overridePruneRow{{ID: "python.gone", File: config.RulesetFileName}, {ID: "local.gone", File: config.LocalOverridesFileName}}
+	if !slices.Equal(pruned.Removed, want) || len(pruned.Updated) != 2 {
+		t.Fatalf("unexpected prune result: %#v", pruned)
+	}
+	saved, err := config.LoadEffectiveRuleset(filepath.Join(projectDir, config.RulesetFileName))
 	if err != nil {
-		t.Fatalf("read claude file: %v", err)
+		t.Fatalf("load ruleset: %v", err)
 	}
-	got := string(content)
-	if !strings.HasPrefix(got, "---\npaths:\n") || !strings.Contains(got, "\"src/api/**/*.ts\"") {
-		t.Fatalf("expected paths frontmatter, got %q", got)
+	if len(saved.Overrides) != 1 || saved.Overrides[0].ID != "python.base" {
+		t.Fatalf("expected only the live override to remain, got %#v", saved.Overrides)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--strict"); err != nil {
+		t.Fatalf("strict install after prune failed: %v", err)
 	}
 }
 
-func TestBuildCommandJSON_ClaudeTargetRejectsOutFile(t *testing.T) {
+func TestLockPruneAndInstallDropOrphanedEntries(t *testing.T) {
 	projectDir := t.TempDir()
-	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
-	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	keepDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	goneDir := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	relKeep, _ := filepath.Rel(projectDir, keepDir)
+	relGone, _ := filepath.Rel(projectDir, goneDir)
 	cfg := config.DefaultRuleset("proj")
-	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
-	cfg.Targets["claude"] = config.TargetEntry{OutFile: "CLAUDE.md"}
-	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relKeep), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relGone), Export: "default"},
+	}
+	rulesetPath := filepath.Join(projectDir, config.RulesetFileName)
+	if err := config.SaveRuleset(rulesetPath, cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
 		t.Fatalf("install failed: %v", err)
 	}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude")
-	if err == nil || !strings.Contains(err.Error(), "claude target does not support outFile; use outDir") {
-		t.Fatalf("expected outFile validation error, got %v", err)
+	lockPath := filepath.Join(projectDir, config.LockFileName)
+	before, err := config.LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+
+	removed := cfg
+	removed.Dependencies = cfg.Dependencies[:1]
+	if err := config.SaveRuleset(rulesetPath, removed); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newLockPruneCmd(), &env); err != nil {
+		t.Fatalf("lock prune failed: %v", err)
+	}
+	var pruned lockPruneOutput
+	if err := json.Unmarshal(env.Result, &pruned); err != nil {
+		t.Fatalf("unmarshal lock prune: %v", err)
+	}
+	if len(pruned.Pruned) != 1 || pruned.Pruned[0].Key != before.Resolved[1].Key {
+		t.Fatalf("expected the removed dependency's entry pruned, got %#v", pruned)
+	}
+	after, err := config.LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	if len(after.Resolved) != 1 || after.RulesetDigest == "" || after.RulesetDigest == before.RulesetDigest {
+		t.Fatalf("expected one entry and a new ruleset digest, got %#v", after)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build after lock prune failed: %v", err)
+	}
+
+	if err := config.SaveRuleset(rulesetPath, cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := config.SaveRuleset(rulesetPath, removed); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var install installOutput
+	if err := json.Unmarshal(env.Result, &install); err != nil {
+		t.Fatalf("unmarshal install: %v", err)
+	}
+	if len(install.Pruned) != 1 || install.Pruned[0].Source != "local" || install.Pruned[0].Key != before.Resolved[1].Key {
+		t.Fatalf("expected install to report the dropped entry, got %#v", install.Pruned)
+	}
+	reinstalled, err := config.LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	if reinstalled.RulesetDigest != after.RulesetDigest {
+		t.Fatalf("expected lock prune's digest %s to match a fresh install's %s", after.RulesetDigest, reinstalled.RulesetDigest)
 	}
 }
 
-func TestBuildCommandJSON_ClaudeTargetRejectsPerModuleFalse(t *testing.T) {
+func TestAliasesRunEachStep(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("USERPROFILE", homeDir)
+	if err := config.SaveUserConfig(config.UserConfig{Aliases: map[string]string{"up": "deps install && rulepack build", "build": "lint"}}); err != nil {
+		t.Fatalf("save user config: %v", err)
+	}
 	projectDir := t.TempDir()
 	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
 	relSource, _ := filepath.Rel(projectDir, sourceDir)
 	cfg := config.DefaultRuleset("proj")
 	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
-	cfg.Targets["claude"] = config.TargetEntry{OutDir: ".claude/rules", PerModule: false, Ext: ".md"}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
 
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
-		t.Fatalf("install failed: %v", err)
+	// Global flags may follow the alias; other arguments go to the last step.
+	a := &app{}
+	out, err := captureStdout(func() error {
+		return a.newRootCmd([]string{"up", "--target", "copilot", "--json"}).Execute()
+	})
+	if err != nil {
+		t.Fatalf("alias up failed: %v", err)
 	}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude")
-	if err == nil || !strings.Contains(err.Error(), "claude target requires perModule=true") {
-		t.Fatalf("expected perModule validation error, got %v", err)
+	dec := json.NewDecoder(bytes.NewReader(out))
+	var commands []string
+	for dec.More() {
+		var env jsonEnvelope
+		if err := dec.Decode(&env); err != nil {
+			t.Fatalf("decode envelope: %v\n%s", err, out)
+		}
+		commands = append(commands, env.Command)
+	}
+	if !reflect.DeepEqual(commands, []string{"install", "build"}) {
+		t.Fatalf("unexpected step envelopes: %v", commands)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".github", "copilot-instructions.md")); err != nil {
+		t.Fatalf("expected the build step to write copilot output: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".cursor", "rules")); !os.IsNotExist(err) {
+		t.Fatalf("expected --target to reach only the build step, stat err=%v", err)
 	}
-}
 
-func TestAddCommandJSON_RequiresYesWhenReplacingDependency(t *testing.T) {
-	projectDir := t.TempDir()
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
-		},
+	// Help for an alias runs none of its steps.
+	lockPath := filepath.Join(projectDir, config.LockFileName)
+	before, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatalf("read lockfile: %v", err)
 	}
-	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
-		t.Fatalf("save ruleset: %v", err)
+	if err := os.WriteFile(filepath.Join(sourceDir, "modules", "python_base.md"), []byte("changed rule\n"), 0o644); err != nil {
+		t.Fatalf("write source module: %v", err)
 	}
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git")
-	if err == nil {
-		t.Fatalf("expected add to fail without --yes when replacing dependency")
+	help, err := captureStdout(func() error {
+		return (&app{}).newRootCmd([]string{"sync", "--help"}).Execute()
+	})
+	if err != nil {
+		t.Fatalf("sync --help failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "rerun with --yes") {
-		t.Fatalf("unexpected error: %v", err)
+	if !strings.Contains(string(help), "Run rulepack deps install && build") {
+		t.Fatalf("expected alias help, got:\n%s", help)
 	}
-	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git", "--yes"); err != nil {
-		t.Fatalf("add with --yes failed: %v", err)
+	after, err := os.ReadFile(lockPath)
+	if err != nil || !bytes.Equal(before, after) {
+		t.Fatalf("expected sync --help to leave the lockfile untouched (%v)", err)
 	}
-	var out addOutput
-	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal add result: %v", err)
+
+	root := (&app{}).newRootCmd(nil)
+	if cmd, _, err := root.Find([]string{"sync"}); err != nil || cmd.Short != "Alias for: rulepack deps install && build" {
+		t.Fatalf("expected built-in sync alias, got %v", err)
 	}
-	if out.Action != "replaced" {
-		t.Fatalf("expected replaced action, got %s", out.Action)
+	if cmd, _, err := root.Find([]string{"build"}); err != nil || cmd.Short == "Alias for: rulepack lint" {
+		t.Fatalf("expected an alias not to shadow the build command, got %v", err)
 	}
 }
 
-func TestAddCommandJSON_AllowsMultipleExportsSameSource(t *testing.T) {
+func TestDepsUninstallSyncPrunesLockAndRebuilds(t *testing.T) {
 	projectDir := t.TempDir()
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "python"},
-		},
+	keepDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	goneDir := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	relKeep, _ := filepath.Rel(projectDir, keepDir)
+	relGone, _ := filepath.Rel(projectDir, goneDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relKeep), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relGone), Export: "default"},
 	}
-	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+	rulesetPath := filepath.Join(projectDir, config.RulesetFileName)
+	if err := config.SaveRuleset(rulesetPath, cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git", "--export", "ml"); err != nil {
-		t.Fatalf("add second export failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
 	}
-	var out addOutput
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	gonePath := filepath.Join(projectDir, ".cursor", "rules", "100-go_base.mdc")
+	if _, err := os.Stat(gonePath); err != nil {
+		t.Fatalf("expected cursor output for go.base: %v", err)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "2", "--sync", "--cleanup"); err == nil {
+		t.Fatalf("expected --sync with --cleanup to fail")
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "2", "--sync", "--yes"); err != nil {
+		t.Fatalf("uninstall --sync failed: %v", err)
+	}
+	var out uninstallOutput
 	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal add result: %v", err)
+		t.Fatalf("unmarshal uninstall: %v", err)
 	}
-	if out.Action != "added" {
-		t.Fatalf("expected added action, got %s", out.Action)
+	if out.Sync == nil || len(out.Sync.Pruned) != 1 || len(out.Sync.Build) == 0 {
+		t.Fatalf("expected one pruned lock entry and a build result, got %#v", out.Sync)
 	}
-	newCfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
 	if err != nil {
-		t.Fatalf("load ruleset: %v", err)
+		t.Fatalf("load lock: %v", err)
 	}
-	if len(newCfg.Dependencies) != 2 {
-		t.Fatalf("expected two dependencies, got %#v", newCfg.Dependencies)
+	if len(lock.Resolved) != 1 {
+		t.Fatalf("expected one lock entry, got %#v", lock.Resolved)
+	}
+	if _, err := os.Stat(gonePath); !os.IsNotExist(err) {
+		t.Fatalf("expected go.base output removed, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".cursor", "rules", "100-python_base.mdc")); err != nil {
+		t.Fatalf("expected python.base output kept: %v", err)
 	}
 }
 
-func TestAddCommandJSON_AutoInitWhenMissingRuleset(t *testing.T) {
+func TestDependencyFreshnessSLA(t *testing.T) {
 	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default", MaxAgeDays: 30}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
 
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git", "--export", "python"); err != nil {
-		t.Fatalf("add failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
 	}
-	if env.Command != "add" {
-		t.Fatalf("unexpected command: %s", env.Command)
+	lockPath := filepath.Join(projectDir, config.LockFileName)
+	lock, err := config.LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
 	}
-
-	var out addOutput
-	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal add result: %v", err)
+	lockedAt := time.Now().UTC().AddDate(0, 0, -45).Format(time.RFC3339)
+	lock.Resolved[0].LockedAt = lockedAt
+	if err := config.SaveLockfile(lockPath, lock); err != nil {
+		t.Fatalf("save lock: %v", err)
 	}
-	if out.Action != "added" {
-		t.Fatalf("expected added action, got %s", out.Action)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("reinstall failed: %v", err)
+	}
+	if lock, err = config.LoadLockfile(lockPath); err != nil || lock.Resolved[0].LockedAt != lockedAt {
+		t.Fatalf("expected unchanged resolution to keep lockedAt %s, got %#v (err=%v)", lockedAt, lock.Resolved, err)
 	}
 
-	cfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
-	if err != nil {
-		t.Fatalf("load ruleset: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env); err != nil {
+		t.Fatalf("outdated failed: %v", err)
 	}
-	if cfg.SpecVersion != "0.1" {
-		t.Fatalf("unexpected specVersion: %s", cfg.SpecVersion)
+	var out outdatedOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal outdated: %v", err)
 	}
-	if cfg.Name != filepath.Base(projectDir) {
-		t.Fatalf("expected auto-init name %s, got %s", filepath.Base(projectDir), cfg.Name)
+	entry := out.Dependencies[0]
+	if out.StaleCount != 1 || entry.Freshness != "stale" || entry.LockAgeDays == nil || *entry.LockAgeDays != 45 {
+		t.Fatalf("expected stale dependency, got %#v", out)
 	}
-	if len(cfg.Dependencies) != 1 {
-		t.Fatalf("expected 1 dependency, got %d", len(cfg.Dependencies))
+	err = runCmd(t, projectDir, a.newDepsOutdatedCmd(), "--fail-when", "stale")
+	if err == nil || !strings.Contains(err.Error(), "1 past maxAgeDays") {
+		t.Fatalf("expected stale threshold failure, got %v", err)
 	}
-	if cfg.Dependencies[0].URI != "https://example.com/rules.git" || cfg.Dependencies[0].Export != "python" {
-		t.Fatalf("unexpected dependency: %+v", cfg.Dependencies[0])
+
+	if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env); err != nil {
+		t.Fatalf("doctor failed: %v", err)
 	}
-	if _, ok := cfg.Targets["cursor"]; !ok {
-		t.Fatalf("expected default cursor target to be present")
+	var doctor doctorOutput
+	if err := json.Unmarshal(env.Result, &doctor); err != nil {
+		t.Fatalf("unmarshal doctor: %v", err)
+	}
+	found := false
+	for _, check := range doctor.Checks {
+		if check.Name == "dependency freshness" {
+			found = true
+			if check.Status != "fail" || !strings.Contains(check.Details, "locked 45d ago (max 30d)") {
+				t.Fatalf("unexpected freshness check: %#v", check)
+			}
+		}
+	}
+	if !found {
+		t.Fatalf("expected dependency freshness check, got %#v", doctor.Checks)
 	}
 }
 
-func TestAddCommandJSON_LocalDependency(t *testing.T) {
-	projectDir := t.TempDir()
-	localPack := createLocalSourcePackWithID(t, "python.base", "python rule\n")
-	relLocal, err := filepath.Rel(projectDir, localPack)
+func TestOutdatedCommandJSON_FetchesThroughMirror(t *testing.T) {
+	repoDir, oldCommit, _, err := createGitRepoWithTwoCommits(t)
 	if err != nil {
-		t.Fatalf("rel local: %v", err)
-	}
-
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", relLocal, "--export", "python"); err != nil {
-		t.Fatalf("add local failed: %v", err)
-	}
-
-	var out addOutput
-	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal add output: %v", err)
-	}
-	if out.Dependency.Source != "local" {
-		t.Fatalf("expected local source, got %#v", out.Dependency)
-	}
-	if out.Dependency.Path != filepath.ToSlash(relLocal) {
-		t.Fatalf("expected normalized path %q, got %q", filepath.ToSlash(relLocal), out.Dependency.Path)
-	}
-	if out.Dependency.Export != "python" {
-		t.Fatalf("expected export=python, got %#v", out.Dependency)
+		t.Fatalf("create repo: %v", err)
 	}
-}
+	canonical := "https://github.invalid/org/" + filepath.Base(repoDir)
 
-func TestAddCommandJSON_LocalReplacementRequiresYes(t *testing.T) {
 	projectDir := t.TempDir()
-	localPack := createLocalSourcePackWithID(t, "python.base", "python rule\n")
-	relLocal, err := filepath.Rel(projectDir, localPack)
-	if err != nil {
-		t.Fatalf("rel local: %v", err)
-	}
 	cfg := config.Ruleset{
 		SpecVersion: "0.1",
 		Name:        "proj",
 		Dependencies: []config.Dependency{
-			{Source: "local", Path: filepath.ToSlash(relLocal), Export: "default"},
+			{Source: "git", URI: canonical},
+		},
+		Mirrors: map[string]string{"https://github.invalid/org": filepath.Dir(repoDir)},
+	}
+	lock := config.Lockfile{
+		LockVersion: "0.1",
+		Resolved: []config.LockedSource{
+			{Source: "git", URI: canonical, Commit: oldCommit},
 		},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var env jsonEnvelope
-	err = runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", relLocal)
-	if err == nil {
-		t.Fatalf("expected local replacement to require --yes")
-	}
-	if !strings.Contains(err.Error(), "rerun with --yes") {
-		t.Fatalf("unexpected error: %v", err)
-	}
-	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", relLocal, "--yes"); err != nil {
-		t.Fatalf("add local with --yes failed: %v", err)
+	if err := config.SaveLockfile(filepath.Join(projectDir, config.LockFileName), lock); err != nil {
+		t.Fatalf("save lock: %v", err)
 	}
-}
 
-func TestAddCommandJSON_LocalValidation(t *testing.T) {
-	projectDir := t.TempDir()
-	localPack := createLocalSourcePackWithID(t, "python.base", "python rule\n")
-	relLocal, err := filepath.Rel(projectDir, localPack)
-	if err != nil {
-		t.Fatalf("rel local: %v", err)
-	}
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-
-	cases := []struct {
-		name    string
-		args    []string
-		wantErr string
-	}{
-		{name: "missing source", args: []string{}, wantErr: "missing source: provide <git-url> or --local <path>"},
-		{name: "both source modes", args: []string{"https://example.com/rules.git", "--local", relLocal}, wantErr: "use either <git-url> or --local <path>, not both"},
-		{name: "local plus version", args: []string{"--local", relLocal, "--version", "^1.0.0"}, wantErr: "--version and --ref are only supported for git dependencies"},
-		{name: "local plus ref", args: []string{"--local", relLocal, "--ref", "main"}, wantErr: "--version and --ref are only supported for git dependencies"},
-		{name: "missing local path", args: []string{"--local", filepath.Join(projectDir, "missing-pack")}, wantErr: "local dependency path"},
+	if err := runCmdJSON(t, projectDir, a.newDepsOutdatedCmd(), &env); err != nil {
+		t.Fatalf("outdated command failed: %v", err)
 	}
-	for _, tc := range cases {
-		t.Run(tc.name, func(t *testing.T) {
-			err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, tc.args...)
-			if err == nil {
-				t.Fatalf("expected error")
-			}
-			if !strings.Contains(err.Error(), tc.wantErr) {
-				t.Fatalf("unexpected error: %v", err)
-			}
-		})
+	var out outdatedOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if out.OutdatedCount != 1 || out.Dependencies[0].Reference != canonical {
+		t.Fatalf("expected canonical dependency resolved through mirror, got %#v", out.Dependencies)
 	}
 }
 
-func TestAddCommandJSON_LocalMissingRulepack(t *testing.T) {
-	projectDir := t.TempDir()
-	invalidLocal := filepath.Join(t.TempDir(), "rules")
-	if err := os.MkdirAll(invalidLocal, 0o755); err != nil {
-		t.Fatalf("mkdir invalid local: %v", err)
-	}
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", invalidLocal)
-	if err == nil {
-		t.Fatalf("expected missing rulepack.json error")
-	}
-	if !strings.Contains(err.Error(), "local dependency missing rulepack.json") {
-		t.Fatalf("unexpected error: %v", err)
+func TestDepsInstallJSON_EnforcesLicensePolicy(t *testing.T) {
+	repoDir := createLocalSourcePackWithManifest(t, map[string]string{"modules/base.md": "base\n"}, `{
+  "specVersion": "0.1",
+  "name": "licensed",
+  "version": "1.0.0",
+  "license": "MIT",
+  "modules": [{"id": "base", "path": "modules/base.md", "priority": 100}]
+}`)
+	for _, args := range [][]string{{"init"}, {"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "init"}} {
+		if _, err := runGit(repoDir, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
 	}
-}
 
-func TestUninstallCommandJSON(t *testing.T) {
 	projectDir := t.TempDir()
 	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
-			{Source: "local", Path: "../local-rules", Export: "local"},
-			{Source: "profile", Profile: "abc123__python__01", Export: "default"},
-		},
+		SpecVersion:  "0.1",
+		Name:         "proj",
+		Dependencies: []config.Dependency{{Source: "git", URI: repoDir}},
+		Policy:       &config.Policy{Licenses: &config.LicensePolicy{Allow: []string{"Apache-2.0"}}},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "abc123__python__01", "--yes"); err != nil {
-		t.Fatalf("uninstall failed: %v", err)
-	}
-	if env.Command != "uninstall" {
-		t.Fatalf("unexpected command: %s", env.Command)
+	err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), `license "MIT" is not allowed`) {
+		t.Fatalf("expected license policy failure, got %v", err)
 	}
 
-	var out uninstallOutput
-	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal uninstall result: %v", err)
-	}
-	if len(out.Removed) != 2 {
-		t.Fatalf("expected 2 removed dependencies, got %d", len(out.Removed))
+	cfg.Policy.Licenses.Allow = append(cfg.Policy.Licenses.Allow, "MIT")
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
 	}
-	if out.Remaining != 1 {
-		t.Fatalf("expected 1 remaining dependency, got %d", out.Remaining)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
 	}
-	newCfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
 	if err != nil {
-		t.Fatalf("load ruleset: %v", err)
+		t.Fatalf("load lock: %v", err)
 	}
-	if len(newCfg.Dependencies) != 1 || newCfg.Dependencies[0].Source != "local" {
-		t.Fatalf("unexpected remaining dependencies: %#v", newCfg.Dependencies)
+	if lock.Resolved[0].License != "MIT" {
+		t.Fatalf("expected license recorded in lockfile, got %#v", lock.Resolved[0])
 	}
-}
 
-func TestUninstallCommandJSON_RequiresYes(t *testing.T) {
-	projectDir := t.TempDir()
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
-		},
+	if err := runCmdJSON(t, projectDir, a.newDepsLicensesCmd(), &env); err != nil {
+		t.Fatalf("licenses failed: %v", err)
 	}
+	var out licensesOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if out.Violations != 0 || len(out.Dependencies) != 1 || out.Dependencies[0].Policy != "allowed" {
+		t.Fatalf("unexpected license report: %#v", out)
+	}
+
+	cfg.Policy.Licenses.Allow = []string{"Apache-2.0"}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1")
-	if err == nil {
-		t.Fatalf("expected uninstall to fail without --yes")
+	if err := runCmdJSON(t, projectDir, a.newDepsLicensesCmd(), &env, "--sarif", "licenses.sarif"); err != nil {
+		t.Fatalf("licenses --sarif failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "rerun with --yes") {
-		t.Fatalf("unexpected error: %v", err)
+	data, err := os.ReadFile(filepath.Join(projectDir, "licenses.sarif"))
+	if err != nil {
+		t.Fatalf("read sarif: %v", err)
+	}
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				RuleID  string `json:"ruleId"`
+				Level   string `json:"level"`
+				Message struct {
+					Text string `json:"text"`
+				} `json:"message"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("decode sarif: %v", err)
+	}
+	if len(log.Runs) != 1 || len(log.Runs[0].Results) != 1 {
+		t.Fatalf("expected one license finding, got %s", data)
+	}
+	if got := log.Runs[0].Results[0]; got.RuleID != "license-not-allowed" || got.Level != "error" || !strings.Contains(got.Message.Text, "declares MIT") {
+		t.Fatalf("unexpected license finding: %s", data)
 	}
 }
 
-func TestUninstallCommand_AmbiguousSelector(t *testing.T) {
+func TestDepsInstallJSON_RecordsLicenseOfExportWithoutModules(t *testing.T) {
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{"modules/base.md": "base\n"}, `{
+  "specVersion": "0.1",
+  "name": "licensed",
+  "version": "1.0.0",
+  "license": "MIT",
+  "modules": [{"id": "base", "path": "modules/base.md", "priority": 100}],
+  "exports": {"empty": {"include": ["nothing.*"]}}
+}`)
 	projectDir := t.TempDir()
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git"},
-			{Source: "git", URI: "https://example.com/rules.git"},
-		},
-	}
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "empty"}}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "https://example.com/rules.git")
-	if err == nil {
-		t.Fatalf("expected uninstall to fail for ambiguous selector")
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "matched multiple dependencies") {
-		t.Fatalf("unexpected error: %v", err)
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	if got := lock.Resolved[0]; got.ModuleCount != 0 || got.License != "MIT" {
+		t.Fatalf("expected the manifest license for an export without modules, got %#v", got)
 	}
 }
 
-func TestUninstallCommandJSON_CleanupOptional(t *testing.T) {
+func TestDepsListCommandJSON(t *testing.T) {
 	projectDir := t.TempDir()
-	managedOut := filepath.Join(projectDir, "managed.md")
-	if err := os.WriteFile(managedOut, []byte("<!-- rulepack:managed -->\ncontent\n"), 0o644); err != nil {
-		t.Fatalf("write managed output: %v", err)
-	}
 	cfg := config.Ruleset{
 		SpecVersion: "0.1",
 		Name:        "proj",
 		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+			{Source: "git", URI: "https://example.com/rules.git", Export: "python"},
 		},
-		Targets: map[string]config.TargetEntry{
-			"codex": {OutFile: managedOut},
+	}
+	lock := config.Lockfile{
+		LockVersion: "0.1",
+		Resolved: []config.LockedSource{
+			{Source: "git", URI: "https://example.com/rules.git", Commit: "abcdef0123456789"},
 		},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
+	if err := config.SaveLockfile(filepath.Join(projectDir, config.LockFileName), lock); err != nil {
+		t.Fatalf("save lock: %v", err)
+	}
+
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "--yes"); err != nil {
-		t.Fatalf("uninstall failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsListCmd(), &env); err != nil {
+		t.Fatalf("deps list failed: %v", err)
 	}
-	var out uninstallOutput
+
+	var out depsListOutput
 	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal uninstall output: %v", err)
+		t.Fatalf("unmarshal result: %v", err)
 	}
-	if out.CleanupPerformed {
-		t.Fatalf("cleanup should be skipped by default in non-interactive mode")
+	if len(out.Dependencies) != 1 {
+		t.Fatalf("expected one dependency row, got %d", len(out.Dependencies))
 	}
-	if _, err := os.Stat(managedOut); err != nil {
-		t.Fatalf("expected managed output to remain without --cleanup: %v", err)
+	if out.Dependencies[0].Locked != "abcdef012345" {
+		t.Fatalf("unexpected locked reference: %s", out.Dependencies[0].Locked)
 	}
 }
 
-func TestUninstallCommandJSON_CleanupWithFlag(t *testing.T) {
+func TestDepsListCommandJSON_HealthColumns(t *testing.T) {
 	projectDir := t.TempDir()
-	managedOut := filepath.Join(projectDir, "managed.md")
-	if err := os.WriteFile(managedOut, []byte("<!-- rulepack:managed -->\ncontent\n"), 0o644); err != nil {
-		t.Fatalf("write managed output: %v", err)
-	}
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
-		},
-		Targets: map[string]config.TargetEntry{
-			"codex": {OutFile: managedOut},
-		},
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
+
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "--yes", "--cleanup"); err != nil {
-		t.Fatalf("uninstall --cleanup failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
 	}
-	var out uninstallOutput
-	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal uninstall output: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsListCmd(), &env); err != nil {
+		t.Fatalf("deps list failed: %v", err)
 	}
-	if !out.CleanupPerformed || len(out.CleanupDeleted) != 1 {
-		t.Fatalf("expected cleanup to delete one file, got %#v", out)
+	var out depsListOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
 	}
-	if _, err := os.Stat(managedOut); !os.IsNotExist(err) {
-		t.Fatalf("expected managed output removed, stat err=%v", err)
+	row := out.Dependencies[0]
+	if row.Resolves != "yes" || row.ExportExists != "yes" || row.ModuleDelta == nil || *row.ModuleDelta != 0 || row.Health != "ok" {
+		t.Fatalf("unexpected healthy row: %#v", row)
 	}
-}
 
-func TestUninstallCommand_InteractiveCleanupPromptDecline(t *testing.T) {
-	orig := isInteractiveTerminal
+	if err := os.WriteFile(filepath.Join(sourceDir, "modules", "python_extra.md"), []byte("extra rule\n"), 0o644); err != nil {
+		t.Fatalf("write module: %v", err)
+	}
+	manifest := `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "python.base", "path": "modules/python_base.md", "priority": 100 },
+    { "id": "python.extra", "path": "modules/python_extra.md", "priority": 200 }
+  ],
+  "exports": { "default": { "include": ["python.*"] } }
+}`
+	if err := os.WriteFile(filepath.Join(sourceDir, "rulepack.json"), []byte(manifest), 0o644); err != nil {
+		t.Fatalf("write source rulepack: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsListCmd(), &env); err != nil {
+		t.Fatalf("deps list failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if row := out.Dependencies[0]; row.ModuleDelta == nil || *row.ModuleDelta != 1 {
+		t.Fatalf("expected module delta +1, got %#v", row)
+	}
+
+	cfg.Dependencies[0].Export = "gone"
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsListCmd(), &env); err != nil {
+		t.Fatalf("deps list failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal result: %v", err)
+	}
+	if row := out.Dependencies[0]; row.ExportExists != "no" || row.Health != "broken" {
+		t.Fatalf("expected missing export to be broken, got %#v", row)
+	}
+}
+
+func TestBuildCommandJSON_RequiresYesOnCursorOverwriteCollision(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	collision := filepath.Join(projectDir, ".cursor", "rules", "100-python_base.mdc")
+	if err := os.MkdirAll(filepath.Dir(collision), 0o755); err != nil {
+		t.Fatalf("mkdir collision dir: %v", err)
+	}
+	if err := os.WriteFile(collision, []byte("manual rule\n"), 0o644); err != nil {
+		t.Fatalf("write collision file: %v", err)
+	}
+
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env)
+	if err == nil {
+		t.Fatalf("expected build to fail without --yes on unmanaged overwrite collision")
+	}
+	if !strings.Contains(err.Error(), "rerun with --yes") {
+		t.Fatalf("unexpected build error: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--yes"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal build output: %v", err)
+	}
+	if len(out.Warnings) != 1 {
+		t.Fatalf("expected one warning, got %#v", out.Warnings)
+	}
+	if !strings.Contains(out.Warnings[0], ".cursor/rules/100-python_base.mdc") {
+		t.Fatalf("unexpected warning: %s", out.Warnings[0])
+	}
+}
+
+func TestBuildCommandJSON_ClaudeTargetWritesPerModuleOutput(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	outFile := filepath.Join(projectDir, ".claude", "rules", "100-python_base.md")
+	content, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read claude output: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "<!-- rulepack:ruleset=") || !strings.Contains(string(content), "\n<!-- pack=") {
+		t.Fatalf("expected ruleset and provenance headers in claude output, got %q", string(content))
+	}
+}
+
+func TestBuildCommandJSON_EmbedsLockRulesetDigest(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	install := func() string {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+			t.Fatalf("install failed: %v", err)
+		}
+		lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+		if err != nil {
+			t.Fatalf("load lock: %v", err)
+		}
+		if lock.RulesetDigest == "" {
+			t.Fatalf("expected rulesetDigest in lockfile")
+		}
+		return lock.RulesetDigest
+	}
+	build := func(digest string) {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+		var out buildOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("decode build: %v", err)
+		}
+		if out.RulesetDigest != digest {
+			t.Fatalf("expected build to report digest %s, got %s", digest, out.RulesetDigest)
+		}
+		content, err := os.ReadFile(filepath.Join(projectDir, ".github", "copilot-instructions.md"))
+		if err != nil {
+			t.Fatalf("read copilot output: %v", err)
+		}
+		want := "<!-- rulepack:managed -->\n<!-- rulepack:ruleset=" + digest + " -->\n"
+		if !strings.HasPrefix(string(content), want) {
+			t.Fatalf("expected output to start with %q, got %q", want, string(content))
+		}
+	}
+
+	first := install()
+	build(first)
+	if err := os.WriteFile(filepath.Join(sourceDir, "modules", "python_base.md"), []byte("changed rule\n"), 0o644); err != nil {
+		t.Fatalf("edit module: %v", err)
+	}
+	second := install()
+	if second == first {
+		t.Fatalf("expected rulesetDigest to change with module content")
+	}
+	build(second)
+}
+
+func TestBuildCommandJSON_OutputIndependentOfInputOrder(t *testing.T) {
+	modules := map[string]string{
+		"modules/a_first.md":  "first rule\n",
+		"modules/b_second.md": "second rule\n",
+		"modules/c_third.md":  "third rule\n",
+	}
+	manifest := func(name string, entries []string) string {
+		return `{"specVersion":"0.1","name":"` + name + `","version":"1.0.0","modules":[` + strings.Join(entries, ",") + `],"exports":{"default":{"include":["**"]}}}`
+	}
+	alpha := []string{
+		`{"id":"alpha.a","path":"modules/a_first.md","priority":10}`,
+		`{"id":"alpha.b","path":"modules/b_second.md","priority":20}`,
+		`{"id":"alpha.c","path":"modules/c_third.md","priority":20}`,
+	}
+	beta := []string{
+		`{"id":"beta.a","path":"modules/a_first.md","priority":20}`,
+		`{"id":"beta.b","path":"modules/b_second.md","priority":10}`,
+	}
+	reversed := func(entries []string) []string {
+		out := slices.Clone(entries)
+		slices.Reverse(out)
+		return out
+	}
+
+	buildProject := func(alphaEntries, betaEntries []string, depOrder []string) map[string]string {
+		t.Helper()
+		projectDir := t.TempDir()
+		for name, entries := range map[string][]string{"alpha": alphaEntries, "beta": betaEntries} {
+			src := createLocalSourcePackWithManifest(t, modules, manifest(name, entries))
+			if err := os.CopyFS(filepath.Join(projectDir, "packs", name), os.DirFS(src)); err != nil {
+				t.Fatalf("copy pack: %v", err)
+			}
+		}
+		cfg := config.DefaultRuleset("proj")
+		for _, name := range depOrder {
+			cfg.Dependencies = append(cfg.Dependencies, config.Dependency{Source: "local", Path: "packs/" + name, Export: "default"})
+		}
+		if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+			t.Fatalf("save ruleset: %v", err)
+		}
+		a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+			t.Fatalf("install failed: %v", err)
+		}
+		if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "all"); err != nil {
+			t.Fatalf("build failed: %v", err)
+		}
+		files := map[string]string{}
+		for _, dir := range []string{".cursor", ".github", ".codex", ".claude"} {
+			err := filepath.WalkDir(filepath.Join(projectDir, dir), func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				content, err := os.ReadFile(path)
+				rel, _ := filepath.Rel(projectDir, path)
+				files[filepath.ToSlash(rel)] = string(content)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("walk %s: %v", dir, err)
+			}
+		}
+		return files
+	}
+
+	first := buildProject(alpha, beta, []string{"alpha", "beta"})
+	second := buildProject(reversed(alpha), reversed(beta), []string{"beta", "alpha"})
+	if len(first) == 0 {
+		t.Fatalf("expected build outputs")
+	}
+	if !reflect.DeepEqual(first, second) {
+		for name, content := range first {
+			if second[name] != content {
+				t.Fatalf("%s differs between input orders:\n%s\n---\n%s", name, content, second[name])
+			}
+		}
+		t.Fatalf("output files differ between input orders: %v vs %v", slices.Sorted(maps.Keys(first)), slices.Sorted(maps.Keys(second)))
+	}
+}
+
+func TestBuildCommandJSON_ReorderedDependenciesKeepLock(t *testing.T) {
+	projectDir := t.TempDir()
+	for _, id := range []string{"alpha.base", "beta.base"} {
+		src := createLocalSourcePackWithID(t, id, id+" rule\n")
+		if err := os.CopyFS(filepath.Join(projectDir, "packs", id), os.DirFS(src)); err != nil {
+			t.Fatalf("copy pack: %v", err)
+		}
+	}
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: "packs/alpha.base", Export: "default"},
+		{Source: "local", Path: "packs/beta.base", Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	slices.Reverse(cfg.Dependencies)
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build after reorder failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsListCmd(), &env); err != nil {
+		t.Fatalf("deps list failed: %v", err)
+	}
+	var list depsListOutput
+	if err := json.Unmarshal(env.Result, &list); err != nil {
+		t.Fatalf("decode deps list: %v", err)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	if list.Dependencies[0].Locked != lockReference(lock.Resolved[1]) || list.Dependencies[1].Locked != lockReference(lock.Resolved[0]) {
+		t.Fatalf("expected deps list to pair entries by key, got %#v", list.Dependencies)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--plan"); err != nil {
+		t.Fatalf("install plan failed: %v", err)
+	}
+	var plan planOutput
+	if err := json.Unmarshal(env.Result, &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if len(plan.Actions) != 0 {
+		t.Fatalf("expected reordering to plan no lock changes, got %#v", plan.Actions)
+	}
+}
+
+func TestBuildCommandJSON_ReportsTimings(t *testing.T) {
+	projectDir := t.TempDir()
+	src := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	if err := os.CopyFS(filepath.Join(projectDir, "packs", "go.base"), os.DirFS(src)); err != nil {
+		t.Fatalf("copy pack: %v", err)
+	}
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: "packs/go.base", Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var install installOutput
+	if err := json.Unmarshal(env.Result, &install); err != nil {
+		t.Fatalf("decode install: %v", err)
+	}
+	if install.Timings == nil || install.Timings.TotalMs < 0 || install.Timings.TotalMs < install.Timings.ExpandMs {
+		t.Fatalf("expected install timings, got %#v", install.Timings)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode build: %v", err)
+	}
+	if out.Timings == nil {
+		t.Fatalf("expected build timings, got none")
+	}
+	if _, ok := out.Timings.RenderMs["copilot"]; !ok || len(out.Timings.RenderMs) != 1 {
+		t.Fatalf("expected render time for copilot only, got %#v", out.Timings.RenderMs)
+	}
+}
+
+func TestNamedRulesetsKeepSeparateLockfiles(t *testing.T) {
+	t.Cleanup(func() { useRuleset(config.RulesetFileName) })
+	projectDir := t.TempDir()
+	for _, id := range []string{"go.base", "web.base"} {
+		src := createLocalSourcePackWithID(t, id, id+" rule\n")
+		if err := os.CopyFS(filepath.Join(projectDir, "packs", id), os.DirFS(src)); err != nil {
+			t.Fatalf("copy pack: %v", err)
+		}
+	}
+	backend := config.Ruleset{SpecVersion: "0.1", Name: "backend", Targets: map[string]config.TargetEntry{"copilot": {OutFile: "api/copilot.md"}}}
+	backend.Dependencies = []config.Dependency{{Source: "local", Path: "packs/go.base", Export: "default"}}
+	frontend := config.Ruleset{SpecVersion: "0.1", Name: "frontend", Targets: map[string]config.TargetEntry{"copilot": {OutFile: "web/copilot.md"}}}
+	frontend.Dependencies = []config.Dependency{{Source: "local", Path: "packs/web.base", Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), backend); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, "rulepack.frontend.json"), frontend); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	run := func(args ...string) {
+		t.Helper()
+		a := &app{}
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newRootCmd(args), &env, args...); err != nil {
+			t.Fatalf("%v failed: %v", args, err)
+		}
+	}
+	run("--json", "deps", "install")
+	run("--json", "-f", "rulepack.frontend.json", "deps", "install")
+	run("--json", "build", "--target", "copilot")
+	run("--json", "--file", "rulepack.frontend.json", "build", "--target", "copilot")
+
+	for file, want := range map[string]string{"rulepack.lock.json": "packs/go.base", "rulepack.frontend.lock.json": "packs/web.base"} {
+		lock, err := config.LoadLockfile(filepath.Join(projectDir, file))
+		if err != nil {
+			t.Fatalf("load %s: %v", file, err)
+		}
+		if len(lock.Resolved) != 1 || lock.Resolved[0].Path != want {
+			t.Fatalf("expected %s to lock %s, got %#v", file, want, lock.Resolved)
+		}
+	}
+	for file, want := range map[string]string{"api/copilot.md": "go.base rule", "web/copilot.md": "web.base rule"} {
+		data, err := os.ReadFile(filepath.Join(projectDir, file))
+		if err != nil {
+			t.Fatalf("read %s: %v", file, err)
+		}
+		if !strings.Contains(string(data), want) {
+			t.Fatalf("expected %s to contain %q, got:\n%s", file, want, data)
+		}
+	}
+	manifest, err := config.LoadOutputs(filepath.Join(projectDir, ".rulepack", "outputs.frontend.json"))
+	if err != nil {
+		t.Fatalf("load frontend outputs: %v", err)
+	}
+	if files := manifest.Targets["copilot"].Files; len(files) != 1 || files[0].Path != "web/copilot.md" {
+		t.Fatalf("expected frontend manifest to record web/copilot.md, got %#v", manifest.Targets)
+	}
+}
+
+func TestDepsInstall_SelectorsKeepOtherResolutions(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	repo := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	commit := func(msg string) string {
+		t.Helper()
+		for _, args := range [][]string{{"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", msg}} {
+			if _, err := runGit(repo, args...); err != nil {
+				t.Fatalf("git %v: %v", args, err)
+			}
+		}
+		sha, err := runGit(repo, "rev-parse", "HEAD")
+		if err != nil {
+			t.Fatalf("rev-parse: %v", err)
+		}
+		return strings.TrimSpace(sha)
+	}
+	if _, err := runGit(repo, "init"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	first := commit("init")
+
+	projectDir := t.TempDir()
+	if err := os.CopyFS(filepath.Join(projectDir, "packs", "local"), os.DirFS(createLocalSourcePackWithID(t, "python.base", "python rule\n"))); err != nil {
+		t.Fatalf("copy pack: %v", err)
+	}
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "git", URI: repo, Export: "default"},
+		{Name: "house", Source: "local", Path: "packs/local", Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	loadLock := func() config.Lockfile {
+		t.Helper()
+		lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+		if err != nil {
+			t.Fatalf("load lock: %v", err)
+		}
+		return lock
+	}
+	if lock := loadLock(); lock.Resolved[0].Key != "git:"+repo+"#default" || lock.Resolved[1].Key != "name:house" {
+		t.Fatalf("unexpected lock keys: %q, %q", lock.Resolved[0].Key, lock.Resolved[1].Key)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "modules", "go_base.md"), []byte("go rule v2\n"), 0o644); err != nil {
+		t.Fatalf("edit repo: %v", err)
+	}
+	second := commit("update")
+	if err := os.WriteFile(filepath.Join(projectDir, "packs", "local", "modules", "python_base.md"), []byte("python rule v2\n"), 0o644); err != nil {
+		t.Fatalf("edit local pack: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "house"); err != nil {
+		t.Fatalf("partial install failed: %v", err)
+	}
+	if got := loadLock().Resolved[0].Commit; got != first {
+		t.Fatalf("expected unselected git dependency to stay at %s, got %s", first, got)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build after partial install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if got := loadLock().Resolved[0].Commit; got != second {
+		t.Fatalf("expected full install to move git dependency to %s, got %s", second, got)
+	}
+
+	if err := os.Rename(filepath.Join(projectDir, "packs", "local"), filepath.Join(projectDir, "packs", "moved")); err != nil {
+		t.Fatalf("move pack: %v", err)
+	}
+	cfg.Dependencies[1].Path = "packs/moved"
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot")
+	if err == nil || !strings.Contains(err.Error(), "dependency 2 (house) resolves to packs/moved but is locked to packs/local") {
+		t.Fatalf("expected named mismatch, got %v", err)
+	}
+	cfg.Dependencies = cfg.Dependencies[:1]
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot")
+	if err == nil || !strings.Contains(err.Error(), "lock entries name:house match no dependency") {
+		t.Fatalf("expected leftover lock entry to be named, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_StampBuildIDAddsFooter(t *testing.T) {
+	orig := buildVersion
+	buildVersion = "v1.2.3-test"
+	t.Cleanup(func() { buildVersion = orig })
+
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	copilot := cfg.Targets["copilot"]
+	copilot.StampBuildID = true
+	cfg.Targets["copilot"] = copilot
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "all"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(projectDir, ".github", "copilot-instructions.md"))
+	if err != nil {
+		t.Fatalf("read copilot output: %v", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(content), "\n"), "\n")
+	footer := regexp.MustCompile(`^<!-- rulepack:build-id=([0-9a-f]{12})-\d{8}T\d{6}Z-(\S+) -->$`).FindStringSubmatch(lines[len(lines)-1])
+	if footer == nil {
+		t.Fatalf("expected build ID footer as last line, got %q", string(content))
+	}
+	if footer[1] != lock.RulesetDigest[:12] || footer[2] != "v1.2.3-test" {
+		t.Fatalf("unexpected build ID footer %q", lines[len(lines)-1])
+	}
+	claude, err := os.ReadFile(filepath.Join(projectDir, ".claude", "rules", "100-python_base.md"))
+	if err != nil {
+		t.Fatalf("read claude output: %v", err)
+	}
+	if strings.Contains(string(claude), "rulepack:build-id") {
+		t.Fatalf("expected unstamped target to have no footer, got %q", string(claude))
+	}
+
+	var again jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &again, "--target", "copilot"); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(again.Result, &out); err != nil {
+		t.Fatalf("decode build: %v", err)
+	}
+	if len(out.Targets) != 1 || out.Targets[0].Status != "unchanged" {
+		t.Fatalf("expected stamped target to stay unchanged on rebuild, got %+v", out.Targets)
+	}
+}
+
+func TestServeCommand_AnswersRequestsInProcess(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	var in bytes.Buffer
+	for _, req := range []string{
+		`{"jsonrpc":"2.0","id":1,"method":"drift"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"build","params":{"args":["--target","copilot"]}}`,
+		`{"jsonrpc":"2.0","method":"build"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"modules","params":{"args":["--target","copilot"]}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"nope"}`,
+		`{"jsonrpc":"2.0","id":5,"method":"shutdown"}`,
+		`{"jsonrpc":"2.0","id":6,"method":"drift"}`,
+	} {
+		fmt.Fprintf(&in, "Content-Length: %d\r\n\r\n%s", len(req), req)
+	}
+	serve := a.newServeCmd()
+	serve.SetIn(&in)
+	var out bytes.Buffer
+	serve.SetOut(&out)
+	if err := runCmd(t, projectDir, serve); err != nil {
+		t.Fatalf("serve failed: %v", err)
+	}
+
+	reader := bufio.NewReader(&out)
+	responses := map[string]rpcResponse{}
+	for {
+		body, err := readRPCMessage(reader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read response: %v", err)
+		}
+		var resp rpcResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("decode response: %v", err)
+		}
+		responses[string(resp.ID)] = resp
+	}
+	if len(responses) != 5 {
+		t.Fatalf("expected responses to ids 1-5 only, got %v", responses)
+	}
+	if resp := responses["1"]; resp.Error == nil || resp.Error.Code != serveCommandFailed || len(resp.Error.Data) == 0 {
+		t.Fatalf("expected drift to fail with the build --check report before building, got %+v", resp)
+	}
+	var built jsonEnvelope
+	if err := json.Unmarshal(responses["2"].Result, &built); err != nil || built.Command != "build" {
+		t.Fatalf("expected build envelope, got %s (%v)", responses["2"].Result, err)
+	}
+	var effective jsonEnvelope
+	if err := json.Unmarshal(responses["3"].Result, &effective); err != nil || effective.Command != "effective" {
+		t.Fatalf("expected effective envelope, got %s (%v)", responses["3"].Result, err)
+	}
+	if resp := responses["4"]; resp.Error == nil || resp.Error.Code != serveMethodNotFound {
+		t.Fatalf("expected method not found, got %+v", resp)
+	}
+	if resp := responses["5"]; resp.Error != nil || string(resp.Result) != "null" {
+		t.Fatalf("expected shutdown acknowledgement, got %+v", resp)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".github", "copilot-instructions.md")); err != nil {
+		t.Fatalf("expected build request to write outputs: %v", err)
+	}
+}
+
+func TestBuildCommand_StdoutWritesTargetWithoutTouchingWorktree(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	jsonApp := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, jsonApp.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+	a := &app{renderer: cliout.NewHumanRenderer(true)}
+	buildCmd := a.newBuildCmd()
+	buildCmd.SetArgs([]string{"--target", "codex", "--stdout"})
+	out, err := captureStdout(buildCmd.Execute)
+	if err != nil {
+		t.Fatalf("build --stdout failed: %v", err)
+	}
+	if !strings.HasPrefix(string(out), "<!-- rulepack:managed -->") || !strings.Contains(string(out), "base rule") {
+		t.Fatalf("unexpected stdout: %q", out)
+	}
+	if _, err := os.Stat(cfg.Targets["codex"].OutFile); !os.IsNotExist(err) {
+		t.Fatalf("expected no codex output on disk, stat err=%v", err)
+	}
+
+	allCmd := a.newBuildCmd()
+	allCmd.SetArgs([]string{"--stdout"})
+	if _, err := captureStdout(allCmd.Execute); err == nil || !strings.Contains(err.Error(), "single --target") {
+		t.Fatalf("expected --stdout to require a single target, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_NamedTargetsShareRendererType(t *testing.T) {
+	projectDir := t.TempDir()
+	pythonDir := createLocalSourcePackWithID(t, "python.base", "python rule\n")
+	goDir := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	relPython, _ := filepath.Rel(projectDir, pythonDir)
+	relGo, _ := filepath.Rel(projectDir, goDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relPython), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relGo), Export: "default"},
+	}
+	cfg.Targets["python-docs"] = config.TargetEntry{Type: "copilot", OutFile: "docs/python.md", Include: []string{"python.*"}}
+	cfg.Targets["go-docs"] = config.TargetEntry{Type: "copilot", OutFile: "docs/go.md", Include: []string{"go.*"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	python, err := os.ReadFile(filepath.Join(projectDir, "docs", "python.md"))
+	if err != nil {
+		t.Fatalf("read python-docs output: %v", err)
+	}
+	if !strings.Contains(string(python), "python rule") || strings.Contains(string(python), "go rule") {
+		t.Fatalf("unexpected python-docs output: %q", python)
+	}
+	goDocs, err := os.ReadFile(filepath.Join(projectDir, "docs", "go.md"))
+	if err != nil {
+		t.Fatalf("read go-docs output: %v", err)
+	}
+	if !strings.Contains(string(goDocs), "go rule") || strings.Contains(string(goDocs), "python rule") {
+		t.Fatalf("unexpected go-docs output: %q", goDocs)
+	}
+}
+
+func TestBuildCommandJSON_DisableModulesPerTarget(t *testing.T) {
+	projectDir := t.TempDir()
+	baseDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	styleDir := createLocalSourcePackWithID(t, "style.verbose", "verbose style rule\n")
+	relBase, _ := filepath.Rel(projectDir, baseDir)
+	relStyle, _ := filepath.Rel(projectDir, styleDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relBase), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relStyle), Export: "default"},
+	}
+	copilot := cfg.Targets["copilot"]
+	copilot.DisableModules = []string{"style.*"}
+	cfg.Targets["copilot"] = copilot
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build copilot failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "codex"); err != nil {
+		t.Fatalf("build codex failed: %v", err)
+	}
+
+	copilotOut, err := os.ReadFile(filepath.Join(projectDir, cfg.Targets["copilot"].OutFile))
+	if err != nil {
+		t.Fatalf("read copilot output: %v", err)
+	}
+	if !strings.Contains(string(copilotOut), "base rule") || strings.Contains(string(copilotOut), "verbose style rule") {
+		t.Fatalf("expected disabled module to be dropped from copilot: %q", copilotOut)
+	}
+	codexOut, err := os.ReadFile(filepath.Join(projectDir, cfg.Targets["codex"].OutFile))
+	if err != nil {
+		t.Fatalf("read codex output: %v", err)
+	}
+	if !strings.Contains(string(codexOut), "verbose style rule") {
+		t.Fatalf("expected other targets to keep the module: %q", codexOut)
+	}
+}
+
+func TestBuildCommandJSON_WhenConditionsFollowPlatform(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/base.md":    "base rule\n",
+		"modules/posix.md":   "use forward slashes\n",
+		"modules/windows.md": "use backslashes\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "shell.base", "path": "modules/base.md", "priority": 10 },
+    { "id": "shell.posix", "path": "modules/posix.md", "priority": 20, "when": { "os": "linux" } },
+    { "id": "shell.windows", "path": "modules/windows.md", "priority": 20, "when": { "os": "windows" } }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	armDir := createLocalSourcePackWithID(t, "arm.simd", "prefer neon intrinsics\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	relArm, _ := filepath.Rel(projectDir, armDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relArm), Export: "default", When: &config.When{Arch: "arm64"}},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	outPath := filepath.Join(projectDir, ".github", "copilot-instructions.md")
+	for _, tc := range []struct {
+		os, arch string
+		want     []string
+		absent   []string
+	}{
+		{os: "windows", arch: "amd64", want: []string{"base rule", "use backslashes"}, absent: []string{"forward slashes", "neon"}},
+		{os: "linux", arch: "arm64", want: []string{"base rule", "forward slashes", "neon"}, absent: []string{"backslashes"}},
+	} {
+		if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot", "--os", tc.os, "--arch", tc.arch); err != nil {
+			t.Fatalf("build for %s/%s failed: %v", tc.os, tc.arch, err)
+		}
+		content, err := os.ReadFile(outPath)
+		if err != nil {
+			t.Fatalf("read copilot output: %v", err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(content), want) {
+				t.Fatalf("%s/%s output missing %q:\n%s", tc.os, tc.arch, want, content)
+			}
+		}
+		for _, absent := range tc.absent {
+			if strings.Contains(string(content), absent) {
+				t.Fatalf("%s/%s output should not contain %q:\n%s", tc.os, tc.arch, absent, content)
+			}
+		}
+	}
+
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--os", "win")
+	if err == nil || !strings.Contains(err.Error(), `unknown os "win"`) {
+		t.Fatalf("expected unknown os error, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_ValidatesPriorityBands(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{"modules/secrets.md": "no secrets\n"}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [{ "id": "safety.secrets", "path": "modules/secrets.md", "priority": 150, "band": "safety" }],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	cfg.PriorityBands = map[string]string{"safety": "0-99", "style": "100-499"}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), "module safety.secrets: priority 150 is outside band safety (0-99)") {
+		t.Fatalf("expected band violation, got %v", err)
+	}
+	if err := runCmd(t, projectDir, a.newLintCmd()); err == nil || !strings.Contains(err.Error(), "lint found 1 error(s)") {
+		t.Fatalf("expected lint to report the band violation, got %v", err)
+	}
+
+	priority := 20
+	cfg.Overrides = []config.Override{{ID: "safety.secrets", Priority: &priority}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env); err != nil {
+		t.Fatalf("expected override into the band to build, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_PresetSelectsTargets(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	cfg.Presets = map[string][]string{"ci": {"copilot", "codex"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--preset", "ci"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode build output: %v", err)
+	}
+	if len(out.Targets) != 2 || out.Targets[0].Target != "copilot" || out.Targets[1].Target != "codex" {
+		t.Fatalf("expected preset targets copilot and codex, got %+v", out.Targets)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".cursor")); !os.IsNotExist(err) {
+		t.Fatalf("expected no cursor output, stat err=%v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--preset", "ide"); err == nil || !strings.Contains(err.Error(), `unknown preset "ide"`) {
+		t.Fatalf("expected unknown preset error, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_RefusesProtectedOutputs(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	cfg.Protect = &config.Protect{Paths: []string{".github"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), `.github/copilot-instructions.md (protected by ".github")`) {
+		t.Fatalf("expected protected path error, got %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "cursor"); err != nil {
+		t.Fatalf("expected unprotected target to build: %v", err)
+	}
+
+	if _, err := runGit(projectDir, "init", "-q"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, ".gitignore"), []byte(".claude/\n"), 0o644); err != nil {
+		t.Fatalf("write .gitignore: %v", err)
+	}
+	cfg.Protect = &config.Protect{GitIgnored: true}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude")
+	if err == nil || !strings.Contains(err.Error(), ".claude/rules (ignored by .gitignore)") {
+		t.Fatalf("expected gitignored output error, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_RunsTargetFormatters(t *testing.T) {
+	if _, err := exec.LookPath("sed"); err != nil {
+		t.Skip("sed not available")
+	}
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	copilot := cfg.Targets["copilot"]
+	copilot.Format = []string{"sed", "-i", "s/base rule/formatted rule/"}
+	cfg.Targets["copilot"] = copilot
+	codex := cfg.Targets["codex"]
+	codex.Format = []string{"false"}
+	cfg.Targets["codex"] = codex
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build copilot failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(projectDir, ".github", "copilot-instructions.md"))
+	if err != nil {
+		t.Fatalf("read copilot output: %v", err)
+	}
+	if !strings.Contains(string(content), "formatted rule") {
+		t.Fatalf("expected formatter to rewrite output, got %q", content)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "codex"); err != nil {
+		t.Fatalf("formatter failure should not fail build: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode build output: %v", err)
+	}
+	if len(out.Warnings) != 1 || !strings.HasPrefix(out.Warnings[0], "codex formatter: false failed") {
+		t.Fatalf("expected formatter warning, got %v", out.Warnings)
+	}
+}
+
+func TestEffectiveCommandJSON(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newEffectiveCmd(), &env, "--target", "cursor", "--path", "src/app.py"); err != nil {
+		t.Fatalf("effective failed: %v", err)
+	}
+	var out effectiveOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode effective output: %v", err)
+	}
+	if env.Command != "effective" || out.Path != "src/app.py" || len(out.Modules) != 1 || out.Modules[0].Status != "applies" {
+		t.Fatalf("unexpected effective output: %+v", out)
+	}
+}
+
+func TestDepsInstallNotifiesWebhookOfDependencyChanges(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	repo := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/style.md": "style v1\n",
+		"modules/tests.md": "tests v1\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "python-rules",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "python.style", "path": "modules/style.md", "priority": 100 },
+    { "id": "python.tests", "path": "modules/tests.md", "priority": 200 }
+  ]
+}`)
+	commit := func(tag string) {
+		for _, args := range [][]string{{"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", tag}, {"tag", tag}} {
+			if _, err := runGit(repo, args...); err != nil {
+				t.Fatalf("git %v: %v", args, err)
+			}
+		}
+	}
+	if _, err := runGit(repo, "init"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	commit("v1.0.0")
+
+	var payloads []notifyPayload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p notifyPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Errorf("decode payload: %v", err)
+		}
+		payloads = append(payloads, p)
+	}))
+	defer server.Close()
+
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{
+		SpecVersion:  "0.1",
+		Name:         "proj",
+		Dependencies: []config.Dependency{{Source: "git", URI: repo, Version: "^1.0.0"}},
+		Notify:       &config.Notify{Webhook: server.URL},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if len(payloads) != 1 || payloads[0].Event != "deps.install" || payloads[0].Dependencies[0].Change != "added" {
+		t.Fatalf("expected one payload for the added dependency, got %+v", payloads)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("reinstall failed: %v", err)
+	}
+	if len(payloads) != 1 {
+		t.Fatalf("expected no payload when nothing changed, got %+v", payloads)
+	}
+
+	if err := os.WriteFile(filepath.Join(repo, "modules", "style.md"), []byte("style v2\n"), 0o644); err != nil {
+		t.Fatalf("write module: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "modules", "docs.md"), []byte("docs\n"), 0o644); err != nil {
+		t.Fatalf("write module: %v", err)
+	}
+	manifest := `{
+  "specVersion": "0.1",
+  "name": "python-rules",
+  "version": "1.1.0",
+  "modules": [
+    { "id": "python.style", "path": "modules/style.md", "priority": 100 },
+    { "id": "python.tests", "path": "modules/tests.md", "priority": 200 },
+    { "id": "python.docs", "path": "modules/docs.md", "priority": 300 }
+  ]
+}`
+	if err := os.WriteFile(filepath.Join(repo, "rulepack.json"), []byte(manifest), 0o644); err != nil {
+		t.Fatalf("write manifest: %v", err)
+	}
+	commit("v1.1.0")
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install of update failed: %v", err)
+	}
+	if len(payloads) != 2 {
+		t.Fatalf("expected a payload for the update, got %+v", payloads)
+	}
+	got := payloads[1]
+	dep := got.Dependencies[0]
+	if dep.Change != "updated" || dep.Version != "1.1.0" || !reflect.DeepEqual(dep.AddedModules, []string{"python.docs"}) || !reflect.DeepEqual(dep.ChangedModules, []string{"python.style"}) {
+		t.Fatalf("unexpected update payload: %+v", dep)
+	}
+	if want := "proj: " + filepath.Base(repo) + " updated to v1.1.0, 2 modules changed"; got.Text != want {
+		t.Fatalf("expected text %q, got %q", want, got.Text)
+	}
+
+	server.Close()
+	if err := runCmdJSON(t, projectDir, a.newDepsUpdateCmd(), &env, "--no-notify"); err != nil {
+		t.Fatalf("update with --no-notify failed: %v", err)
+	}
+	cfg.Dependencies[0].Version = "1.0.0"
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("expected a failed webhook not to fail install, got %v", err)
+	}
+	var out installOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode install: %v", err)
+	}
+	if len(out.Warnings) != 1 || !strings.HasPrefix(out.Warnings[0], "notify: webhook:") {
+		t.Fatalf("expected a notify warning, got %+v", out.Warnings)
+	}
+}
+
+func TestRequireApprovedGatesInstallAndBuild(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfgPath := filepath.Join(projectDir, config.RulesetFileName)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	if err := config.SaveRuleset(cfgPath, cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--require-approved")
+	if err == nil || !strings.Contains(err.Error(), "approval required: dependency 1") {
+		t.Fatalf("expected unapproved install to fail, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, config.LockFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected no lockfile after a refused install, got err=%v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	cfg.Dependencies[0].Approvals = []config.Approval{{Hash: lock.Resolved[0].ContentHash, Approvers: []string{"@org/governance"}}}
+	if err := config.SaveRuleset(cfgPath, cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--require-approved"); err != nil {
+		t.Fatalf("approved install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--require-approved"); err != nil {
+		t.Fatalf("approved build failed: %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(sourceDir, "modules", "python_base.md"), []byte("changed rule\n"), 0o644); err != nil {
+		t.Fatalf("change module: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--require-approved")
+	if err == nil || !strings.Contains(err.Error(), "not approved") {
+		t.Fatalf("expected build of changed content to need approval, got %v", err)
+	}
+}
+
+func TestCodeownersCommandJSON_MapsGeneratedFilesToModuleOwners(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/go.md":   "go rule\n",
+		"modules/docs.md": "docs rule\n",
+		"modules/misc.md": "misc rule\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "owned",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "go.style", "path": "modules/go.md", "priority": 100, "owner": "@org/backend" },
+    { "id": "docs.style", "path": "modules/docs.md", "priority": 200, "owner": "@org/docs @alice" },
+    { "id": "misc.style", "path": "modules/misc.md", "priority": 300 }
+  ]
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource)}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newCodeownersCmd(), &env, "--target", "copilot", "--target", "claude"); err != nil {
+		t.Fatalf("codeowners failed: %v", err)
+	}
+	var out codeownersOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode codeowners: %v", err)
+	}
+	owners := map[string][]string{}
+	for _, f := range out.Files {
+		owners[f.Path] = f.Owners
+	}
+	if got := owners[".github/copilot-instructions.md"]; !reflect.DeepEqual(got, []string{"@alice", "@org/backend", "@org/docs"}) {
+		t.Fatalf("expected merged file to carry every module owner, got %v in %+v", got, out.Files)
+	}
+	var claude int
+	for _, f := range out.Files {
+		if !strings.HasPrefix(f.Path, ".claude/rules/") {
+			continue
+		}
+		claude++
+		if len(f.Modules) != 1 {
+			t.Fatalf("expected one module per claude file, got %+v", f)
+		}
+		if f.Modules[0] == "misc.style" && len(f.Owners) != 0 {
+			t.Fatalf("expected unowned module file to have no owners, got %+v", f)
+		}
+	}
+	if claude != 3 {
+		t.Fatalf("expected 3 claude files, got %+v", out.Files)
+	}
+
+	codeowners := filepath.Join(projectDir, ".github", "CODEOWNERS")
+	if err := os.MkdirAll(filepath.Dir(codeowners), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(codeowners, []byte("* @org/maintainers\n"), 0o644); err != nil {
+		t.Fatalf("write CODEOWNERS: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := runCmdJSON(t, projectDir, a.newCodeownersCmd(), &env, "--target", "copilot", "--write", ".github/CODEOWNERS"); err != nil {
+			t.Fatalf("codeowners --write failed: %v", err)
+		}
+	}
+	data, err := os.ReadFile(codeowners)
+	if err != nil {
+		t.Fatalf("read CODEOWNERS: %v", err)
+	}
+	want := "* @org/maintainers\n\n" + codeownersBegin + "\n/.github/copilot-instructions.md @alice @org/backend @org/docs\n" + codeownersEnd + "\n"
+	if string(data) != want {
+		t.Fatalf("unexpected CODEOWNERS:\n%s", data)
+	}
+}
+
+func TestCoverageCommandJSON_ReportsUncoveredGroups(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{"modules/go.md": "go rule\n"}, `{
+  "specVersion": "0.1",
+  "name": "globbed",
+  "version": "1.0.0",
+  "modules": [{
+    "id": "go.style",
+    "path": "modules/go.md",
+    "priority": 100,
+    "apply": { "default": { "mode": "glob", "globs": ["src/**/*.go"] } }
+  }]
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource)}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	for _, rel := range []string{"src/api/handler.go", "src/api/client.ts", "docs/guide.md", "node_modules/x/index.js", ".cursor/rules/old.mdc", "gen/out.go"} {
+		full := filepath.Join(projectDir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(full, []byte("x\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", rel, err)
+		}
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newCoverageCmd(), &env, "--target", "nope"); err == nil {
+		t.Fatalf("expected an unknown target to fail")
+	}
+	if err := runCmdJSON(t, projectDir, a.newCoverageCmd(), &env, "--target", "claude", "--exclude", "gen"); err != nil {
+		t.Fatalf("coverage failed: %v", err)
+	}
+	var out coverageOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode coverage: %v", err)
+	}
+	if out.Files != 5 || len(out.Targets) != 1 || out.Targets[0].Target != "claude" {
+		t.Fatalf("unexpected coverage output: %+v", out)
+	}
+	row := out.Targets[0]
+	var api render.CoverageGroup
+	for _, g := range row.Groups {
+		if g.By == "dir" && g.Key == "src/api" {
+			api = g
+		}
+	}
+	if api.Files != 2 || api.Covered != 1 || !reflect.DeepEqual(api.Modules, []string{"go.style"}) {
+		t.Fatalf("unexpected src/api coverage: %+v", api)
+	}
+	if !reflect.DeepEqual(row.UncoveredDirs, []string{".", "docs"}) || !reflect.DeepEqual(row.UncoveredExts, []string{".json", ".md", ".ts"}) {
+		t.Fatalf("unexpected uncovered groups: %+v", row)
+	}
+}
+
+func TestEffectiveCommandJSON_AppliesLocalOverrideFile(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, config.LocalOverridesFileName), []byte(`{"overrides":[{"id":"python.base","priority":7}]}`), 0o644); err != nil {
+		t.Fatalf("write local overrides: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newEffectiveCmd(), &env, "--target", "cursor"); err != nil {
+		t.Fatalf("effective failed: %v", err)
+	}
+	var out effectiveOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode effective output: %v", err)
+	}
+	if len(out.Modules) != 1 || out.Modules[0].Priority != 7 {
+		t.Fatalf("expected local override priority, got %+v", out.Modules)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", filepath.ToSlash(relSource), "--export", "default", "--yes"); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	saved, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if len(saved.Overrides) != 0 {
+		t.Fatalf("local overrides leaked into %s: %+v", config.RulesetFileName, saved.Overrides)
+	}
+}
+
+func TestBuildCommandJSON_FailedTargetLeavesWorktreeUntouched(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	claude := cfg.Targets["claude"]
+	claude.OutFile = "CLAUDE.md"
+	cfg.Targets["claude"] = claude
+	cfg.Presets = map[string][]string{"broken": {"copilot", "claude"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	copilotOut := filepath.Join(projectDir, ".github", "copilot-instructions.md")
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--preset", "broken"); err == nil {
+		t.Fatalf("expected claude target to fail")
+	}
+	if _, err := os.Stat(copilotOut); !os.IsNotExist(err) {
+		t.Fatalf("expected staged copilot output to be discarded, stat err=%v", err)
+	}
+	entries, err := os.ReadDir(projectDir)
+	if err != nil {
+		t.Fatalf("read project dir: %v", err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".rulepack-stage-") {
+			t.Fatalf("expected staging directory to be removed, found %s", e.Name())
+		}
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--preset", "broken", "--no-atomic"); err == nil {
+		t.Fatalf("expected claude target to fail")
+	}
+	if _, err := os.Stat(copilotOut); err != nil {
+		t.Fatalf("expected --no-atomic to keep earlier target output, stat err=%v", err)
+	}
+}
+
+func TestSmoke_FlagsBrokenGeneratedFiles(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newSmokeCmd(), &env); err != nil {
+		t.Fatalf("expected fresh outputs to pass smoke: %v", err)
+	}
+	var out smokeOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal smoke: %v", err)
+	}
+	if len(out.Files) < 4 || out.Failures != 0 {
+		t.Fatalf("unexpected smoke output: %#v", out)
+	}
+
+	mdc := filepath.Join(projectDir, ".cursor", "rules", "100-python_base.mdc")
+	content, err := os.ReadFile(mdc)
+	if err != nil {
+		t.Fatalf("read cursor rule: %v", err)
+	}
+	broken := strings.Replace(string(content), "---\n", "", 1) + "<<<<<<< local\n"
+	if err := os.WriteFile(mdc, []byte(broken), 0o644); err != nil {
+		t.Fatalf("break cursor rule: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newSmokeCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), "1 generated file(s) failed the smoke check") {
+		t.Fatalf("expected smoke to fail, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_OutputManifest(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	manifest, err := config.LoadOutputs(filepath.Join(projectDir, config.OutputsFileName))
+	if err != nil {
+		t.Fatalf("load manifest: %v", err)
+	}
+	files := manifest.Targets["copilot"].Files
+	if len(files) != 1 || files[0].Path != ".github/copilot-instructions.md" || len(files[0].SHA256) != 64 {
+		t.Fatalf("unexpected manifest files: %#v", files)
+	}
+
+	var out buildOutput
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode build: %v", err)
+	}
+	if out.Targets[0].Status != "unchanged" {
+		t.Fatalf("expected no-op rebuild, got %#v", out.Targets)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot", "--check"); err != nil {
+		t.Fatalf("expected check to pass: %v", err)
+	}
+
+	copilotOut := filepath.Join(projectDir, ".github", "copilot-instructions.md")
+	if err := os.WriteFile(copilotOut, []byte("hand edit\n"), 0o644); err != nil {
+		t.Fatalf("edit output: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot", "--check"); err == nil {
+		t.Fatalf("expected check to fail after edit")
+	}
+	err = runCmdJSON(t, projectDir, a.newVerifyOutputsCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), "1 generated file(s) modified or missing") {
+		t.Fatalf("expected verify-outputs to report the edit, got %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("rebuild failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newVerifyOutputsCmd(), &env); err != nil {
+		t.Fatalf("expected verify-outputs to pass after rebuild: %v", err)
+	}
+
+	copilot := cfg.Targets["copilot"]
+	copilot.OutFile = "docs/copilot.md"
+	cfg.Targets["copilot"] = copilot
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build after move failed: %v", err)
+	}
+	if _, err := os.Stat(copilotOut); !os.IsNotExist(err) {
+		t.Fatalf("expected stale output to be pruned, stat err=%v", err)
+	}
+
+	var cleaned cleanOutput
+	if err := runCmdJSON(t, projectDir, a.newCleanCmd(), &env); err != nil {
+		t.Fatalf("clean failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &cleaned); err != nil {
+		t.Fatalf("decode clean: %v", err)
+	}
+	if !reflect.DeepEqual(cleaned.Deleted, []string{"docs/copilot.md"}) {
+		t.Fatalf("unexpected clean result: %#v", cleaned)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, config.OutputsFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected manifest to be removed, stat err=%v", err)
+	}
+}
+
+func TestBuildCommandJSON_RulepackIgnoreExcludesModules(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/base.md":  "base rule\n",
+		"modules/draft.md": "draft rule\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "team.base", "path": "modules/base.md", "priority": 100 },
+    { "id": "team.draft", "path": "modules/draft.md", "priority": 200 }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(projectDir, config.IgnoreFileName), []byte("# not ready yet\nteam.draft\n"), 0o644); err != nil {
+		t.Fatalf("write ignore file: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var installed installOutput
+	if err := json.Unmarshal(env.Result, &installed); err != nil {
+		t.Fatalf("decode install: %v", err)
+	}
+	if installed.Resolved[0].Ignored != 1 {
+		t.Fatalf("expected install to report 1 ignored module, got %#v", installed.Resolved)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode build: %v", err)
+	}
+	if out.ModuleCount != 1 {
+		t.Fatalf("expected 1 composed module, got %d", out.ModuleCount)
+	}
+	content, err := os.ReadFile(filepath.Join(projectDir, ".github", "copilot-instructions.md"))
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if strings.Contains(string(content), "draft rule") || !strings.Contains(string(content), "base rule") {
+		t.Fatalf("expected draft module to be excluded, got:\n%s", content)
+	}
+}
+
+func TestBuildCommandJSON_RejectsOutputsOutsideProject(t *testing.T) {
+	outside := t.TempDir()
+	projectDir := filepath.Join(t.TempDir(), "proj")
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	for _, tc := range []struct {
+		target, outFile, written, wantErr string
+	}{
+		{"codex", filepath.ToSlash(filepath.Join(outside, "abs", "AGENTS.md")), filepath.Join(outside, "abs", "AGENTS.md"), "must be relative to the project"},
+		{"zed", "../up.rules", filepath.Join(filepath.Dir(projectDir), "up.rules"), "resolves outside the project"},
+	} {
+		if err := os.MkdirAll(projectDir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		manifest := fmt.Sprintf(`{"specVersion":"0.1","name":"proj","dependencies":[{"source":"local","path":%q}],"targets":{%q:{"outFile":%q}}}`, filepath.ToSlash(relSource), tc.target, tc.outFile)
+		if err := os.WriteFile(filepath.Join(projectDir, config.RulesetFileName), []byte(manifest), 0o644); err != nil {
+			t.Fatalf("write ruleset: %v", err)
+		}
+		a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+		var env jsonEnvelope
+		err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", tc.target, "--plan")
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Fatalf("%s: expected %q, got %v", tc.target, tc.wantErr, err)
+		}
+		if _, err := os.Stat(tc.written); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected build --plan not to write %s, stat err=%v", tc.target, tc.written, err)
+		}
+	}
+}
+
+func TestPlanCommandsJSON_ReportWithoutApplying(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	var plan planOutput
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--plan"); err != nil {
+		t.Fatalf("install --plan failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if env.Command != "plan" || plan.Command != "install" || len(plan.Actions) != 2 || plan.Actions[1].Target != config.LockFileName || plan.Actions[1].Action != "create" {
+		t.Fatalf("unexpected install plan: %#v", plan)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, config.LockFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected install --plan not to write the lockfile, stat err=%v", err)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot", "--plan"); err != nil {
+		t.Fatalf("build --plan failed: %v", err)
+	}
+	plan = planOutput{}
+	if err := json.Unmarshal(env.Result, &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	want := []planAction{{Action: "create", Kind: "file", Target: ".github/copilot-instructions.md", Detail: "copilot"}}
+	if !reflect.DeepEqual(plan.Actions, want) || plan.RequiresConfirmation {
+		t.Fatalf("unexpected build plan: %#v", plan)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".github", "copilot-instructions.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected build --plan not to write outputs, stat err=%v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot", "--diff"); err != nil {
+		t.Fatalf("build --diff failed: %v", err)
+	}
+	plan = planOutput{}
+	if err := json.Unmarshal(env.Result, &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if len(plan.Diffs) != 1 || plan.Diffs[0].Title != ".github/copilot-instructions.md" || plan.Diffs[0].Before != "" || !strings.Contains(plan.Diffs[0].After, "base rule") {
+		t.Fatalf("unexpected build --diff diffs: %#v", plan.Diffs)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".github", "copilot-instructions.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected build --diff not to write outputs, stat err=%v", err)
+	}
+
+	plan = planOutput{}
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", filepath.ToSlash(relSource), "--export", "default", "--plan"); err != nil {
+		t.Fatalf("add --plan failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &plan); err != nil {
+		t.Fatalf("decode plan: %v", err)
+	}
+	if plan.Actions[0].Action != "replace" || !plan.RequiresConfirmation || len(plan.Risks) != 1 || len(plan.Risks[0].Preview) != 2 {
+		t.Fatalf("expected replace plan with confirmation risk, got %#v", plan)
+	}
+}
+
+func TestUndoCommandJSON_RestoresBeforeUninstall(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "--yes"); err != nil {
+		t.Fatalf("uninstall failed: %v", err)
+	}
+
+	var out undoOutput
+	if err := runCmdJSON(t, projectDir, a.newUndoCmd(), &env); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode undo: %v", err)
+	}
+	if out.Command != "deps uninstall" || !reflect.DeepEqual(out.Restored, []string{"rulepack.json", "rulepack.lock.json"}) {
+		t.Fatalf("unexpected undo result: %#v", out)
+	}
+	restored, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if len(restored.Dependencies) != 1 {
+		t.Fatalf("expected uninstalled dependency to be restored, got %#v", restored.Dependencies)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newUndoCmd(), &env); err != nil {
+		t.Fatalf("undo install failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, config.LockFileName)); !os.IsNotExist(err) {
+		t.Fatalf("expected undoing the first install to remove the lockfile, stat err=%v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newUndoCmd(), &env); err == nil || !strings.Contains(err.Error(), "nothing to undo") {
+		t.Fatalf("expected empty history error, got %v", err)
+	}
+}
+
+func TestHistoryCommandJSON_RecordsMutatingCommands(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	run := func(args ...string) (jsonEnvelope, error) {
+		a := &app{}
+		var env jsonEnvelope
+		err := runCmdJSON(t, projectDir, a.newRootCmd(args), &env, args...)
+		return env, err
+	}
+	if _, err := run("--json", "deps", "install"); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if _, err := run("--json", "deps", "list"); err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if _, err := run("--json", "deps", "uninstall", "1", "--yes"); err != nil {
+		t.Fatalf("uninstall failed: %v", err)
+	}
+
+	env, err := run("--json", "history")
+	if err != nil {
+		t.Fatalf("history failed: %v", err)
+	}
+	var out historyOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(out.Entries) != 2 {
+		t.Fatalf("expected only mutating commands to be recorded, got %#v", out.Entries)
+	}
+	install, uninstall := out.Entries[0], out.Entries[1]
+	if install.Command != "deps install" || uninstall.Command != "deps uninstall" {
+		t.Fatalf("unexpected commands: %q, %q", install.Command, uninstall.Command)
+	}
+	if !reflect.DeepEqual(uninstall.Args, []string{"--json", "deps", "uninstall", "1", "--yes"}) {
+		t.Fatalf("unexpected args: %#v", uninstall.Args)
+	}
+	if install.Time == "" || install.Hashes[config.LockFileName] == "" {
+		t.Fatalf("expected time and lockfile hash, got %#v", install)
+	}
+	if install.Hashes[config.RulesetFileName] == uninstall.Hashes[config.RulesetFileName] {
+		t.Fatalf("expected ruleset hash to change after uninstall")
+	}
+
+	env, err = run("--json", "history", "--limit", "1")
+	if err != nil {
+		t.Fatalf("history --limit failed: %v", err)
+	}
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(out.Entries) != 1 || out.Entries[0].Command != "deps uninstall" {
+		t.Fatalf("expected newest entry only, got %#v", out.Entries)
+	}
+}
+
+func TestForEachCommandJSON_AggregatesProjects(t *testing.T) {
+	t.Setenv("RULEPACK_TEST_MAIN", "1")
+	root := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	for _, name := range []string{"svc-a", "team/svc-b"} {
+		projectDir := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(projectDir, 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		relSource, _ := filepath.Rel(projectDir, sourceDir)
+		cfg := config.DefaultRuleset(filepath.Base(name))
+		cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+		if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+			t.Fatalf("save ruleset: %v", err)
+		}
+	}
+	for dir, body := range map[string]string{
+		"broken":           "{",
+		"packs/shared":     `{"specVersion":"0.1","name":"shared","version":"1.0.0","modules":[]}`,
+		"node_modules/dep": `{"specVersion":"0.1","name":"dep","targets":{"codex":{"outFile":"x.md"}}}`,
+		".hidden/ignored":  `{"specVersion":"0.1","name":"hidden","targets":{"codex":{"outFile":"x.md"}}}`,
+	} {
+		if err := os.MkdirAll(filepath.Join(root, filepath.FromSlash(dir)), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(dir), config.RulesetFileName), []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+
+	args := []string{"--json", "for-each", "--root", root, "--", "rulepack", "deps", "install"}
+	a := &app{}
+	err := runCmd(t, root, a.newRootCmd(args), args...)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 project(s) failed") {
+		t.Fatalf("expected one failed project, got %v", err)
+	}
+
+	projects, err := discoverProjects(root)
+	if err != nil {
+		t.Fatalf("discoverProjects: %v", err)
+	}
+	if !reflect.DeepEqual(projects, []string{"broken", "svc-a", "team/svc-b"}) {
+		t.Fatalf("unexpected projects: %#v", projects)
+	}
+	for _, name := range []string{"svc-a", "team/svc-b"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name), config.LockFileName)); err != nil {
+			t.Fatalf("expected for-each install to write %s lockfile: %v", name, err)
+		}
+	}
+
+	var env jsonEnvelope
+	args = []string{"--json", "for-each", "--root", filepath.Join(root, "team"), "--", "deps", "list"}
+	a = &app{}
+	if err := runCmdJSON(t, root, a.newRootCmd(args), &env, args...); err != nil {
+		t.Fatalf("for-each failed: %v", err)
+	}
+	var out forEachOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode for-each: %v", err)
+	}
+	if len(out.Projects) != 1 || out.Failed != 0 {
+		t.Fatalf("unexpected report: %#v", out)
+	}
+	row := out.Projects[0]
+	if row.Project != "svc-b" || row.Status != "ok" || row.Command != "deps.list" {
+		t.Fatalf("unexpected project row: %#v", row)
+	}
+	var list depsListOutput
+	if err := json.Unmarshal(row.Result, &list); err != nil {
+		t.Fatalf("decode nested result: %v", err)
+	}
+	if len(list.Dependencies) != 1 || list.Dependencies[0].Locked == "" {
+		t.Fatalf("expected locked dependency in nested result, got %#v", list.Dependencies)
+	}
+}
+
+func TestFmtCommandJSON_FormatsPackAndProject(t *testing.T) {
+	packDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/a.md": "alpha  \n\n\n",
+		"modules/b.md": "beta\n",
+	}, `{"specVersion":"0.1","name":"source-pack","version":"1.0.0","modules":[{"id":"b","path":"modules/b.md","priority":20},{"id":"a","path":"modules/a.md","priority":10}]}`)
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, packDir, a.newFmtCmd(), &env, "--check")
+	if err == nil || !strings.Contains(err.Error(), "2 file(s) need formatting") {
+		t.Fatalf("expected check failure, got %v", err)
+	}
+	if err := runCmdJSON(t, packDir, a.newFmtCmd(), &env); err != nil {
+		t.Fatalf("fmt failed: %v", err)
+	}
+	var out fmtOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode fmt output: %v", err)
+	}
+	want := []fmtFileRow{
+		{Path: "rulepack.json", Status: "formatted"},
+		{Path: "modules/a.md", Status: "formatted"},
+		{Path: "modules/b.md", Status: "unchanged"},
+	}
+	if env.Command != "fmt" || out.Changed != 2 || !reflect.DeepEqual(out.Files, want) {
+		t.Fatalf("unexpected fmt output: %+v", out)
+	}
+	content, err := os.ReadFile(filepath.Join(packDir, "modules", "a.md"))
+	if err != nil || string(content) != "alpha\n" {
+		t.Fatalf("module not formatted: %q (%v)", content, err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(packDir, "rulepack.json"))
+	if err != nil || strings.Index(string(manifest), `"id": "a"`) > strings.Index(string(manifest), `"id": "b"`) {
+		t.Fatalf("modules not sorted by priority:\n%s", manifest)
+	}
+	if err := runCmdJSON(t, packDir, a.newFmtCmd(), &env, "--check"); err != nil {
+		t.Fatalf("formatted pack should pass --check: %v", err)
+	}
+
+	projectDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(projectDir, config.RulesetFileName), []byte(`{"name":"proj","specVersion":"0.1"}`), 0o644); err != nil {
+		t.Fatalf("write ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newFmtCmd(), &env); err != nil {
+		t.Fatalf("fmt project failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil || string(data) != "{\n  \"specVersion\": \"0.1\",\n  \"name\": \"proj\"\n}\n" {
+		t.Fatalf("unexpected project format: %q (%v)", data, err)
+	}
+}
+
+func TestLintCommandJSON_EnforcesTerminology(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "net.hosts", "Keep a whitelist of hosts.\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	cfg.Terminology = &config.Terminology{Preferred: map[string]string{"whitelist": "allowlist"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newLintCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("lint with only preferred-term warnings failed: %v", err)
+	}
+	var out lintOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode lint output: %v", err)
+	}
+	if out.Warnings != 1 || out.Issues[0].Rule != "preferred-term" || out.Issues[0].Module != "net.hosts" {
+		t.Fatalf("unexpected lint output: %+v", out)
+	}
+
+	cfg.Terminology.Banned = []string{"hosts"}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmd(t, projectDir, a.newLintCmd(), "--target", "copilot"); err == nil || !strings.Contains(err.Error(), "lint found 1 error(s)") {
+		t.Fatalf("expected banned term to fail lint, got %v", err)
+	}
+}
+
+func TestLintCommand_ProblemsPointAtModuleSource(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := filepath.Join(projectDir, "packs", "net")
+	if err := os.CopyFS(sourceDir, os.DirFS(createLocalSourcePackWithID(t, "net.hosts", "# Hosts\n\nKeep a whitelist of hosts.\n"))); err != nil {
+		t.Fatalf("copy pack: %v", err)
+	}
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: "packs/net", Export: "default"}}
+	cfg.Terminology = &config.Terminology{Banned: []string{"whitelist"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+	p := &app{renderer: cliout.NewProblemsRenderer(config.RulesetFileName), problems: true}
+	lintCmd := p.newLintCmd()
+	lintCmd.SetArgs([]string{"--target", "copilot"})
+	text, err := captureStdout(lintCmd.Execute)
+	if err == nil || !strings.Contains(err.Error(), "lint found 1 error(s)") {
+		t.Fatalf("expected banned term to fail lint, got %v", err)
+	}
+	want := "packs/net/modules/net_hosts.md:3: error: banned term \"whitelist\" on line 3 (module net.hosts at modules/net_hosts.md, target ) [banned-term]\n"
+	if string(text) != want {
+		t.Fatalf("unexpected problems output:\n%s\nwant:\n%s", text, want)
+	}
+}
+
+func TestLintCommandJSON_WritesSARIF(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/api.md": "api\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    {
+      "id": "a.api",
+      "path": "modules/api.md",
+      "priority": 100,
+      "apply": { "targets": { "claude": { "mode": "glob" } } }
+    }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	err := runCmd(t, projectDir, a.newLintCmd(), "--target", "claude", "--sarif", "lint.sarif")
+	if err == nil || !strings.Contains(err.Error(), "lint found 1 error(s)") {
+		t.Fatalf("expected lint error, got %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(projectDir, "lint.sarif"))
+	if err != nil {
+		t.Fatalf("read sarif: %v", err)
+	}
+	var log struct {
+		Version string `json:"version"`
+		Runs    []struct {
+			Tool struct {
+				Driver struct {
+					Rules []struct {
+						ID string `json:"id"`
+					} `json:"rules"`
+				} `json:"driver"`
+			} `json:"tool"`
+			Results []struct {
+				RuleID    string `json:"ruleId"`
+				Level     string `json:"level"`
+				Locations []struct {
+					PhysicalLocation struct {
+						ArtifactLocation struct {
+							URI string `json:"uri"`
+						} `json:"artifactLocation"`
+					} `json:"physicalLocation"`
+					LogicalLocations []struct {
+						Name string `json:"name"`
+					} `json:"logicalLocations"`
+				} `json:"locations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	if err := json.Unmarshal(data, &log); err != nil {
+		t.Fatalf("decode sarif: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Tool.Driver.Rules) != len(render.LintRules) {
+		t.Fatalf("unexpected sarif log: %s", data)
+	}
+	results := log.Runs[0].Results
+	if len(results) != 1 || results[0].RuleID != "glob-without-globs" || results[0].Level != "error" {
+		t.Fatalf("unexpected sarif results: %s", data)
+	}
+	loc := results[0].Locations[0]
+	if loc.PhysicalLocation.ArtifactLocation.URI != config.RulesetFileName || loc.LogicalLocations[0].Name != "a.api" {
+		t.Fatalf("unexpected sarif location: %s", data)
+	}
+}
+
+func TestInstallAndLintJSON_WarnOnSharedNamespace(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.DefaultRuleset("proj")
+	for _, name := range []string{"py-core", "py-extra"} {
+		id := "python." + strings.TrimPrefix(name, "py-")
+		sourceDir := createLocalSourcePackWithManifest(t, map[string]string{"modules/rule.md": name + "\n"}, `{
+  "specVersion": "0.1",
+  "name": "`+name+`",
+  "version": "1.0.0",
+  "modules": [{ "id": "`+id+`", "path": "modules/rule.md", "priority": 100 }],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+		relSource, _ := filepath.Rel(projectDir, sourceDir)
+		cfg.Dependencies = append(cfg.Dependencies, config.Dependency{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"})
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var install installOutput
+	if err := json.Unmarshal(env.Result, &install); err != nil {
+		t.Fatalf("decode install: %v", err)
+	}
+	want := `namespace "python" is shared by packs py-core (python.core), py-extra (python.extra)`
+	if !reflect.DeepEqual(install.Warnings, []string{want}) {
+		t.Fatalf("unexpected install warnings: %#v", install.Warnings)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newLintCmd(), &env); err != nil {
+		t.Fatalf("lint failed: %v", err)
+	}
+	var lint lintOutput
+	if err := json.Unmarshal(env.Result, &lint); err != nil {
+		t.Fatalf("decode lint: %v", err)
+	}
+	if lint.Warnings != 1 || lint.Issues[0].Rule != "namespace-collision" || lint.Issues[0].Message != want {
+		t.Fatalf("unexpected lint issues: %#v", lint.Issues)
+	}
+}
+
+func TestBuildCommandJSON_ClaudeTargetWritesNestedOutput(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/backend/api/auth.md": "auth rule\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "backend.api.auth", "path": "modules/backend/api/auth.md", "priority": 100 }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	outFile := filepath.Join(projectDir, ".claude", "rules", "backend", "api", "100-auth.md")
+	if _, err := os.Stat(outFile); err != nil {
+		t.Fatalf("expected nested claude output, stat err=%v", err)
+	}
+}
+
+func TestBuildCommandJSON_CursorTargetWritesNestedOutput(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/backend/api/auth.md": "auth rule\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    { "id": "backend.api.auth", "path": "modules/backend/api/auth.md", "priority": 100 }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "cursor"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	outFile := filepath.Join(projectDir, ".cursor", "rules", "backend", "api", "100-auth.mdc")
+	if _, err := os.Stat(outFile); err != nil {
+		t.Fatalf("expected nested cursor output, stat err=%v", err)
+	}
+}
+
+func TestBuildCommandJSON_ClaudeTargetNeverSkipsModuleFile(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/never.md": "never\n",
+		"modules/keep.md":  "keep\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    {
+      "id": "a.never",
+      "path": "modules/never.md",
+      "priority": 100,
+      "apply": { "targets": { "claude": { "mode": "never" } } }
+    },
+    { "id": "b.keep", "path": "modules/keep.md", "priority": 110 }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(projectDir, ".claude", "rules", "100-never.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected never file to be skipped, stat err=%v", err)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".claude", "rules", "110-keep.md")); err != nil {
+		t.Fatalf("expected keep file to exist, stat err=%v", err)
+	}
+}
+
+func TestBuildCommandJSON_ClaudeTargetGlobIncludesPathsFrontmatter(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/api.md": "api\n",
+	}, `{
+  "specVersion": "0.1",
+  "name": "source-pack",
+  "version": "1.0.0",
+  "modules": [
+    {
+      "id": "api.rule",
+      "path": "modules/api.md",
+      "priority": 100,
+      "apply": { "targets": { "claude": { "mode": "glob", "globs": ["src/api/**/*.ts"] } } }
+    }
+  ],
+  "exports": { "default": { "include": ["**"] } }
+}`)
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(projectDir, ".claude", "rules", "100-api.md"))
+	if err != nil {
+		t.Fatalf("read claude file: %v", err)
+	}
+	got := string(content)
+	if !strings.HasPrefix(got, "---\npaths:\n") || !strings.Contains(got, "\"src/api/**/*.ts\"") {
+		t.Fatalf("expected paths frontmatter, got %q", got)
+	}
+}
+
+func TestBuildCommandJSON_ClaudeTargetRejectsOutFile(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	cfg.Targets["claude"] = config.TargetEntry{OutFile: "CLAUDE.md", PerModule: true}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude")
+	if err == nil || !strings.Contains(err.Error(), "claude target does not support outFile with perModule=true; use outDir") {
+		t.Fatalf("expected outFile validation error, got %v", err)
+	}
+}
+
+func TestBuildCommandJSON_ClaudeTargetWritesMergedClaudeMD(t *testing.T) {
+	projectDir := t.TempDir()
+	sourceDir := createLocalSourcePackWithID(t, "python.base", "base rule\n")
+	relSource, _ := filepath.Rel(projectDir, sourceDir)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(relSource), Export: "default"}}
+	cfg.Targets["claude"] = config.TargetEntry{PerModule: false}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode build: %v", err)
+	}
+	if len(out.Targets) != 1 || out.Targets[0].Output != "CLAUDE.md" {
+		t.Fatalf("expected build to report CLAUDE.md, got %+v", out.Targets)
+	}
+	data, err := os.ReadFile(filepath.Join(projectDir, "CLAUDE.md"))
+	if err != nil {
+		t.Fatalf("read CLAUDE.md: %v", err)
+	}
+	if !strings.Contains(string(data), "base rule") {
+		t.Fatalf("expected module content in CLAUDE.md, got:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(projectDir, ".claude", "rules")); !os.IsNotExist(err) {
+		t.Fatalf("expected no per-module claude output, got err=%v", err)
+	}
+}
+
+func TestAddCommandJSON_RequiresYesWhenReplacingDependency(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git")
+	if err == nil {
+		t.Fatalf("expected add to fail without --yes when replacing dependency")
+	}
+	if !strings.Contains(err.Error(), "rerun with --yes") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git", "--yes"); err != nil {
+		t.Fatalf("add with --yes failed: %v", err)
+	}
+	var out addOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal add result: %v", err)
+	}
+	if out.Action != "replaced" {
+		t.Fatalf("expected replaced action, got %s", out.Action)
+	}
+}
+
+func TestAddCommandJSON_AllowsMultipleExportsSameSource(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "python"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git", "--export", "ml"); err != nil {
+		t.Fatalf("add second export failed: %v", err)
+	}
+	var out addOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal add result: %v", err)
+	}
+	if out.Action != "added" {
+		t.Fatalf("expected added action, got %s", out.Action)
+	}
+	newCfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if len(newCfg.Dependencies) != 2 {
+		t.Fatalf("expected two dependencies, got %#v", newCfg.Dependencies)
+	}
+}
+
+func TestAddCommandJSON_AutoInitWhenMissingRuleset(t *testing.T) {
+	projectDir := t.TempDir()
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "https://example.com/rules.git", "--export", "python"); err != nil {
+		t.Fatalf("add failed: %v", err)
+	}
+	if env.Command != "add" {
+		t.Fatalf("unexpected command: %s", env.Command)
+	}
+
+	var out addOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal add result: %v", err)
+	}
+	if out.Action != "added" {
+		t.Fatalf("expected added action, got %s", out.Action)
+	}
+
+	cfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if cfg.SpecVersion != "0.1" {
+		t.Fatalf("unexpected specVersion: %s", cfg.SpecVersion)
+	}
+	if cfg.Name != filepath.Base(projectDir) {
+		t.Fatalf("expected auto-init name %s, got %s", filepath.Base(projectDir), cfg.Name)
+	}
+	if len(cfg.Dependencies) != 1 {
+		t.Fatalf("expected 1 dependency, got %d", len(cfg.Dependencies))
+	}
+	if cfg.Dependencies[0].URI != "https://example.com/rules.git" || cfg.Dependencies[0].Export != "python" {
+		t.Fatalf("unexpected dependency: %+v", cfg.Dependencies[0])
+	}
+	if _, ok := cfg.Targets["cursor"]; !ok {
+		t.Fatalf("expected default cursor target to be present")
+	}
+}
+
+func TestAddCommandJSON_LocalDependency(t *testing.T) {
+	projectDir := t.TempDir()
+	localPack := createLocalSourcePackWithID(t, "python.base", "python rule\n")
+	relLocal, err := filepath.Rel(projectDir, localPack)
+	if err != nil {
+		t.Fatalf("rel local: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", relLocal, "--export", "python"); err != nil {
+		t.Fatalf("add local failed: %v", err)
+	}
+
+	var out addOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal add output: %v", err)
+	}
+	if out.Dependency.Source != "local" {
+		t.Fatalf("expected local source, got %#v", out.Dependency)
+	}
+	if out.Dependency.Path != filepath.ToSlash(relLocal) {
+		t.Fatalf("expected normalized path %q, got %q", filepath.ToSlash(relLocal), out.Dependency.Path)
+	}
+	if out.Dependency.Export != "python" {
+		t.Fatalf("expected export=python, got %#v", out.Dependency)
+	}
+}
+
+func TestAddCommandJSON_LocalReplacementRequiresYes(t *testing.T) {
+	projectDir := t.TempDir()
+	localPack := createLocalSourcePackWithID(t, "python.base", "python rule\n")
+	relLocal, err := filepath.Rel(projectDir, localPack)
+	if err != nil {
+		t.Fatalf("rel local: %v", err)
+	}
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "local", Path: filepath.ToSlash(relLocal), Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err = runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", relLocal)
+	if err == nil {
+		t.Fatalf("expected local replacement to require --yes")
+	}
+	if !strings.Contains(err.Error(), "rerun with --yes") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", relLocal, "--yes"); err != nil {
+		t.Fatalf("add local with --yes failed: %v", err)
+	}
+}
+
+func TestAddCommandJSON_LocalValidation(t *testing.T) {
+	projectDir := t.TempDir()
+	localPack := createLocalSourcePackWithID(t, "python.base", "python rule\n")
+	relLocal, err := filepath.Rel(projectDir, localPack)
+	if err != nil {
+		t.Fatalf("rel local: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+
+	cases := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "missing source", args: []string{}, wantErr: "missing source: provide <git-url> or --local <path>"},
+		{name: "both source modes", args: []string{"https://example.com/rules.git", "--local", relLocal}, wantErr: "use either <git-url> or --local <path>, not both"},
+		{name: "local plus version", args: []string{"--local", relLocal, "--version", "^1.0.0"}, wantErr: "--version and --ref are only supported for git dependencies"},
+		{name: "local plus ref", args: []string{"--local", relLocal, "--ref", "main"}, wantErr: "--version and --ref are only supported for git dependencies"},
+		{name: "missing local path", args: []string{"--local", filepath.Join(projectDir, "missing-pack")}, wantErr: "local dependency path"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, tc.args...)
+			if err == nil {
+				t.Fatalf("expected error")
+			}
+			if !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestAddCommandJSON_LocalMissingRulepack(t *testing.T) {
+	projectDir := t.TempDir()
+	invalidLocal := filepath.Join(t.TempDir(), "rules")
+	if err := os.MkdirAll(invalidLocal, 0o755); err != nil {
+		t.Fatalf("mkdir invalid local: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsAddCmd(), &env, "--local", invalidLocal)
+	if err == nil {
+		t.Fatalf("expected missing rulepack.json error")
+	}
+	if !strings.Contains(err.Error(), "local dependency missing rulepack.json") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUninstallCommandJSON(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+			{Source: "local", Path: "../local-rules", Export: "local"},
+			{Source: "profile", Profile: "abc123__python__01", Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "abc123__python__01", "--yes"); err != nil {
+		t.Fatalf("uninstall failed: %v", err)
+	}
+	if env.Command != "uninstall" {
+		t.Fatalf("unexpected command: %s", env.Command)
+	}
+
+	var out uninstallOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal uninstall result: %v", err)
+	}
+	if len(out.Removed) != 2 {
+		t.Fatalf("expected 2 removed dependencies, got %d", len(out.Removed))
+	}
+	if out.Remaining != 1 {
+		t.Fatalf("expected 1 remaining dependency, got %d", out.Remaining)
+	}
+	newCfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if len(newCfg.Dependencies) != 1 || newCfg.Dependencies[0].Source != "local" {
+		t.Fatalf("unexpected remaining dependencies: %#v", newCfg.Dependencies)
+	}
+}
+
+func TestUninstallCommandJSON_RequiresYes(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1")
+	if err == nil {
+		t.Fatalf("expected uninstall to fail without --yes")
+	}
+	if !strings.Contains(err.Error(), "rerun with --yes") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUninstallCommand_AmbiguousSelector(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git"},
+			{Source: "git", URI: "https://example.com/rules.git"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "https://example.com/rules.git")
+	if err == nil {
+		t.Fatalf("expected uninstall to fail for ambiguous selector")
+	}
+	if !strings.Contains(err.Error(), "matched multiple dependencies") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestUninstallCommandJSON_CleanupOptional(t *testing.T) {
+	projectDir := t.TempDir()
+	managedOut := filepath.Join(projectDir, "managed.md")
+	if err := os.WriteFile(managedOut, []byte("<!-- rulepack:managed -->\ncontent\n"), 0o644); err != nil {
+		t.Fatalf("write managed output: %v", err)
+	}
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+		},
+		Targets: map[string]config.TargetEntry{
+			"codex": {OutFile: "managed.md"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "--yes"); err != nil {
+		t.Fatalf("uninstall failed: %v", err)
+	}
+	var out uninstallOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal uninstall output: %v", err)
+	}
+	if out.CleanupPerformed {
+		t.Fatalf("cleanup should be skipped by default in non-interactive mode")
+	}
+	if _, err := os.Stat(managedOut); err != nil {
+		t.Fatalf("expected managed output to remain without --cleanup: %v", err)
+	}
+}
+
+func TestUninstallCommandJSON_CleanupWithFlag(t *testing.T) {
+	projectDir := t.TempDir()
+	managedOut := filepath.Join(projectDir, "managed.md")
+	if err := os.WriteFile(managedOut, []byte("<!-- rulepack:managed -->\ncontent\n"), 0o644); err != nil {
+		t.Fatalf("write managed output: %v", err)
+	}
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+		},
+		Targets: map[string]config.TargetEntry{
+			"codex": {OutFile: "managed.md"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsUninstallCmd(), &env, "1", "--yes", "--cleanup"); err != nil {
+		t.Fatalf("uninstall --cleanup failed: %v", err)
+	}
+	var out uninstallOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal uninstall output: %v", err)
+	}
+	if !out.CleanupPerformed || len(out.CleanupDeleted) != 1 {
+		t.Fatalf("expected cleanup to delete one file, got %#v", out)
+	}
+	if _, err := os.Stat(managedOut); !os.IsNotExist(err) {
+		t.Fatalf("expected managed output removed, stat err=%v", err)
+	}
+}
+
+func TestBuildTriagesDuplicateModuleIDs(t *testing.T) {
+	projectDir := t.TempDir()
+	firstDir := createLocalSourcePackWithID(t, "python.base", "first rule\n")
+	secondDir := createLocalSourcePackWithID(t, "python.base", "second rule\n")
+	relFirst, _ := filepath.Rel(projectDir, firstDir)
+	relSecond, _ := filepath.Rel(projectDir, secondDir)
+	outFile := filepath.Join(projectDir, "rules.md")
+	cfg := config.DefaultRuleset("proj")
+	cfg.Targets = map[string]config.TargetEntry{"codex": {OutFile: "rules.md"}}
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relFirst), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relSecond), Export: "default"},
+	}
+	rulesetPath := filepath.Join(projectDir, config.RulesetFileName)
+	if err := config.SaveRuleset(rulesetPath, cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), `duplicate module id "python.base"`) {
+		t.Fatalf("expected duplicate error without a terminal, got %v", err)
+	}
+
+	orig := isInteractiveTerminal
+	t.Cleanup(func() { isInteractiveTerminal = orig })
+	isInteractiveTerminal = func() bool { return true }
+	human := &app{renderer: cliout.NewHumanRenderer(true)}
+	cmd := human.newBuildCmd()
+	cmd.SetIn(strings.NewReader("r\n2\npython.second\n"))
+	if err := runCmd(t, projectDir, cmd, "--target", "codex"); err != nil {
+		t.Fatalf("interactive build failed: %v", err)
+	}
+	saved, err := config.LoadRuleset(rulesetPath)
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if got := saved.Dependencies[1].RenameModules; got["python.base"] != "python.second" || saved.Dependencies[0].RenameModules != nil {
+		t.Fatalf("expected the rename on the second dependency, got %#v", saved.Dependencies)
+	}
+	content, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if !strings.Contains(string(content), "first rule") || !strings.Contains(string(content), "second rule") {
+		t.Fatalf("expected both modules rendered, got %q", content)
+	}
+
+	cmd = human.newBuildCmd()
+	saved.Dependencies[1].RenameModules = nil
+	if err := config.SaveRuleset(rulesetPath, saved); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	cmd.SetIn(strings.NewReader("k\n1\n"))
+	if err := runCmd(t, projectDir, cmd, "--target", "codex"); err != nil {
+		t.Fatalf("interactive build failed: %v", err)
+	}
+	if saved, err = config.LoadRuleset(rulesetPath); err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if got := saved.Dependencies[1].DisableModules; len(got) != 1 || got[0] != "python.base" || len(saved.Dependencies[0].DisableModules) != 0 {
+		t.Fatalf("expected python.base disabled in the second dependency, got %#v", saved.Dependencies)
+	}
+	if content, err = os.ReadFile(outFile); err != nil {
+		t.Fatalf("read output: %v", err)
+	}
+	if strings.Contains(string(content), "second rule") {
+		t.Fatalf("expected only the kept module rendered, got %q", content)
+	}
+}
+
+func TestUninstallCommand_InteractiveCleanupPromptDecline(t *testing.T) {
+	orig := isInteractiveTerminal
+	t.Cleanup(func() { isInteractiveTerminal = orig })
+	isInteractiveTerminal = func() bool { return true }
+
+	projectDir := t.TempDir()
+	managedOut := filepath.Join(projectDir, "managed.md")
+	if err := os.WriteFile(managedOut, []byte("<!-- rulepack:managed -->\ncontent\n"), 0o644); err != nil {
+		t.Fatalf("write managed output: %v", err)
+	}
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+		},
+		Targets: map[string]config.TargetEntry{
+			"codex": {OutFile: "managed.md"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewHumanRenderer(true)}
+	cmd := a.newDepsUninstallCmd()
+	cmd.SetIn(strings.NewReader("yes\nn\n"))
+	if err := runCmd(t, projectDir, cmd, "1"); err != nil {
+		t.Fatalf("interactive uninstall failed: %v", err)
+	}
+	if _, err := os.Stat(managedOut); err != nil {
+		t.Fatalf("expected managed output to remain after declining cleanup: %v", err)
+	}
+}
+
+func TestUninstallCommand_InteractiveNoCleanupPromptWhenNoCandidates(t *testing.T) {
+	orig := isInteractiveTerminal
 	t.Cleanup(func() { isInteractiveTerminal = orig })
 	isInteractiveTerminal = func() bool { return true }
 
 	projectDir := t.TempDir()
-	managedOut := filepath.Join(projectDir, "managed.md")
-	if err := os.WriteFile(managedOut, []byte("<!-- rulepack:managed -->\ncontent\n"), 0o644); err != nil {
-		t.Fatalf("write managed output: %v", err)
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
+		},
+		Targets: map[string]config.TargetEntry{
+			"codex": {OutFile: "missing.md"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewHumanRenderer(true)}
+	cmd := a.newDepsUninstallCmd()
+	cmd.SetIn(strings.NewReader("yes\n"))
+	if err := runCmd(t, projectDir, cmd, "1"); err != nil {
+		t.Fatalf("interactive uninstall failed: %v", err)
+	}
+}
+
+func TestRootHasNoTopLevelDependencyLifecycleCommands(t *testing.T) {
+	a := &app{}
+	root := &cobra.Command{
+		Use: "rulepack",
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			a.renderer = cliout.NewJSONRenderer()
+			return nil
+		},
+	}
+	root.AddCommand(a.newInitCmd())
+	root.AddCommand(a.newDepsCmd())
+	root.AddCommand(a.newBuildCmd())
+	root.AddCommand(a.newDoctorCmd())
+	root.AddCommand(a.newProfileCmd())
+	for _, name := range []string{"add", "install", "outdated", "uninstall"} {
+		if cmd, _, err := root.Find([]string{name}); err == nil && cmd != nil {
+			t.Fatalf("expected no top-level %s command", name)
+		}
+	}
+}
+
+func TestDepsCommand_UninstallOnly(t *testing.T) {
+	a := &app{}
+	deps := a.newDepsCmd()
+	if cmd, _, err := deps.Find([]string{"uninstall"}); err != nil || cmd == nil {
+		t.Fatalf("expected uninstall subcommand, err=%v", err)
+	}
+	if cmd, _, err := deps.Find([]string{"remove"}); err == nil && cmd != nil {
+		t.Fatalf("expected remove subcommand to be unavailable")
+	}
+}
+
+func TestProfileSave_AllDependenciesDefaultJSON(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	projectDir := t.TempDir()
+
+	depA := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
+	depB := createLocalSourcePackWithID(t, "beta.base", "beta v1\n")
+	relA, _ := filepath.Rel(projectDir, depA)
+	relB, _ := filepath.Rel(projectDir, depB)
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "local", Path: filepath.ToSlash(relA), Export: "default"},
+			{Source: "local", Path: filepath.ToSlash(relB), Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env, "--alias", "combo"); err != nil {
+		t.Fatalf("profile save failed: %v", err)
+	}
+	var out profileSaveOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal profile save: %v", err)
+	}
+	if out.Scope != "all" || !out.Combined || out.SourceCount != 2 {
+		t.Fatalf("unexpected save scope output: %#v", out)
+	}
+	if out.Switched {
+		t.Fatalf("expected switched=false by default")
+	}
+	newCfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if len(newCfg.Dependencies) != 2 || newCfg.Dependencies[0].Source != "local" {
+		t.Fatalf("expected dependencies unchanged, got %#v", newCfg.Dependencies)
+	}
+	meta, _, err := profilesvc.ResolveIDOrAlias(out.Profile.ID)
+	if err != nil {
+		t.Fatalf("resolve profile: %v", err)
+	}
+	if len(meta.Sources) != 2 {
+		t.Fatalf("expected combined profile sources, got %#v", meta.Sources)
+	}
+}
+
+func TestProfileSave_RequiresAliasInNonInteractiveMode(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	projectDir := t.TempDir()
+	depA := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
+	relA, _ := filepath.Rel(projectDir, depA)
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "local", Path: filepath.ToSlash(relA), Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env)
+	if err == nil {
+		t.Fatalf("expected alias requirement error")
+	}
+	if !strings.Contains(err.Error(), "requires --alias in non-interactive mode") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestProfileUse_ConsumesNamedExport(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	projectDir := t.TempDir()
+
+	depA := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
+	depB := createLocalSourcePackWithID(t, "beta.base", "beta v1\n")
+	relA, _ := filepath.Rel(projectDir, depA)
+	relB, _ := filepath.Rel(projectDir, depB)
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "local", Path: filepath.ToSlash(relA), Export: "default"},
+			{Source: "local", Path: filepath.ToSlash(relB), Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var installEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	var saveEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &saveEnv, "--alias", "combo", "--export", "alpha=alpha.*"); err != nil {
+		t.Fatalf("profile save failed: %v", err)
+	}
+	var saved profileSaveOutput
+	if err := json.Unmarshal(saveEnv.Result, &saved); err != nil {
+		t.Fatalf("unmarshal profile save: %v", err)
+	}
+	if got := saved.Profile.ExportNames(); !reflect.DeepEqual(got, []string{"default", "alpha"}) {
+		t.Fatalf("unexpected export names: %v", got)
+	}
+
+	var badEnv jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newProfileUseCmd(), &badEnv, "combo", "--export", "alpah")
+	if err == nil || !strings.Contains(err.Error(), `no export "alpah" (did you mean "alpha"?)`) {
+		t.Fatalf("expected unknown export error, got %v", err)
+	}
+
+	cfg.Dependencies = nil
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	var useEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newProfileUseCmd(), &useEnv, "combo", "--export", "alpha"); err != nil {
+		t.Fatalf("profile use failed: %v", err)
+	}
+	var used profileUseOutput
+	if err := json.Unmarshal(useEnv.Result, &used); err != nil {
+		t.Fatalf("unmarshal profile use: %v", err)
+	}
+	if used.Export != "alpha" {
+		t.Fatalf("expected export alpha, got %#v", used)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+		t.Fatalf("install profile export failed: %v", err)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lockfile: %v", err)
+	}
+	if len(lock.Resolved) != 1 || lock.Resolved[0].Export != "alpha" || lock.Resolved[0].ModuleCount != 1 {
+		t.Fatalf("expected one alpha module locked, got %#v", lock.Resolved)
+	}
+}
+
+func TestProfileSave_ProjectScopeIsSharedWithRepo(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	projectDir := t.TempDir()
+
+	depA := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
+	relA, _ := filepath.Rel(projectDir, depA)
+	cfg := config.Ruleset{
+		SpecVersion: "0.1",
+		Name:        "proj",
+		Dependencies: []config.Dependency{
+			{Source: "local", Path: filepath.ToSlash(relA), Export: "default"},
+		},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env, "--alias", "team", "--scope", "project", "--switch"); err != nil {
+		t.Fatalf("profile save failed: %v", err)
+	}
+	var saved profileSaveOutput
+	if err := json.Unmarshal(env.Result, &saved); err != nil {
+		t.Fatalf("unmarshal profile save: %v", err)
+	}
+	if saved.Profile.Scope != "project" {
+		t.Fatalf("expected project scope, got %#v", saved.Profile)
+	}
+	metaPath := filepath.Join(projectDir, ".rulepack", "profiles", saved.Profile.ID, "profile.json")
+	data, err := os.ReadFile(metaPath)
+	if err != nil {
+		t.Fatalf("expected project profile: %v", err)
+	}
+	if strings.Contains(string(data), "scope") {
+		t.Fatalf("scope must not be persisted: %s", data)
+	}
+
+	// A teammate with an empty global store still resolves the profile.
+	t.Setenv("HOME", t.TempDir())
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install from project profile failed: %v", err)
+	}
+	var listEnv jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newProfileListCmd(), &listEnv); err != nil {
+		t.Fatalf("profile list failed: %v", err)
+	}
+	var listed profileListOutput
+	if err := json.Unmarshal(listEnv.Result, &listed); err != nil {
+		t.Fatalf("unmarshal profile list: %v", err)
+	}
+	if len(listed.Profiles) != 1 || listed.Profiles[0].Alias != "team" || listed.Profiles[0].Scope != "project" {
+		t.Fatalf("unexpected profiles: %#v", listed.Profiles)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env, "--alias", "x", "--scope", "repo"); err == nil || !strings.Contains(err.Error(), "invalid --scope") {
+		t.Fatalf("expected invalid scope error, got %v", err)
+	}
+}
+
+func TestProfileRefresh_BestEffortCombinedJSON(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	sourceDir := createLocalSourcePackWithID(t, "alpha.base", "alpha new\n")
+	missingDir := filepath.Join(t.TempDir(), "missing")
+
+	modules := []pack.Module{
+		{PackName: "snapshot", PackVersion: "1.0.0", Commit: "profile", ID: "alpha.base", Priority: 100, Content: "alpha old\n"},
+		{PackName: "snapshot", PackVersion: "1.0.0", Commit: "profile", ID: "beta.base", Priority: 110, Content: "beta old\n"},
+	}
+	meta, err := profilesvc.SaveSnapshot(profilesvc.SaveInput{
+		Alias: "combo",
+		Sources: []profilesvc.SourceSnapshot{
+			{SourceType: "local", SourceRef: sourceDir, SourceExport: "default", ModuleIDs: []string{"alpha.base"}, Provenance: map[string]string{"path": sourceDir}},
+			{SourceType: "local", SourceRef: missingDir, SourceExport: "default", ModuleIDs: []string{"beta.base"}, Provenance: map[string]string{"path": missingDir}},
+		},
+		ContentHash: profilesvc.ComputeContentHash(modules, "default"),
+		Modules:     modules,
+	})
+	if err != nil {
+		t.Fatalf("save combined profile: %v", err)
+	}
+
+	projectDir := t.TempDir()
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, meta.ID, "--dry-run"); err != nil {
+		t.Fatalf("profile refresh failed: %v", err)
+	}
+	var out profileRefreshOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal profile refresh: %v", err)
+	}
+	if len(out.RefreshedSources) != 1 || len(out.SkippedSources) != 1 {
+		t.Fatalf("expected best-effort source statuses, got %#v", out)
+	}
+	if len(out.ChangedModules) == 0 || out.ChangedModules[0] != "alpha.base" {
+		t.Fatalf("expected alpha.base to change, got %#v", out.ChangedModules)
+	}
+}
+
+func TestProfileRefreshJSON_RequiresYesForInPlaceChanges(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	sourceDir := createLocalSourcePack(t, "new content\n")
+	savedMeta := createSavedProfile(t, sourceDir, "old content\n")
+	projectDir := t.TempDir()
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, savedMeta.ID)
+	if err == nil {
+		t.Fatalf("expected in-place refresh to fail without --yes")
+	}
+	if !strings.Contains(err.Error(), "rerun with --yes") {
+		t.Fatalf("unexpected refresh error: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, savedMeta.ID, "--yes"); err != nil {
+		t.Fatalf("refresh with --yes failed: %v", err)
+	}
+}
+
+func TestProfileRefreshDue_RefreshesOnlyOverdueProfiles(t *testing.T) {
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	sourceDir := createLocalSourcePack(t, "new content\n")
+	savedMeta := createSavedProfile(t, sourceDir, "old content\n")
+	root, err := profilesvc.GlobalRoot()
+	if err != nil {
+		t.Fatalf("global root: %v", err)
+	}
+	metaPath := filepath.Join(root, savedMeta.ID, "profile.json")
+	savedMeta.RefreshEvery = "1d"
+	savedMeta.RefreshedAt = time.Now().Add(-72 * time.Hour).UTC().Format(time.RFC3339)
+	data, err := json.Marshal(savedMeta)
+	if err != nil {
+		t.Fatalf("marshal metadata: %v", err)
+	}
+	if err := os.WriteFile(metaPath, data, 0o644); err != nil {
+		t.Fatalf("write metadata: %v", err)
+	}
+
+	projectDir := t.TempDir()
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	listDue := func() []string {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newProfileListCmd(), &env); err != nil {
+			t.Fatalf("profile list failed: %v", err)
+		}
+		var out profileListOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("unmarshal profile list: %v", err)
+		}
+		return out.Due
 	}
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
-		},
-		Targets: map[string]config.TargetEntry{
-			"codex": {OutFile: managedOut},
-		},
+	if due := listDue(); !reflect.DeepEqual(due, []string{savedMeta.ID}) {
+		t.Fatalf("expected profile to be due, got %v", due)
 	}
-	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
-		t.Fatalf("save ruleset: %v", err)
+
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, "--due", savedMeta.ID); err == nil {
+		t.Fatalf("expected --due to reject a profile argument")
 	}
-	a := &app{renderer: cliout.NewHumanRenderer(true)}
-	cmd := a.newDepsUninstallCmd()
-	cmd.SetIn(strings.NewReader("yes\nn\n"))
-	if err := runCmd(t, projectDir, cmd, "1"); err != nil {
-		t.Fatalf("interactive uninstall failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, "--due", "--yes"); err != nil {
+		t.Fatalf("refresh --due failed: %v", err)
 	}
-	if _, err := os.Stat(managedOut); err != nil {
-		t.Fatalf("expected managed output to remain after declining cleanup: %v", err)
+	var out profileRefreshDueOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal refresh --due: %v", err)
+	}
+	if len(out.Profiles) != 1 || out.Profiles[0].OldProfileID != savedMeta.ID || len(out.Profiles[0].ChangedModules) != 1 {
+		t.Fatalf("unexpected refresh --due output: %#v", out)
+	}
+	if due := listDue(); len(due) != 0 {
+		t.Fatalf("expected no due profiles after refresh, got %v", due)
+	}
+	meta, _, err := profilesvc.ResolveIDOrAlias(savedMeta.ID)
+	if err != nil {
+		t.Fatalf("resolve profile: %v", err)
+	}
+	if meta.RefreshEvery != "1d" {
+		t.Fatalf("expected refreshEvery to survive refresh, got %#v", meta)
 	}
 }
 
-func TestUninstallCommand_InteractiveNoCleanupPromptWhenNoCandidates(t *testing.T) {
-	orig := isInteractiveTerminal
-	t.Cleanup(func() { isInteractiveTerminal = orig })
-	isInteractiveTerminal = func() bool { return true }
-
+func TestDepsInstall_UpdateProfilesRefreshesBeforeLocking(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sourceDir := createLocalSourcePack(t, "new content\n")
+	savedMeta := createSavedProfile(t, sourceDir, "old content\n")
 	projectDir := t.TempDir()
 	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "git", URI: "https://example.com/rules.git", Export: "default"},
-		},
-		Targets: map[string]config.TargetEntry{
-			"codex": {OutFile: filepath.Join(projectDir, "missing.md")},
-		},
+		SpecVersion:  "0.1",
+		Name:         "proj",
+		Dependencies: []config.Dependency{{Source: profilesvc.ProfileSource, Profile: "python-a"}},
 	}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-	a := &app{renderer: cliout.NewHumanRenderer(true)}
-	cmd := a.newDepsUninstallCmd()
-	cmd.SetIn(strings.NewReader("yes\n"))
-	if err := runCmd(t, projectDir, cmd, "1"); err != nil {
-		t.Fatalf("interactive uninstall failed: %v", err)
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--update-profiles", "--plan"); err == nil {
+		t.Fatalf("expected --update-profiles to reject --plan")
+	}
+	err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--update-profiles")
+	if err == nil || !strings.Contains(err.Error(), "rerun with --yes") {
+		t.Fatalf("expected in-place refresh to require --yes, got %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env, "--update-profiles", "--yes"); err != nil {
+		t.Fatalf("install --update-profiles failed: %v", err)
+	}
+	var out installOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal install: %v", err)
+	}
+	if len(out.UpdatedProfiles) != 1 || out.UpdatedProfiles[0].OldProfileID != savedMeta.ID || !reflect.DeepEqual(out.UpdatedProfiles[0].ChangedModules, []string{"python.base"}) {
+		t.Fatalf("unexpected updated profiles: %#v", out.UpdatedProfiles)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lockfile: %v", err)
+	}
+	if len(lock.Resolved) != 1 || lock.Resolved[0].Profile != savedMeta.ID || lock.Resolved[0].ContentHash == savedMeta.ContentHash {
+		t.Fatalf("expected lock to record the refreshed hash, got %#v", lock.Resolved)
 	}
 }
 
-func TestRootHasNoTopLevelDependencyLifecycleCommands(t *testing.T) {
-	a := &app{}
-	root := &cobra.Command{
-		Use: "rulepack",
-		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			a.renderer = cliout.NewJSONRenderer()
-			return nil
-		},
+func TestProfileRefresh_MergesLocalEditsAndFlagsConflicts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sourceDir := createLocalSourcePack(t, "intro\nkeep\nouter\n")
+	savedMeta := createSavedProfile(t, sourceDir, "intro\nkeep\nouter\n")
+	if _, err := profilesvc.EditModule("python-a", "python.base", "intro\nkeep\nlocal outer\n"); err != nil {
+		t.Fatalf("edit module: %v", err)
 	}
-	root.AddCommand(a.newInitCmd())
-	root.AddCommand(a.newDepsCmd())
-	root.AddCommand(a.newBuildCmd())
-	root.AddCommand(a.newDoctorCmd())
-	root.AddCommand(a.newProfileCmd())
-	for _, name := range []string{"add", "install", "outdated", "uninstall"} {
-		if cmd, _, err := root.Find([]string{name}); err == nil && cmd != nil {
-			t.Fatalf("expected no top-level %s command", name)
+	modulePath := filepath.Join(sourceDir, "modules", "python_base.md")
+	if err := os.WriteFile(modulePath, []byte("source intro\nkeep\nouter\n"), 0o644); err != nil {
+		t.Fatalf("edit source: %v", err)
+	}
+	projectDir := t.TempDir()
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	refresh := func() profileRefreshOutput {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, "python-a", "--yes"); err != nil {
+			t.Fatalf("refresh failed: %v", err)
+		}
+		var out profileRefreshOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("unmarshal refresh: %v", err)
 		}
+		return out
+	}
+	readModule := func() string {
+		t.Helper()
+		_, dir, err := profilesvc.ResolveIDOrAlias(savedMeta.ID)
+		if err != nil {
+			t.Fatalf("resolve profile: %v", err)
+		}
+		modules, _, err := profilesvc.Expand(dir, config.Dependency{Source: profilesvc.ProfileSource, Profile: savedMeta.ID, Export: "default"}, pack.Options{})
+		if err != nil {
+			t.Fatalf("expand profile: %v", err)
+		}
+		return modules[0].Content
 	}
-}
 
-func TestDepsCommand_UninstallOnly(t *testing.T) {
-	a := &app{}
-	deps := a.newDepsCmd()
-	if cmd, _, err := deps.Find([]string{"uninstall"}); err != nil || cmd == nil {
-		t.Fatalf("expected uninstall subcommand, err=%v", err)
+	out := refresh()
+	if !reflect.DeepEqual(out.MergedModules, []string{"python.base"}) || len(out.ConflictedModules) != 0 {
+		t.Fatalf("expected a clean merge, got %#v", out)
 	}
-	if cmd, _, err := deps.Find([]string{"remove"}); err == nil && cmd != nil {
-		t.Fatalf("expected remove subcommand to be unavailable")
+	if got := readModule(); got != "source intro\nkeep\nlocal outer\n" {
+		t.Fatalf("expected source and local changes merged, got %q", got)
+	}
+
+	if err := os.WriteFile(modulePath, []byte("source intro\nkeep\nsource outer\n"), 0o644); err != nil {
+		t.Fatalf("edit source: %v", err)
+	}
+	out = refresh()
+	if !reflect.DeepEqual(out.ConflictedModules, []string{"python.base"}) {
+		t.Fatalf("expected a conflict, got %#v", out)
+	}
+	if got := readModule(); !strings.Contains(got, "<<<<<<< local\nlocal outer\n=======\nsource outer\n>>>>>>> source\n") {
+		t.Fatalf("expected conflict markers, got %q", got)
+	}
+	cfg := config.Ruleset{SpecVersion: "0.1", Name: "proj", Dependencies: []config.Dependency{{Source: profilesvc.ProfileSource, Profile: "python-a"}}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	var env jsonEnvelope
+	err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env)
+	if err == nil || !strings.Contains(err.Error(), "unresolved refresh conflicts in python.base") {
+		t.Fatalf("expected install to refuse a conflicted profile, got %v", err)
+	}
+	if _, err := profilesvc.EditModule("python-a", "python.base", "source intro\nkeep\nlocal outer\n"); err != nil {
+		t.Fatalf("resolve conflict: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install after resolving failed: %v", err)
 	}
 }
 
-func TestProfileSave_AllDependenciesDefaultJSON(t *testing.T) {
-	homeDir := t.TempDir()
-	t.Setenv("HOME", homeDir)
+func TestProfileRefresh_SourceSelectsCombinedSources(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
 	projectDir := t.TempDir()
 
 	depA := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
@@ -893,132 +4578,340 @@ func TestProfileSave_AllDependenciesDefaultJSON(t *testing.T) {
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
 		t.Fatalf("install failed: %v", err)
 	}
-
-	var env jsonEnvelope
 	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env, "--alias", "combo"); err != nil {
 		t.Fatalf("profile save failed: %v", err)
 	}
-	var out profileSaveOutput
+	for _, f := range []string{filepath.Join(depA, "modules", "alpha_base.md"), filepath.Join(depB, "modules", "beta_base.md")} {
+		if err := os.WriteFile(f, []byte("v2\n"), 0o644); err != nil {
+			t.Fatalf("update source: %v", err)
+		}
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, "combo", "--source", "3"); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("expected out of range error, got %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, "combo", "--source", "2", "--yes"); err != nil {
+		t.Fatalf("refresh --source failed: %v", err)
+	}
+	var out profileRefreshOutput
 	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal profile save: %v", err)
+		t.Fatalf("unmarshal refresh: %v", err)
 	}
-	if out.Scope != "all" || !out.Combined || out.SourceCount != 2 {
-		t.Fatalf("unexpected save scope output: %#v", out)
+	if !reflect.DeepEqual(out.ChangedModules, []string{"beta.base"}) || len(out.SelectedSources) != 1 || len(out.RefreshedSources) != 1 {
+		t.Fatalf("expected only the second source refreshed, got %#v", out)
 	}
-	if out.Switched {
-		t.Fatalf("expected switched=false by default")
+}
+
+func TestRemoteProfileDependency_InstallsFromRegistryAndBuilds(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	registry := t.TempDir()
+	profileDir := filepath.Join(registry, "acme", "python", "1.0.0")
+	if err := os.MkdirAll(filepath.Join(profileDir, "modules"), 0o755); err != nil {
+		t.Fatalf("mkdir registry profile: %v", err)
 	}
-	newCfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	manifest := `{"specVersion": "0.1", "name": "acme-python", "version": "1.0.0", "modules": [{"id": "python.base", "path": "modules/100-base.md", "priority": 100}], "exports": {"default": {"include": ["**"]}}}`
+	if err := os.WriteFile(filepath.Join(profileDir, "rulepack.json"), []byte(manifest), 0o644); err != nil {
+		t.Fatalf("write registry manifest: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(profileDir, "modules", "100-base.md"), []byte("registry rule\n"), 0o644); err != nil {
+		t.Fatalf("write registry module: %v", err)
+	}
+	if _, err := runGit(registry, "init"); err != nil {
+		t.Fatalf("git init: %v", err)
+	}
+	if _, err := runGit(registry, "add", "."); err != nil {
+		t.Fatalf("git add: %v", err)
+	}
+	if _, err := runGit(registry, "-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "publish"); err != nil {
+		t.Fatalf("git commit: %v", err)
+	}
+
+	projectDir := t.TempDir()
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "profile", Profile: "acme/python@1.0.0"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if _, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName)); err == nil || !strings.Contains(err.Error(), "requires profileRegistry") {
+		t.Fatalf("expected missing registry error, got %v", err)
+	}
+	cfg.ProfileRegistry = registry
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
 	if err != nil {
-		t.Fatalf("load ruleset: %v", err)
+		t.Fatalf("load lockfile: %v", err)
 	}
-	if len(newCfg.Dependencies) != 2 || newCfg.Dependencies[0].Source != "local" {
-		t.Fatalf("expected dependencies unchanged, got %#v", newCfg.Dependencies)
+	head, err := runGit(registry, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("rev-parse: %v", err)
 	}
-	meta, _, err := profilesvc.ResolveIDOrAlias(out.Profile.ID)
+	got := lock.Resolved[0]
+	if got.Profile != "acme/python@1.0.0" || got.URI != registry || got.Commit != strings.TrimSpace(head) || got.ModuleCount != 1 {
+		t.Fatalf("unexpected lock entry: %#v", got)
+	}
+
+	// A teammate without the cache fetches the locked commit at build time.
+	cacheRoot, err := profilesvc.RegistryCacheRoot()
 	if err != nil {
-		t.Fatalf("resolve profile: %v", err)
+		t.Fatalf("cache root: %v", err)
 	}
-	if len(meta.Sources) != 2 {
-		t.Fatalf("expected combined profile sources, got %#v", meta.Sources)
+	if err := os.RemoveAll(cacheRoot); err != nil {
+		t.Fatalf("clear cache: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude"); err != nil {
+		t.Fatalf("build failed: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(projectDir, ".claude", "rules", "100-100-base.md"))
+	if err != nil {
+		t.Fatalf("read claude output: %v", err)
+	}
+	if !strings.Contains(string(content), "registry rule") {
+		t.Fatalf("expected registry module in output, got %q", content)
+	}
+
+	cfg.Dependencies[0].Profile = "acme/python@9.9.9"
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err == nil || !strings.Contains(err.Error(), "not found in registry") {
+		t.Fatalf("expected missing version error, got %v", err)
 	}
 }
 
-func TestProfileSave_RequiresAliasInNonInteractiveMode(t *testing.T) {
-	homeDir := t.TempDir()
-	t.Setenv("HOME", homeDir)
+func TestBuild_MissingLockedProfileReportsSourcesAndRecovers(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	projectDir := t.TempDir()
+	source := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
+	rel, _ := filepath.Rel(projectDir, source)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: filepath.ToSlash(rel), Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env, "--alias", "team"); err != nil {
+		t.Fatalf("profile save failed: %v", err)
+	}
+	cfg.Dependencies = []config.Dependency{{Source: "profile", Profile: "team"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install profile failed: %v", err)
+	}
+	lock, err := config.LoadLockfile(filepath.Join(projectDir, config.LockFileName))
+	if err != nil {
+		t.Fatalf("load lockfile: %v", err)
+	}
+	locked := lock.Resolved[0]
+	if locked.ProfileAlias != "team" || len(locked.ProfileSources) != 1 || locked.ProfileSources[0].SourceRef != source {
+		t.Fatalf("expected alias and sources in lock entry, got %#v", locked)
+	}
+
+	// A clone on another machine has the lockfile but not the profile.
+	if _, _, err := profilesvc.Remove("team"); err != nil {
+		t.Fatalf("remove profile: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude")
+	var missing *missingProfileError
+	if !errors.As(err, &missing) || missing.Alias != "team" || !strings.Contains(err.Error(), "local:"+source) || !strings.Contains(err.Error(), "--recover") {
+		t.Fatalf("expected missing profile error, got %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env); err != nil {
+		t.Fatalf("doctor failed: %v", err)
+	}
+	var doctor doctorOutput
+	if err := json.Unmarshal(env.Result, &doctor); err != nil {
+		t.Fatalf("unmarshal doctor: %v", err)
+	}
+	found := false
+	for _, c := range doctor.Checks {
+		if c.Name == "locked profiles" {
+			found = c.Status == "fail" && strings.Contains(c.Details, "team")
+		}
+	}
+	if !found {
+		t.Fatalf("expected failing locked profiles check, got %#v", doctor.Checks)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude", "--recover"); err != nil {
+		t.Fatalf("build --recover failed: %v", err)
+	}
+	var out buildOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("unmarshal build: %v", err)
+	}
+	if !reflect.DeepEqual(out.Recovered, []string{locked.Profile}) {
+		t.Fatalf("expected %s recovered, got %#v", locked.Profile, out.Recovered)
+	}
+	if meta, _, err := profilesvc.ResolveIDOrAlias("team"); err != nil || meta.ID != locked.Profile {
+		t.Fatalf("expected recovered profile under its locked id, got %#v (%v)", meta, err)
+	}
+
+	// Sources that no longer reproduce the locked content are not saved.
+	if _, _, err := profilesvc.Remove("team"); err != nil {
+		t.Fatalf("remove profile: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(source, "modules", "alpha_base.md"), []byte("alpha v2\n"), 0o644); err != nil {
+		t.Fatalf("edit source: %v", err)
+	}
+	err = runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude", "--recover")
+	if err == nil || !strings.Contains(err.Error(), "no longer produce the locked content") {
+		t.Fatalf("expected drift error, got %v", err)
+	}
+	if _, _, err := profilesvc.ResolveIDOrAlias("team"); !errors.Is(err, profilesvc.ErrNotFound) {
+		t.Fatalf("expected no profile saved after failed recovery, got %v", err)
+	}
+}
+
+func TestProfileVerify_NamesModulesEditedSinceSave(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
 	projectDir := t.TempDir()
 	depA := createLocalSourcePackWithID(t, "alpha.base", "alpha v1\n")
+	depB := createLocalSourcePackWithID(t, "beta.base", "beta v1\n")
 	relA, _ := filepath.Rel(projectDir, depA)
-	cfg := config.Ruleset{
-		SpecVersion: "0.1",
-		Name:        "proj",
-		Dependencies: []config.Dependency{
-			{Source: "local", Path: filepath.ToSlash(relA), Export: "default"},
-		},
+	relB, _ := filepath.Rel(projectDir, depB)
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "local", Path: filepath.ToSlash(relA), Export: "default"},
+		{Source: "local", Path: filepath.ToSlash(relB), Export: "default"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	if err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env, "--alias", "combo"); err != nil {
+		t.Fatalf("profile save failed: %v", err)
 	}
+	cfg.Dependencies = []config.Dependency{{Source: "profile", Profile: "combo"}}
 	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
 		t.Fatalf("save ruleset: %v", err)
 	}
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var installEnv jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &installEnv); err != nil {
-		t.Fatalf("install failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install profile failed: %v", err)
 	}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newProfileSaveCmd(), &env)
-	if err == nil {
-		t.Fatalf("expected alias requirement error")
+	if err := runCmdJSON(t, projectDir, a.newProfileCmd(), &env, "verify", "combo"); err != nil {
+		t.Fatalf("verify of untouched profile failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "requires --alias in non-interactive mode") {
-		t.Fatalf("unexpected error: %v", err)
+	var verified profileVerifyOutput
+	if err := json.Unmarshal(env.Result, &verified); err != nil {
+		t.Fatalf("unmarshal verify: %v", err)
+	}
+	if !verified.Verified || verified.ModuleCount != 2 {
+		t.Fatalf("unexpected verify output: %#v", verified)
 	}
-}
 
-func TestProfileRefresh_BestEffortCombinedJSON(t *testing.T) {
-	homeDir := t.TempDir()
-	t.Setenv("HOME", homeDir)
-	sourceDir := createLocalSourcePackWithID(t, "alpha.base", "alpha new\n")
-	missingDir := filepath.Join(t.TempDir(), "missing")
+	meta, dir, err := profilesvc.ResolveIDOrAlias("combo")
+	if err != nil {
+		t.Fatalf("resolve profile: %v", err)
+	}
+	var blob string
+	for modulePath, digest := range meta.Blobs {
+		if strings.Contains(modulePath, "beta_base") {
+			blob = filepath.Join(filepath.Dir(dir), profilesvc.BlobDir, digest[:2], digest)
+		}
+	}
+	if err := os.WriteFile(blob, []byte("beta edited by hand\n"), 0o644); err != nil {
+		t.Fatalf("edit snapshot blob: %v", err)
+	}
 
-	modules := []pack.Module{
-		{PackName: "snapshot", PackVersion: "1.0.0", Commit: "profile", ID: "alpha.base", Priority: 100, Content: "alpha old\n"},
-		{PackName: "snapshot", PackVersion: "1.0.0", Commit: "profile", ID: "beta.base", Priority: 110, Content: "beta old\n"},
+	err = runCmdJSON(t, projectDir, a.newProfileCmd(), &env, "verify", "combo")
+	if err == nil || !strings.Contains(err.Error(), "beta.base") || strings.Contains(err.Error(), "alpha.base") {
+		t.Fatalf("expected verify to name only beta.base, got %v", err)
 	}
-	meta, err := profilesvc.SaveSnapshot(profilesvc.SaveInput{
-		Alias: "combo",
-		Sources: []profilesvc.SourceSnapshot{
-			{SourceType: "local", SourceRef: sourceDir, SourceExport: "default", ModuleIDs: []string{"alpha.base"}, Provenance: map[string]string{"path": sourceDir}},
-			{SourceType: "local", SourceRef: missingDir, SourceExport: "default", ModuleIDs: []string{"beta.base"}, Provenance: map[string]string{"path": missingDir}},
-		},
-		ContentHash: profilesvc.ComputeContentHash(modules, "default"),
-		Modules:     modules,
-	})
+
+	err = runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "claude")
+	if err == nil || !strings.Contains(err.Error(), "module(s) beta.base edited") || !strings.Contains(err.Error(), "profile refresh "+meta.ID) {
+		t.Fatalf("expected build drift error naming beta.base, got %v", err)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newProfileDiffCmd(), &env, "combo"); err != nil {
+		t.Fatalf("profile diff failed: %v", err)
+	}
+	var diff profileDiffOutput
+	if err := json.Unmarshal(env.Result, &diff); err != nil {
+		t.Fatalf("unmarshal diff: %v", err)
+	}
+	if !reflect.DeepEqual(diff.EditedModules, []string{"beta.base"}) || !reflect.DeepEqual(diff.ChangedModules, []string{"beta.base"}) {
+		t.Fatalf("expected diff to report beta.base edited and changed, got %#v", diff)
+	}
+}
+
+func TestProfileDoctor_ReportsUnreadableProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sourceDir := createLocalSourcePack(t, "content\n")
+	createSavedProfile(t, sourceDir, "content\n")
+	root, err := profilesvc.GlobalRoot()
 	if err != nil {
-		t.Fatalf("save combined profile: %v", err)
+		t.Fatalf("global root: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "broken"), 0o755); err != nil {
+		t.Fatalf("mkdir broken: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "broken", "profile.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatalf("write broken: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "empty"), 0o755); err != nil {
+		t.Fatalf("mkdir empty: %v", err)
 	}
 
 	projectDir := t.TempDir()
 	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
 	var env jsonEnvelope
-	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, meta.ID, "--dry-run"); err != nil {
-		t.Fatalf("profile refresh failed: %v", err)
+	if err := runCmdJSON(t, projectDir, a.newProfileCmd(), &env, "doctor"); err != nil {
+		t.Fatalf("profile doctor failed: %v", err)
 	}
-	var out profileRefreshOutput
+	var out profileDoctorOutput
 	if err := json.Unmarshal(env.Result, &out); err != nil {
-		t.Fatalf("unmarshal profile refresh: %v", err)
+		t.Fatalf("unmarshal profile doctor: %v", err)
 	}
-	if len(out.RefreshedSources) != 1 || len(out.SkippedSources) != 1 {
-		t.Fatalf("expected best-effort source statuses, got %#v", out)
+	if out.ProfileCount != 1 || len(out.Unreadable) != 2 {
+		t.Fatalf("expected one readable and two unreadable profiles, got %#v", out)
 	}
-	if len(out.ChangedModules) == 0 || out.ChangedModules[0] != "alpha.base" {
-		t.Fatalf("expected alpha.base to change, got %#v", out.ChangedModules)
+	reasons := map[string]string{}
+	for _, u := range out.Unreadable {
+		reasons[u.ID] = u.Reason
+	}
+	if !strings.HasPrefix(reasons["broken"], "parse profile.json") || reasons["empty"] != "missing profile.json" {
+		t.Fatalf("unexpected reasons: %#v", reasons)
 	}
-}
 
-func TestProfileRefreshJSON_RequiresYesForInPlaceChanges(t *testing.T) {
-	homeDir := t.TempDir()
-	t.Setenv("HOME", homeDir)
-	sourceDir := createLocalSourcePack(t, "new content\n")
-	savedMeta := createSavedProfile(t, sourceDir, "old content\n")
-	projectDir := t.TempDir()
-	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
-	var env jsonEnvelope
-	err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, savedMeta.ID)
-	if err == nil {
-		t.Fatalf("expected in-place refresh to fail without --yes")
+	if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env); err != nil {
+		t.Fatalf("doctor failed: %v", err)
 	}
-	if !strings.Contains(err.Error(), "rerun with --yes") {
-		t.Fatalf("unexpected refresh error: %v", err)
+	var doctor doctorOutput
+	if err := json.Unmarshal(env.Result, &doctor); err != nil {
+		t.Fatalf("unmarshal doctor: %v", err)
 	}
-	if err := runCmdJSON(t, projectDir, a.newProfileRefreshCmd(), &env, savedMeta.ID, "--yes"); err != nil {
-		t.Fatalf("refresh with --yes failed: %v", err)
+	found := false
+	for _, c := range doctor.Checks {
+		if c.Name == "unreadable profiles" {
+			found = c.Status == "warn" && strings.Contains(c.Details, "broken (parse profile.json") && strings.Contains(c.Details, "empty (missing profile.json)")
+		}
+	}
+	if !found {
+		t.Fatalf("expected unreadable profiles warning, got %#v", doctor.Checks)
 	}
 }
 
@@ -1117,6 +5010,381 @@ func TestDoctorCommandJSON(t *testing.T) {
 	}
 }
 
+func TestDoctorCommandJSON_FixesWindowsLockPaths(t *testing.T) {
+	projectDir := t.TempDir()
+	src := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	if err := os.CopyFS(filepath.Join(projectDir, "packs", "go.base"), os.DirFS(src)); err != nil {
+		t.Fatalf("copy pack: %v", err)
+	}
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{{Source: "local", Path: `packs\go.base`, Export: "default"}}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDepsInstallCmd(), &env); err != nil {
+		t.Fatalf("install failed: %v", err)
+	}
+	lockPath := filepath.Join(projectDir, config.LockFileName)
+	lock, err := config.LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	if got := lock.Resolved[0]; got.Path != "packs/go.base" || got.Key != "local:packs/go.base#default" {
+		t.Fatalf("expected install to write slash paths, got %#v", got)
+	}
+
+	lock.Resolved[0].Path, lock.Resolved[0].Key = `packs\go.base`, `local:packs\go.base#default`
+	if err := config.SaveLockfile(lockPath, lock); err != nil {
+		t.Fatalf("save lock: %v", err)
+	}
+	check := func(args ...string) doctorCheck {
+		t.Helper()
+		if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env, args...); err != nil {
+			t.Fatalf("doctor %v failed: %v", args, err)
+		}
+		var out doctorOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("decode doctor: %v", err)
+		}
+		for _, c := range out.Checks {
+			if c.Name == "lockfile paths" {
+				return c
+			}
+		}
+		t.Fatalf("expected lockfile paths check, got %#v", out.Checks)
+		return doctorCheck{}
+	}
+	if c := check(); c.Status != "warn" || !strings.Contains(c.Details, "run rulepack doctor --fix") {
+		t.Fatalf("expected backslash paths to warn, got %#v", c)
+	}
+	if c := check("--fix"); c.Status != "ok" || !strings.Contains(c.Details, "normalized entries 1") {
+		t.Fatalf("expected --fix to normalize entry 1, got %#v", c)
+	}
+	if lock, err = config.LoadLockfile(lockPath); err != nil {
+		t.Fatalf("load lock: %v", err)
+	}
+	if got := lock.Resolved[0]; got.Path != "packs/go.base" || got.Key != "local:packs/go.base#default" {
+		t.Fatalf("expected fixed lock to use slash paths, got %#v", got)
+	}
+	if err := runCmdJSON(t, projectDir, a.newBuildCmd(), &env, "--target", "copilot"); err != nil {
+		t.Fatalf("build after fix failed: %v", err)
+	}
+}
+
+func TestDoctorCommandJSON_ProbesDependencyHosts(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	repo := createLocalSourcePackWithID(t, "go.base", "go rule\n")
+	for _, args := range [][]string{{"init"}, {"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "init"}} {
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	missing := filepath.Join(t.TempDir(), "missing.git")
+	projectDir := t.TempDir()
+	cfg := config.DefaultRuleset("proj")
+	cfg.Dependencies = []config.Dependency{
+		{Source: "git", URI: repo, Ref: "HEAD", Export: "default"},
+		{Source: "git", URI: missing, Ref: "HEAD", Export: "default"},
+		{Source: "git", URI: repo, Ref: "HEAD", Export: "other"},
+	}
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	hosts := func(args ...string) map[string]doctorCheck {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env, args...); err != nil {
+			t.Fatalf("doctor %v failed: %v", args, err)
+		}
+		var out doctorOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("decode doctor: %v", err)
+		}
+		found := map[string]doctorCheck{}
+		for _, c := range out.Checks {
+			if host, ok := strings.CutPrefix(c.Name, "host "); ok {
+				found[host] = c
+			}
+		}
+		return found
+	}
+	found := hosts()
+	if len(found) != 2 {
+		t.Fatalf("expected one check per host, got %#v", found)
+	}
+	if found[repo].Status != "ok" {
+		t.Fatalf("expected reachable repo to pass, got %#v", found[repo])
+	}
+	if c := found[missing]; c.Status != "fail" || !strings.Contains(c.Details, "would fail dependency 2") {
+		t.Fatalf("expected missing repo to fail naming dependency 2, got %#v", c)
+	}
+	if found := hosts("--offline"); len(found) != 0 {
+		t.Fatalf("expected --offline to skip probes, got %#v", found)
+	}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env, "--network", "--offline"); err == nil {
+		t.Fatalf("expected --network with --offline to fail")
+	}
+}
+
+func TestDoctorCommandJSON_ToolsComparesTargetsWithRepository(t *testing.T) {
+	projectDir := t.TempDir()
+	cfg := config.DefaultRuleset("proj")
+	if err := config.SaveRuleset(filepath.Join(projectDir, config.RulesetFileName), cfg); err != nil {
+		t.Fatalf("save ruleset: %v", err)
+	}
+	for _, f := range []string{".cursor/mcp.json", ".claude/rules/go.md", ".github/copilot-instructions.md", ".vscode/settings.json", ".zed/settings.json"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(projectDir, f)), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(projectDir, f), []byte("{}\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", f, err)
+		}
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env, "--offline", "--tools"); err != nil {
+		t.Fatalf("doctor failed: %v", err)
+	}
+	var out doctorOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode doctor: %v", err)
+	}
+	got := map[string]string{}
+	for _, c := range out.Checks {
+		if kind, ok := strings.CutPrefix(c.Name, "tool "); ok {
+			got[kind] = c.Status
+		}
+	}
+	want := map[string]string{"cursor": "ok", "copilot": "warn", "codex": "warn", "claude": "warn", "zed": "warn"}
+	if !maps.Equal(got, want) {
+		t.Fatalf("expected tool checks %v, got %v (%#v)", want, got, out.Checks)
+	}
+
+	if err := runCmdJSON(t, projectDir, a.newDoctorCmd(), &env, "--offline"); err != nil {
+		t.Fatalf("doctor failed: %v", err)
+	}
+	if strings.Contains(string(env.Result), `"tool `) {
+		t.Fatalf("expected tool checks only with --tools, got %s", env.Result)
+	}
+}
+
+func TestInitCommandJSON_FromExistingDetectsTargets(t *testing.T) {
+	projectDir := t.TempDir()
+	for _, f := range []string{".cursorrules", "CLAUDE.md", ".zed/settings.json"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(projectDir, f)), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(projectDir, f), []byte("x\n"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", f, err)
+		}
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newInitCmd(), &env, "--from-existing"); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	var out initOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode init: %v", err)
+	}
+	if !slices.Equal(out.Targets, []string{"claude", "cursor", "zed"}) {
+		t.Fatalf("expected detected targets, got %v", out.Targets)
+	}
+	if len(out.Detected) != 3 || out.Detected[0].Target != "cursor" || !slices.Equal(out.Detected[0].Evidence, []string{".cursorrules"}) {
+		t.Fatalf("unexpected detections %#v", out.Detected)
+	}
+	cfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if cfg.Targets["cursor"].OutDir != ".cursor/rules" || cfg.Targets["claude"].OutDir != ".claude/rules" {
+		t.Fatalf("expected default entries for detected targets, got %#v", cfg.Targets)
+	}
+	if _, ok := cfg.Targets["copilot"]; ok {
+		t.Fatalf("expected no copilot target without copilot files, got %#v", cfg.Targets)
+	}
+
+	empty := t.TempDir()
+	if err := runCmdJSON(t, empty, a.newInitCmd(), &env, "--from-existing"); err != nil {
+		t.Fatalf("init in empty repo failed: %v", err)
+	}
+	var defaults initOutput
+	if err := json.Unmarshal(env.Result, &defaults); err != nil {
+		t.Fatalf("decode init: %v", err)
+	}
+	if !slices.Equal(defaults.Targets, []string{"claude", "codex", "copilot", "cursor"}) || len(defaults.Detected) != 0 {
+		t.Fatalf("expected default targets without detections, got %#v", defaults)
+	}
+}
+
+func TestInitCommandJSON_TemplateFromPackExport(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	template := `{
+  "specVersion": "0.1",
+  "name": "service-template",
+  "targets": {"copilot": {"outFile": ".github/copilot-instructions.md"}},
+  "dependencies": [{"source": "git", "uri": "https://example.com/org/standards.git", "version": "^1.0.0", "export": "default"}],
+  "overrides": [{"id": "org.style", "priority": 50}]
+}
+`
+	repo := createLocalSourcePackWithManifest(t, map[string]string{
+		"modules/style.md":       "style\n",
+		"templates/service.json": template,
+	}, `{"specVersion":"0.1","name":"org","version":"1.0.0","modules":[{"id":"org.style","path":"modules/style.md","priority":100}],"exports":{"default":{"include":["**"]},"service":{"include":["**"],"template":"templates/service.json"}}}`)
+	for _, args := range [][]string{{"init"}, {"add", "."}, {"-c", "user.email=test@example.com", "-c", "user.name=rulepack-test", "commit", "-m", "init"}} {
+		if _, err := runGit(repo, args...); err != nil {
+			t.Fatalf("git %v: %v", args, err)
+		}
+	}
+	head, err := runGit(repo, "rev-parse", "HEAD")
+	if err != nil {
+		t.Fatalf("rev-parse: %v", err)
+	}
+
+	projectDir := filepath.Join(t.TempDir(), "billing")
+	if err := os.Mkdir(projectDir, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, a.newInitCmd(), &env, "--template", "git:"+repo+"#service"); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+	var out initOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode init: %v", err)
+	}
+	if out.TemplateCommit != strings.TrimSpace(head) || !slices.Equal(out.Targets, []string{"copilot"}) {
+		t.Fatalf("unexpected init output %#v", out)
+	}
+	cfg, err := config.LoadRuleset(filepath.Join(projectDir, config.RulesetFileName))
+	if err != nil {
+		t.Fatalf("load ruleset: %v", err)
+	}
+	if cfg.Name != "billing" || len(cfg.Dependencies) != 1 || cfg.Dependencies[0].Version != "^1.0.0" || len(cfg.Overrides) != 1 {
+		t.Fatalf("expected template ruleset renamed for the project, got %#v", cfg)
+	}
+
+	if err := runCmdJSON(t, t.TempDir(), a.newInitCmd(), &env, "--template", "local:"+repo+"#default"); err == nil || !strings.Contains(err.Error(), `export "default" of org has no template`) {
+		t.Fatalf("expected export without template to fail, got %v", err)
+	}
+}
+
+func TestProfileListCommandJSON_FiltersSortsAndLimits(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	save := func(alias, sourceType string, moduleCount int) {
+		t.Helper()
+		modules := make([]pack.Module, 0, moduleCount)
+		ids := make([]string, 0, moduleCount)
+		for i := 0; i < moduleCount; i++ {
+			id := alias + ".m" + strconv.Itoa(i)
+			modules = append(modules, pack.Module{ID: id, Priority: i, Content: id + "\n"})
+			ids = append(ids, id)
+		}
+		_, err := profilesvc.SaveSnapshot(profilesvc.SaveInput{
+			Alias:       alias,
+			Sources:     []profilesvc.SourceSnapshot{{SourceType: sourceType, SourceRef: "https://example.com/" + alias + ".git", SourceExport: "default", ModuleIDs: ids}},
+			ContentHash: profilesvc.ComputeContentHash(modules, "default"),
+			Modules:     modules,
+		})
+		if err != nil {
+			t.Fatalf("save profile %s: %v", alias, err)
+		}
+	}
+	save("python-web", "git", 1)
+	save("python-ml", "git", 3)
+	save("go-base", "local", 2)
+
+	a := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	list := func(args ...string) profileListOutput {
+		t.Helper()
+		var env jsonEnvelope
+		if err := runCmdJSON(t, t.TempDir(), a.newProfileListCmd(), &env, args...); err != nil {
+			t.Fatalf("profile list %v failed: %v", args, err)
+		}
+		var out profileListOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("decode profile list: %v", err)
+		}
+		return out
+	}
+	aliases := func(out profileListOutput) []string {
+		names := []string{}
+		for _, p := range out.Profiles {
+			names = append(names, p.Alias)
+		}
+		return names
+	}
+
+	out := list("--sort", "alias")
+	if got := aliases(out); !reflect.DeepEqual(got, []string{"go-base", "python-ml", "python-web"}) || out.Total != 3 || out.Sort != "alias" {
+		t.Fatalf("unexpected alias sort: %v %+v", got, out)
+	}
+	out = list("--filter", "alias=python-*", "--sort", "modules", "--limit", "1")
+	if got := aliases(out); !reflect.DeepEqual(got, []string{"python-ml"}) || out.Matched != 2 || out.Limit != 1 || !reflect.DeepEqual(out.Filters, []string{"alias=python-*"}) {
+		t.Fatalf("unexpected filtered list: %v %+v", got, out)
+	}
+	out = list("--source", "local")
+	if got := aliases(out); !reflect.DeepEqual(got, []string{"go-base"}) || out.Source != "local" {
+		t.Fatalf("unexpected source filter: %v", got)
+	}
+	out = list("--filter", "ref=*web*", "--filter", "export=default")
+	if got := aliases(out); !reflect.DeepEqual(got, []string{"python-web"}) {
+		t.Fatalf("unexpected ref filter: %v", got)
+	}
+
+	var env jsonEnvelope
+	if err := runCmdJSON(t, t.TempDir(), a.newProfileListCmd(), &env, "--filter", "name=x"); err == nil || !strings.Contains(err.Error(), `invalid --filter key "name"`) {
+		t.Fatalf("expected invalid filter key error, got %v", err)
+	}
+	if err := runCmdJSON(t, t.TempDir(), a.newProfileListCmd(), &env, "--sort", "size"); err == nil || !strings.Contains(err.Error(), `invalid --sort "size"`) {
+		t.Fatalf("expected invalid sort error, got %v", err)
+	}
+}
+
+func TestProfileShowCommand_RenderPrintsTargetOutput(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	sourceDir := createLocalSourcePack(t, "new content\n")
+	meta := createSavedProfile(t, sourceDir, "snapshot rule\n")
+	projectDir := t.TempDir()
+
+	a := &app{renderer: cliout.NewHumanRenderer(true)}
+	var buf strings.Builder
+	cmd := a.newProfileShowCmd()
+	cmd.SetOut(&buf)
+	if err := runCmd(t, projectDir, cmd, "python-a", "--render", "copilot"); err != nil {
+		t.Fatalf("profile show --render copilot failed: %v", err)
+	}
+	if !strings.Contains(buf.String(), "snapshot rule") || strings.Contains(buf.String(), "==>") {
+		t.Fatalf("expected raw copilot content, got:\n%s", buf.String())
+	}
+	entries, err := os.ReadDir(projectDir)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("render must not write into the working directory: %v %v", entries, err)
+	}
+
+	ja := &app{renderer: cliout.NewJSONRenderer(), jsonMode: true}
+	var env jsonEnvelope
+	if err := runCmdJSON(t, projectDir, ja.newProfileShowCmd(), &env, meta.ID, "--render", "claude"); err != nil {
+		t.Fatalf("profile show --render claude failed: %v", err)
+	}
+	var out profileRenderOutput
+	if err := json.Unmarshal(env.Result, &out); err != nil {
+		t.Fatalf("decode render output: %v", err)
+	}
+	if out.ProfileID != meta.ID || out.Target != "claude" || len(out.Files) != 1 || !strings.HasPrefix(out.Files[0].Path, ".claude/rules/") || !strings.Contains(out.Files[0].Content, "snapshot rule") {
+		t.Fatalf("unexpected render output: %+v", out)
+	}
+
+	if err := runCmdJSON(t, projectDir, ja.newProfileShowCmd(), &env, meta.ID, "--render", "vim"); err == nil || !strings.Contains(err.Error(), `unknown --render target "vim"`) {
+		t.Fatalf("expected unknown target error, got %v", err)
+	}
+}
+
 func TestProfileCommandsJSON(t *testing.T) {
 	homeDir := t.TempDir()
 	t.Setenv("HOME", homeDir)
@@ -1217,6 +5485,25 @@ func TestProfileCommandsJSON(t *testing.T) {
 		if len(out.ChangedModules) == 0 || out.ChangedModules[0] != "python.base" {
 			t.Fatalf("expected python.base to be changed: %#v", out)
 		}
+		if len(out.ContentDiffs) != 0 {
+			t.Fatalf("expected no content diffs without --content: %#v", out.ContentDiffs)
+		}
+	}
+	{
+		var env jsonEnvelope
+		if err := runCmdJSON(t, projectDir, a.newProfileDiffCmd(), &env, savedMeta.ID, "--content"); err != nil {
+			t.Fatalf("profile diff --content failed: %v", err)
+		}
+		var out profileDiffOutput
+		if err := json.Unmarshal(env.Result, &out); err != nil {
+			t.Fatalf("unmarshal profile diff --content: %v", err)
+		}
+		if len(out.ChangedModules) == 0 || out.ChangedModules[0] != "python.base" {
+			t.Fatalf("expected python.base to be changed with --content: %#v", out)
+		}
+		if len(out.ContentDiffs) == 0 || out.ContentDiffs[0].Title != "python.base" || out.ContentDiffs[0].Before == out.ContentDiffs[0].After {
+			t.Fatalf("expected a content diff for python.base: %#v", out.ContentDiffs)
+		}
 	}
 
 	// profile refresh dry-run should not mutate stored metadata hash
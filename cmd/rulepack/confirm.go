@@ -45,13 +45,20 @@ func promptOptionalAction(cmd *cobra.Command, prompt string, preview []string) (
 }
 
 func readConfirmAnswer(cmd *cobra.Command, prompt string) (string, error) {
-	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s [y/N]: ", prompt)
+	answer, err := readPromptAnswer(cmd, prompt+" [y/N]")
+	return strings.ToLower(answer), err
+}
+
+// readPromptAnswer reads one line answering prompt, trimmed but otherwise as
+// typed.
+func readPromptAnswer(cmd *cobra.Command, prompt string) (string, error) {
+	_, _ = fmt.Fprintf(cmd.ErrOrStderr(), "%s: ", prompt)
 	reader := confirmReader(cmd)
 	line, err := reader.ReadString('\n')
 	if err != nil {
 		return "", err
 	}
-	return strings.ToLower(strings.TrimSpace(line)), nil
+	return strings.TrimSpace(line), nil
 }
 
 func confirmReader(cmd *cobra.Command) *bufio.Reader {
@@ -1,22 +1,25 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
+	"rulepack/internal/auth"
 	"rulepack/internal/build"
 	"rulepack/internal/config"
 	"rulepack/internal/git"
 	"rulepack/internal/pack"
 	profilesvc "rulepack/internal/profile"
+	"rulepack/internal/render"
+	"rulepack/internal/selector"
 )
 
 func resolveTargets(target string) []string {
@@ -27,6 +30,89 @@ func resolveTargets(target string) []string {
 	return []string{target}
 }
 
+// resolveBuildTargets expands "all" to the core targets plus any other
+// configured entry with a known renderer type, such as amazonq, cline, zed,
+// junie, custom, or a named second copilot entry.
+func resolveBuildTargets(target string, configured map[string]config.TargetEntry) []string {
+	targets := resolveTargets(target)
+	if target = strings.ToLower(target); target != "" && target != "all" {
+		return targets
+	}
+	extra := make([]string, 0)
+	for name, entry := range configured {
+		if slices.Contains(targets, name) || !slices.Contains(config.TargetKinds, entry.Kind(name)) {
+			continue
+		}
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	return append(targets, extra...)
+}
+
+// protectedOutputs describes outputs of the given targets that the project's
+// protect settings forbid build from writing.
+func protectedOutputs(cfg config.Ruleset, targets []string, modules []pack.Module) ([]string, error) {
+	if cfg.Protect == nil {
+		return nil, nil
+	}
+	paths := make([]string, 0)
+	for _, t := range targets {
+		entry, ok := cfg.Targets[t]
+		if !ok {
+			continue
+		}
+		paths = append(paths, render.OutputPaths(entry.Kind(t), entry, targetModules(entry, modules))...)
+	}
+	violations := make([]string, 0)
+	for _, p := range paths {
+		if protected, ok := cfg.Protect.Match(p); ok {
+			violations = append(violations, fmt.Sprintf("%s (protected by %q)", p, protected))
+		}
+	}
+	if cfg.Protect.GitIgnored {
+		ignored, err := git.CheckIgnore(paths)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range ignored {
+			violations = append(violations, fmt.Sprintf("%s (ignored by .gitignore)", p))
+		}
+	}
+	return violations, nil
+}
+
+// targetModules applies a target entry's include filter.
+func targetModules(entry config.TargetEntry, modules []pack.Module) []pack.Module {
+	if len(entry.Include) == 0 && len(entry.DisableModules) == 0 {
+		return modules
+	}
+	out := make([]pack.Module, 0, len(modules))
+	for _, m := range modules {
+		if len(entry.Include) > 0 && !pack.MatchesID(m.ID, entry.Include) {
+			continue
+		}
+		if pack.MatchesID(m.ID, entry.DisableModules) {
+			continue
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// exportRemoved replaces a missing-export error from expanding a git
+// dependency at commit with one naming the exports the pack has now.
+func exportRemoved(dep config.Dependency, commit string, err error) error {
+	var missing *pack.MissingExportError
+	if !errors.As(err, &missing) {
+		return err
+	}
+	available := "none"
+	if len(missing.Available) > 0 {
+		available = strings.Join(missing.Available, ", ")
+	}
+	return fmt.Errorf("%s: export %q removed upstream at %s (available exports: %s); choose one with deps add --export, or map the old name in exportAliases", dep.URI, missing.Export, shortSHA(commit), available)
+}
+
 func shortSHA(sha string) string {
 	if len(sha) > 12 {
 		return sha[:12]
@@ -34,6 +120,48 @@ func shortSHA(sha string) string {
 	return sha
 }
 
+// phaseTimer adds up wall time per phase of a command for the timings in
+// its JSON output. A nil timer records nothing.
+type phaseTimer struct {
+	started time.Time
+	phases  map[string]time.Duration
+	targets map[string]time.Duration
+}
+
+func newPhaseTimer() *phaseTimer {
+	return &phaseTimer{started: time.Now(), phases: map[string]time.Duration{}, targets: map[string]time.Duration{}}
+}
+
+// track adds the time since start to phase.
+func (p *phaseTimer) track(phase string, start time.Time) {
+	if p != nil {
+		p.phases[phase] += time.Since(start)
+	}
+}
+
+// trackTarget adds the time since start to rendering target.
+func (p *phaseTimer) trackTarget(target string, start time.Time) {
+	if p != nil {
+		p.targets[target] += time.Since(start)
+	}
+}
+
+func (p *phaseTimer) timings() commandTimings {
+	out := commandTimings{
+		TotalMs:   time.Since(p.started).Milliseconds(),
+		ResolveMs: p.phases["resolve"].Milliseconds(),
+		FetchMs:   p.phases["fetch"].Milliseconds(),
+		ExpandMs:  p.phases["expand"].Milliseconds(),
+	}
+	if len(p.targets) > 0 {
+		out.RenderMs = make(map[string]int64, len(p.targets))
+		for t, d := range p.targets {
+			out.RenderMs[t] = d.Milliseconds()
+		}
+	}
+	return out
+}
+
 func dryRunMessage(dryRun bool) string {
 	if dryRun {
 		return "Dry run only; no profile files were written"
@@ -76,9 +204,9 @@ func resolveLocalPath(cfgDir string, depPath string) (string, string, error) {
 	if depPath == "" {
 		return "", "", errors.New("local source requires path")
 	}
-	absPath := depPath
+	absPath := filepath.FromSlash(config.SlashPath(depPath))
 	if !filepath.IsAbs(absPath) {
-		absPath = filepath.Join(cfgDir, depPath)
+		absPath = filepath.Join(cfgDir, absPath)
 	}
 	absPath = filepath.Clean(absPath)
 	info, err := os.Stat(absPath)
@@ -102,6 +230,45 @@ func resolveLocalPath(cfgDir string, depPath string) (string, string, error) {
 	return absPath, relPath, nil
 }
 
+// profileLocation is where a profile dependency's snapshot was found.
+type profileLocation struct {
+	// ID is the saved profile ID, or the org/name@version of a registry
+	// profile.
+	ID  string
+	Dir string
+	// Commit is the registry commit, or profilesvc.ProfileCommit for saved
+	// profiles.
+	Commit string
+	// Registry is the registry URI; empty for saved profiles.
+	Registry string
+	// Alias and Sources describe a saved profile for its lock entry.
+	Alias   string
+	Sources []profilesvc.SourceSnapshot
+	// Meta is the saved profile's metadata; zero for registry profiles.
+	Meta profilesvc.Metadata
+}
+
+// resolveProfileDependency locates a profile dependency's snapshot. Saved
+// profiles come from the profile stores; an org/name@version ref is fetched
+// from registry at commit (its HEAD when empty) into the local cache.
+func resolveProfileDependency(gc *git.Client, registry, ref, commit string) (profileLocation, error) {
+	if remote, ok := config.ParseRemoteProfile(ref); ok {
+		if registry == "" {
+			return profileLocation{}, fmt.Errorf("remote profile %q requires profileRegistry in %s", ref, rulesetFile)
+		}
+		dir, commit, err := profilesvc.FetchRemote(gc, registry, remote, commit)
+		if err != nil {
+			return profileLocation{}, err
+		}
+		return profileLocation{ID: remote.String(), Dir: dir, Commit: commit, Registry: registry}, nil
+	}
+	meta, dir, err := profilesvc.ResolveIDOrAlias(ref)
+	if err != nil {
+		return profileLocation{}, err
+	}
+	return profileLocation{ID: meta.ID, Dir: dir, Commit: profilesvc.ProfileCommit, Alias: meta.Alias, Sources: meta.Sources, Meta: meta}, nil
+}
+
 func profileDependencyForRead(dep config.Dependency) config.Dependency {
 	out := dep
 	if out.Export == "" {
@@ -118,64 +285,348 @@ func normalizeExportName(export string) string {
 	return export
 }
 
-func buildLock(cfg config.Ruleset, cfgDir string, gc *git.Client) (config.Lockfile, []installResolvedRow, map[string]int, error) {
+func newGitClient() (*git.Client, error) {
+	gc, err := git.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	userCfg, err := config.LoadUserConfig()
+	if err != nil {
+		return nil, err
+	}
+	if len(userCfg.Auth.Hosts) > 0 {
+		gc.Credentials = auth.NewStore().GitCredentials(userCfg)
+	}
+	gc.Mirrors = userCfg.Mirrors
+	return gc, nil
+}
+
+// newProjectGitClient layers the project's mirrors over the user's so a
+// rulepack.json entry wins for the same prefix.
+func newProjectGitClient(cfg config.Ruleset) (*git.Client, error) {
+	gc, err := newGitClient()
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Mirrors) == 0 {
+		return gc, nil
+	}
+	mirrors := make(map[string]string, len(gc.Mirrors)+len(cfg.Mirrors))
+	for prefix, mirror := range gc.Mirrors {
+		mirrors[prefix] = mirror
+	}
+	for prefix, mirror := range cfg.Mirrors {
+		mirrors[prefix] = mirror
+	}
+	gc.Mirrors = mirrors
+	return gc, nil
+}
+
+// buildLock resolves every dependency and also returns every module it
+// provides, for any platform and before ignore rules, with warnings about
+// the composition, such as packs sharing a module ID namespace.
+//
+// Pinned modules whose digest differs from the previous lock fail the
+// install unless their dependency index is in bumpPins.
+//
+// Dependencies with a non-nil hold entry keep its resolution: git sources
+// stay at the held commit, and registry profiles at the held registry
+// commit, without resolving their ref again.
+func buildLock(cfg config.Ruleset, cfgDir string, gc *git.Client, bumpPins map[int]bool, hold []*config.LockedSource, timer *phaseTimer) (config.Lockfile, []installResolvedRow, map[string]int, []pack.Module, []string, error) {
 	lock := config.Lockfile{LockVersion: "0.1"}
 	rows := make([]installResolvedRow, 0, len(cfg.Dependencies))
 	counts := map[string]int{"git": 0, "local": 0, "profile": 0}
+	opts := expandOptions(cfg)
+	var composed []pack.Module
+	// The ignore file does not affect locked hashes; install only reports how
+	// many modules of each dependency it excludes.
+	ignore, err := pack.LoadIgnore(filepath.Join(cfgDir, config.IgnoreFileName))
+	if err != nil {
+		return lock, nil, nil, nil, nil, err
+	}
 	for idx, dep := range cfg.Dependencies {
 		source := dependencySource(dep)
+		var held *config.LockedSource
+		if idx < len(hold) {
+			held = hold[idx]
+		}
 		switch source {
 		case "git":
-			repoDir, err := gc.EnsureRepo(dep.URI)
+			var repoDir string
+			var res git.Resolution
+			start := time.Now()
+			if held != nil {
+				repoDir, err = heldRepo(gc, dep.URI, held.Commit)
+				res = git.Resolution{Requested: held.Requested, ResolvedVersion: held.ResolvedVersion, Commit: held.Commit}
+			} else {
+				repoDir, err = gc.EnsureRepo(dep.URI)
+			}
+			timer.track("fetch", start)
 			if err != nil {
-				return lock, nil, nil, fmt.Errorf("prepare %s: %w", dep.URI, err)
+				return lock, nil, nil, nil, nil, fmt.Errorf("prepare %s: %w", dep.URI, err)
 			}
-			res, err := gc.Resolve(repoDir, dep.Ref, dep.Version)
+			if held == nil {
+				start = time.Now()
+				res, err = gc.Resolve(repoDir, dep.Ref, dep.Version)
+				timer.track("resolve", start)
+				if err != nil {
+					return lock, nil, nil, nil, nil, fmt.Errorf("resolve %s: %w", dep.URI, err)
+				}
+			}
+			start = time.Now()
+			modules, err := pack.ExpandGitDependency(gc, repoDir, dep, config.LockedSource{Source: "git", URI: dep.URI, Commit: res.Commit, Export: dep.Export}, opts)
+			timer.track("expand", start)
+			if err != nil {
+				return lock, nil, nil, nil, nil, exportRemoved(dep, res.Commit, err)
+			}
+			license, err := pack.License(pack.GitReader(gc, repoDir, res.Commit))
 			if err != nil {
-				return lock, nil, nil, fmt.Errorf("resolve %s: %w", dep.URI, err)
+				return lock, nil, nil, nil, nil, err
 			}
-			if _, err := pack.ExpandGitDependency(gc, repoDir, dep, config.LockedSource{Source: "git", URI: dep.URI, Commit: res.Commit, Export: dep.Export}); err != nil {
-				return lock, nil, nil, err
+			if err := checkLicensePolicy(cfg, dep.URI, license); err != nil {
+				return lock, nil, nil, nil, nil, err
 			}
-			lock.Resolved = append(lock.Resolved, config.LockedSource{Source: "git", URI: dep.URI, Requested: res.Requested, ResolvedVersion: res.ResolvedVersion, Commit: res.Commit, Export: dep.Export})
-			rows = append(rows, installResolvedRow{Index: idx + 1, Source: "git", Ref: dep.URI, Export: dep.Export, Resolved: res.Requested, Hash: shortSHA(res.Commit)})
+			pins, err := pinModules(idx, dep, modules)
+			if err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			lock.Resolved = append(lock.Resolved, config.LockedSource{Key: dep.Key(), Source: "git", URI: dep.URI, Requested: res.Requested, ResolvedVersion: res.ResolvedVersion, Commit: res.Commit, Export: dep.Export, License: license, ModuleCount: len(modules), ModulePins: pins})
+			rows = append(rows, installResolvedRow{Index: idx + 1, Source: "git", Ref: dep.URI, Export: dep.Export, Resolved: res.Requested, Hash: shortSHA(res.Commit), Ignored: ignoredCount(ignore, modules)})
+			composed = append(composed, modules...)
 			counts["git"]++
 		case "local":
 			absLocalPath, relPath, err := resolveLocalPath(cfgDir, dep.Path)
 			if err != nil {
-				return lock, nil, nil, err
+				return lock, nil, nil, nil, nil, err
 			}
-			_, contentHash, err := pack.ExpandLocalDependency(absLocalPath, dep, "local")
+			start := time.Now()
+			modules, contentHash, err := pack.ExpandLocalDependency(absLocalPath, dep, "local", opts)
+			timer.track("expand", start)
 			if err != nil {
-				return lock, nil, nil, err
+				return lock, nil, nil, nil, nil, err
 			}
-			lock.Resolved = append(lock.Resolved, config.LockedSource{Source: "local", Path: relPath, Commit: "local", ContentHash: contentHash, Export: dep.Export})
-			rows = append(rows, installResolvedRow{Index: idx + 1, Source: "local", Ref: relPath, Export: dep.Export, Resolved: "local", Hash: shortSHA(contentHash)})
+			license, err := pack.License(pack.LocalReader(absLocalPath))
+			if err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			pins, err := pinModules(idx, dep, modules)
+			if err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			lock.Resolved = append(lock.Resolved, config.LockedSource{Key: dep.Key(), Source: "local", Path: relPath, Commit: "local", ContentHash: contentHash, Export: dep.Export, License: license, ModuleCount: len(modules), ModulePins: pins})
+			rows = append(rows, installResolvedRow{Index: idx + 1, Source: "local", Ref: relPath, Export: dep.Export, Resolved: "local", Hash: shortSHA(contentHash), Ignored: ignoredCount(ignore, modules)})
+			composed = append(composed, modules...)
 			counts["local"]++
 		case profilesvc.ProfileSource:
 			if dep.Profile == "" {
-				return lock, nil, nil, errors.New("profile source requires profile id")
+				return lock, nil, nil, nil, nil, errors.New("profile source requires profile id")
 			}
-			meta, profileDir, err := profilesvc.ResolveIDOrAlias(dep.Profile)
+			heldCommit := ""
+			if held != nil && held.URI != "" {
+				heldCommit = held.Commit
+			}
+			start := time.Now()
+			loc, err := resolveProfileDependency(gc, cfg.ProfileRegistry, dep.Profile, heldCommit)
+			timer.track("fetch", start)
 			if err != nil {
-				return lock, nil, nil, err
+				return lock, nil, nil, nil, nil, err
+			}
+			if len(loc.Meta.Conflicts) > 0 {
+				return lock, nil, nil, nil, nil, fmt.Errorf("profile %s has unresolved refresh conflicts in %s; resolve the conflict markers in those modules before installing", loc.ID, strings.Join(loc.Meta.Conflicts, ", "))
 			}
 			depRead := profileDependencyForRead(dep)
-			_, contentHash, err := pack.ExpandProfileDependency(profileDir, depRead, profilesvc.ProfileCommit)
+			start = time.Now()
+			modules, contentHash, err := profilesvc.Expand(loc.Dir, depRead, opts)
+			timer.track("expand", start)
+			if err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			reader, err := profilesvc.Reader(loc.Dir)
+			if err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			license, err := pack.License(reader)
+			if err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			if err := checkLicensePolicy(cfg, loc.ID, license); err != nil {
+				return lock, nil, nil, nil, nil, err
+			}
+			pins, err := pinModules(idx, dep, modules)
 			if err != nil {
-				return lock, nil, nil, err
+				return lock, nil, nil, nil, nil, err
 			}
-			lock.Resolved = append(lock.Resolved, config.LockedSource{Source: profilesvc.ProfileSource, Profile: meta.ID, Commit: profilesvc.ProfileCommit, ContentHash: contentHash, Export: depRead.Export})
-			rows = append(rows, installResolvedRow{Index: idx + 1, Source: "profile", Ref: meta.ID, Export: depRead.Export, Resolved: "profile", Hash: shortSHA(contentHash)})
+			lock.Resolved = append(lock.Resolved, config.LockedSource{Key: dep.Key(), Source: profilesvc.ProfileSource, URI: loc.Registry, Profile: loc.ID, Commit: loc.Commit, ContentHash: contentHash, Export: depRead.Export, License: license, ModuleCount: len(modules), ProfileAlias: loc.Alias, ProfileSources: loc.Sources, ModulePins: pins})
+			resolved := "profile"
+			if loc.Registry != "" {
+				resolved = "registry@" + shortSHA(loc.Commit)
+			}
+			rows = append(rows, installResolvedRow{Index: idx + 1, Source: "profile", Ref: loc.ID, Export: depRead.Export, Resolved: resolved, Hash: shortSHA(contentHash), Ignored: ignoredCount(ignore, modules)})
+			composed = append(composed, modules...)
 			counts["profile"]++
 		default:
-			return lock, nil, nil, fmt.Errorf("unsupported source %q", dep.Source)
+			return lock, nil, nil, nil, nil, fmt.Errorf("unsupported source %q", dep.Source)
+		}
+	}
+	// A missing or unreadable previous lock just means every entry is new.
+	previous, _ := config.LoadLockfile(filepath.Join(cfgDir, filepath.Base(lockFile)))
+	if err := checkModulePins(lock.Resolved, previous.Resolved, bumpPins); err != nil {
+		return lock, nil, nil, nil, nil, err
+	}
+	stampLockedAt(lock.Resolved, previous.Resolved, time.Now().UTC())
+	kept, _ := ignore.Filter(composed)
+	if lock.RulesetDigest, err = build.RulesetDigest(composed); err != nil {
+		return lock, nil, nil, nil, nil, err
+	}
+	warnings := make([]string, 0)
+	for _, issue := range render.LintNamespaces(kept) {
+		warnings = append(warnings, issue.Message)
+	}
+	return lock, rows, counts, composed, warnings, nil
+}
+
+// heldRepo returns the mirror of uri, fetching only when the cached one
+// lacks commit.
+func heldRepo(gc *git.Client, uri, commit string) (string, error) {
+	if repoDir, ok := gc.CachedRepo(uri); ok {
+		if _, err := gc.CommitTime(repoDir, commit); err == nil {
+			return repoDir, nil
+		}
+	}
+	return gc.EnsureRepo(uri)
+}
+
+// pinModules returns the digests of the modules dep pins. Pinning a module
+// the export does not provide is an error, so a typo cannot pin nothing.
+func pinModules(idx int, dep config.Dependency, modules []pack.Module) (map[string]string, error) {
+	if len(dep.Pin) == 0 {
+		return nil, nil
+	}
+	byID := make(map[string]pack.Module, len(modules))
+	for _, m := range modules {
+		byID[m.ID] = m
+	}
+	pins := make(map[string]string, len(dep.Pin))
+	for _, id := range dep.Pin {
+		m, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("dependency %d (%s) pins module %q, which it does not provide", idx+1, dependencyReference(dep), id)
+		}
+		pins[id] = profilesvc.ModuleDigest(m)
+	}
+	return pins, nil
+}
+
+// modulePinChanges compares the pins of resolved with the entries of
+// previous for the same source and export. Modules pinned for the first
+// time are not changes.
+func modulePinChanges(resolved, previous []config.LockedSource) []pinChangeRow {
+	changes := []pinChangeRow{}
+	for i, entry := range resolved {
+		for _, old := range previous {
+			if lockSource(old) != lockSource(entry) || lockSourceReference(old) != lockSourceReference(entry) || old.Export != entry.Export {
+				continue
+			}
+			ids := make([]string, 0, len(entry.ModulePins))
+			for id := range entry.ModulePins {
+				ids = append(ids, id)
+			}
+			buildSortStrings(ids)
+			for _, id := range ids {
+				if from, ok := old.ModulePins[id]; ok && from != entry.ModulePins[id] {
+					changes = append(changes, pinChangeRow{Index: i + 1, Ref: lockSourceReference(entry), Module: id, From: from, To: entry.ModulePins[id]})
+				}
+			}
+			break
 		}
 	}
-	return lock, rows, counts, nil
+	return changes
 }
 
-func expandDependencyForSnapshot(cfgDir string, gc *git.Client, dep config.Dependency, locked config.LockedSource) ([]pack.Module, string, string, map[string]string, error) {
+// checkModulePins fails when a pinned module changed in a dependency whose
+// index (zero-based) is not in bump.
+func checkModulePins(resolved, previous []config.LockedSource, bump map[int]bool) error {
+	lines := []string{}
+	for _, c := range modulePinChanges(resolved, previous) {
+		if bump[c.Index-1] {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("dependency %d (%s) module %s: locked %s, now %s", c.Index, c.Ref, c.Module, shortSHA(c.From), shortSHA(c.To)))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return fmt.Errorf("pinned modules changed: %s; review the changes and run rulepack deps update to accept them", strings.Join(lines, "; "))
+}
+
+// stampLockedAt carries LockedAt over from previous entries that resolved to
+// the same content and stamps the rest with now.
+func stampLockedAt(resolved, previous []config.LockedSource, now time.Time) {
+	for i := range resolved {
+		resolved[i].LockedAt = now.Format(time.RFC3339)
+		for _, old := range previous {
+			if old.LockedAt != "" && sameResolution(old, resolved[i]) {
+				resolved[i].LockedAt = old.LockedAt
+				break
+			}
+		}
+	}
+}
+
+func sameResolution(a, b config.LockedSource) bool {
+	return lockSource(a) == lockSource(b) &&
+		lockSourceReference(a) == lockSourceReference(b) &&
+		a.Export == b.Export &&
+		a.Commit == b.Commit &&
+		a.ContentHash == b.ContentHash
+}
+
+func ignoredCount(ignore pack.Ignore, modules []pack.Module) int {
+	_, ignored := ignore.Filter(modules)
+	return len(ignored)
+}
+
+func expandOptions(cfg config.Ruleset) pack.Options {
+	limits := cfg.Policy.EffectiveLimits()
+	return pack.Options{
+		MaxModuleBytes: limits.MaxModuleBytes,
+		MaxModules:     limits.MaxModulesPerDependency,
+		NFC:            cfg.Normalize != nil && cfg.Normalize.Unicode == config.UnicodeNFC,
+	}
+}
+
+// checkLicensePolicy gates imported content. Local packs are authored in-tree
+// and are not subject to the policy.
+func checkLicensePolicy(cfg config.Ruleset, ref string, license string) error {
+	if cfg.Policy == nil || cfg.Policy.Licenses.Allows(license) {
+		return nil
+	}
+	if license == "" {
+		return fmt.Errorf("license policy: %s declares no license", ref)
+	}
+	return fmt.Errorf("license policy: %s license %q is not allowed", ref, license)
+}
+
+// checkApprovals fails unless every dependency's lock entry is covered by
+// one of its approvals, for --require-approved.
+func checkApprovals(deps []config.Dependency, lock config.Lockfile) error {
+	locked, err := lock.Align(deps)
+	if err != nil {
+		return err
+	}
+	var unapproved []string
+	for i, dep := range deps {
+		if hash := locked[i].ApprovalHash(); !dep.Approved(hash) {
+			unapproved = append(unapproved, fmt.Sprintf("dependency %d (%s) content %s", i+1, dep.Key(), hash))
+		}
+	}
+	if len(unapproved) > 0 {
+		return fmt.Errorf("approval required: %s not approved; add the hash to approvals", strings.Join(unapproved, ", "))
+	}
+	return nil
+}
+
+func expandDependencyForSnapshot(cfgDir string, gc *git.Client, dep config.Dependency, locked config.LockedSource, opts pack.Options) ([]pack.Module, string, string, map[string]string, error) {
 	source := dependencySource(dep)
 	if source != lockSource(locked) {
 		return nil, "", "", nil, errors.New("cannot save profile: dependency not installed; run rulepack deps install")
@@ -189,7 +640,7 @@ func expandDependencyForSnapshot(cfgDir string, gc *git.Client, dep config.Depen
 		if err != nil {
 			return nil, "", "", nil, err
 		}
-		modules, err := pack.ExpandGitDependency(gc, repoDir, dep, locked)
+		modules, err := pack.ExpandGitDependency(gc, repoDir, dep, locked, opts)
 		if err != nil {
 			return nil, "", "", nil, err
 		}
@@ -215,7 +666,7 @@ func expandDependencyForSnapshot(cfgDir string, gc *git.Client, dep config.Depen
 		if locked.Path != "" && relPath != locked.Path {
 			return nil, "", "", nil, errors.New("cannot save profile: dependency not installed; run rulepack deps install")
 		}
-		modules, hash, err := pack.ExpandLocalDependency(absLocalPath, dep, "local")
+		modules, hash, err := pack.ExpandLocalDependency(absLocalPath, dep, "local", opts)
 		if err != nil {
 			return nil, "", "", nil, err
 		}
@@ -229,37 +680,42 @@ func expandDependencyForSnapshot(cfgDir string, gc *git.Client, dep config.Depen
 		if profileRef == "" {
 			profileRef = locked.Profile
 		}
-		meta, profileDir, err := profilesvc.ResolveIDOrAlias(profileRef)
+		loc, err := resolveProfileDependency(gc, locked.URI, profileRef, locked.Commit)
 		if err != nil {
 			return nil, "", "", nil, err
 		}
-		if locked.Profile != "" && meta.ID != locked.Profile {
+		if locked.Profile != "" && loc.ID != locked.Profile {
 			return nil, "", "", nil, errors.New("cannot save profile: dependency not installed; run rulepack deps install")
 		}
 		depRead := profileDependencyForRead(dep)
-		modules, hash, err := pack.ExpandProfileDependency(profileDir, depRead, profilesvc.ProfileCommit)
+		modules, hash, err := profilesvc.Expand(loc.Dir, depRead, opts)
 		if err != nil {
 			return nil, "", "", nil, err
 		}
 		if locked.ContentHash != "" && hash != locked.ContentHash {
 			return nil, "", "", nil, errors.New("cannot save profile: dependency not installed; run rulepack deps install")
 		}
-		prov := map[string]string{"profile": meta.ID, "contentHash": hash}
-		return modules, hash, meta.ID, prov, nil
+		prov := map[string]string{"profile": loc.ID, "contentHash": hash}
+		if loc.Registry != "" {
+			prov["registry"] = loc.Registry
+			prov["commit"] = loc.Commit
+		}
+		return modules, hash, loc.ID, prov, nil
 	default:
 		return nil, "", "", nil, fmt.Errorf("unsupported source %q", dep.Source)
 	}
 }
 
 func collectSnapshotForAllDependencies(cfg config.Ruleset, lock config.Lockfile, cfgDir string, gc *git.Client) ([]pack.Module, []profilesvc.SourceSnapshot, error) {
-	if len(cfg.Dependencies) != len(lock.Resolved) {
+	aligned, err := lock.Align(cfg.Dependencies)
+	if err != nil {
 		return nil, nil, errors.New("cannot save profile: dependency not installed; run rulepack deps install")
 	}
 	modules := make([]pack.Module, 0)
 	sources := make([]profilesvc.SourceSnapshot, 0, len(cfg.Dependencies))
 	for i, dep := range cfg.Dependencies {
-		locked := lock.Resolved[i]
-		expanded, _, sourceRef, provenance, err := expandDependencyForSnapshot(cfgDir, gc, dep, locked)
+		locked := aligned[i]
+		expanded, _, sourceRef, provenance, err := expandDependencyForSnapshot(cfgDir, gc, dep, locked, expandOptions(cfg))
 		if err != nil {
 			return nil, nil, err
 		}
@@ -284,11 +740,11 @@ func collectSnapshotForAllDependencies(cfg config.Ruleset, lock config.Lockfile,
 	return modules, sources, nil
 }
 
-func findDependencyIndex(cfg config.Ruleset, selector string) (int, error) {
-	if selector == "" {
+func findDependencyIndex(cfg config.Ruleset, ref string) (int, error) {
+	if ref == "" {
 		return -1, errors.New("missing --dep selector")
 	}
-	if n, err := strconv.Atoi(selector); err == nil {
+	if n, err := strconv.Atoi(ref); err == nil {
 		if n >= 1 && n <= len(cfg.Dependencies) {
 			return n - 1, nil
 		}
@@ -297,19 +753,40 @@ func findDependencyIndex(cfg config.Ruleset, selector string) (int, error) {
 		}
 		return -1, fmt.Errorf("dependency index %d out of range", n)
 	}
-	index := -1
+	refs := make([]string, len(cfg.Dependencies))
+	candidates := make([][]string, len(cfg.Dependencies))
 	for i, dep := range cfg.Dependencies {
-		if dependencyReference(dep) == selector {
-			if index != -1 {
-				return -1, fmt.Errorf("selector %q matched multiple dependencies", selector)
+		refs[i] = dependencyReference(dep)
+		candidates[i] = []string{refs[i]}
+		if dep.Name != "" {
+			candidates[i] = append(candidates[i], dep.Name)
+		}
+	}
+	matches := selector.Match(ref, candidates)
+	switch len(matches) {
+	case 0:
+		return -1, fmt.Errorf("dependency selector %q not found%s", ref, selector.Hint(selector.Suggest(ref, refs)))
+	case 1:
+		return matches[0], nil
+	default:
+		listed := make([]string, len(matches))
+		for i, idx := range matches {
+			listed[i] = fmt.Sprintf("#%d %s", idx+1, refs[idx])
+			if export := cfg.Dependencies[idx].Export; export != "" {
+				listed[i] += " export=" + export
 			}
-			index = i
 		}
+		return -1, fmt.Errorf("selector %q matched multiple dependencies: %s", ref, strings.Join(listed, ", "))
 	}
-	if index == -1 {
-		return -1, fmt.Errorf("dependency selector %q not found", selector)
+}
+
+// dependencyLabel names dependency i (zero-based) in messages by its
+// position and its name or reference.
+func dependencyLabel(i int, dep config.Dependency) string {
+	if dep.Name != "" {
+		return fmt.Sprintf("dependency %d (%s)", i+1, dep.Name)
 	}
-	return index, nil
+	return fmt.Sprintf("dependency %d (%s)", i+1, dependencyReference(dep))
 }
 
 func dependencyReference(dep config.Dependency) string {
@@ -348,6 +825,9 @@ func dependencyFromSourceSnapshot(src profilesvc.SourceSnapshot) (config.Depende
 		dep.Path = src.SourceRef
 	case profilesvc.ProfileSource:
 		dep.Profile = src.SourceRef
+		// Registry profiles carry their registry in URI; resolveModulesForDependency
+		// reads it from there.
+		dep.URI = src.Provenance["registry"]
 	default:
 		return config.Dependency{}, fmt.Errorf("unsupported profile source type %q", src.SourceType)
 	}
@@ -358,7 +838,10 @@ func sourceStatusLabel(sourceType string, sourceRef string) string {
 	return sourceType + ":" + sourceRef
 }
 
-func resolveFreshModulesForProfile(gc *git.Client, meta profilesvc.Metadata, oldModules []pack.Module) ([]pack.Module, []sourceStatus, []sourceSkip, error) {
+// resolveFreshModulesForProfile re-resolves a profile's sources. When only is
+// non-nil, sources whose index it does not contain keep their snapshot
+// modules without being reported as refreshed or skipped.
+func resolveFreshModulesForProfile(gc *git.Client, meta profilesvc.Metadata, oldModules []pack.Module, only map[int]bool) ([]pack.Module, []sourceStatus, []sourceSkip, error) {
 	if len(meta.Sources) == 0 {
 		return nil, nil, nil, errors.New("unsupported profile format: missing sources; re-save profile with current CLI")
 	}
@@ -371,7 +854,16 @@ func resolveFreshModulesForProfile(gc *git.Client, meta profilesvc.Metadata, old
 	fresh := make([]pack.Module, 0, len(oldModules))
 	refreshed := make([]sourceStatus, 0, len(meta.Sources))
 	skipped := make([]sourceSkip, 0)
-	for _, src := range meta.Sources {
+	for i, src := range meta.Sources {
+		if only != nil && !only[i] {
+			for _, id := range src.ModuleIDs {
+				if m, ok := oldByID[id]; ok {
+					fresh = append(fresh, m)
+					seen[id] = struct{}{}
+				}
+			}
+			continue
+		}
 		label := sourceStatusLabel(src.SourceType, src.SourceRef)
 		dep, depErr := dependencyFromSourceSnapshot(src)
 		if depErr == nil {
@@ -408,6 +900,8 @@ func resolveFreshModulesForProfile(gc *git.Client, meta profilesvc.Metadata, old
 }
 
 func resolveModulesForDependency(gc *git.Client, dep config.Dependency) ([]pack.Module, error) {
+	// Profiles refresh outside any project, so only the default limits apply.
+	opts := expandOptions(config.Ruleset{})
 	switch dependencySource(dep) {
 	case "git":
 		repoDir, err := gc.EnsureRepo(dep.URI)
@@ -418,18 +912,18 @@ func resolveModulesForDependency(gc *git.Client, dep config.Dependency) ([]pack.
 		if err != nil {
 			return nil, err
 		}
-		return pack.ExpandGitDependency(gc, repoDir, dep, config.LockedSource{Source: "git", URI: dep.URI, Commit: res.Commit, Export: dep.Export})
+		return pack.ExpandGitDependency(gc, repoDir, dep, config.LockedSource{Source: "git", URI: dep.URI, Commit: res.Commit, Export: dep.Export}, opts)
 	case "local":
-		absPath := filepath.Clean(dep.Path)
-		returnModules, _, err := pack.ExpandLocalDependency(absPath, dep, "local")
+		absPath := filepath.FromSlash(config.SlashPath(dep.Path))
+		returnModules, _, err := pack.ExpandLocalDependency(absPath, dep, "local", opts)
 		return returnModules, err
 	case profilesvc.ProfileSource:
-		meta, profileDir, err := profilesvc.ResolveIDOrAlias(dep.Profile)
+		loc, err := resolveProfileDependency(gc, dep.URI, dep.Profile, "")
 		if err != nil {
 			return nil, err
 		}
-		depRead := profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: meta.ID, Export: "default"})
-		mods, _, err := pack.ExpandProfileDependency(profileDir, depRead, profilesvc.ProfileCommit)
+		depRead := profileDependencyForRead(config.Dependency{Source: profilesvc.ProfileSource, Profile: loc.ID, Export: dep.Export})
+		mods, _, err := profilesvc.Expand(loc.Dir, depRead, opts)
 		return mods, err
 	default:
 		return nil, fmt.Errorf("unsupported source %q", dep.Source)
@@ -515,7 +1009,7 @@ func diffModules(current []pack.Module, fresh []pack.Module) ([]string, []string
 			removed = append(removed, id)
 			continue
 		}
-		if moduleDigest(oldMod) != moduleDigest(newMod) {
+		if profilesvc.ModuleDigest(oldMod) != profilesvc.ModuleDigest(newMod) {
 			changed = append(changed, id)
 		}
 	}
@@ -531,10 +1025,107 @@ func diffModules(current []pack.Module, fresh []pack.Module) ([]string, []string
 	return changed, added, removed
 }
 
-func moduleDigest(m pack.Module) string {
-	applyJSON, _ := json.Marshal(m.Apply)
-	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", m.ID, m.Priority, m.Content, string(applyJSON))))
-	return hex.EncodeToString(sum[:])
+// detectRenames pairs removed and added modules with identical, non-blank
+// content as probable renames, and returns them with what is left of
+// removed and added. Each added module pairs with at most one removed one.
+func detectRenames(before, after []pack.Module, removed, added []string) ([]moduleRename, []string, []string) {
+	content := func(modules []pack.Module) map[string]string {
+		byID := make(map[string]string, len(modules))
+		for _, m := range modules {
+			byID[m.ID] = m.Content
+		}
+		return byID
+	}
+	old, fresh := content(before), content(after)
+	renames := []moduleRename{}
+	taken := map[string]bool{}
+	keptRemoved := make([]string, 0, len(removed))
+	for _, from := range removed {
+		to := ""
+		if strings.TrimSpace(old[from]) != "" {
+			for _, id := range added {
+				if !taken[id] && fresh[id] == old[from] {
+					to = id
+					break
+				}
+			}
+		}
+		if to == "" {
+			keptRemoved = append(keptRemoved, from)
+			continue
+		}
+		taken[to] = true
+		renames = append(renames, moduleRename{From: from, To: to})
+	}
+	keptAdded := make([]string, 0, len(added))
+	for _, id := range added {
+		if !taken[id] {
+			keptAdded = append(keptAdded, id)
+		}
+	}
+	return renames, keptRemoved, keptAdded
+}
+
+// carryOverrides points each override of a renamed module at its new ID,
+// unless an override already targets the new ID, and reports which renames
+// it carried.
+func carryOverrides(overrides []config.Override, renames []moduleRename) []bool {
+	carried := make([]bool, len(renames))
+	for i, r := range renames {
+		if slices.ContainsFunc(overrides, func(ov config.Override) bool { return ov.ID == r.To }) {
+			continue
+		}
+		for j := range overrides {
+			if overrides[j].ID == r.From {
+				overrides[j].ID = r.To
+				carried[i] = true
+			}
+		}
+	}
+	return carried
+}
+
+// prunedLockRows describes the entries of lock at indexes.
+func prunedLockRows(lock config.Lockfile, indexes []int) []prunedLockRow {
+	rows := make([]prunedLockRow, 0, len(indexes))
+	for _, i := range indexes {
+		locked := lock.Resolved[i]
+		rows = append(rows, prunedLockRow{Key: locked.Key, Source: lockSource(locked), Ref: lockSourceReference(locked), Resolved: lockReference(locked)})
+	}
+	return rows
+}
+
+// deadOverrides returns the IDs of overrides that match none of modules, in
+// override order. An ID overridden twice is listed once.
+func deadOverrides(overrides []config.Override, modules []pack.Module) []string {
+	ids := make(map[string]bool, len(modules))
+	for _, m := range modules {
+		ids[m.ID] = true
+	}
+	var dead []string
+	for _, ov := range overrides {
+		if !ids[ov.ID] && !slices.Contains(dead, ov.ID) {
+			dead = append(dead, ov.ID)
+		}
+	}
+	return dead
+}
+
+// checkOverrides returns a warning per override matching none of modules,
+// or, when strict, fails naming them all.
+func checkOverrides(overrides []config.Override, modules []pack.Module, strict bool) ([]string, error) {
+	dead := deadOverrides(overrides, modules)
+	if len(dead) == 0 {
+		return nil, nil
+	}
+	if strict {
+		return nil, fmt.Errorf("overrides match no composed module: %s; remove them with rulepack overrides prune", strings.Join(dead, ", "))
+	}
+	warnings := make([]string, 0, len(dead))
+	for _, id := range dead {
+		warnings = append(warnings, fmt.Sprintf("override for %s matches no composed module; remove it with rulepack overrides prune", id))
+	}
+	return warnings, nil
 }
 
 func moduleMatchesAny(id string, patterns []string) bool {
@@ -612,7 +1203,7 @@ func initTemplate(name string, template string) (config.Ruleset, []templateFile,
 			{Path: ".rulepack/packs/rule-authoring/modules/authoring/tests.md", Content: "# Rule Authoring Testability\n\n- Add at least one acceptance criterion for each rule module.\n- Validate generated outputs in CI with deterministic checks.\n- Fail builds when local rule dependencies drift without reinstall.\n"},
 		}, nil
 	default:
-		return config.Ruleset{}, nil, fmt.Errorf("unknown template %q (supported: rulepack)", template)
+		return config.Ruleset{}, nil, fmt.Errorf("unknown template %q (supported: rulepack, git:<uri>#<export>, local:<path>#<export>)", template)
 	}
 }
 
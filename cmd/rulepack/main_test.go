@@ -1,14 +1,31 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"rulepack/internal/config"
+	"rulepack/internal/git"
 	"rulepack/internal/pack"
 )
 
+// TestMain lets tests run the test binary as the rulepack CLI, for commands
+// such as for-each that re-execute themselves.
+func TestMain(m *testing.M) {
+	if os.Getenv("RULEPACK_TEST_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
 func TestResolveLocalPath_RelativeToConfigDir(t *testing.T) {
 	cfgDir := t.TempDir()
 	localDir := filepath.Join(cfgDir, "packs", "local-pack")
@@ -83,6 +100,28 @@ func TestFindDependencyIndexBySource(t *testing.T) {
 	}
 }
 
+func TestFindDependencyIndexPrefixAndSuggestions(t *testing.T) {
+	cfg := config.Ruleset{
+		Dependencies: []config.Dependency{
+			{Source: "git", URI: "https://example.com/python.git"},
+			{Source: "git", URI: "https://example.com/pytest.git", Export: "strict"},
+			{Source: "local", Path: "../shared-rules"},
+		},
+	}
+	idx, err := findDependencyIndex(cfg, "../sh")
+	if err != nil || idx != 2 {
+		t.Fatalf("expected unique prefix to resolve to 2, got %d (%v)", idx, err)
+	}
+	_, err = findDependencyIndex(cfg, "https://example.com/py")
+	if err == nil || !strings.Contains(err.Error(), "matched multiple dependencies: #1 https://example.com/python.git, #2 https://example.com/pytest.git export=strict") {
+		t.Fatalf("expected ambiguity error listing candidates, got %v", err)
+	}
+	_, err = findDependencyIndex(cfg, "https://example.com/pyhton.git")
+	if err == nil || !strings.Contains(err.Error(), `not found (did you mean "https://example.com/python.git"`) {
+		t.Fatalf("expected did-you-mean suggestion, got %v", err)
+	}
+}
+
 func TestMergeRefreshedModulesSelective(t *testing.T) {
 	current := []pack.Module{
 		{ID: "python.base", Priority: 100, Content: "old\n"},
@@ -126,6 +165,54 @@ func TestLockReference(t *testing.T) {
 	}
 }
 
+func TestParseBrowserURL(t *testing.T) {
+	tests := []struct {
+		raw, ref string
+		want     browserSource
+		ok       bool
+	}{
+		{raw: "https://github.com/org/rules", want: browserSource{URI: "https://github.com/org/rules.git"}, ok: true},
+		{raw: "https://github.com/org/rules/tree/main/languages/python", want: browserSource{URI: "https://github.com/org/rules.git", Ref: "main", Dir: "languages/python"}, ok: true},
+		{raw: "https://github.com/org/rules/blob/v1.2.0/rulepack.json", want: browserSource{URI: "https://github.com/org/rules.git", Ref: "v1.2.0"}, ok: true},
+		{raw: "https://github.com/org/rules/tree/feature/x/languages", ref: "feature/x", want: browserSource{URI: "https://github.com/org/rules.git", Ref: "feature/x", Dir: "languages"}, ok: true},
+		{raw: "https://gitlab.com/group/sub/rules/-/tree/main/standards", want: browserSource{URI: "https://gitlab.com/group/sub/rules.git", Ref: "main", Dir: "standards"}, ok: true},
+		{raw: "https://github.com/org/rules/pulls"},
+		{raw: "https://example.com/rules.git"},
+		{raw: "git@github.com:org/rules.git"},
+	}
+	for _, tt := range tests {
+		got, ok := parseBrowserURL(tt.raw, tt.ref)
+		if ok != tt.ok || got != tt.want {
+			t.Fatalf("parseBrowserURL(%q, %q) = %+v, %v; want %+v, %v", tt.raw, tt.ref, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseShorthand(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    browserSource
+		ok      bool
+		wantErr bool
+	}{
+		{raw: "gh:org/rules", want: browserSource{URI: "https://github.com/org/rules.git"}, ok: true},
+		{raw: "gh:org/rules//languages/python@v1.2.0", want: browserSource{URI: "https://github.com/org/rules.git", Ref: "v1.2.0", Dir: "languages/python"}, ok: true},
+		{raw: "gh:org/rules@feature/x", want: browserSource{URI: "https://github.com/org/rules.git", Ref: "feature/x"}, ok: true},
+		{raw: "gl:group/sub/rules//standards", want: browserSource{URI: "https://gitlab.com/group/sub/rules.git", Dir: "standards"}, ok: true},
+		{raw: "gh:org", wantErr: true},
+		{raw: "gh:org/sub/rules", wantErr: true},
+		{raw: "gh:org/rules@", wantErr: true},
+		{raw: "https://github.com/org/rules.git"},
+		{raw: "git@github.com:org/rules.git"},
+	}
+	for _, tt := range tests {
+		got, ok, err := parseShorthand(tt.raw)
+		if (err != nil) != tt.wantErr || ok != tt.ok || got != tt.want {
+			t.Fatalf("parseShorthand(%q) = %+v, %v, %v; want %+v, %v, error %v", tt.raw, got, ok, err, tt.want, tt.ok, tt.wantErr)
+		}
+	}
+}
+
 func TestDryRunMessage(t *testing.T) {
 	if got := dryRunMessage(true); got == "" {
 		t.Fatalf("expected dry-run message")
@@ -158,6 +245,24 @@ func TestDiffModules(t *testing.T) {
 	}
 }
 
+func TestDetectRenames(t *testing.T) {
+	before := []pack.Module{{ID: "a.old", Content: "same\n"}, {ID: "b.gone", Content: "gone\n"}, {ID: "c.blank", Content: "\n"}}
+	after := []pack.Module{{ID: "a.new", Content: "same\n"}, {ID: "d.added", Content: "new\n"}, {ID: "e.blank", Content: "\n"}}
+	renames, removed, added := detectRenames(before, after, []string{"a.old", "b.gone", "c.blank"}, []string{"a.new", "d.added", "e.blank"})
+	if !slices.Equal(renames, []moduleRename{{From: "a.old", To: "a.new"}}) {
+		t.Fatalf("unexpected renames: %#v", renames)
+	}
+	if !slices.Equal(removed, []string{"b.gone", "c.blank"}) || !slices.Equal(added, []string{"d.added", "e.blank"}) {
+		t.Fatalf("unexpected leftovers: removed=%v added=%v", removed, added)
+	}
+
+	overrides := []config.Override{{ID: "a.old"}, {ID: "x.old"}, {ID: "x.new"}}
+	carried := carryOverrides(overrides, []moduleRename{{From: "a.old", To: "a.new"}, {From: "x.old", To: "x.new"}})
+	if !slices.Equal(carried, []bool{true, false}) || overrides[0].ID != "a.new" || overrides[1].ID != "x.old" {
+		t.Fatalf("unexpected carry: %v %#v", carried, overrides)
+	}
+}
+
 func TestFilterModulesByPatterns(t *testing.T) {
 	modules := []pack.Module{
 		{ID: "python.base"},
@@ -188,3 +293,47 @@ func TestAppVersionDefaultsToDev(t *testing.T) {
 		t.Fatalf("expected dev, got %q", got)
 	}
 }
+
+func TestFetchRepos_CancelledContextReportsEveryURI(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	gc, err := git.NewClient()
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var uris []string
+	for i := range 32 {
+		uri := filepath.Join(t.TempDir(), fmt.Sprintf("repo-%d", i))
+		uris = append(uris, uri, uri)
+	}
+	results := fetchRepos(ctx, gc, uris, time.Minute, 4)
+	if len(results) != 32 {
+		t.Fatalf("expected one result per distinct URI, got %d", len(results))
+	}
+	for uri, result := range results {
+		if result.err == nil || !result.cancelled {
+			t.Fatalf("expected %s cancelled, got %#v", uri, result)
+		}
+	}
+}
+
+func TestRunNotify_PassesOnlyNamedSecrets(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	t.Setenv("GITHUB_TOKEN", "ghp_secret")
+	t.Setenv("RULEPACK_TEST_CHAT_TOKEN", "chat")
+	out := filepath.Join(t.TempDir(), "env")
+	if err := runNotify([]string{"sh", "-c", `env > "$0"`, out}, []string{"RULEPACK_TEST_CHAT_TOKEN"}, []byte("{}")); err != nil {
+		t.Fatalf("runNotify: %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read env: %v", err)
+	}
+	env := string(data)
+	if strings.Contains(env, "GITHUB_TOKEN") || !strings.Contains(env, "RULEPACK_TEST_CHAT_TOKEN=chat") {
+		t.Fatalf("expected only the named secret in the notify environment, got:\n%s", env)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"rulepack/internal/build"
+	"rulepack/internal/config"
+	"rulepack/internal/git"
+	"rulepack/internal/pack"
+	profilesvc "rulepack/internal/profile"
+)
+
+// notifyTimeout bounds one webhook request or notify command.
+const notifyTimeout = 30 * time.Second
+
+// notifyPayload describes the dependency changes one deps install or deps
+// update wrote. Text is a one-line summary, so chat webhooks such as Slack's
+// can post the payload as is.
+type notifyPayload struct {
+	Event        string             `json:"event"`
+	Project      string             `json:"project"`
+	LockFile     string             `json:"lockFile"`
+	Text         string             `json:"text"`
+	Dependencies []notifyDependency `json:"dependencies"`
+}
+
+// notifyDependency is one added, updated, or removed lock entry. Module
+// lists are only set when the previous content could be read back, which
+// excludes local packs.
+type notifyDependency struct {
+	Name           string         `json:"name"`
+	Source         string         `json:"source"`
+	Ref            string         `json:"ref"`
+	Change         string         `json:"change"`
+	From           string         `json:"from,omitempty"`
+	To             string         `json:"to,omitempty"`
+	Version        string         `json:"version,omitempty"`
+	AddedModules   []string       `json:"addedModules,omitempty"`
+	RemovedModules []string       `json:"removedModules,omitempty"`
+	ChangedModules []string       `json:"changedModules,omitempty"`
+	RenamedModules []moduleRename `json:"renamedModules,omitempty"`
+}
+
+// dependencyChanges compares the lock a command wrote with the previous one.
+// deps holds the dependency of each entry of lock.Resolved.
+func dependencyChanges(gc *git.Client, opts pack.Options, deps []config.Dependency, previous, lock config.Lockfile) []notifyDependency {
+	changes := []notifyDependency{}
+	pairs, unpaired := pairLockEntries(previous.Resolved, lock.Resolved)
+	for i, locked := range lock.Resolved {
+		var dep config.Dependency
+		if i < len(deps) {
+			dep = deps[i]
+		}
+		change := notifyDependency{Name: notifyName(dep, locked), Source: lockSource(locked), Ref: lockSourceReference(locked), To: lockReference(locked), Version: locked.ResolvedVersion}
+		prev := pairs[i]
+		if prev < 0 {
+			change.Change = "added"
+			changes = append(changes, change)
+			continue
+		}
+		old := previous.Resolved[prev]
+		if old.Commit == locked.Commit && old.ContentHash == locked.ContentHash && lockSource(old) == lockSource(locked) {
+			continue
+		}
+		change.Change, change.From = "updated", lockReference(old)
+		if lockSource(old) == lockSource(locked) {
+			before, errBefore := lockedModules(gc, dep, old, opts)
+			after, errAfter := lockedModules(gc, dep, locked, opts)
+			if errBefore == nil && errAfter == nil {
+				change.AddedModules, change.RemovedModules, change.ChangedModules, change.RenamedModules = moduleChanges(before, after)
+			}
+		}
+		changes = append(changes, change)
+	}
+	for _, j := range unpaired {
+		old := previous.Resolved[j]
+		changes = append(changes, notifyDependency{Name: notifyName(config.Dependency{}, old), Source: lockSource(old), Ref: lockSourceReference(old), Change: "removed", From: lockReference(old)})
+	}
+	return changes
+}
+
+// lockedModules expands the content a lock entry pins. Only git commits and
+// profiles keep old content readable; local packs are read as they are now.
+func lockedModules(gc *git.Client, dep config.Dependency, locked config.LockedSource, opts pack.Options) ([]pack.Module, error) {
+	switch lockSource(locked) {
+	case "git":
+		repoDir, err := gc.EnsureRepo(locked.URI)
+		if err != nil {
+			return nil, err
+		}
+		dep.URI = locked.URI
+		return pack.ExpandGitDependency(gc, repoDir, dep, locked, opts)
+	case profilesvc.ProfileSource:
+		loc, err := resolveProfileDependency(gc, locked.URI, locked.Profile, locked.Commit)
+		if err != nil {
+			return nil, err
+		}
+		dep.Profile = loc.ID
+		modules, _, err := profilesvc.Expand(loc.Dir, profileDependencyForRead(dep), opts)
+		return modules, err
+	default:
+		return nil, fmt.Errorf("previous %s content is not kept", lockSource(locked))
+	}
+}
+
+// moduleChanges lists module IDs only in after, only in before, and in both
+// with different content or priority, with probable renames taken out of
+// the first two.
+func moduleChanges(before, after []pack.Module) (added, removed, changed []string, renamed []moduleRename) {
+	old := make(map[string]pack.Module, len(before))
+	for _, m := range before {
+		old[m.ID] = m
+	}
+	for _, m := range after {
+		prev, ok := old[m.ID]
+		switch {
+		case !ok:
+			added = append(added, m.ID)
+		case prev.Content != m.Content || prev.Priority != m.Priority:
+			changed = append(changed, m.ID)
+		}
+		delete(old, m.ID)
+	}
+	for _, m := range before {
+		if _, ok := old[m.ID]; ok {
+			removed = append(removed, m.ID)
+		}
+	}
+	renamed, removed, added = detectRenames(before, after, removed, added)
+	return added, removed, changed, renamed
+}
+
+// notifyName is how a summary refers to a dependency: its name, else the last
+// segment of its URI or path, else its profile.
+func notifyName(dep config.Dependency, locked config.LockedSource) string {
+	if dep.Name != "" {
+		return dep.Name
+	}
+	ref := lockSourceReference(locked)
+	if lockSource(locked) == profilesvc.ProfileSource {
+		return ref
+	}
+	return strings.TrimSuffix(path.Base(strings.TrimRight(strings.ReplaceAll(ref, `\`, "/"), "/")), ".git")
+}
+
+// notifyText summarizes changes in one line, e.g. "python-rules updated to
+// v1.4.0, 3 modules changed".
+func notifyText(project string, changes []notifyDependency) string {
+	parts := make([]string, 0, len(changes))
+	for _, c := range changes {
+		switch c.Change {
+		case "added":
+			parts = append(parts, c.Name+" added at "+notifyVersion(c))
+		case "removed":
+			parts = append(parts, c.Name+" removed")
+		default:
+			part := c.Name + " updated to " + notifyVersion(c)
+			if n := len(c.AddedModules) + len(c.RemovedModules) + len(c.ChangedModules) + len(c.RenamedModules); n == 1 {
+				part += ", 1 module changed"
+			} else if n > 1 {
+				part += fmt.Sprintf(", %d modules changed", n)
+			}
+			parts = append(parts, part)
+		}
+	}
+	text := strings.Join(parts, "; ")
+	if project != "" {
+		text = project + ": " + text
+	}
+	return text
+}
+
+// notifyVersion is the version a summary names: the resolved semver tag,
+// else the short commit or content hash.
+func notifyVersion(c notifyDependency) string {
+	if c.Version != "" {
+		return "v" + strings.TrimPrefix(c.Version, "v")
+	}
+	return c.To
+}
+
+// sendNotify delivers payload to the configured webhook and command. Both are
+// attempted; the errors are returned together.
+func sendNotify(n *config.Notify, payload notifyPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	if n.Webhook != "" {
+		if err := postNotify(n.Webhook, body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(n.Command) > 0 {
+		if err := runNotify(n.Command, n.Env, body); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("notify: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func postNotify(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// runNotify runs argv without a shell, with body on standard input. Like a
+// formatter it comes from a config file that may not be trusted, so it only
+// sees the formatter environment plus the variables named in env.
+func runNotify(argv, env []string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	cmd.Env = build.CommandEnv(env...)
+	cmd.Stdin = bytes.NewReader(body)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s timed out after %s", argv[0], notifyTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", argv[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// notifyDependencyChanges announces the changes event made, from
+// dependencyChanges, if there are any and notify is configured. It returns a
+// warning rather than failing, since the lockfile is already written.
+func notifyDependencyChanges(cfg config.Ruleset, event string, changes []notifyDependency) []string {
+	if cfg.Notify == nil || len(changes) == 0 {
+		return nil
+	}
+	payload := notifyPayload{Event: event, Project: cfg.Name, LockFile: lockFile, Text: notifyText(cfg.Name, changes), Dependencies: changes}
+	if err := sendNotify(cfg.Notify, payload); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
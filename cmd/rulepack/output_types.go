@@ -1,22 +1,41 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
 
+	"rulepack/internal/auth"
+	"rulepack/internal/cliout"
 	"rulepack/internal/config"
+	"rulepack/internal/history"
 	profilesvc "rulepack/internal/profile"
+	"rulepack/internal/render"
 )
 
 type initOutput struct {
-	RulesetFile   string   `json:"rulesetFile"`
-	Name          string   `json:"name"`
-	TemplateFiles []string `json:"templateFiles,omitempty"`
+	RulesetFile string `json:"rulesetFile"`
+	Name        string `json:"name"`
+	Template    string `json:"template,omitempty"`
+	// TemplateCommit is the commit a git: template was read at.
+	TemplateCommit string          `json:"templateCommit,omitempty"`
+	Targets        []string        `json:"targets"`
+	Detected       []initDetection `json:"detected,omitempty"`
+	TemplateFiles  []string        `json:"templateFiles,omitempty"`
+}
+
+// initDetection is a target init --from-existing configured and the files
+// that showed its tool is in use.
+type initDetection struct {
+	Target   string   `json:"target"`
+	Evidence []string `json:"evidence"`
 }
 
 type addOutput struct {
 	RulesetFile string            `json:"rulesetFile"`
 	Action      string            `json:"action"`
 	Dependency  config.Dependency `json:"dependency"`
+	// FromURL is the browser URL the dependency was translated from.
+	FromURL string `json:"fromUrl,omitempty"`
 }
 
 type removedDependencyRow struct {
@@ -35,6 +54,16 @@ type uninstallOutput struct {
 	CleanupPerformed bool                   `json:"cleanupPerformed,omitempty"`
 	CleanupDeleted   []string               `json:"cleanupDeleted,omitempty"`
 	CleanupSkipped   []string               `json:"cleanupSkipped,omitempty"`
+	Sync             *uninstallSyncOutput   `json:"sync,omitempty"`
+}
+
+// uninstallSyncOutput is what deps uninstall --sync did after saving
+// rulepack.json.
+type uninstallSyncOutput struct {
+	LockFile string          `json:"lockFile"`
+	Pruned   []prunedLockRow `json:"pruned"`
+	// Build is the build command's result, as rulepack build --json reports it.
+	Build json.RawMessage `json:"build,omitempty"`
 }
 
 type installResolvedRow struct {
@@ -44,12 +73,66 @@ type installResolvedRow struct {
 	Export   string `json:"export,omitempty"`
 	Resolved string `json:"resolved"`
 	Hash     string `json:"hash"`
+	Ignored  int    `json:"ignored,omitempty"`
 }
 
 type installOutput struct {
 	LockFile string               `json:"lockFile"`
 	Resolved []installResolvedRow `json:"resolved"`
 	Counts   map[string]int       `json:"counts"`
+	Warnings []string             `json:"warnings,omitempty"`
+	// Pruned lists the previous lock entries of dependencies no longer in
+	// rulepack.json, which this install dropped.
+	Pruned []prunedLockRow `json:"pruned,omitempty"`
+	// UpdatedProfiles lists the profiles --update-profiles refreshed.
+	UpdatedProfiles []profileRefreshOutput `json:"updatedProfiles,omitempty"`
+	Timings         *commandTimings        `json:"timings,omitempty"`
+}
+
+// commandTimings breaks a command's wall time down by phase, in
+// milliseconds: fetching git sources, resolving refs, expanding packs, and
+// rendering each target. Phases do not overlap; the total also covers time
+// spent outside them.
+type commandTimings struct {
+	TotalMs   int64            `json:"totalMs"`
+	ResolveMs int64            `json:"resolveMs"`
+	FetchMs   int64            `json:"fetchMs"`
+	ExpandMs  int64            `json:"expandMs"`
+	RenderMs  map[string]int64 `json:"renderMs,omitempty"`
+}
+
+// pinChangeRow is a pinned module whose content differs from the previous
+// lock.
+type pinChangeRow struct {
+	Index  int    `json:"index"`
+	Ref    string `json:"ref"`
+	Module string `json:"module"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// moduleRename is a module whose ID changed while its content did not.
+type moduleRename struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// renameRow is a probable module rename within one updated dependency.
+// CarriedOverride is set when --carry-overrides moved an override from the
+// old ID to the new one.
+type renameRow struct {
+	Dependency      string `json:"dependency"`
+	From            string `json:"from"`
+	To              string `json:"to"`
+	CarriedOverride bool   `json:"carriedOverride,omitempty"`
+}
+
+type depsUpdateOutput struct {
+	LockFile       string         `json:"lockFile"`
+	Updated        []int          `json:"updated"`
+	BumpedPins     []pinChangeRow `json:"bumpedPins"`
+	RenamedModules []renameRow    `json:"renamedModules,omitempty"`
+	Warnings       []string       `json:"warnings,omitempty"`
 }
 
 type buildTargetRow struct {
@@ -59,9 +142,163 @@ type buildTargetRow struct {
 }
 
 type buildOutput struct {
-	ModuleCount int              `json:"moduleCount"`
-	Targets     []buildTargetRow `json:"targets"`
-	Warnings    []string         `json:"warnings,omitempty"`
+	ModuleCount   int              `json:"moduleCount"`
+	RulesetDigest string           `json:"rulesetDigest,omitempty"`
+	Targets       []buildTargetRow `json:"targets"`
+	Recovered     []string         `json:"recovered,omitempty"`
+	Warnings      []string         `json:"warnings,omitempty"`
+	Timings       *commandTimings  `json:"timings,omitempty"`
+}
+
+type effectiveOutput struct {
+	Target  string                   `json:"target"`
+	Path    string                   `json:"path,omitempty"`
+	Modules []render.EffectiveModule `json:"modules"`
+}
+
+type coverageTargetRow struct {
+	Target        string                 `json:"target"`
+	Groups        []render.CoverageGroup `json:"groups"`
+	UncoveredDirs []string               `json:"uncoveredDirs"`
+	UncoveredExts []string               `json:"uncoveredExts"`
+}
+
+type coverageOutput struct {
+	Files   int                 `json:"files"`
+	Targets []coverageTargetRow `json:"targets"`
+}
+
+type codeownersFile struct {
+	Path    string   `json:"path"`
+	Targets []string `json:"targets"`
+	Owners  []string `json:"owners"`
+	Modules []string `json:"modules"`
+}
+
+// prunedLockRow is a lock entry dropped because no dependency claims it.
+type prunedLockRow struct {
+	Key      string `json:"key"`
+	Source   string `json:"source"`
+	Ref      string `json:"ref"`
+	Resolved string `json:"resolved"`
+}
+
+type lockPruneOutput struct {
+	LockFile string          `json:"lockFile"`
+	Pruned   []prunedLockRow `json:"pruned"`
+}
+
+type overridePruneRow struct {
+	ID   string `json:"id"`
+	File string `json:"file"`
+}
+
+type overridesPruneOutput struct {
+	Removed []overridePruneRow `json:"removed"`
+	// Updated lists the files rewritten without the removed overrides.
+	Updated []string `json:"updated"`
+}
+
+type codeownersOutput struct {
+	Files []codeownersFile `json:"files"`
+	// Written is the CODEOWNERS file updated with --write.
+	Written string `json:"written,omitempty"`
+}
+
+type globsTestOutput struct {
+	Module  string              `json:"module"`
+	Results []render.GlobResult `json:"results"`
+}
+
+type lintOutput struct {
+	Issues   []render.LintIssue `json:"issues"`
+	Errors   int                `json:"errors"`
+	Warnings int                `json:"warnings"`
+}
+
+type outputFileRow struct {
+	Target string `json:"target"`
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+type verifyOutputsOutput struct {
+	Files    []outputFileRow `json:"files"`
+	Problems int             `json:"problems"`
+}
+
+type smokeFileRow struct {
+	Target   string   `json:"target"`
+	Path     string   `json:"path"`
+	Status   string   `json:"status"`
+	Problems []string `json:"problems,omitempty"`
+}
+
+type smokeOutput struct {
+	Files    []smokeFileRow `json:"files"`
+	Failures int            `json:"failures"`
+}
+
+type fmtFileRow struct {
+	Path   string `json:"path"`
+	Status string `json:"status"`
+}
+
+type fmtOutput struct {
+	Files   []fmtFileRow `json:"files"`
+	Changed int          `json:"changed"`
+}
+
+type cleanOutput struct {
+	Deleted []string `json:"deleted"`
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// planAction is one change a mutating command would make. Action is one of
+// create, update, delete, or add/replace/remove for dependency entries.
+type planAction struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Target string `json:"target"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type planOutput struct {
+	Command              string       `json:"command"`
+	Actions              []planAction `json:"actions"`
+	Risks                []planRisk   `json:"risks,omitempty"`
+	RequiresConfirmation bool         `json:"requiresConfirmation"`
+	// Diffs holds each changed file's content before and after, for
+	// build --diff.
+	Diffs []cliout.Diff `json:"diffs,omitempty"`
+}
+
+type undoOutput struct {
+	Command   string   `json:"command"`
+	CreatedAt string   `json:"createdAt"`
+	Restored  []string `json:"restored"`
+	Removed   []string `json:"removed"`
+}
+
+type historyOutput struct {
+	Entries []history.AuditEntry `json:"entries"`
+}
+
+// forEachProjectRow is one project's outcome; Result is the command's own JSON
+// result, unchanged.
+type forEachProjectRow struct {
+	Project string          `json:"project"`
+	Status  string          `json:"status"`
+	Command string          `json:"command,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+type forEachOutput struct {
+	Root     string              `json:"root"`
+	Command  []string            `json:"command"`
+	Projects []forEachProjectRow `json:"projects"`
+	Failed   int                 `json:"failed"`
 }
 
 type profileSaveOutput struct {
@@ -82,12 +319,23 @@ type sourceSkip struct {
 	Reason string `json:"reason"`
 }
 
+// profileListOutput echoes the list options. Total counts every saved
+// profile, Matched those passing the filters before --limit.
 type profileListOutput struct {
 	Profiles []profilesvc.Metadata `json:"profiles"`
+	Total    int                   `json:"total"`
+	Matched  int                   `json:"matched"`
+	Filters  []string              `json:"filters,omitempty"`
+	Source   string                `json:"source,omitempty"`
+	Sort     string                `json:"sort"`
+	Limit    int                   `json:"limit,omitempty"`
+	// Due lists the IDs of shown profiles whose refreshEvery has passed.
+	Due []string `json:"due,omitempty"`
 }
 
 type profileUseOutput struct {
 	ProfileID   string `json:"profileId"`
+	Export      string `json:"export"`
 	Action      string `json:"action"`
 	RulesetFile string `json:"rulesetFile"`
 }
@@ -108,10 +356,12 @@ type profileRemoveOutput struct {
 }
 
 type profileRefreshOutput struct {
-	OldProfileID     string         `json:"oldProfileId"`
-	NewProfileID     string         `json:"newProfileId"`
-	RefreshedRule    []string       `json:"refreshedRules,omitempty"`
-	Source           string         `json:"source"`
+	OldProfileID  string   `json:"oldProfileId"`
+	NewProfileID  string   `json:"newProfileId"`
+	RefreshedRule []string `json:"refreshedRules,omitempty"`
+	Source        string   `json:"source"`
+	// SelectedSources lists the sources picked with --source; empty means all.
+	SelectedSources  []string       `json:"selectedSources,omitempty"`
 	InPlace          bool           `json:"inPlace"`
 	DryRun           bool           `json:"dryRun,omitempty"`
 	RefreshedSources []sourceStatus `json:"refreshedSources,omitempty"`
@@ -119,6 +369,18 @@ type profileRefreshOutput struct {
 	ChangedModules   []string       `json:"changedModules,omitempty"`
 	AddedModules     []string       `json:"addedModules,omitempty"`
 	RemovedModules   []string       `json:"removedModules,omitempty"`
+	// MergedModules are locally edited modules whose source changes merged
+	// cleanly; ConflictedModules could not be merged and hold conflict
+	// markers.
+	MergedModules     []string `json:"mergedModules,omitempty"`
+	ConflictedModules []string `json:"conflictedModules,omitempty"`
+}
+
+// profileRefreshDueOutput is profile refresh --due's result, one entry per
+// profile that was due.
+type profileRefreshDueOutput struct {
+	DryRun   bool                   `json:"dryRun,omitempty"`
+	Profiles []profileRefreshOutput `json:"profiles"`
 }
 
 type depsListRow struct {
@@ -127,17 +389,65 @@ type depsListRow struct {
 	Ref    string `json:"ref"`
 	Export string `json:"export,omitempty"`
 	Locked string `json:"locked,omitempty"`
+	// Health columns; empty or absent when not checked.
+	AgeDays      *int   `json:"ageDays,omitempty"`
+	Resolves     string `json:"resolves,omitempty"`
+	ExportExists string `json:"exportExists,omitempty"`
+	ModuleDelta  *int   `json:"moduleDelta,omitempty"`
+	Health       string `json:"health,omitempty"`
 }
 
 type depsListOutput struct {
 	Dependencies []depsListRow `json:"dependencies"`
 }
 
+type licenseRow struct {
+	Index     int    `json:"index"`
+	Source    string `json:"source"`
+	Reference string `json:"reference"`
+	License   string `json:"license,omitempty"`
+	Policy    string `json:"policy"`
+}
+
+type licensesOutput struct {
+	Dependencies []licenseRow `json:"dependencies"`
+	Violations   int          `json:"violations"`
+}
+
+type fetchedDependency struct {
+	Index     int    `json:"index"`
+	Source    string `json:"source"`
+	Reference string `json:"reference"`
+	Resolved  string `json:"resolved"`
+	// Dir is the dependency's directory relative to the output directory.
+	Dir   string   `json:"dir"`
+	Files []string `json:"files"`
+}
+
+type fetchOutput struct {
+	Lockfile     string              `json:"lockfile"`
+	Out          string              `json:"out"`
+	Dependencies []fetchedDependency `json:"dependencies"`
+}
+
 type profileShowOutput struct {
 	Profile profilesvc.Metadata `json:"profile"`
 	Path    string              `json:"path"`
 }
 
+type renderedFile struct {
+	Path    string `json:"path"`
+	Content string `json:"content"`
+}
+
+// profileRenderOutput is profile show --render's result; paths are relative
+// to a project root.
+type profileRenderOutput struct {
+	ProfileID string         `json:"profileId"`
+	Target    string         `json:"target"`
+	Files     []renderedFile `json:"files"`
+}
+
 type doctorCheck struct {
 	Name    string `json:"name"`
 	Status  string `json:"status"`
@@ -152,6 +462,28 @@ type versionOutput struct {
 	Version string `json:"version"`
 }
 
+type authLoginOutput struct {
+	Host auth.HostStatus `json:"host"`
+}
+
+type authLogoutOutput struct {
+	Host auth.HostStatus `json:"host"`
+}
+
+type authStatusOutput struct {
+	Hosts []auth.HostStatus `json:"hosts"`
+}
+
+type authTestOutput struct {
+	Host        string `json:"host"`
+	Kind        string `json:"kind"`
+	Credentials bool   `json:"credentials"`
+	Probe       string `json:"probe"`
+	HTTPStatus  int    `json:"httpStatus,omitempty"`
+	Status      string `json:"status"`
+	Details     string `json:"details,omitempty"`
+}
+
 type outdatedEntry struct {
 	Index        int    `json:"index"`
 	Source       string `json:"source"`
@@ -159,35 +491,90 @@ type outdatedEntry struct {
 	Locked       string `json:"locked,omitempty"`
 	Latest       string `json:"latest,omitempty"`
 	UpdateStatus string `json:"updateStatus"`
+	// Newest is the highest version tag when it is newer than the locked
+	// version, whether or not the dependency's constraint allows it.
+	Newest      string `json:"newest,omitempty"`
+	MajorUpdate bool   `json:"majorUpdate,omitempty"`
+	// Freshness checks the lock age against the dependency's maxAgeDays; the
+	// fields are absent when no limit is set.
+	MaxAgeDays  int    `json:"maxAgeDays,omitempty"`
+	LockAgeDays *int   `json:"lockAgeDays,omitempty"`
+	Freshness   string `json:"freshness,omitempty"`
+	// Cached is set when the resolution was reused from a recent check
+	// instead of fetched.
+	Cached bool `json:"cached,omitempty"`
+	// AvailableExports lists the pack's exports at the latest revision when
+	// the dependency's export is no longer one of them.
+	AvailableExports []string `json:"availableExports,omitempty"`
 }
 
 type outdatedOutput struct {
 	CheckedAt     string          `json:"checkedAt"`
 	Dependencies  []outdatedEntry `json:"dependencies"`
 	OutdatedCount int             `json:"outdatedCount"`
+	MajorCount    int             `json:"majorCount"`
+	StaleCount    int             `json:"staleCount"`
+	// CancelledCount is non-zero when the check was interrupted and the
+	// report is partial.
+	CancelledCount int `json:"cancelledCount,omitempty"`
 }
 
 type profileDiffOutput struct {
-	ProfileID        string         `json:"profileId"`
-	SourceType       string         `json:"sourceType"`
-	SourceRef        string         `json:"sourceRef"`
-	CurrentHash      string         `json:"currentHash"`
-	FreshHash        string         `json:"freshHash"`
-	ChangedModules   []string       `json:"changedModules,omitempty"`
-	AddedModules     []string       `json:"addedModules,omitempty"`
-	RemovedModules   []string       `json:"removedModules,omitempty"`
+	ProfileID      string         `json:"profileId"`
+	SourceType     string         `json:"sourceType"`
+	SourceRef      string         `json:"sourceRef"`
+	CurrentHash    string         `json:"currentHash"`
+	FreshHash      string         `json:"freshHash"`
+	ChangedModules []string       `json:"changedModules,omitempty"`
+	AddedModules   []string       `json:"addedModules,omitempty"`
+	RemovedModules []string       `json:"removedModules,omitempty"`
+	RenamedModules []moduleRename `json:"renamedModules,omitempty"`
+	// EditedModules are snapshot modules that no longer match the digests
+	// recorded when the profile was saved.
+	EditedModules    []string       `json:"editedModules,omitempty"`
 	RefreshedSources []sourceStatus `json:"refreshedSources,omitempty"`
 	SkippedSources   []sourceSkip   `json:"skippedSources,omitempty"`
 	RuleSelectors    []string       `json:"ruleSelectors,omitempty"`
 	UpdatedAt        string         `json:"updatedAt"`
+	// ContentDiffs holds each differing module's content in the snapshot and
+	// at its source, for profile diff --content.
+	ContentDiffs []cliout.Diff `json:"contentDiffs,omitempty"`
 }
 
-func newOutdatedOutput(entries []outdatedEntry, outdatedCount int) outdatedOutput {
-	return outdatedOutput{
-		CheckedAt:     time.Now().UTC().Format(time.RFC3339),
-		Dependencies:  entries,
-		OutdatedCount: outdatedCount,
+type profileDoctorOutput struct {
+	ProfileCount int                     `json:"profileCount"`
+	Unreadable   []profilesvc.Unreadable `json:"unreadable"`
+}
+
+type profileVerifyOutput struct {
+	ProfileID      string   `json:"profileId"`
+	Verified       bool     `json:"verified"`
+	ModuleCount    int      `json:"moduleCount"`
+	ChangedModules []string `json:"changedModules,omitempty"`
+	AddedModules   []string `json:"addedModules,omitempty"`
+	RemovedModules []string `json:"removedModules,omitempty"`
+}
+
+func newOutdatedOutput(entries []outdatedEntry) outdatedOutput {
+	out := outdatedOutput{
+		CheckedAt:    time.Now().UTC().Format(time.RFC3339),
+		Dependencies: entries,
+	}
+	for _, entry := range entries {
+		if entry.UpdateStatus == "outdated" || entry.UpdateStatus == "export-removed" {
+			out.OutdatedCount++
+		}
+		if entry.MajorUpdate {
+			out.MajorCount++
+		}
+		if entry.Freshness == "stale" {
+			out.StaleCount++
+		}
+		if entry.UpdateStatus == "cancelled" {
+			out.CancelledCount++
+		}
 	}
+	return out
 }
 
 func newProfileDiffOutput(profileID, sourceType, sourceRef, currentHash, freshHash string, changed, added, removed []string, refreshed []sourceStatus, skipped []sourceSkip, selectors []string) profileDiffOutput {
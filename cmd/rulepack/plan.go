@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strconv"
+
+	"rulepack/internal/cliout"
+)
+
+// planRisk is a confirmation the command would ask for, with the same preview
+// lines the prompt shows.
+type planRisk struct {
+	Message string   `json:"message"`
+	Preview []string `json:"preview,omitempty"`
+}
+
+// newPlanRisk returns the risk for a confirmRiskAction call, or nil when the
+// action would not prompt.
+func newPlanRisk(risk bool, message string, preview []string) []planRisk {
+	if !risk {
+		return nil
+	}
+	return []planRisk{{Message: message, Preview: preview}}
+}
+
+// renderPlan reports what a mutating command would do under --plan. Nothing
+// has been written when it is called.
+func (a *app) renderPlan(out planOutput) error {
+	if out.Actions == nil {
+		out.Actions = []planAction{}
+	}
+	out.RequiresConfirmation = len(out.Risks) > 0
+	if a.jsonMode {
+		return a.renderer.RenderJSON("plan", out)
+	}
+	rows := make([][]string, 0, len(out.Actions))
+	for _, act := range out.Actions {
+		rows = append(rows, []string{act.Action, act.Kind, act.Target, act.Detail})
+	}
+	events := make([]cliout.Event, 0)
+	if len(out.Actions) == 0 {
+		events = append(events, cliout.Event{Level: "info", Message: "No changes"})
+	}
+	for _, risk := range out.Risks {
+		events = append(events, cliout.Event{Level: "warn", Message: risk.Message + " (needs confirmation or --yes)"})
+		for _, line := range risk.Preview {
+			events = append(events, cliout.Event{Level: "warn", Message: "  " + line})
+		}
+	}
+	a.renderer.RenderHuman(cliout.HumanPayload{
+		Command: "plan",
+		Title:   "Plan: " + out.Command,
+		Events:  events,
+		Tables:  []cliout.Table{{Title: "Actions", Columns: []string{"Action", "Kind", "Target", "Detail"}, Rows: rows}},
+		Diffs:   out.Diffs,
+		Summary: map[string]string{"actions": strconv.Itoa(len(out.Actions))},
+		Done:    "Plan complete; nothing was changed",
+	})
+	return nil
+}
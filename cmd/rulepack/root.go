@@ -2,20 +2,77 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 
 	"github.com/spf13/cobra"
 	"rulepack/internal/cliout"
+	"rulepack/internal/config"
 )
 
+// The ruleset commands operate on and the files named after it. -f sets
+// them before each command runs; see useRuleset.
+var (
+	rulesetFile = config.RulesetFileName
+	lockFile    = config.LockFileName
+	outputsFile = config.OutputsFileName
+)
+
+// useRuleset points commands at the ruleset at path. A named ruleset such
+// as rulepack.frontend.json gets its own lockfile beside it and build
+// manifest, rulepack.frontend.lock.json and .rulepack/outputs.frontend.json.
+func useRuleset(path string) {
+	name := config.RulesetName(path)
+	rulesetFile = path
+	lockFile = filepath.Join(filepath.Dir(path), config.NamedFile(name, config.LockFileName))
+	outputsFile = config.NamedFile(name, config.OutputsFileName)
+}
+
 type app struct {
 	renderer cliout.Renderer
 	jsonMode bool
 	noColor  bool
+	noPager  bool
+	// problems prints warnings and errors as file:line: message lines.
+	problems bool
+	// schemaVersion selects the JSON output shape; see cliout.SchemaVersion.
+	schemaVersion int
+	// rulesetPath is the ruleset given with -f.
+	rulesetPath string
+	// args is the command line as invoked, recorded in the audit log.
+	args []string
+	// mutation names the mutating command that changed project files during
+	// this run, if any; see snapshotProject.
+	mutation string
+	// out, when set, receives JSON output instead of stdout; serve uses it to
+	// run commands in process.
+	out io.Writer
+	// inAlias marks a command run as one step of an alias, which may not
+	// itself use aliases.
+	inAlias bool
 }
 
 func main() {
 	a := &app{}
+	root := a.newRootCmd(os.Args[1:])
+	if err := root.Execute(); err != nil {
+		_ = a.recordAudit(err)
+		if a.renderer == nil {
+			if a.jsonMode {
+				_ = cliout.NewJSONRenderer().RenderJSON("error", map[string]any{"error": map[string]string{"message": err.Error()}})
+			} else {
+				fmt.Fprintln(os.Stderr, err)
+			}
+			os.Exit(1)
+		}
+		a.renderer.RenderError("error", err)
+		os.Exit(1)
+	}
+}
+
+func (a *app) newRootCmd(args []string) *cobra.Command {
+	a.args = args
 	root := &cobra.Command{
 		Use:           "rulepack",
 		Short:         "Import rule packs and compile target-native rule outputs",
@@ -23,35 +80,72 @@ func main() {
 		SilenceUsage:  true,
 		SilenceErrors: true,
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
-			if a.jsonMode {
-				a.renderer = cliout.NewJSONRenderer()
+			useRuleset(a.rulesetPath)
+			if cmd.Flags().Changed("schema-version") && !a.jsonMode {
+				return fmt.Errorf("--schema-version requires --json")
+			}
+			if a.problems && a.jsonMode {
+				return fmt.Errorf("use only one of --json or --problems")
+			}
+			if a.problems {
+				a.renderer = cliout.NewProblemsRenderer(rulesetFile)
+			} else if a.jsonMode {
+				renderer, err := cliout.NewJSONRendererVersion(a.schemaVersion)
+				if err != nil {
+					return err
+				}
+				if a.out != nil {
+					renderer.SetOutput(a.out)
+				}
+				a.renderer = renderer
 			} else {
-				a.renderer = cliout.NewHumanRenderer(a.noColor)
+				renderer := cliout.NewHumanRenderer(a.noColor)
+				if !a.noPager {
+					renderer.SetPager(cliout.PagerFromEnv())
+				}
+				a.renderer = renderer
 			}
 			return nil
 		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			return a.recordAudit(nil)
+		},
 	}
 
 	root.PersistentFlags().BoolVar(&a.jsonMode, "json", false, "emit JSON output")
 	root.PersistentFlags().BoolVar(&a.noColor, "no-color", false, "disable color in human output")
+	root.PersistentFlags().BoolVar(&a.noPager, "no-pager", false, "do not page long human output through $PAGER")
+	root.PersistentFlags().BoolVar(&a.problems, "problems", false, "print only warnings and errors, as file:line: level: message lines for IDE problem matchers")
+	root.PersistentFlags().StringVarP(&a.rulesetPath, "file", "f", config.RulesetFileName, "ruleset to use; rulepack.<name>.json gets its own lockfile, rulepack.<name>.lock.json")
+	root.PersistentFlags().IntVar(&a.schemaVersion, "schema-version", cliout.SchemaVersion, "JSON output schema version to emit, for scripts pinned to an older shape")
 
 	root.AddCommand(a.newInitCmd())
 	root.AddCommand(a.newDepsCmd())
+	root.AddCommand(a.newFetchCmd())
+	root.AddCommand(a.newLockCmd())
 	root.AddCommand(a.newBuildCmd())
+	root.AddCommand(a.newEffectiveCmd())
+	root.AddCommand(a.newGlobsCmd())
+	root.AddCommand(a.newCoverageCmd())
+	root.AddCommand(a.newCodeownersCmd())
+	root.AddCommand(a.newLintCmd())
+	root.AddCommand(a.newFmtCmd())
+	root.AddCommand(a.newOverridesCmd())
+	root.AddCommand(a.newVerifyOutputsCmd())
+	root.AddCommand(a.newSmokeCmd())
+	root.AddCommand(a.newCleanCmd())
+	root.AddCommand(a.newUndoCmd())
+	root.AddCommand(a.newHistoryCmd())
+	root.AddCommand(a.newForEachCmd())
+	root.AddCommand(a.newServeCmd())
 	root.AddCommand(a.newDoctorCmd())
 	root.AddCommand(a.newVersionCmd())
 	root.AddCommand(a.newProfileCmd())
-
-	if err := root.Execute(); err != nil {
-		if a.renderer == nil {
-			if a.jsonMode {
-				_ = cliout.NewJSONRenderer().RenderJSON("error", map[string]any{"error": map[string]string{"message": err.Error()}})
-			} else {
-				fmt.Fprintln(os.Stderr, err)
-			}
-			os.Exit(1)
-		}
-		a.renderer.RenderError("error", err)
-		os.Exit(1)
+	root.AddCommand(a.newAuthCmd())
+	if !a.inAlias {
+		a.addAliasCmds(root)
 	}
+
+	root.SetArgs(args)
+	return root
 }
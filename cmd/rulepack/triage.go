@@ -0,0 +1,99 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"rulepack/internal/config"
+)
+
+// triageDuplicate asks how to resolve dup, a module ID more than one
+// dependency supplies, and writes the answer into rulepack.json as
+// disableModules or renameModules on those dependencies. It returns the
+// updated dependencies and a line describing the change, or dup itself when
+// the user leaves the conflict alone.
+func (a *app) triageDuplicate(cmd *cobra.Command, dup *duplicateModuleError) ([]config.Dependency, string, error) {
+	cfg, err := config.LoadRuleset(rulesetFile)
+	if err != nil {
+		return nil, "", err
+	}
+	w := cmd.ErrOrStderr()
+	_, _ = fmt.Fprintf(w, "Module id %q is provided by %d dependencies:\n", dup.ID, len(dup.Dependencies))
+	for n, i := range dup.Dependencies {
+		_, _ = fmt.Fprintf(w, "  %d) %s\n", n+1, dependencyLabel(i, cfg.Dependencies[i]))
+	}
+	answer, err := readPromptAnswer(cmd, "Resolve by [k]eeping one, [r]enaming one, [d]isabling all, or [q]uit")
+	if err != nil {
+		return nil, "", err
+	}
+	var change string
+	switch strings.ToLower(answer) {
+	case "k", "keep":
+		keep, err := pickDuplicateSupplier(cmd, dup, "Keep which dependency's module")
+		if err != nil {
+			return nil, "", err
+		}
+		for _, i := range dup.Dependencies {
+			if i != keep {
+				disableModule(&cfg.Dependencies[i], dup.ID)
+			}
+		}
+		change = fmt.Sprintf("kept %s from %s and disabled it in the others", dup.ID, dependencyLabel(keep, cfg.Dependencies[keep]))
+	case "r", "rename":
+		i, err := pickDuplicateSupplier(cmd, dup, "Rename the module of which dependency")
+		if err != nil {
+			return nil, "", err
+		}
+		to, err := readPromptAnswer(cmd, fmt.Sprintf("New module id for %s", dup.ID))
+		if err != nil {
+			return nil, "", err
+		}
+		if to == "" || to == dup.ID {
+			return nil, "", fmt.Errorf("rename of %s cancelled: a new module id is required", dup.ID)
+		}
+		dep := &cfg.Dependencies[i]
+		if dep.RenameModules == nil {
+			dep.RenameModules = map[string]string{}
+		}
+		dep.RenameModules[dup.ID] = to
+		change = fmt.Sprintf("renamed %s to %s in %s", dup.ID, to, dependencyLabel(i, *dep))
+	case "d", "disable":
+		for _, i := range dup.Dependencies {
+			disableModule(&cfg.Dependencies[i], dup.ID)
+		}
+		change = fmt.Sprintf("disabled %s in every dependency", dup.ID)
+	default:
+		return nil, "", dup
+	}
+	if err := a.snapshotProject("build"); err != nil {
+		return nil, "", err
+	}
+	if err := config.SaveRuleset(rulesetFile, cfg); err != nil {
+		return nil, "", err
+	}
+	return cfg.Dependencies, change, nil
+}
+
+// pickDuplicateSupplier asks for one of dup's dependencies by its number in
+// the list triageDuplicate printed.
+func pickDuplicateSupplier(cmd *cobra.Command, dup *duplicateModuleError, prompt string) (int, error) {
+	answer, err := readPromptAnswer(cmd, fmt.Sprintf("%s? [1-%d]", prompt, len(dup.Dependencies)))
+	if err != nil {
+		return -1, err
+	}
+	n, err := strconv.Atoi(answer)
+	if err != nil || n < 1 || n > len(dup.Dependencies) {
+		return -1, errors.New("duplicate resolution cancelled: expected a number from the list")
+	}
+	return dup.Dependencies[n-1], nil
+}
+
+func disableModule(dep *config.Dependency, id string) {
+	if !slices.Contains(dep.DisableModules, id) {
+		dep.DisableModules = append(dep.DisableModules, id)
+	}
+}
@@ -7,6 +7,7 @@ require (
 	github.com/charmbracelet/lipgloss v1.0.0
 	github.com/spf13/cobra v1.8.1
 	golang.org/x/term v0.30.0
+	golang.org/x/text v0.23.0
 )
 
 require (
@@ -0,0 +1,455 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"rulepack/internal/config"
+)
+
+const (
+	StorageKeyring    = "keyring"
+	StoragePassphrase = "passphrase"
+
+	KindGit      = "git"
+	KindOCI      = "oci"
+	KindRegistry = "registry"
+	KindArchive  = "archive"
+
+	PassphraseEnv = "RULEPACK_AUTH_PASSPHRASE"
+
+	keyringService   = "rulepack"
+	pbkdf2Iterations = 210000
+	probeTimeout     = 10 * time.Second
+)
+
+var ErrPassphraseRequired = errors.New("auth passphrase required; set " + PassphraseEnv)
+
+type Store struct {
+	Keyring    Keyring
+	Passphrase func() (string, error)
+}
+
+type HostStatus struct {
+	Host      string `json:"host"`
+	Kind      string `json:"kind,omitempty"`
+	Username  string `json:"username,omitempty"`
+	Storage   string `json:"storage"`
+	Status    string `json:"status"`
+	Details   string `json:"details,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+func NewStore() *Store {
+	return &Store{Keyring: defaultKeyring(), Passphrase: envPassphrase}
+}
+
+func NormalizeHost(host string) string {
+	host = strings.TrimSpace(strings.ToLower(host))
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	return strings.TrimRight(host, "/")
+}
+
+func (s *Store) Login(cfg *config.UserConfig, host string, kind string, username string, secret string, storage string) (HostStatus, error) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return HostStatus{}, errors.New("auth login requires a host")
+	}
+	kind, err := normalizeKind(kind)
+	if err != nil {
+		return HostStatus{}, err
+	}
+	if secret == "" {
+		return HostStatus{}, errors.New("auth login requires a non-empty token")
+	}
+	if storage == "" {
+		storage = StorageKeyring
+		if s.Keyring == nil || !s.Keyring.Available() {
+			storage = StoragePassphrase
+		}
+	}
+	entry := config.HostCredential{Kind: kind, Username: username, Storage: storage, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	switch storage {
+	case StorageKeyring:
+		if s.Keyring == nil || !s.Keyring.Available() {
+			return HostStatus{}, errors.New("os keychain is not available; use --storage passphrase")
+		}
+		if err := s.Keyring.Set(keyringService, host, secret); err != nil {
+			return HostStatus{}, fmt.Errorf("store secret in os keychain: %w", err)
+		}
+	case StoragePassphrase:
+		passphrase, err := s.passphrase()
+		if err != nil {
+			return HostStatus{}, err
+		}
+		salt, nonce, ciphertext, err := encrypt(passphrase, []byte(secret))
+		if err != nil {
+			return HostStatus{}, err
+		}
+		entry.Salt = salt
+		entry.Nonce = nonce
+		entry.Ciphertext = ciphertext
+	default:
+		return HostStatus{}, fmt.Errorf("unsupported auth storage %q (supported: keyring, passphrase)", storage)
+	}
+	if storage == StorageKeyring {
+		if cfg.Auth.Hosts == nil {
+			cfg.Auth.Hosts = map[string]config.HostCredential{}
+		}
+		cfg.Auth.Hosts[host] = entry
+		return HostStatus{Host: host, Kind: kind, Username: username, Storage: storage, Status: "ok", UpdatedAt: entry.UpdatedAt}, nil
+	}
+	return s.replaceEntry(cfg, host, entry), nil
+}
+
+func (s *Store) LoginGitHubApp(cfg *config.UserConfig, host string, app config.GitHubAppCredential) (HostStatus, error) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return HostStatus{}, errors.New("auth login requires a host")
+	}
+	if app.AppID == "" || app.InstallationID == "" {
+		return HostStatus{}, errors.New("github app login requires --github-app-id and --installation-id")
+	}
+	if app.PrivateKeyPath == "" && app.PrivateKeyEnv == "" {
+		return HostStatus{}, errors.New("github app login requires --private-key or --private-key-env")
+	}
+	entry := config.HostCredential{
+		Kind:      KindGit,
+		Username:  "x-access-token",
+		Storage:   StorageGitHubApp,
+		GitHubApp: &app,
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	return s.replaceEntry(cfg, host, entry), nil
+}
+
+func (s *Store) LoginTokenEnv(cfg *config.UserConfig, host string, kind string, username string, envName string) (HostStatus, error) {
+	host = NormalizeHost(host)
+	if host == "" {
+		return HostStatus{}, errors.New("auth login requires a host")
+	}
+	kind, err := normalizeKind(kind)
+	if err != nil {
+		return HostStatus{}, err
+	}
+	if strings.TrimSpace(envName) == "" {
+		return HostStatus{}, errors.New("token env login requires an environment variable name")
+	}
+	entry := config.HostCredential{
+		Kind:      kind,
+		Username:  username,
+		Storage:   StorageEnv,
+		TokenEnv:  strings.TrimSpace(envName),
+		UpdatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	return s.replaceEntry(cfg, host, entry), nil
+}
+
+func (s *Store) replaceEntry(cfg *config.UserConfig, host string, entry config.HostCredential) HostStatus {
+	if cfg.Auth.Hosts == nil {
+		cfg.Auth.Hosts = map[string]config.HostCredential{}
+	}
+	if prev, ok := cfg.Auth.Hosts[host]; ok && prev.Storage == StorageKeyring && s.Keyring != nil && s.Keyring.Available() {
+		_ = s.Keyring.Delete(keyringService, host)
+	}
+	cfg.Auth.Hosts[host] = entry
+	return HostStatus{Host: host, Kind: entry.Kind, Username: entry.Username, Storage: entry.Storage, Status: "ok", UpdatedAt: entry.UpdatedAt}
+}
+
+func (s *Store) Logout(cfg *config.UserConfig, host string) (HostStatus, error) {
+	host = NormalizeHost(host)
+	entry, ok := cfg.Auth.Hosts[host]
+	if !ok {
+		return HostStatus{}, fmt.Errorf("no credentials stored for %s", host)
+	}
+	if entry.Storage == StorageKeyring && s.Keyring != nil && s.Keyring.Available() {
+		if err := s.Keyring.Delete(keyringService, host); err != nil {
+			return HostStatus{}, fmt.Errorf("remove secret from os keychain: %w", err)
+		}
+	}
+	delete(cfg.Auth.Hosts, host)
+	return HostStatus{Host: host, Kind: entry.Kind, Username: entry.Username, Storage: entry.Storage, Status: "removed"}, nil
+}
+
+func (s *Store) Secret(cfg config.UserConfig, host string) (string, error) {
+	host = NormalizeHost(host)
+	entry, ok := cfg.Auth.Hosts[host]
+	if !ok {
+		return "", fmt.Errorf("no credentials stored for %s", host)
+	}
+	switch entry.Storage {
+	case StorageKeyring:
+		if s.Keyring == nil || !s.Keyring.Available() {
+			return "", errors.New("os keychain is not available")
+		}
+		return s.Keyring.Get(keyringService, host)
+	case StoragePassphrase:
+		passphrase, err := s.passphrase()
+		if err != nil {
+			return "", err
+		}
+		plain, err := decrypt(passphrase, entry.Salt, entry.Nonce, entry.Ciphertext)
+		if err != nil {
+			return "", err
+		}
+		return string(plain), nil
+	case StorageGitHubApp:
+		if entry.GitHubApp == nil {
+			return "", fmt.Errorf("github app credentials for %s are incomplete", host)
+		}
+		return mintGitHubAppToken(host, *entry.GitHubApp, time.Now())
+	case StorageEnv:
+		secret := os.Getenv(entry.TokenEnv)
+		if secret == "" {
+			return "", fmt.Errorf("token env %s is empty", entry.TokenEnv)
+		}
+		return secret, nil
+	default:
+		return "", fmt.Errorf("unsupported auth storage %q for %s", entry.Storage, host)
+	}
+}
+
+func (s *Store) Status(cfg config.UserConfig) []HostStatus {
+	hosts := make([]string, 0, len(cfg.Auth.Hosts))
+	for host := range cfg.Auth.Hosts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	out := make([]HostStatus, 0, len(hosts))
+	for _, host := range hosts {
+		entry := cfg.Auth.Hosts[host]
+		row := HostStatus{Host: host, Kind: entry.Kind, Username: entry.Username, Storage: entry.Storage, UpdatedAt: entry.UpdatedAt, Status: "ok"}
+		if err := s.checkSecret(cfg, host); err != nil {
+			row.Status = "error"
+			if errors.Is(err, ErrPassphraseRequired) {
+				row.Status = "locked"
+			}
+			row.Details = err.Error()
+		}
+		out = append(out, row)
+	}
+	return out
+}
+
+// checkSecret reports whether host's secret can be read. GitHub App
+// credentials are checked locally instead of minting a token.
+func (s *Store) checkSecret(cfg config.UserConfig, host string) error {
+	if entry := cfg.Auth.Hosts[host]; entry.Storage == StorageGitHubApp && entry.GitHubApp != nil {
+		_, err := checkGitHubApp(host, *entry.GitHubApp)
+		return err
+	}
+	_, err := s.Secret(cfg, host)
+	return err
+}
+
+// GitCredentials adapts stored host credentials to the git client. Hosts
+// registered for a non-git kind are ignored.
+func (s *Store) GitCredentials(cfg config.UserConfig) func(uri string) (string, string, bool, error) {
+	return func(uri string) (string, string, bool, error) {
+		host := HostFromURI(uri)
+		entry, ok := cfg.Auth.Hosts[host]
+		if !ok || (entry.Kind != "" && entry.Kind != KindGit) {
+			return "", "", false, nil
+		}
+		secret, err := s.Secret(cfg, host)
+		if err != nil {
+			return "", "", false, fmt.Errorf("credentials for %s: %w", host, err)
+		}
+		return entry.Username, secret, true, nil
+	}
+}
+
+func (s *Store) AuthorizationHeader(cfg config.UserConfig, host string) (string, bool, error) {
+	host = NormalizeHost(host)
+	entry, ok := cfg.Auth.Hosts[host]
+	if !ok {
+		return "", false, nil
+	}
+	secret, err := s.Secret(cfg, host)
+	if err != nil {
+		return "", false, err
+	}
+	switch entry.Kind {
+	case KindOCI, KindRegistry:
+		return "Bearer " + secret, true, nil
+	default:
+		username := entry.Username
+		if username == "" {
+			username = "x-access-token"
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+secret)), true, nil
+	}
+}
+
+func (s *Store) ProbeHTTP(cfg config.UserConfig, host string, url string) (int, error) {
+	if url == "" {
+		url = "https://" + NormalizeHost(host) + "/"
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	header, ok, err := s.AuthorizationHeader(cfg, host)
+	if err != nil {
+		return 0, err
+	}
+	if ok {
+		req.Header.Set("Authorization", header)
+	}
+	client := &http.Client{Timeout: probeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return resp.StatusCode, fmt.Errorf("%s rejected credentials (HTTP %d)", host, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func HostFromURI(uri string) string {
+	uri = strings.TrimSpace(uri)
+	if i := strings.Index(uri, "://"); i >= 0 {
+		rest := uri[i+3:]
+		if j := strings.IndexAny(rest, "/?#"); j >= 0 {
+			rest = rest[:j]
+		}
+		if at := strings.LastIndex(rest, "@"); at >= 0 {
+			rest = rest[at+1:]
+		}
+		return NormalizeHost(rest)
+	}
+	if at := strings.Index(uri, "@"); at >= 0 {
+		rest := uri[at+1:]
+		if colon := strings.Index(rest, ":"); colon >= 0 {
+			return NormalizeHost(rest[:colon])
+		}
+	}
+	return NormalizeHost(uri)
+}
+
+func normalizeKind(kind string) (string, error) {
+	kind = strings.ToLower(strings.TrimSpace(kind))
+	switch kind {
+	case "":
+		return KindGit, nil
+	case KindGit, KindOCI, KindRegistry, KindArchive:
+		return kind, nil
+	default:
+		return "", fmt.Errorf("unsupported auth kind %q (supported: git, oci, registry, archive)", kind)
+	}
+}
+
+func (s *Store) passphrase() (string, error) {
+	if s.Passphrase == nil {
+		return "", ErrPassphraseRequired
+	}
+	passphrase, err := s.Passphrase()
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", ErrPassphraseRequired
+	}
+	return passphrase, nil
+}
+
+func envPassphrase() (string, error) {
+	if v := os.Getenv(PassphraseEnv); v != "" {
+		return v, nil
+	}
+	return "", ErrPassphraseRequired
+}
+
+func encrypt(passphrase string, plain []byte) (string, string, string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", "", "", err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return "", "", "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", "", "", err
+	}
+	sealed := gcm.Seal(nil, nonce, plain, nil)
+	enc := base64.StdEncoding
+	return enc.EncodeToString(salt), enc.EncodeToString(nonce), enc.EncodeToString(sealed), nil
+}
+
+func decrypt(passphrase, saltB64, nonceB64, ciphertextB64 string) ([]byte, error) {
+	enc := base64.StdEncoding
+	salt, err := enc.DecodeString(saltB64)
+	if err != nil {
+		return nil, fmt.Errorf("decode auth salt: %w", err)
+	}
+	nonce, err := enc.DecodeString(nonceB64)
+	if err != nil {
+		return nil, fmt.Errorf("decode auth nonce: %w", err)
+	}
+	sealed, err := enc.DecodeString(ciphertextB64)
+	if err != nil {
+		return nil, fmt.Errorf("decode auth ciphertext: %w", err)
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, errors.New("decrypt auth secret: wrong passphrase or corrupted config")
+	}
+	return plain, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key := pbkdf2SHA256([]byte(passphrase), salt, pbkdf2Iterations, 32)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func pbkdf2SHA256(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	blocks := (keyLen + hashLen - 1) / hashLen
+	out := make([]byte, 0, blocks*hashLen)
+	buf := make([]byte, 4)
+	for block := 1; block <= blocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(buf, uint32(block))
+		prf.Write(buf)
+		u := prf.Sum(nil)
+		t := make([]byte, len(u))
+		copy(t, u)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen]
+}
@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rulepack/internal/config"
+)
+
+type memoryKeyring struct {
+	secrets map[string]string
+}
+
+func (k *memoryKeyring) Available() bool { return true }
+
+func (k *memoryKeyring) Set(service, account, secret string) error {
+	if k.secrets == nil {
+		k.secrets = map[string]string{}
+	}
+	k.secrets[service+"/"+account] = secret
+	return nil
+}
+
+func (k *memoryKeyring) Get(service, account string) (string, error) {
+	secret, ok := k.secrets[service+"/"+account]
+	if !ok {
+		return "", errors.New("secret not found")
+	}
+	return secret, nil
+}
+
+func (k *memoryKeyring) Delete(service, account string) error {
+	delete(k.secrets, service+"/"+account)
+	return nil
+}
+
+func TestLoginPassphraseEncryptsAtRest(t *testing.T) {
+	store := &Store{Passphrase: func() (string, error) { return "hunter2", nil }}
+	var cfg config.UserConfig
+	if _, err := store.Login(&cfg, "https://GitHub.com/", "", "bot", "s3cret-token", StoragePassphrase); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	entry, ok := cfg.Auth.Hosts["github.com"]
+	if !ok {
+		t.Fatalf("expected normalized host entry, got %#v", cfg.Auth.Hosts)
+	}
+	if strings.Contains(entry.Ciphertext, "s3cret-token") || entry.Ciphertext == "" {
+		t.Fatalf("expected encrypted ciphertext, got %q", entry.Ciphertext)
+	}
+	secret, err := store.Secret(cfg, "github.com")
+	if err != nil {
+		t.Fatalf("Secret: %v", err)
+	}
+	if secret != "s3cret-token" {
+		t.Fatalf("unexpected secret %q", secret)
+	}
+
+	wrong := &Store{Passphrase: func() (string, error) { return "nope", nil }}
+	if _, err := wrong.Secret(cfg, "github.com"); err == nil {
+		t.Fatalf("expected wrong passphrase to fail")
+	}
+	locked := &Store{}
+	status := locked.Status(cfg)
+	if len(status) != 1 || status[0].Status != "locked" {
+		t.Fatalf("expected locked status without passphrase, got %#v", status)
+	}
+}
+
+func TestLoginKeyringAndLogout(t *testing.T) {
+	ring := &memoryKeyring{}
+	store := &Store{Keyring: ring}
+	var cfg config.UserConfig
+	if _, err := store.Login(&cfg, "git.example.com", "", "", "tok", ""); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	entry := cfg.Auth.Hosts["git.example.com"]
+	if entry.Storage != StorageKeyring || entry.Ciphertext != "" {
+		t.Fatalf("expected keyring storage without ciphertext, got %#v", entry)
+	}
+	if ring.secrets["rulepack/git.example.com"] != "tok" {
+		t.Fatalf("expected secret in keyring, got %#v", ring.secrets)
+	}
+	if _, err := store.Logout(&cfg, "git.example.com"); err != nil {
+		t.Fatalf("Logout: %v", err)
+	}
+	if len(cfg.Auth.Hosts) != 0 || len(ring.secrets) != 0 {
+		t.Fatalf("expected credentials removed, cfg=%#v ring=%#v", cfg.Auth.Hosts, ring.secrets)
+	}
+}
+
+func TestHostFromURI(t *testing.T) {
+	cases := map[string]string{
+		"https://github.com/org/repo.git":        "github.com",
+		"https://user@Git.Example.com:8443/x":    "git.example.com:8443",
+		"git@github.com:org/repo.git":            "github.com",
+		"ssh://git@gitlab.internal/org/repo.git": "gitlab.internal",
+	}
+	for in, want := range cases {
+		if got := HostFromURI(in); got != want {
+			t.Fatalf("HostFromURI(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestGitCredentialsIgnoresOtherKinds(t *testing.T) {
+	ring := &memoryKeyring{}
+	store := &Store{Keyring: ring}
+	var cfg config.UserConfig
+	if _, err := store.Login(&cfg, "github.com", KindGit, "bot", "git-tok", ""); err != nil {
+		t.Fatalf("Login git: %v", err)
+	}
+	if _, err := store.Login(&cfg, "registry.example.com", KindRegistry, "", "reg-tok", ""); err != nil {
+		t.Fatalf("Login registry: %v", err)
+	}
+	creds := store.GitCredentials(cfg)
+	user, secret, ok, err := creds("https://github.com/org/rules.git")
+	if err != nil || !ok || user != "bot" || secret != "git-tok" {
+		t.Fatalf("unexpected git credentials: %q %q %v %v", user, secret, ok, err)
+	}
+	if _, _, ok, _ := creds("https://registry.example.com/org/rules.git"); ok {
+		t.Fatalf("expected registry credential to be ignored for git")
+	}
+}
+
+func TestProbeHTTPSendsBearerForRegistry(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		if gotAuth != "Bearer reg-tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	store := &Store{Keyring: &memoryKeyring{}}
+	var cfg config.UserConfig
+	host := HostFromURI(srv.URL)
+	if _, err := store.Login(&cfg, host, KindRegistry, "", "reg-tok", ""); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	code, err := store.ProbeHTTP(cfg, host, srv.URL)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("expected successful probe, got %d %v (auth=%q)", code, err, gotAuth)
+	}
+	if _, err := (&Store{Keyring: &memoryKeyring{}}).ProbeHTTP(config.UserConfig{}, host, srv.URL); err == nil {
+		t.Fatalf("expected probe without credentials to fail")
+	}
+}
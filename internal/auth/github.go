@@ -0,0 +1,161 @@
+package auth
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"rulepack/internal/config"
+)
+
+const (
+	StorageGitHubApp = "github-app"
+	StorageEnv       = "env"
+
+	defaultGitHubAPI = "https://api.github.com"
+)
+
+type mintedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+var mintedTokens sync.Map
+
+// mintGitHubAppToken exchanges a short-lived app JWT for an installation token.
+// Tokens are cached per host for the life of the process and refreshed a
+// minute before GitHub expires them.
+func mintGitHubAppToken(host string, app config.GitHubAppCredential, now time.Time) (string, error) {
+	if cached, ok := mintedTokens.Load(host); ok {
+		t := cached.(mintedToken)
+		if now.Before(t.expiresAt.Add(-time.Minute)) {
+			return t.token, nil
+		}
+	}
+	key, err := checkGitHubApp(host, app)
+	if err != nil {
+		return "", err
+	}
+	jwt, err := signAppJWT(app.AppID, key, now)
+	if err != nil {
+		return "", err
+	}
+	apiURL := strings.TrimRight(app.APIURL, "/")
+	if apiURL == "" {
+		apiURL = defaultGitHubAPI
+	}
+	var body []byte
+	if len(app.Repositories) > 0 {
+		body, err = json.Marshal(map[string]any{"repositories": app.Repositories})
+		if err != nil {
+			return "", err
+		}
+	}
+	req, err := http.NewRequest(http.MethodPost, apiURL+"/app/installations/"+app.InstallationID+"/access_tokens", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	client := &http.Client{Timeout: probeTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("mint github app token for %s: %w", host, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("mint github app token for %s: HTTP %d", host, resp.StatusCode)
+	}
+	var payload struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("decode github app token response: %w", err)
+	}
+	if payload.Token == "" {
+		return "", errors.New("github app token response missing token")
+	}
+	if payload.ExpiresAt.IsZero() {
+		payload.ExpiresAt = now.Add(time.Hour)
+	}
+	mintedTokens.Store(host, mintedToken{token: payload.Token, expiresAt: payload.ExpiresAt})
+	return payload.Token, nil
+}
+
+// checkGitHubApp validates app credentials and loads their private key
+// without contacting GitHub.
+func checkGitHubApp(host string, app config.GitHubAppCredential) (*rsa.PrivateKey, error) {
+	if app.AppID == "" || app.InstallationID == "" {
+		return nil, fmt.Errorf("github app credentials for %s require appId and installationId", host)
+	}
+	return loadGitHubAppKey(app)
+}
+
+func loadGitHubAppKey(app config.GitHubAppCredential) (*rsa.PrivateKey, error) {
+	var data []byte
+	switch {
+	case app.PrivateKeyEnv != "":
+		data = []byte(os.Getenv(app.PrivateKeyEnv))
+		if len(data) == 0 {
+			return nil, fmt.Errorf("github app private key env %s is empty", app.PrivateKeyEnv)
+		}
+	case app.PrivateKeyPath != "":
+		var err error
+		data, err = os.ReadFile(app.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("read github app private key: %w", err)
+		}
+	default:
+		return nil, errors.New("github app credentials require privateKeyPath or privateKeyEnv")
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("github app private key is not PEM encoded")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse github app private key: %w", err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("github app private key must be RSA")
+	}
+	return key, nil
+}
+
+func signAppJWT(appID string, key *rsa.PrivateKey, now time.Time) (string, error) {
+	enc := base64.RawURLEncoding
+	header := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]any{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": appID,
+	})
+	if err != nil {
+		return "", err
+	}
+	signingInput := header + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + enc.EncodeToString(sig), nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rulepack/internal/config"
+)
+
+func TestGitHubAppMintsInstallationToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, pemBytes, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.URL.Path != "/app/installations/99/access_tokens" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		jwt := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		parts := strings.Split(jwt, ".")
+		if len(parts) != 3 {
+			t.Errorf("expected JWT, got %q", jwt)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		sig, _ := base64.RawURLEncoding.DecodeString(parts[2])
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+			t.Errorf("invalid JWT signature: %v", err)
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":"ghs_minted","expires_at":"2099-01-01T00:00:00Z"}`))
+	}))
+	defer srv.Close()
+
+	store := &Store{}
+	var cfg config.UserConfig
+	host := "github.app-test.example"
+	if _, err := store.LoginGitHubApp(&cfg, host, config.GitHubAppCredential{
+		AppID:          "12",
+		InstallationID: "99",
+		PrivateKeyPath: keyPath,
+		APIURL:         srv.URL,
+	}); err != nil {
+		t.Fatalf("LoginGitHubApp: %v", err)
+	}
+	user, secret, ok, err := store.GitCredentials(cfg)("https://" + host + "/org/private-rules.git")
+	if err != nil || !ok {
+		t.Fatalf("GitCredentials: ok=%v err=%v", ok, err)
+	}
+	if user != "x-access-token" || secret != "ghs_minted" {
+		t.Fatalf("unexpected minted credentials %q %q", user, secret)
+	}
+	if _, err := store.Secret(cfg, host); err != nil {
+		t.Fatalf("Secret: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected minted token to be cached, got %d calls", calls)
+	}
+}
+
+func TestTokenEnvReadsAtRuntime(t *testing.T) {
+	store := &Store{}
+	var cfg config.UserConfig
+	if _, err := store.LoginTokenEnv(&cfg, "github.com", KindGit, "", "RULEPACK_TEST_PAT"); err != nil {
+		t.Fatalf("LoginTokenEnv: %v", err)
+	}
+	if _, err := store.Secret(cfg, "github.com"); err == nil {
+		t.Fatalf("expected empty env to fail")
+	}
+	t.Setenv("RULEPACK_TEST_PAT", "github_pat_x")
+	secret, err := store.Secret(cfg, "github.com")
+	if err != nil || secret != "github_pat_x" {
+		t.Fatalf("unexpected secret %q %v", secret, err)
+	}
+}
+
+func TestStatusChecksGitHubAppWithoutMinting(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "app.pem")
+	pemBytes := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, pemBytes, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	store := &Store{}
+	var cfg config.UserConfig
+	if _, err := store.LoginGitHubApp(&cfg, "github.status-test.example", config.GitHubAppCredential{
+		AppID:          "12",
+		InstallationID: "99",
+		PrivateKeyPath: keyPath,
+		APIURL:         srv.URL,
+	}); err != nil {
+		t.Fatalf("LoginGitHubApp: %v", err)
+	}
+	if _, err := store.LoginGitHubApp(&cfg, "github.missing-key.example", config.GitHubAppCredential{
+		AppID:          "12",
+		InstallationID: "99",
+		PrivateKeyPath: filepath.Join(t.TempDir(), "missing.pem"),
+		APIURL:         srv.URL,
+	}); err != nil {
+		t.Fatalf("LoginGitHubApp: %v", err)
+	}
+	rows := store.Status(cfg)
+	if len(rows) != 2 || rows[0].Status != "error" || rows[1].Status != "ok" {
+		t.Fatalf("expected missing key to error and valid app to be ok, got %#v", rows)
+	}
+	if calls != 0 {
+		t.Fatalf("expected status not to contact GitHub, got %d calls", calls)
+	}
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+type Keyring interface {
+	Available() bool
+	Set(service, account, secret string) error
+	Get(service, account string) (string, error)
+	Delete(service, account string) error
+}
+
+var defaultKeyring = func() Keyring {
+	switch runtime.GOOS {
+	case "darwin":
+		return macKeychain{}
+	case "linux", "freebsd", "openbsd":
+		return secretService{}
+	default:
+		return nil
+	}
+}
+
+type macKeychain struct{}
+
+func (macKeychain) Available() bool {
+	_, err := exec.LookPath("security")
+	return err == nil
+}
+
+// Set runs security in interactive mode and writes the command on its stdin,
+// so the secret never appears in the process list.
+func (macKeychain) Set(service, account, secret string) error {
+	if strings.ContainsAny(service+account+secret, "\r\n") {
+		return errors.New("os keychain secrets must not contain line breaks")
+	}
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", securityQuote(service), securityQuote(account), securityQuote(secret))
+	_, err := runKeyring(command, "security", "-i")
+	return err
+}
+
+// securityQuote quotes s as a single argument for security -i.
+func securityQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (macKeychain) Get(service, account string) (string, error) {
+	out, err := runKeyring("", "security", "find-generic-password", "-s", service, "-a", account, "-w")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func (macKeychain) Delete(service, account string) error {
+	_, err := runKeyring("", "security", "delete-generic-password", "-s", service, "-a", account)
+	return err
+}
+
+type secretService struct{}
+
+func (secretService) Available() bool {
+	_, err := exec.LookPath("secret-tool")
+	return err == nil
+}
+
+func (secretService) Set(service, account, secret string) error {
+	_, err := runKeyring(secret, "secret-tool", "store", "--label", service+" "+account, "service", service, "account", account)
+	return err
+}
+
+func (secretService) Get(service, account string) (string, error) {
+	out, err := runKeyring("", "secret-tool", "lookup", "service", service, "account", account)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "", errors.New("secret not found in os keychain")
+	}
+	return strings.TrimRight(out, "\n"), nil
+}
+
+func (secretService) Delete(service, account string) error {
+	_, err := runKeyring("", "secret-tool", "clear", "service", service, "account", account)
+	return err
+}
+
+func runKeyring(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("%s %s failed: %w\n%s", name, args[0], err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("%s %s failed: %w", name, args[0], err)
+	}
+	return string(out), nil
+}
@@ -1,8 +1,20 @@
 package build
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
 	"sort"
+	"strings"
+	"time"
 
 	"rulepack/internal/config"
 	"rulepack/internal/pack"
@@ -25,34 +37,276 @@ func ApplyOverrides(modules []pack.Module, overrides []config.Override) []pack.M
 	return out
 }
 
+// FilterPlatform drops modules whose when condition excludes goos/goarch.
+func FilterPlatform(modules []pack.Module, goos, goarch string) []pack.Module {
+	out := make([]pack.Module, 0, len(modules))
+	for _, m := range modules {
+		if m.When.Matches(goos, goarch) {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// Sort orders modules by priority, then ID. Modules sharing an ID are
+// further ordered by pack and path, so the order is total and never depends
+// on dependency or manifest order.
 func Sort(modules []pack.Module) {
 	sort.Slice(modules, func(i, j int) bool {
-		if modules[i].Priority == modules[j].Priority {
-			return modules[i].ID < modules[j].ID
+		a, b := modules[i], modules[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.ID != b.ID {
+			return a.ID < b.ID
+		}
+		if a.PackName != b.PackName {
+			return a.PackName < b.PackName
 		}
-		return modules[i].Priority < modules[j].Priority
+		return a.Path < b.Path
 	})
 }
 
+// DuplicateIDError reports two composed modules sharing an ID.
+type DuplicateIDError struct {
+	ID            string
+	First, Second pack.Module
+}
+
+func (e *DuplicateIDError) Error() string {
+	return fmt.Sprintf(
+		"duplicate module id %q after composition: first(pack=%s version=%s commit=%s) second(pack=%s version=%s commit=%s)",
+		e.ID,
+		e.First.PackName, e.First.PackVersion, shortCommit(e.First.Commit),
+		e.Second.PackName, e.Second.PackVersion, shortCommit(e.Second.Commit),
+	)
+}
+
+// CheckDuplicateIDs returns a *DuplicateIDError for the first module ID
+// that occurs twice.
 func CheckDuplicateIDs(modules []pack.Module) error {
 	seen := map[string]pack.Module{}
 	for _, m := range modules {
 		if prev, ok := seen[m.ID]; ok {
-			return fmt.Errorf(
-				"duplicate module id %q after composition: first(pack=%s version=%s commit=%s) second(pack=%s version=%s commit=%s)",
-				m.ID,
-				prev.PackName, prev.PackVersion, shortCommit(prev.Commit),
-				m.PackName, m.PackVersion, shortCommit(m.Commit),
-			)
+			return &DuplicateIDError{ID: m.ID, First: prev, Second: m}
 		}
 		seen[m.ID] = m
 	}
 	return nil
 }
 
+// CheckOutputSize rejects compositions whose module content exceeds max bytes.
+// A max of zero disables the check.
+func CheckOutputSize(modules []pack.Module, max int64) error {
+	if max <= 0 {
+		return nil
+	}
+	var total int64
+	for _, m := range modules {
+		total += int64(len(m.Content))
+	}
+	if total > max {
+		return fmt.Errorf("composed output is %d bytes across %d modules, exceeding the limit of %d", total, len(modules), max)
+	}
+	return nil
+}
+
 func shortCommit(v string) string {
 	if len(v) > 12 {
 		return v[:12]
 	}
 	return v
 }
+
+// FormatTimeout bounds one formatter run.
+const FormatTimeout = 2 * time.Minute
+
+// formatterEnv is the environment a formatter sees: enough to locate and run
+// tools, without tokens or other secrets from the caller's environment.
+var formatterEnv = []string{"PATH", "HOME", "USERPROFILE", "SYSTEMROOT", "TMPDIR", "TEMP", "TMP", "LANG"}
+
+// CommandEnv returns the environment for a command named in a config file:
+// the variables of formatterEnv, plus the extra names, taken from the
+// caller's environment when set.
+func CommandEnv(extra ...string) []string {
+	env := make([]string, 0, len(formatterEnv)+len(extra))
+	for _, key := range append(slices.Clone(formatterEnv), extra...) {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// Format runs a target's formatter once with the output files appended to
+// argv. The command runs without a shell, stdin, or inherited secrets, and is
+// killed after FormatTimeout.
+func Format(argv []string, files []string) error {
+	if len(argv) == 0 || len(files) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), FormatTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], append(argv[1:], files...)...)
+	cmd.Env = CommandEnv()
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s timed out after %s", argv[0], FormatTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %w: %s", argv[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// NewStage creates a staging directory under dir. Staging beside the outputs
+// keeps CommitStage's renames on one filesystem.
+func NewStage(dir string) (string, error) {
+	return os.MkdirTemp(dir, ".rulepack-stage-")
+}
+
+// CommitStage moves every file under stage to the same relative path under
+// dest, creating directories as needed. It returns the moved files as
+// slash-separated paths relative to dest.
+func CommitStage(stage, dest string) ([]string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(stage, func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(stage, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(path, target); err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// InputHash digests everything that determines a target's output: the entry,
+// the content of its template, if any, and each module's identity, content,
+// and apply metadata.
+func InputHash(entry config.TargetEntry, modules []pack.Module) (string, error) {
+	var tmpl string
+	if entry.Template != "" {
+		data, err := os.ReadFile(entry.Template)
+		if err != nil {
+			return "", err
+		}
+		tmpl = string(data)
+	}
+	entry.Root = ""
+	bytes, err := json.Marshal(struct {
+		Entry         config.TargetEntry
+		RulesetDigest string
+		Template      string `json:",omitempty"`
+		Modules       []hashedModule
+	}{entry, entry.RulesetDigest, tmpl, hashModules(modules)})
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// RulesetDigest digests a composed module set independent of its order, for
+// the lockfile's rulesetDigest.
+func RulesetDigest(modules []pack.Module) (string, error) {
+	sorted := append([]pack.Module(nil), modules...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	bytes, err := json.Marshal(hashModules(sorted))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type hashedModule struct {
+	PackName    string
+	PackVersion string
+	Commit      string
+	ID          string
+	Priority    int
+	Content     string
+	Apply       pack.ApplyConfig
+}
+
+func hashModules(modules []pack.Module) []hashedModule {
+	hashed := make([]hashedModule, 0, len(modules))
+	for _, m := range modules {
+		hashed = append(hashed, hashedModule{m.PackName, m.PackVersion, m.Commit, m.ID, m.Priority, m.Content, m.Apply})
+	}
+	return hashed
+}
+
+// RecordOutputs digests files for the build manifest.
+func RecordOutputs(files []string) ([]config.OutputFile, error) {
+	out := make([]config.OutputFile, 0, len(files))
+	for _, f := range files {
+		digest, err := fileDigest(f)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, config.OutputFile{Path: f, SHA256: digest})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Path < out[j].Path })
+	return out, nil
+}
+
+// OutputStatus compares a recorded file with disk: "ok", "modified", or
+// "missing".
+func OutputStatus(f config.OutputFile) (string, error) {
+	digest, err := fileDigest(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "missing", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if digest != f.SHA256 {
+		return "modified", nil
+	}
+	return "ok", nil
+}
+
+// RemoveOutputs deletes recorded files that still match their digest.
+// Modified files are skipped and missing ones ignored.
+func RemoveOutputs(files []config.OutputFile) (deleted []string, skipped []string, err error) {
+	for _, f := range files {
+		status, err := OutputStatus(f)
+		if err != nil {
+			return deleted, skipped, err
+		}
+		switch status {
+		case "ok":
+			if err := os.Remove(f.Path); err != nil {
+				return deleted, skipped, err
+			}
+			deleted = append(deleted, f.Path)
+		case "modified":
+			skipped = append(skipped, f.Path)
+		}
+	}
+	return deleted, skipped, nil
+}
+
+func fileDigest(path string) (string, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
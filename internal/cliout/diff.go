@@ -0,0 +1,196 @@
+package cliout
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// Diff is a before/after pair the human renderer prints as a line diff with
+// changed words highlighted. An empty Before is a new file, an empty After a
+// deleted one.
+type Diff struct {
+	Title  string `json:"title"`
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// maxDiffCells bounds the line LCS table; larger inputs are shown as the
+// whole of Before removed and the whole of After added.
+const maxDiffCells = 4_000_000
+
+type diffOp struct {
+	kind byte // ' ', '-', or '+'
+	text string
+}
+
+var wordRe = regexp.MustCompile(`\s+|\w+|[^\w\s]`)
+
+// renderDiff returns d as unified lines. Within a change, removed and added
+// lines are paired in order and diffed word by word: with color the changed
+// words are highlighted on the - and + lines, without it each pair becomes
+// one ~ line marking words as [-removed-]{+added+}. Lines left unpaired are
+// shown whole.
+func (r *HumanRenderer) renderDiff(d Diff) string {
+	ops := diffLines(splitDiffLines(d.Before), splitDiffLines(d.After))
+	show := make([]bool, len(ops))
+	for i, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		for j := max(0, i-diffContext); j <= min(len(ops)-1, i+diffContext); j++ {
+			show[j] = true
+		}
+	}
+	var b strings.Builder
+	gap := false
+	for i := 0; i < len(ops); {
+		if !show[i] {
+			gap = true
+			i++
+			continue
+		}
+		if gap && b.Len() > 0 {
+			b.WriteString(r.styleSubhead("...") + "\n")
+		}
+		gap = false
+		if ops[i].kind == ' ' {
+			b.WriteString("  " + ops[i].text + "\n")
+			i++
+			continue
+		}
+		del := i
+		for i < len(ops) && ops[i].kind == '-' {
+			i++
+		}
+		ins := i
+		for i < len(ops) && ops[i].kind == '+' {
+			i++
+		}
+		removed, added := ops[del:ins], ops[ins:i]
+		paired := min(len(removed), len(added))
+		for k := 0; k < paired; k++ {
+			b.WriteString(r.renderWordDiff(removed[k].text, added[k].text))
+		}
+		for _, op := range removed[paired:] {
+			b.WriteString(r.styleRemoved("- "+op.text) + "\n")
+		}
+		for _, op := range added[paired:] {
+			b.WriteString(r.styleAdded("+ "+op.text) + "\n")
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+func (r *HumanRenderer) renderWordDiff(before, after string) string {
+	ops := diffLines(wordRe.FindAllString(before, -1), wordRe.FindAllString(after, -1))
+	if !r.color {
+		var b strings.Builder
+		b.WriteString("~ ")
+		for i := 0; i < len(ops); {
+			kind := ops[i].kind
+			var run strings.Builder
+			for ; i < len(ops) && ops[i].kind == kind; i++ {
+				run.WriteString(ops[i].text)
+			}
+			switch kind {
+			case '-':
+				b.WriteString("[-" + run.String() + "-]")
+			case '+':
+				b.WriteString("{+" + run.String() + "+}")
+			default:
+				b.WriteString(run.String())
+			}
+		}
+		return b.String() + "\n"
+	}
+	var minus, plus strings.Builder
+	for _, op := range ops {
+		switch op.kind {
+		case '-':
+			minus.WriteString(r.styleRemovedWord(op.text))
+		case '+':
+			plus.WriteString(r.styleAddedWord(op.text))
+		default:
+			minus.WriteString(r.styleRemoved(op.text))
+			plus.WriteString(r.styleAdded(op.text))
+		}
+	}
+	return r.styleRemoved("- ") + minus.String() + "\n" + r.styleAdded("+ ") + plus.String() + "\n"
+}
+
+func splitDiffLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffLines returns the edit script turning a into b along a longest common
+// subsequence, removals before additions within each change.
+func diffLines(a, b []string) []diffOp {
+	ops := make([]diffOp, 0, len(a)+len(b))
+	if len(a)*len(b) > maxDiffCells {
+		for _, s := range a {
+			ops = append(ops, diffOp{'-', s})
+		}
+		for _, s := range b {
+			ops = append(ops, diffOp{'+', s})
+		}
+		return ops
+	}
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i, j = i+1, j+1
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+func (r *HumanRenderer) styleRemoved(s string) string {
+	if !r.color {
+		return s
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("196")).Render(s)
+}
+
+func (r *HumanRenderer) styleAdded(s string) string {
+	if !r.color {
+		return s
+	}
+	return lipgloss.NewStyle().Foreground(lipgloss.Color("42")).Render(s)
+}
+
+func (r *HumanRenderer) styleRemovedWord(s string) string {
+	return lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("231")).Background(lipgloss.Color("124")).Render(s)
+}
+
+func (r *HumanRenderer) styleAddedWord(s string) string {
+	return lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("231")).Background(lipgloss.Color("28")).Render(s)
+}
@@ -0,0 +1,22 @@
+package cliout
+
+import "testing"
+
+func TestRenderDiffPlainMarksChangedWords(t *testing.T) {
+	r := &HumanRenderer{}
+	before := "one\ntwo\nthree\nfour\nfive\nsix\nseven\nUse tabs for indentation.\n"
+	after := "one\ntwo\nthree\nfour\nfive\nsix\nseven\nUse spaces for indentation.\nextra\n"
+	got := r.renderDiff(Diff{Title: "rules.md", Before: before, After: after})
+	want := "  five\n  six\n  seven\n~ Use [-tabs-]{+spaces+} for indentation.\n+ extra"
+	if got != want {
+		t.Fatalf("unexpected diff:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderDiffNewFileIsAllAdded(t *testing.T) {
+	r := &HumanRenderer{}
+	got := r.renderDiff(Diff{Title: "new.md", After: "a\nb\n"})
+	if got != "+ a\n+ b" {
+		t.Fatalf("unexpected diff: %q", got)
+	}
+}
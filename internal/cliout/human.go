@@ -11,6 +11,9 @@ import (
 
 type HumanRenderer struct {
 	color bool
+	// pager, when set, is the command long output is piped through; see
+	// SetPager.
+	pager string
 }
 
 func NewHumanRenderer(noColor bool) *HumanRenderer {
@@ -19,31 +22,37 @@ func NewHumanRenderer(noColor bool) *HumanRenderer {
 }
 
 func (r *HumanRenderer) RenderHuman(payload HumanPayload) {
+	var b strings.Builder
 	header := payload.Command
 	if payload.Title != "" {
 		header = payload.Title
 	}
-	fmt.Println(r.styleHeader(header))
+	fmt.Fprintln(&b, r.styleHeader(header))
 	for _, evt := range payload.Events {
 		switch evt.Level {
 		case "warn":
-			fmt.Println(r.styleWarn("! " + evt.Message))
+			fmt.Fprintln(&b, r.styleWarn("! "+evt.Message))
 		case "error":
-			fmt.Println(r.styleErr("x " + evt.Message))
+			fmt.Fprintln(&b, r.styleErr("x "+evt.Message))
 		default:
-			fmt.Println(r.styleInfo("- " + evt.Message))
+			fmt.Fprintln(&b, r.styleInfo("- "+evt.Message))
 		}
 	}
 	for _, table := range payload.Tables {
-		fmt.Println()
+		fmt.Fprintln(&b)
 		if table.Title != "" {
-			fmt.Println(r.styleSubhead(table.Title))
+			fmt.Fprintln(&b, r.styleSubhead(table.Title))
 		}
-		fmt.Println(renderTable(table.Columns, table.Rows))
+		fmt.Fprintln(&b, renderTable(table.Columns, table.Rows))
+	}
+	for _, d := range payload.Diffs {
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, r.styleSubhead(d.Title))
+		fmt.Fprintln(&b, r.renderDiff(d))
 	}
 	if len(payload.Summary) > 0 {
-		fmt.Println()
-		fmt.Println(r.styleSubhead("Summary"))
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, r.styleSubhead("Summary"))
 		keys := make([]string, 0, len(payload.Summary))
 		for k := range payload.Summary {
 			keys = append(keys, k)
@@ -57,13 +66,14 @@ func (r *HumanRenderer) RenderHuman(payload HumanPayload) {
 			}
 		}
 		for _, k := range keys {
-			fmt.Printf("  %s: %s\n", k, payload.Summary[k])
+			fmt.Fprintf(&b, "  %s: %s\n", k, payload.Summary[k])
 		}
 	}
 	if payload.Done != "" {
-		fmt.Println()
-		fmt.Println(r.styleDone(payload.Done))
+		fmt.Fprintln(&b)
+		fmt.Fprintln(&b, r.styleDone(payload.Done))
 	}
+	r.page(b.String())
 }
 
 func (r *HumanRenderer) RenderJSON(_ string, payload any) error {
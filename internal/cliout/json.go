@@ -2,13 +2,52 @@ package cliout
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 )
 
-type JSONRenderer struct{}
+// SchemaVersion is the current version of the JSON envelope and command
+// result shapes. Additive changes keep the version; any breaking change bumps
+// it and registers shims that convert the new shape back to the previous one.
+const SchemaVersion = 1
+
+// Shim rewrites a command result from schema version v+1 to v. Results arrive
+// decoded into generic JSON values (maps, slices, strings, float64, bool, nil).
+type Shim func(result any) any
+
+// shims[v][command] downgrades results from version v+1 to v. The "*" entry
+// applies to every command before the command's own shim.
+var shims = map[int]map[string]Shim{}
+
+type envelope struct {
+	SchemaVersion int    `json:"schemaVersion"`
+	Command       string `json:"command"`
+	Result        any    `json:"result"`
+}
+
+type JSONRenderer struct {
+	version int
+	out     io.Writer
+}
 
 func NewJSONRenderer() *JSONRenderer {
-	return &JSONRenderer{}
+	return &JSONRenderer{version: SchemaVersion}
+}
+
+// NewJSONRendererVersion renders envelopes in the requested schema version,
+// downgrading results through the registered shims.
+func NewJSONRendererVersion(version int) (*JSONRenderer, error) {
+	if version < 1 || version > SchemaVersion {
+		return nil, fmt.Errorf("unsupported schema version %d (supported: 1-%d)", version, SchemaVersion)
+	}
+	return &JSONRenderer{version: version}, nil
+}
+
+// SetOutput sends envelopes to w instead of stdout.
+func (r *JSONRenderer) SetOutput(w io.Writer) {
+	r.out = w
 }
 
 func (r *JSONRenderer) RenderHuman(payload HumanPayload) {
@@ -16,20 +55,61 @@ func (r *JSONRenderer) RenderHuman(payload HumanPayload) {
 }
 
 func (r *JSONRenderer) RenderJSON(command string, payload any) error {
-	out := map[string]any{
-		"command": command,
-		"result":  payload,
+	result, err := downgrade(command, payload, r.version)
+	if err != nil {
+		return err
 	}
-	enc := json.NewEncoder(os.Stdout)
+	out := r.out
+	if out == nil {
+		out = os.Stdout
+	}
+	enc := json.NewEncoder(out)
 	enc.SetIndent("", "  ")
-	return enc.Encode(out)
+	return enc.Encode(envelope{SchemaVersion: r.version, Command: command, Result: result})
+}
+
+// DetailedError is an error that carries structured context for JSON
+// output, reported as error.details next to the message.
+type DetailedError interface {
+	error
+	Details() any
 }
 
 func (r *JSONRenderer) RenderError(command string, err error) {
+	body := map[string]any{
+		"message": err.Error(),
+	}
+	var detailed DetailedError
+	if errors.As(err, &detailed) {
+		body["details"] = detailed.Details()
+	}
 	_ = r.RenderJSON("error", map[string]any{
 		"failedCommand": command,
-		"error": map[string]string{
-			"message": err.Error(),
-		},
+		"error":         body,
 	})
 }
+
+// downgrade converts a current-version result to version by applying each
+// shim between them, newest first. The current version passes through as is.
+func downgrade(command string, payload any, version int) (any, error) {
+	if version >= SchemaVersion {
+		return payload, nil
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	var result any
+	if err := json.Unmarshal(raw, &result); err != nil {
+		return nil, err
+	}
+	for v := SchemaVersion - 1; v >= version; v-- {
+		if shim, ok := shims[v]["*"]; ok {
+			result = shim(result)
+		}
+		if shim, ok := shims[v][command]; ok {
+			result = shim(result)
+		}
+	}
+	return result, nil
+}
@@ -11,3 +11,46 @@ func TestMustJSON(t *testing.T) {
 		t.Fatalf("expected newline-terminated json")
 	}
 }
+
+func TestNewJSONRendererVersion(t *testing.T) {
+	if _, err := NewJSONRendererVersion(SchemaVersion); err != nil {
+		t.Fatalf("expected current version to be accepted: %v", err)
+	}
+	for _, v := range []int{0, SchemaVersion + 1} {
+		if _, err := NewJSONRendererVersion(v); err == nil {
+			t.Fatalf("expected version %d to be rejected", v)
+		}
+	}
+}
+
+func TestDowngradeAppliesShimsNewestFirst(t *testing.T) {
+	saved := shims
+	defer func() { shims = saved }()
+	shims = map[int]map[string]Shim{
+		SchemaVersion - 1: {"build": func(result any) any {
+			m := result.(map[string]any)
+			m["targets"] = m["outputs"]
+			delete(m, "outputs")
+			return m
+		}},
+		SchemaVersion - 2: {"*": func(result any) any {
+			m := result.(map[string]any)
+			m["v"] = "old"
+			return m
+		}},
+	}
+
+	got, err := downgrade("build", map[string]any{"outputs": []string{"a"}}, SchemaVersion-2)
+	if err != nil {
+		t.Fatalf("downgrade: %v", err)
+	}
+	m := got.(map[string]any)
+	if _, ok := m["outputs"]; ok || m["targets"] == nil || m["v"] != "old" {
+		t.Fatalf("unexpected downgraded result: %#v", m)
+	}
+
+	current := map[string]any{"outputs": []string{"a"}}
+	if got, _ := downgrade("build", current, SchemaVersion); got.(map[string]any)["outputs"] == nil {
+		t.Fatalf("expected current version to pass through")
+	}
+}
@@ -0,0 +1,69 @@
+package cliout
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// DefaultPager is used when $PAGER is unset.
+const DefaultPager = "less"
+
+// PagerFromEnv returns the pager named by $PAGER, DefaultPager when it is
+// unset, or "" when it is empty or "cat", which turn paging off as they do
+// for git.
+func PagerFromEnv() string {
+	pager, ok := os.LookupEnv("PAGER")
+	if !ok {
+		return DefaultPager
+	}
+	if pager = strings.TrimSpace(pager); pager == "cat" {
+		return ""
+	}
+	return pager
+}
+
+// SetPager pipes human output taller than the terminal through pager, a
+// shell command line. Output is written directly when pager is empty or
+// stdout is not a terminal.
+func (r *HumanRenderer) SetPager(pager string) {
+	r.pager = pager
+}
+
+// page writes out to stdout, through the pager when it does not fit on the
+// screen. A pager that fails to start falls back to writing out directly.
+func (r *HumanRenderer) page(out string) {
+	fd := int(os.Stdout.Fd())
+	if r.pager != "" && term.IsTerminal(fd) {
+		if _, height, err := term.GetSize(fd); err == nil && strings.Count(out, "\n") >= height {
+			if runPager(r.pager, out, os.Stdout) == nil {
+				return
+			}
+		}
+	}
+	_, _ = io.WriteString(os.Stdout, out)
+}
+
+// runPager runs pager through the shell with out on its stdin. Like git it
+// sets LESS=FRX when LESS is unset, so less keeps colors and leaves the
+// output on screen when it exits.
+func runPager(pager, out string, w io.Writer) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", pager)
+	} else {
+		cmd = exec.Command("sh", "-c", pager)
+	}
+	cmd.Stdin = strings.NewReader(out)
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+	if _, ok := os.LookupEnv("LESS"); !ok {
+		cmd.Env = append(cmd.Env, "LESS=FRX")
+	}
+	return cmd.Run()
+}
@@ -0,0 +1,34 @@
+package cliout
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestPagerFromEnv(t *testing.T) {
+	t.Setenv("PAGER", "more -s")
+	if got := PagerFromEnv(); got != "more -s" {
+		t.Fatalf("expected $PAGER to be used, got %q", got)
+	}
+	for _, off := range []string{"", "cat"} {
+		t.Setenv("PAGER", off)
+		if got := PagerFromEnv(); got != "" {
+			t.Fatalf("expected PAGER=%q to disable paging, got %q", off, got)
+		}
+	}
+}
+
+func TestRunPagerPipesOutput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pager command uses sh syntax")
+	}
+	t.Setenv("LESS", "")
+	var b strings.Builder
+	if err := runPager(`tr a-z A-Z; printf '%s' "${LESS-unset}"`, "line one\nline two\n", &b); err != nil {
+		t.Fatalf("runPager: %v", err)
+	}
+	if b.String() != "LINE ONE\nLINE TWO\n" {
+		t.Fatalf("unexpected pager output: %q", b.String())
+	}
+}
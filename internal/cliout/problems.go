@@ -0,0 +1,71 @@
+package cliout
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ProblemsRenderer prints only warnings and errors, one per line as
+// file:line: level: message, the shape IDE problem matchers parse. Findings
+// carry their own location; events and errors without one are reported
+// against DefaultFile, line 1.
+type ProblemsRenderer struct {
+	DefaultFile string
+	out         io.Writer
+	printed     int
+}
+
+func NewProblemsRenderer(defaultFile string) *ProblemsRenderer {
+	return &ProblemsRenderer{DefaultFile: defaultFile}
+}
+
+func (r *ProblemsRenderer) RenderHuman(payload HumanPayload) {
+	for _, f := range payload.Findings {
+		r.print(f)
+	}
+	for _, e := range payload.Events {
+		if e.Level == "warn" || e.Level == "error" {
+			r.print(Finding{Level: e.Level, Message: e.Message})
+		}
+	}
+}
+
+// RenderJSON prints nothing; commands only render JSON in --json mode.
+func (r *ProblemsRenderer) RenderJSON(command string, payload any) error {
+	return nil
+}
+
+// RenderError reports err unless problems were already printed, in which
+// case err only summarizes them.
+func (r *ProblemsRenderer) RenderError(command string, err error) {
+	if r.printed > 0 {
+		return
+	}
+	r.print(Finding{Level: "error", Message: err.Error()})
+}
+
+func (r *ProblemsRenderer) print(f Finding) {
+	file, line := f.File, f.Line
+	if file == "" {
+		file = r.DefaultFile
+	}
+	if line < 1 {
+		line = 1
+	}
+	level := "warning"
+	if f.Level == "error" {
+		level = "error"
+	}
+	msg := strings.Join(strings.Fields(f.Message), " ")
+	if f.RuleID != "" {
+		msg += " [" + f.RuleID + "]"
+	}
+	out := r.out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "%s:%d: %s: %s\n", file, line, level, msg)
+	r.printed++
+}
@@ -0,0 +1,33 @@
+package cliout
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestProblemsRenderer(t *testing.T) {
+	var buf bytes.Buffer
+	r := &ProblemsRenderer{DefaultFile: "rulepack.json", out: &buf}
+	r.RenderHuman(HumanPayload{
+		Events: []Event{{Level: "info", Message: "skipped"}, {Level: "warn", Message: "overwrites\nfile"}},
+		Findings: []Finding{
+			{RuleID: "banned-term", Level: "error", Message: "banned term", File: "packs/a/modules/a.md", Line: 3},
+			{Level: "warn", Message: "no location"},
+		},
+	})
+	r.RenderError("lint", errors.New("lint found 1 error(s)"))
+	want := "packs/a/modules/a.md:3: error: banned term [banned-term]\n" +
+		"rulepack.json:1: warning: no location\n" +
+		"rulepack.json:1: warning: overwrites file\n"
+	if buf.String() != want {
+		t.Fatalf("unexpected output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	r = &ProblemsRenderer{DefaultFile: "rulepack.json", out: &buf}
+	r.RenderError("build", errors.New("lockfile mismatch"))
+	if buf.String() != "rulepack.json:1: error: lockfile mismatch\n" {
+		t.Fatalf("expected unlocated error, got %q", buf.String())
+	}
+}
@@ -18,8 +18,13 @@ type HumanPayload struct {
 	Title   string
 	Tables  []Table
 	Events  []Event
+	// Diffs are printed after Tables by HumanRenderer only.
+	Diffs   []Diff
 	Summary map[string]string
 	Done    string
+	// Findings are located warnings and errors, printed only by
+	// ProblemsRenderer; the other renderers show them through Tables.
+	Findings []Finding `json:"-"`
 }
 
 type Renderer interface {
@@ -0,0 +1,133 @@
+package cliout
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// SARIFRule describes a kind of finding for the SARIF tool driver.
+type SARIFRule struct {
+	ID          string
+	Description string
+}
+
+// Finding is one result for SARIF output. Level is error, warn, or anything
+// else for a note.
+type Finding struct {
+	RuleID  string
+	Level   string
+	Message string
+	// File is the project-relative file the finding is reported against.
+	File string
+	// Line is the 1-based line in File, or 0 when unknown.
+	Line int
+	// Logical names the entity within File the finding is about, such as a
+	// module ID.
+	Logical string
+}
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name    string            `json:"name"`
+	Version string            `json:"version,omitempty"`
+	Rules   []sarifDescriptor `json:"rules"`
+}
+
+type sarifDescriptor struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation *sarifPhysical `json:"physicalLocation,omitempty"`
+	LogicalLocations []sarifLogical `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysical struct {
+	ArtifactLocation sarifArtifact `json:"artifactLocation"`
+	Region           *sarifRegion  `json:"region,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+type sarifArtifact struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogical struct {
+	Name string `json:"name"`
+}
+
+// WriteSARIF writes findings as a SARIF 2.1.0 log with a single run of the
+// named tool.
+func WriteSARIF(w io.Writer, tool, version string, rules []SARIFRule, findings []Finding) error {
+	run := sarifRun{
+		Tool:    sarifTool{Driver: sarifDriver{Name: tool, Version: version, Rules: make([]sarifDescriptor, 0, len(rules))}},
+		Results: make([]sarifResult, 0, len(findings)),
+	}
+	for _, rule := range rules {
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifDescriptor{ID: rule.ID, ShortDescription: sarifMessage{Text: rule.Description}})
+	}
+	for _, f := range findings {
+		result := sarifResult{RuleID: f.RuleID, Level: sarifLevel(f.Level), Message: sarifMessage{Text: f.Message}}
+		if f.File != "" || f.Logical != "" {
+			loc := sarifLocation{}
+			if f.File != "" {
+				loc.PhysicalLocation = &sarifPhysical{ArtifactLocation: sarifArtifact{URI: f.File}}
+				if f.Line > 0 {
+					loc.PhysicalLocation.Region = &sarifRegion{StartLine: f.Line}
+				}
+			}
+			if f.Logical != "" {
+				loc.LogicalLocations = []sarifLogical{{Name: f.Logical}}
+			}
+			result.Locations = []sarifLocation{loc}
+		}
+		run.Results = append(run.Results, result)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs:    []sarifRun{run},
+	})
+}
+
+func sarifLevel(level string) string {
+	switch level {
+	case "error":
+		return "error"
+	case "warn":
+		return "warning"
+	default:
+		return "note"
+	}
+}
@@ -0,0 +1,40 @@
+package cliout
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	rules := []SARIFRule{{ID: "r1", Description: "first"}}
+	findings := []Finding{
+		{RuleID: "r1", Level: "warn", Message: "m", File: "rulepack.json", Logical: "mod.a"},
+		{RuleID: "r1", Level: "info", Message: "n"},
+	}
+	if err := WriteSARIF(&buf, "rulepack", "1.0.0", rules, findings); err != nil {
+		t.Fatalf("WriteSARIF: %v", err)
+	}
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	run := log.Runs[0]
+	if run.Tool.Driver.Name != "rulepack" || len(run.Tool.Driver.Rules) != 1 || run.Tool.Driver.Rules[0].ShortDescription.Text != "first" {
+		t.Fatalf("unexpected driver: %+v", run.Tool.Driver)
+	}
+	if len(run.Results) != 2 || run.Results[0].Level != "warning" || run.Results[1].Level != "note" {
+		t.Fatalf("unexpected results: %+v", run.Results)
+	}
+	loc := run.Results[0].Locations[0]
+	if loc.PhysicalLocation.ArtifactLocation.URI != "rulepack.json" || loc.LogicalLocations[0].Name != "mod.a" {
+		t.Fatalf("unexpected location: %+v", loc)
+	}
+	if run.Results[1].Locations != nil {
+		t.Fatalf("expected no location for unlocated finding")
+	}
+}
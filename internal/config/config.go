@@ -4,23 +4,284 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
 )
 
 const (
 	RulesetFileName = "rulepack.json"
 	LockFileName    = "rulepack.lock.json"
+	OutputsFileName = ".rulepack/outputs.json"
+	IgnoreFileName  = ".rulepackignore"
+
+	// OverridesFileName and LocalOverridesFileName hold extra overrides
+	// merged on top of rulepack.json; the local file is meant to be
+	// gitignored for personal tweaks.
+	OverridesFileName      = "rulepack.overrides.json"
+	LocalOverridesFileName = "rulepack.overrides.local.json"
+
+	UserConfigFileName = "config.json"
 )
 
+// RulesetName returns the name of a named ruleset file, "frontend" for
+// rulepack.frontend.json or frontend.json, and "" for rulepack.json.
+func RulesetName(rulesetPath string) string {
+	name := strings.TrimSuffix(filepath.Base(rulesetPath), ".json")
+	if name == "rulepack" {
+		return ""
+	}
+	return strings.TrimPrefix(name, "rulepack.")
+}
+
+// NamedFile returns the file a named ruleset uses in place of base, one of
+// the file name constants: rulepack.<name>.lock.json for LockFileName and
+// .rulepack/outputs.<name>.json for OutputsFileName. Unnamed rulesets use
+// base itself.
+func NamedFile(name, base string) string {
+	if name == "" {
+		return base
+	}
+	if rest, ok := strings.CutPrefix(base, "rulepack."); ok {
+		return "rulepack." + name + "." + rest
+	}
+	ext := path.Ext(base)
+	return strings.TrimSuffix(base, ext) + "." + name + ext
+}
+
 type Ruleset struct {
 	SpecVersion  string                 `json:"specVersion"`
 	Name         string                 `json:"name"`
 	Dependencies []Dependency           `json:"dependencies,omitempty"`
 	Overrides    []Override             `json:"overrides,omitempty"`
 	Targets      map[string]TargetEntry `json:"targets,omitempty"`
+	Mirrors      map[string]string      `json:"mirrors,omitempty"`
+	Policy       *Policy                `json:"policy,omitempty"`
+	Normalize    *Normalize             `json:"normalize,omitempty"`
+	// Presets name target lists selectable with build --preset.
+	Presets map[string][]string `json:"presets,omitempty"`
+	Protect *Protect            `json:"protect,omitempty"`
+	// PriorityBands name inclusive priority ranges written "min-max", such
+	// as "safety": "0-99". Modules opt into a band with their band field.
+	PriorityBands map[string]string `json:"priorityBands,omitempty"`
+	Terminology   *Terminology      `json:"terminology,omitempty"`
+	// ProfileRegistry is the git URI of the store that org/name@version
+	// profile dependencies are published in.
+	ProfileRegistry string `json:"profileRegistry,omitempty"`
+	// Notify announces the dependency changes deps install and deps update
+	// write to the lockfile.
+	Notify *Notify `json:"notify,omitempty"`
+}
+
+// Notify names where dependency change payloads go. Either or both may be
+// set.
+type Notify struct {
+	// Webhook is an http(s) URL the payload is POSTed to as JSON.
+	Webhook string `json:"webhook,omitempty"`
+	// Command is run without a shell, with the payload on standard input.
+	Command []string `json:"command,omitempty"`
+	// Env names environment variables, such as a chat token, passed to
+	// Command on top of the minimal environment formatters get.
+	Env []string `json:"env,omitempty"`
+}
+
+// RemoteProfile is a profile dependency published in the profile registry,
+// written org/name@version.
+type RemoteProfile struct {
+	Org     string
+	Name    string
+	Version string
+}
+
+var remoteProfilePattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9_.-]*)/([A-Za-z0-9][A-Za-z0-9_.-]*)@([A-Za-z0-9][A-Za-z0-9_.+-]*)$`)
+
+// ParseRemoteProfile reports whether ref names a registry profile and, if
+// so, splits it. Saved profile IDs and aliases never contain both / and @.
+func ParseRemoteProfile(ref string) (RemoteProfile, bool) {
+	m := remoteProfilePattern.FindStringSubmatch(ref)
+	if m == nil {
+		return RemoteProfile{}, false
+	}
+	return RemoteProfile{Org: m[1], Name: m[2], Version: m[3]}, true
+}
+
+func (r RemoteProfile) String() string {
+	return r.Org + "/" + r.Name + "@" + r.Version
+}
+
+// Dir is the profile's directory inside the registry repository.
+func (r RemoteProfile) Dir() string {
+	return r.Org + "/" + r.Name + "/" + r.Version
+}
+
+// Terminology is the vocabulary lint enforces in module content. Terms match
+// case-insensitively as whole words.
+type Terminology struct {
+	// Banned terms are errors wherever they appear.
+	Banned []string `json:"banned,omitempty"`
+	// Preferred maps a discouraged term to its replacement; uses are
+	// warnings.
+	Preferred map[string]string `json:"preferred,omitempty"`
+}
+
+// PriorityBand is a parsed entry of Ruleset.PriorityBands.
+type PriorityBand struct {
+	Name string
+	Min  int
+	Max  int
+}
+
+// Bands parses PriorityBands, ordered by Min. Bands may not overlap, so
+// sorting by priority keeps every band's modules together and in band order.
+func (r Ruleset) Bands() ([]PriorityBand, error) {
+	names := make([]string, 0, len(r.PriorityBands))
+	for name := range r.PriorityBands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bands := make([]PriorityBand, 0, len(names))
+	for _, name := range names {
+		band, err := parsePriorityBand(name, r.PriorityBands[name])
+		if err != nil {
+			return nil, err
+		}
+		bands = append(bands, band)
+	}
+	sort.Slice(bands, func(i, j int) bool { return bands[i].Min < bands[j].Min })
+	for i := 1; i < len(bands); i++ {
+		if bands[i].Min <= bands[i-1].Max {
+			return nil, fmt.Errorf("priorityBands: %s overlaps %s", bands[i].Name, bands[i-1].Name)
+		}
+	}
+	return bands, nil
+}
+
+var priorityBandPattern = regexp.MustCompile(`^\s*(-?\d+)\s*-\s*(-?\d+)\s*$`)
+
+func parsePriorityBand(name, raw string) (PriorityBand, error) {
+	m := priorityBandPattern.FindStringSubmatch(raw)
+	if name == "" || m == nil {
+		return PriorityBand{}, fmt.Errorf("priorityBands.%s: %q must be min-max, e.g. 0-99", name, raw)
+	}
+	band := PriorityBand{Name: name}
+	band.Min, _ = strconv.Atoi(m[1])
+	band.Max, _ = strconv.Atoi(m[2])
+	if band.Min > band.Max {
+		return PriorityBand{}, fmt.Errorf("priorityBands.%s: min %d exceeds max %d", name, band.Min, band.Max)
+	}
+	return band, nil
+}
+
+// Protect lists output locations build must not write into, typically
+// directories owned by other tooling.
+type Protect struct {
+	// Paths are project-relative directories, files, or path.Match patterns;
+	// anything beneath a match is protected too.
+	Paths []string `json:"paths,omitempty"`
+	// GitIgnored refuses outputs that the project's .gitignore rules ignore.
+	GitIgnored bool `json:"gitIgnored,omitempty"`
+}
+
+// Match returns the protected entry covering outPath, if any. A nil Protect
+// protects nothing.
+func (p *Protect) Match(outPath string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+	outPath = path.Clean(filepath.ToSlash(outPath))
+	for _, raw := range p.Paths {
+		protected := path.Clean(filepath.ToSlash(strings.TrimSpace(raw)))
+		if outPath == protected || strings.HasPrefix(outPath, protected+"/") {
+			return raw, true
+		}
+		for candidate := outPath; candidate != "." && candidate != "/"; candidate = path.Dir(candidate) {
+			if matched, err := path.Match(protected, candidate); err == nil && matched {
+				return raw, true
+			}
+		}
+	}
+	return "", false
+}
+
+type Normalize struct {
+	Unicode string `json:"unicode,omitempty"`
+}
+
+const (
+	NewlineLF   = "lf"
+	NewlineCRLF = "crlf"
+
+	UnicodeNFC = "nfc"
+
+	LayoutPath      = "path"
+	LayoutNamespace = "namespace"
+
+	FallbackError   = "error"
+	FallbackSkip    = "skip"
+	FallbackSidecar = "sidecar"
+)
+
+type Policy struct {
+	Licenses *LicensePolicy `json:"licenses,omitempty"`
+	Limits   *Limits        `json:"limits,omitempty"`
+}
+
+// Limits bound what a dependency may contribute. Zero uses the default and a
+// negative value disables the limit.
+type Limits struct {
+	MaxModuleBytes          int64 `json:"maxModuleBytes,omitempty"`
+	MaxModulesPerDependency int   `json:"maxModulesPerDependency,omitempty"`
+	MaxOutputBytes          int64 `json:"maxOutputBytes,omitempty"`
+}
+
+const (
+	DefaultMaxModuleBytes          = 256 << 10
+	DefaultMaxModulesPerDependency = 500
+	DefaultMaxOutputBytes          = 2 << 20
+)
+
+// EffectiveLimits fills in defaults. In the result, zero means unlimited.
+func (p *Policy) EffectiveLimits() Limits {
+	var l Limits
+	if p != nil && p.Limits != nil {
+		l = *p.Limits
+	}
+	return Limits{
+		MaxModuleBytes:          effectiveLimit(l.MaxModuleBytes, DefaultMaxModuleBytes),
+		MaxModulesPerDependency: int(effectiveLimit(int64(l.MaxModulesPerDependency), DefaultMaxModulesPerDependency)),
+		MaxOutputBytes:          effectiveLimit(l.MaxOutputBytes, DefaultMaxOutputBytes),
+	}
+}
+
+func effectiveLimit(v int64, def int64) int64 {
+	switch {
+	case v < 0:
+		return 0
+	case v == 0:
+		return def
+	default:
+		return v
+	}
+}
+
+type LicensePolicy struct {
+	Allow        []string `json:"allow"`
+	AllowUnknown bool     `json:"allowUnknown,omitempty"`
 }
 
 type Dependency struct {
+	// Name optionally identifies the dependency in the lockfile, so its
+	// source can change without losing the lock entry.
+	Name    string `json:"name,omitempty"`
 	Source  string `json:"source"`
 	URI     string `json:"uri"`
 	Path    string `json:"path,omitempty"`
@@ -28,6 +289,101 @@ type Dependency struct {
 	Version string `json:"version,omitempty"`
 	Ref     string `json:"ref,omitempty"`
 	Export  string `json:"export,omitempty"`
+	// ExportAliases maps export names this project uses to the names the
+	// pack exports, so an upstream rename only needs a new alias.
+	ExportAliases map[string]string `json:"exportAliases,omitempty"`
+	// DefaultExport is the pack export selected when Export is unset, in
+	// place of the pack's own default.
+	DefaultExport string `json:"defaultExport,omitempty"`
+	// MaxAgeDays is the freshness SLA: the lock entry should be refreshed at
+	// least this often. Zero means no limit.
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+	// When limits the dependency to builds for a matching platform. The
+	// lock still resolves it everywhere.
+	When *When `json:"when,omitempty"`
+	// Pin lists module IDs whose content is locked by digest. Install fails
+	// when a pinned module changes until deps update accepts it.
+	Pin []string `json:"pin,omitempty"`
+	// Approvals records sign-off on locked content. --require-approved
+	// fails unless one covers the lock entry's content hash.
+	Approvals []Approval `json:"approvals,omitempty"`
+	// DisableModules drops modules whose ID matches one of these patterns
+	// from this dependency only, e.g. to let another dependency's module of
+	// the same ID win.
+	DisableModules []string `json:"disableModules,omitempty"`
+	// RenameModules maps IDs of modules this dependency provides to the IDs
+	// the project composes them under. It applies after DisableModules.
+	RenameModules map[string]string `json:"renameModules,omitempty"`
+}
+
+// Approval records that approvers signed off on one locked content hash of
+// a dependency.
+type Approval struct {
+	Hash      string   `json:"hash"`
+	Approvers []string `json:"approvers"`
+}
+
+// Approved reports whether an approval covers hash, a lock entry's
+// ApprovalHash.
+func (d Dependency) Approved(hash string) bool {
+	if hash == "" {
+		return false
+	}
+	for _, approval := range d.Approvals {
+		if approval.Hash == hash {
+			return true
+		}
+	}
+	return false
+}
+
+// PackExport returns the name of the export to select in the dependency's
+// pack: DefaultExport when Export is unset or "default", otherwise Export
+// after ExportAliases. An empty result selects the pack's default.
+func (d Dependency) PackExport() string {
+	if (d.Export == "" || d.Export == "default") && d.DefaultExport != "" {
+		return d.DefaultExport
+	}
+	if name, ok := d.ExportAliases[d.Export]; ok {
+		return name
+	}
+	return d.Export
+}
+
+// When restricts a module or dependency to build platforms, using Go's
+// GOOS and GOARCH names. Empty fields match anything.
+type When struct {
+	OS   string `json:"os,omitempty"`
+	Arch string `json:"arch,omitempty"`
+}
+
+var (
+	knownOS   = []string{"aix", "android", "darwin", "dragonfly", "freebsd", "illumos", "ios", "js", "linux", "netbsd", "openbsd", "plan9", "solaris", "wasip1", "windows"}
+	knownArch = []string{"386", "amd64", "arm", "arm64", "loong64", "mips", "mips64", "mips64le", "mipsle", "ppc64", "ppc64le", "riscv64", "s390x", "wasm"}
+)
+
+// Matches reports whether the condition holds for goos and goarch. A nil
+// When always matches.
+func (w *When) Matches(goos, goarch string) bool {
+	if w == nil {
+		return true
+	}
+	return (w.OS == "" || w.OS == goos) && (w.Arch == "" || w.Arch == goarch)
+}
+
+// Validate rejects platform names Go does not know, which are most likely
+// typos such as "win" or "x86_64".
+func (w *When) Validate() error {
+	if w == nil {
+		return nil
+	}
+	if w.OS != "" && !slices.Contains(knownOS, w.OS) {
+		return fmt.Errorf("when.os: unknown os %q (use a GOOS name such as linux, darwin, or windows)", w.OS)
+	}
+	if w.Arch != "" && !slices.Contains(knownArch, w.Arch) {
+		return fmt.Errorf("when.arch: unknown arch %q (use a GOARCH name such as amd64 or arm64)", w.Arch)
+	}
+	return nil
 }
 
 type Override struct {
@@ -36,18 +392,93 @@ type Override struct {
 }
 
 type TargetEntry struct {
-	OutDir    string `json:"outDir,omitempty"`
-	OutFile   string `json:"outFile,omitempty"`
-	PerModule bool   `json:"perModule,omitempty"`
-	Ext       string `json:"ext,omitempty"`
+	// Type selects the renderer; it defaults to the entry's key, so several
+	// entries can share one renderer under different names.
+	Type string `json:"type,omitempty"`
+	// Include limits the entry to modules whose ID matches one of these
+	// patterns. Empty means every module.
+	Include []string `json:"include,omitempty"`
+	// DisableModules drops modules whose ID matches one of these patterns
+	// from this entry only, after Include.
+	DisableModules []string `json:"disableModules,omitempty"`
+	OutDir         string   `json:"outDir,omitempty"`
+	OutFile        string   `json:"outFile,omitempty"`
+	PerModule      bool     `json:"perModule,omitempty"`
+	Ext            string   `json:"ext,omitempty"`
+	Newline        string   `json:"newline,omitempty"`
+	Layout         string   `json:"layout,omitempty"`
+	// Fallback and SidecarDir apply to cursor with perModule=false.
+	Fallback   string `json:"fallback,omitempty"`
+	SidecarDir string `json:"sidecarDir,omitempty"`
+	// ScopeByGlob (codex with perModule=false) also writes outFile's base name
+	// into each directory named by a module's glob apply rule.
+	ScopeByGlob bool `json:"scopeByGlob,omitempty"`
+	// Format is a formatter command run after rendering, with the target's
+	// output files appended as arguments, e.g. ["npx", "prettier", "--write"].
+	Format []string `json:"format,omitempty"`
+	// Template (custom only) is the path of a Go text/template file whose
+	// output build writes to OutFile.
+	Template string `json:"template,omitempty"`
+	// StampBuildID ends every output file with a footer naming the build that
+	// wrote it: the ruleset digest, the build time, and the rulepack version.
+	StampBuildID bool `json:"stampBuildID,omitempty"`
+	// Root, when set, prefixes relative output paths. Build sets it to stage
+	// writes; it is never read from rulepack.json.
+	Root string `json:"-"`
+	// RulesetDigest is the lockfile's rulesetDigest. Build sets it so every
+	// output names the composed ruleset it was rendered from.
+	RulesetDigest string `json:"-"`
+	// BuildID is the footer build sets for StampBuildID targets. It is left
+	// out of input hashes so stamping alone never forces a rebuild.
+	BuildID string `json:"-"`
+}
+
+// TargetKinds lists the renderer types a target entry may use.
+var TargetKinds = []string{"cursor", "copilot", "codex", "claude", "amazonq", "cline", "zed", "junie", "custom"}
+
+// Kind returns the renderer type of the entry stored under name.
+func (t TargetEntry) Kind(name string) string {
+	if t.Type != "" {
+		return t.Type
+	}
+	return name
+}
+
+// ExpandPaths resolves template placeholders such as {{.Env}} in the entry's
+// output paths from build variables. Referencing an unset variable is an error.
+func (t TargetEntry) ExpandPaths(vars map[string]string) (TargetEntry, error) {
+	for _, field := range []*string{&t.OutDir, &t.OutFile, &t.SidecarDir} {
+		if !strings.Contains(*field, "{{") {
+			continue
+		}
+		tmpl, err := template.New("path").Option("missingkey=error").Parse(*field)
+		if err != nil {
+			return t, fmt.Errorf("parse output path %q: %w", *field, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, vars); err != nil {
+			return t, fmt.Errorf("expand output path %q: %w", *field, err)
+		}
+		if err := validateOutputPath(b.String()); err != nil {
+			return t, fmt.Errorf("expand output path %q: %w", *field, err)
+		}
+		*field = b.String()
+	}
+	return t, nil
 }
 
 type Lockfile struct {
-	LockVersion string         `json:"lockVersion"`
-	Resolved    []LockedSource `json:"resolved"`
+	LockVersion string `json:"lockVersion"`
+	// RulesetDigest digests every module the resolved dependencies compose,
+	// so outputs can be matched against the lock they were built from.
+	RulesetDigest string         `json:"rulesetDigest,omitempty"`
+	Resolved      []LockedSource `json:"resolved"`
 }
 
 type LockedSource struct {
+	// Key is the Key of the dependency the entry locks. Entries are matched
+	// to dependencies by it, so reordering rulepack.json keeps them valid.
+	Key             string `json:"key,omitempty"`
 	Source          string `json:"source,omitempty"`
 	URI             string `json:"uri"`
 	Path            string `json:"path,omitempty"`
@@ -57,6 +488,168 @@ type LockedSource struct {
 	Commit          string `json:"commit"`
 	ContentHash     string `json:"contentHash,omitempty"`
 	Export          string `json:"export,omitempty"`
+	License         string `json:"license,omitempty"`
+	// ModuleCount is the number of modules the export selected at install.
+	ModuleCount int `json:"moduleCount,omitempty"`
+	// LockedAt is when install last changed this entry's resolution, in
+	// RFC 3339 UTC.
+	LockedAt string `json:"lockedAt,omitempty"`
+	// ProfileAlias and ProfileSources record where a saved profile came
+	// from, so a checkout without it can say how to get it back.
+	ProfileAlias   string           `json:"profileAlias,omitempty"`
+	ProfileSources []SourceSnapshot `json:"profileSources,omitempty"`
+	// ModulePins maps each module ID the dependency pins to its content
+	// digest.
+	ModulePins map[string]string `json:"modulePins,omitempty"`
+}
+
+// ApprovalHash is the hash an approval must name to cover the entry: its
+// contentHash, or for git entries, which record none, the commit.
+func (l LockedSource) ApprovalHash() string {
+	if l.ContentHash != "" {
+		return l.ContentHash
+	}
+	return l.Commit
+}
+
+// SourceSnapshot records one source a profile was built from and the
+// modules it contributed.
+type SourceSnapshot struct {
+	SourceType   string            `json:"sourceType"`
+	SourceRef    string            `json:"sourceRef"`
+	SourceExport string            `json:"sourceExport,omitempty"`
+	Provenance   map[string]string `json:"provenance,omitempty"`
+	ModuleIDs    []string          `json:"moduleIds,omitempty"`
+}
+
+// Key identifies the dependency independently of its position: its Name
+// when set, else its source, the URI, path, or profile as written, and its
+// export.
+func (d Dependency) Key() string {
+	if d.Name != "" {
+		return "name:" + d.Name
+	}
+	ref := d.URI
+	switch d.Source {
+	case "local":
+		ref = SlashPath(d.Path)
+	case "profile":
+		ref = d.Profile
+	}
+	return d.Source + ":" + ref + "#" + d.Export
+}
+
+// Align returns the lock entry of each of deps, in their order. Entries are
+// matched by Key; dependencies sharing a key take their entries in order.
+// Lockfiles written before keys were recorded are matched by position.
+// Unlocked dependencies and leftover entries are a mismatch.
+func (l Lockfile) Align(deps []Dependency) ([]LockedSource, error) {
+	keyed := true
+	for _, locked := range l.Resolved {
+		keyed = keyed && locked.Key != ""
+	}
+	if !keyed {
+		if len(deps) != len(l.Resolved) {
+			return nil, errors.New("lockfile mismatch: run rulepack deps install")
+		}
+		return slices.Clone(l.Resolved), nil
+	}
+	byKey := map[string][]LockedSource{}
+	for _, locked := range l.Resolved {
+		byKey[locked.Key] = append(byKey[locked.Key], locked)
+	}
+	out := make([]LockedSource, len(deps))
+	var missing []string
+	for i, dep := range deps {
+		entries := byKey[dep.Key()]
+		if len(entries) == 0 {
+			missing = append(missing, fmt.Sprintf("dependency %d (%s)", i+1, dep.Key()))
+			continue
+		}
+		out[i] = entries[0]
+		byKey[dep.Key()] = entries[1:]
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("lockfile mismatch: %s missing from lock; run rulepack deps install", strings.Join(missing, ", "))
+	}
+	var extra []string
+	for _, locked := range l.Resolved {
+		if len(byKey[locked.Key]) > 0 {
+			extra = append(extra, locked.Key)
+			byKey[locked.Key] = byKey[locked.Key][1:]
+		}
+	}
+	if len(extra) > 0 {
+		return nil, fmt.Errorf("lockfile mismatch: lock entries %s match no dependency; run rulepack deps install", strings.Join(extra, ", "))
+	}
+	return out, nil
+}
+
+// Orphans returns the indexes of the lock entries no dependency of deps
+// claims, such as those of dependencies removed from rulepack.json. Entries
+// are claimed by Key as in Align, so each dependency claims one entry.
+// Entries without a key cannot be attributed and are never orphans.
+func (l Lockfile) Orphans(deps []Dependency) []int {
+	claims := make(map[string]int, len(deps))
+	for _, dep := range deps {
+		claims[dep.Key()]++
+	}
+	var orphans []int
+	for i, locked := range l.Resolved {
+		if locked.Key == "" {
+			continue
+		}
+		if claims[locked.Key] > 0 {
+			claims[locked.Key]--
+			continue
+		}
+		orphans = append(orphans, i)
+	}
+	return orphans
+}
+
+// NormalizePaths rewrites local entries whose path or key uses backslashes,
+// as lockfiles written on Windows may, to the forward-slash form every OS
+// reads. It returns the indexes of the entries it changed.
+func (l *Lockfile) NormalizePaths() []int {
+	var changed []int
+	for i := range l.Resolved {
+		locked := &l.Resolved[i]
+		if locked.Source != "local" {
+			continue
+		}
+		slashed, key := SlashPath(locked.Path), locked.Key
+		if ref, ok := strings.CutPrefix(key, "local:"); ok {
+			if j := strings.LastIndex(ref, "#"); j >= 0 {
+				key = "local:" + SlashPath(ref[:j]) + ref[j:]
+			}
+		}
+		if slashed == locked.Path && key == locked.Key {
+			continue
+		}
+		locked.Path, locked.Key = slashed, key
+		changed = append(changed, i)
+	}
+	return changed
+}
+
+// SlashPath returns p cleaned and with forward slashes, whichever OS wrote
+// it. Lockfiles record paths in this form.
+func SlashPath(p string) string {
+	if p == "" {
+		return ""
+	}
+	return path.Clean(strings.ReplaceAll(p, `\`, "/"))
+}
+
+// AgeDays returns the whole days between LockedAt and now, or false when the
+// entry has no valid LockedAt.
+func (l LockedSource) AgeDays(now time.Time) (int, bool) {
+	lockedAt, err := time.Parse(time.RFC3339, l.LockedAt)
+	if err != nil {
+		return 0, false
+	}
+	return int(now.Sub(lockedAt).Hours() / 24), true
 }
 
 func DefaultRuleset(name string) Ruleset {
@@ -85,13 +678,18 @@ func DefaultRuleset(name string) Ruleset {
 }
 
 func LoadRuleset(path string) (Ruleset, error) {
-	var cfg Ruleset
 	bytes, err := os.ReadFile(path)
 	if err != nil {
-		return cfg, err
+		return Ruleset{}, err
 	}
-	if err := json.Unmarshal(bytes, &cfg); err != nil {
-		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	return ParseRuleset(bytes, path)
+}
+
+// ParseRuleset decodes and validates a ruleset read from name.
+func ParseRuleset(data []byte, name string) (Ruleset, error) {
+	var cfg Ruleset
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", name, err)
 	}
 	if cfg.SpecVersion == "" {
 		return cfg, errors.New("rulepack missing specVersion")
@@ -99,13 +697,109 @@ func LoadRuleset(path string) (Ruleset, error) {
 	if err := validateDependencies(cfg.Dependencies); err != nil {
 		return cfg, err
 	}
+	if cfg.ProfileRegistry == "" {
+		for i, dep := range cfg.Dependencies {
+			if _, remote := ParseRemoteProfile(dep.Profile); remote && dep.Source == "profile" {
+				return cfg, fmt.Errorf("dependency[%d]: remote profile %q requires profileRegistry", i, dep.Profile)
+			}
+		}
+	}
+	if err := validateMirrors(cfg.Mirrors); err != nil {
+		return cfg, err
+	}
+	if err := validateTargets(cfg); err != nil {
+		return cfg, err
+	}
+	if err := validatePresets(cfg); err != nil {
+		return cfg, err
+	}
+	if _, err := cfg.Bands(); err != nil {
+		return cfg, err
+	}
+	if err := validateProtect(cfg.Protect); err != nil {
+		return cfg, err
+	}
+	if err := validateTerminology(cfg.Terminology); err != nil {
+		return cfg, err
+	}
+	if err := validateNotify(cfg.Notify); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// OverrideFile is the format of OverridesFileName and LocalOverridesFileName.
+type OverrideFile struct {
+	Overrides []Override `json:"overrides"`
+}
+
+// LoadEffectiveRuleset loads the ruleset at path and appends the overrides
+// from the override files beside it, named after it for named rulesets,
+// shared file first, then the local one.
+// Later overrides for the same module ID win. Missing files are skipped.
+// Commands that write rulepack.json must use LoadRuleset instead so the
+// merged overrides are never saved back.
+func LoadEffectiveRuleset(path string) (Ruleset, error) {
+	cfg, err := LoadRuleset(path)
+	if err != nil {
+		return cfg, err
+	}
+	for _, file := range OverrideFiles(path) {
+		overrides, err := LoadOverrideFile(file)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return cfg, err
+		}
+		cfg.Overrides = append(cfg.Overrides, overrides...)
+	}
 	return cfg, nil
 }
 
+// OverrideFiles returns the paths of the overrides files the ruleset at path
+// reads, in the order they apply, whether or not they exist.
+func OverrideFiles(path string) []string {
+	dir, rulesetName := filepath.Dir(path), RulesetName(path)
+	return []string{
+		filepath.Join(dir, NamedFile(rulesetName, OverridesFileName)),
+		filepath.Join(dir, NamedFile(rulesetName, LocalOverridesFileName)),
+	}
+}
+
+// LoadOverrideFile reads the overrides of one overrides file.
+func LoadOverrideFile(path string) ([]Override, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var file OverrideFile
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", filepath.Base(path), err)
+	}
+	for i, ov := range file.Overrides {
+		if strings.TrimSpace(ov.ID) == "" {
+			return nil, fmt.Errorf("%s: overrides[%d] missing id", filepath.Base(path), i)
+		}
+	}
+	return file.Overrides, nil
+}
+
 func SaveRuleset(path string, cfg Ruleset) error {
 	return saveJSON(path, cfg)
 }
 
+// SaveOverrideFile writes overrides to the overrides file at path.
+func SaveOverrideFile(path string, overrides []Override) error {
+	if overrides == nil {
+		overrides = []Override{}
+	}
+	return saveJSON(path, OverrideFile{Overrides: overrides})
+}
+
 func LoadLockfile(path string) (Lockfile, error) {
 	var lock Lockfile
 	bytes, err := os.ReadFile(path)
@@ -127,20 +821,94 @@ func SaveLockfile(path string, lock Lockfile) error {
 	return saveJSON(path, lock)
 }
 
+// Outputs is the build manifest: the files each target last wrote and their
+// digests, so later commands can tell generated files from hand edits.
+type Outputs struct {
+	Targets map[string]TargetOutputs `json:"targets"`
+}
+
+type TargetOutputs struct {
+	// InputHash covers the target entry and its modules. A matching hash with
+	// unmodified files means the target is up to date.
+	InputHash string       `json:"inputHash"`
+	Files     []OutputFile `json:"files"`
+}
+
+type OutputFile struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// LoadOutputs reads the build manifest. A missing manifest is empty.
+func LoadOutputs(path string) (Outputs, error) {
+	out := Outputs{Targets: map[string]TargetOutputs{}}
+	bytes, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return out, nil
+	}
+	if err != nil {
+		return out, err
+	}
+	if err := json.Unmarshal(bytes, &out); err != nil {
+		return out, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if out.Targets == nil {
+		out.Targets = map[string]TargetOutputs{}
+	}
+	return out, nil
+}
+
+func SaveOutputs(path string, out Outputs) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return saveJSON(path, out)
+}
+
 func saveJSON(path string, value any) error {
-	bytes, err := json.MarshalIndent(value, "", "  ")
+	bytes, err := marshalJSON(value)
 	if err != nil {
 		return err
 	}
-	bytes = append(bytes, '\n')
 	return os.WriteFile(path, bytes, 0o644)
 }
 
+// FormatRuleset returns the canonical encoding of a project rulepack.json,
+// as SaveRuleset writes it. Unknown fields are an error rather than being
+// dropped.
+func FormatRuleset(data []byte) ([]byte, error) {
+	var cfg Ruleset
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", RulesetFileName, err)
+	}
+	return marshalJSON(cfg)
+}
+
+func marshalJSON(value any) ([]byte, error) {
+	bytes, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(bytes, '\n'), nil
+}
+
 func validateDependencies(deps []Dependency) error {
+	names := map[string]int{}
 	for i, dep := range deps {
 		if dep.Source == "" {
 			return fmt.Errorf("dependency[%d]: source is required", i)
 		}
+		if dep.Name != "" {
+			if strings.TrimSpace(dep.Name) != dep.Name {
+				return fmt.Errorf("dependency[%d]: name %q must not have surrounding spaces", i, dep.Name)
+			}
+			if prev, ok := names[dep.Name]; ok {
+				return fmt.Errorf("dependency[%d]: name %q is already used by dependency[%d]", i, dep.Name, prev)
+			}
+			names[dep.Name] = i
+		}
 		source := dep.Source
 		switch source {
 		case "git":
@@ -176,6 +944,438 @@ func validateDependencies(deps []Dependency) error {
 		default:
 			return fmt.Errorf("dependency[%d]: unsupported source %q", i, dep.Source)
 		}
+		if dep.MaxAgeDays < 0 {
+			return fmt.Errorf("dependency[%d]: maxAgeDays must not be negative", i)
+		}
+		if err := dep.When.Validate(); err != nil {
+			return fmt.Errorf("dependency[%d]: %w", i, err)
+		}
+		for _, id := range dep.Pin {
+			if strings.TrimSpace(id) == "" {
+				return fmt.Errorf("dependency[%d]: pin entries must be module ids", i)
+			}
+		}
+		aliases := make([]string, 0, len(dep.ExportAliases))
+		for name := range dep.ExportAliases {
+			aliases = append(aliases, name)
+		}
+		sort.Strings(aliases)
+		for _, name := range aliases {
+			switch {
+			case strings.TrimSpace(name) == "" || name == "default":
+				return fmt.Errorf("dependency[%d]: exportAliases cannot alias the default export; use defaultExport", i)
+			case strings.TrimSpace(dep.ExportAliases[name]) == "":
+				return fmt.Errorf("dependency[%d]: exportAliases[%q] requires an export name", i, name)
+			}
+		}
+		if dep.DefaultExport == "default" {
+			return fmt.Errorf("dependency[%d]: defaultExport %q is the pack's own default; remove it", i, dep.DefaultExport)
+		}
+		for _, pattern := range dep.DisableModules {
+			if strings.TrimSpace(pattern) == "" {
+				return fmt.Errorf("dependency[%d]: disableModules entries must be module id patterns", i)
+			}
+		}
+		renamed := make([]string, 0, len(dep.RenameModules))
+		for id := range dep.RenameModules {
+			renamed = append(renamed, id)
+		}
+		sort.Strings(renamed)
+		for _, id := range renamed {
+			switch to := dep.RenameModules[id]; {
+			case strings.TrimSpace(id) == "":
+				return fmt.Errorf("dependency[%d]: renameModules keys must be module ids", i)
+			case strings.TrimSpace(to) == "" || to == id:
+				return fmt.Errorf("dependency[%d]: renameModules[%q] requires a new module id", i, id)
+			}
+		}
+		for j, approval := range dep.Approvals {
+			if strings.TrimSpace(approval.Hash) == "" {
+				return fmt.Errorf("dependency[%d]: approvals[%d] requires hash", i, j)
+			}
+			if len(approval.Approvers) == 0 {
+				return fmt.Errorf("dependency[%d]: approvals[%d] requires at least one approver", i, j)
+			}
+		}
 	}
 	return nil
 }
+
+// Allows reports whether an SPDX license expression satisfies the policy.
+// AND binds tighter than OR, as in SPDX: every AND term must be allowed, and
+// an OR needs one allowed side. Operators are case-insensitive. A license
+// with a WITH exception is allowed when the license itself is, or when the
+// policy lists the whole "license WITH exception" term. Malformed
+// expressions are not allowed.
+func (p *LicensePolicy) Allows(license string) bool {
+	if p == nil {
+		return true
+	}
+	tokens := licenseTokens(license)
+	if len(tokens) == 0 {
+		return p.AllowUnknown
+	}
+	allowed := make(map[string]struct{}, len(p.Allow))
+	for _, id := range p.Allow {
+		allowed[strings.Join(licenseTokens(strings.ToLower(id)), " ")] = struct{}{}
+	}
+	e := licenseEval{tokens: tokens, allowed: allowed}
+	ok, valid := e.or()
+	return valid && e.pos == len(tokens) && ok
+}
+
+// licenseTokens splits an SPDX expression into lowercase identifiers,
+// operators, and parentheses.
+func licenseTokens(expr string) []string {
+	expr = strings.NewReplacer("(", " ( ", ")", " ) ").Replace(strings.ToLower(expr))
+	return strings.Fields(expr)
+}
+
+// licenseEval evaluates a tokenized SPDX expression against an allow set.
+// Each method returns whether its part is allowed and whether it parsed.
+type licenseEval struct {
+	tokens  []string
+	pos     int
+	allowed map[string]struct{}
+}
+
+func (e *licenseEval) peek() string {
+	if e.pos < len(e.tokens) {
+		return e.tokens[e.pos]
+	}
+	return ""
+}
+
+func (e *licenseEval) or() (bool, bool) {
+	ok, valid := e.and()
+	for valid && e.peek() == "or" {
+		e.pos++
+		var right bool
+		right, valid = e.and()
+		ok = ok || right
+	}
+	return ok, valid
+}
+
+func (e *licenseEval) and() (bool, bool) {
+	ok, valid := e.term()
+	for valid && e.peek() == "and" {
+		e.pos++
+		var right bool
+		right, valid = e.term()
+		ok = ok && right
+	}
+	return ok, valid
+}
+
+func (e *licenseEval) term() (bool, bool) {
+	switch tok := e.peek(); tok {
+	case "(":
+		e.pos++
+		ok, valid := e.or()
+		if !valid || e.peek() != ")" {
+			return false, false
+		}
+		e.pos++
+		return ok, true
+	case "", ")", "and", "or", "with":
+		return false, false
+	default:
+		e.pos++
+		_, ok := e.allowed[tok]
+		if e.peek() != "with" {
+			return ok, true
+		}
+		e.pos++
+		exception := e.peek()
+		switch exception {
+		case "", "(", ")", "and", "or", "with":
+			return false, false
+		}
+		e.pos++
+		if _, whole := e.allowed[tok+" with "+exception]; whole {
+			ok = true
+		}
+		return ok, true
+	}
+}
+
+// validateOutputPath requires an output path to stay inside the project, so
+// build can stage it and record it in the outputs manifest.
+func validateOutputPath(p string) error {
+	if p == "" {
+		return nil
+	}
+	slashed := strings.ReplaceAll(p, `\`, "/")
+	if filepath.IsAbs(p) || path.IsAbs(slashed) || filepath.VolumeName(p) != "" {
+		return fmt.Errorf("%q must be relative to the project", p)
+	}
+	if cleaned := path.Clean(slashed); cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return fmt.Errorf("%q resolves outside the project", p)
+	}
+	return nil
+}
+
+func validateTargets(cfg Ruleset) error {
+	for name, target := range cfg.Targets {
+		kind := target.Kind(name)
+		if target.Type != "" && !slices.Contains(TargetKinds, target.Type) {
+			return fmt.Errorf("targets.%s: unsupported type %q (use %s)", name, target.Type, strings.Join(TargetKinds, ", "))
+		}
+		switch target.Newline {
+		case "", NewlineLF, NewlineCRLF:
+		default:
+			return fmt.Errorf("targets.%s: unsupported newline %q (use lf or crlf)", name, target.Newline)
+		}
+		switch target.Layout {
+		case "", LayoutPath:
+		case LayoutNamespace:
+			if kind != "cursor" {
+				return fmt.Errorf("targets.%s: layout %q is only supported by the cursor target", name, target.Layout)
+			}
+		default:
+			return fmt.Errorf("targets.%s: unsupported layout %q (use path or namespace)", name, target.Layout)
+		}
+		switch target.Fallback {
+		case "", FallbackError:
+		case FallbackSkip, FallbackSidecar:
+			if kind != "cursor" {
+				return fmt.Errorf("targets.%s: fallback %q is only supported by the cursor target", name, target.Fallback)
+			}
+		default:
+			return fmt.Errorf("targets.%s: unsupported fallback %q (use error, skip, or sidecar)", name, target.Fallback)
+		}
+		if len(target.Format) > 0 && strings.TrimSpace(target.Format[0]) == "" {
+			return fmt.Errorf("targets.%s: format command must not be empty", name)
+		}
+		for _, out := range []struct{ field, value string }{{"outDir", target.OutDir}, {"outFile", target.OutFile}, {"sidecarDir", target.SidecarDir}} {
+			if err := validateOutputPath(out.value); err != nil {
+				return fmt.Errorf("targets.%s: %s %w", name, out.field, err)
+			}
+		}
+		if target.ScopeByGlob && (kind != "codex" || target.PerModule) {
+			return fmt.Errorf("targets.%s: scopeByGlob is only supported by the codex target with perModule=false", name)
+		}
+		if kind == "copilot" && target.Ext != "" {
+			return fmt.Errorf("targets.%s: copilot target does not support ext; instructions files always end in .instructions.md", name)
+		}
+		if target.Template != "" && kind != "custom" {
+			return fmt.Errorf("targets.%s: template is only supported by the custom target", name)
+		}
+		if kind == "custom" {
+			switch {
+			case strings.TrimSpace(target.Template) == "":
+				return fmt.Errorf("targets.%s: custom target requires template", name)
+			case target.OutFile == "":
+				return fmt.Errorf("targets.%s: custom target requires outFile", name)
+			case target.PerModule || target.OutDir != "":
+				return fmt.Errorf("targets.%s: custom target writes only outFile; remove perModule and outDir", name)
+			}
+		}
+	}
+	if cfg.Normalize != nil {
+		switch cfg.Normalize.Unicode {
+		case "", UnicodeNFC:
+		default:
+			return fmt.Errorf("normalize: unsupported unicode form %q (use nfc)", cfg.Normalize.Unicode)
+		}
+	}
+	return nil
+}
+
+func validatePresets(cfg Ruleset) error {
+	for name, targets := range cfg.Presets {
+		if name == "" {
+			return errors.New("presets: name must not be empty")
+		}
+		if len(targets) == 0 {
+			return fmt.Errorf("presets.%s: must list at least one target", name)
+		}
+		for _, target := range targets {
+			if _, ok := cfg.Targets[target]; !ok {
+				return fmt.Errorf("presets.%s: target %q not configured", name, target)
+			}
+		}
+	}
+	return nil
+}
+
+func validateProtect(p *Protect) error {
+	if p == nil {
+		return nil
+	}
+	for i, raw := range p.Paths {
+		if strings.TrimSpace(raw) == "" {
+			return fmt.Errorf("protect.paths[%d]: must not be empty", i)
+		}
+		if _, err := path.Match(filepath.ToSlash(raw), ""); err != nil {
+			return fmt.Errorf("protect.paths[%d]: invalid pattern %q: %w", i, raw, err)
+		}
+	}
+	return nil
+}
+
+func validateTerminology(t *Terminology) error {
+	if t == nil {
+		return nil
+	}
+	for i, term := range t.Banned {
+		if strings.TrimSpace(term) == "" {
+			return fmt.Errorf("terminology.banned[%d]: term must not be empty", i)
+		}
+	}
+	for term, preferred := range t.Preferred {
+		if strings.TrimSpace(term) == "" {
+			return errors.New("terminology.preferred: term must not be empty")
+		}
+		if strings.TrimSpace(preferred) == "" {
+			return fmt.Errorf("terminology.preferred.%s: replacement must not be empty", term)
+		}
+	}
+	return nil
+}
+
+func validateNotify(n *Notify) error {
+	if n == nil {
+		return nil
+	}
+	if n.Webhook != "" {
+		u, err := url.Parse(n.Webhook)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("notify.webhook: %q is not an http(s) URL", n.Webhook)
+		}
+	}
+	if len(n.Command) > 0 && strings.TrimSpace(n.Command[0]) == "" {
+		return errors.New("notify.command: program must not be empty")
+	}
+	for _, name := range n.Env {
+		if name == "" || strings.ContainsAny(name, "= ") {
+			return fmt.Errorf("notify.env: %q is not an environment variable name", name)
+		}
+	}
+	return nil
+}
+
+func validateMirrors(mirrors map[string]string) error {
+	for prefix, mirror := range mirrors {
+		if prefix == "" {
+			return errors.New("mirrors: source prefix must not be empty")
+		}
+		if mirror == "" {
+			return fmt.Errorf("mirrors[%q]: mirror must not be empty", prefix)
+		}
+	}
+	return nil
+}
+
+type UserConfig struct {
+	Auth    AuthConfig        `json:"auth,omitempty"`
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+	// Aliases maps a command name to the rulepack command line it stands
+	// for; see AliasSteps.
+	Aliases map[string]string `json:"aliases,omitempty"`
+}
+
+// AliasSteps splits an alias command line such as "deps install && build"
+// into the rulepack commands it runs, in order. Arguments are separated by
+// whitespace, without quoting; a leading "rulepack" on a step is dropped.
+func AliasSteps(cmdline string) ([][]string, error) {
+	var steps [][]string
+	for _, part := range strings.Split(cmdline, "&&") {
+		step := strings.Fields(part)
+		if len(step) > 0 && step[0] == "rulepack" {
+			step = step[1:]
+		}
+		if len(step) == 0 {
+			return nil, fmt.Errorf("empty command in %q", cmdline)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func validateAliases(aliases map[string]string) error {
+	for name, cmdline := range aliases {
+		if name == "" || strings.HasPrefix(name, "-") || strings.ContainsFunc(name, unicode.IsSpace) {
+			return fmt.Errorf("aliases: invalid alias name %q", name)
+		}
+		if _, err := AliasSteps(cmdline); err != nil {
+			return fmt.Errorf("aliases[%q]: %w", name, err)
+		}
+	}
+	return nil
+}
+
+type AuthConfig struct {
+	Hosts map[string]HostCredential `json:"hosts,omitempty"`
+}
+
+type HostCredential struct {
+	Kind       string               `json:"kind,omitempty"`
+	Username   string               `json:"username,omitempty"`
+	Storage    string               `json:"storage"`
+	Salt       string               `json:"salt,omitempty"`
+	Nonce      string               `json:"nonce,omitempty"`
+	Ciphertext string               `json:"ciphertext,omitempty"`
+	TokenEnv   string               `json:"tokenEnv,omitempty"`
+	GitHubApp  *GitHubAppCredential `json:"githubApp,omitempty"`
+	UpdatedAt  string               `json:"updatedAt,omitempty"`
+}
+
+type GitHubAppCredential struct {
+	AppID          string   `json:"appId"`
+	InstallationID string   `json:"installationId"`
+	PrivateKeyPath string   `json:"privateKeyPath,omitempty"`
+	PrivateKeyEnv  string   `json:"privateKeyEnv,omitempty"`
+	APIURL         string   `json:"apiUrl,omitempty"`
+	Repositories   []string `json:"repositories,omitempty"`
+}
+
+func UserConfigPath() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".rulepack", UserConfigFileName), nil
+}
+
+func LoadUserConfig() (UserConfig, error) {
+	var cfg UserConfig
+	path, err := UserConfigPath()
+	if err != nil {
+		return cfg, err
+	}
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	if err := json.Unmarshal(bytes, &cfg); err != nil {
+		return cfg, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if err := validateMirrors(cfg.Mirrors); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateAliases(cfg.Aliases); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func SaveUserConfig(cfg UserConfig) error {
+	path, err := UserConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	bytes, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	bytes = append(bytes, '\n')
+	return os.WriteFile(path, bytes, 0o600)
+}
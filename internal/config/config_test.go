@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -70,6 +71,69 @@ func TestLoadRulesetDependencyValidation(t *testing.T) {
 			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"http","uri":"https://example.com/a.git"}]}`,
 			wantErr: "unsupported source",
 		},
+		{
+			name: "valid when condition",
+			json: `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","when":{"os":"windows","arch":"amd64"}}]}`,
+		},
+		{
+			name:    "unknown when os",
+			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","when":{"os":"win"}}]}`,
+			wantErr: `dependency[0]: when.os: unknown os "win"`,
+		},
+		{
+			name: "valid approval",
+			json: `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","approvals":[{"hash":"sha256:abc","approvers":["@org/governance"]}]}]}`,
+		},
+		{
+			name:    "approval without approvers",
+			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","approvals":[{"hash":"sha256:abc"}]}]}`,
+			wantErr: "dependency[0]: approvals[0] requires at least one approver",
+		},
+		{
+			name:    "export alias for default",
+			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","exportAliases":{"default":"core"}}]}`,
+			wantErr: "dependency[0]: exportAliases cannot alias the default export; use defaultExport",
+		},
+		{
+			name:    "export alias without target",
+			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","exportAliases":{"python":""}}]}`,
+			wantErr: `dependency[0]: exportAliases["python"] requires an export name`,
+		},
+		{
+			name:    "rename module to itself",
+			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","renameModules":{"a.b":"a.b"}}]}`,
+			wantErr: `dependency[0]: renameModules["a.b"] requires a new module id`,
+		},
+		{
+			name:    "empty disabled module",
+			json:    `{"specVersion":"0.1","name":"x","dependencies":[{"source":"local","path":"../rules","disableModules":[" "]}]}`,
+			wantErr: "dependency[0]: disableModules entries must be module id patterns",
+		},
+		{
+			name:    "notify webhook must be http",
+			json:    `{"specVersion":"0.1","name":"x","notify":{"webhook":"hooks.slack.com/x"}}`,
+			wantErr: `notify.webhook: "hooks.slack.com/x" is not an http(s) URL`,
+		},
+		{
+			name:    "absolute output path",
+			json:    `{"specVersion":"0.1","name":"x","targets":{"codex":{"outFile":"/tmp/abs/AGENTS.md"}}}`,
+			wantErr: `targets.codex: outFile "/tmp/abs/AGENTS.md" must be relative to the project`,
+		},
+		{
+			name:    "output path outside the project",
+			json:    `{"specVersion":"0.1","name":"x","targets":{"zed":{"outFile":"docs/../../up.rules"}}}`,
+			wantErr: `targets.zed: outFile "docs/../../up.rules" resolves outside the project`,
+		},
+		{
+			name:    "notify env must name variables",
+			json:    `{"specVersion":"0.1","name":"x","notify":{"command":["notify"],"env":["SLACK_TOKEN=x"]}}`,
+			wantErr: `notify.env: "SLACK_TOKEN=x" is not an environment variable name`,
+		},
+		{
+			name:    "empty terminology replacement",
+			json:    `{"specVersion":"0.1","name":"x","terminology":{"preferred":{"whitelist":""}}}`,
+			wantErr: "terminology.preferred.whitelist: replacement must not be empty",
+		},
 	}
 
 	for _, tt := range tests {
@@ -102,6 +166,99 @@ func TestLoadLockfileRejectsMissingSource(t *testing.T) {
 	}
 }
 
+func TestLockfileAlignMatchesByKey(t *testing.T) {
+	deps := []Dependency{
+		{Source: "local", Path: "./packs/b/", Export: "default"},
+		{Source: "git", URI: "https://example.com/a.git"},
+		{Source: "git", URI: "https://example.com/a.git", Export: "python"},
+	}
+	lock := Lockfile{Resolved: []LockedSource{
+		{Key: "git:https://example.com/a.git#python", Source: "git", Commit: "c2"},
+		{Key: "git:https://example.com/a.git#", Source: "git", Commit: "c1"},
+		{Key: "local:packs/b#default", Source: "local", Commit: "local"},
+	}}
+	aligned, err := lock.Align(deps)
+	if err != nil {
+		t.Fatalf("Align: %v", err)
+	}
+	if got := []string{aligned[0].Commit, aligned[1].Commit, aligned[2].Commit}; !reflect.DeepEqual(got, []string{"local", "c1", "c2"}) {
+		t.Fatalf("unexpected alignment %v", got)
+	}
+
+	legacy := Lockfile{Resolved: []LockedSource{{Source: "git", Commit: "c1"}, {Source: "git", Commit: "c2"}, {Source: "local"}}}
+	if aligned, err := legacy.Align(deps); err != nil || aligned[1].Commit != "c2" {
+		t.Fatalf("expected keyless lock to align by position, got %v, %v", aligned, err)
+	}
+
+	deps[2].Export = "go"
+	if _, err := lock.Align(deps); err == nil || !strings.Contains(err.Error(), "dependency 3 (git:https://example.com/a.git#go) missing from lock") {
+		t.Fatalf("expected unlocked dependency error, got %v", err)
+	}
+	if _, err := lock.Align(deps[:2]); err == nil || !strings.Contains(err.Error(), "lock entries git:https://example.com/a.git#python match no dependency") {
+		t.Fatalf("expected leftover entry to mismatch, got %v", err)
+	}
+}
+
+func TestLockfileOrphans(t *testing.T) {
+	deps := []Dependency{
+		{Source: "git", URI: "https://example.com/a.git"},
+		{Source: "local", Path: "packs/b", Export: "default"},
+	}
+	lock := Lockfile{Resolved: []LockedSource{
+		{Key: "git:https://example.com/a.git#", Source: "git", Commit: "c1"},
+		{Key: "git:https://example.com/gone.git#", Source: "git", Commit: "c2"},
+		{Key: "local:packs/b#default", Source: "local"},
+		{Key: "git:https://example.com/a.git#", Source: "git", Commit: "c3"},
+		{Source: "git", Commit: "c4"},
+	}}
+	if got := lock.Orphans(deps); !reflect.DeepEqual(got, []int{1, 3}) {
+		t.Fatalf("expected entries 1 and 3 orphaned, got %v", got)
+	}
+	if got := lock.Orphans(append(deps, deps[0])); !reflect.DeepEqual(got, []int{1}) {
+		t.Fatalf("expected a repeated dependency to claim its second entry, got %v", got)
+	}
+}
+
+func TestLockfileNormalizePathsRewritesWindowsSeparators(t *testing.T) {
+	dep := Dependency{Source: "local", Path: `..\packs\b\`, Export: "default"}
+	if got := dep.Key(); got != "local:../packs/b#default" {
+		t.Fatalf("expected slash key for backslash path, got %q", got)
+	}
+	lock := Lockfile{Resolved: []LockedSource{
+		{Key: "git:https://example.com/a.git#", Source: "git", Commit: "c1"},
+		{Key: `local:..\packs\b#default`, Source: "local", Path: `..\packs\b`, Commit: "local"},
+		{Key: "local:packs/c#default", Source: "local", Path: "packs/c", Commit: "local"},
+	}}
+	if changed := lock.NormalizePaths(); !reflect.DeepEqual(changed, []int{1}) {
+		t.Fatalf("expected only entry 1 to change, got %v", changed)
+	}
+	if lock.Resolved[1].Path != "../packs/b" || lock.Resolved[1].Key != "local:../packs/b#default" {
+		t.Fatalf("unexpected normalized entry %#v", lock.Resolved[1])
+	}
+	if _, err := lock.Align([]Dependency{{Source: "git", URI: "https://example.com/a.git"}, dep, {Source: "local", Path: "packs/c", Export: "default"}}); err != nil {
+		t.Fatalf("expected normalized lock to align: %v", err)
+	}
+	if changed := lock.NormalizePaths(); len(changed) != 0 {
+		t.Fatalf("expected normalizing twice to change nothing, got %v", changed)
+	}
+}
+
+func TestNamedFileDerivesFromRulesetName(t *testing.T) {
+	cases := []struct {
+		ruleset, base, want string
+	}{
+		{"rulepack.json", LockFileName, "rulepack.lock.json"},
+		{"rulepack.frontend.json", LockFileName, "rulepack.frontend.lock.json"},
+		{"frontend.json", OutputsFileName, ".rulepack/outputs.frontend.json"},
+		{"svc/rulepack.api.json", LocalOverridesFileName, "rulepack.api.overrides.local.json"},
+	}
+	for _, c := range cases {
+		if got := NamedFile(RulesetName(c.ruleset), c.base); got != c.want {
+			t.Fatalf("NamedFile(%q, %q) = %q, want %q", c.ruleset, c.base, got, c.want)
+		}
+	}
+}
+
 func TestDefaultRulesetIncludesClaudeTarget(t *testing.T) {
 	cfg := DefaultRuleset("demo")
 	claude, ok := cfg.Targets["claude"]
@@ -128,3 +285,231 @@ func writeTempFile(t *testing.T, name, content string) string {
 	}
 	return path
 }
+
+func TestLicensePolicyAllows(t *testing.T) {
+	policy := &LicensePolicy{Allow: []string{"MIT", "apache-2.0"}}
+	cases := map[string]bool{
+		"MIT":                    true,
+		"Apache-2.0":             true,
+		"MIT AND Apache-2.0":     true,
+		"MIT AND GPL-3.0-only":   false,
+		"(GPL-3.0-only OR MIT)":  true,
+		"LicenseRef-Proprietary": false,
+		"":                       false,
+
+		"(MIT AND BSD-3-Clause) OR Apache-2.0":        true,
+		"MIT AND BSD-3-Clause OR Apache-2.0":          true,
+		"MIT AND (BSD-3-Clause OR Apache-2.0)":        true,
+		"MIT AND (BSD-3-Clause OR GPL-3.0-only)":      false,
+		"mit and apache-2.0":                          true,
+		"GPL-3.0-only or mit":                         true,
+		"Apache-2.0 WITH LLVM-exception":              true,
+		"GPL-2.0-only WITH Classpath-exception-2.0":   false,
+		"(GPL-2.0-only WITH Classpath-exception-2.0)": false,
+		"MIT OR":         false,
+		"(MIT":           false,
+		"MIT Apache-2.0": false,
+		"MIT WITH":       false,
+	}
+	for license, want := range cases {
+		if got := policy.Allows(license); got != want {
+			t.Fatalf("Allows(%q) = %v, want %v", license, got, want)
+		}
+	}
+	withException := &LicensePolicy{Allow: []string{"GPL-2.0-only WITH Classpath-exception-2.0"}}
+	if !withException.Allows("(gpl-2.0-only with classpath-exception-2.0)") || withException.Allows("GPL-2.0-only") {
+		t.Fatalf("expected an allowed WITH term to match only with its exception")
+	}
+	policy.AllowUnknown = true
+	if !policy.Allows("") {
+		t.Fatalf("expected allowUnknown to admit packs without a license")
+	}
+	var none *LicensePolicy
+	if !none.Allows("GPL-3.0-only") {
+		t.Fatalf("expected nil policy to allow everything")
+	}
+}
+
+func TestPolicyEffectiveLimits(t *testing.T) {
+	var none *Policy
+	if got := none.EffectiveLimits(); got.MaxModuleBytes != DefaultMaxModuleBytes || got.MaxModulesPerDependency != DefaultMaxModulesPerDependency || got.MaxOutputBytes != DefaultMaxOutputBytes {
+		t.Fatalf("expected defaults, got %#v", got)
+	}
+	p := &Policy{Limits: &Limits{MaxModuleBytes: 10, MaxOutputBytes: -1}}
+	got := p.EffectiveLimits()
+	if got.MaxModuleBytes != 10 || got.MaxModulesPerDependency != DefaultMaxModulesPerDependency || got.MaxOutputBytes != 0 {
+		t.Fatalf("unexpected limits %#v", got)
+	}
+}
+
+func TestLoadRulesetValidatesTargetsAndNormalization(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, RulesetFileName)
+	cases := map[string]string{
+		`{"specVersion":"0.1","targets":{"codex":{"outFile":"x.md","newline":"cr"}}}`:            `targets.codex: unsupported newline "cr"`,
+		`{"specVersion":"0.1","normalize":{"unicode":"nfd"}}`:                                    `normalize: unsupported unicode form "nfd"`,
+		`{"specVersion":"0.1","targets":{"claude":{"layout":"namespace"}}}`:                      `targets.claude: layout "namespace" is only supported by the cursor target`,
+		`{"specVersion":"0.1","targets":{"copilot":{"outFile":"x.md","scopeByGlob":true}}}`:      `targets.copilot: scopeByGlob is only supported by the codex target`,
+		`{"specVersion":"0.1","targets":{"docs":{"type":"windsurf","outFile":"x.md"}}}`:          `targets.docs: unsupported type "windsurf"`,
+		`{"specVersion":"0.1","targets":{"docs":{"type":"copilot","layout":"namespace"}}}`:       `targets.docs: layout "namespace" is only supported by the cursor target`,
+		`{"specVersion":"0.1","targets":{"copilot":{"outFile":"x.md","template":"t"}}}`:          `targets.copilot: template is only supported by the custom target`,
+		`{"specVersion":"0.1","targets":{"custom":{"outFile":"x.md"}}}`:                          `targets.custom: custom target requires template`,
+		`{"specVersion":"0.1","targets":{"w":{"type":"custom","template":"t"}}}`:                 `targets.w: custom target requires outFile`,
+		`{"specVersion":"0.1","targets":{"copilot":{"perModule":true,"ext":".md"}}}`:             `targets.copilot: copilot target does not support ext; instructions files always end in .instructions.md`,
+		`{"specVersion":"0.1","targets":{"cursor":{}},"presets":{"ide":["cursor","jetbrains"]}}`: `presets.ide: target "jetbrains" not configured`,
+		`{"specVersion":"0.1","priorityBands":{"safety":"0-99","style":"50-499"}}`:               `priorityBands: style overlaps safety`,
+		`{"specVersion":"0.1","priorityBands":{"style":"high"}}`:                                 `priorityBands.style: "high" must be min-max`,
+		`{"specVersion":"0.1","priorityBands":{"style":"500-100"}}`:                              `priorityBands.style: min 500 exceeds max 100`,
+	}
+	for body, want := range cases {
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		if _, err := LoadRuleset(path); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q, got %v", want, err)
+		}
+	}
+}
+
+func TestRulesetBands(t *testing.T) {
+	r := Ruleset{PriorityBands: map[string]string{"style": "100-499", "safety": "0-99", "early": "-10 - -1"}}
+	got, err := r.Bands()
+	if err != nil {
+		t.Fatalf("Bands: %v", err)
+	}
+	want := []PriorityBand{{Name: "early", Min: -10, Max: -1}, {Name: "safety", Min: 0, Max: 99}, {Name: "style", Min: 100, Max: 499}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected bands: %+v", got)
+	}
+}
+
+func TestLoadEffectiveRulesetMergesOverrideFiles(t *testing.T) {
+	path := writeTempFile(t, RulesetFileName, `{"specVersion":"0.1","overrides":[{"id":"a","priority":1},{"id":"b","priority":2}]}`)
+	dir := filepath.Dir(path)
+	if err := os.WriteFile(filepath.Join(dir, OverridesFileName), []byte(`{"overrides":[{"id":"b","priority":20}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LocalOverridesFileName), []byte(`{"overrides":[{"id":"b","priority":200},{"id":"c"}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadEffectiveRuleset(path)
+	if err != nil {
+		t.Fatalf("LoadEffectiveRuleset: %v", err)
+	}
+	ids := []string{}
+	for _, ov := range cfg.Overrides {
+		ids = append(ids, ov.ID)
+	}
+	if !reflect.DeepEqual(ids, []string{"a", "b", "b", "b", "c"}) || *cfg.Overrides[3].Priority != 200 {
+		t.Fatalf("unexpected merged overrides: %+v", cfg.Overrides)
+	}
+	base, err := LoadRuleset(path)
+	if err != nil || len(base.Overrides) != 2 {
+		t.Fatalf("LoadRuleset should ignore override files, got %+v (%v)", base.Overrides, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, LocalOverridesFileName), []byte(`{"targets":{}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEffectiveRuleset(path); err == nil || !strings.Contains(err.Error(), "parse rulepack.overrides.local.json") {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, LocalOverridesFileName), []byte(`{"overrides":[{"priority":5}]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadEffectiveRuleset(path); err == nil || !strings.Contains(err.Error(), "overrides[0] missing id") {
+		t.Fatalf("expected missing id error, got %v", err)
+	}
+}
+
+func TestWhenMatches(t *testing.T) {
+	var none *When
+	if !none.Matches("linux", "amd64") {
+		t.Fatalf("nil when should match every platform")
+	}
+	w := &When{OS: "windows"}
+	if !w.Matches("windows", "arm64") || w.Matches("linux", "amd64") {
+		t.Fatalf("os-only condition matched wrongly")
+	}
+	w = &When{OS: "linux", Arch: "arm64"}
+	if !w.Matches("linux", "arm64") || w.Matches("linux", "amd64") {
+		t.Fatalf("os and arch condition matched wrongly")
+	}
+}
+
+func TestTargetEntryExpandPaths(t *testing.T) {
+	entry := TargetEntry{OutFile: ".github/copilot-instructions-{{.Env}}.md", OutDir: ".cursor/rules"}
+	got, err := entry.ExpandPaths(map[string]string{"Env": "prod"})
+	if err != nil {
+		t.Fatalf("ExpandPaths: %v", err)
+	}
+	if got.OutFile != ".github/copilot-instructions-prod.md" || got.OutDir != ".cursor/rules" {
+		t.Fatalf("unexpected expansion: %+v", got)
+	}
+	if _, err := entry.ExpandPaths(nil); err == nil {
+		t.Fatalf("expected unset variable to fail")
+	}
+	escaping := TargetEntry{OutDir: "{{.Dir}}/rules"}
+	for _, dir := range []string{"", "..", "../.."} {
+		if _, err := escaping.ExpandPaths(map[string]string{"Dir": dir}); err == nil {
+			t.Fatalf("expected Dir=%q to expand outside the project and fail", dir)
+		}
+	}
+}
+
+func TestProtectMatch(t *testing.T) {
+	p := &Protect{Paths: []string{".github/", "tools/*/generated"}}
+	cases := map[string]bool{
+		".github/copilot-instructions.md": true,
+		".github":                         true,
+		".githubx/rules.md":               false,
+		"tools/lint/generated":            true,
+		"tools/lint/generated/rules.md":   true,
+		"tools/generated/rules.md":        false,
+		".cursor/rules":                   false,
+	}
+	for outPath, want := range cases {
+		if _, got := p.Match(outPath); got != want {
+			t.Fatalf("Match(%q) = %v, want %v", outPath, got, want)
+		}
+	}
+	var none *Protect
+	if _, ok := none.Match(".github"); ok {
+		t.Fatalf("expected nil protect to match nothing")
+	}
+}
+
+func TestAliasSteps(t *testing.T) {
+	steps, err := AliasSteps("deps install --yes && rulepack build --target cursor")
+	if err != nil {
+		t.Fatalf("AliasSteps: %v", err)
+	}
+	want := [][]string{{"deps", "install", "--yes"}, {"build", "--target", "cursor"}}
+	if !reflect.DeepEqual(steps, want) {
+		t.Fatalf("unexpected steps: %#v", steps)
+	}
+	for _, bad := range []string{"", "build &&", "rulepack"} {
+		if _, err := AliasSteps(bad); err == nil {
+			t.Fatalf("expected %q to fail", bad)
+		}
+	}
+}
+
+func TestLoadUserConfigAliasValidation(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	path, err := UserConfigPath()
+	if err != nil {
+		t.Fatalf("UserConfigPath: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(`{"aliases":{"up":"deps install && "}}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := LoadUserConfig(); err == nil || !strings.Contains(err.Error(), `aliases["up"]`) {
+		t.Fatalf("expected alias validation error, got %v", err)
+	}
+}
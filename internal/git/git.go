@@ -1,22 +1,33 @@
 package git
 
 import (
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	semver "github.com/Masterminds/semver/v3"
 )
 
 type Client struct {
-	CacheRoot string
+	CacheRoot   string
+	Credentials CredentialFunc
+	// Mirrors maps canonical URI prefixes to replacement prefixes. Callers keep
+	// passing canonical URIs; only the fetch location changes.
+	Mirrors map[string]string
 }
 
+type CredentialFunc func(uri string) (username string, secret string, ok bool, err error)
+
 type Resolution struct {
 	Requested       string
 	ResolvedVersion string
@@ -36,13 +47,24 @@ func NewClient() (*Client, error) {
 }
 
 func (c *Client) EnsureRepo(uri string) (string, error) {
-	hash := sha256.Sum256([]byte(uri))
-	repoDir := filepath.Join(c.CacheRoot, hex.EncodeToString(hash[:8]), "repo.git")
+	return c.EnsureRepoContext(context.Background(), uri)
+}
+
+// EnsureRepoContext is EnsureRepo with the git processes killed when ctx is
+// done. Callers fetching concurrently must not pass the same uri twice at
+// once, since both would write the same mirror.
+func (c *Client) EnsureRepoContext(ctx context.Context, uri string) (string, error) {
+	uri = c.FetchURI(uri)
+	env, err := c.authEnv(uri)
+	if err != nil {
+		return "", err
+	}
+	repoDir := c.cacheDir(uri)
 	if _, err := os.Stat(repoDir); err == nil {
-		if _, err := run("git", "--git-dir", repoDir, "fetch", "--force", "--tags", "origin"); err != nil {
+		if _, err := runEnvContext(ctx, env, "git", "--git-dir", repoDir, "fetch", "--force", "--tags", "origin"); err != nil {
 			return "", err
 		}
-		if _, err := run("git", "--git-dir", repoDir, "fetch", "--force", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
+		if _, err := runEnvContext(ctx, env, "git", "--git-dir", repoDir, "fetch", "--force", "origin", "+refs/heads/*:refs/remotes/origin/*"); err != nil {
 			return "", err
 		}
 		return repoDir, nil
@@ -50,12 +72,93 @@ func (c *Client) EnsureRepo(uri string) (string, error) {
 	if err := os.MkdirAll(filepath.Dir(repoDir), 0o755); err != nil {
 		return "", err
 	}
-	if _, err := run("git", "clone", "--mirror", uri, repoDir); err != nil {
+	if _, err := runEnvContext(ctx, env, "git", "clone", "--mirror", uri, repoDir); err != nil {
+		// A killed clone can leave a partial mirror that later fetches would reuse.
+		_ = os.RemoveAll(repoDir)
 		return "", err
 	}
 	return repoDir, nil
 }
 
+// CachedRepo returns the local mirror for uri without fetching, and whether
+// it exists.
+func (c *Client) CachedRepo(uri string) (string, bool) {
+	repoDir := c.cacheDir(c.FetchURI(uri))
+	if _, err := os.Stat(repoDir); err != nil {
+		return "", false
+	}
+	return repoDir, true
+}
+
+func (c *Client) cacheDir(fetchURI string) string {
+	hash := sha256.Sum256([]byte(fetchURI))
+	return filepath.Join(c.CacheRoot, hex.EncodeToString(hash[:8]), "repo.git")
+}
+
+func (c *Client) LsRemote(uri string) error {
+	return c.LsRemoteContext(context.Background(), uri)
+}
+
+// LsRemoteContext is LsRemote with git killed when ctx is done.
+func (c *Client) LsRemoteContext(ctx context.Context, uri string) error {
+	uri = c.FetchURI(uri)
+	env, err := c.authEnv(uri)
+	if err != nil {
+		return err
+	}
+	_, err = runEnvContext(ctx, env, "git", "ls-remote", "--heads", uri)
+	return err
+}
+
+// FetchURI rewrites uri using the longest matching mirror prefix. A prefix only
+// matches on a path boundary, so "github.com/org" does not match "github.com/organization".
+func (c *Client) FetchURI(uri string) string {
+	best := ""
+	for prefix := range c.Mirrors {
+		if len(prefix) <= len(best) || !strings.HasPrefix(uri, prefix) {
+			continue
+		}
+		rest := uri[len(prefix):]
+		if rest != "" && rest != ".git" && !strings.HasSuffix(prefix, "/") && !strings.HasPrefix(rest, "/") && !strings.HasPrefix(rest, ":") {
+			continue
+		}
+		best = prefix
+	}
+	if best == "" {
+		return uri
+	}
+	return c.Mirrors[best] + uri[len(best):]
+}
+
+// authEnv passes credentials through GIT_CONFIG_* variables so tokens never
+// appear in process arguments or in the cached mirror's config. Only https
+// remotes get them; plain http would send the token in cleartext.
+func (c *Client) authEnv(uri string) ([]string, error) {
+	if c.Credentials == nil {
+		return nil, nil
+	}
+	if !strings.HasPrefix(strings.ToLower(uri), "https://") {
+		return nil, nil
+	}
+	username, secret, ok, err := c.Credentials(uri)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	if username == "" {
+		username = "x-access-token"
+	}
+	basic := base64.StdEncoding.EncodeToString([]byte(username + ":" + secret))
+	return []string{
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic " + basic,
+		"GIT_TERMINAL_PROMPT=0",
+	}, nil
+}
+
 func (c *Client) Resolve(repoDir string, ref string, version string) (Resolution, error) {
 	if ref != "" {
 		sha, err := revParse(repoDir, ref)
@@ -90,38 +193,92 @@ func (c *Client) ShowFile(repoDir, commit, path string) ([]byte, error) {
 	return []byte(out), nil
 }
 
-func resolveTag(repoDir, constraint string) (*semver.Version, string, error) {
-	cons, err := semver.NewConstraint(constraint)
+// CommitTime returns the committer date of commit.
+func (c *Client) CommitTime(repoDir, commit string) (time.Time, error) {
+	out, err := run("git", "--git-dir", repoDir, "show", "-s", "--format=%ct", commit)
 	if err != nil {
-		return nil, "", fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+		return time.Time{}, err
 	}
-	output, err := run("git", "--git-dir", repoDir, "tag", "--list")
+	secs, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
 	if err != nil {
-		return nil, "", err
+		return time.Time{}, fmt.Errorf("parse commit time of %s: %w", commit, err)
 	}
-	tags := strings.Fields(output)
-	type entry struct {
-		version *semver.Version
-		tag     string
+	return time.Unix(secs, 0), nil
+}
+
+// CheckIgnore returns the paths, relative to the working directory, that the
+// enclosing repository's ignore rules exclude.
+func CheckIgnore(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	cmd := exec.Command("git", "check-ignore", "-z", "--stdin")
+	cmd.Stdin = strings.NewReader(strings.Join(paths, "\x00") + "\x00")
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+		if errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("git check-ignore failed: %s", strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return nil, err
+	}
+	return strings.FieldsFunc(string(out), func(r rune) bool { return r == 0 }), nil
+}
+
+// NewestVersion returns the highest semver tag in repoDir regardless of any
+// constraint, or nil when the repository has no semver tags.
+func (c *Client) NewestVersion(repoDir string) (*semver.Version, error) {
+	tags, err := semverTags(repoDir)
+	if err != nil || len(tags) == 0 {
+		return nil, err
+	}
+	return tags[0].version, nil
+}
+
+type semverTag struct {
+	version *semver.Version
+	tag     string
+}
+
+// semverTags lists the tags of repoDir that parse as semver, highest first.
+func semverTags(repoDir string) ([]semverTag, error) {
+	output, err := run("git", "--git-dir", repoDir, "tag", "--list")
+	if err != nil {
+		return nil, err
 	}
-	var matches []entry
-	for _, tag := range tags {
+	var tags []semverTag
+	for _, tag := range strings.Fields(output) {
 		normalized := strings.TrimPrefix(tag, "v")
 		v, err := semver.NewVersion(normalized)
 		if err != nil {
 			continue
 		}
-		if cons.Check(v) {
-			matches = append(matches, entry{version: v, tag: tag})
-		}
-	}
-	if len(matches) == 0 {
-		return nil, "", fmt.Errorf("no tags satisfy constraint %q", constraint)
+		tags = append(tags, semverTag{version: v, tag: tag})
 	}
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].version.GreaterThan(matches[j].version)
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].version.GreaterThan(tags[j].version)
 	})
-	return matches[0].version, matches[0].tag, nil
+	return tags, nil
+}
+
+func resolveTag(repoDir, constraint string) (*semver.Version, string, error) {
+	cons, err := semver.NewConstraint(constraint)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid version constraint %q: %w", constraint, err)
+	}
+	tags, err := semverTags(repoDir)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, t := range tags {
+		if cons.Check(t.version) {
+			return t.version, t.tag, nil
+		}
+	}
+	return nil, "", fmt.Errorf("no tags satisfy constraint %q", constraint)
 }
 
 func revParse(repoDir, ref string) (string, error) {
@@ -133,7 +290,18 @@ func revParse(repoDir, ref string) (string, error) {
 }
 
 func run(name string, args ...string) (string, error) {
-	cmd := exec.Command(name, args...)
+	return runEnv(nil, name, args...)
+}
+
+func runEnv(env []string, name string, args ...string) (string, error) {
+	return runEnvContext(context.Background(), env, name, args...)
+}
+
+func runEnvContext(ctx context.Context, env []string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		return "", fmt.Errorf("%s %s failed: %w\n%s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
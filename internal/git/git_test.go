@@ -0,0 +1,25 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuthEnvOnlyForHTTPS(t *testing.T) {
+	c := &Client{Credentials: func(uri string) (string, string, bool, error) {
+		return "", "secret-token", true, nil
+	}}
+	env, err := c.authEnv("https://example.com/org/rules.git")
+	if err != nil {
+		t.Fatalf("authEnv: %v", err)
+	}
+	if !strings.Contains(strings.Join(env, "\n"), "Authorization: Basic ") {
+		t.Fatalf("expected an auth header for https, got %v", env)
+	}
+	for _, uri := range []string{"http://example.com/org/rules.git", "HTTP://example.com/org/rules.git", "git@example.com:org/rules.git", "/tmp/rules"} {
+		env, err := c.authEnv(uri)
+		if err != nil || env != nil {
+			t.Fatalf("expected no auth env for %s, got %v (%v)", uri, env, err)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package git
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ResolutionTTL is how long a recorded resolution answers CachedResolution,
+// so commands that poll remotes repeatedly fetch at most this often.
+const ResolutionTTL = 5 * time.Minute
+
+const resolutionsFile = "resolutions.json"
+
+// CachedResolution is a resolution recorded under CacheRoot.
+type CachedResolution struct {
+	Requested       string `json:"requested,omitempty"`
+	ResolvedVersion string `json:"resolvedVersion,omitempty"`
+	Commit          string `json:"commit"`
+	// Newest is the highest semver tag the repository had, if any.
+	Newest    string    `json:"newest,omitempty"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// CachedResolution returns what ref or version of uri resolved to when it
+// was recorded less than ResolutionTTL before now.
+func (c *Client) CachedResolution(uri, ref, version string, now time.Time) (CachedResolution, bool) {
+	cached := c.loadResolutions()[resolutionKey(c.FetchURI(uri), ref, version)]
+	if cached.Commit == "" || now.Sub(cached.CheckedAt) >= ResolutionTTL || now.Before(cached.CheckedAt) {
+		return CachedResolution{}, false
+	}
+	return cached, true
+}
+
+// RecordResolution stores r for ref or version of uri and drops entries that
+// have expired. Concurrent writers may lose each other's entries, which only
+// costs a later fetch.
+func (c *Client) RecordResolution(uri, ref, version string, r CachedResolution) error {
+	entries := c.loadResolutions()
+	for key, cached := range entries {
+		if r.CheckedAt.Sub(cached.CheckedAt) >= ResolutionTTL {
+			delete(entries, key)
+		}
+	}
+	entries[resolutionKey(c.FetchURI(uri), ref, version)] = r
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.CacheRoot, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.CacheRoot, resolutionsFile+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.CacheRoot, resolutionsFile))
+}
+
+// loadResolutions reads the recorded resolutions. A missing or corrupt file
+// is an empty cache.
+func (c *Client) loadResolutions() map[string]CachedResolution {
+	entries := map[string]CachedResolution{}
+	data, err := os.ReadFile(filepath.Join(c.CacheRoot, resolutionsFile))
+	if err != nil {
+		return entries
+	}
+	if err := json.Unmarshal(data, &entries); err != nil || entries == nil {
+		return map[string]CachedResolution{}
+	}
+	return entries
+}
+
+func resolutionKey(fetchURI, ref, version string) string {
+	return fetchURI + "#ref=" + ref + "&version=" + version
+}
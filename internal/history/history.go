@@ -0,0 +1,236 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dir holds one subdirectory per snapshot of project files taken before a
+// mutating command, relative to the project root.
+const Dir = ".rulepack/history"
+
+// MaxEntries is how many snapshots are kept; older ones are pruned.
+const MaxEntries = 20
+
+// ErrEmpty reports that there is nothing to undo.
+var ErrEmpty = errors.New("no history to undo")
+
+type Entry struct {
+	ID        string `json:"id"`
+	Command   string `json:"command"`
+	CreatedAt string `json:"createdAt"`
+	// Files maps each snapshotted path to whether it existed. Undo deletes
+	// paths that did not.
+	Files map[string]bool `json:"files"`
+}
+
+// Snapshot copies files into a new history entry attributed to command and
+// prunes entries beyond MaxEntries.
+func Snapshot(command string, files []string) (Entry, error) {
+	now := time.Now().UTC()
+	entry := Entry{
+		ID:        now.Format("20060102T150405.000000000Z"),
+		Command:   command,
+		CreatedAt: now.Format(time.RFC3339),
+		Files:     make(map[string]bool, len(files)),
+	}
+	entryDir := filepath.Join(Dir, entry.ID)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			entry.Files[filepath.ToSlash(file)] = false
+			continue
+		}
+		if err != nil {
+			return entry, err
+		}
+		dest := filepath.Join(entryDir, "files", file)
+		if err := os.MkdirAll(filepath.Dir(dest), 0o755); err != nil {
+			return entry, err
+		}
+		if err := os.WriteFile(dest, data, 0o644); err != nil {
+			return entry, err
+		}
+		entry.Files[filepath.ToSlash(file)] = true
+	}
+	if err := os.MkdirAll(entryDir, 0o755); err != nil {
+		return entry, err
+	}
+	bytes, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return entry, err
+	}
+	if err := os.WriteFile(filepath.Join(entryDir, "entry.json"), append(bytes, '\n'), 0o644); err != nil {
+		return entry, err
+	}
+	return entry, prune()
+}
+
+// List returns snapshots oldest first.
+func List() ([]Entry, error) {
+	dirs, err := os.ReadDir(Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(dirs))
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		bytes, err := os.ReadFile(filepath.Join(Dir, d.Name(), "entry.json"))
+		if err != nil {
+			return nil, fmt.Errorf("read history entry %s: %w", d.Name(), err)
+		}
+		var entry Entry
+		if err := json.Unmarshal(bytes, &entry); err != nil {
+			return nil, fmt.Errorf("parse history entry %s: %w", d.Name(), err)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].ID < entries[j].ID })
+	return entries, nil
+}
+
+// Undo restores the files of the newest snapshot and removes it.
+func Undo() (Entry, error) {
+	entries, err := List()
+	if err != nil {
+		return Entry{}, err
+	}
+	if len(entries) == 0 {
+		return Entry{}, ErrEmpty
+	}
+	entry := entries[len(entries)-1]
+	entryDir := filepath.Join(Dir, entry.ID)
+	for file, existed := range entry.Files {
+		path := filepath.FromSlash(file)
+		if !existed {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return entry, err
+			}
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(entryDir, "files", path))
+		if err != nil {
+			return entry, err
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return entry, err
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return entry, err
+		}
+	}
+	return entry, os.RemoveAll(entryDir)
+}
+
+func prune() error {
+	entries, err := List()
+	if err != nil {
+		return err
+	}
+	for len(entries) > MaxEntries {
+		if err := os.RemoveAll(filepath.Join(Dir, entries[0].ID)); err != nil {
+			return err
+		}
+		entries = entries[1:]
+	}
+	return nil
+}
+
+// AuditFile is an append-only log of mutating commands, one JSON object per
+// line, relative to the project root.
+const AuditFile = ".rulepack/audit.log"
+
+type AuditEntry struct {
+	Time    string   `json:"time"`
+	User    string   `json:"user,omitempty"`
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+	// Hashes holds the sha256 of each project file after the command ran.
+	// Files that do not exist are omitted.
+	Hashes map[string]string `json:"hashes"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// Audit appends entry to AuditFile, filling in the time, the current user,
+// and the hashes of files.
+func Audit(entry AuditEntry, files []string) error {
+	entry.Time = time.Now().UTC().Format(time.RFC3339)
+	entry.User = currentUser()
+	entry.Hashes = make(map[string]string, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(data)
+		entry.Hashes[filepath.ToSlash(file)] = hex.EncodeToString(sum[:])
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(AuditFile), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(AuditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadAudit returns the audit log oldest first. A missing log is empty.
+func ReadAudit() ([]AuditEntry, error) {
+	data, err := os.ReadFile(AuditFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]AuditEntry, 0)
+	for i, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", AuditFile, i+1, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	for _, key := range []string{"USER", "USERNAME"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return ""
+}
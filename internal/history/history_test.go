@@ -0,0 +1,56 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotPrunesOldestEntries(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+
+	if err := os.WriteFile("state.json", []byte("v0\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	for i := 0; i < MaxEntries+2; i++ {
+		if _, err := Snapshot("step", []string{"state.json", filepath.Join("sub", "missing.json")}); err != nil {
+			t.Fatalf("Snapshot: %v", err)
+		}
+	}
+	entries, err := List()
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != MaxEntries {
+		t.Fatalf("expected %d entries after pruning, got %d", MaxEntries, len(entries))
+	}
+	if entries[0].Files["state.json"] != true || entries[0].Files["sub/missing.json"] != false {
+		t.Fatalf("unexpected snapshot files: %#v", entries[0].Files)
+	}
+
+	if err := os.WriteFile("state.json", []byte("v1\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := os.MkdirAll("sub", 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join("sub", "missing.json"), []byte("{}\n"), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := Undo(); err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if data, _ := os.ReadFile("state.json"); string(data) != "v0\n" {
+		t.Fatalf("expected state.json restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join("sub", "missing.json")); !os.IsNotExist(err) {
+		t.Fatalf("expected file created after snapshot to be removed, stat err=%v", err)
+	}
+}
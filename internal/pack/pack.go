@@ -4,13 +4,16 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
+	"golang.org/x/text/unicode/norm"
 	"rulepack/internal/config"
 	"rulepack/internal/git"
 )
@@ -19,6 +22,7 @@ type RulePack struct {
 	SpecVersion string                    `json:"specVersion"`
 	Name        string                    `json:"name"`
 	Version     string                    `json:"version"`
+	License     string                    `json:"license,omitempty"`
 	Modules     []ModuleEntry             `json:"modules"`
 	Exports     map[string]ExportSelector `json:"exports,omitempty"`
 }
@@ -29,12 +33,23 @@ type ModuleEntry struct {
 	Priority  int         `json:"priority"`
 	AppliesTo []string    `json:"appliesTo,omitempty"`
 	Apply     ApplyConfig `json:"apply,omitempty"`
+	// Band names the project priority band the module's priority must fall
+	// in; see config.Ruleset.PriorityBands.
+	Band string `json:"band,omitempty"`
+	// Owner is the team or user responsible for the module, as a CODEOWNERS
+	// owner such as @org/team; see rulepack codeowners.
+	Owner string `json:"owner,omitempty"`
+	// When limits the module to builds for a matching platform.
+	When *config.When `json:"when,omitempty"`
 }
 
 type ExportSelector struct {
 	Include   []string `json:"include,omitempty"`
 	Folders   []string `json:"folders,omitempty"`
 	AppliesTo []string `json:"appliesTo,omitempty"`
+	// Template is the path of a project rulepack.json in the pack that
+	// rulepack init can start a project from.
+	Template string `json:"template,omitempty"`
 }
 
 type ApplyConfig struct {
@@ -51,15 +66,50 @@ type ApplyRule struct {
 type Module struct {
 	PackName    string
 	PackVersion string
+	PackLicense string
 	Commit      string
 	ID          string
 	Path        string
 	Priority    int
+	Band        string
+	Owner       string
+	When        *config.When
 	Content     string
 	Apply       ApplyConfig
 }
 
-type fileReader interface {
+// Options bounds and normalizes expansion. Zero limits mean no limit.
+type Options struct {
+	MaxModuleBytes int64
+	MaxModules     int
+	// NFC normalizes module content before hashing so composed and decomposed
+	// encodings of the same text hash identically.
+	NFC bool
+}
+
+// ErrMissingExport reports a dependency naming an export its pack does not
+// define.
+var ErrMissingExport = errors.New("missing export")
+
+// MissingExportError is the ErrMissingExport for one pack. Available lists
+// the exports the pack does define, so callers can suggest a replacement.
+type MissingExportError struct {
+	Pack      string
+	Export    string
+	Available []string
+}
+
+func (e *MissingExportError) Error() string {
+	return fmt.Sprintf("%s %q in %s", ErrMissingExport, e.Export, e.Pack)
+}
+
+func (e *MissingExportError) Is(target error) bool {
+	return target == ErrMissingExport
+}
+
+// FileReader reads files of a rule pack by their slash-separated path
+// relative to the pack root.
+type FileReader interface {
 	ReadFile(path string) ([]byte, error)
 }
 
@@ -85,50 +135,65 @@ func (r localFileReader) ReadFile(filePath string) ([]byte, error) {
 	return os.ReadFile(fullPath)
 }
 
-func ExpandGitDependency(gc *git.Client, repoDir string, dep config.Dependency, lock config.LockedSource) ([]Module, error) {
+// GitReader reads a pack from repoDir at commit.
+func GitReader(gc *git.Client, repoDir, commit string) FileReader {
+	return gitFileReader{client: gc, repoDir: repoDir, commit: commit}
+}
+
+// LocalReader reads a pack from the directory root.
+func LocalReader(root string) FileReader {
+	return localFileReader{root: root}
+}
+
+func ExpandGitDependency(gc *git.Client, repoDir string, dep config.Dependency, lock config.LockedSource, opts Options) ([]Module, error) {
 	reader := gitFileReader{client: gc, repoDir: repoDir, commit: lock.Commit}
-	return expandDependency(reader, dep, lock.Commit)
+	return expandDependency(reader, dep, lock.Commit, opts)
 }
 
-func ExpandLocalDependency(localRoot string, dep config.Dependency, commit string) ([]Module, string, error) {
+func ExpandLocalDependency(localRoot string, dep config.Dependency, commit string, opts Options) ([]Module, string, error) {
 	reader := localFileReader{root: localRoot}
-	modules, hash, err := expandDependencyWithHash(reader, dep, commit)
+	modules, hash, err := expandDependencyWithHash(reader, dep, commit, opts)
 	if err != nil {
 		return nil, "", err
 	}
 	return modules, hash, nil
 }
 
-func ExpandProfileDependency(profileRoot string, dep config.Dependency, commit string) ([]Module, string, error) {
-	reader := localFileReader{root: profileRoot}
-	modules, hash, err := expandDependencyWithHash(reader, dep, commit)
+// ExpandReader expands a dependency whose files come from reader, such as a
+// profile snapshot whose module content lives outside the pack directory.
+func ExpandReader(reader FileReader, dep config.Dependency, commit string, opts Options) ([]Module, string, error) {
+	modules, hash, err := expandDependencyWithHash(reader, dep, commit, opts)
 	if err != nil {
 		return nil, "", err
 	}
 	return modules, hash, nil
 }
 
-func expandDependency(reader fileReader, dep config.Dependency, commit string) ([]Module, error) {
-	modules, _, err := expandDependencyWithHash(reader, dep, commit)
+func expandDependency(reader FileReader, dep config.Dependency, commit string, opts Options) ([]Module, error) {
+	modules, _, err := expandDependencyWithHash(reader, dep, commit, opts)
 	return modules, err
 }
 
-func expandDependencyWithHash(reader fileReader, dep config.Dependency, commit string) ([]Module, string, error) {
+func expandDependencyWithHash(reader FileReader, dep config.Dependency, commit string, opts Options) ([]Module, string, error) {
 	rp, err := loadRulePack(reader)
 	if err != nil {
 		return nil, "", err
 	}
-	selector, err := exportSelector(rp, dep.Export)
+	export := dep.PackExport()
+	selector, err := exportSelector(rp, export)
 	if err != nil {
 		return nil, "", err
 	}
 
 	selected := selectModules(rp.Modules, selector)
+	if opts.MaxModules > 0 && len(selected) > opts.MaxModules {
+		return nil, "", fmt.Errorf("pack %s selects %d modules, exceeding the limit of %d per dependency", rp.Name, len(selected), opts.MaxModules)
+	}
 	mods := make([]Module, 0, len(selected))
 	hashState := hashState{
 		packName:    rp.Name,
 		packVersion: rp.Version,
-		export:      dep.Export,
+		export:      export,
 	}
 
 	for _, m := range selected {
@@ -136,14 +201,27 @@ func expandDependencyWithHash(reader fileReader, dep config.Dependency, commit s
 		if err != nil {
 			return nil, "", fmt.Errorf("read module %s (%s): %w", m.ID, m.Path, err)
 		}
+		if opts.MaxModuleBytes > 0 && int64(len(bytes)) > opts.MaxModuleBytes {
+			return nil, "", fmt.Errorf("module %s (%s) is %d bytes, exceeding the limit of %d", m.ID, m.Path, len(bytes), opts.MaxModuleBytes)
+		}
+		if err := checkText(bytes); err != nil {
+			return nil, "", fmt.Errorf("module %s (%s): %w", m.ID, m.Path, err)
+		}
 		content := normalizeNewlines(string(bytes))
+		if opts.NFC {
+			content = norm.NFC.String(content)
+		}
 		mods = append(mods, Module{
 			PackName:    rp.Name,
 			PackVersion: rp.Version,
+			PackLicense: rp.License,
 			Commit:      commit,
 			ID:          m.ID,
 			Path:        m.Path,
 			Priority:    m.Priority,
+			Band:        m.Band,
+			Owner:       m.Owner,
+			When:        m.When,
 			Content:     content,
 			Apply:       m.Apply,
 		})
@@ -155,15 +233,164 @@ func expandDependencyWithHash(reader fileReader, dep config.Dependency, commit s
 			ID:       m.ID,
 			Path:     m.Path,
 			Priority: m.Priority,
+			Band:     m.Band,
+			Owner:    m.Owner,
+			When:     m.When,
 			Content:  content,
 			Apply:    string(applyJSON),
 		})
 	}
 
-	return mods, hashState.sum(), nil
+	return dependencyModules(dep, mods), hashState.sum(), nil
+}
+
+// dependencyModules applies the dependency's disableModules and
+// renameModules. They are the project's choice, not the pack's, so the
+// content hash the lock records is taken before they apply.
+func dependencyModules(dep config.Dependency, modules []Module) []Module {
+	if len(dep.DisableModules) == 0 && len(dep.RenameModules) == 0 {
+		return modules
+	}
+	out := make([]Module, 0, len(modules))
+	for _, m := range modules {
+		if MatchesID(m.ID, dep.DisableModules) {
+			continue
+		}
+		if to, ok := dep.RenameModules[m.ID]; ok {
+			m.ID = to
+		}
+		out = append(out, m)
+	}
+	return out
 }
 
-func loadRulePack(reader fileReader) (RulePack, error) {
+// Materialize copies the pack reader reads into dir: its rulepack.json as
+// is and the file of every module it declares, whatever the exports select.
+// It returns the slash-separated paths written, sorted.
+func Materialize(reader FileReader, dir string) ([]string, error) {
+	manifest, err := reader.ReadFile("rulepack.json")
+	if err != nil {
+		return nil, fmt.Errorf("read rulepack.json: %w", err)
+	}
+	rp, err := loadRulePack(reader)
+	if err != nil {
+		return nil, err
+	}
+	files := map[string][]byte{"rulepack.json": manifest}
+	for _, m := range rp.Modules {
+		name := path.Clean(filepath.ToSlash(m.Path))
+		if _, ok := files[name]; ok {
+			continue
+		}
+		content, err := reader.ReadFile(m.Path)
+		if err != nil {
+			return nil, fmt.Errorf("read module %s (%s): %w", m.ID, m.Path, err)
+		}
+		files[name] = content
+	}
+	written := make([]string, 0, len(files))
+	for name, content := range files {
+		target, err := safeJoinPath(dir, name)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return nil, err
+		}
+		written = append(written, name)
+	}
+	sort.Strings(written)
+	return written, nil
+}
+
+// LoadTemplate reads the project template of the named export, or of the
+// default export when name is empty.
+func LoadTemplate(reader FileReader, name string) (config.Ruleset, error) {
+	rp, err := loadRulePack(reader)
+	if err != nil {
+		return config.Ruleset{}, err
+	}
+	exp, err := exportSelector(rp, name)
+	if err != nil {
+		return config.Ruleset{}, err
+	}
+	if exp.Template == "" {
+		if name == "" {
+			name = "default"
+		}
+		return config.Ruleset{}, fmt.Errorf("export %q of %s has no template", name, rp.Name)
+	}
+	content, err := reader.ReadFile(exp.Template)
+	if err != nil {
+		return config.Ruleset{}, fmt.Errorf("read template %s: %w", exp.Template, err)
+	}
+	return config.ParseRuleset(content, exp.Template)
+}
+
+// CheckExport reports whether the pack defines the export dep selects,
+// returning a *MissingExportError when it does not.
+func CheckExport(reader FileReader, dep config.Dependency) error {
+	rp, err := loadRulePack(reader)
+	if err != nil {
+		return err
+	}
+	_, err = exportSelector(rp, dep.PackExport())
+	return err
+}
+
+// License returns the license the pack's manifest declares, whatever its
+// exports select.
+func License(reader FileReader) (string, error) {
+	rp, err := loadRulePack(reader)
+	if err != nil {
+		return "", err
+	}
+	return rp.License, nil
+}
+
+// ExportForFolder returns the export whose folders select dir, a directory
+// of the pack such as languages/python or modules/languages/python. An
+// export selecting only dir wins over ones selecting it among others.
+func ExportForFolder(reader FileReader, dir string) (string, error) {
+	rp, err := loadRulePack(reader)
+	if err != nil {
+		return "", err
+	}
+	dir = strings.Trim(strings.ReplaceAll(dir, "\\", "/"), "/")
+	names := make([]string, 0, len(rp.Exports))
+	for name := range rp.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var matches, exact []string
+	for _, name := range names {
+		folders := normalizeFolders(rp.Exports[name].Folders)
+		for _, folder := range folders {
+			if folder == dir || "modules/"+folder == dir {
+				matches = append(matches, name)
+				if len(folders) == 1 {
+					exact = append(exact, name)
+				}
+				break
+			}
+		}
+	}
+	switch {
+	case len(exact) == 1:
+		return exact[0], nil
+	case len(matches) == 1:
+		return matches[0], nil
+	case len(matches) == 0:
+		return "", fmt.Errorf("no export of %s selects folder %q", rp.Name, dir)
+	default:
+		return "", fmt.Errorf("folder %q of %s is selected by exports %s", dir, rp.Name, strings.Join(matches, ", "))
+	}
+}
+
+func loadRulePack(reader FileReader) (RulePack, error) {
 	var rp RulePack
 	content, err := reader.ReadFile("rulepack.json")
 	if err != nil {
@@ -175,9 +402,92 @@ func loadRulePack(reader fileReader) (RulePack, error) {
 	if rp.SpecVersion == "" || rp.Name == "" || rp.Version == "" {
 		return rp, fmt.Errorf("invalid rulepack metadata")
 	}
+	for _, m := range rp.Modules {
+		if err := m.When.Validate(); err != nil {
+			return rp, fmt.Errorf("module %s: %w", m.ID, err)
+		}
+	}
 	return rp, nil
 }
 
+// manifestModule mirrors ModuleEntry for FormatManifest, leaving out an
+// empty apply block.
+type manifestModule struct {
+	ID        string       `json:"id"`
+	Path      string       `json:"path"`
+	Priority  int          `json:"priority"`
+	AppliesTo []string     `json:"appliesTo,omitempty"`
+	Apply     *ApplyConfig `json:"apply,omitempty"`
+	Band      string       `json:"band,omitempty"`
+	Owner     string       `json:"owner,omitempty"`
+	When      *config.When `json:"when,omitempty"`
+}
+
+type manifest struct {
+	SpecVersion string                    `json:"specVersion"`
+	Name        string                    `json:"name"`
+	Version     string                    `json:"version"`
+	License     string                    `json:"license,omitempty"`
+	Modules     []manifestModule          `json:"modules"`
+	Exports     map[string]ExportSelector `json:"exports,omitempty"`
+}
+
+// FormatManifest returns the canonical encoding of a pack rulepack.json:
+// fields in RulePack order, two-space indentation, and modules sorted by
+// priority, then ID. Unknown fields are an error rather than being dropped.
+// The parsed pack is returned with its modules in the new order.
+func FormatManifest(data []byte) ([]byte, RulePack, error) {
+	var rp RulePack
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rp); err != nil {
+		return nil, rp, fmt.Errorf("parse rulepack.json: %w", err)
+	}
+	sort.SliceStable(rp.Modules, func(i, j int) bool {
+		if rp.Modules[i].Priority == rp.Modules[j].Priority {
+			return rp.Modules[i].ID < rp.Modules[j].ID
+		}
+		return rp.Modules[i].Priority < rp.Modules[j].Priority
+	})
+	out := manifest{
+		SpecVersion: rp.SpecVersion,
+		Name:        rp.Name,
+		Version:     rp.Version,
+		License:     rp.License,
+		Modules:     make([]manifestModule, 0, len(rp.Modules)),
+		Exports:     rp.Exports,
+	}
+	for _, m := range rp.Modules {
+		mm := manifestModule{ID: m.ID, Path: m.Path, Priority: m.Priority, AppliesTo: m.AppliesTo, Band: m.Band, Owner: m.Owner, When: m.When}
+		if m.Apply.Default != nil || len(m.Apply.Targets) > 0 {
+			apply := m.Apply
+			mm.Apply = &apply
+		}
+		out.Modules = append(out.Modules, mm)
+	}
+	bytes, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return nil, rp, err
+	}
+	return append(bytes, '\n'), rp, nil
+}
+
+// FormatMarkdown normalizes module content: LF line endings, no trailing
+// spaces or tabs, and exactly one final newline.
+func FormatMarkdown(content string) string {
+	lines := strings.Split(normalizeNewlines(content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return normalizeNewlines(strings.Join(lines, "\n"))
+}
+
+// ModuleFile resolves a module path inside a pack root, rejecting paths
+// that escape it.
+func ModuleFile(root, modulePath string) (string, error) {
+	return safeJoinPath(root, modulePath)
+}
+
 func exportSelector(rp RulePack, name string) (ExportSelector, error) {
 	if name == "" {
 		if exp, ok := rp.Exports["default"]; ok {
@@ -187,7 +497,12 @@ func exportSelector(rp RulePack, name string) (ExportSelector, error) {
 	}
 	exp, ok := rp.Exports[name]
 	if !ok {
-		return ExportSelector{}, fmt.Errorf("missing export %q in %s", name, rp.Name)
+		available := make([]string, 0, len(rp.Exports))
+		for export := range rp.Exports {
+			available = append(available, export)
+		}
+		sort.Strings(available)
+		return ExportSelector{}, &MissingExportError{Pack: rp.Name, Export: name, Available: available}
 	}
 	return exp, nil
 }
@@ -212,15 +527,26 @@ func selectModules(modules []ModuleEntry, selector ExportSelector) []ModuleEntry
 		}
 		out = append(out, m)
 	}
+	// Path breaks ties between duplicate IDs so the selection, and the hash
+	// over it, never depends on manifest order.
 	sort.Slice(out, func(i, j int) bool {
-		if out[i].Priority == out[j].Priority {
+		if out[i].Priority != out[j].Priority {
+			return out[i].Priority < out[j].Priority
+		}
+		if out[i].ID != out[j].ID {
 			return out[i].ID < out[j].ID
 		}
-		return out[i].Priority < out[j].Priority
+		return out[i].Path < out[j].Path
 	})
 	return out
 }
 
+// MatchesID reports whether a module ID matches one of the include patterns
+// used by export selectors.
+func MatchesID(id string, patterns []string) bool {
+	return matchesAny(id, patterns)
+}
+
 func matchesAny(id string, patterns []string) bool {
 	for _, pattern := range patterns {
 		if pattern == "**" || pattern == "*" {
@@ -237,6 +563,131 @@ func matchesAny(id string, patterns []string) bool {
 	return false
 }
 
+// MatchPath matches a slash-separated path against a pattern where ** spans
+// any number of directories and other segments use path.Match syntax.
+func MatchPath(pattern, name string) bool {
+	pattern = strings.TrimPrefix(filepath.ToSlash(strings.TrimSpace(pattern)), "./")
+	return matchPathSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchPathSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchPathSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, err := path.Match(pattern[0], name[0]); err != nil || !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// Ignore excludes modules from composition using gitignore-style patterns.
+// A pattern without a slash matches module IDs (as in export include lists)
+// and any file or directory name in a module's path; a pattern with a slash
+// matches module paths from the pack root, and a trailing slash matches only
+// directories.
+// Patterns starting with ! re-include, and the last matching pattern wins.
+type Ignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	pattern string
+	negate  bool
+}
+
+// ParseIgnore reads ignore patterns, one per line. Blank lines and lines
+// starting with # are skipped; \# and \! escape a literal first character.
+func ParseIgnore(content string) (Ignore, error) {
+	var ig Ignore
+	for i, line := range strings.Split(normalizeNewlines(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		rule.pattern = line
+		check := strings.Trim(line, "/")
+		if check == "" {
+			return ig, fmt.Errorf("line %d: empty pattern", i+1)
+		}
+		if _, err := path.Match(strings.ReplaceAll(check, "**", "*"), ""); err != nil {
+			return ig, fmt.Errorf("line %d: invalid pattern %q", i+1, line)
+		}
+		ig.rules = append(ig.rules, rule)
+	}
+	return ig, nil
+}
+
+// LoadIgnore reads an ignore file. A missing file ignores nothing.
+func LoadIgnore(filePath string) (Ignore, error) {
+	bytes, err := os.ReadFile(filePath)
+	if os.IsNotExist(err) {
+		return Ignore{}, nil
+	}
+	if err != nil {
+		return Ignore{}, err
+	}
+	ig, err := ParseIgnore(string(bytes))
+	if err != nil {
+		return Ignore{}, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return ig, nil
+}
+
+// Match reports whether m is excluded.
+func (ig Ignore) Match(m Module) bool {
+	modulePath := strings.Trim(strings.ReplaceAll(m.Path, "\\", "/"), "/")
+	ignored := false
+	for _, rule := range ig.rules {
+		if rule.matches(m.ID, modulePath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+func (r ignoreRule) matches(id, modulePath string) bool {
+	dirOnly := strings.HasSuffix(r.pattern, "/")
+	pattern := strings.Trim(r.pattern, "/")
+	if !strings.Contains(pattern, "/") {
+		// Like gitignore, a slash-free pattern matches at any depth.
+		if !dirOnly && matchesAny(id, []string{pattern}) {
+			return true
+		}
+		pattern = "**/" + pattern
+	}
+	return MatchPath(pattern+"/**", modulePath) || (!dirOnly && MatchPath(pattern, modulePath))
+}
+
+// Filter splits modules into kept and ignored, preserving order.
+func (ig Ignore) Filter(modules []Module) (kept []Module, ignored []Module) {
+	kept = make([]Module, 0, len(modules))
+	for _, m := range modules {
+		if ig.Match(m) {
+			ignored = append(ignored, m)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept, ignored
+}
+
 func intersects(values []string, want map[string]struct{}) bool {
 	for _, value := range values {
 		if _, ok := want[value]; ok {
@@ -280,6 +731,22 @@ func matchesAnyFolder(modulePath string, folders []string) bool {
 	return false
 }
 
+// checkText rejects content that would corrupt instruction files: NUL bytes
+// (a reliable binary signal) and invalid UTF-8.
+func checkText(b []byte) error {
+	for i := 0; i < len(b); {
+		if b[i] == 0 {
+			return fmt.Errorf("binary content (NUL byte) at byte offset %d", i)
+		}
+		r, size := utf8.DecodeRune(b[i:])
+		if r == utf8.RuneError && size == 1 {
+			return fmt.Errorf("invalid UTF-8 at byte offset %d", i)
+		}
+		i += size
+	}
+	return nil
+}
+
 func normalizeNewlines(s string) string {
 	s = strings.ReplaceAll(s, "\r\n", "\n")
 	s = strings.ReplaceAll(s, "\r", "\n")
@@ -310,6 +777,9 @@ type hashedModule struct {
 	ID       string
 	Path     string
 	Priority int
+	Band     string
+	Owner    string
+	When     *config.When
 	Content  string
 	Apply    string
 }
@@ -329,6 +799,19 @@ func (h hashState) sum() string {
 		b.WriteString(m.Path)
 		b.WriteString("\npriority:")
 		b.WriteString(fmt.Sprintf("%d", m.Priority))
+		// Only banded modules hash their band, so existing lock hashes hold.
+		if m.Band != "" {
+			b.WriteString("\nband:")
+			b.WriteString(m.Band)
+		}
+		if m.Owner != "" {
+			b.WriteString("\nowner:")
+			b.WriteString(m.Owner)
+		}
+		if m.When != nil {
+			b.WriteString("\nwhen:")
+			b.WriteString(m.When.OS + "/" + m.When.Arch)
+		}
 		b.WriteString("\ncontent:\n")
 		b.WriteString(m.Content)
 		b.WriteString("\napply:\n")
@@ -3,6 +3,8 @@ package pack
 import (
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"rulepack/internal/config"
@@ -26,11 +28,11 @@ func TestExpandLocalDependency_DefaultExportAndDeterministicHash(t *testing.T) {
 	writeFile(t, filepath.Join(root, "mods", "b.md"), "B\n")
 
 	dep := config.Dependency{Source: "local", Path: ".", Export: "default"}
-	mods1, hash1, err := ExpandLocalDependency(root, dep, "local")
+	mods1, hash1, err := ExpandLocalDependency(root, dep, "local", Options{})
 	if err != nil {
 		t.Fatalf("ExpandLocalDependency: %v", err)
 	}
-	mods2, hash2, err := ExpandLocalDependency(root, dep, "local")
+	mods2, hash2, err := ExpandLocalDependency(root, dep, "local", Options{})
 	if err != nil {
 		t.Fatalf("ExpandLocalDependency second: %v", err)
 	}
@@ -52,6 +54,38 @@ func TestExpandLocalDependency_DefaultExportAndDeterministicHash(t *testing.T) {
 	}
 }
 
+func TestExpandLocalDependency_DisableAndRenameModulesKeepHash(t *testing.T) {
+	root := writeLocalPack(t, `{
+  "specVersion": "0.1",
+  "name": "local-pack",
+  "version": "1.0.0",
+  "modules": [
+    {"id":"a.alpha","path":"mods/a.md","priority":100},
+    {"id":"b.beta","path":"mods/b.md","priority":200}
+  ]
+}`)
+	writeFile(t, filepath.Join(root, "mods", "a.md"), "A\n")
+	writeFile(t, filepath.Join(root, "mods", "b.md"), "B\n")
+
+	dep := config.Dependency{Source: "local", Path: "."}
+	_, plainHash, err := ExpandLocalDependency(root, dep, "local", Options{})
+	if err != nil {
+		t.Fatalf("ExpandLocalDependency: %v", err)
+	}
+	dep.DisableModules = []string{"a.*"}
+	dep.RenameModules = map[string]string{"b.beta": "vendor.beta"}
+	mods, hash, err := ExpandLocalDependency(root, dep, "local", Options{})
+	if err != nil {
+		t.Fatalf("ExpandLocalDependency with policy: %v", err)
+	}
+	if len(mods) != 1 || mods[0].ID != "vendor.beta" || mods[0].Path != "mods/b.md" {
+		t.Fatalf("expected only b.beta renamed to vendor.beta, got %#v", mods)
+	}
+	if hash != plainHash {
+		t.Fatalf("expected the content hash to ignore project policy, got %s != %s", hash, plainHash)
+	}
+}
+
 func TestExpandLocalDependency_NamedExportAndHashDrift(t *testing.T) {
 	root := writeLocalPack(t, `{
   "specVersion": "0.1",
@@ -71,7 +105,7 @@ func TestExpandLocalDependency_NamedExportAndHashDrift(t *testing.T) {
 	writeFile(t, filepath.Join(root, "mods", "b.md"), "B\n")
 
 	dep := config.Dependency{Source: "local", Path: ".", Export: "all"}
-	mods, hash1, err := ExpandLocalDependency(root, dep, "local")
+	mods, hash1, err := ExpandLocalDependency(root, dep, "local", Options{})
 	if err != nil {
 		t.Fatalf("ExpandLocalDependency: %v", err)
 	}
@@ -80,7 +114,7 @@ func TestExpandLocalDependency_NamedExportAndHashDrift(t *testing.T) {
 	}
 
 	writeFile(t, aPath, "A changed\n")
-	_, hash2, err := ExpandLocalDependency(root, dep, "local")
+	_, hash2, err := ExpandLocalDependency(root, dep, "local", Options{})
 	if err != nil {
 		t.Fatalf("ExpandLocalDependency changed: %v", err)
 	}
@@ -106,7 +140,7 @@ func TestExpandLocalDependency_MissingNamedExportFails(t *testing.T) {
 	writeFile(t, filepath.Join(root, "modules", "tasks", "setup.md"), "T\n")
 
 	dep := config.Dependency{Source: "local", Path: ".", Export: "standards"}
-	_, _, err := ExpandLocalDependency(root, dep, "local")
+	_, _, err := ExpandLocalDependency(root, dep, "local", Options{})
 	if err == nil {
 		t.Fatalf("expected missing export error")
 	}
@@ -115,6 +149,44 @@ func TestExpandLocalDependency_MissingNamedExportFails(t *testing.T) {
 	}
 }
 
+func TestExpandLocalDependency_ExportAliasesAndDefaultExport(t *testing.T) {
+	root := writeLocalPack(t, `{
+  "specVersion": "0.1",
+  "name": "local-pack",
+  "version": "1.0.0",
+  "modules": [
+    {"id":"standards.style","path":"modules/standards/style.md","priority":100},
+    {"id":"tasks.setup","path":"modules/tasks/setup.md","priority":200}
+  ],
+  "exports": {
+    "default": {"include":["**"]},
+    "style": {"include":["standards.*"]}
+  }
+}`)
+	writeFile(t, filepath.Join(root, "modules", "standards", "style.md"), "S\n")
+	writeFile(t, filepath.Join(root, "modules", "tasks", "setup.md"), "T\n")
+
+	deps := []config.Dependency{
+		{Source: "local", Path: ".", Export: "standards", ExportAliases: map[string]string{"standards": "style"}},
+		{Source: "local", Path: ".", DefaultExport: "style"},
+		{Source: "local", Path: ".", Export: "style"},
+	}
+	var hashes []string
+	for _, dep := range deps {
+		mods, hash, err := ExpandLocalDependency(root, dep, "local", Options{})
+		if err != nil {
+			t.Fatalf("ExpandLocalDependency(%+v): %v", dep, err)
+		}
+		if len(mods) != 1 || mods[0].ID != "standards.style" {
+			t.Fatalf("expected only standards.style for %+v, got %+v", dep, mods)
+		}
+		hashes = append(hashes, hash)
+	}
+	if hashes[0] != hashes[2] || hashes[1] != hashes[2] {
+		t.Fatalf("expected aliased exports to hash like the pack export: %v", hashes)
+	}
+}
+
 func TestExpandLocalDependency_ExportWithFoldersSelector(t *testing.T) {
 	root := writeLocalPack(t, `{
   "specVersion": "0.1",
@@ -134,7 +206,7 @@ func TestExpandLocalDependency_ExportWithFoldersSelector(t *testing.T) {
 	writeFile(t, filepath.Join(root, "modules", "tasks", "setup.md"), "T\n")
 
 	dep := config.Dependency{Source: "local", Path: ".", Export: "python-core"}
-	mods, _, err := ExpandLocalDependency(root, dep, "local")
+	mods, _, err := ExpandLocalDependency(root, dep, "local", Options{})
 	if err != nil {
 		t.Fatalf("ExpandLocalDependency: %v", err)
 	}
@@ -146,6 +218,34 @@ func TestExpandLocalDependency_ExportWithFoldersSelector(t *testing.T) {
 	}
 }
 
+func TestExportForFolder(t *testing.T) {
+	root := writeLocalPack(t, `{
+  "specVersion": "0.1",
+  "name": "local-pack",
+  "version": "1.0.0",
+  "modules": [{"id":"languages.python.patterns","path":"modules/languages/python/patterns.md","priority":200}],
+  "exports": {
+    "python": {"folders":["languages/python"]},
+    "python-core": {"folders":["standards","languages/python"]},
+    "tasks": {"folders":["tasks"]},
+    "tasks-all": {"folders":["tasks","standards"]}
+  }
+}`)
+	reader := LocalReader(root)
+	for dir, want := range map[string]string{"languages/python": "python", "modules/languages/python/": "python", "tasks": "tasks"} {
+		got, err := ExportForFolder(reader, dir)
+		if err != nil || got != want {
+			t.Fatalf("ExportForFolder(%q) = %q, %v; want %q", dir, got, err, want)
+		}
+	}
+	if _, err := ExportForFolder(reader, "standards"); err == nil || !strings.Contains(err.Error(), "selected by exports python-core, tasks-all") {
+		t.Fatalf("expected an ambiguous folder error, got %v", err)
+	}
+	if _, err := ExportForFolder(reader, "docs"); err == nil || !strings.Contains(err.Error(), `no export of local-pack selects folder "docs"`) {
+		t.Fatalf("expected a missing folder error, got %v", err)
+	}
+}
+
 func writeLocalPack(t *testing.T, rulepackJSON string) string {
 	t.Helper()
 	root := t.TempDir()
@@ -162,3 +262,212 @@ func writeFile(t *testing.T, path string, content string) {
 		t.Fatalf("WriteFile: %v", err)
 	}
 }
+
+func TestExpandLocalDependency_EnforcesLimits(t *testing.T) {
+	root := writeLocalPack(t, `{
+  "specVersion": "0.1",
+  "name": "local-pack",
+  "version": "1.0.0",
+  "modules": [
+    {"id":"a","path":"modules/a.md","priority":100},
+    {"id":"b","path":"modules/b.md","priority":200}
+  ]
+}`)
+	writeFile(t, filepath.Join(root, "modules", "a.md"), "short\n")
+	writeFile(t, filepath.Join(root, "modules", "b.md"), strings.Repeat("x", 64)+"\n")
+	dep := config.Dependency{Source: "local", Path: "."}
+
+	_, _, err := ExpandLocalDependency(root, dep, "local", Options{MaxModules: 1})
+	if err == nil || !strings.Contains(err.Error(), "selects 2 modules, exceeding the limit of 1") {
+		t.Fatalf("expected module count limit error, got %v", err)
+	}
+	_, _, err = ExpandLocalDependency(root, dep, "local", Options{MaxModuleBytes: 32})
+	if err == nil || !strings.Contains(err.Error(), "module b (modules/b.md) is 65 bytes") {
+		t.Fatalf("expected module size limit error, got %v", err)
+	}
+	if _, _, err := ExpandLocalDependency(root, dep, "local", Options{MaxModules: 2, MaxModuleBytes: 65}); err != nil {
+		t.Fatalf("expected limits at the boundary to pass: %v", err)
+	}
+}
+
+func TestExpandLocalDependency_RejectsNonText(t *testing.T) {
+	manifest := `{
+  "specVersion": "0.1",
+  "name": "local-pack",
+  "version": "1.0.0",
+  "modules": [{"id":"a","path":"modules/a.md","priority":100}]
+}`
+	dep := config.Dependency{Source: "local", Path: "."}
+	cases := map[string]string{
+		"ok\x00\x01\x02":    "module a (modules/a.md): binary content (NUL byte) at byte offset 2",
+		"caf\xe9 latin-1\n": "module a (modules/a.md): invalid UTF-8 at byte offset 3",
+	}
+	for content, want := range cases {
+		root := writeLocalPack(t, manifest)
+		writeFile(t, filepath.Join(root, "modules", "a.md"), content)
+		_, _, err := ExpandLocalDependency(root, dep, "local", Options{})
+		if err == nil || err.Error() != want {
+			t.Fatalf("expected %q, got %v", want, err)
+		}
+	}
+
+	root := writeLocalPack(t, manifest)
+	writeFile(t, filepath.Join(root, "modules", "a.md"), "café ✓\n")
+	if _, _, err := ExpandLocalDependency(root, dep, "local", Options{}); err != nil {
+		t.Fatalf("expected UTF-8 text to pass: %v", err)
+	}
+}
+
+func TestExpandLocalDependency_NFCStabilizesHash(t *testing.T) {
+	manifest := `{
+  "specVersion": "0.1",
+  "name": "local-pack",
+  "version": "1.0.0",
+  "modules": [{"id":"a","path":"modules/a.md","priority":100}]
+}`
+	dep := config.Dependency{Source: "local", Path: "."}
+	composed := writeLocalPack(t, manifest)
+	writeFile(t, filepath.Join(composed, "modules", "a.md"), "caf\u00e9\n")
+	decomposed := writeLocalPack(t, manifest)
+	writeFile(t, filepath.Join(decomposed, "modules", "a.md"), "cafe\u0301\n")
+
+	_, rawA, _ := ExpandLocalDependency(composed, dep, "local", Options{})
+	_, rawB, _ := ExpandLocalDependency(decomposed, dep, "local", Options{})
+	if rawA == rawB {
+		t.Fatalf("expected hashes to differ without NFC")
+	}
+	modsA, hashA, err := ExpandLocalDependency(composed, dep, "local", Options{NFC: true})
+	if err != nil {
+		t.Fatalf("ExpandLocalDependency: %v", err)
+	}
+	modsB, hashB, err := ExpandLocalDependency(decomposed, dep, "local", Options{NFC: true})
+	if err != nil {
+		t.Fatalf("ExpandLocalDependency: %v", err)
+	}
+	if hashA != hashB || modsA[0].Content != modsB[0].Content {
+		t.Fatalf("expected NFC to make content and hashes identical")
+	}
+}
+
+func TestExpandLocalDependency_IgnoresManifestOrder(t *testing.T) {
+	entries := []string{
+		`{"id":"a","path":"modules/a.md","priority":100}`,
+		`{"id":"b","path":"modules/b.md","priority":100}`,
+		`{"id":"b","path":"modules/b2.md","priority":100}`,
+		`{"id":"c","path":"modules/c.md","priority":50}`,
+	}
+	expand := func(order []int) ([]Module, string) {
+		t.Helper()
+		listed := make([]string, 0, len(order))
+		for _, i := range order {
+			listed = append(listed, entries[i])
+		}
+		root := writeLocalPack(t, `{"specVersion":"0.1","name":"local-pack","version":"1.0.0","modules":[`+strings.Join(listed, ",")+`]}`)
+		for _, name := range []string{"a", "b", "b2", "c"} {
+			writeFile(t, filepath.Join(root, "modules", name+".md"), name+"\n")
+		}
+		mods, hash, err := ExpandLocalDependency(root, config.Dependency{Source: "local", Path: "."}, "local", Options{})
+		if err != nil {
+			t.Fatalf("ExpandLocalDependency: %v", err)
+		}
+		return mods, hash
+	}
+	wantMods, wantHash := expand([]int{0, 1, 2, 3})
+	for _, order := range [][]int{{3, 2, 1, 0}, {2, 0, 3, 1}, {1, 3, 0, 2}} {
+		mods, hash := expand(order)
+		if hash != wantHash || !reflect.DeepEqual(mods, wantMods) {
+			t.Fatalf("order %v changed the expansion: %+v (%s), want %+v (%s)", order, mods, hash, wantMods, wantHash)
+		}
+	}
+	if got := []string{wantMods[0].Path, wantMods[1].Path, wantMods[2].Path, wantMods[3].Path}; !reflect.DeepEqual(got, []string{"modules/c.md", "modules/a.md", "modules/b.md", "modules/b2.md"}) {
+		t.Fatalf("unexpected order %v", got)
+	}
+}
+
+func TestFormatManifest_SortsModulesAndDropsEmptyApply(t *testing.T) {
+	input := `{"name":"p","specVersion":"0.1","version":"1.0.0",
+"modules":[{"priority":200,"id":"b","path":"modules/b.md","apply":{"default":{"mode":"always"}}},{"id":"a","path":"modules/a.md","priority":200},{"id":"c","path":"modules/c.md","priority":100}]}`
+	got, rp, err := FormatManifest([]byte(input))
+	if err != nil {
+		t.Fatalf("FormatManifest: %v", err)
+	}
+	want := `{
+  "specVersion": "0.1",
+  "name": "p",
+  "version": "1.0.0",
+  "modules": [
+    {
+      "id": "c",
+      "path": "modules/c.md",
+      "priority": 100
+    },
+    {
+      "id": "a",
+      "path": "modules/a.md",
+      "priority": 200
+    },
+    {
+      "id": "b",
+      "path": "modules/b.md",
+      "priority": 200,
+      "apply": {
+        "default": {
+          "mode": "always"
+        }
+      }
+    }
+  ]
+}
+`
+	if string(got) != want {
+		t.Fatalf("unexpected manifest:\n%s", got)
+	}
+	if rp.Modules[0].ID != "c" {
+		t.Fatalf("returned pack should be sorted, got %+v", rp.Modules)
+	}
+	again, _, err := FormatManifest(got)
+	if err != nil || string(again) != want {
+		t.Fatalf("formatting should be idempotent: %v\n%s", err, again)
+	}
+	if _, _, err := FormatManifest([]byte(`{"specVersion":"0.1","modules":[],"extra":true}`)); err == nil || !strings.Contains(err.Error(), `unknown field "extra"`) {
+		t.Fatalf("expected unknown field error, got %v", err)
+	}
+}
+
+func TestFormatMarkdown(t *testing.T) {
+	got := FormatMarkdown("# Title  \r\n\r\n- item\t\nend \n  \n\n")
+	if got != "# Title\n\n- item\nend\n" {
+		t.Fatalf("unexpected markdown: %q", got)
+	}
+}
+
+func TestIgnore_Match(t *testing.T) {
+	ig, err := ParseIgnore(`# temporary exclusions
+python.*
+!python.base
+modules/legacy/
+drafts
+`)
+	if err != nil {
+		t.Fatalf("ParseIgnore: %v", err)
+	}
+	cases := []struct {
+		id, path string
+		want     bool
+	}{
+		{"python.style", "modules/python/style.md", true},
+		{"python.base", "modules/python/base.md", false},
+		{"go.old", "modules/legacy/go/old.md", true},
+		{"go.draft", "modules/go/drafts/new.md", true},
+		{"go.base", "modules/go/base.md", false},
+	}
+	for _, c := range cases {
+		if got := ig.Match(Module{ID: c.id, Path: c.path}); got != c.want {
+			t.Fatalf("Match(%s, %s) = %v, want %v", c.id, c.path, got, c.want)
+		}
+	}
+
+	if _, err := ParseIgnore("modules/[bad\n"); err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Fatalf("expected invalid pattern error, got %v", err)
+	}
+}
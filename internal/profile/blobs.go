@@ -0,0 +1,222 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"rulepack/internal/config"
+	"rulepack/internal/pack"
+)
+
+// BlobDir holds module content shared by every profile in a store, one file
+// per distinct content named by its SHA-256. Profiles reference blobs from
+// profile.json instead of keeping their own copies.
+const BlobDir = "blobs"
+
+// blobPath returns where the blob named digest lives in root. Digests come
+// from profile.json, which a registry supplies, so anything but a SHA-256 in
+// lowercase hex is rejected before it can reach the filesystem.
+func blobPath(root, digest string) (string, error) {
+	if !validDigest(digest) {
+		return "", fmt.Errorf("invalid blob digest %q", digest)
+	}
+	return filepath.Join(root, BlobDir, digest[:2], digest), nil
+}
+
+func validDigest(digest string) bool {
+	if len(digest) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range digest {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// writeBlob stores content in the blob store of root and returns its digest.
+// Content already stored is not written again.
+func writeBlob(root string, content []byte) (string, error) {
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	target, err := blobPath(root, digest)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(target); err == nil {
+		return digest, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".blob-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// readProfileBlobs returns the blob references in profileDir's profile.json,
+// or nil when it has none or no metadata, as in registry snapshots.
+func readProfileBlobs(profileDir string) (map[string]string, error) {
+	bytes, err := os.ReadFile(filepath.Join(profileDir, "profile.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var payload struct {
+		Blobs map[string]string `json:"blobs"`
+	}
+	if err := json.Unmarshal(bytes, &payload); err != nil {
+		return nil, err
+	}
+	return payload.Blobs, nil
+}
+
+// referencedBlobs returns every blob digest profileDir's profile.json
+// references: module content and the bases of local edits.
+func referencedBlobs(profileDir string) ([]string, error) {
+	bytes, err := os.ReadFile(filepath.Join(profileDir, "profile.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var payload struct {
+		Blobs     map[string]string `json:"blobs"`
+		EditBases map[string]string `json:"editBases"`
+	}
+	if err := json.Unmarshal(bytes, &payload); err != nil {
+		return nil, err
+	}
+	digests := slices.Collect(maps.Values(payload.Blobs))
+	return append(digests, slices.Collect(maps.Values(payload.EditBases))...), nil
+}
+
+// snapshotReader reads a profile snapshot, resolving module paths through
+// its blob references and everything else from the profile directory.
+type snapshotReader struct {
+	dir   string
+	blobs map[string]string
+}
+
+func (r snapshotReader) ReadFile(filePath string) ([]byte, error) {
+	var blobErr error
+	if digest, ok := r.blobs[filePath]; ok {
+		target, err := blobPath(filepath.Dir(r.dir), digest)
+		if err != nil {
+			return nil, fmt.Errorf("profile blob for %s: %w", filePath, err)
+		}
+		content, err := os.ReadFile(target)
+		if err == nil {
+			return content, nil
+		}
+		// A snapshot copied out of its store, as into a registry, carries
+		// its module files next to the metadata instead.
+		blobErr = fmt.Errorf("profile blob %s for %s: %w", digest, filePath, err)
+	}
+	fullPath, err := pack.ModuleFile(r.dir, filePath)
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil && blobErr != nil {
+		return nil, blobErr
+	}
+	return content, err
+}
+
+// Reader reads the profile snapshot in profileDir as a pack, with module
+// files resolved through its blob references.
+func Reader(profileDir string) (pack.FileReader, error) {
+	blobs, err := readProfileBlobs(profileDir)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotReader{dir: profileDir, blobs: blobs}, nil
+}
+
+// Expand reads dep from the profile snapshot in profileDir. Snapshots saved
+// before the blob store, and registry snapshots, keep module files in the
+// profile directory and are read from there.
+//
+// A save that replaces the profile mid-read can prune blobs the old version
+// referenced; the read is then retried once against the new version.
+func Expand(profileDir string, dep config.Dependency, opts pack.Options) ([]pack.Module, string, error) {
+	blobs, err := readProfileBlobs(profileDir)
+	if err != nil {
+		return nil, "", err
+	}
+	modules, hash, err := pack.ExpandReader(snapshotReader{dir: profileDir, blobs: blobs}, dep, ProfileCommit, opts)
+	if err == nil {
+		return modules, hash, nil
+	}
+	current, readErr := readProfileBlobs(profileDir)
+	if readErr != nil || maps.Equal(blobs, current) {
+		return nil, "", err
+	}
+	return pack.ExpandReader(snapshotReader{dir: profileDir, blobs: current}, dep, ProfileCommit, opts)
+}
+
+// pruneBlobs deletes blobs in root that no profile in root references.
+func pruneBlobs(root string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	referenced := map[string]bool{}
+	for _, entry := range entries {
+		if !isStoreEntry(entry) {
+			continue
+		}
+		digests, err := referencedBlobs(filepath.Join(root, entry.Name()))
+		if err != nil {
+			// Keep everything rather than drop blobs an unreadable profile
+			// may still need.
+			return nil
+		}
+		for _, digest := range digests {
+			referenced[digest] = true
+		}
+	}
+	return filepath.WalkDir(filepath.Join(root, BlobDir), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		// Temporary files belong to a save in progress.
+		if d.IsDir() || referenced[d.Name()] || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		return os.Remove(path)
+	})
+}
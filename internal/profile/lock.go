@@ -0,0 +1,135 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// lockFileName marks a store as being written. Dot-prefixed entries in a
+// store are never profiles.
+const lockFileName = ".lock"
+
+// Lock timing. A lock older than staleLockAge is assumed to belong to a
+// process that died and is taken over.
+var (
+	lockTimeout  = 30 * time.Second
+	lockRetry    = 50 * time.Millisecond
+	staleLockAge = 10 * time.Minute
+)
+
+// lockStore takes the write lock of the store at root, waiting up to
+// lockTimeout for another process to finish. Leftovers from an interrupted
+// write are cleared once the lock is held. The returned func releases it.
+func lockStore(root string) (func(), error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(root, lockFileName)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			_, _ = f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+			_ = f.Close()
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(path); statErr == nil && time.Since(info.ModTime()) > staleLockAge {
+			takeOverStaleLock(path, info)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("profile store %s is busy: another rulepack process holds %s (delete it if none is running)", root, path)
+		}
+		time.Sleep(lockRetry)
+	}
+	if err := clearInterrupted(root); err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return func() { _ = os.Remove(path) }, nil
+}
+
+// takeOverStaleLock removes the stale lock described by stale. The lock is
+// renamed aside first and checked to still be that file and still stale,
+// since inode numbers can be reused: another waiter may have taken over the
+// stale lock and created a fresh one in the meantime, which is put back
+// instead of deleted.
+func takeOverStaleLock(path string, stale os.FileInfo) {
+	aside := fmt.Sprintf("%s.stale-%d-%d", path, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(path, aside); err != nil {
+		return
+	}
+	if moved, err := os.Stat(aside); err == nil && (!os.SameFile(stale, moved) || time.Since(moved.ModTime()) <= staleLockAge) {
+		// Link fails rather than replace a lock created since.
+		_ = os.Link(aside, path)
+	}
+	_ = os.Remove(aside)
+}
+
+// clearInterrupted removes staging and discarded profile directories left
+// by a write that never finished. Only call it with the store locked.
+func clearInterrupted(root string) error {
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), ".") {
+			if err := os.RemoveAll(filepath.Join(root, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// replaceDir moves the fully written dir into place at target. An existing
+// target is renamed aside first and deleted afterwards, so readers see the
+// old profile or the new one, never a partial directory.
+func replaceDir(dir, target string) error {
+	old := ""
+	if _, err := os.Stat(target); err == nil {
+		old = dir + ".old"
+		if err := os.Rename(target, old); err != nil {
+			return err
+		}
+	}
+	if err := os.Rename(dir, target); err != nil {
+		if old != "" {
+			_ = os.Rename(old, target)
+		}
+		return err
+	}
+	if old != "" {
+		return os.RemoveAll(old)
+	}
+	return nil
+}
+
+// discardDir removes a profile directory by first renaming it aside, so it
+// disappears from listings at once rather than file by file.
+func discardDir(dir string) error {
+	trash, err := os.MkdirTemp(filepath.Dir(dir), ".remove-*")
+	if err != nil {
+		return err
+	}
+	target := filepath.Join(trash, filepath.Base(dir))
+	if err := os.Rename(dir, target); err != nil {
+		_ = os.Remove(trash)
+		return err
+	}
+	return os.RemoveAll(trash)
+}
+
+// isStoreEntry reports whether a store directory entry can hold a profile.
+func isStoreEntry(entry os.DirEntry) bool {
+	return entry.IsDir() && entry.Name() != BlobDir && !strings.HasPrefix(entry.Name(), ".")
+}
@@ -0,0 +1,279 @@
+package profile
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"rulepack/internal/config"
+	"rulepack/internal/pack"
+)
+
+// Conflict markers written around the two sides of a module that could not
+// be merged. The local side comes first, as in git.
+const (
+	conflictLocal  = "<<<<<<< local\n"
+	conflictSep    = "=======\n"
+	conflictSource = ">>>>>>> source\n"
+)
+
+// EditBase returns the source content a local edit of moduleID started from,
+// and false when the module has no local edit.
+func (m Metadata) EditBase(moduleID string) (string, bool, error) {
+	digest, ok := m.EditBases[moduleID]
+	if !ok {
+		return "", false, nil
+	}
+	target, err := blobPath(filepath.Dir(m.dir), digest)
+	if err != nil {
+		return "", false, fmt.Errorf("profile %s edit base of %s: %w", m.ID, moduleID, err)
+	}
+	content, err := os.ReadFile(target)
+	if err != nil {
+		return "", false, fmt.Errorf("profile %s edit base of %s: %w", m.ID, moduleID, err)
+	}
+	return string(content), true, nil
+}
+
+// EditModule replaces the content of one module of a saved profile with a
+// local edit. The source content the edit started from is kept, so a later
+// refresh can merge source changes into the edit instead of overwriting it.
+// Editing a conflicted module resolves its conflict.
+func EditModule(ref, moduleID, content string) (Metadata, error) {
+	meta, dir, err := ResolveIDOrAlias(ref)
+	if err != nil {
+		return Metadata{}, err
+	}
+	modules, _, err := Expand(dir, config.Dependency{Source: ProfileSource, Profile: meta.ID, Export: "default"}, pack.Options{})
+	if err != nil {
+		return Metadata{}, err
+	}
+	bases, err := meta.editBaseContents()
+	if err != nil {
+		return Metadata{}, err
+	}
+	found := false
+	for i, m := range modules {
+		if m.ID != moduleID {
+			continue
+		}
+		if _, ok := bases[m.ID]; !ok {
+			bases[m.ID] = m.Content
+		}
+		modules[i].Content = content
+		found = true
+	}
+	if !found {
+		return Metadata{}, fmt.Errorf("profile %s has no module %s", meta.ID, moduleID)
+	}
+	conflicts := slices.DeleteFunc(slices.Clone(meta.Conflicts), func(id string) bool { return id == moduleID })
+	return SaveSnapshot(SaveInput{
+		ID:           meta.ID,
+		Alias:        meta.Alias,
+		Sources:      meta.Sources,
+		ContentHash:  ComputeContentHash(modules, "default"),
+		Modules:      modules,
+		Exports:      meta.Exports,
+		Scope:        meta.Scope,
+		RefreshEvery: meta.RefreshEvery,
+		EditBases:    bases,
+		Conflicts:    conflicts,
+	})
+}
+
+// editBaseContents reads the base content of every locally edited module.
+func (m Metadata) editBaseContents() (map[string]string, error) {
+	bases := make(map[string]string, len(m.EditBases))
+	for id := range m.EditBases {
+		base, _, err := m.EditBase(id)
+		if err != nil {
+			return nil, err
+		}
+		bases[id] = base
+	}
+	return bases, nil
+}
+
+// RefreshMerge is the result of merging a refresh into a profile's local
+// edits.
+type RefreshMerge struct {
+	Modules []pack.Module
+	// EditBases and Conflicts are passed on to SaveInput.
+	EditBases map[string]string
+	Conflicts []string
+	// Merged lists edited modules whose source changes merged cleanly.
+	Merged []string
+}
+
+// MergeLocalEdits folds the local edits of meta into refreshed, the modules
+// a refresh would otherwise save. Each edited module is merged three ways:
+// the content the edit started from, the local module in current, and the
+// refreshed source. Edits whose source did not change are kept as they are.
+// Overlapping changes are saved with conflict markers and listed in
+// Conflicts; an edited module the source no longer provides is kept and
+// listed as a conflict too. The source side becomes the new base of every
+// merged edit.
+func MergeLocalEdits(meta Metadata, current, refreshed []pack.Module) (RefreshMerge, error) {
+	out := RefreshMerge{Modules: refreshed, EditBases: map[string]string{}, Conflicts: []string{}, Merged: []string{}}
+	if len(meta.EditBases) == 0 {
+		return out, nil
+	}
+	bases, err := meta.editBaseContents()
+	if err != nil {
+		return RefreshMerge{}, err
+	}
+	local := make(map[string]pack.Module, len(current))
+	for _, m := range current {
+		local[m.ID] = m
+	}
+	out.Modules = slices.Clone(refreshed)
+	seen := map[string]bool{}
+	for i, m := range out.Modules {
+		base, edited := bases[m.ID]
+		if !edited {
+			continue
+		}
+		seen[m.ID] = true
+		mine := local[m.ID].Content
+		switch {
+		case m.Content == mine:
+			// Not refreshed, or the source made the same edit.
+			if m.Content != base {
+				out.EditBases[m.ID] = base
+			}
+		case m.Content == base:
+			out.Modules[i].Content = mine
+			out.EditBases[m.ID] = base
+		default:
+			merged, conflict := Merge3(base, mine, m.Content)
+			out.Modules[i].Content = merged
+			if merged != m.Content {
+				out.EditBases[m.ID] = m.Content
+			}
+			if conflict {
+				out.Conflicts = append(out.Conflicts, m.ID)
+			} else {
+				out.Merged = append(out.Merged, m.ID)
+			}
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(bases)) {
+		if seen[id] {
+			continue
+		}
+		if m, ok := local[id]; ok {
+			out.Modules = append(out.Modules, m)
+			out.EditBases[id] = bases[id]
+			out.Conflicts = append(out.Conflicts, id)
+		}
+	}
+	for _, id := range meta.Conflicts {
+		if _, still := out.EditBases[id]; still && !slices.Contains(out.Conflicts, id) && !slices.Contains(out.Merged, id) {
+			out.Conflicts = append(out.Conflicts, id)
+		}
+	}
+	slices.Sort(out.Conflicts)
+	slices.Sort(out.Merged)
+	return out, nil
+}
+
+// Merge3 merges the changes local and fresh each made to base, line by line.
+// Where both changed the same lines differently, both sides are kept between
+// conflict markers and conflict is true.
+func Merge3(base, local, fresh string) (merged string, conflict bool) {
+	o, a, b := splitLines(base), splitLines(local), splitLines(fresh)
+	matchA, matchB := matchLines(o, a), matchLines(o, b)
+	var sb strings.Builder
+	i, j, k := 0, 0, 0
+	for i < len(o) || j < len(a) || k < len(b) {
+		if i < len(o) && matchA[i] == j && matchB[i] == k {
+			sb.WriteString(o[i])
+			i, j, k = i+1, j+1, k+1
+			continue
+		}
+		// The chunk runs to the next base line both sides kept.
+		m, endA, endB := i, len(a), len(b)
+		for ; m < len(o); m++ {
+			if matchA[m] >= 0 && matchB[m] >= 0 {
+				endA, endB = matchA[m], matchB[m]
+				break
+			}
+		}
+		chunkO, chunkA, chunkB := o[i:m], a[j:endA], b[k:endB]
+		switch {
+		case slices.Equal(chunkA, chunkO):
+			writeLines(&sb, chunkB)
+		case slices.Equal(chunkB, chunkO), slices.Equal(chunkA, chunkB):
+			writeLines(&sb, chunkA)
+		default:
+			conflict = true
+			sb.WriteString(conflictLocal)
+			writeTerminated(&sb, chunkA)
+			sb.WriteString(conflictSep)
+			writeTerminated(&sb, chunkB)
+			sb.WriteString(conflictSource)
+		}
+		i, j, k = m, endA, endB
+	}
+	return sb.String(), conflict
+}
+
+// splitLines splits s into lines that keep their newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// matchLines returns, for each line of o, the index of the line of a it is
+// paired with in a longest common subsequence, or -1.
+func matchLines(o, a []string) []int {
+	lcs := make([][]int, len(o)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(a)+1)
+	}
+	for i := len(o) - 1; i >= 0; i-- {
+		for j := len(a) - 1; j >= 0; j-- {
+			if o[i] == a[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	match := make([]int, len(o))
+	i, j := 0, 0
+	for i < len(o) {
+		switch {
+		case j < len(a) && o[i] == a[j]:
+			match[i] = j
+			i, j = i+1, j+1
+		case j < len(a) && lcs[i][j+1] >= lcs[i+1][j]:
+			j++
+		default:
+			match[i] = -1
+			i++
+		}
+	}
+	return match
+}
+
+func writeLines(sb *strings.Builder, lines []string) {
+	for _, line := range lines {
+		sb.WriteString(line)
+	}
+}
+
+// writeTerminated writes lines and ends the last one with a newline, so a
+// conflict marker always starts a line.
+func writeTerminated(sb *strings.Builder, lines []string) {
+	writeLines(sb, lines)
+	if len(lines) > 0 && !strings.HasSuffix(lines[len(lines)-1], "\n") {
+		sb.WriteString("\n")
+	}
+}
@@ -9,11 +9,15 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"rulepack/internal/config"
 	"rulepack/internal/pack"
+	"rulepack/internal/selector"
 )
 
 const (
@@ -21,6 +25,18 @@ const (
 	ProfileCommit = "profile"
 )
 
+// Profile stores. The project store lives in the repository so teams can
+// commit shared profiles; it is searched before the global store.
+const (
+	ScopeGlobal  = "global"
+	ScopeProject = "project"
+
+	ProjectDir = ".rulepack/profiles"
+)
+
+// ErrNotFound reports a profile reference that matches no saved profile.
+var ErrNotFound = errors.New("not found locally")
+
 type Metadata struct {
 	ID          string           `json:"id"`
 	Alias       string           `json:"alias,omitempty"`
@@ -28,22 +44,115 @@ type Metadata struct {
 	CreatedAt   string           `json:"createdAt"`
 	ContentHash string           `json:"contentHash"`
 	ModuleCount int              `json:"moduleCount"`
+	// ModuleDigests maps each module ID to its ModuleDigest at save time, so
+	// drift can be traced to individual modules. Profiles saved before
+	// digests were recorded have none.
+	ModuleDigests map[string]string `json:"moduleDigests,omitempty"`
+	// Blobs maps each snapshot module path to the SHA-256 of its content in
+	// the store's blob directory (see BlobDir).
+	Blobs map[string]string `json:"blobs,omitempty"`
+	// EditBases maps each locally edited module ID to the blob of the source
+	// content the edit started from; see EditModule.
+	EditBases map[string]string `json:"editBases,omitempty"`
+	// Conflicts lists modules a refresh could not merge with their local
+	// edits. They hold conflict markers until edited again.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Exports maps named subsets of the snapshot to module ID patterns. The
+	// implicit "default" export always covers every module.
+	Exports map[string][]string `json:"exports,omitempty"`
+	// RefreshEvery is how often the snapshot should be refreshed from its
+	// sources, e.g. "30d"; see ParseRefreshEvery.
+	RefreshEvery string `json:"refreshEvery,omitempty"`
+	// RefreshedAt is when the snapshot was last written.
+	RefreshedAt string `json:"refreshedAt,omitempty"`
+	// Scope is the store the profile was read from. It is not persisted.
+	Scope string `json:"scope,omitempty"`
+
+	dir string
 }
 
-type SourceSnapshot struct {
-	SourceType   string            `json:"sourceType"`
-	SourceRef    string            `json:"sourceRef"`
-	SourceExport string            `json:"sourceExport,omitempty"`
-	Provenance   map[string]string `json:"provenance,omitempty"`
-	ModuleIDs    []string          `json:"moduleIds,omitempty"`
+// ExportNames returns "default" followed by the profile's named exports in
+// sorted order.
+func (m Metadata) ExportNames() []string {
+	names := make([]string, 0, len(m.Exports)+1)
+	for name := range m.Exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{"default"}, names...)
 }
 
+// LastRefreshed returns when the snapshot was last written, falling back to
+// its creation time for profiles saved before refreshedAt was recorded.
+func (m Metadata) LastRefreshed() (time.Time, bool) {
+	stamp := m.RefreshedAt
+	if stamp == "" {
+		stamp = m.CreatedAt
+	}
+	t, err := time.Parse(time.RFC3339, stamp)
+	return t, err == nil
+}
+
+// RefreshDue reports whether the profile has a refreshEvery interval that
+// has passed since it was last refreshed. A profile with no usable
+// timestamp is always due.
+func (m Metadata) RefreshDue(now time.Time) bool {
+	if m.RefreshEvery == "" {
+		return false
+	}
+	every, err := ParseRefreshEvery(m.RefreshEvery)
+	if err != nil {
+		return false
+	}
+	last, ok := m.LastRefreshed()
+	return !ok || now.Sub(last) > every
+}
+
+// ParseRefreshEvery parses a refresh interval: a whole number of days
+// ("30d") or weeks ("2w"), or a Go duration such as "12h".
+func ParseRefreshEvery(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	unit := time.Duration(0)
+	switch {
+	case strings.HasSuffix(s, "d"):
+		unit = 24 * time.Hour
+	case strings.HasSuffix(s, "w"):
+		unit = 7 * 24 * time.Hour
+	}
+	if unit > 0 {
+		if n, err := strconv.Atoi(s[:len(s)-1]); err == nil && n > 0 {
+			return time.Duration(n) * unit, nil
+		}
+	} else if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid refreshEvery %q: use a positive duration like 30d, 2w, or 12h", s)
+}
+
+// SourceSnapshot is shared with the lockfile, which copies a saved profile's
+// sources into its entry.
+type SourceSnapshot = config.SourceSnapshot
+
 type SaveInput struct {
 	ID          string
 	Alias       string
 	Sources     []SourceSnapshot
 	ContentHash string
 	Modules     []pack.Module
+	// Exports names subsets of Modules by ID pattern. When nil, a re-save of
+	// an existing profile keeps its exports.
+	Exports map[string][]string
+	// Scope selects the store to save into: ScopeGlobal (the default) or
+	// ScopeProject.
+	Scope string
+	// RefreshEvery sets the refresh interval. When empty, a re-save of an
+	// existing profile keeps its interval.
+	RefreshEvery string
+	// EditBases maps locally edited module IDs to the source content each
+	// edit started from, and Conflicts lists modules left with conflict
+	// markers. A save without them has no local edits.
+	EditBases map[string]string
+	Conflicts []string
 }
 
 func GlobalRoot() (string, error) {
@@ -54,12 +163,33 @@ func GlobalRoot() (string, error) {
 	return filepath.Join(home, ".rulepack", "profiles"), nil
 }
 
+// ProjectRoot returns the project profile store under the current directory.
+func ProjectRoot() (string, error) {
+	return filepath.Abs(filepath.FromSlash(ProjectDir))
+}
+
+// Root returns the directory of the store for scope.
+func Root(scope string) (string, error) {
+	switch scope {
+	case "", ScopeGlobal:
+		return GlobalRoot()
+	case ScopeProject:
+		return ProjectRoot()
+	default:
+		return "", fmt.Errorf("unknown profile scope %q: use global or project", scope)
+	}
+}
+
+// storeScopes lists the stores in lookup order.
+var storeScopes = []string{ScopeProject, ScopeGlobal}
+
 func SaveSnapshot(input SaveInput) (Metadata, error) {
-	root, err := GlobalRoot()
-	if err != nil {
-		return Metadata{}, err
+	scope := input.Scope
+	if scope == "" {
+		scope = ScopeGlobal
 	}
-	if err := os.MkdirAll(root, 0o755); err != nil {
+	root, err := Root(scope)
+	if err != nil {
 		return Metadata{}, err
 	}
 	if input.ContentHash == "" {
@@ -72,30 +202,64 @@ func SaveSnapshot(input SaveInput) (Metadata, error) {
 	if id == "" {
 		id = buildID(input.Sources, input.ContentHash)
 	}
+	if input.RefreshEvery != "" {
+		if _, err := ParseRefreshEvery(input.RefreshEvery); err != nil {
+			return Metadata{}, err
+		}
+	}
+	unlock, err := lockStore(root)
+	if err != nil {
+		return Metadata{}, err
+	}
+	defer unlock()
+
 	profileDir := filepath.Join(root, id)
-	if err := os.MkdirAll(profileDir, 0o755); err != nil {
+	existing, existingErr := readProfile(profileDir)
+	_, statErr := os.Stat(profileDir)
+	resaved := statErr == nil
+	exports := input.Exports
+	if exports == nil && existingErr == nil {
+		exports = existing.Exports
+	}
+	if err := validateExports(exports, input.Modules); err != nil {
+		return Metadata{}, err
+	}
+	alias := input.Alias
+	if alias == "" && existingErr == nil {
+		alias = existing.Alias
+	}
+	if err := ensureAliasUnique(root, alias, id); err != nil {
+		return Metadata{}, err
+	}
+	// The profile is written to a staging directory and swapped into place,
+	// so a failed or concurrent save never leaves a partial profile behind.
+	stage, err := os.MkdirTemp(root, ".save-*")
+	if err != nil {
 		return Metadata{}, err
 	}
+	defer os.RemoveAll(stage)
 
 	modules := make([]snapshotModule, 0, len(input.Modules))
 	pathToModule := make(map[string]string, len(input.Modules))
+	blobs := make(map[string]string, len(input.Modules))
 	for _, m := range input.Modules {
 		relPath := snapshotModulePath(m)
 		if existingID, ok := pathToModule[relPath]; ok {
 			return Metadata{}, fmt.Errorf("profile output collision: modules %s and %s both map to %s", existingID, m.ID, relPath)
 		}
 		pathToModule[relPath] = m.ID
-		fullPath := filepath.Join(profileDir, filepath.FromSlash(relPath))
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
-			return Metadata{}, err
-		}
-		if err := os.WriteFile(fullPath, []byte(m.Content), 0o644); err != nil {
+		digest, err := writeBlob(root, []byte(m.Content))
+		if err != nil {
 			return Metadata{}, err
 		}
+		blobs[relPath] = digest
 		modules = append(modules, snapshotModule{
 			ID:       m.ID,
 			Path:     relPath,
 			Priority: m.Priority,
+			Band:     m.Band,
+			Owner:    m.Owner,
+			When:     m.When,
 			Apply:    m.Apply,
 		})
 	}
@@ -109,80 +273,180 @@ func SaveSnapshot(input SaveInput) (Metadata, error) {
 		SpecVersion: "0.1",
 		Name:        "saved-profile-" + id,
 		Version:     "1.0.0",
+		License:     combinedLicense(input.Modules),
 		Modules:     modules,
 		Exports: map[string]snapshotExport{
 			"default": {Include: []string{"**"}},
 		},
 	}
-	if err := writeJSON(filepath.Join(profileDir, "rulepack.json"), rp); err != nil {
+	for name, patterns := range exports {
+		rp.Exports[name] = snapshotExport{Include: patterns}
+	}
+	if err := writeJSON(filepath.Join(stage, "rulepack.json"), rp); err != nil {
 		return Metadata{}, err
 	}
 
+	digests := make(map[string]string, len(input.Modules))
+	for _, m := range input.Modules {
+		digests[m.ID] = ModuleDigest(m)
+	}
+	var editBases map[string]string
+	for id, content := range input.EditBases {
+		if _, ok := digests[id]; !ok {
+			return Metadata{}, fmt.Errorf("edit base for unknown module %s", id)
+		}
+		digest, err := writeBlob(root, []byte(content))
+		if err != nil {
+			return Metadata{}, err
+		}
+		if editBases == nil {
+			editBases = map[string]string{}
+		}
+		editBases[id] = digest
+	}
+	var conflicts []string
+	if len(input.Conflicts) > 0 {
+		conflicts = slices.Sorted(slices.Values(input.Conflicts))
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
 	meta := Metadata{
-		ID:          id,
-		Alias:       input.Alias,
-		Sources:     input.Sources,
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		ContentHash: input.ContentHash,
-		ModuleCount: len(input.Modules),
-	}
-	metaPath := filepath.Join(profileDir, "profile.json")
-	if _, err := os.Stat(metaPath); err == nil {
-		existing, readErr := readProfile(profileDir)
-		if readErr == nil {
-			// Preserve original creation time/metadata for deterministic IDs.
-			meta.CreatedAt = existing.CreatedAt
-			if input.Alias == "" {
-				meta.Alias = existing.Alias
-			}
+		ID:            id,
+		Alias:         alias,
+		Sources:       input.Sources,
+		CreatedAt:     now,
+		ContentHash:   input.ContentHash,
+		ModuleCount:   len(input.Modules),
+		ModuleDigests: digests,
+		Blobs:         blobs,
+		EditBases:     editBases,
+		Conflicts:     conflicts,
+		Exports:       exports,
+		RefreshEvery:  input.RefreshEvery,
+		RefreshedAt:   now,
+	}
+	if existingErr == nil {
+		// Preserve original creation time/metadata for deterministic IDs.
+		meta.CreatedAt = existing.CreatedAt
+		if input.RefreshEvery == "" {
+			meta.RefreshEvery = existing.RefreshEvery
 		}
 	}
-	if err := ensureAliasUnique(root, meta.Alias, meta.ID); err != nil {
+	if err := writeJSON(filepath.Join(stage, "profile.json"), meta); err != nil {
 		return Metadata{}, err
 	}
-	if err := writeJSON(metaPath, meta); err != nil {
+	// Module files kept before the blob store go away with the old directory.
+	if err := replaceDir(stage, profileDir); err != nil {
 		return Metadata{}, err
 	}
+	if resaved {
+		if err := pruneBlobs(root); err != nil {
+			return Metadata{}, err
+		}
+	}
+	meta.Scope = scope
+	meta.dir = profileDir
 	return meta, nil
 }
 
+// List returns the profiles in every store, sorted by ID. A project profile
+// hides a global one with the same ID.
 func List() ([]Metadata, error) {
-	root, err := GlobalRoot()
+	out := []Metadata{}
+	seen := map[string]bool{}
+	for _, scope := range storeScopes {
+		profiles, _, err := listScope(scope)
+		if err != nil {
+			return nil, err
+		}
+		for _, meta := range profiles {
+			if seen[meta.ID] {
+				continue
+			}
+			seen[meta.ID] = true
+			out = append(out, meta)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// Unreadable is a profile store directory that List skips because it holds
+// no usable profile, with the reason why.
+type Unreadable struct {
+	ID     string `json:"id"`
+	Scope  string `json:"scope"`
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// ListUnreadable returns the store directories List skips, project store
+// first, each sorted by ID.
+func ListUnreadable() ([]Unreadable, error) {
+	out := []Unreadable{}
+	for _, scope := range storeScopes {
+		_, unreadable, err := listScope(scope)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, unreadable...)
+	}
+	return out, nil
+}
+
+func listScope(scope string) ([]Metadata, []Unreadable, error) {
+	root, err := Root(scope)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	entries, err := os.ReadDir(root)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, nil
+			return nil, nil, nil
 		}
-		return nil, err
+		return nil, nil, err
 	}
 	out := make([]Metadata, 0, len(entries))
+	unreadable := []Unreadable{}
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !isStoreEntry(entry) {
 			continue
 		}
-		meta, err := readProfile(filepath.Join(root, entry.Name()))
+		profileDir := filepath.Join(root, entry.Name())
+		meta, err := readProfile(profileDir)
 		if err != nil {
+			reason := err.Error()
+			if errors.Is(err, os.ErrNotExist) {
+				reason = "missing profile.json"
+			}
+			unreadable = append(unreadable, Unreadable{ID: entry.Name(), Scope: scope, Path: profileDir, Reason: reason})
 			continue
 		}
+		meta.Scope = scope
+		meta.dir = profileDir
 		out = append(out, meta)
 	}
-	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
-	return out, nil
+	return out, unreadable, nil
 }
 
 func ResolveIDOrAlias(ref string) (Metadata, string, error) {
-	root, err := GlobalRoot()
-	if err != nil {
-		return Metadata{}, "", err
-	}
-	directPath := filepath.Join(root, ref)
-	if meta, err := readProfile(directPath); err == nil {
-		return meta, directPath, nil
-	} else if _, statErr := os.Stat(directPath); statErr == nil {
-		return Metadata{}, "", err
+	roots := make([]string, 0, len(storeScopes))
+	for _, scope := range storeScopes {
+		root, err := Root(scope)
+		if err != nil {
+			return Metadata{}, "", err
+		}
+		roots = append(roots, root)
+		if ref == BlobDir || strings.HasPrefix(ref, ".") {
+			continue
+		}
+		directPath := filepath.Join(root, ref)
+		if meta, err := readProfile(directPath); err == nil {
+			meta.Scope = scope
+			meta.dir = directPath
+			return meta, directPath, nil
+		} else if _, statErr := os.Stat(directPath); statErr == nil {
+			return Metadata{}, "", err
+		}
 	}
 
 	all, err := List()
@@ -195,9 +459,16 @@ func ResolveIDOrAlias(ref string) (Metadata, string, error) {
 			matches = append(matches, entry)
 		}
 	}
+	// An alias in the project store shadows the same alias globally.
+	if slices.ContainsFunc(matches, func(m Metadata) bool { return m.Scope == ScopeProject }) {
+		matches = slices.DeleteFunc(matches, func(m Metadata) bool { return m.Scope != ScopeProject })
+	}
 	if len(matches) == 0 {
-		entries, err := os.ReadDir(root)
-		if err == nil {
+		for _, root := range roots {
+			entries, err := os.ReadDir(root)
+			if err != nil {
+				continue
+			}
 			for _, entry := range entries {
 				if !entry.IsDir() {
 					continue
@@ -218,40 +489,106 @@ func ResolveIDOrAlias(ref string) (Metadata, string, error) {
 		}
 	}
 	if len(matches) == 0 {
-		return Metadata{}, "", fmt.Errorf("profile %q not found locally", ref)
+		return Metadata{}, "", fmt.Errorf("profile %q %w%s", ref, ErrNotFound, selector.Hint(selector.Suggest(ref, profileNames(all))))
 	}
 	if len(matches) > 1 {
-		return Metadata{}, "", fmt.Errorf("alias %q resolves to multiple profiles", ref)
+		return Metadata{}, "", fmt.Errorf("alias %q resolves to multiple profiles: %s", ref, describeProfiles(matches))
 	}
-	return matches[0], filepath.Join(root, matches[0].ID), nil
+	return matches[0], matches[0].dir, nil
 }
 
-func Remove(ref string) (Metadata, string, error) {
+// ResolveSelector resolves a profile typed on the command line. Beyond
+// ResolveIDOrAlias it accepts a unique prefix of an ID or alias; a prefix
+// shared by several profiles fails and lists them.
+func ResolveSelector(ref string) (Metadata, string, error) {
 	meta, profileDir, err := ResolveIDOrAlias(ref)
+	if err == nil || !errors.Is(err, ErrNotFound) {
+		return meta, profileDir, err
+	}
+	all, listErr := List()
+	if listErr != nil {
+		return Metadata{}, "", listErr
+	}
+	candidates := make([][]string, len(all))
+	for i, p := range all {
+		candidates[i] = []string{p.ID, p.Alias}
+	}
+	indexes := selector.Match(ref, candidates)
+	switch len(indexes) {
+	case 0:
+		return Metadata{}, "", err
+	case 1:
+		return ResolveIDOrAlias(all[indexes[0]].ID)
+	default:
+		matches := make([]Metadata, len(indexes))
+		for i, idx := range indexes {
+			matches[i] = all[idx]
+		}
+		return Metadata{}, "", fmt.Errorf("profile %q is ambiguous: matches %s", ref, describeProfiles(matches))
+	}
+}
+
+func profileNames(profiles []Metadata) []string {
+	names := make([]string, 0, len(profiles)*2)
+	for _, p := range profiles {
+		names = append(names, p.ID, p.Alias)
+	}
+	return names
+}
+
+// describeProfiles lists profiles as "id (alias)" for ambiguity errors.
+func describeProfiles(profiles []Metadata) string {
+	parts := make([]string, len(profiles))
+	for i, p := range profiles {
+		parts[i] = p.ID
+		if p.Alias != "" {
+			parts[i] += " (" + p.Alias + ")"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func Remove(ref string) (Metadata, string, error) {
+	meta, profileDir, err := ResolveSelector(ref)
+	if err != nil {
+		return Metadata{}, "", err
+	}
+	unlock, err := lockStore(filepath.Dir(profileDir))
 	if err != nil {
 		return Metadata{}, "", err
 	}
-	if err := os.RemoveAll(profileDir); err != nil {
+	defer unlock()
+	if err := discardDir(profileDir); err != nil {
+		return Metadata{}, "", err
+	}
+	if err := pruneBlobs(filepath.Dir(profileDir)); err != nil {
 		return Metadata{}, "", err
 	}
 	return meta, profileDir, nil
 }
 
+// RemoveAll deletes every profile in the global store. Project profiles are
+// left alone since they belong to the repository.
 func RemoveAll() ([]Metadata, error) {
 	root, err := GlobalRoot()
 	if err != nil {
 		return nil, err
 	}
+	if _, err := os.Stat(root); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	unlock, err := lockStore(root)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 	entries, err := os.ReadDir(root)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil, nil
-		}
 		return nil, err
 	}
 	removed := make([]Metadata, 0, len(entries))
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !isStoreEntry(entry) {
 			continue
 		}
 		profileDir := filepath.Join(root, entry.Name())
@@ -259,11 +596,14 @@ func RemoveAll() ([]Metadata, error) {
 		if err != nil {
 			continue
 		}
-		if err := os.RemoveAll(profileDir); err != nil {
+		if err := discardDir(profileDir); err != nil {
 			return nil, err
 		}
 		removed = append(removed, meta)
 	}
+	if err := pruneBlobs(root); err != nil {
+		return nil, err
+	}
 	sort.Slice(removed, func(i, j int) bool { return removed[i].ID < removed[j].ID })
 	return removed, nil
 }
@@ -283,6 +623,42 @@ func buildID(sources []SourceSnapshot, contentHash string) string {
 	return sourcePrefix + "__default__" + hashPrefix
 }
 
+// ModuleDigest identifies what a module renders: its ID, priority, content,
+// and apply settings. Pack name, version, and path are left out so a module
+// digests the same read from its source or from a snapshot.
+func ModuleDigest(m pack.Module) string {
+	applyJSON, _ := json.Marshal(m.Apply)
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%d|%s|%s", m.ID, m.Priority, m.Content, string(applyJSON))))
+	return hex.EncodeToString(sum[:])
+}
+
+// DigestDiff compares modules with the digests recorded at save time. It
+// returns the sorted IDs whose digest changed, that were not recorded, and
+// that were recorded but are not in modules.
+func (m Metadata) DigestDiff(modules []pack.Module) (changed, added, removed []string) {
+	changed, added, removed = []string{}, []string{}, []string{}
+	seen := make(map[string]bool, len(modules))
+	for _, mod := range modules {
+		seen[mod.ID] = true
+		digest, ok := m.ModuleDigests[mod.ID]
+		switch {
+		case !ok:
+			added = append(added, mod.ID)
+		case digest != ModuleDigest(mod):
+			changed = append(changed, mod.ID)
+		}
+	}
+	for id := range m.ModuleDigests {
+		if !seen[id] {
+			removed = append(removed, id)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(added)
+	sort.Strings(removed)
+	return changed, added, removed
+}
+
 func ComputeContentHash(modules []pack.Module, export string) string {
 	type item struct {
 		ID          string
@@ -339,6 +715,80 @@ func ComputeContentHash(modules []pack.Module, export string) string {
 	return hex.EncodeToString(sum[:])
 }
 
+// validateExports checks that every named export has patterns, does not
+// shadow "default", and selects at least one module.
+func validateExports(exports map[string][]string, modules []pack.Module) error {
+	names := make([]string, 0, len(exports))
+	for name := range exports {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		patterns := exports[name]
+		switch {
+		case strings.TrimSpace(name) == "":
+			return errors.New("profile export name must not be empty")
+		case name == "default":
+			return errors.New(`profile export "default" is reserved for the whole snapshot`)
+		case len(patterns) == 0:
+			return fmt.Errorf("profile export %q has no module patterns", name)
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("profile export %q: invalid pattern %q: %w", name, pattern, err)
+			}
+		}
+		matched := false
+		for _, m := range modules {
+			if pack.MatchesID(m.ID, patterns) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Errorf("profile export %q matches no modules", name)
+		}
+	}
+	return nil
+}
+
+// combinedLicense joins the distinct source licenses into an SPDX AND
+// expression. Any module without a license makes the snapshot unlicensed.
+func combinedLicense(modules []pack.Module) string {
+	seen := map[string]struct{}{}
+	licenses := []string{}
+	for _, m := range modules {
+		if m.PackLicense == "" {
+			return ""
+		}
+		if _, ok := seen[m.PackLicense]; ok {
+			continue
+		}
+		seen[m.PackLicense] = struct{}{}
+		licenses = append(licenses, m.PackLicense)
+	}
+	sort.Strings(licenses)
+	if len(licenses) > 1 {
+		for i, license := range licenses {
+			if isCompoundLicense(license) {
+				licenses[i] = "(" + license + ")"
+			}
+		}
+	}
+	return strings.Join(licenses, " AND ")
+}
+
+// isCompoundLicense reports whether an SPDX expression uses an operator, and
+// so needs parentheses to keep its meaning inside an AND.
+func isCompoundLicense(license string) bool {
+	for _, word := range strings.Fields(strings.ToLower(license)) {
+		if word == "and" || word == "or" || word == "with" {
+			return true
+		}
+	}
+	return false
+}
+
 func sanitizeID(s string) string {
 	s = strings.TrimSpace(s)
 	if s == "" {
@@ -401,7 +851,7 @@ func readProfile(profileDir string) (Metadata, error) {
 	}
 	var meta Metadata
 	if err := json.Unmarshal(bytes, &meta); err != nil {
-		return Metadata{}, err
+		return Metadata{}, fmt.Errorf("parse profile.json: %w", err)
 	}
 	if meta.ID == "" {
 		return Metadata{}, errors.New("invalid profile metadata")
@@ -425,7 +875,7 @@ func ensureAliasUnique(root, alias, currentID string) error {
 		return err
 	}
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !isStoreEntry(entry) {
 			continue
 		}
 		meta, err := readProfile(filepath.Join(root, entry.Name()))
@@ -469,6 +919,7 @@ type snapshotRulepack struct {
 	SpecVersion string                    `json:"specVersion"`
 	Name        string                    `json:"name"`
 	Version     string                    `json:"version"`
+	License     string                    `json:"license,omitempty"`
 	Modules     []snapshotModule          `json:"modules"`
 	Exports     map[string]snapshotExport `json:"exports,omitempty"`
 }
@@ -477,6 +928,9 @@ type snapshotModule struct {
 	ID       string           `json:"id"`
 	Path     string           `json:"path"`
 	Priority int              `json:"priority"`
+	Band     string           `json:"band,omitempty"`
+	Owner    string           `json:"owner,omitempty"`
+	When     *config.When     `json:"when,omitempty"`
 	Apply    pack.ApplyConfig `json:"apply,omitempty"`
 }
 
@@ -1,11 +1,14 @@
 package profile
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
+	"rulepack/internal/config"
 	"rulepack/internal/pack"
 )
 
@@ -84,6 +87,45 @@ func TestAliasCollision(t *testing.T) {
 	}
 }
 
+func TestResolveSelectorPrefixesAndSuggestions(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	save := func(alias string, modules []pack.Module) Metadata {
+		t.Helper()
+		meta, err := SaveSnapshot(SaveInput{
+			Alias:       alias,
+			Sources:     []SourceSnapshot{{SourceType: "git", SourceRef: "https://example.com/" + alias + ".git", ModuleIDs: []string{modules[0].ID}}},
+			ContentHash: ComputeContentHash(modules, ""),
+			Modules:     modules,
+		})
+		if err != nil {
+			t.Fatalf("SaveSnapshot %s: %v", alias, err)
+		}
+		return meta
+	}
+	base := save("python-base", sampleModules())
+	save("python-ml", []pack.Module{{ID: "b", Priority: 1, Content: "b\n"}})
+
+	got, _, err := ResolveSelector("python-b")
+	if err != nil || got.ID != base.ID {
+		t.Fatalf("expected unique alias prefix to resolve, got %+v (%v)", got, err)
+	}
+	got, _, err = ResolveSelector(base.ID[:12])
+	if err != nil || got.ID != base.ID {
+		t.Fatalf("expected unique id prefix to resolve, got %+v (%v)", got, err)
+	}
+	_, _, err = ResolveSelector("python")
+	if err == nil || !strings.Contains(err.Error(), `profile "python" is ambiguous`) || !strings.Contains(err.Error(), "(python-base)") || !strings.Contains(err.Error(), "(python-ml)") {
+		t.Fatalf("expected ambiguity error listing both profiles, got %v", err)
+	}
+	_, _, err = ResolveSelector("pyhton-ml")
+	if !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), `did you mean "python-ml"?`) {
+		t.Fatalf("expected suggestion, got %v", err)
+	}
+	if _, _, err := ResolveIDOrAlias("python-b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("ResolveIDOrAlias should not accept prefixes, got %v", err)
+	}
+}
+
 func TestSaveSnapshot_PreservesNestedModulePath(t *testing.T) {
 	t.Setenv("HOME", t.TempDir())
 	modules := []pack.Module{
@@ -111,13 +153,19 @@ func TestSaveSnapshot_PreservesNestedModulePath(t *testing.T) {
 	if err != nil {
 		t.Fatalf("SaveSnapshot: %v", err)
 	}
-	root, err := GlobalRoot()
+	if _, ok := meta.Blobs["modules/backend/api/100-auth.md"]; !ok {
+		t.Fatalf("expected nested profile module path, got blobs %#v", meta.Blobs)
+	}
+	_, dir, err := ResolveIDOrAlias(meta.ID)
 	if err != nil {
-		t.Fatalf("GlobalRoot: %v", err)
+		t.Fatalf("ResolveIDOrAlias: %v", err)
 	}
-	outPath := filepath.Join(root, meta.ID, "modules", "backend", "api", "100-auth.md")
-	if _, err := os.Stat(outPath); err != nil {
-		t.Fatalf("expected nested profile module path, stat err=%v", err)
+	read, _, err := Expand(dir, config.Dependency{Source: ProfileSource, Profile: meta.ID}, pack.Options{})
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if len(read) != 1 || read[0].Path != "modules/backend/api/100-auth.md" || read[0].Content != "a\n" {
+		t.Fatalf("unexpected snapshot modules: %#v", read)
 	}
 }
 
@@ -159,3 +207,441 @@ func sampleModules() []pack.Module {
 		{PackName: "x", PackVersion: "1.0.0", Commit: "abc", ID: "a", Priority: 10, Content: "a\n"},
 	}
 }
+
+func TestSaveSnapshot_ValidatesExports(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	modules := []pack.Module{{ID: "python.base", Priority: 100, Content: "x\n"}}
+	input := SaveInput{
+		Sources:     []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/x"}},
+		ContentHash: ComputeContentHash(modules, "default"),
+		Modules:     modules,
+	}
+	for _, tc := range []struct {
+		exports map[string][]string
+		want    string
+	}{
+		{map[string][]string{"default": {"*"}}, "reserved"},
+		{map[string][]string{"go": {"go.*"}}, `export "go" matches no modules`},
+		{map[string][]string{"py": {}}, "has no module patterns"},
+	} {
+		input.Exports = tc.exports
+		if _, err := SaveSnapshot(input); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Fatalf("exports %v: expected error containing %q, got %v", tc.exports, tc.want, err)
+		}
+	}
+
+	input.Exports = map[string][]string{"py": {"python.*"}}
+	meta, err := SaveSnapshot(input)
+	if err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	input.Exports = nil
+	again, err := SaveSnapshot(input)
+	if err != nil {
+		t.Fatalf("re-save: %v", err)
+	}
+	if again.ID != meta.ID || len(again.Exports["py"]) != 1 {
+		t.Fatalf("expected re-save to keep exports, got %#v", again)
+	}
+}
+
+func TestRefreshDue(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want time.Duration
+	}{
+		{"30d", 30 * 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+		{"12h", 12 * time.Hour},
+	} {
+		got, err := ParseRefreshEvery(tc.in)
+		if err != nil || got != tc.want {
+			t.Fatalf("ParseRefreshEvery(%q) = %v, %v; want %v", tc.in, got, err, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "0d", "-1w", "soon", "1.5d"} {
+		if _, err := ParseRefreshEvery(bad); err == nil {
+			t.Fatalf("ParseRefreshEvery(%q): expected error", bad)
+		}
+	}
+
+	now := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	meta := Metadata{CreatedAt: "2026-01-01T00:00:00Z", RefreshedAt: "2026-03-01T00:00:00Z"}
+	if meta.RefreshDue(now) {
+		t.Fatalf("profile without refreshEvery must never be due")
+	}
+	meta.RefreshEvery = "7d"
+	if !meta.RefreshDue(now) {
+		t.Fatalf("expected profile refreshed 9 days ago to be due every 7d")
+	}
+	meta.RefreshEvery = "2w"
+	if meta.RefreshDue(now) {
+		t.Fatalf("expected profile refreshed 9 days ago not to be due every 2w")
+	}
+	meta.RefreshedAt = ""
+	if !meta.RefreshDue(now) {
+		t.Fatalf("expected fallback to createdAt")
+	}
+}
+
+func TestSaveSnapshot_RecordsModuleDigests(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	modules := []pack.Module{
+		{PackName: "x", ID: "a", Priority: 10, Content: "a\n"},
+		{PackName: "x", ID: "b", Priority: 20, Content: "b\n"},
+	}
+	meta, err := SaveSnapshot(SaveInput{
+		Sources:     []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/x"}},
+		ContentHash: ComputeContentHash(modules, "default"),
+		Modules:     modules,
+	})
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if len(meta.ModuleDigests) != 2 || meta.ModuleDigests["a"] != ModuleDigest(modules[0]) {
+		t.Fatalf("unexpected module digests: %#v", meta.ModuleDigests)
+	}
+
+	// Pack metadata differs between a source and its snapshot; only rendered
+	// content counts.
+	snapshot := []pack.Module{
+		{PackName: "saved-profile-" + meta.ID, ID: "a", Priority: 10, Content: "a edited\n"},
+		{PackName: "saved-profile-" + meta.ID, ID: "c", Priority: 30, Content: "c\n"},
+	}
+	changed, added, removed := meta.DigestDiff(snapshot)
+	if strings.Join(changed, ",") != "a" || strings.Join(added, ",") != "c" || strings.Join(removed, ",") != "b" {
+		t.Fatalf("unexpected digest diff: changed=%v added=%v removed=%v", changed, added, removed)
+	}
+	changed, added, removed = meta.DigestDiff([]pack.Module{{PackName: "other", ID: "a", Priority: 10, Content: "a\n"}, {ID: "b", Priority: 20, Content: "b\n"}})
+	if len(changed)+len(added)+len(removed) != 0 {
+		t.Fatalf("expected no differences, got changed=%v added=%v removed=%v", changed, added, removed)
+	}
+}
+
+func TestSaveSnapshot_CombinesCompoundLicensesWithParentheses(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	modules := []pack.Module{
+		{PackName: "dual", PackLicense: "Apache-2.0 OR GPL-3.0-only", ID: "a", Priority: 10, Content: "a\n"},
+		{PackName: "mit", PackLicense: "MIT", ID: "b", Priority: 20, Content: "b\n"},
+	}
+	meta, err := SaveSnapshot(SaveInput{
+		Sources:     []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/x"}},
+		ContentHash: ComputeContentHash(modules, "default"),
+		Modules:     modules,
+	})
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	_, dir, err := ResolveIDOrAlias(meta.ID)
+	if err != nil {
+		t.Fatalf("ResolveIDOrAlias: %v", err)
+	}
+	reader, err := Reader(dir)
+	if err != nil {
+		t.Fatalf("Reader: %v", err)
+	}
+	license, err := pack.License(reader)
+	if err != nil {
+		t.Fatalf("License: %v", err)
+	}
+	if want := "(Apache-2.0 OR GPL-3.0-only) AND MIT"; license != want {
+		t.Fatalf("expected license %q, got %q", want, license)
+	}
+	if (&config.LicensePolicy{Allow: []string{"Apache-2.0"}}).Allows(license) {
+		t.Fatalf("expected MIT to still be required by %q", license)
+	}
+	if !(&config.LicensePolicy{Allow: []string{"Apache-2.0", "MIT"}}).Allows(license) {
+		t.Fatalf("expected Apache-2.0 and MIT to satisfy %q", license)
+	}
+}
+
+func TestSaveSnapshot_SharesBlobsAndPrunesOnRemove(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	shared := pack.Module{ID: "shared.base", Priority: 10, Content: "shared\n"}
+	save := func(alias string, extra pack.Module) Metadata {
+		t.Helper()
+		modules := []pack.Module{shared, extra}
+		meta, err := SaveSnapshot(SaveInput{
+			Alias:       alias,
+			Sources:     []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/" + alias}},
+			ContentHash: ComputeContentHash(modules, "default"),
+			Modules:     modules,
+		})
+		if err != nil {
+			t.Fatalf("SaveSnapshot %s: %v", alias, err)
+		}
+		return meta
+	}
+	a := save("a", pack.Module{ID: "a.only", Priority: 20, Content: "a\n"})
+	b := save("b", pack.Module{ID: "b.only", Priority: 20, Content: "b\n"})
+	root, err := GlobalRoot()
+	if err != nil {
+		t.Fatalf("GlobalRoot: %v", err)
+	}
+	blobCount := func() int {
+		t.Helper()
+		n := 0
+		err := filepath.WalkDir(filepath.Join(root, BlobDir), func(_ string, d os.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				n++
+			}
+			return err
+		})
+		if err != nil {
+			t.Fatalf("walk blobs: %v", err)
+		}
+		return n
+	}
+	if a.Blobs["modules/010-shared_base.md"] != b.Blobs["modules/010-shared_base.md"] {
+		t.Fatalf("expected identical content to share a blob: %#v %#v", a.Blobs, b.Blobs)
+	}
+	if got := blobCount(); got != 3 {
+		t.Fatalf("expected 3 distinct blobs, got %d", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, a.ID, "modules")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected no per-profile module copies, stat err=%v", err)
+	}
+	if _, _, err := ResolveIDOrAlias(BlobDir); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected blob directory not to resolve as a profile, got %v", err)
+	}
+
+	if _, _, err := Remove("a"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	if got := blobCount(); got != 2 {
+		t.Fatalf("expected a's own blob pruned, got %d blobs", got)
+	}
+	_, dir, err := ResolveIDOrAlias("b")
+	if err != nil {
+		t.Fatalf("ResolveIDOrAlias: %v", err)
+	}
+	modules, _, err := Expand(dir, config.Dependency{Source: ProfileSource, Profile: b.ID}, pack.Options{})
+	if err != nil || len(modules) != 2 {
+		t.Fatalf("expected b intact after pruning, got %#v (%v)", modules, err)
+	}
+}
+
+func TestSnapshotReader_RejectsMalformedDigests(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "profile")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	upper := strings.Repeat("A", 64)
+	for _, digest := range []string{"", "a", "../../secret", "../secret", upper, strings.Repeat("a", 63)} {
+		reader := snapshotReader{dir: dir, blobs: map[string]string{"modules/x.md": digest}}
+		if content, err := reader.ReadFile("modules/x.md"); err == nil || !strings.Contains(err.Error(), "invalid blob digest") {
+			t.Fatalf("digest %q: expected invalid digest error, got %q (%v)", digest, content, err)
+		}
+		meta := Metadata{ID: "p", dir: dir, EditBases: map[string]string{"x": digest}}
+		if _, _, err := meta.EditBase("x"); err == nil || !strings.Contains(err.Error(), "invalid blob digest") {
+			t.Fatalf("digest %q: expected invalid edit base digest error, got %v", digest, err)
+		}
+	}
+}
+
+func TestSaveSnapshot_ConcurrentSavesNeverExposePartialProfiles(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	save := func(n int) error {
+		modules := []pack.Module{{ID: "a", Priority: 10, Content: strings.Repeat("x", n) + "\n"}}
+		_, err := SaveSnapshot(SaveInput{
+			ID:          "shared",
+			Alias:       "shared",
+			Sources:     []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/x"}},
+			ContentHash: ComputeContentHash(modules, "default"),
+			Modules:     modules,
+		})
+		return err
+	}
+	if err := save(0); err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+
+	errs := make(chan error, 16)
+	for i := 1; i <= 8; i++ {
+		go func(n int) { errs <- save(n) }(i)
+		go func() {
+			for j := 0; j < 20; j++ {
+				profiles, err := List()
+				if err != nil {
+					errs <- err
+					return
+				}
+				for _, p := range profiles {
+					if _, _, err := Expand(p.dir, config.Dependency{Source: ProfileSource, Profile: p.ID}, pack.Options{}); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for i := 0; i < 16; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("concurrent profile access: %v", err)
+		}
+	}
+	profiles, err := List()
+	if err != nil || len(profiles) != 1 {
+		t.Fatalf("expected one intact profile, got %#v (%v)", profiles, err)
+	}
+}
+
+func TestLockStore_TakesOverStaleLocksAndClearsLeftovers(t *testing.T) {
+	root := t.TempDir()
+	savedTimeout := lockTimeout
+	defer func() { lockTimeout = savedTimeout }()
+	lockTimeout = 100 * time.Millisecond
+
+	unlock, err := lockStore(root)
+	if err != nil {
+		t.Fatalf("lockStore: %v", err)
+	}
+	if _, err := lockStore(root); err == nil || !strings.Contains(err.Error(), "is busy") {
+		t.Fatalf("expected busy store, got %v", err)
+	}
+	unlock()
+
+	leftover := filepath.Join(root, ".save-123")
+	if err := os.MkdirAll(leftover, 0o755); err != nil {
+		t.Fatalf("mkdir leftover: %v", err)
+	}
+	lockPath := filepath.Join(root, lockFileName)
+	if err := os.WriteFile(lockPath, []byte("1\n"), 0o644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("age lock: %v", err)
+	}
+	unlock, err = lockStore(root)
+	if err != nil {
+		t.Fatalf("expected stale lock to be taken over: %v", err)
+	}
+	defer unlock()
+	if _, err := os.Stat(leftover); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected interrupted save to be cleared, stat err=%v", err)
+	}
+}
+
+func TestTakeOverStaleLock_KeepsLockCreatedSince(t *testing.T) {
+	root := t.TempDir()
+	lockPath := filepath.Join(root, lockFileName)
+	if err := os.WriteFile(lockPath, []byte("1\n"), 0o644); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	old := time.Now().Add(-2 * staleLockAge)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatalf("age lock: %v", err)
+	}
+	stale, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatalf("stat lock: %v", err)
+	}
+	// Another waiter takes over the stale lock and creates its own before
+	// this one acts on what it saw.
+	takeOverStaleLock(lockPath, stale)
+	if _, err := os.Stat(lockPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected the stale lock removed, stat err=%v", err)
+	}
+	if err := os.WriteFile(lockPath, []byte("2\n"), 0o644); err != nil {
+		t.Fatalf("write fresh lock: %v", err)
+	}
+	takeOverStaleLock(lockPath, stale)
+	data, err := os.ReadFile(lockPath)
+	if err != nil || string(data) != "2\n" {
+		t.Fatalf("expected the fresh lock to survive a late takeover, got %q (%v)", data, err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected only the lock to remain, got %v (%v)", entries, err)
+	}
+}
+
+func TestMerge3(t *testing.T) {
+	base := "one\ntwo\nthree\nfour\n"
+	cases := []struct {
+		name, local, fresh, want string
+		conflict                 bool
+	}{
+		{"separate lines", "one\nTWO\nthree\nfour\n", "one\ntwo\nthree\nFOUR\n", "one\nTWO\nthree\nFOUR\n", false},
+		{"same change", "one\nTWO\nthree\nfour\n", "one\nTWO\nthree\nfour\n", "one\nTWO\nthree\nfour\n", false},
+		{"insert and delete", "zero\none\ntwo\nthree\nfour\n", "one\ntwo\nfour\n", "zero\none\ntwo\nfour\n", false},
+		{"overlap", "one\nlocal\nthree\nfour\n", "one\nsource\nthree\nfour\n", "one\n<<<<<<< local\nlocal\n=======\nsource\n>>>>>>> source\nthree\nfour\n", true},
+		{"unterminated last line", "one\ntwo\nthree\nmine", "one\ntwo\nthree\ntheirs", "one\ntwo\nthree\n<<<<<<< local\nmine\n=======\ntheirs\n>>>>>>> source\n", true},
+	}
+	for _, tc := range cases {
+		got, conflict := Merge3(base, tc.local, tc.fresh)
+		if got != tc.want || conflict != tc.conflict {
+			t.Fatalf("%s: Merge3 = %q, %v; want %q, %v", tc.name, got, conflict, tc.want, tc.conflict)
+		}
+	}
+}
+
+func TestEditModule_KeepsBaseForRefreshMerge(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	modules := []pack.Module{{ID: "team.style", Priority: 10, Content: "use tabs\nlint on save\nwrap at 100\n"}}
+	meta, err := SaveSnapshot(SaveInput{
+		Alias:       "team",
+		Sources:     []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/team"}},
+		ContentHash: ComputeContentHash(modules, "default"),
+		Modules:     modules,
+	})
+	if err != nil {
+		t.Fatalf("SaveSnapshot: %v", err)
+	}
+	if _, err := EditModule("team", "missing.module", "x\n"); err == nil {
+		t.Fatalf("expected editing an unknown module to fail")
+	}
+	edited, err := EditModule("team", "team.style", "use tabs\nlint on save\nwrap at 120\n")
+	if err != nil {
+		t.Fatalf("EditModule: %v", err)
+	}
+	if edited.ID != meta.ID {
+		t.Fatalf("expected edit to keep the profile ID, got %s", edited.ID)
+	}
+	// Removing an unrelated profile prunes blobs; the edit base must survive.
+	other := []pack.Module{{ID: "other.base", Priority: 10, Content: "other\n"}}
+	if _, err := SaveSnapshot(SaveInput{Alias: "other", Sources: []SourceSnapshot{{SourceType: "local", SourceRef: "/tmp/other"}}, ContentHash: ComputeContentHash(other, "default"), Modules: other}); err != nil {
+		t.Fatalf("SaveSnapshot other: %v", err)
+	}
+	if _, _, err := Remove("other"); err != nil {
+		t.Fatalf("Remove: %v", err)
+	}
+	edited, dir, err := ResolveIDOrAlias("team")
+	if err != nil {
+		t.Fatalf("ResolveIDOrAlias: %v", err)
+	}
+	if base, ok, err := edited.EditBase("team.style"); err != nil || !ok || base != "use tabs\nlint on save\nwrap at 100\n" {
+		t.Fatalf("EditBase = %q, %v, %v", base, ok, err)
+	}
+	current, _, err := Expand(dir, config.Dependency{Source: ProfileSource, Profile: edited.ID, Export: "default"}, pack.Options{})
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	fresh := []pack.Module{{ID: "team.style", Priority: 10, Content: "use spaces\nlint on save\nwrap at 100\n"}}
+	merge, err := MergeLocalEdits(edited, current, fresh)
+	if err != nil {
+		t.Fatalf("MergeLocalEdits: %v", err)
+	}
+	if merge.Modules[0].Content != "use spaces\nlint on save\nwrap at 120\n" || len(merge.Conflicts) != 0 || len(merge.Merged) != 1 {
+		t.Fatalf("unexpected clean merge: %#v", merge)
+	}
+	if merge.EditBases["team.style"] != fresh[0].Content {
+		t.Fatalf("expected the source content to become the new edit base, got %#v", merge.EditBases)
+	}
+
+	fresh[0].Content = "use tabs\nlint on save\nwrap at 80\n"
+	merge, err = MergeLocalEdits(edited, current, fresh)
+	if err != nil {
+		t.Fatalf("MergeLocalEdits: %v", err)
+	}
+	if !strings.Contains(merge.Modules[0].Content, "<<<<<<< local\nwrap at 120\n=======\nwrap at 80\n>>>>>>> source\n") || len(merge.Conflicts) != 1 {
+		t.Fatalf("expected a conflict, got %#v", merge)
+	}
+}
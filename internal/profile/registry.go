@@ -0,0 +1,131 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+
+	"rulepack/internal/config"
+	"rulepack/internal/git"
+	"rulepack/internal/pack"
+)
+
+// RegistryCacheRoot returns where registry profiles are cached once fetched.
+func RegistryCacheRoot() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".rulepack", "registry"), nil
+}
+
+// registryCacheDir is the cache directory of ref as published at commit.
+// Entries are keyed by commit, so a cached snapshot never changes.
+func registryCacheDir(registry, commit string, ref config.RemoteProfile) (string, error) {
+	root, err := RegistryCacheRoot()
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256([]byte(registry))
+	return filepath.Join(root, hex.EncodeToString(digest[:])[:12], commit, ref.Org, ref.Name, ref.Version), nil
+}
+
+// FetchRemote returns a local directory holding the registry profile ref as
+// published at commit, fetching the registry and copying the snapshot into
+// the cache when it is not there yet. An empty commit resolves the
+// registry's HEAD; the commit used is returned for the lockfile.
+func FetchRemote(gc *git.Client, registry string, ref config.RemoteProfile, commit string) (string, string, error) {
+	if commit != "" {
+		dir, err := registryCacheDir(registry, commit, ref)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := os.Stat(filepath.Join(dir, "rulepack.json")); err == nil {
+			return dir, commit, nil
+		}
+	}
+	repoDir, err := gc.EnsureRepo(registry)
+	if err != nil {
+		return "", "", fmt.Errorf("prepare profile registry %s: %w", registry, err)
+	}
+	if commit == "" {
+		res, err := gc.Resolve(repoDir, "", "")
+		if err != nil {
+			return "", "", fmt.Errorf("resolve profile registry %s: %w", registry, err)
+		}
+		commit = res.Commit
+	}
+	dir, err := registryCacheDir(registry, commit, ref)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "rulepack.json")); err == nil {
+		return dir, commit, nil
+	}
+
+	manifest, err := gc.ShowFile(repoDir, commit, path.Join(ref.Dir(), "rulepack.json"))
+	if err != nil {
+		return "", "", fmt.Errorf("profile %s not found in registry %s", ref, registry)
+	}
+	var rp pack.RulePack
+	if err := json.Unmarshal(manifest, &rp); err != nil {
+		return "", "", fmt.Errorf("profile %s: parse rulepack.json: %w", ref, err)
+	}
+	// Stage next to the cache entry and rename it into place, so an
+	// interrupted fetch never leaves a partial snapshot behind.
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return "", "", err
+	}
+	stage, err := os.MkdirTemp(filepath.Dir(dir), ".fetch-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.RemoveAll(stage)
+	if err := os.WriteFile(filepath.Join(stage, "rulepack.json"), manifest, 0o644); err != nil {
+		return "", "", err
+	}
+	var blobs map[string]string
+	if meta, err := gc.ShowFile(repoDir, commit, path.Join(ref.Dir(), "profile.json")); err == nil {
+		if err := os.WriteFile(filepath.Join(stage, "profile.json"), meta, 0o644); err != nil {
+			return "", "", err
+		}
+		var payload struct {
+			Blobs map[string]string `json:"blobs"`
+		}
+		if json.Unmarshal(meta, &payload) == nil {
+			blobs = payload.Blobs
+		}
+	}
+	for _, m := range rp.Modules {
+		target, err := pack.ModuleFile(stage, m.Path)
+		if err != nil {
+			return "", "", fmt.Errorf("profile %s module %s: %w", ref, m.ID, err)
+		}
+		content, err := gc.ShowFile(repoDir, commit, path.Join(ref.Dir(), m.Path))
+		if digest, ok := blobs[m.Path]; err != nil && ok && len(digest) > 2 {
+			// Profiles copied from a store reference the store's blobs, which
+			// the registry keeps at its root.
+			content, err = gc.ShowFile(repoDir, commit, path.Join(BlobDir, digest[:2], digest))
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("profile %s: read module %s (%s): %w", ref, m.ID, m.Path, err)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+			return "", "", err
+		}
+		if err := os.WriteFile(target, content, 0o644); err != nil {
+			return "", "", err
+		}
+	}
+	if err := os.Rename(stage, dir); err != nil {
+		// Another install may have cached the same commit first.
+		if _, statErr := os.Stat(filepath.Join(dir, "rulepack.json")); statErr != nil {
+			return "", "", err
+		}
+	}
+	return dir, commit, nil
+}
@@ -0,0 +1,102 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"rulepack/internal/config"
+	"rulepack/internal/pack"
+)
+
+// CustomData is what a custom target's template executes with.
+type CustomData struct {
+	// RulesetDigest is the lockfile's rulesetDigest, or empty.
+	RulesetDigest string
+	// Modules are sorted by priority, then ID, as every target composes them.
+	Modules []CustomModule
+}
+
+// CustomModule is one module as a custom template sees it. Mode, Globs, and
+// Description are its apply rule for the custom target, with Mode lowercased
+// and defaulting to always; Apply is the module's full apply metadata.
+type CustomModule struct {
+	ID          string
+	Priority    int
+	Content     string
+	Mode        string
+	Globs       []string
+	Description string
+	Apply       pack.ApplyConfig
+	Pack        string
+	Version     string
+	Commit      string
+	Path        string
+	Owner       string
+	// Provenance is the header comment other targets start module output
+	// with.
+	Provenance string
+}
+
+// customFuncs are the functions a custom template may call besides the
+// text/template builtins.
+var customFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// WriteCustom executes the entry's template and writes the result to
+// outFile. Modules with apply mode never for custom are left out.
+func WriteCustom(target config.TargetEntry, modules []pack.Module) error {
+	content, err := customContent(target, modules)
+	if err != nil {
+		return err
+	}
+	target = rootTarget(target)
+	if err := os.MkdirAll(filepath.Dir(target.OutFile), 0o755); err != nil {
+		return err
+	}
+	return writeOutput(target.OutFile, content, target)
+}
+
+func customContent(target config.TargetEntry, modules []pack.Module) (string, error) {
+	if target.Template == "" || target.OutFile == "" {
+		return "", fmt.Errorf("custom target requires template and outFile")
+	}
+	src, err := os.ReadFile(target.Template)
+	if err != nil {
+		return "", fmt.Errorf("custom template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(target.Template)).Funcs(customFuncs).Option("missingkey=error").Parse(string(src))
+	if err != nil {
+		return "", fmt.Errorf("custom template %s: %w", target.Template, err)
+	}
+	data := CustomData{RulesetDigest: target.RulesetDigest, Modules: make([]CustomModule, 0, len(modules))}
+	for _, m := range withoutNever(modules, "custom") {
+		rule := targetApplyRule(m, "custom")
+		data.Modules = append(data.Modules, CustomModule{
+			ID:          m.ID,
+			Priority:    m.Priority,
+			Content:     m.Content,
+			Mode:        resolveApplyMode(m, "custom"),
+			Globs:       rule.Globs,
+			Description: rule.Description,
+			Apply:       m.Apply,
+			Pack:        m.PackName,
+			Version:     m.PackVersion,
+			Commit:      m.Commit,
+			Path:        m.Path,
+			Owner:       m.Owner,
+			Provenance:  provenanceHeader(m),
+		})
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("custom template %s: %w", target.Template, err)
+	}
+	return normalize(out.String()), nil
+}
@@ -7,7 +7,9 @@ import (
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"rulepack/internal/config"
@@ -26,6 +28,7 @@ func WriteCursor(target config.TargetEntry, modules []pack.Module) error {
 	if target.OutDir == "" {
 		target.OutDir = ".cursor/rules"
 	}
+	target = rootTarget(target)
 	if err := os.MkdirAll(target.OutDir, 0o755); err != nil {
 		return err
 	}
@@ -41,129 +44,1418 @@ func WriteCursor(target config.TargetEntry, modules []pack.Module) error {
 		cursorModules = append(cursorModules, m)
 	}
 	if target.PerModule {
-		planned := make([]struct {
+		return writeCursorPerModule(target.OutDir, ext, target, cursorModules)
+	}
+	merged, sidecar, _, err := planCursorMerged(target, cursorModules)
+	if err != nil {
+		return err
+	}
+	if len(sidecar) > 0 {
+		if err := writeCursorPerModule(cursorSidecarDir(target), ".mdc", target, sidecar); err != nil {
+			return err
+		}
+	}
+	if target.OutFile == "" {
+		target.OutFile = filepath.Join(target.OutDir, "rules"+ext)
+	}
+	return writeOutput(target.OutFile, normalize(rulesetHeader(target.RulesetDigest)+merge(merged, true)), target)
+}
+
+func writeCursorPerModule(outDir string, ext string, target config.TargetEntry, modules []pack.Module) error {
+	planned := make([]struct {
+		module pack.Module
+		rule   cursorApplyRule
+		path   string
+	}, 0, len(modules))
+	pathToModule := make(map[string]string, len(modules))
+	for _, m := range modules {
+		rule, err := resolveCursorApplyRule(m)
+		if err != nil {
+			return err
+		}
+		fullPath := targetModuleFullPath(outDir, m, ext, target.Layout)
+		if existingID, ok := pathToModule[fullPath]; ok {
+			return fmt.Errorf("cursor output collision: modules %s and %s both map to %s", existingID, m.ID, fullPath)
+		}
+		pathToModule[fullPath] = m.ID
+		planned = append(planned, struct {
 			module pack.Module
 			rule   cursorApplyRule
 			path   string
-		}, 0, len(cursorModules))
-		pathToModule := make(map[string]string, len(cursorModules))
-		for _, m := range cursorModules {
+		}{module: m, rule: rule, path: fullPath})
+	}
+	for _, item := range planned {
+		if err := os.MkdirAll(filepath.Dir(item.path), 0o755); err != nil {
+			return err
+		}
+		content, err := cursorPerModuleContent(ext, item.module, item.rule, target.RulesetDigest)
+		if err != nil {
+			return err
+		}
+		if err := writeOutput(item.path, normalize(content), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// planCursorMerged splits modules for perModule=false output. Modes that need
+// frontmatter cannot live in a merged file, so they follow target.Fallback.
+func planCursorMerged(target config.TargetEntry, modules []pack.Module) (merged, sidecar, skipped []pack.Module, err error) {
+	for _, m := range modules {
+		rule, err := resolveCursorApplyRule(m)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if rule.Mode != "glob" && rule.Mode != "agent" && rule.Mode != "manual" {
+			merged = append(merged, m)
+			continue
+		}
+		switch target.Fallback {
+		case config.FallbackSkip:
+			skipped = append(skipped, m)
+		case config.FallbackSidecar:
+			sidecar = append(sidecar, m)
+		default:
+			return nil, nil, nil, fmt.Errorf("cursor target with perModule=false does not support apply mode %q for module %s (set fallback to skip or sidecar)", rule.Mode, m.ID)
+		}
+	}
+	return merged, sidecar, skipped, nil
+}
+
+func cursorSidecarDir(target config.TargetEntry) string {
+	if target.SidecarDir != "" {
+		return target.SidecarDir
+	}
+	if target.OutDir != "" {
+		return target.OutDir
+	}
+	return ".cursor/rules"
+}
+
+// CursorMergedFallbacks describes modules that a merged cursor build will
+// skip or move to the sidecar directory, for reporting as build warnings.
+func CursorMergedFallbacks(target config.TargetEntry, modules []pack.Module) ([]string, error) {
+	if target.PerModule {
+		return nil, nil
+	}
+	cursorModules := make([]pack.Module, 0, len(modules))
+	for _, m := range modules {
+		rule, err := resolveCursorApplyRule(m)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Mode != "never" {
+			cursorModules = append(cursorModules, m)
+		}
+	}
+	_, sidecar, skipped, err := planCursorMerged(target, cursorModules)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(sidecar)+len(skipped))
+	for _, m := range skipped {
+		out = append(out, fmt.Sprintf("cursor merged output skips module %s (apply mode requires perModule)", m.ID))
+	}
+	for _, m := range sidecar {
+		out = append(out, fmt.Sprintf("cursor merged output writes module %s to sidecar %s", m.ID, cursorSidecarDir(target)))
+	}
+	return out, nil
+}
+
+func CursorUnmanagedOverwrites(target config.TargetEntry, modules []pack.Module) ([]string, error) {
+	writePaths, err := cursorWritePaths(target, modules)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(writePaths))
+	for _, path := range writePaths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !isRulepackManagedCursorContent(string(data)) {
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
+
+// WriteClaude writes one rule file per module under .claude/rules, or with
+// perModule=false a merged CLAUDE.md. CLAUDE.md has no conditional loading,
+// so merged output includes every module except those with apply mode never.
+func WriteClaude(target config.TargetEntry, modules []pack.Module) error {
+	if !target.PerModule {
+		claudeModules, err := claudeMergedModules(modules)
+		if err != nil {
+			return err
+		}
+		return WriteMerged(claudeMergedTarget(target), claudeModules)
+	}
+	if target.OutFile != "" {
+		return fmt.Errorf("claude target does not support outFile with perModule=true; use outDir")
+	}
+	ext := target.Ext
+	if ext == "" {
+		ext = ".md"
+	}
+	if target.OutDir == "" {
+		target.OutDir = ".claude/rules"
+	}
+	target = rootTarget(target)
+	if err := os.MkdirAll(target.OutDir, 0o755); err != nil {
+		return err
+	}
+	pathToModule := make(map[string]string, len(modules))
+	for _, m := range modules {
+		rule, err := resolveClaudeApplyRule(m)
+		if err != nil {
+			return err
+		}
+		if rule.Mode == "never" {
+			continue
+		}
+		fullPath := targetModuleFullPath(target.OutDir, m, ext, config.LayoutPath)
+		if existingID, ok := pathToModule[fullPath]; ok {
+			return fmt.Errorf("claude output collision: modules %s and %s both map to %s", existingID, m.ID, fullPath)
+		}
+		pathToModule[fullPath] = m.ID
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return err
+		}
+		content := claudePerModuleContent(m, rule, target.RulesetDigest)
+		if err := writeOutput(fullPath, normalize(content), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// claudeMergedTarget applies the merged claude defaults.
+func claudeMergedTarget(target config.TargetEntry) config.TargetEntry {
+	if target.OutFile == "" {
+		target.OutFile = "CLAUDE.md"
+	}
+	return target
+}
+
+// claudeMergedModules returns the modules a merged CLAUDE.md includes.
+func claudeMergedModules(modules []pack.Module) ([]pack.Module, error) {
+	kept := make([]pack.Module, 0, len(modules))
+	for _, m := range modules {
+		rule, err := resolveClaudeApplyRule(m)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Mode != "never" {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
+
+// WriteAmazonQ writes one project rule per module under .amazonq/rules. Amazon
+// Q has no conditional activation, so every mode except never is written.
+func WriteAmazonQ(target config.TargetEntry, modules []pack.Module) error {
+	return writeUnconditionalRules("amazonq", target, modules)
+}
+
+// WriteCline writes one rule file per module under .clinerules, the folder
+// Cline reads and Roo Code falls back to. Like Amazon Q, it has no conditional
+// activation.
+func WriteCline(target config.TargetEntry, modules []pack.Module) error {
+	return writeUnconditionalRules("cline", target, modules)
+}
+
+// WriteCopilot writes the merged copilot-instructions.md, or with
+// perModule=true one path-specific instructions file per module under
+// .github/instructions, scoped by an applyTo glob list.
+func WriteCopilot(target config.TargetEntry, modules []pack.Module) error {
+	if !target.PerModule {
+		return WriteMerged(target, modules)
+	}
+	if target.OutFile != "" {
+		return fmt.Errorf("copilot target does not support outFile with perModule=true; use outDir")
+	}
+	target = rootTarget(copilotInstructionsTarget(target))
+	if err := os.MkdirAll(target.OutDir, 0o755); err != nil {
+		return err
+	}
+	paths, written, err := copilotInstructionPaths(target, modules)
+	if err != nil {
+		return err
+	}
+	for i, m := range written {
+		rule, err := resolveCopilotApplyRule(m)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0o755); err != nil {
+			return err
+		}
+		if err := writeOutput(paths[i], normalize(copilotInstructionsContent(m, rule, target.RulesetDigest)), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copilotInstructionsExt is the suffix Copilot requires of path-specific
+// instructions files.
+const copilotInstructionsExt = ".instructions.md"
+
+// copilotInstructionsTarget applies the perModule copilot defaults.
+func copilotInstructionsTarget(target config.TargetEntry) config.TargetEntry {
+	if target.OutDir == "" {
+		target.OutDir = ".github/instructions"
+	}
+	return target
+}
+
+// copilotInstructionPaths returns the instructions file of each module and
+// those modules, in order, failing when two modules map to the same file.
+func copilotInstructionPaths(target config.TargetEntry, modules []pack.Module) ([]string, []pack.Module, error) {
+	paths := make([]string, 0, len(modules))
+	written := make([]pack.Module, 0, len(modules))
+	pathToModule := make(map[string]string, len(modules))
+	for _, m := range modules {
+		rule, err := resolveCopilotApplyRule(m)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rule.Mode == "never" {
+			continue
+		}
+		fullPath := targetModuleFullPath(target.OutDir, m, copilotInstructionsExt, config.LayoutPath)
+		if existingID, ok := pathToModule[fullPath]; ok {
+			return nil, nil, fmt.Errorf("copilot output collision: modules %s and %s both map to %s", existingID, m.ID, fullPath)
+		}
+		pathToModule[fullPath] = m.ID
+		paths = append(paths, fullPath)
+		written = append(written, m)
+	}
+	return paths, written, nil
+}
+
+// ruleDirs is the default outDir of the per-module targets without a
+// conditional activation format.
+var ruleDirs = map[string]string{
+	"amazonq": ".amazonq/rules",
+	"cline":   ".clinerules",
+}
+
+// writeUnconditionalRules writes one priority-prefixed file per module, named
+// like cursor rules, skipping modules whose apply mode for kind is never.
+func writeUnconditionalRules(kind string, target config.TargetEntry, modules []pack.Module) error {
+	if target.OutFile != "" {
+		return fmt.Errorf("%s target does not support outFile; use outDir", kind)
+	}
+	if target.OutDir == "" {
+		target.OutDir = ruleDirs[kind]
+	}
+	target = rootTarget(target)
+	if err := os.MkdirAll(target.OutDir, 0o755); err != nil {
+		return err
+	}
+	paths, written, err := unconditionalRulePaths(kind, target, modules)
+	if err != nil {
+		return err
+	}
+	for i, m := range written {
+		if err := os.MkdirAll(filepath.Dir(paths[i]), 0o755); err != nil {
+			return err
+		}
+		content := rulesetHeader(target.RulesetDigest) + provenanceHeader(m) + "\n" + m.Content
+		if err := writeOutput(paths[i], normalize(content), target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unconditionalRulePaths returns the file of each module kind writes and
+// those modules, in order, failing when two modules map to the same file.
+func unconditionalRulePaths(kind string, target config.TargetEntry, modules []pack.Module) ([]string, []pack.Module, error) {
+	ext := target.Ext
+	if ext == "" {
+		ext = ".md"
+	}
+	if target.OutDir == "" {
+		target.OutDir = ruleDirs[kind]
+	}
+	paths := make([]string, 0, len(modules))
+	written := make([]pack.Module, 0, len(modules))
+	pathToModule := make(map[string]string, len(modules))
+	for _, m := range modules {
+		if resolveApplyMode(m, kind) == "never" {
+			continue
+		}
+		fullPath := targetModuleFullPath(target.OutDir, m, ext, config.LayoutPath)
+		if existingID, ok := pathToModule[fullPath]; ok {
+			return nil, nil, fmt.Errorf("%s output collision: modules %s and %s both map to %s", kind, existingID, m.ID, fullPath)
+		}
+		pathToModule[fullPath] = m.ID
+		paths = append(paths, fullPath)
+		written = append(written, m)
+	}
+	return paths, written, nil
+}
+
+// RulesUnmanagedOverwrites lists existing files without a rulepack provenance
+// header that an amazonq, cline, or perModule copilot build would replace, like
+// CursorUnmanagedOverwrites.
+func RulesUnmanagedOverwrites(kind string, target config.TargetEntry, modules []pack.Module) ([]string, error) {
+	if target.OutFile != "" {
+		return nil, nil
+	}
+	var paths []string
+	var err error
+	if kind == "copilot" {
+		if !target.PerModule {
+			return nil, nil
+		}
+		paths, _, err = copilotInstructionPaths(rootTarget(copilotInstructionsTarget(target)), modules)
+	} else {
+		if target.OutDir == "" {
+			target.OutDir = ruleDirs[kind]
+		}
+		paths, _, err = unconditionalRulePaths(kind, rootTarget(target), modules)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !isRulepackManagedCursorContent(string(data)) {
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
+
+// resolveApplyMode returns the lowercased apply mode for targets that only
+// distinguish never from everything else.
+func resolveApplyMode(m pack.Module, target string) string {
+	mode := strings.ToLower(strings.TrimSpace(targetApplyRule(m, target).Mode))
+	if mode == "" {
+		return "always"
+	}
+	return mode
+}
+
+func targetApplyRule(m pack.Module, target string) pack.ApplyRule {
+	if rule, ok := m.Apply.Targets[target]; ok {
+		return rule
+	}
+	if m.Apply.Default != nil {
+		return *m.Apply.Default
+	}
+	return pack.ApplyRule{}
+}
+
+func WriteMerged(target config.TargetEntry, modules []pack.Module) error {
+	if target.OutFile == "" {
+		return fmt.Errorf("missing output file")
+	}
+	target = rootTarget(target)
+	if err := os.MkdirAll(filepath.Dir(target.OutFile), 0o755); err != nil {
+		return err
+	}
+	return writeOutput(target.OutFile, mergedContent(target.RulesetDigest, modules), target)
+}
+
+func mergedContent(digest string, modules []pack.Module) string {
+	return mergedManagedHeader + "\n" + rulesetHeader(digest) + normalize(merge(modules, false))
+}
+
+// RenderSingleFile returns what a single-file target would write, so build can
+// stream it instead of touching the worktree. Targets or settings that write
+// more than one file are rejected.
+func RenderSingleFile(name string, target config.TargetEntry, modules []pack.Module) (string, error) {
+	var content string
+	switch name {
+	case "copilot":
+		if target.PerModule {
+			return "", fmt.Errorf("copilot target writes multiple files with perModule=true")
+		}
+		content = mergedContent(target.RulesetDigest, modules)
+	case "codex":
+		if target.PerModule || target.ScopeByGlob {
+			return "", fmt.Errorf("codex target writes multiple files with perModule or scopeByGlob set")
+		}
+		content = mergedContent(target.RulesetDigest, modules)
+	case "zed", "junie":
+		content = mergedContent(target.RulesetDigest, withoutNever(modules, name))
+	case "custom":
+		var err error
+		if content, err = customContent(target, modules); err != nil {
+			return "", err
+		}
+	case "claude":
+		if target.PerModule {
+			return "", fmt.Errorf("claude target writes multiple files with perModule=true")
+		}
+		claudeModules, err := claudeMergedModules(modules)
+		if err != nil {
+			return "", err
+		}
+		content = mergedContent(target.RulesetDigest, claudeModules)
+	case "cursor":
+		if target.PerModule {
+			return "", fmt.Errorf("cursor target writes multiple files with perModule=true")
+		}
+		cursorModules := make([]pack.Module, 0, len(modules))
+		for _, m := range modules {
 			rule, err := resolveCursorApplyRule(m)
 			if err != nil {
-				return err
+				return "", err
 			}
-			fullPath := targetModuleFullPath(target.OutDir, m, ext)
-			if existingID, ok := pathToModule[fullPath]; ok {
-				return fmt.Errorf("cursor output collision: modules %s and %s both map to %s", existingID, m.ID, fullPath)
+			if rule.Mode != "never" {
+				cursorModules = append(cursorModules, m)
 			}
-			pathToModule[fullPath] = m.ID
-			planned = append(planned, struct {
-				module pack.Module
-				rule   cursorApplyRule
-				path   string
-			}{module: m, rule: rule, path: fullPath})
 		}
-		for _, item := range planned {
-			if err := os.MkdirAll(filepath.Dir(item.path), 0o755); err != nil {
-				return err
+		merged, sidecar, _, err := planCursorMerged(target, cursorModules)
+		if err != nil {
+			return "", err
+		}
+		if len(sidecar) > 0 {
+			return "", fmt.Errorf("cursor target writes sidecar files for %d module(s)", len(sidecar))
+		}
+		content = normalize(rulesetHeader(target.RulesetDigest) + merge(merged, true))
+	default:
+		return "", fmt.Errorf("%s target writes one file per module", name)
+	}
+	return withNewline(content+buildFooter(target.BuildID), target.Newline), nil
+}
+
+func withoutNever(modules []pack.Module, target string) []pack.Module {
+	kept := make([]pack.Module, 0, len(modules))
+	for _, m := range modules {
+		if resolveApplyMode(m, target) == "never" {
+			continue
+		}
+		kept = append(kept, m)
+	}
+	return kept
+}
+
+// mergedFiles is the default outFile of the merged targets that only
+// distinguish never from everything else.
+var mergedFiles = map[string]string{
+	"zed":   ".rules",
+	"junie": ".junie/guidelines.md",
+}
+
+// WriteZed writes the merged .rules file read by Zed's assistant. Modules with
+// apply mode never for zed are left out.
+func WriteZed(target config.TargetEntry, modules []pack.Module) error {
+	return writeUnconditionalMerged("zed", target, modules)
+}
+
+// WriteJunie writes the merged .junie/guidelines.md file read by JetBrains
+// Junie. Modules with apply mode never for junie are left out.
+func WriteJunie(target config.TargetEntry, modules []pack.Module) error {
+	return writeUnconditionalMerged("junie", target, modules)
+}
+
+func writeUnconditionalMerged(kind string, target config.TargetEntry, modules []pack.Module) error {
+	if target.OutFile == "" {
+		target.OutFile = mergedFiles[kind]
+	}
+	return WriteMerged(target, withoutNever(modules, kind))
+}
+
+// WriteCodex writes the merged monolith, or with perModule=true one file per
+// topic (the first segment of the module ID) plus an index at outFile.
+func WriteCodex(target config.TargetEntry, modules []pack.Module) error {
+	if !target.PerModule {
+		if target.ScopeByGlob {
+			return writeScopedMerged(target, "codex", modules)
+		}
+		return WriteMerged(target, modules)
+	}
+	target.OutDir, target.Ext, target.OutFile = codexLayout(target)
+	target = rootTarget(target)
+	outDir, ext, index := target.OutDir, target.Ext, target.OutFile
+	topics := make([]string, 0)
+	byTopic := make(map[string][]pack.Module)
+	for _, m := range modules {
+		topic := codexTopic(m)
+		if _, ok := byTopic[topic]; !ok {
+			topics = append(topics, topic)
+		}
+		byTopic[topic] = append(byTopic[topic], m)
+	}
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+	var idx strings.Builder
+	idx.WriteString(mergedManagedHeader + "\n")
+	idx.WriteString(rulesetHeader(target.RulesetDigest))
+	idx.WriteString("# Instructions\n\n")
+	for _, topic := range topics {
+		fullPath := filepath.Join(outDir, topic+ext)
+		content := mergedContent(target.RulesetDigest, byTopic[topic])
+		if err := writeOutput(fullPath, content, target); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(index), fullPath)
+		if err != nil {
+			return err
+		}
+		idx.WriteString(fmt.Sprintf("- [%s](%s)\n", topic, filepath.ToSlash(rel)))
+	}
+	if err := os.MkdirAll(filepath.Dir(index), 0o755); err != nil {
+		return err
+	}
+	return writeOutput(index, normalize(idx.String()), target)
+}
+
+func codexLayout(target config.TargetEntry) (outDir, ext, index string) {
+	outDir, ext, index = target.OutDir, target.Ext, target.OutFile
+	if outDir == "" {
+		outDir = ".codex/rules"
+	}
+	if ext == "" {
+		ext = ".md"
+	}
+	if index == "" {
+		index = ".codex/rules.md"
+	}
+	return outDir, ext, index
+}
+
+// writeScopedMerged writes root-level modules to outFile and each glob-scoped
+// group to <dir>/<base of outFile>, e.g. services/api/AGENTS.md.
+func writeScopedMerged(target config.TargetEntry, targetName string, modules []pack.Module) error {
+	dirs, byDir := planGlobDirs(modules, targetName)
+	for _, dir := range dirs {
+		entry := target
+		if dir != "" {
+			entry.OutFile = filepath.Join(filepath.FromSlash(dir), filepath.Base(target.OutFile))
+		}
+		if err := WriteMerged(entry, byDir[dir]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScopedUnmanagedOverwrites lists existing non-rulepack files that glob-scoped
+// output would replace. The root outFile is not checked, matching merged output.
+func ScopedUnmanagedOverwrites(target config.TargetEntry, targetName string, modules []pack.Module) ([]string, error) {
+	if !target.ScopeByGlob || target.PerModule || target.OutFile == "" {
+		return nil, nil
+	}
+	dirs, _ := planGlobDirs(modules, targetName)
+	out := make([]string, 0)
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		path := filepath.Join(filepath.FromSlash(dir), filepath.Base(target.OutFile))
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		if !isRulepackManagedMergedContent(string(data)) {
+			out = append(out, path)
+		}
+	}
+	return out, nil
+}
+
+// planGlobDirs groups modules by the directories their glob apply rule for
+// targetName points at. A module lands in every directory its globs name;
+// modules without glob rules, or with a glob lacking a literal directory
+// prefix (such as **/*.go), go to the root, keyed "". The root is always
+// planned and comes first; other directories are sorted.
+func planGlobDirs(modules []pack.Module, targetName string) ([]string, map[string][]pack.Module) {
+	byDir := map[string][]pack.Module{"": nil}
+	for _, m := range modules {
+		rule := targetApplyRule(m, targetName)
+		if !strings.EqualFold(strings.TrimSpace(rule.Mode), "glob") || len(rule.Globs) == 0 {
+			byDir[""] = append(byDir[""], m)
+			continue
+		}
+		seen := make(map[string]struct{}, len(rule.Globs))
+		for _, glob := range rule.Globs {
+			dir := globDir(glob)
+			if _, ok := seen[dir]; ok {
+				continue
+			}
+			seen[dir] = struct{}{}
+			byDir[dir] = append(byDir[dir], m)
+		}
+	}
+	dirs := make([]string, 0, len(byDir))
+	for dir := range byDir {
+		if dir != "" {
+			dirs = append(dirs, dir)
+		}
+	}
+	sort.Strings(dirs)
+	return append([]string{""}, dirs...), byDir
+}
+
+// globDir returns the literal directory prefix of a project-relative glob:
+// services/api/**/*.go -> services/api. Patterns that could escape the
+// project, or are negated, map to the root.
+func globDir(glob string) string {
+	glob = strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(glob), "\\", "/"), "./")
+	if glob == "" || strings.HasPrefix(glob, "!") || strings.HasPrefix(glob, "/") {
+		return ""
+	}
+	segments := strings.Split(glob, "/")
+	dir := make([]string, 0, len(segments))
+	for i, seg := range segments {
+		if i == len(segments)-1 || strings.ContainsAny(seg, "*?[{") {
+			break
+		}
+		if seg == "" || seg == "." || seg == ".." {
+			return ""
+		}
+		dir = append(dir, seg)
+	}
+	return strings.Join(dir, "/")
+}
+
+func codexTopic(m pack.Module) string {
+	topic, _, _ := strings.Cut(m.ID, ".")
+	if topic = sanitizeID(topic); topic == "" {
+		return "general"
+	}
+	return topic
+}
+
+// EffectiveModule describes whether a target shows one module to the assistant.
+type EffectiveModule struct {
+	ID       string   `json:"id"`
+	Pack     string   `json:"pack"`
+	Priority int      `json:"priority"`
+	Mode     string   `json:"mode"`
+	Globs    []string `json:"globs,omitempty"`
+	// Status is "applies", "conditional", or "excluded".
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Effective reports how a target of the given kind exposes each module. When
+// filePath is set, glob rules are evaluated against it; otherwise glob-scoped
+// modules are reported as conditional.
+func Effective(kind string, target config.TargetEntry, modules []pack.Module, filePath string) ([]EffectiveModule, error) {
+	if filePath != "" {
+		filePath = strings.TrimPrefix(path.Clean(filepath.ToSlash(filePath)), "./")
+	}
+	out := make([]EffectiveModule, 0, len(modules))
+	for _, m := range modules {
+		em := EffectiveModule{ID: m.ID, Pack: m.PackName, Priority: m.Priority, Status: "applies"}
+		switch kind {
+		case "cursor":
+			rule, err := resolveCursorApplyRule(m)
+			if err != nil {
+				return nil, err
+			}
+			em.Mode, em.Globs = rule.Mode, rule.Globs
+			if !target.PerModule && (rule.Mode == "glob" || rule.Mode == "agent" || rule.Mode == "manual") {
+				switch target.Fallback {
+				case config.FallbackSidecar:
+				case config.FallbackSkip:
+					em.Status, em.Reason = "excluded", "skipped by merged output fallback"
+				default:
+					em.Status, em.Reason = "excluded", "not supported in merged output"
+				}
+			}
+			if em.Status == "applies" {
+				switch rule.Mode {
+				case "agent":
+					em.Status, em.Reason = "conditional", "included when the assistant judges it relevant"
+				case "manual":
+					em.Status, em.Reason = "conditional", "included only when referenced explicitly"
+				}
+			}
+		case "claude":
+			rule, err := resolveClaudeApplyRule(m)
+			if err != nil {
+				return nil, err
+			}
+			em.Mode, em.Globs = rule.Mode, rule.Globs
+			if !target.PerModule && em.Mode != "never" {
+				em.Mode, em.Globs = "always", nil
+			}
+		case "codex":
+			rule := targetApplyRule(m, "codex")
+			em.Mode = resolveApplyMode(m, "codex")
+			if target.ScopeByGlob && !target.PerModule && em.Mode == "glob" {
+				em.Globs = rule.Globs
+				em.Status, em.Reason = effectiveScoped(rule.Globs, filePath)
+				out = append(out, em)
+				continue
+			}
+			em.Mode = "always"
+		case "copilot":
+			em.Mode = "always"
+			if target.PerModule {
+				rule, err := resolveCopilotApplyRule(m)
+				if err != nil {
+					return nil, err
+				}
+				em.Mode, em.Globs = rule.Mode, rule.Globs
+				switch rule.Mode {
+				case "agent":
+					em.Status, em.Reason = "conditional", "included when the assistant judges it relevant"
+				case "manual":
+					em.Status, em.Reason = "conditional", "included only when referenced explicitly"
+				}
+			}
+		case "amazonq", "cline", "zed", "junie", "custom":
+			em.Mode = resolveApplyMode(m, kind)
+			if em.Mode != "never" {
+				em.Mode = "always"
+			}
+		default:
+			return nil, fmt.Errorf("unsupported target %q", kind)
+		}
+		switch {
+		case em.Mode == "never":
+			em.Status, em.Reason = "excluded", "apply mode never"
+		case em.Mode == "glob" && em.Status == "applies":
+			em.Status, em.Reason = effectiveGlob(em.Globs, filePath)
+		}
+		out = append(out, em)
+	}
+	return out, nil
+}
+
+func effectiveGlob(globs []string, filePath string) (string, string) {
+	if filePath == "" {
+		return "conditional", "applies to files matching " + strings.Join(globs, ", ")
+	}
+	for _, glob := range globs {
+		if matchGlob(glob, filePath) {
+			return "applies", "matches " + glob
+		}
+	}
+	return "excluded", "no glob matches " + filePath
+}
+
+// effectiveScoped mirrors scopeByGlob output: a module applies to files under
+// any directory its globs scope it to.
+func effectiveScoped(globs []string, filePath string) (string, string) {
+	if filePath == "" {
+		return "conditional", "scoped to directories of " + strings.Join(globs, ", ")
+	}
+	for _, glob := range globs {
+		dir := globDir(glob)
+		if dir == "" || filePath == dir || strings.HasPrefix(filePath, dir+"/") {
+			if dir == "" {
+				dir = "."
+			}
+			return "applies", "written to " + dir
+		}
+	}
+	return "excluded", "not scoped to a directory containing " + filePath
+}
+
+// CoverageGroup counts the files of one directory, or with one extension,
+// that at least one glob-scoped module applies to.
+type CoverageGroup struct {
+	// By is "dir" or "ext".
+	By      string   `json:"by"`
+	Key     string   `json:"key"`
+	Files   int      `json:"files"`
+	Covered int      `json:"covered"`
+	Modules []string `json:"modules,omitempty"`
+}
+
+// Coverage evaluates every module's glob rules for a target against files,
+// project-relative paths, and groups the result by parent directory and by
+// extension. Modules that always apply do not count as coverage: the report
+// is about where glob-scoped rules reach.
+func Coverage(kind string, target config.TargetEntry, modules []pack.Module, files []string) ([]CoverageGroup, error) {
+	type tally struct {
+		files, covered int
+		modules        map[string]bool
+	}
+	groups := map[[2]string]*tally{}
+	add := func(by, key string, covered bool, ids []string) {
+		g := groups[[2]string{by, key}]
+		if g == nil {
+			g = &tally{modules: map[string]bool{}}
+			groups[[2]string{by, key}] = g
+		}
+		g.files++
+		if covered {
+			g.covered++
+		}
+		for _, id := range ids {
+			g.modules[id] = true
+		}
+	}
+	for _, file := range files {
+		effective, err := Effective(kind, target, modules, file)
+		if err != nil {
+			return nil, err
+		}
+		ids := []string{}
+		for _, em := range effective {
+			if em.Mode == "glob" && em.Status == "applies" {
+				ids = append(ids, em.ID)
+			}
+		}
+		file = filepath.ToSlash(file)
+		ext := strings.ToLower(path.Ext(file))
+		if ext == "" {
+			ext = "(none)"
+		}
+		add("dir", path.Dir(file), len(ids) > 0, ids)
+		add("ext", ext, len(ids) > 0, ids)
+	}
+	out := make([]CoverageGroup, 0, len(groups))
+	for key, g := range groups {
+		ids := make([]string, 0, len(g.modules))
+		for id := range g.modules {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		out = append(out, CoverageGroup{By: key[0], Key: key[1], Files: g.files, Covered: g.covered, Modules: ids})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].By != out[j].By {
+			return out[i].By < out[j].By
+		}
+		return out[i].Key < out[j].Key
+	})
+	return out, nil
+}
+
+// LintIssue is an apply configuration problem for one module and target.
+// Errors fail the build; warnings mark settings the target ignores. Rule is
+// one of the LintRules IDs and Path is the module's file within its pack.
+type LintIssue struct {
+	Rule    string `json:"rule"`
+	Module  string `json:"module"`
+	Path    string `json:"path,omitempty"`
+	Target  string `json:"target"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	// Line is the first line of the module content the issue points at, or 0
+	// when it concerns the module as a whole.
+	Line int `json:"line,omitempty"`
+}
+
+// LintRule describes one kind of LintIssue.
+type LintRule struct {
+	ID          string
+	Description string
+}
+
+// LintRules lists every rule LintApply and LintApplyTargets report.
+var LintRules = []LintRule{
+	{ID: "unsupported-mode", Description: "Apply mode is not one of always, never, agent, glob, or manual."},
+	{ID: "glob-without-globs", Description: "Apply mode glob lists no globs."},
+	{ID: "invalid-glob", Description: "A glob pattern is malformed."},
+	{ID: "ignored-globs", Description: "Globs are set on a mode that does not use them."},
+	{ID: "agent-without-description", Description: "Cursor agent mode has no description to decide when to apply the rule."},
+	{ID: "merged-conditional", Description: "A conditional mode cannot be expressed in merged cursor output without a skip or sidecar fallback."},
+	{ID: "unsupported-target-mode", Description: "The target cannot honor the mode set for it and approximates or ignores it."},
+	{ID: "unknown-apply-target", Description: "An apply.targets key matches no target type."},
+	{ID: "namespace-collision", Description: "Different packs contribute modules under the same ID namespace."},
+	{ID: "unknown-band", Description: "A module names a priority band rulepack.json does not declare."},
+	{ID: "priority-outside-band", Description: "A module's priority falls outside its declared priority band."},
+	{ID: "banned-term", Description: "Module content uses a term the terminology dictionary bans."},
+	{ID: "preferred-term", Description: "Module content uses a term the terminology dictionary replaces with a preferred one."},
+}
+
+var applyModes = []string{"always", "never", "agent", "glob", "manual"}
+
+// LintApply checks each module's apply rule as the named target, rendered by
+// kind, will interpret it, so contradictions surface before any file is
+// written.
+func LintApply(name string, kind string, target config.TargetEntry, modules []pack.Module) []LintIssue {
+	issues := make([]LintIssue, 0)
+	add := func(m pack.Module, rule, level, format string, args ...any) {
+		issues = append(issues, LintIssue{Rule: rule, Module: m.ID, Path: m.Path, Target: name, Level: level, Message: fmt.Sprintf(format, args...)})
+	}
+	for _, m := range modules {
+		rule := targetApplyRule(m, kind)
+		mode := resolveApplyMode(m, kind)
+		// Modes a target cannot honor are only worth flagging when the pack
+		// asked for them on that target; a shared default is expected to be
+		// approximated by simpler renderers.
+		_, explicit := m.Apply.Targets[kind]
+		if !slices.Contains(applyModes, mode) {
+			add(m, "unsupported-mode", "error", "unsupported apply mode %q", rule.Mode)
+			continue
+		}
+		if mode == "glob" {
+			if len(rule.Globs) == 0 {
+				level := "warn"
+				if kind == "cursor" || (kind == "claude" && target.PerModule) {
+					level = "error"
+				}
+				add(m, "glob-without-globs", level, "apply mode glob has no globs")
+			} else if invalid := invalidGlob(rule.Globs); invalid != "" {
+				add(m, "invalid-glob", "error", "%s", invalid)
+			}
+		} else if len(rule.Globs) > 0 {
+			add(m, "ignored-globs", "warn", "globs are ignored with apply mode %s", mode)
+		}
+		switch kind {
+		case "cursor":
+			if mode == "agent" && strings.TrimSpace(rule.Description) == "" {
+				add(m, "agent-without-description", "warn", "apply mode agent without a description gets a generated one")
+			}
+			if !target.PerModule && (mode == "glob" || mode == "agent" || mode == "manual") {
+				switch target.Fallback {
+				case config.FallbackSkip, config.FallbackSidecar:
+				default:
+					add(m, "merged-conditional", "error", "apply mode %s needs perModule=true or a skip/sidecar fallback", mode)
+				}
+			}
+		case "claude":
+			if explicit && (mode == "agent" || mode == "manual" || (mode == "glob" && !target.PerModule)) {
+				add(m, "unsupported-target-mode", "warn", "apply mode %s is written as an unconditional rule", mode)
+			}
+		case "codex":
+			scoped := mode == "glob" && target.ScopeByGlob && !target.PerModule
+			if explicit && mode != "always" && !scoped {
+				add(m, "unsupported-target-mode", "warn", "apply mode %s is ignored; codex includes every module", mode)
+			}
+		case "copilot":
+			if explicit && mode != "always" && !target.PerModule {
+				add(m, "unsupported-target-mode", "warn", "apply mode %s is ignored; copilot includes every module", mode)
+			}
+		case "amazonq", "cline", "zed", "junie":
+			if explicit && mode != "always" && mode != "never" {
+				add(m, "unsupported-target-mode", "warn", "apply mode %s is written as an unconditional rule", mode)
+			}
+		}
+	}
+	return issues
+}
+
+// LintApplyTargets flags per-target apply rules keyed by a name no renderer
+// reads, which usually means a typo.
+func LintApplyTargets(modules []pack.Module) []LintIssue {
+	issues := make([]LintIssue, 0)
+	for _, m := range modules {
+		keys := make([]string, 0, len(m.Apply.Targets))
+		for key := range m.Apply.Targets {
+			if !slices.Contains(config.TargetKinds, key) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			issues = append(issues, LintIssue{Rule: "unknown-apply-target", Module: m.ID, Path: m.Path, Target: key, Level: "warn", Message: fmt.Sprintf("apply.targets.%s matches no target type", key)})
+		}
+	}
+	return issues
+}
+
+// LintNamespaces warns when different packs contribute modules to the same ID
+// namespace, the segment before the first dot, since their IDs are likely to
+// collide as the packs grow. IDs without a dot have no namespace.
+func LintNamespaces(modules []pack.Module) []LintIssue {
+	// firstID[namespace][pack] is the first module ID the pack contributes.
+	firstID := map[string]map[string]string{}
+	packOrder := map[string][]string{}
+	for _, m := range modules {
+		ns, _, ok := strings.Cut(m.ID, ".")
+		if !ok {
+			continue
+		}
+		if firstID[ns] == nil {
+			firstID[ns] = map[string]string{}
+		}
+		if _, seen := firstID[ns][m.PackName]; !seen {
+			firstID[ns][m.PackName] = m.ID
+			packOrder[ns] = append(packOrder[ns], m.PackName)
+		}
+	}
+	namespaces := make([]string, 0, len(packOrder))
+	for ns, packs := range packOrder {
+		if len(packs) > 1 {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	sort.Strings(namespaces)
+	issues := make([]LintIssue, 0, len(namespaces))
+	for _, ns := range namespaces {
+		users := make([]string, 0, len(packOrder[ns]))
+		for _, p := range packOrder[ns] {
+			users = append(users, fmt.Sprintf("%s (%s)", p, firstID[ns][p]))
+		}
+		issues = append(issues, LintIssue{
+			Rule:    "namespace-collision",
+			Module:  ns + ".*",
+			Level:   "warn",
+			Message: fmt.Sprintf("namespace %q is shared by packs %s", ns, strings.Join(users, ", ")),
+		})
+	}
+	return issues
+}
+
+// LintBands checks that every module naming a priority band exists in bands
+// and has a priority inside it. Modules without a band are not checked.
+func LintBands(modules []pack.Module, bands []config.PriorityBand) []LintIssue {
+	byName := make(map[string]config.PriorityBand, len(bands))
+	for _, b := range bands {
+		byName[b.Name] = b
+	}
+	issues := make([]LintIssue, 0)
+	for _, m := range modules {
+		if m.Band == "" {
+			continue
+		}
+		band, ok := byName[m.Band]
+		switch {
+		case !ok:
+			issues = append(issues, LintIssue{Rule: "unknown-band", Module: m.ID, Path: m.Path, Level: "error", Message: fmt.Sprintf("priority band %q is not declared in priorityBands", m.Band)})
+		case m.Priority < band.Min || m.Priority > band.Max:
+			issues = append(issues, LintIssue{Rule: "priority-outside-band", Module: m.ID, Path: m.Path, Level: "error", Message: fmt.Sprintf("priority %d is outside band %s (%d-%d)", m.Priority, band.Name, band.Min, band.Max)})
+		}
+	}
+	return issues
+}
+
+// LintTerminology reports, per module, each banned or discouraged term its
+// content uses and the lines it appears on.
+func LintTerminology(modules []pack.Module, terms *config.Terminology) []LintIssue {
+	issues := make([]LintIssue, 0)
+	if terms == nil {
+		return issues
+	}
+	discouraged := make([]string, 0, len(terms.Preferred))
+	for term := range terms.Preferred {
+		discouraged = append(discouraged, term)
+	}
+	sort.Strings(discouraged)
+	banned := make([]*regexp.Regexp, len(terms.Banned))
+	for i, term := range terms.Banned {
+		banned[i] = termPattern(term)
+	}
+	preferred := make([]*regexp.Regexp, len(discouraged))
+	for i, term := range discouraged {
+		preferred[i] = termPattern(term)
+	}
+	for _, m := range modules {
+		lines := strings.Split(m.Content, "\n")
+		for i, term := range terms.Banned {
+			if found, first := termLines(lines, banned[i]); found != "" {
+				issues = append(issues, LintIssue{Rule: "banned-term", Module: m.ID, Path: m.Path, Level: "error", Message: fmt.Sprintf("banned term %q on %s", term, found), Line: first})
+			}
+		}
+		for i, term := range discouraged {
+			if found, first := termLines(lines, preferred[i]); found != "" {
+				issues = append(issues, LintIssue{Rule: "preferred-term", Module: m.ID, Path: m.Path, Level: "warn", Message: fmt.Sprintf("use %q instead of %q on %s", terms.Preferred[term], term, found), Line: first})
+			}
+		}
+	}
+	return issues
+}
+
+// termPattern matches term case-insensitively when it is not part of a
+// longer word.
+func termPattern(term string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])` + regexp.QuoteMeta(strings.TrimSpace(term)) + `(?:$|[^\p{L}\p{N}_])`)
+}
+
+// termLines lists the lines re matches, e.g. "line 3" or "lines 3, 7", with
+// the first of them, or returns "" when none do.
+func termLines(lines []string, re *regexp.Regexp) (string, int) {
+	found := []string{}
+	first := 0
+	for i, line := range lines {
+		if re.MatchString(line) {
+			if first == 0 {
+				first = i + 1
+			}
+			found = append(found, strconv.Itoa(i+1))
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", 0
+	case 1:
+		return "line " + found[0], first
+	default:
+		return "lines " + strings.Join(found, ", "), first
+	}
+}
+
+// GlobKinds are the targets whose output honors glob apply rules; the other
+// targets include glob-mode modules unconditionally.
+var GlobKinds = []string{"cursor", "claude", "codex"}
+
+// GlobResult reports how a module's apply rule for one target treats a path.
+type GlobResult struct {
+	Target  string `json:"target"`
+	Mode    string `json:"mode"`
+	Path    string `json:"path"`
+	Matched bool   `json:"matched"`
+	Glob    string `json:"glob,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// EvaluateGlobs checks each path against the module's apply rule for every
+// glob-aware target. Non-glob modes match every path except under never.
+func EvaluateGlobs(m pack.Module, paths []string) []GlobResult {
+	out := make([]GlobResult, 0, len(GlobKinds)*len(paths))
+	for _, kind := range GlobKinds {
+		rule := targetApplyRule(m, kind)
+		mode := resolveApplyMode(m, kind)
+		var invalid string
+		if mode == "glob" {
+			invalid = invalidGlob(rule.Globs)
+		}
+		for _, p := range paths {
+			name := strings.TrimPrefix(path.Clean(filepath.ToSlash(p)), "./")
+			result := GlobResult{Target: kind, Mode: mode, Path: p}
+			switch {
+			case mode != "glob":
+				result.Matched = mode != "never"
+			case invalid != "":
+				result.Error = invalid
+			default:
+				for _, glob := range rule.Globs {
+					if matchGlob(glob, name) {
+						result.Matched, result.Glob = true, glob
+						break
+					}
+				}
+			}
+			out = append(out, result)
+		}
+	}
+	return out
+}
+
+func invalidGlob(globs []string) string {
+	if len(globs) == 0 {
+		return "glob mode without globs"
+	}
+	for _, glob := range globs {
+		for _, seg := range strings.Split(filepath.ToSlash(glob), "/") {
+			if _, err := path.Match(seg, ""); err != nil {
+				return fmt.Sprintf("invalid glob %q: %v", glob, err)
+			}
+		}
+	}
+	return ""
+}
+
+// matchGlob matches a slash-separated path against a pattern where ** spans
+// any number of directories and other segments use path.Match syntax.
+func matchGlob(pattern, name string) bool {
+	return pack.MatchPath(pattern, name)
+}
+
+// OutputPaths lists the files and directories a target of the given kind
+// writes, with defaults applied. Directories stand for every per-module file
+// beneath them. modules is only needed for codex scopeByGlob output.
+func OutputPaths(kind string, target config.TargetEntry, modules []pack.Module) []string {
+	switch kind {
+	case "cursor":
+		outDir := target.OutDir
+		if outDir == "" {
+			outDir = ".cursor/rules"
+		}
+		if target.PerModule {
+			return []string{outDir}
+		}
+		outFile := target.OutFile
+		if outFile == "" {
+			ext := target.Ext
+			if ext == "" {
+				ext = ".mdc"
 			}
-			content, err := cursorPerModuleContent(ext, item.module, item.rule)
-			if err != nil {
-				return err
-			}
-			if err := os.WriteFile(item.path, []byte(normalize(content)), 0o644); err != nil {
-				return err
+			outFile = filepath.Join(outDir, "rules"+ext)
+		}
+		if target.Fallback == config.FallbackSidecar {
+			return []string{outFile, cursorSidecarDir(target)}
+		}
+		return []string{outFile}
+	case "copilot":
+		if target.PerModule {
+			return []string{copilotInstructionsTarget(target).OutDir}
+		}
+		return []string{target.OutFile}
+	case "custom":
+		return []string{target.OutFile}
+	case "codex":
+		if target.PerModule {
+			outDir, _, index := codexLayout(target)
+			return []string{outDir, index}
+		}
+		paths := []string{target.OutFile}
+		if target.ScopeByGlob {
+			dirs, _ := planGlobDirs(modules, "codex")
+			for _, dir := range dirs[1:] {
+				paths = append(paths, filepath.Join(filepath.FromSlash(dir), filepath.Base(target.OutFile)))
 			}
 		}
-		return nil
-	}
-	for _, m := range cursorModules {
-		rule, err := resolveCursorApplyRule(m)
-		if err != nil {
-			return err
+		return paths
+	case "claude":
+		if !target.PerModule {
+			return []string{claudeMergedTarget(target).OutFile}
 		}
-		if rule.Mode == "glob" || rule.Mode == "agent" || rule.Mode == "manual" {
-			return fmt.Errorf("cursor target with perModule=false does not support apply mode %q for module %s", rule.Mode, m.ID)
+		if target.OutDir == "" {
+			return []string{".claude/rules"}
 		}
+		return []string{target.OutDir}
+	case "amazonq", "cline":
+		if target.OutDir == "" {
+			return []string{ruleDirs[kind]}
+		}
+		return []string{target.OutDir}
+	case "zed", "junie":
+		if target.OutFile == "" {
+			return []string{mergedFiles[kind]}
+		}
+		return []string{target.OutFile}
 	}
-	if target.OutFile == "" {
-		target.OutFile = filepath.Join(target.OutDir, "rules"+ext)
-	}
-	return os.WriteFile(target.OutFile, []byte(normalize(merge(cursorModules, true))), 0o644)
+	return nil
 }
 
-func CursorUnmanagedOverwrites(target config.TargetEntry, modules []pack.Module) ([]string, error) {
-	writePaths, err := cursorWritePaths(target, modules)
-	if err != nil {
-		return nil, err
+// OutputModules maps each file a target of the given kind writes to the IDs
+// of the modules rendered into it, in module order. Unlike OutputPaths it
+// names every per-module file, and it applies the target root.
+func OutputModules(kind string, target config.TargetEntry, modules []pack.Module) (map[string][]string, error) {
+	out := map[string][]string{}
+	add := func(path string, mods []pack.Module) {
+		for _, m := range mods {
+			out[path] = append(out[path], m.ID)
+		}
 	}
-	out := make([]string, 0, len(writePaths))
-	for _, path := range writePaths {
-		data, err := os.ReadFile(path)
-		if err != nil {
-			if os.IsNotExist(err) {
-				continue
+	switch kind {
+	case "cursor":
+		ext := target.Ext
+		if ext == "" {
+			ext = ".mdc"
+		}
+		if target.OutDir == "" {
+			target.OutDir = ".cursor/rules"
+		}
+		target = rootTarget(target)
+		cursorModules := make([]pack.Module, 0, len(modules))
+		for _, m := range modules {
+			rule, err := resolveCursorApplyRule(m)
+			if err != nil {
+				return nil, err
 			}
+			if rule.Mode != "never" {
+				cursorModules = append(cursorModules, m)
+			}
+		}
+		if target.PerModule {
+			for _, m := range cursorModules {
+				add(targetModuleFullPath(target.OutDir, m, ext, target.Layout), []pack.Module{m})
+			}
+			return out, nil
+		}
+		merged, sidecar, _, err := planCursorMerged(target, cursorModules)
+		if err != nil {
 			return nil, err
 		}
-		if !isRulepackManagedCursorContent(string(data)) {
-			out = append(out, path)
+		for _, m := range sidecar {
+			add(targetModuleFullPath(cursorSidecarDir(target), m, ".mdc", target.Layout), []pack.Module{m})
 		}
-	}
-	return out, nil
-}
-
-func WriteClaude(target config.TargetEntry, modules []pack.Module) error {
-	if target.OutFile != "" {
-		return fmt.Errorf("claude target does not support outFile; use outDir")
-	}
-	if !target.PerModule {
-		return fmt.Errorf("claude target requires perModule=true")
-	}
-	ext := target.Ext
-	if ext == "" {
-		ext = ".md"
-	}
-	if target.OutDir == "" {
-		target.OutDir = ".claude/rules"
-	}
-	if err := os.MkdirAll(target.OutDir, 0o755); err != nil {
-		return err
-	}
-	pathToModule := make(map[string]string, len(modules))
-	for _, m := range modules {
-		rule, err := resolveClaudeApplyRule(m)
+		if target.OutFile == "" {
+			target.OutFile = filepath.Join(target.OutDir, "rules"+ext)
+		}
+		add(target.OutFile, merged)
+	case "copilot":
+		if !target.PerModule {
+			add(rootTarget(target).OutFile, modules)
+			return out, nil
+		}
+		paths, written, err := copilotInstructionPaths(rootTarget(copilotInstructionsTarget(target)), modules)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		if rule.Mode == "never" {
-			continue
+		for i, m := range written {
+			add(paths[i], []pack.Module{m})
 		}
-		fullPath := targetModuleFullPath(target.OutDir, m, ext)
-		if existingID, ok := pathToModule[fullPath]; ok {
-			return fmt.Errorf("claude output collision: modules %s and %s both map to %s", existingID, m.ID, fullPath)
+	case "codex":
+		if target.PerModule {
+			target.OutDir, target.Ext, target.OutFile = codexLayout(target)
+			target = rootTarget(target)
+			for _, m := range modules {
+				add(filepath.Join(target.OutDir, codexTopic(m)+target.Ext), []pack.Module{m})
+			}
+			add(target.OutFile, modules)
+			return out, nil
 		}
-		pathToModule[fullPath] = m.ID
-		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
-			return err
+		if !target.ScopeByGlob {
+			add(rootTarget(target).OutFile, modules)
+			return out, nil
 		}
-		content := claudePerModuleContent(m, rule)
-		if err := os.WriteFile(fullPath, []byte(normalize(content)), 0o644); err != nil {
-			return err
+		dirs, byDir := planGlobDirs(modules, "codex")
+		for _, dir := range dirs {
+			entry := target
+			if dir != "" {
+				entry.OutFile = filepath.Join(filepath.FromSlash(dir), filepath.Base(target.OutFile))
+			}
+			add(rootTarget(entry).OutFile, byDir[dir])
 		}
+	case "claude", "amazonq", "cline":
+		if kind == "claude" && !target.PerModule {
+			claudeModules, err := claudeMergedModules(modules)
+			if err != nil {
+				return nil, err
+			}
+			add(rootTarget(claudeMergedTarget(target)).OutFile, claudeModules)
+			return out, nil
+		}
+		ext := target.Ext
+		if ext == "" {
+			ext = ".md"
+		}
+		if target.OutDir == "" {
+			target.OutDir = ".claude/rules"
+			if dir, ok := ruleDirs[kind]; ok {
+				target.OutDir = dir
+			}
+		}
+		target = rootTarget(target)
+		for _, m := range modules {
+			mode := resolveApplyMode(m, kind)
+			if kind == "claude" {
+				rule, err := resolveClaudeApplyRule(m)
+				if err != nil {
+					return nil, err
+				}
+				mode = rule.Mode
+			}
+			if mode == "never" {
+				continue
+			}
+			add(targetModuleFullPath(target.OutDir, m, ext, config.LayoutPath), []pack.Module{m})
+		}
+	case "zed", "junie":
+		if target.OutFile == "" {
+			target.OutFile = mergedFiles[kind]
+		}
+		add(rootTarget(target).OutFile, withoutNever(modules, kind))
+	case "custom":
+		add(rootTarget(target).OutFile, withoutNever(modules, kind))
 	}
-	return nil
-}
-
-func WriteMerged(outFile string, modules []pack.Module) error {
-	if outFile == "" {
-		return fmt.Errorf("missing output file")
-	}
-	if err := os.MkdirAll(filepath.Dir(outFile), 0o755); err != nil {
-		return err
-	}
-	content := mergedManagedHeader + "\n" + normalize(merge(modules, false))
-	return os.WriteFile(outFile, []byte(content), 0o644)
+	return out, nil
 }
 
 func PreviewManagedCleanup(targets map[string]config.TargetEntry) ([]string, []string, error) {
@@ -182,13 +1474,22 @@ func PreviewManagedCleanup(targets map[string]config.TargetEntry) ([]string, []s
 		var targetDelete []string
 		var targetSkip []string
 		var err error
-		switch name {
+		switch entry.Kind(name) {
 		case "cursor":
 			targetDelete, targetSkip, err = previewCursorCleanup(entry)
-		case "copilot", "codex":
-			targetDelete, targetSkip, err = previewMergedCleanup(entry)
+		case "copilot":
+			targetDelete, targetSkip, err = previewCopilotCleanup(entry)
+		case "codex":
+			targetDelete, targetSkip, err = previewCodexCleanup(entry)
 		case "claude":
 			targetDelete, targetSkip, err = previewClaudeCleanup(entry)
+		case "amazonq", "cline":
+			targetDelete, targetSkip, err = previewUnconditionalRulesCleanup(entry.Kind(name), entry)
+		case "zed", "junie":
+			if entry.OutFile == "" {
+				entry.OutFile = mergedFiles[entry.Kind(name)]
+			}
+			targetDelete, targetSkip, err = previewMergedCleanup(entry)
 		default:
 			continue
 		}
@@ -236,6 +1537,15 @@ func merge(modules []pack.Module, includeProvenance bool) string {
 	return b.String()
 }
 
+// rulesetHeader returns the line naming the lockfile ruleset digest an output
+// was built from, or nothing for builds without one.
+func rulesetHeader(digest string) string {
+	if digest == "" {
+		return ""
+	}
+	return fmt.Sprintf("<!-- rulepack:ruleset=%s -->\n", digest)
+}
+
 func provenanceHeader(m pack.Module) string {
 	shortCommit := m.Commit
 	if len(shortCommit) > 12 {
@@ -291,7 +1601,10 @@ func targetModuleFilename(module pack.Module, ext string) string {
 	return fmt.Sprintf("%03d-%s%s", module.Priority, base, ext)
 }
 
-func targetModuleFullPath(outDir string, module pack.Module, ext string) string {
+func targetModuleFullPath(outDir string, module pack.Module, ext string, layout string) string {
+	if layout == config.LayoutNamespace {
+		return namespaceModuleFullPath(outDir, module, ext)
+	}
 	nested := nestedOutputDirFromModulePath(module.Path)
 	name := targetModuleFilename(module, ext)
 	if nested == "" {
@@ -300,12 +1613,63 @@ func targetModuleFullPath(outDir string, module pack.Module, ext string) string
 	return filepath.Join(outDir, nested, name)
 }
 
+// namespaceModuleFullPath nests by module ID instead of source path:
+// "python.testing.base" -> <outDir>/python/testing/<priority>-base<ext>.
+func namespaceModuleFullPath(outDir string, module pack.Module, ext string) string {
+	parts := strings.Split(module.ID, ".")
+	name := fmt.Sprintf("%03d-%s%s", module.Priority, sanitizeID(parts[len(parts)-1]), ext)
+	segments := []string{outDir}
+	for _, part := range parts[:len(parts)-1] {
+		if part = sanitizeID(part); part != "" {
+			segments = append(segments, part)
+		}
+	}
+	return filepath.Join(append(segments, name)...)
+}
+
 func normalize(s string) string {
 	s = strings.ReplaceAll(s, "\r\n", "\n")
 	s = strings.ReplaceAll(s, "\r", "\n")
 	return strings.TrimRight(s, "\n") + "\n"
 }
 
+// rootTarget prefixes relative output paths with target.Root, after the caller
+// has applied its defaults.
+func rootTarget(target config.TargetEntry) config.TargetEntry {
+	if target.Root == "" {
+		return target
+	}
+	for _, field := range []*string{&target.OutDir, &target.OutFile, &target.SidecarDir} {
+		if *field != "" && !filepath.IsAbs(*field) {
+			*field = filepath.Join(target.Root, *field)
+		}
+	}
+	target.Root = ""
+	return target
+}
+
+// writeOutput writes LF-normalized content, converting to CRLF when the
+// target asks for Windows line endings.
+func writeOutput(path string, content string, target config.TargetEntry) error {
+	return os.WriteFile(path, []byte(withNewline(content+buildFooter(target.BuildID), target.Newline)), 0o644)
+}
+
+// buildFooter returns the last line of outputs stamped with a build ID, or
+// nothing when the target is not stamped.
+func buildFooter(buildID string) string {
+	if buildID == "" {
+		return ""
+	}
+	return fmt.Sprintf("<!-- rulepack:build-id=%s -->\n", buildID)
+}
+
+func withNewline(content string, newline string) string {
+	if newline == config.NewlineCRLF {
+		return strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	return content
+}
+
 type cursorApplyRule struct {
 	Mode        string
 	Description string
@@ -350,18 +1714,101 @@ func resolveCursorApplyRule(m pack.Module) (cursorApplyRule, error) {
 	return out, nil
 }
 
-func cursorPerModuleContent(ext string, m pack.Module, rule cursorApplyRule) (string, error) {
+func cursorPerModuleContent(ext string, m pack.Module, rule cursorApplyRule, digest string) (string, error) {
 	var b strings.Builder
+	body := m.Content
 	if strings.EqualFold(ext, ".mdc") {
-		b.WriteString(cursorFrontmatter(rule, m))
+		authored, rest, ok := splitFrontmatter(m.Content)
+		if ok {
+			body = rest
+			if rule.Description == "" {
+				rule.Description = frontmatterScalar(authored, "description")
+			}
+		}
+		b.WriteString(mergeFrontmatter(cursorFrontmatter(rule, m), authored))
 		b.WriteString("\n")
 	}
+	b.WriteString(rulesetHeader(digest))
 	b.WriteString(provenanceHeader(m))
 	b.WriteString("\n")
-	b.WriteString(m.Content)
+	b.WriteString(body)
 	return b.String(), nil
 }
 
+type frontmatterEntry struct {
+	Key  string
+	Text string
+}
+
+// splitFrontmatter separates a leading YAML frontmatter block into top-level
+// entries. Each entry keeps its raw lines, including nested or list values.
+func splitFrontmatter(content string) ([]frontmatterEntry, string, bool) {
+	if !strings.HasPrefix(content, "---\n") {
+		return nil, content, false
+	}
+	lines := strings.SplitAfter(content[len("---\n"):], "\n")
+	var entries []frontmatterEntry
+	for i, line := range lines {
+		if strings.TrimRight(line, "\r\n") == "---" {
+			return entries, strings.TrimLeft(strings.Join(lines[i+1:], ""), "\n"), true
+		}
+		if line == "" {
+			continue
+		}
+		if key, _, found := strings.Cut(line, ":"); found && !strings.ContainsAny(line[:1], " \t-#") {
+			entries = append(entries, frontmatterEntry{Key: strings.TrimSpace(key), Text: line})
+			continue
+		}
+		if len(entries) == 0 {
+			entries = append(entries, frontmatterEntry{Text: line})
+			continue
+		}
+		entries[len(entries)-1].Text += line
+	}
+	return nil, content, false
+}
+
+func frontmatterScalar(entries []frontmatterEntry, key string) string {
+	for _, e := range entries {
+		if e.Key != key {
+			continue
+		}
+		_, value, _ := strings.Cut(strings.TrimSpace(e.Text), ":")
+		value = strings.TrimSpace(value)
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			return unquoted
+		}
+		return strings.Trim(value, "'")
+	}
+	return ""
+}
+
+// mergeFrontmatter appends authored keys that the generated block does not
+// set, so generated keys win without dropping author-provided metadata.
+func mergeFrontmatter(generated string, authored []frontmatterEntry) string {
+	if len(authored) == 0 {
+		return generated
+	}
+	genEntries, _, _ := splitFrontmatter(generated)
+	seen := make(map[string]struct{}, len(genEntries))
+	for _, e := range genEntries {
+		seen[e.Key] = struct{}{}
+	}
+	var b strings.Builder
+	b.WriteString(strings.TrimSuffix(generated, "---\n"))
+	for _, e := range authored {
+		if _, ok := seen[e.Key]; ok {
+			continue
+		}
+		b.WriteString(e.Text)
+		if !strings.HasSuffix(e.Text, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString("---\n")
+	return b.String()
+}
+
 func resolveClaudeApplyRule(m pack.Module) (claudeApplyRule, error) {
 	var rule pack.ApplyRule
 	if targetRule, ok := m.Apply.Targets["claude"]; ok {
@@ -391,7 +1838,67 @@ func resolveClaudeApplyRule(m pack.Module) (claudeApplyRule, error) {
 	return out, nil
 }
 
-func claudePerModuleContent(m pack.Module, rule claudeApplyRule) string {
+// resolveCopilotApplyRule returns the module's copilot apply rule with the
+// mode lowercased and defaulting to always.
+func resolveCopilotApplyRule(m pack.Module) (cursorApplyRule, error) {
+	rule := targetApplyRule(m, "copilot")
+	mode := strings.ToLower(strings.TrimSpace(rule.Mode))
+	if mode == "" {
+		mode = "always"
+	}
+	out := cursorApplyRule{Mode: mode, Description: rule.Description}
+	switch mode {
+	case "always", "never", "agent", "manual":
+	case "glob":
+		if len(rule.Globs) == 0 {
+			return cursorApplyRule{}, fmt.Errorf("copilot apply mode glob requires globs for module %s", m.ID)
+		}
+		out.Globs = append([]string(nil), rule.Globs...)
+	default:
+		return cursorApplyRule{}, fmt.Errorf("unsupported copilot apply mode %q for module %s", rule.Mode, m.ID)
+	}
+	return out, nil
+}
+
+// copilotInstructionsContent is a path-specific instructions file. Copilot
+// applies a file to the paths its applyTo globs match, so always is "**" and
+// agent and manual modules get no applyTo, leaving them to be attached by
+// description or by hand.
+func copilotInstructionsContent(m pack.Module, rule cursorApplyRule, digest string) string {
+	var b strings.Builder
+	b.WriteString("---\n")
+	switch rule.Mode {
+	case "glob":
+		globs := append([]string(nil), rule.Globs...)
+		sort.Strings(globs)
+		b.WriteString("applyTo: ")
+		b.WriteString(quoteYAML(strings.Join(globs, ",")))
+		b.WriteString("\n")
+	case "agent", "manual":
+		desc := rule.Description
+		if desc == "" {
+			desc = "Apply when relevant: " + m.ID
+		}
+		b.WriteString("description: ")
+		b.WriteString(quoteYAML(desc))
+		b.WriteString("\n")
+	default:
+		b.WriteString("applyTo: \"**\"\n")
+	}
+	if rule.Mode == "glob" && rule.Description != "" {
+		b.WriteString("description: ")
+		b.WriteString(quoteYAML(rule.Description))
+		b.WriteString("\n")
+	}
+	b.WriteString("---\n\n")
+	b.WriteString(rulesetHeader(digest))
+	b.WriteString(provenanceHeader(m))
+	b.WriteString("\n")
+	b.WriteString(m.Content)
+	return b.String()
+}
+
+func claudePerModuleContent(m pack.Module, rule claudeApplyRule, digest string) string {
 	var b strings.Builder
 	if rule.Mode == "glob" {
 		b.WriteString("---\n")
@@ -406,6 +1913,7 @@ func claudePerModuleContent(m pack.Module, rule claudeApplyRule) string {
 		b.WriteString("---\n")
 		b.WriteString("\n")
 	}
+	b.WriteString(rulesetHeader(digest))
 	b.WriteString(provenanceHeader(m))
 	b.WriteString("\n")
 	b.WriteString(m.Content)
@@ -435,7 +1943,7 @@ func cursorWritePaths(target config.TargetEntry, modules []pack.Module) ([]strin
 		out := make([]string, 0, len(cursorModules))
 		pathToModule := make(map[string]string, len(cursorModules))
 		for _, m := range cursorModules {
-			fullPath := targetModuleFullPath(target.OutDir, m, ext)
+			fullPath := targetModuleFullPath(target.OutDir, m, ext, target.Layout)
 			if existingID, ok := pathToModule[fullPath]; ok {
 				return nil, fmt.Errorf("cursor output collision: modules %s and %s both map to %s", existingID, m.ID, fullPath)
 			}
@@ -444,19 +1952,18 @@ func cursorWritePaths(target config.TargetEntry, modules []pack.Module) ([]strin
 		}
 		return out, nil
 	}
-	for _, m := range cursorModules {
-		rule, err := resolveCursorApplyRule(m)
-		if err != nil {
-			return nil, err
-		}
-		if rule.Mode == "glob" || rule.Mode == "agent" || rule.Mode == "manual" {
-			return nil, fmt.Errorf("cursor target with perModule=false does not support apply mode %q for module %s", rule.Mode, m.ID)
-		}
+	_, sidecar, _, err := planCursorMerged(target, cursorModules)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]string, 0, len(sidecar)+1)
+	for _, m := range sidecar {
+		out = append(out, targetModuleFullPath(cursorSidecarDir(target), m, ".mdc", target.Layout))
 	}
 	if target.OutFile == "" {
 		target.OutFile = filepath.Join(target.OutDir, "rules"+ext)
 	}
-	return []string{target.OutFile}, nil
+	return append(out, target.OutFile), nil
 }
 
 func isRulepackManagedCursorContent(content string) bool {
@@ -483,17 +1990,30 @@ func previewCursorCleanup(target config.TargetEntry) ([]string, []string, error)
 	if target.OutFile == "" {
 		target.OutFile = filepath.Join(target.OutDir, "rules"+ext)
 	}
+	var deletable, skipped []string
+	if target.Fallback == config.FallbackSidecar {
+		var err error
+		deletable, skipped, err = previewPerModuleCleanup(cursorSidecarDir(target), ".mdc", isRulepackManagedCursorContent)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, p := range append(append([]string(nil), deletable...), skipped...) {
+			if filepath.Clean(p) == filepath.Clean(target.OutFile) {
+				return deletable, skipped, nil
+			}
+		}
+	}
 	data, err := os.ReadFile(target.OutFile)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, nil, nil
+			return deletable, skipped, nil
 		}
 		return nil, nil, err
 	}
 	if isRulepackManagedCursorContent(string(data)) {
-		return []string{target.OutFile}, nil, nil
+		return append(deletable, target.OutFile), skipped, nil
 	}
-	return nil, []string{target.OutFile}, nil
+	return deletable, append(skipped, target.OutFile), nil
 }
 
 func previewMergedCleanup(target config.TargetEntry) ([]string, []string, error) {
@@ -513,7 +2033,67 @@ func previewMergedCleanup(target config.TargetEntry) ([]string, []string, error)
 	return nil, []string{target.OutFile}, nil
 }
 
+func previewCodexCleanup(target config.TargetEntry) ([]string, []string, error) {
+	if !target.PerModule {
+		if target.ScopeByGlob {
+			return previewScopedCleanup(target)
+		}
+		return previewMergedCleanup(target)
+	}
+	outDir, ext, index := codexLayout(target)
+	deletable, skipped, err := previewPerModuleCleanup(outDir, ext, isRulepackManagedMergedContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	target.OutFile = index
+	indexDelete, indexSkip, err := previewMergedCleanup(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(deletable, indexDelete...), append(skipped, indexSkip...), nil
+}
+
+// previewScopedCleanup walks the project for managed copies of outFile's base
+// name, since the scoped directories depend on modules that are being removed.
+func previewScopedCleanup(target config.TargetEntry) ([]string, []string, error) {
+	deletable, skipped, err := previewMergedCleanup(target)
+	if err != nil || target.OutFile == "" {
+		return deletable, skipped, err
+	}
+	root := filepath.Clean(target.OutFile)
+	name := filepath.Base(target.OutFile)
+	err = filepath.WalkDir(".", func(path string, d os.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" || d.Name() == "node_modules" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Name() != name || filepath.Clean(path) == root {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if isRulepackManagedMergedContent(string(data)) {
+			deletable = append(deletable, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return deletable, skipped, nil
+}
+
 func previewClaudeCleanup(target config.TargetEntry) ([]string, []string, error) {
+	if !target.PerModule {
+		return previewMergedCleanup(claudeMergedTarget(target))
+	}
 	ext := target.Ext
 	if ext == "" {
 		ext = ".md"
@@ -524,6 +2104,31 @@ func previewClaudeCleanup(target config.TargetEntry) ([]string, []string, error)
 	return previewPerModuleCleanup(target.OutDir, ext, isRulepackManagedCursorContent)
 }
 
+func previewCopilotCleanup(target config.TargetEntry) ([]string, []string, error) {
+	if !target.PerModule {
+		return previewMergedCleanup(target)
+	}
+	deletable, skipped, err := previewPerModuleCleanup(copilotInstructionsTarget(target).OutDir, ".md", isRulepackManagedCursorContent)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Only .instructions.md files are ours; hand-written notes beside them are
+	// neither deleted nor reported.
+	isInstructions := func(p string) bool { return !strings.HasSuffix(p, copilotInstructionsExt) }
+	return slices.DeleteFunc(deletable, isInstructions), slices.DeleteFunc(skipped, isInstructions), nil
+}
+
+func previewUnconditionalRulesCleanup(kind string, target config.TargetEntry) ([]string, []string, error) {
+	ext := target.Ext
+	if ext == "" {
+		ext = ".md"
+	}
+	if target.OutDir == "" {
+		target.OutDir = ruleDirs[kind]
+	}
+	return previewPerModuleCleanup(target.OutDir, ext, isRulepackManagedCursorContent)
+}
+
 func previewPerModuleCleanup(outDir, ext string, isManaged func(string) bool) ([]string, []string, error) {
 	info, err := os.Stat(outDir)
 	if err != nil {
@@ -3,6 +3,7 @@ package render
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
@@ -67,6 +68,30 @@ func TestWriteCursorApplyModes(t *testing.T) {
 	}
 }
 
+func TestWriteCursorMergesAuthoredFrontmatter(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "rules")
+	target := config.TargetEntry{OutDir: outDir, PerModule: true, Ext: ".mdc"}
+	modules := []pack.Module{{
+		ID:       "a",
+		Priority: 100,
+		Content:  "---\ndescription: \"Authored description\"\nalwaysApply: true\ntags:\n  - python\n---\n\nBody\n",
+		Apply: pack.ApplyConfig{
+			Default: &pack.ApplyRule{Mode: "agent"},
+		},
+	}}
+	if err := WriteCursor(target, modules); err != nil {
+		t.Fatalf("WriteCursor: %v", err)
+	}
+	content := mustReadFile(t, filepath.Join(outDir, "100-a.mdc"))
+	want := "---\nalwaysApply: false\ndescription: \"Authored description\"\ntags:\n  - python\n---\n\n<!-- pack= version= commit= module=a priority=100 -->\nBody\n"
+	if content != want {
+		t.Fatalf("unexpected merged frontmatter:\n%s", content)
+	}
+	if strings.Count(content, "---\n") != 2 {
+		t.Fatalf("expected a single frontmatter block, got %q", content)
+	}
+}
+
 func TestWriteCursorGlobModeRequiresGlobs(t *testing.T) {
 	outDir := filepath.Join(t.TempDir(), "rules")
 	target := config.TargetEntry{
@@ -106,6 +131,73 @@ func TestWriteCursorPreservesNestedModulePath(t *testing.T) {
 	}
 }
 
+func TestWriteCursorNamespaceLayout(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "rules")
+	target := config.TargetEntry{OutDir: outDir, PerModule: true, Ext: ".mdc", Layout: config.LayoutNamespace}
+	modules := []pack.Module{
+		{ID: "python.base", Path: "modules/flat/python-base.md", Priority: 100, Content: "P\n"},
+		{ID: "python.testing.pytest", Path: "modules/flat/pytest.md", Priority: 200, Content: "T\n"},
+		{ID: "general", Path: "modules/flat/general.md", Priority: 50, Content: "G\n"},
+	}
+	if err := WriteCursor(target, modules); err != nil {
+		t.Fatalf("WriteCursor: %v", err)
+	}
+	for _, rel := range []string{"python/100-base.mdc", "python/testing/200-pytest.mdc", "050-general.mdc"} {
+		if _, err := os.Stat(filepath.Join(outDir, filepath.FromSlash(rel))); err != nil {
+			t.Fatalf("expected %s: %v", rel, err)
+		}
+	}
+}
+
+func TestWriteCursorMergedFallbacks(t *testing.T) {
+	modules := []pack.Module{
+		{ID: "a.base", Path: "modules/base.md", Priority: 100, Content: "A\n"},
+		{
+			ID:       "b.agent",
+			Path:     "modules/agent.md",
+			Priority: 200,
+			Content:  "B\n",
+			Apply:    pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "agent", Description: "Backend work"}},
+		},
+	}
+
+	outDir := filepath.Join(t.TempDir(), "rules")
+	target := config.TargetEntry{OutDir: outDir, Ext: ".md"}
+	if err := WriteCursor(target, modules); err == nil || !strings.Contains(err.Error(), "set fallback to skip or sidecar") {
+		t.Fatalf("expected default fallback to error, got %v", err)
+	}
+
+	target.Fallback = config.FallbackSkip
+	warnings, err := CursorMergedFallbacks(target, modules)
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "skips module b.agent") {
+		t.Fatalf("unexpected skip warnings %#v err=%v", warnings, err)
+	}
+	if err := WriteCursor(target, modules); err != nil {
+		t.Fatalf("WriteCursor skip: %v", err)
+	}
+	merged := mustReadFile(t, filepath.Join(outDir, "rules.md"))
+	if !strings.Contains(merged, "A\n") || strings.Contains(merged, "B\n") {
+		t.Fatalf("expected agent module skipped from merged output, got %q", merged)
+	}
+
+	target.Fallback = config.FallbackSidecar
+	target.SidecarDir = filepath.Join(outDir, "sidecar")
+	if err := WriteCursor(target, modules); err != nil {
+		t.Fatalf("WriteCursor sidecar: %v", err)
+	}
+	sidecar := mustReadFile(t, filepath.Join(target.SidecarDir, "200-agent.mdc"))
+	if !strings.Contains(sidecar, "description: \"Backend work\"") || !strings.Contains(sidecar, "B\n") {
+		t.Fatalf("expected agent module in sidecar with frontmatter, got %q", sidecar)
+	}
+	deletable, _, err := PreviewManagedCleanup(map[string]config.TargetEntry{"cursor": target})
+	if err != nil {
+		t.Fatalf("PreviewManagedCleanup: %v", err)
+	}
+	if len(deletable) != 2 {
+		t.Fatalf("expected merged file and sidecar in cleanup, got %#v", deletable)
+	}
+}
+
 func TestWriteCursorDetectsNestedPathCollision(t *testing.T) {
 	outDir := filepath.Join(t.TempDir(), "rules")
 	target := config.TargetEntry{OutDir: outDir, PerModule: true, Ext: ".mdc"}
@@ -183,7 +275,7 @@ func TestCursorUnmanagedOverwrites_IgnoresManagedCollision(t *testing.T) {
 func TestWriteMergedAddsManagedHeader(t *testing.T) {
 	outFile := filepath.Join(t.TempDir(), "rules.md")
 	modules := []pack.Module{{ID: "a", Priority: 100, Content: "A\n"}}
-	if err := WriteMerged(outFile, modules); err != nil {
+	if err := WriteMerged(config.TargetEntry{OutFile: outFile}, modules); err != nil {
 		t.Fatalf("WriteMerged: %v", err)
 	}
 	content := mustReadFile(t, outFile)
@@ -192,6 +284,50 @@ func TestWriteMergedAddsManagedHeader(t *testing.T) {
 	}
 }
 
+func TestWriteMergedCRLFNewline(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "rules.md")
+	modules := []pack.Module{{ID: "a", Priority: 100, Content: "line one\nline two\n"}}
+	if err := WriteMerged(config.TargetEntry{OutFile: outFile, Newline: config.NewlineCRLF}, modules); err != nil {
+		t.Fatalf("WriteMerged: %v", err)
+	}
+	content := mustReadFile(t, outFile)
+	if !strings.Contains(content, "line one\r\nline two\r\n") || strings.Contains(strings.ReplaceAll(content, "\r\n", ""), "\n") {
+		t.Fatalf("expected CRLF line endings throughout, got %q", content)
+	}
+}
+
+func TestWriteCodexPerTopicWithIndex(t *testing.T) {
+	root := t.TempDir()
+	target := config.TargetEntry{
+		OutDir:    filepath.Join(root, ".codex", "rules"),
+		OutFile:   filepath.Join(root, ".codex", "rules.md"),
+		PerModule: true,
+	}
+	modules := []pack.Module{
+		{ID: "python.base", Priority: 100, Content: "P1\n"},
+		{ID: "general", Priority: 150, Content: "G\n"},
+		{ID: "python.tests", Priority: 200, Content: "P2\n"},
+	}
+	if err := WriteCodex(target, modules); err != nil {
+		t.Fatalf("WriteCodex: %v", err)
+	}
+	python := mustReadFile(t, filepath.Join(target.OutDir, "python.md"))
+	if python != "<!-- rulepack:managed -->\nP1\n\nP2\n" {
+		t.Fatalf("unexpected topic file %q", python)
+	}
+	index := mustReadFile(t, target.OutFile)
+	if !strings.Contains(index, "- [python](rules/python.md)\n- [general](rules/general.md)\n") {
+		t.Fatalf("unexpected index %q", index)
+	}
+	deletable, _, err := PreviewManagedCleanup(map[string]config.TargetEntry{"codex": target})
+	if err != nil {
+		t.Fatalf("PreviewManagedCleanup: %v", err)
+	}
+	if len(deletable) != 3 {
+		t.Fatalf("expected index and topic files in cleanup, got %#v", deletable)
+	}
+}
+
 func TestWriteClaudeWritesPerModuleMarkdown(t *testing.T) {
 	outDir := filepath.Join(t.TempDir(), "rules")
 	target := config.TargetEntry{
@@ -306,9 +442,10 @@ func TestWriteClaude_GlobRequiresGlobs(t *testing.T) {
 }
 
 func TestWriteClaude_RejectsOutFile(t *testing.T) {
+	dir := t.TempDir()
 	target := config.TargetEntry{
-		OutDir:    filepath.Join(t.TempDir(), "rules"),
-		OutFile:   "CLAUDE.md",
+		OutDir:    filepath.Join(dir, "rules"),
+		OutFile:   filepath.Join(dir, "CLAUDE.md"),
 		PerModule: true,
 		Ext:       ".md",
 	}
@@ -318,15 +455,23 @@ func TestWriteClaude_RejectsOutFile(t *testing.T) {
 	}
 }
 
-func TestWriteClaude_RejectsPerModuleFalse(t *testing.T) {
-	target := config.TargetEntry{
-		OutDir:    filepath.Join(t.TempDir(), "rules"),
-		PerModule: false,
-		Ext:       ".md",
+func TestWriteClaude_MergedWritesClaudeMDWithoutNeverModules(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "CLAUDE.md")
+	target := config.TargetEntry{OutFile: outFile}
+	modules := []pack.Module{
+		{ID: "a", Priority: 100, Content: "A\n", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "glob", Globs: []string{"src/**"}}}},
+		{ID: "b", Priority: 200, Content: "B\n", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"claude": {Mode: "never"}}}},
 	}
-	err := WriteClaude(target, []pack.Module{{ID: "a", Priority: 100, Content: "A\n"}})
-	if err == nil || !strings.Contains(err.Error(), "requires perModule=true") {
-		t.Fatalf("expected perModule validation error, got %v", err)
+	if err := WriteClaude(target, modules); err != nil {
+		t.Fatalf("write claude: %v", err)
+	}
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("read CLAUDE.md: %v", err)
+	}
+	content := string(data)
+	if !strings.HasPrefix(content, mergedManagedHeader) || !strings.Contains(content, "A\n") || strings.Contains(content, "B\n") {
+		t.Fatalf("unexpected merged claude output:\n%s", content)
 	}
 }
 
@@ -502,3 +647,493 @@ func mustReadFile(t *testing.T, path string) string {
 	}
 	return string(bytes)
 }
+
+func TestWriteAmazonQWritesPerModuleRules(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), ".amazonq", "rules")
+	target := config.TargetEntry{OutDir: outDir}
+	modules := []pack.Module{
+		{ID: "a.never", Priority: 100, Content: "A\n", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"amazonq": {Mode: "never"}}}},
+		{ID: "backend.api", Path: "modules/backend/api.md", Priority: 110, Content: "B\n"},
+	}
+	if err := WriteAmazonQ(target, modules); err != nil {
+		t.Fatalf("WriteAmazonQ: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "100-a_never.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected never module to be skipped, stat err=%v", err)
+	}
+	content := mustReadFile(t, filepath.Join(outDir, "backend", "110-api.md"))
+	if !strings.HasPrefix(content, "<!-- pack=") || !strings.HasSuffix(content, "B\n") {
+		t.Fatalf("unexpected amazonq content: %q", content)
+	}
+	if err := WriteAmazonQ(config.TargetEntry{OutFile: "rules.md"}, modules); err == nil {
+		t.Fatalf("expected outFile to be rejected")
+	}
+}
+
+func TestWriteClineWritesPriorityPrefixedRules(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), ".clinerules")
+	modules := []pack.Module{
+		{ID: "a.never", Priority: 100, Content: "A\n", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"cline": {Mode: "never"}}}},
+		{ID: "style", Path: "modules/style.md", Priority: 105, Content: "S\n", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "glob", Globs: []string{"**/*.go"}}}},
+		{ID: "backend.api", Path: "modules/backend/api.md", Priority: 110, Content: "B\n"},
+	}
+	if err := WriteCline(config.TargetEntry{OutDir: outDir}, modules); err != nil {
+		t.Fatalf("WriteCline: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "100-a_never.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected never module to be skipped, stat err=%v", err)
+	}
+	if content := mustReadFile(t, filepath.Join(outDir, "105-style.md")); !strings.HasSuffix(content, "S\n") {
+		t.Fatalf("expected glob module as an unconditional rule, got %q", content)
+	}
+	content := mustReadFile(t, filepath.Join(outDir, "backend", "110-api.md"))
+	if !strings.HasPrefix(content, "<!-- pack=") || !strings.HasSuffix(content, "B\n") {
+		t.Fatalf("unexpected cline content: %q", content)
+	}
+	paths, err := OutputModules("cline", config.TargetEntry{}, modules)
+	if err != nil {
+		t.Fatalf("OutputModules: %v", err)
+	}
+	if got := paths[filepath.Join(".clinerules", "backend", "110-api.md")]; len(got) != 1 || got[0] != "backend.api" || len(paths) != 2 {
+		t.Fatalf("unexpected cline output modules: %v", paths)
+	}
+	if err := WriteCline(config.TargetEntry{OutFile: "rules.md"}, modules); err == nil || err.Error() != "cline target does not support outFile; use outDir" {
+		t.Fatalf("expected outFile to be rejected, got %v", err)
+	}
+}
+
+func TestWriteCopilotPerModuleWritesInstructionsFiles(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "instructions")
+	target := config.TargetEntry{OutDir: outDir, PerModule: true}
+	copilot := func(rule pack.ApplyRule) pack.ApplyConfig {
+		return pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"copilot": rule}}
+	}
+	modules := []pack.Module{
+		{ID: "a.always", Priority: 100, Content: "A\n"},
+		{ID: "b.glob", Priority: 110, Content: "B\n", Apply: copilot(pack.ApplyRule{Mode: "glob", Globs: []string{"src/**/*.ts", "lib/**/*.ts"}})},
+		{ID: "c.manual", Priority: 120, Content: "C\n", Apply: copilot(pack.ApplyRule{Mode: "manual", Description: "Release checklist"})},
+		{ID: "d.never", Priority: 130, Content: "D\n", Apply: copilot(pack.ApplyRule{Mode: "never"})},
+	}
+	if err := WriteCopilot(target, modules); err != nil {
+		t.Fatalf("WriteCopilot: %v", err)
+	}
+	if content := mustReadFile(t, filepath.Join(outDir, "100-a_always.instructions.md")); !strings.HasPrefix(content, "---\napplyTo: \"**\"\n---\n\n<!-- pack=") {
+		t.Fatalf("expected applyTo ** frontmatter, got %q", content)
+	}
+	if content := mustReadFile(t, filepath.Join(outDir, "110-b_glob.instructions.md")); !strings.HasPrefix(content, "---\napplyTo: \"lib/**/*.ts,src/**/*.ts\"\n---\n") {
+		t.Fatalf("expected sorted applyTo globs, got %q", content)
+	}
+	if content := mustReadFile(t, filepath.Join(outDir, "120-c_manual.instructions.md")); !strings.HasPrefix(content, "---\ndescription: \"Release checklist\"\n---\n") {
+		t.Fatalf("expected description without applyTo, got %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "130-d_never.instructions.md")); !os.IsNotExist(err) {
+		t.Fatalf("expected never module skipped, stat err=%v", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "notes.md"), []byte("<!-- pack=x -->\n"), 0o644); err != nil {
+		t.Fatalf("write notes: %v", err)
+	}
+	deletable, skipped, err := PreviewManagedCleanup(map[string]config.TargetEntry{"copilot": target})
+	if err != nil {
+		t.Fatalf("PreviewManagedCleanup: %v", err)
+	}
+	if len(deletable) != 3 || len(skipped) != 0 {
+		t.Fatalf("expected only the three instructions files, got delete=%v skip=%v", deletable, skipped)
+	}
+	if _, err := RenderSingleFile("copilot", target, modules); err == nil {
+		t.Fatalf("expected RenderSingleFile to reject perModule copilot")
+	}
+}
+
+func TestRulesUnmanagedOverwrites_WarnsOnNonManagedCollision(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "rules")
+	modules := []pack.Module{
+		{ID: "python.base", Priority: 100, Content: "A\n"},
+		{ID: "go.base", Priority: 110, Content: "B\n"},
+	}
+	if err := WriteAmazonQ(config.TargetEntry{OutDir: outDir}, modules[1:]); err != nil {
+		t.Fatalf("WriteAmazonQ: %v", err)
+	}
+	existing := filepath.Join(outDir, "100-python_base.md")
+	if err := os.WriteFile(existing, []byte("manual content\n"), 0o644); err != nil {
+		t.Fatalf("WriteFile existing: %v", err)
+	}
+
+	warnings, err := RulesUnmanagedOverwrites("amazonq", config.TargetEntry{OutDir: outDir}, modules)
+	if err != nil {
+		t.Fatalf("RulesUnmanagedOverwrites: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0] != existing {
+		t.Fatalf("expected only the hand-written file, got %v", warnings)
+	}
+}
+
+func TestWriteCustomExecutesTemplate(t *testing.T) {
+	dir := t.TempDir()
+	tmplPath := filepath.Join(dir, "rules.tmpl")
+	tmpl := "# {{.RulesetDigest}}\n{{range .Modules}}## {{.ID}} ({{.Priority}}, {{.Mode}}{{if .Globs}}: {{join .Globs \", \"}}{{end}}) from {{.Pack}}@{{.Version}}\n{{.Content}}{{end}}"
+	if err := os.WriteFile(tmplPath, []byte(tmpl), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	modules := []pack.Module{
+		{ID: "a.base", PackName: "rules", PackVersion: "1.0.0", Priority: 100, Content: "A\n"},
+		{ID: "b.never", Priority: 105, Content: "N\n", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"custom": {Mode: "never"}}}},
+		{ID: "c.go", PackName: "rules", PackVersion: "1.0.0", Priority: 110, Content: "C\n", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "Glob", Globs: []string{"**/*.go", "go.mod"}}}},
+	}
+	outFile := filepath.Join(dir, "out", "rules.txt")
+	target := config.TargetEntry{Template: tmplPath, OutFile: outFile, RulesetDigest: "abc"}
+	if err := WriteCustom(target, modules); err != nil {
+		t.Fatalf("WriteCustom: %v", err)
+	}
+	want := "# abc\n## a.base (100, always) from rules@1.0.0\nA\n## c.go (110, glob: **/*.go, go.mod) from rules@1.0.0\nC\n"
+	if got := mustReadFile(t, outFile); got != want {
+		t.Fatalf("unexpected custom output:\n%s", got)
+	}
+	if got, err := RenderSingleFile("custom", target, modules); err != nil || got != want {
+		t.Fatalf("expected --stdout output to match the written file, got %q, %v", got, err)
+	}
+	paths, err := OutputModules("custom", target, modules)
+	if err != nil || len(paths[outFile]) != 2 {
+		t.Fatalf("unexpected custom output modules: %v, %v", paths, err)
+	}
+
+	if err := os.WriteFile(tmplPath, []byte("{{.Missing}}"), 0o644); err != nil {
+		t.Fatalf("write template: %v", err)
+	}
+	if err := WriteCustom(target, modules); err == nil || !strings.Contains(err.Error(), "custom template "+tmplPath) {
+		t.Fatalf("expected template execution error, got %v", err)
+	}
+}
+
+func TestWriteZedOmitsNeverModules(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), ".rules")
+	modules := []pack.Module{
+		{ID: "a.keep", Priority: 100, Content: "A\n"},
+		{ID: "b.never", Priority: 110, Content: "B\n", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"zed": {Mode: "never"}}}},
+	}
+	if err := WriteZed(config.TargetEntry{OutFile: outFile}, modules); err != nil {
+		t.Fatalf("WriteZed: %v", err)
+	}
+	content := mustReadFile(t, outFile)
+	if !strings.HasPrefix(content, mergedManagedHeader) || !strings.Contains(content, "A\n") || strings.Contains(content, "B\n") {
+		t.Fatalf("unexpected zed content: %q", content)
+	}
+}
+
+func TestWriteJunieWritesGuidelinesWithoutNeverModules(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+	modules := []pack.Module{
+		{ID: "a.keep", Priority: 100, Content: "A\n"},
+		{ID: "b.never", Priority: 110, Content: "B\n", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"junie": {Mode: "never"}}}},
+	}
+	if err := WriteJunie(config.TargetEntry{}, modules); err != nil {
+		t.Fatalf("WriteJunie: %v", err)
+	}
+	content := mustReadFile(t, filepath.Join(".junie", "guidelines.md"))
+	if !strings.HasPrefix(content, mergedManagedHeader) || !strings.Contains(content, "A\n") || strings.Contains(content, "B\n") {
+		t.Fatalf("unexpected junie content: %q", content)
+	}
+	streamed, err := RenderSingleFile("junie", config.TargetEntry{}, modules)
+	if err != nil || streamed != content {
+		t.Fatalf("expected streamed junie output to match the file, got %q, %v", streamed, err)
+	}
+}
+
+func TestWriteCodexScopeByGlobSplitsIntoDirectories(t *testing.T) {
+	oldWD, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatalf("chdir: %v", err)
+	}
+	defer func() { _ = os.Chdir(oldWD) }()
+	glob := func(globs ...string) pack.ApplyConfig {
+		return pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "glob", Globs: globs}}
+	}
+	modules := []pack.Module{
+		{ID: "a.root", Priority: 100, Content: "ROOT\n"},
+		{ID: "b.api", Priority: 110, Content: "API\n", Apply: glob("services/api/**/*.go")},
+		{ID: "c.web", Priority: 120, Content: "WEB\n", Apply: glob("services/web/*.ts", "**/*.md")},
+	}
+	target := config.TargetEntry{OutFile: "AGENTS.md", ScopeByGlob: true}
+	if err := WriteCodex(target, modules); err != nil {
+		t.Fatalf("WriteCodex: %v", err)
+	}
+	root := mustReadFile(t, "AGENTS.md")
+	if !strings.Contains(root, "ROOT") || !strings.Contains(root, "WEB") || strings.Contains(root, "API") {
+		t.Fatalf("unexpected root content: %q", root)
+	}
+	api := mustReadFile(t, filepath.Join("services", "api", "AGENTS.md"))
+	if !strings.HasPrefix(api, mergedManagedHeader) || !strings.Contains(api, "API") || strings.Contains(api, "ROOT") {
+		t.Fatalf("unexpected api content: %q", api)
+	}
+	if web := mustReadFile(t, filepath.Join("services", "web", "AGENTS.md")); !strings.Contains(web, "WEB") {
+		t.Fatalf("unexpected web content: %q", web)
+	}
+
+	deletable, _, err := PreviewManagedCleanup(map[string]config.TargetEntry{"codex": target})
+	if err != nil {
+		t.Fatalf("PreviewManagedCleanup: %v", err)
+	}
+	if len(deletable) != 3 {
+		t.Fatalf("expected root and both scoped files in cleanup, got %v", deletable)
+	}
+}
+
+func TestGlobDir(t *testing.T) {
+	cases := map[string]string{
+		"services/api/**/*.go": "services/api",
+		"src/main.go":          "src",
+		"**/*.md":              "",
+		"*.go":                 "",
+		"../other/*.go":        "",
+		"!services/api/*.go":   "",
+		"./web/{a,b}/*.ts":     "web",
+	}
+	for glob, want := range cases {
+		if got := globDir(glob); got != want {
+			t.Fatalf("globDir(%q) = %q, want %q", glob, got, want)
+		}
+	}
+}
+
+func TestEffectiveEvaluatesApplyRulesForPath(t *testing.T) {
+	modules := []pack.Module{
+		{ID: "a.always", Priority: 100},
+		{ID: "b.py", Priority: 110, Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "glob", Globs: []string{"src/**/*.py"}}}},
+		{ID: "c.agent", Priority: 120, Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "agent", Description: "x"}}},
+		{ID: "d.never", Priority: 130, Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"cursor": {Mode: "never"}}}},
+	}
+	target := config.TargetEntry{PerModule: true}
+	got, err := Effective("cursor", target, modules, "./src/pkg/foo.py")
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	want := []string{"applies", "applies", "conditional", "excluded"}
+	for i, m := range got {
+		if m.Status != want[i] {
+			t.Fatalf("module %s: status %q, want %q (%+v)", m.ID, m.Status, want[i], got)
+		}
+	}
+	got, err = Effective("cursor", target, modules, "README.md")
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	if got[1].Status != "excluded" {
+		t.Fatalf("expected glob module excluded for README.md, got %+v", got[1])
+	}
+	got, err = Effective("copilot", config.TargetEntry{}, modules, "")
+	if err != nil {
+		t.Fatalf("Effective: %v", err)
+	}
+	for _, m := range got {
+		if m.Status != "applies" {
+			t.Fatalf("expected copilot to apply every module, got %+v", m)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"src/**/*.py", "src/foo.py", true},
+		{"src/**/*.py", "src/a/b/foo.py", true},
+		{"src/**/*.py", "lib/foo.py", false},
+		{"**/*.md", "README.md", true},
+		{"*.go", "cmd/main.go", false},
+		{"docs/**", "docs/a/b.md", true},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.name); got != c.want {
+			t.Fatalf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestEvaluateGlobsPerTarget(t *testing.T) {
+	m := pack.Module{
+		ID: "py.style",
+		Apply: pack.ApplyConfig{
+			Default: &pack.ApplyRule{Mode: "glob", Globs: []string{"src/**/*.py"}},
+			Targets: map[string]pack.ApplyRule{"claude": {Mode: "never"}, "codex": {Mode: "glob", Globs: []string{"src/[a-"}}},
+		},
+	}
+	results := EvaluateGlobs(m, []string{"src/a/b.py", "README.md"})
+	if len(results) != 6 {
+		t.Fatalf("expected 6 results, got %d", len(results))
+	}
+	if r := results[0]; r.Target != "cursor" || !r.Matched || r.Glob != "src/**/*.py" {
+		t.Fatalf("unexpected cursor result: %+v", r)
+	}
+	if r := results[1]; r.Matched {
+		t.Fatalf("expected README.md not to match: %+v", r)
+	}
+	if r := results[2]; r.Target != "claude" || r.Mode != "never" || r.Matched {
+		t.Fatalf("unexpected claude result: %+v", r)
+	}
+	if r := results[4]; r.Target != "codex" || r.Error == "" {
+		t.Fatalf("expected codex invalid glob error: %+v", r)
+	}
+}
+
+func TestLintNamespacesFlagsSharedPrefixes(t *testing.T) {
+	modules := []pack.Module{
+		{PackName: "py-core", ID: "python.base"},
+		{PackName: "py-core", ID: "python.style"},
+		{PackName: "py-extra", ID: "python.lint"},
+		{PackName: "py-extra", ID: "go.lint"},
+		{PackName: "go-core", ID: "golang.base"},
+		{PackName: "misc", ID: "readme"},
+		{PackName: "misc2", ID: "readme2"},
+	}
+	got := LintNamespaces(modules)
+	want := []LintIssue{{
+		Rule:    "namespace-collision",
+		Module:  "python.*",
+		Level:   "warn",
+		Message: `namespace "python" is shared by packs py-core (python.base), py-extra (python.lint)`,
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected namespace issues:\n got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestLintBandsChecksDeclaredRanges(t *testing.T) {
+	bands := []config.PriorityBand{{Name: "safety", Min: 0, Max: 99}}
+	modules := []pack.Module{
+		{ID: "safety.ok", Priority: 10, Band: "safety"},
+		{ID: "safety.late", Priority: 150, Band: "safety"},
+		{ID: "style.base", Priority: 200, Band: "style"},
+		{ID: "misc", Priority: 5000},
+	}
+	got := LintBands(modules, bands)
+	if len(got) != 2 || got[0].Rule != "priority-outside-band" || got[0].Module != "safety.late" || got[1].Rule != "unknown-band" {
+		t.Fatalf("unexpected band issues: %+v", got)
+	}
+	if got[0].Message != "priority 150 is outside band safety (0-99)" {
+		t.Fatalf("unexpected message: %q", got[0].Message)
+	}
+}
+
+func TestLintTerminologyReportsTermsPerModule(t *testing.T) {
+	terms := &config.Terminology{
+		Banned:    []string{"simply"},
+		Preferred: map[string]string{"blacklist": "denylist", "e-mail": "email"},
+	}
+	modules := []pack.Module{
+		{ID: "a", Path: "modules/a.md", Content: "Simply run it.\nAdd hosts to the Blacklist.\nsimply again\n"},
+		{ID: "b", Content: "Send an e-mail; blacklisted and simplyfied do not count.\n"},
+		{ID: "c", Content: "nothing to report\n"},
+	}
+	got := LintTerminology(modules, terms)
+	want := []LintIssue{
+		{Rule: "banned-term", Module: "a", Path: "modules/a.md", Level: "error", Line: 1, Message: `banned term "simply" on lines 1, 3`},
+		{Rule: "preferred-term", Module: "a", Path: "modules/a.md", Level: "warn", Line: 2, Message: `use "denylist" instead of "blacklist" on line 2`},
+		{Rule: "preferred-term", Module: "b", Level: "warn", Line: 1, Message: `use "email" instead of "e-mail" on line 1`},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected terminology issues:\n got %+v\nwant %+v", got, want)
+	}
+	if got := LintTerminology(modules, nil); len(got) != 0 {
+		t.Fatalf("expected no issues without a dictionary, got %+v", got)
+	}
+}
+
+func TestLintApplyFlagsContradictoryRules(t *testing.T) {
+	modules := []pack.Module{
+		{ID: "a.noglobs", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "glob"}}},
+		{ID: "b.agent", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "agent", Description: "d"}}},
+		{ID: "c.bogus", Apply: pack.ApplyConfig{Targets: map[string]pack.ApplyRule{"cursor": {Mode: "sometimes"}, "copilot": {Mode: "agent"}, "cusor": {Mode: "never"}}}},
+		{ID: "d.ignored", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "always", Globs: []string{"*.go"}}}},
+	}
+	got := LintApply("cursor", "cursor", config.TargetEntry{}, modules)
+	want := []LintIssue{
+		{Rule: "glob-without-globs", Module: "a.noglobs", Target: "cursor", Level: "error", Message: "apply mode glob has no globs"},
+		{Rule: "merged-conditional", Module: "a.noglobs", Target: "cursor", Level: "error", Message: "apply mode glob needs perModule=true or a skip/sidecar fallback"},
+		{Rule: "merged-conditional", Module: "b.agent", Target: "cursor", Level: "error", Message: "apply mode agent needs perModule=true or a skip/sidecar fallback"},
+		{Rule: "unsupported-mode", Module: "c.bogus", Target: "cursor", Level: "error", Message: `unsupported apply mode "sometimes"`},
+		{Rule: "ignored-globs", Module: "d.ignored", Target: "cursor", Level: "warn", Message: "globs are ignored with apply mode always"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("unexpected cursor issues:\n got %+v\nwant %+v", got, want)
+	}
+
+	got = LintApply("copilot", "copilot", config.TargetEntry{}, modules)
+	if len(got) != 3 || got[0].Level != "warn" || got[1].Message != "apply mode agent is ignored; copilot includes every module" {
+		t.Fatalf("unexpected copilot issues: %+v", got)
+	}
+
+	unknown := LintApplyTargets(modules)
+	if len(unknown) != 1 || unknown[0].Target != "cusor" || unknown[0].Rule != "unknown-apply-target" {
+		t.Fatalf("expected unknown apply target key, got %+v", unknown)
+	}
+
+	ids := map[string]bool{}
+	for _, rule := range LintRules {
+		ids[rule.ID] = true
+	}
+	for _, issue := range append(got, LintApply("cursor", "cursor", config.TargetEntry{}, modules)...) {
+		if !ids[issue.Rule] {
+			t.Fatalf("issue rule %q missing from LintRules", issue.Rule)
+		}
+	}
+}
+
+func TestSmoke(t *testing.T) {
+	cases := []struct {
+		name    string
+		path    string
+		content string
+		want    []string
+	}{
+		{"valid mdc", "a.mdc", "---\nalwaysApply: false\ndescription: \"say \\\"hi\\\"\"\nglobs:\n  - \"**/*.go\"\n---\n\nbody\n", []string{}},
+		{"crlf mdc", "a.mdc", "---\r\nalwaysApply: true\r\n---\r\nbody\r\n", []string{}},
+		{"setext heading", "a.md", "Title\n=======\n", []string{}},
+		{"mdc without frontmatter", "a.mdc", "body\n", []string{"missing frontmatter; Cursor rules must start with ---"}},
+		{"unclosed frontmatter", "a.md", "---\npaths:\n  - \"a\"\n", []string{"frontmatter is not closed with ---"}},
+		{"conflict markers", "a.md", "one\n<<<<<<< local\ntwo\n=======\nthree\n>>>>>>> source\n", []string{`line 2: merge conflict marker "<<<<<<< local"`, `line 6: merge conflict marker ">>>>>>> source"`}},
+		{"bad frontmatter", "a.mdc", "---\nalwaysApply: yes\ndescription: \"open\nno key here\n\tglobs: x\n---\n", []string{
+			"frontmatter line 2: alwaysApply must be true or false",
+			`frontmatter line 3: unterminated quoted value for "description"`,
+			"frontmatter line 4: expected key: value",
+			"frontmatter line 5: indented with a tab",
+		}},
+		{"duplicate key", "a.mdc", "---\nalwaysApply: true\nalwaysApply: false\n---\n", []string{`frontmatter line 3: duplicate key "alwaysApply"`}},
+		{"encoding", "a.md", "\xef\xbb\xbfhi\x00\n", []string{"starts with a byte order mark", "contains NUL bytes"}},
+		{"invalid utf8", "a.md", "\xff\n", []string{"not valid UTF-8"}},
+	}
+	for _, tc := range cases {
+		if got := Smoke(tc.path, []byte(tc.content)); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%s: Smoke = %#v, want %#v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestCoverageCountsOnlyGlobScopedModules(t *testing.T) {
+	modules := []pack.Module{
+		{ID: "always.base", Content: "a\n"},
+		{ID: "py.style", Content: "p\n", Apply: pack.ApplyConfig{Default: &pack.ApplyRule{Mode: "glob", Globs: []string{"**/*.py"}}}},
+	}
+	groups, err := Coverage("cursor", config.TargetEntry{PerModule: true, Ext: ".mdc"}, modules, []string{"app/main.py", "app/README", "setup.py"})
+	if err != nil {
+		t.Fatalf("Coverage: %v", err)
+	}
+	want := []CoverageGroup{
+		{By: "dir", Key: ".", Files: 1, Covered: 1, Modules: []string{"py.style"}},
+		{By: "dir", Key: "app", Files: 2, Covered: 1, Modules: []string{"py.style"}},
+		{By: "ext", Key: "(none)", Files: 1, Covered: 0, Modules: []string{}},
+		{By: "ext", Key: ".py", Files: 2, Covered: 2, Modules: []string{"py.style"}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Fatalf("Coverage = %#v, want %#v", groups, want)
+	}
+}
@@ -0,0 +1,119 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Smoke checks that a generated file will load in the assistant that reads
+// it and returns one message per problem. It checks encoding, leftover merge
+// conflict markers, and frontmatter, which .mdc files must have.
+func Smoke(path string, content []byte) []string {
+	problems := []string{}
+	switch {
+	case !utf8.Valid(content):
+		problems = append(problems, "not valid UTF-8")
+	case bytes.HasPrefix(content, []byte("\xef\xbb\xbf")):
+		problems = append(problems, "starts with a byte order mark")
+	}
+	if bytes.IndexByte(content, 0) >= 0 {
+		problems = append(problems, "contains NUL bytes")
+	}
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	for i, line := range strings.Split(text, "\n") {
+		if isConflictMarker(line) {
+			problems = append(problems, fmt.Sprintf("line %d: merge conflict marker %q", i+1, strings.TrimSpace(line)))
+		}
+	}
+	if strings.HasPrefix(text, "---\n") {
+		problems = append(problems, smokeFrontmatter(text)...)
+	} else if strings.EqualFold(filepath.Ext(path), ".mdc") {
+		problems = append(problems, "missing frontmatter; Cursor rules must start with ---")
+	}
+	return problems
+}
+
+// isConflictMarker reports whether line opens or closes a merge conflict.
+// A bare ======= is also a markdown heading underline, so it is not checked.
+func isConflictMarker(line string) bool {
+	for _, marker := range []string{"<<<<<<<", ">>>>>>>", "|||||||"} {
+		if line == marker || strings.HasPrefix(line, marker+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// smokeFrontmatter checks the YAML frontmatter at the start of text with
+// the rules every assistant's parser enforces: a closing ---, key: value
+// lines without duplicate keys, no tab indentation, and closed quotes.
+func smokeFrontmatter(text string) []string {
+	problems := []string{}
+	lines := strings.Split(text, "\n")
+	closed := false
+	seen := map[string]bool{}
+	for i := 1; i < len(lines); i++ {
+		line := lines[i]
+		if line == "---" {
+			closed = true
+			break
+		}
+		n := i + 1
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "\t") {
+			problems = append(problems, fmt.Sprintf("frontmatter line %d: indented with a tab", n))
+			continue
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if trimmed != line || strings.HasPrefix(line, "- ") || line == "-" {
+			// Nested values and list items belong to the key above.
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			problems = append(problems, fmt.Sprintf("frontmatter line %d: expected key: value", n))
+			continue
+		}
+		key = strings.TrimSpace(key)
+		if seen[key] {
+			problems = append(problems, fmt.Sprintf("frontmatter line %d: duplicate key %q", n, key))
+		}
+		seen[key] = true
+		if !quotesClosed(strings.TrimSpace(value)) {
+			problems = append(problems, fmt.Sprintf("frontmatter line %d: unterminated quoted value for %q", n, key))
+		}
+		if key == "alwaysApply" && strings.TrimSpace(value) != "true" && strings.TrimSpace(value) != "false" {
+			problems = append(problems, fmt.Sprintf("frontmatter line %d: alwaysApply must be true or false", n))
+		}
+	}
+	if !closed {
+		problems = append(problems, "frontmatter is not closed with ---")
+	}
+	return problems
+}
+
+// quotesClosed reports whether a quoted scalar ends with its opening quote.
+// Unquoted values always pass.
+func quotesClosed(value string) bool {
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return true
+	}
+	quote := value[0]
+	if len(value) < 2 || value[len(value)-1] != quote {
+		return false
+	}
+	if quote == '"' {
+		// The closing quote must not be escaped.
+		backslashes := 0
+		for i := len(value) - 2; i > 0 && value[i] == '\\'; i-- {
+			backslashes++
+		}
+		return backslashes%2 == 0
+	}
+	return true
+}
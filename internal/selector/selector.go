@@ -0,0 +1,122 @@
+package selector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Match returns the indexes of the candidates a selector names. Each
+// candidate has one or more names, such as a profile's ID and alias. Exact
+// matches win; only when there are none do candidates with a name starting
+// with the selector match.
+func Match(selector string, candidates [][]string) []int {
+	var matches []int
+	for i, names := range candidates {
+		if hasName(names, func(name string) bool { return name == selector }) {
+			matches = append(matches, i)
+		}
+	}
+	if len(matches) > 0 || selector == "" {
+		return matches
+	}
+	for i, names := range candidates {
+		if hasName(names, func(name string) bool { return strings.HasPrefix(name, selector) }) {
+			matches = append(matches, i)
+		}
+	}
+	return matches
+}
+
+func hasName(names []string, match func(string) bool) bool {
+	for _, name := range names {
+		if name != "" && match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxSuggestions caps how many names Suggest returns.
+const maxSuggestions = 3
+
+// Suggest returns up to three names that look like a mistyped selector:
+// names containing it first, then names within a small edit distance,
+// closest first.
+func Suggest(selector string, names []string) []string {
+	if selector == "" {
+		return nil
+	}
+	limit := len(selector) / 3
+	if limit < 2 {
+		limit = 2
+	}
+	type scored struct {
+		name  string
+		score int
+	}
+	seen := map[string]bool{}
+	found := []scored{}
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if strings.Contains(name, selector) {
+			found = append(found, scored{name: name, score: 0})
+			continue
+		}
+		if d := distance(selector, name); d <= limit {
+			found = append(found, scored{name: name, score: d})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].score == found[j].score {
+			return found[i].name < found[j].name
+		}
+		return found[i].score < found[j].score
+	})
+	out := make([]string, 0, maxSuggestions)
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		out = append(out, found[i].name)
+	}
+	return out
+}
+
+// Hint formats suggestions for the end of a not-found error, e.g.
+// ` (did you mean "python" or "pytest"?)`, or returns "" when there are none.
+func Hint(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	if len(quoted) == 1 {
+		return " (did you mean " + quoted[0] + "?)"
+	}
+	return " (did you mean " + strings.Join(quoted[:len(quoted)-1], ", ") + " or " + quoted[len(quoted)-1] + "?)"
+}
+
+// distance is the Levenshtein edit distance between a and b.
+func distance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(br)]
+}
@@ -0,0 +1,45 @@
+package selector
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMatchPrefersExactThenPrefix(t *testing.T) {
+	candidates := [][]string{{"abc123", "python"}, {"abd456", "python-ml"}, {"ffe789", ""}}
+	tests := []struct {
+		selector string
+		want     []int
+	}{
+		{selector: "python", want: []int{0}},
+		{selector: "python-", want: []int{1}},
+		{selector: "ab", want: []int{0, 1}},
+		{selector: "ff", want: []int{2}},
+		{selector: "zz", want: nil},
+		{selector: "", want: nil},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.selector, candidates); !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("Match(%q) = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+}
+
+func TestSuggestAndHint(t *testing.T) {
+	names := []string{"../shared-rules", "python", "pytest", "golang", ""}
+	if got := Suggest("pyton", names); !reflect.DeepEqual(got, []string{"python"}) {
+		t.Fatalf("unexpected suggestions: %v", got)
+	}
+	if got := Suggest("shared", names); !reflect.DeepEqual(got, []string{"../shared-rules"}) {
+		t.Fatalf("expected substring suggestion, got %v", got)
+	}
+	if got := Suggest("rust", names); len(got) != 0 {
+		t.Fatalf("expected no suggestions, got %v", got)
+	}
+	if got := Hint([]string{"python", "pytest"}); got != ` (did you mean "python" or "pytest"?)` {
+		t.Fatalf("unexpected hint: %q", got)
+	}
+	if got := Hint(nil); got != "" {
+		t.Fatalf("expected empty hint, got %q", got)
+	}
+}